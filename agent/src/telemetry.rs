@@ -6,9 +6,14 @@ use std::time::{SystemTime, UNIX_EPOCH};
 use tokio::sync::mpsc;
 use tracing::{info, error, debug};
 use serde::{Serialize, Deserialize};
+use uuid::Uuid;
 
 use crate::config::AgentConfig;
 
+/// Event schema version this agent produces; sent with every event so the ingestor can
+/// upgrade or reject it
+pub const SCHEMA_VERSION: u32 = 2;
+
 /// Event types matching the protobuf enum
 #[derive(Debug, Clone, Copy, Serialize, Deserialize)]
 pub enum EventType {
@@ -37,6 +42,9 @@ pub struct Event {
     pub tenant_id: String,
     pub hostname: String,
     pub os_type: String,
+    pub sequence: u64,          // Assigned by the telemetry client; 0 until sent
+    pub sequence_epoch: String, // Identifies this agent run; sequences restart at 1 per epoch
+    pub schema_version: u32,
 }
 
 impl Event {
@@ -65,31 +73,55 @@ impl Event {
                 .to_string_lossy()
                 .to_string(),
             os_type: std::env::consts::OS.to_string(),
+            sequence: 0,
+            sequence_epoch: String::new(),
+            schema_version: SCHEMA_VERSION,
         }
     }
 }
 
 pub struct TelemetryClient {
     config: AgentConfig,
+    /// Random per-run ID sent with every event so the ingestor can tell a restart
+    /// (sequence back to 1) from replayed or reordered events
+    sequence_epoch: String,
+    next_sequence: u64,
 }
 
 impl TelemetryClient {
     pub async fn new(config: AgentConfig) -> Result<Self> {
-        Ok(Self { config })
+        Ok(Self {
+            config,
+            sequence_epoch: Uuid::new_v4().to_string(),
+            next_sequence: 1,
+        })
+    }
+
+    /// Number an event in send order. Collectors run concurrently, so sequences are assigned
+    /// here, at the single point every event passes through, rather than at capture.
+    fn assign_sequence(&mut self, event: &mut Event) {
+        event.sequence = self.next_sequence;
+        event.sequence_epoch = self.sequence_epoch.clone();
+        self.next_sequence += 1;
     }
 
     /// Run the telemetry client, receiving events from the channel and streaming to ingestor.
     /// TODO: Implement actual gRPC streaming (requires generated protobuf code).
-    pub async fn run(self, mut event_rx: mpsc::Receiver<Event>) -> Result<()> {
-        info!("Telemetry client connected to: {}", self.config.ingestor_url);
+    pub async fn run(mut self, mut event_rx: mpsc::Receiver<Event>) -> Result<()> {
+        info!(
+            "Telemetry client connected to: {} (sequence epoch {})",
+            self.config.ingestor_url, self.sequence_epoch
+        );
 
         // TODO: Establish gRPC stream using tonic
         // let mut client = telemetry_client::TelemetryServiceClient::connect(self.config.ingestor_url).await?;
         // let stream = client.stream_events(...).await?;
 
-        while let Some(event) = event_rx.recv().await {
+        while let Some(mut event) = event_rx.recv().await {
+            self.assign_sequence(&mut event);
             debug!(
-                "Received event: type={:?}, mitre={}, payload_len={}",
+                "Received event: seq={}, type={:?}, mitre={}, payload_len={}",
+                event.sequence,
                 event.event_type,
                 event.mitre_tactic,
                 event.payload.len()
@@ -0,0 +1,65 @@
+// Async Inserts
+// Optional ClickHouse server-side insert buffering for throughput over per-batch durability
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// AsyncInsert holds the settings sent with each event batch when async inserts are enabled.
+//
+// With async inserts ClickHouse buffers rows from many batches and writes them as one part,
+// cutting part count and merge load at high ingest rates. The trade-off depends on the wait mode:
+//
+//   - wait (the default): Send returns once the buffer holding the batch is flushed to the table.
+//     Messages are acked only then, so delivery is as durable as synchronous inserts; each batch
+//     takes up to the busy timeout longer.
+//   - no wait: Send returns once ClickHouse has the rows in memory. Messages are acked before
+//     the rows are written, so a ClickHouse crash loses up to one busy timeout of acked events,
+//     and insert errors from the flush are only visible in ClickHouse's logs.
+type AsyncInsert struct {
+	wait          bool
+	busyTimeoutMs int
+}
+
+// NewAsyncInsertFromEnv reads CONSUMER_ASYNC_INSERT, CONSUMER_ASYNC_INSERT_WAIT and
+// CONSUMER_ASYNC_INSERT_BUSY_TIMEOUT_MS. It returns nil when async inserts are disabled.
+func NewAsyncInsertFromEnv() (*AsyncInsert, error) {
+	enabled, err := strconv.ParseBool(getEnv("CONSUMER_ASYNC_INSERT", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONSUMER_ASYNC_INSERT: %w", err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	wait, err := strconv.ParseBool(getEnv("CONSUMER_ASYNC_INSERT_WAIT", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONSUMER_ASYNC_INSERT_WAIT: %w", err)
+	}
+	busyTimeout, err := strconv.Atoi(getEnv("CONSUMER_ASYNC_INSERT_BUSY_TIMEOUT_MS", "1000"))
+	if err != nil || busyTimeout <= 0 {
+		return nil, fmt.Errorf("invalid CONSUMER_ASYNC_INSERT_BUSY_TIMEOUT_MS %q", getEnv("CONSUMER_ASYNC_INSERT_BUSY_TIMEOUT_MS", ""))
+	}
+	return &AsyncInsert{wait: wait, busyTimeoutMs: busyTimeout}, nil
+}
+
+// Context returns ctx carrying the async insert settings, or ctx unchanged when a is nil
+func (a *AsyncInsert) Context(ctx context.Context) context.Context {
+	if a == nil {
+		return ctx
+	}
+	wait := 0
+	if a.wait {
+		wait = 1
+	}
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"async_insert":                 1,
+		"wait_for_async_insert":        wait,
+		"async_insert_busy_timeout_ms": a.busyTimeoutMs,
+	}))
+}
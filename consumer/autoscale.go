@@ -0,0 +1,198 @@
+// Worker Autoscaling
+// Grows and shrinks the worker pool between configured bounds from JetStream lag and ClickHouse
+// insert latency
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// autoscaleSustain is how many consecutive evaluations must agree before the pool is resized
+const autoscaleSustain = 2
+
+// workerPool runs worker goroutines, each with its own context so one can be stopped alone.
+// A stopped worker flushes its pending batch before it exits.
+type workerPool struct {
+	ctx     context.Context
+	c       *Consumer
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	cancels []context.CancelFunc // Newest last; shrinking stops the newest workers first
+	nextID  int
+}
+
+func newWorkerPool(ctx context.Context, c *Consumer) *workerPool {
+	return &workerPool{ctx: ctx, c: c}
+}
+
+// resize starts or stops workers until n are running
+func (p *workerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.cancels) < n && p.ctx.Err() == nil {
+		workerCtx, cancel := context.WithCancel(p.ctx)
+		p.cancels = append(p.cancels, cancel)
+		p.wg.Add(1)
+		go func(workerID int) {
+			defer p.wg.Done()
+			p.c.worker(workerCtx, workerID)
+		}(p.nextID)
+		p.nextID++
+	}
+	for len(p.cancels) > n {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+	p.c.workers.Store(int64(len(p.cancels)))
+}
+
+// size returns the number of running workers
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cancels)
+}
+
+// wait blocks until every worker has exited
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
+// Autoscaler resizes the worker pool. It scales up while lag stays above scaleUpLag, unless
+// ClickHouse inserts are already slower than maxLatency, since more writers would only add to
+// the load. It scales down while lag stays below scaleDownLag or inserts are too slow. The gap
+// between the two lag thresholds, the sustain count and the cooldown keep it from oscillating.
+type Autoscaler struct {
+	minWorkers   int
+	maxWorkers   int
+	interval     time.Duration
+	cooldown     time.Duration
+	scaleUpLag   uint64
+	scaleDownLag uint64
+	maxLatency   time.Duration // Average batch insert time above which the pool does not grow
+}
+
+// NewAutoscalerFromEnv creates the autoscaler configured by CONSUMER_MIN_WORKERS,
+// CONSUMER_MAX_WORKERS, CONSUMER_SCALE_INTERVAL, CONSUMER_SCALE_COOLDOWN, CONSUMER_SCALE_UP_LAG,
+// CONSUMER_SCALE_DOWN_LAG and CONSUMER_SCALE_MAX_INSERT_LATENCY. Autoscaling is disabled (nil)
+// unless CONSUMER_MAX_WORKERS is above CONSUMER_MIN_WORKERS.
+func NewAutoscalerFromEnv() (*Autoscaler, error) {
+	minWorkers, err := strconv.Atoi(getEnv("CONSUMER_MIN_WORKERS", strconv.Itoa(workerCount)))
+	if err != nil || minWorkers < 1 {
+		return nil, fmt.Errorf("invalid CONSUMER_MIN_WORKERS %q", getEnv("CONSUMER_MIN_WORKERS", ""))
+	}
+	maxWorkers, err := strconv.Atoi(getEnv("CONSUMER_MAX_WORKERS", strconv.Itoa(minWorkers)))
+	if err != nil || maxWorkers < minWorkers {
+		return nil, fmt.Errorf("invalid CONSUMER_MAX_WORKERS %q; must be at least CONSUMER_MIN_WORKERS", getEnv("CONSUMER_MAX_WORKERS", ""))
+	}
+	if maxWorkers == minWorkers {
+		return nil, nil
+	}
+
+	a := &Autoscaler{minWorkers: minWorkers, maxWorkers: maxWorkers}
+	durations := []struct {
+		key, def string
+		dst      *time.Duration
+	}{
+		{"CONSUMER_SCALE_INTERVAL", "30s", &a.interval},
+		{"CONSUMER_SCALE_COOLDOWN", "2m", &a.cooldown},
+		{"CONSUMER_SCALE_MAX_INSERT_LATENCY", "5s", &a.maxLatency},
+	}
+	for _, d := range durations {
+		value, err := time.ParseDuration(getEnv(d.key, d.def))
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", d.key, getEnv(d.key, ""))
+		}
+		*d.dst = value
+	}
+
+	if a.scaleUpLag, err = strconv.ParseUint(getEnv("CONSUMER_SCALE_UP_LAG", "20000"), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid CONSUMER_SCALE_UP_LAG %q", getEnv("CONSUMER_SCALE_UP_LAG", ""))
+	}
+	if a.scaleDownLag, err = strconv.ParseUint(getEnv("CONSUMER_SCALE_DOWN_LAG", "2000"), 10, 64); err != nil || a.scaleDownLag >= a.scaleUpLag {
+		return nil, fmt.Errorf("invalid CONSUMER_SCALE_DOWN_LAG %q; must be below CONSUMER_SCALE_UP_LAG", getEnv("CONSUMER_SCALE_DOWN_LAG", ""))
+	}
+	return a, nil
+}
+
+// Run evaluates the pool every interval until ctx is cancelled. It holds the current size while
+// the lag reading is stale.
+func (a *Autoscaler) Run(ctx context.Context, c *Consumer, pool *workerPool) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	var upStreak, downStreak int
+	var lastScale time.Time
+	lastBatches, lastNanos := c.batchesFlushed.Load(), c.flushNanos.Load()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Average insert time of the batches flushed since the last evaluation
+		batches, nanos := c.batchesFlushed.Load(), c.flushNanos.Load()
+		var latency time.Duration
+		if batches > lastBatches {
+			latency = time.Duration((nanos - lastNanos) / (batches - lastBatches))
+		}
+		lastBatches, lastNanos = batches, nanos
+
+		if time.Since(time.Unix(c.lag.lastPoll.Load(), 0)) > 3*c.lag.interval {
+			upStreak, downStreak = 0, 0
+			continue
+		}
+
+		lag := c.lag.Lag()
+		workers := pool.size()
+		slow := latency > a.maxLatency
+
+		switch {
+		case slow && workers > a.minWorkers:
+			upStreak, downStreak = 0, downStreak+1
+		case lag > a.scaleUpLag && !slow && workers < a.maxWorkers:
+			upStreak, downStreak = upStreak+1, 0
+		case lag < a.scaleDownLag && workers > a.minWorkers:
+			upStreak, downStreak = 0, downStreak+1
+		default:
+			upStreak, downStreak = 0, 0
+		}
+
+		if time.Since(lastScale) < a.cooldown {
+			continue
+		}
+
+		target := workers
+		if upStreak >= autoscaleSustain {
+			// Grow quickly to absorb a burst, shrink one worker at a time
+			target = workers * 2
+			if target > a.maxWorkers {
+				target = a.maxWorkers
+			}
+		} else if downStreak >= autoscaleSustain {
+			target = workers - 1
+		}
+		if target == workers {
+			continue
+		}
+
+		pool.resize(target)
+		upStreak, downStreak = 0, 0
+		lastScale = time.Now()
+		log.WithFields(log.Fields{
+			"lag_messages":   lag,
+			"insert_latency": latency.Round(time.Millisecond).String(),
+		}).Infof("Scaled consumer workers from %d to %d", workers, target)
+	}
+}
@@ -0,0 +1,263 @@
+// Schema Bootstrap
+// Creates telemetry_events on startup and warns when an existing table has drifted
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed telemetry_events.sql
+var telemetryEventsDDL string
+
+// schemaBootstrapTimeout bounds the DDL and drift checks; ALTERs on a large table only change metadata
+const schemaBootstrapTimeout = 2 * time.Minute
+
+// Table structure the consumer and the API rely on
+const (
+	expectedPartitionKey = "toYYYYMM(timestamp)"
+	expectedSortingKey   = "tenant_id, timestamp, event_type, agent_id, event_id"
+)
+
+// expectedColumns are the telemetry_events column types as ClickHouse reports them in
+// system.columns. event_type is checked against eventTypeMap instead.
+var expectedColumns = map[string]string{
+	"event_id":           "UUID",
+	"agent_id":           "String",
+	"tenant_id":          "String",
+	"timestamp":          "DateTime64(3)",
+	"server_timestamp":   "DateTime64(3)",
+	"mitre_tactic":       "LowCardinality(String)",
+	"mitre_technique":    "LowCardinality(String)",
+	"severity":           "UInt8",
+	"hostname":           "LowCardinality(String)",
+	"os_type":            "LowCardinality(String)",
+	"payload":            "String",
+	"process_name":       "String",
+	"file_path":          "String",
+	"dst_ip":             "String",
+	"dst_port":           "UInt16",
+	"username":           "String",
+	"dst_country":        "LowCardinality(String)",
+	"dst_asn":            "UInt32",
+	"dst_as_org":         "LowCardinality(String)",
+	"dst_hostname":       "String",
+	"process_reputation": "LowCardinality(String)",
+	"src_country":        "LowCardinality(String)",
+	"batch_id":           "UUID",
+	"redacted":           "Bool",
+	"agent_timestamp":    "DateTime64(3)",
+	"timestamp_clamped":  "Bool",
+	"ingestion_date":     "Date",
+}
+
+// ddlIndexPattern extracts index names from the embedded DDL
+var ddlIndexPattern = regexp.MustCompile(`ADD INDEX IF NOT EXISTS (\w+)`)
+
+// EnsureSchemaFromEnv creates telemetry_events, its columns and its indexes if missing, then
+// compares the table with what the consumer expects and logs a warning for each difference.
+// CLICKHOUSE_SCHEMA_BOOTSTRAP=false skips the DDL, for deployments whose consumer user may not
+// run it, and only checks for drift. Drift never stops the consumer: the table may have been
+// tuned on purpose, and an incompatible one fails on insert anyway.
+//
+// Only telemetry_events is bootstrapped. The rollup views, ledger and policy tables still come
+// from schema.sql.
+func EnsureSchemaFromEnv(conn driver.Conn) error {
+	create, err := strconv.ParseBool(getEnv("CLICKHOUSE_SCHEMA_BOOTSTRAP", "true"))
+	if err != nil {
+		return fmt.Errorf("invalid CLICKHOUSE_SCHEMA_BOOTSTRAP: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), schemaBootstrapTimeout)
+	defer cancel()
+
+	if create {
+		if err := applySchema(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	drift, err := schemaDrift(ctx, conn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("telemetry_events does not exist; apply schema.sql or set CLICKHOUSE_SCHEMA_BOOTSTRAP=true")
+	}
+	if err != nil {
+		// The check is advisory; a consumer without access to system tables still runs
+		log.Warnf("Failed to check telemetry_events schema: %v", err)
+		return nil
+	}
+	for _, difference := range drift {
+		log.WithField("table", "telemetry_events").Warnf("Schema drift: %s", difference)
+	}
+	if len(drift) == 0 {
+		log.Info("telemetry_events schema verified")
+	}
+	return nil
+}
+
+// applySchema runs the embedded DDL. Creating the table must succeed; a failed ALTER is only
+// logged, since the column or index it adds is then reported as drift.
+func applySchema(ctx context.Context, conn driver.Conn) error {
+	statements := schemaStatements(telemetryEventsDDL)
+	if err := conn.Exec(ctx, statements[0]); err != nil {
+		return fmt.Errorf("failed to create telemetry_events: %w", err)
+	}
+	for _, statement := range statements[1:] {
+		if err := conn.Exec(ctx, statement); err != nil {
+			log.Warnf("Failed to apply schema statement %q: %v", strings.SplitN(statement, "\n", 2)[0], err)
+		}
+	}
+	log.Infof("Applied telemetry_events schema (%d statements)", len(statements))
+	return nil
+}
+
+// schemaStatements splits DDL into statements, dropping comment lines. A statement ends with a
+// semicolon at the end of a line.
+func schemaStatements(ddl string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(ddl, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	return statements
+}
+
+// schemaDrift describes how the live telemetry_events differs from the expected structure
+func schemaDrift(ctx context.Context, conn driver.Conn) ([]string, error) {
+	var drift []string
+
+	var engine, engineFull, partitionKey, sortingKey string
+	if err := conn.QueryRow(ctx, `
+		SELECT engine, engine_full, partition_key, sorting_key
+		FROM system.tables
+		WHERE database = currentDatabase() AND name = 'telemetry_events'
+	`).Scan(&engine, &engineFull, &partitionKey, &sortingKey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read table definition: %w", err)
+	}
+	if engine != "MergeTree" && engine != "ReplicatedMergeTree" {
+		drift = append(drift, fmt.Sprintf("engine is %s, expected MergeTree", engine))
+	}
+	if partitionKey != expectedPartitionKey {
+		drift = append(drift, fmt.Sprintf("partition key is %q, expected %q", partitionKey, expectedPartitionKey))
+	}
+	if sortingKey != expectedSortingKey {
+		drift = append(drift, fmt.Sprintf("sorting key is %q, expected %q; tenant and time range queries may scan more data", sortingKey, expectedSortingKey))
+	}
+	if !strings.Contains(engineFull, " TTL ") {
+		drift = append(drift, "no TTL set; events are never expired")
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT name, type
+		FROM system.columns
+		WHERE database = currentDatabase() AND table = 'telemetry_events'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	columns := make(map[string]string)
+	for rows.Next() {
+		var name, columnType string
+		if err := rows.Scan(&name, &columnType); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read columns: %w", err)
+		}
+		columns[name] = columnType
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	names := make([]string, 0, len(expectedColumns))
+	for name := range expectedColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected := expectedColumns[name]
+		actual, ok := columns[name]
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("column %s is missing", name))
+		case actual != expected:
+			drift = append(drift, fmt.Sprintf("column %s is %s, expected %s", name, actual, expected))
+		}
+	}
+	drift = append(drift, eventTypeDrift(columns["event_type"])...)
+
+	rows, err = conn.Query(ctx, `
+		SELECT name
+		FROM system.data_skipping_indices
+		WHERE database = currentDatabase() AND table = 'telemetry_events'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+	indexes := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read indexes: %w", err)
+		}
+		indexes[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	for _, match := range ddlIndexPattern.FindAllStringSubmatch(telemetryEventsDDL, -1) {
+		if !indexes[match[1]] {
+			drift = append(drift, fmt.Sprintf("index %s is missing", match[1]))
+		}
+	}
+
+	return drift, nil
+}
+
+// eventTypeDrift checks that the event_type enum has every value the consumer inserts
+func eventTypeDrift(columnType string) []string {
+	if columnType == "" {
+		return []string{"column event_type is missing"}
+	}
+	if !strings.HasPrefix(columnType, "Enum8(") {
+		return []string{fmt.Sprintf("column event_type is %s, expected Enum8", columnType)}
+	}
+	values := []string{"unspecified"}
+	for _, value := range eventTypeMap {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	var drift []string
+	for _, value := range values {
+		if !strings.Contains(columnType, "'"+value+"' = ") {
+			drift = append(drift, fmt.Sprintf("event_type has no %q value; inserts of those events fail", value))
+		}
+	}
+	return drift
+}
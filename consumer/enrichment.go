@@ -0,0 +1,452 @@
+// Privé Consumer - Event Enrichment
+// Annotates events with GeoIP/ASN, reverse DNS and process reputation before insert
+
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Enrichment cache configuration
+	enrichCacheSize = 100000           // Max cached lookups per cache
+	enrichCacheTTL  = 30 * time.Minute // Lifetime of a cached lookup
+	rdnsTimeout     = 200 * time.Millisecond
+
+	// Reverse DNS runs off the ingest path: cache misses are queued for a small pool of
+	// resolvers and the event is stored without a hostname
+	rdnsWorkers   = 8
+	rdnsQueueSize = 4096
+
+	// Process reputation verdicts
+	reputationUnknown   = "unknown"
+	reputationKnownGood = "known_good"
+	reputationMalicious = "malicious"
+)
+
+// GeoInfo holds the GeoIP/ASN data resolved for an IP address
+type GeoInfo struct {
+	Country string
+	ASN     uint32
+	ASOrg   string
+}
+
+// geoRange is a single IP range entry of the GeoIP database
+type geoRange struct {
+	start net.IP
+	end   net.IP
+	info  GeoInfo
+}
+
+// GeoIPDatabase performs IP to country/ASN lookups against an in-memory range table.
+// The database is loaded from a CSV file with rows: network_cidr,country_code,asn,as_org
+type GeoIPDatabase struct {
+	ranges []geoRange
+}
+
+// LoadGeoIPDatabase reads a GeoIP CSV file into a sorted range table
+func LoadGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	defer file.Close()
+
+	db := &GeoIPDatabase{}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ",", 4)
+		if len(fields) < 3 {
+			log.Warnf("GeoIP database line %d: expected at least 3 fields", lineNum)
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(strings.TrimSpace(fields[0]))
+		if err != nil {
+			// Skip header rows and malformed networks
+			continue
+		}
+
+		asn, _ := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(fields[2]), "AS"), 10, 32)
+		info := GeoInfo{
+			Country: strings.TrimSpace(fields[1]),
+			ASN:     uint32(asn),
+		}
+		if len(fields) == 4 {
+			info.ASOrg = strings.Trim(strings.TrimSpace(fields[3]), `"`)
+		}
+
+		start := network.IP.To16()
+		end := make(net.IP, len(start))
+		mask := net.IP(network.Mask)
+		if len(mask) == net.IPv4len {
+			mask = append(net.IP{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, mask...)
+		}
+		for i := range start {
+			end[i] = start[i] | ^mask[i]
+		}
+
+		db.ranges = append(db.ranges, geoRange{start: start, end: end, info: info})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return compareIP(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+
+	return db, nil
+}
+
+// Lookup returns the GeoIP/ASN info for an IP, if it falls into a known range
+func (g *GeoIPDatabase) Lookup(ip net.IP) (GeoInfo, bool) {
+	ip = ip.To16()
+	if ip == nil || len(g.ranges) == 0 {
+		return GeoInfo{}, false
+	}
+
+	// Find the last range starting at or before the IP
+	idx := sort.Search(len(g.ranges), func(i int) bool {
+		return compareIP(g.ranges[i].start, ip) > 0
+	}) - 1
+	if idx < 0 {
+		return GeoInfo{}, false
+	}
+
+	r := g.ranges[idx]
+	if compareIP(ip, r.end) > 0 {
+		return GeoInfo{}, false
+	}
+	return r.info, true
+}
+
+// compareIP compares two 16-byte IP addresses
+func compareIP(a, b net.IP) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ReputationDatabase maps process hashes to reputation verdicts.
+// Loaded from a CSV file with rows: sha256,verdict (verdict is known_good or malicious)
+type ReputationDatabase struct {
+	verdicts map[string]string
+}
+
+// LoadReputationDatabase reads a hash reputation CSV file
+func LoadReputationDatabase(path string) (*ReputationDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reputation database: %w", err)
+	}
+	defer file.Close()
+
+	db := &ReputationDatabase{verdicts: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ",", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		verdict := strings.ToLower(strings.TrimSpace(fields[1]))
+		if verdict != reputationKnownGood && verdict != reputationMalicious {
+			continue
+		}
+		db.verdicts[strings.ToLower(strings.TrimSpace(fields[0]))] = verdict
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reputation database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Lookup returns the verdict for a process hash
+func (r *ReputationDatabase) Lookup(hash string) string {
+	if verdict, ok := r.verdicts[strings.ToLower(hash)]; ok {
+		return verdict
+	}
+	return reputationUnknown
+}
+
+// cacheEntry is a single cached enrichment lookup
+type cacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// lookupCache is a bounded TTL cache shared by all workers. When full, the least recently
+// used entry is evicted so the hot set survives.
+type lookupCache struct {
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first
+	maxSize int
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+func newLookupCache(maxSize int, ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		maxSize: maxSize,
+		ttl:     ttl,
+	}
+}
+
+func (c *lookupCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lookupCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// addrResolver resolves IP addresses to host names; *net.Resolver implements it
+type addrResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Enricher annotates events with network and process context before insert
+type Enricher struct {
+	geoIP      *GeoIPDatabase
+	reputation *ReputationDatabase
+	rdns       bool
+	resolver   addrResolver
+
+	geoCache  *lookupCache
+	rdnsCache *lookupCache
+	repCache  *lookupCache
+
+	// Background reverse DNS; rdnsPending holds the IPs queued or being resolved
+	rdnsQueue   chan string
+	rdnsPending map[string]struct{}
+	rdnsMu      sync.Mutex
+}
+
+// NewEnricherFromEnv builds an enricher from environment configuration.
+// ENRICH_GEOIP_DB and ENRICH_REPUTATION_DB point at the lookup databases,
+// ENRICH_RDNS=true enables background reverse DNS resolution of destination IPs.
+func NewEnricherFromEnv() *Enricher {
+	e := &Enricher{
+		rdns:      getEnv("ENRICH_RDNS", "false") == "true",
+		resolver:  net.DefaultResolver,
+		geoCache:  newLookupCache(enrichCacheSize, enrichCacheTTL),
+		rdnsCache: newLookupCache(enrichCacheSize, enrichCacheTTL),
+		repCache:  newLookupCache(enrichCacheSize, enrichCacheTTL),
+	}
+
+	if path := getEnv("ENRICH_GEOIP_DB", ""); path != "" {
+		db, err := LoadGeoIPDatabase(path)
+		if err != nil {
+			log.Warnf("GeoIP enrichment disabled: %v", err)
+		} else {
+			e.geoIP = db
+			log.Infof("Loaded GeoIP database with %d ranges", len(db.ranges))
+		}
+	}
+
+	if path := getEnv("ENRICH_REPUTATION_DB", ""); path != "" {
+		db, err := LoadReputationDatabase(path)
+		if err != nil {
+			log.Warnf("Process reputation enrichment disabled: %v", err)
+		} else {
+			e.reputation = db
+			log.Infof("Loaded reputation database with %d hashes", len(db.verdicts))
+		}
+	}
+
+	if e.rdns {
+		e.startRDNS(rdnsWorkers)
+	}
+
+	return e
+}
+
+// startRDNS starts the background resolvers that fill the reverse DNS cache
+func (e *Enricher) startRDNS(workers int) {
+	e.rdnsQueue = make(chan string, rdnsQueueSize)
+	e.rdnsPending = make(map[string]struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			for ip := range e.rdnsQueue {
+				e.lookupRDNS(ip)
+				e.rdnsMu.Lock()
+				delete(e.rdnsPending, ip)
+				e.rdnsMu.Unlock()
+			}
+		}()
+	}
+}
+
+// Enrich populates the enrichment fields of an event from its payload
+func (e *Enricher) Enrich(event *Event) {
+	if e == nil || event.Payload == "" {
+		return
+	}
+
+	var payload struct {
+		DstIP string `json:"dst_ip"`
+		SrcIP string `json:"src_ip"`
+		Hash  string `json:"hash"`
+	}
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		return
+	}
+
+	if payload.DstIP != "" {
+		if ip := net.ParseIP(payload.DstIP); ip != nil {
+			if geo, ok := e.lookupGeo(payload.DstIP, ip); ok {
+				event.DstCountry = geo.Country
+				event.DstASN = geo.ASN
+				event.DstASOrg = geo.ASOrg
+			}
+			if e.rdns {
+				event.DstHostname = e.cachedRDNS(payload.DstIP)
+			}
+		}
+	}
+
+	// The source country of logins drives impossible-travel detection
+	if payload.SrcIP != "" {
+		if ip := net.ParseIP(payload.SrcIP); ip != nil {
+			if geo, ok := e.lookupGeo(payload.SrcIP, ip); ok {
+				event.SrcCountry = geo.Country
+			}
+		}
+	}
+
+	if payload.Hash != "" && e.reputation != nil {
+		event.ProcessReputation = e.lookupReputation(payload.Hash)
+	}
+}
+
+func (e *Enricher) lookupGeo(key string, ip net.IP) (GeoInfo, bool) {
+	if e.geoIP == nil {
+		return GeoInfo{}, false
+	}
+	if cached, ok := e.geoCache.get(key); ok {
+		geo := cached.(GeoInfo)
+		return geo, geo != GeoInfo{}
+	}
+
+	geo, ok := e.geoIP.Lookup(ip)
+	e.geoCache.set(key, geo)
+	return geo, ok
+}
+
+// cachedRDNS returns the cached host name of an IP without blocking. A miss queues the IP for
+// the background resolvers and returns "", so later events of the same IP get the name.
+func (e *Enricher) cachedRDNS(ip string) string {
+	if cached, ok := e.rdnsCache.get(ip); ok {
+		return cached.(string)
+	}
+
+	e.rdnsMu.Lock()
+	defer e.rdnsMu.Unlock()
+	if _, queued := e.rdnsPending[ip]; queued {
+		return ""
+	}
+	select {
+	case e.rdnsQueue <- ip:
+		e.rdnsPending[ip] = struct{}{}
+	default:
+		// Resolvers are saturated; the IP is queued again on a later miss
+	}
+	return ""
+}
+
+// lookupRDNS resolves an IP synchronously, bounded by rdnsTimeout. Reprocessing jobs call it
+// directly; ingest goes through cachedRDNS.
+func (e *Enricher) lookupRDNS(ip string) string {
+	if cached, ok := e.rdnsCache.get(ip); ok {
+		return cached.(string)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rdnsTimeout)
+	defer cancel()
+
+	hostname := ""
+	names, err := e.resolver.LookupAddr(ctx, ip)
+	if err == nil && len(names) > 0 {
+		hostname = strings.TrimSuffix(names[0], ".")
+	}
+
+	// Negative results are cached too so unresolvable IPs don't stall every batch
+	e.rdnsCache.set(ip, hostname)
+	return hostname
+}
+
+func (e *Enricher) lookupReputation(hash string) string {
+	if cached, ok := e.repCache.get(hash); ok {
+		return cached.(string)
+	}
+
+	verdict := e.reputation.Lookup(hash)
+	e.repCache.set(hash, verdict)
+	return verdict
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareIP(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.0.0.1", "10.0.0.1", 0},
+		{"10.0.0.1", "10.0.0.2", -1},
+		{"10.0.1.0", "10.0.0.255", 1},
+		{"9.255.255.255", "10.0.0.0", -1},
+		{"255.255.255.255", "::1", 1}, // IPv4-mapped addresses sort after low IPv6 addresses
+		{"2001:db8::1", "2001:db8::", 1},
+		{"2001:db8::", "2001:db9::", -1},
+	}
+	for _, tt := range tests {
+		if got := compareIP(net.ParseIP(tt.a).To16(), net.ParseIP(tt.b).To16()); got != tt.want {
+			t.Errorf("compareIP(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGeoIPDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	data := `network,country_code,asn,as_org
+# comment
+203.0.113.0/24,AU,AS64500,"Example Net, Pty"
+10.0.0.0/8,ZZ,64501
+2001:db8::/32,DE,AS64502,Example v6
+not-a-network,XX,1,Broken
+198.51.100.0/24
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := LoadGeoIPDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadGeoIPDatabase() error = %v", err)
+	}
+	if len(db.ranges) != 3 {
+		t.Fatalf("loaded %d ranges, want 3", len(db.ranges))
+	}
+
+	tests := []struct {
+		ip     string
+		want   GeoInfo
+		wantOK bool
+	}{
+		{"203.0.113.0", GeoInfo{Country: "AU", ASN: 64500, ASOrg: "Example Net, Pty"}, true},
+		{"203.0.113.255", GeoInfo{Country: "AU", ASN: 64500, ASOrg: "Example Net, Pty"}, true},
+		{"203.0.114.0", GeoInfo{}, false},
+		{"203.0.112.255", GeoInfo{}, false},
+		{"10.200.3.4", GeoInfo{Country: "ZZ", ASN: 64501}, true},
+		{"11.0.0.0", GeoInfo{}, false},
+		{"2001:db8:ffff::1", GeoInfo{Country: "DE", ASN: 64502, ASOrg: "Example v6"}, true},
+		{"2001:db9::1", GeoInfo{}, false},
+		{"198.51.100.7", GeoInfo{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(net.ParseIP(tt.ip))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v, %v", tt.ip, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLookupCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLookupCache(2, time.Minute)
+	cache.set("a", 1)
+	cache.set("b", 2)
+	cache.get("a") // b is now the least recently used
+	cache.set("c", 3)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if n := cache.order.Len(); n != 2 {
+		t.Errorf("cache holds %d entries, want 2", n)
+	}
+}
+
+func TestLookupCacheExpires(t *testing.T) {
+	cache := newLookupCache(10, -time.Second)
+	cache.set("a", 1)
+	if _, ok := cache.get("a"); ok {
+		t.Error("expired entry was returned")
+	}
+	if n := cache.order.Len(); n != 0 {
+		t.Errorf("cache holds %d entries after expiry, want 0", n)
+	}
+}
+
+// blockingResolver answers reverse lookups once released
+type blockingResolver struct {
+	release chan struct{}
+}
+
+func (r blockingResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	<-r.release
+	return []string{"host.example."}, nil
+}
+
+func TestEnrichDoesNotWaitForReverseDNS(t *testing.T) {
+	resolver := blockingResolver{release: make(chan struct{})}
+	e := &Enricher{
+		rdns:      true,
+		resolver:  resolver,
+		geoCache:  newLookupCache(10, time.Minute),
+		rdnsCache: newLookupCache(10, time.Minute),
+		repCache:  newLookupCache(10, time.Minute),
+	}
+	e.startRDNS(1)
+
+	event := Event{Payload: `{"dst_ip":"192.0.2.10"}`}
+	done := make(chan struct{})
+	go func() {
+		e.Enrich(&event)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enrich blocked on reverse DNS")
+	}
+	if event.DstHostname != "" {
+		t.Errorf("DstHostname = %q before resolution, want empty", event.DstHostname)
+	}
+
+	close(resolver.release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		event := Event{Payload: `{"dst_ip":"192.0.2.10"}`}
+		e.Enrich(&event)
+		if event.DstHostname == "host.example" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("DstHostname = %q after resolution, want host.example", event.DstHostname)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,253 @@
+// Integrity Ledger
+// Hash-chains inserted batches per tenant so deleted or modified events are detectable
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// genesisHash is the prev_hash of the first entry of every chain
+var genesisHash = strings.Repeat("0", 64)
+
+// Ledger appends one entry per tenant for every batch written to telemetry_events. Each entry
+// links to the previous entry of its (chain, tenant) chain through prev_hash.
+type Ledger struct {
+	clickhouse driver.Conn
+	chainID    string
+	mu         sync.Mutex // Serializes appends so sequence numbers follow insert order
+	heads      map[string]ledgerHead
+}
+
+// ledgerHead is the last entry of a tenant's chain
+type ledgerHead struct {
+	seq  uint64
+	hash string
+}
+
+// ledgerEntry is one telemetry_ledger row
+type ledgerEntry struct {
+	tenantID       string
+	seq            uint64
+	batchID        string
+	eventCount     uint32
+	firstTimestamp time.Time
+	lastTimestamp  time.Time
+	eventsHash     string
+	prevHash       string
+	chainHash      string
+}
+
+// NewLedgerFromEnv creates the ledger when INTEGRITY_CHAIN is enabled. The chain is named by
+// INTEGRITY_CHAIN_ID, defaulting to the hostname, so a restarted consumer resumes its chains.
+func NewLedgerFromEnv(conn driver.Conn) *Ledger {
+	if enabled, _ := strconv.ParseBool(getEnv("INTEGRITY_CHAIN", "false")); !enabled {
+		return nil
+	}
+	chainID := getEnv("INTEGRITY_CHAIN_ID", "")
+	if chainID == "" {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "consumer"
+		}
+		chainID = hostname
+	}
+	return &Ledger{
+		clickhouse: conn,
+		chainID:    chainID,
+		heads:      make(map[string]ledgerHead),
+	}
+}
+
+// Append records the batch in the ledger. It is called after the events are stored; on failure
+// the tenant heads are left unchanged, so the batch is simply not covered rather than breaking
+// the chain.
+func (l *Ledger) Append(ctx context.Context, batch []Event) error {
+	byTenant := make(map[string][]Event)
+	for _, event := range batch {
+		byTenant[event.TenantID] = append(byTenant[event.TenantID], event)
+	}
+	tenants := make([]string, 0, len(byTenant))
+	for tenantID := range byTenant {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]ledgerEntry, 0, len(tenants))
+	for _, tenantID := range tenants {
+		head, err := l.head(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		entry := newLedgerEntry(l.chainID, tenantID, byTenant[tenantID], head)
+		entries = append(entries, entry)
+	}
+
+	insert, err := l.clickhouse.PrepareBatch(ctx, `
+		INSERT INTO telemetry_ledger (
+			chain_id, tenant_id, seq, batch_id, event_count, first_timestamp, last_timestamp,
+			events_hash, prev_hash, chain_hash
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare ledger batch: %w", err)
+	}
+	for _, entry := range entries {
+		if err := insert.Append(
+			l.chainID,
+			entry.tenantID,
+			entry.seq,
+			entry.batchID,
+			entry.eventCount,
+			entry.firstTimestamp,
+			entry.lastTimestamp,
+			entry.eventsHash,
+			entry.prevHash,
+			entry.chainHash,
+		); err != nil {
+			return fmt.Errorf("failed to append ledger row: %w", err)
+		}
+	}
+	if err := insert.Send(); err != nil {
+		return fmt.Errorf("failed to send ledger batch: %w", err)
+	}
+
+	for _, entry := range entries {
+		l.heads[entry.tenantID] = ledgerHead{seq: entry.seq, hash: entry.chainHash}
+	}
+	return nil
+}
+
+// head returns the last entry of a tenant's chain, loading it from ClickHouse on first use
+func (l *Ledger) head(ctx context.Context, tenantID string) (ledgerHead, error) {
+	if head, ok := l.heads[tenantID]; ok {
+		return head, nil
+	}
+
+	head := ledgerHead{hash: genesisHash}
+	rows, err := l.clickhouse.Query(ctx, `
+		SELECT seq, chain_hash FROM telemetry_ledger
+		WHERE chain_id = ? AND tenant_id = ?
+		ORDER BY seq DESC
+		LIMIT 1
+	`, l.chainID, tenantID)
+	if err != nil {
+		return head, fmt.Errorf("failed to load ledger head: %w", err)
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(&head.seq, &head.hash); err != nil {
+			return head, fmt.Errorf("failed to scan ledger head: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return head, err
+	}
+
+	l.heads[tenantID] = head
+	return head, nil
+}
+
+func newLedgerEntry(chainID, tenantID string, events []Event, head ledgerHead) ledgerEntry {
+	entry := ledgerEntry{
+		tenantID:   tenantID,
+		seq:        head.seq + 1,
+		batchID:    events[0].BatchID,
+		eventCount: uint32(len(events)),
+		prevHash:   head.hash,
+	}
+
+	hashes := make([]eventHash, 0, len(events))
+	for i, event := range events {
+		timestamp := time.UnixMilli(event.Timestamp)
+		if i == 0 || timestamp.Before(entry.firstTimestamp) {
+			entry.firstTimestamp = timestamp
+		}
+		if i == 0 || timestamp.After(entry.lastTimestamp) {
+			entry.lastTimestamp = timestamp
+		}
+		hashes = append(hashes, eventHash{eventID: event.EventID, sum: hashEvent(event)})
+	}
+	entry.eventsHash = hashEvents(hashes)
+	entry.chainHash = chainHash(entry.prevHash, chainID, tenantID, entry.seq, entry.batchID, entry.eventCount, entry.eventsHash)
+	return entry
+}
+
+// eventHash is the content hash of one event, ordered by event ID within a batch
+type eventHash struct {
+	eventID string
+	sum     [sha256.Size]byte
+}
+
+// hashEvent hashes the stored, immutable columns of an event as ClickHouse returns them.
+// Enrichment columns are excluded since they may legitimately be recomputed. The platform API
+// verifier reproduces this encoding exactly.
+func hashEvent(event Event) [sha256.Size]byte {
+	eventType := eventTypeMap[event.EventType]
+	if eventType == "" {
+		eventType = "unspecified"
+	}
+
+	digest := sha256.New()
+	for _, field := range []string{
+		event.EventID,
+		event.AgentID,
+		event.TenantID,
+		strconv.FormatInt(event.Timestamp, 10),
+		eventType,
+		event.MitreTactic,
+		event.MitreTechnique,
+		strconv.FormatUint(uint64(uint8(event.Severity)), 10),
+		event.Hostname,
+		event.OSType,
+		event.Payload,
+	} {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+		digest.Write(length[:])
+		digest.Write([]byte(field))
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], digest.Sum(nil))
+	return sum
+}
+
+// hashEvents combines the event hashes of a batch in event ID order
+func hashEvents(hashes []eventHash) string {
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].eventID < hashes[j].eventID })
+	digest := sha256.New()
+	for _, hash := range hashes {
+		digest.Write(hash.sum[:])
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// chainHash links an entry to its predecessor
+func chainHash(prevHash, chainID, tenantID string, seq uint64, batchID string, eventCount uint32, eventsHash string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		prevHash,
+		chainID,
+		tenantID,
+		strconv.FormatUint(seq, 10),
+		batchID,
+		strconv.FormatUint(uint64(eventCount), 10),
+		eventsHash,
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
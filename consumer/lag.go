@@ -0,0 +1,160 @@
+// Consumer Lag
+// Polls the JetStream durable consumer to track how far the writers are behind the stream
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// LagMonitor periodically reads the durable consumer's pending counts and ack floor. Lag is
+// the number of messages not yet acknowledged; age is how long the oldest of them has waited.
+type LagMonitor struct {
+	js          nats.JetStreamContext
+	subject     string // Filter subject of the monitored durable
+	durable     string
+	interval    time.Duration
+	maxMessages uint64        // Lag above which the monitor alerts; 0 disables the check
+	maxAge      time.Duration // Oldest-message age above which the monitor alerts; 0 disables the check
+
+	stream     string
+	pending    atomic.Uint64 // Messages not yet delivered to any worker
+	ackPending atomic.Uint64 // Messages delivered but not yet acknowledged
+	oldestAge  atomic.Int64  // Nanoseconds; 0 when nothing is outstanding
+	lastPoll   atomic.Int64  // Unix seconds of the last successful poll
+	pollErrors atomic.Uint64
+	alerting   atomic.Bool
+}
+
+// NewLagMonitorFromEnv creates the lag monitor for a durable consumer, configured by
+// CONSUMER_LAG_POLL_INTERVAL, CONSUMER_LAG_WARN_MESSAGES and CONSUMER_LAG_WARN_AGE
+func NewLagMonitorFromEnv(js nats.JetStreamContext, subject, durable string) (*LagMonitor, error) {
+	interval, err := time.ParseDuration(getEnv("CONSUMER_LAG_POLL_INTERVAL", "15s"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid CONSUMER_LAG_POLL_INTERVAL %q", getEnv("CONSUMER_LAG_POLL_INTERVAL", ""))
+	}
+	var maxMessages uint64
+	if _, err := fmt.Sscan(getEnv("CONSUMER_LAG_WARN_MESSAGES", "100000"), &maxMessages); err != nil {
+		return nil, fmt.Errorf("invalid CONSUMER_LAG_WARN_MESSAGES %q", getEnv("CONSUMER_LAG_WARN_MESSAGES", ""))
+	}
+	maxAge, err := time.ParseDuration(getEnv("CONSUMER_LAG_WARN_AGE", "5m"))
+	if err != nil || maxAge < 0 {
+		return nil, fmt.Errorf("invalid CONSUMER_LAG_WARN_AGE %q", getEnv("CONSUMER_LAG_WARN_AGE", ""))
+	}
+	return &LagMonitor{js: js, subject: subject, durable: durable, interval: interval, maxMessages: maxMessages, maxAge: maxAge}, nil
+}
+
+// Run polls until ctx is cancelled. Poll failures, such as NATS reconnecting or the stream not
+// existing yet, are counted and retried on the next tick; the last known lag is kept.
+func (m *LagMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	failing := false
+	for {
+		if err := m.poll(); err != nil {
+			m.pollErrors.Add(1)
+			if !failing {
+				log.Warnf("Failed to read JetStream consumer lag: %v", err)
+			} else {
+				log.Debugf("Failed to read JetStream consumer lag: %v", err)
+			}
+			failing = true
+		} else {
+			if failing {
+				log.Info("JetStream consumer lag polling recovered")
+			}
+			failing = false
+			m.checkThresholds()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the consumer info and the oldest outstanding message
+func (m *LagMonitor) poll() error {
+	if m.stream == "" {
+		stream, err := m.js.StreamNameBySubject(m.subject)
+		if err != nil {
+			return fmt.Errorf("failed to find stream for %s: %w", m.subject, err)
+		}
+		m.stream = stream
+	}
+
+	info, err := m.js.ConsumerInfo(m.stream, m.durable)
+	if err != nil {
+		if errors.Is(err, nats.ErrStreamNotFound) {
+			m.stream = "" // Look the stream up again once it is recreated
+		}
+		return fmt.Errorf("failed to get consumer info: %w", err)
+	}
+	m.pending.Store(info.NumPending)
+	m.ackPending.Store(uint64(info.NumAckPending))
+
+	// The first message past the ack floor is the oldest one not yet acknowledged. It may have
+	// been removed by stream limits, in which case the age is left as last measured.
+	if info.NumPending == 0 && info.NumAckPending == 0 {
+		m.oldestAge.Store(0)
+	} else {
+		msg, err := m.js.GetMsg(m.stream, info.AckFloor.Stream+1)
+		switch {
+		case err == nil:
+			m.oldestAge.Store(int64(time.Since(msg.Time)))
+		case errors.Is(err, nats.ErrMsgNotFound):
+			log.Debugf("Oldest unacknowledged message %d is no longer in stream %s", info.AckFloor.Stream+1, m.stream)
+		default:
+			return fmt.Errorf("failed to get oldest unacknowledged message: %w", err)
+		}
+	}
+
+	m.lastPoll.Store(time.Now().Unix())
+	return nil
+}
+
+// checkThresholds alerts once when lag or age crosses its threshold and again on recovery
+func (m *LagMonitor) checkThresholds() {
+	lag := m.Lag()
+	age := m.OldestAge()
+	over := (m.maxMessages > 0 && lag > m.maxMessages) || (m.maxAge > 0 && age > m.maxAge)
+
+	switch {
+	case over && !m.alerting.Load():
+		m.alerting.Store(true)
+		log.WithFields(log.Fields{
+			"lag_messages":  lag,
+			"oldest_age":    age.Round(time.Second).String(),
+			"warn_messages": m.maxMessages,
+			"warn_age":      m.maxAge.String(),
+			"stream":        m.stream,
+			"durable":       m.durable,
+		}).Warn("JetStream consumer lag exceeds threshold; consumers are falling behind")
+	case !over && m.alerting.Load():
+		m.alerting.Store(false)
+		log.WithFields(log.Fields{
+			"lag_messages": lag,
+			"oldest_age":   age.Round(time.Second).String(),
+		}).Info("JetStream consumer lag back under threshold")
+	}
+}
+
+// Lag returns the number of messages not yet acknowledged
+func (m *LagMonitor) Lag() uint64 {
+	return m.pending.Load() + m.ackPending.Load()
+}
+
+// OldestAge returns how long the oldest unacknowledged message has waited
+func (m *LagMonitor) OldestAge() time.Duration {
+	return time.Duration(m.oldestAge.Load())
+}
@@ -7,9 +7,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 )
@@ -31,7 +34,7 @@ const (
 	batchSize     = 1000  // Events per batch
 	batchTimeout  = 5     // Seconds before forcing flush
 	maxRetries    = 3     // Retry attempts for failed batches
-	workerCount   = 4     // Parallel workers for processing
+	workerCount   = 4     // Parallel workers when autoscaling is disabled
 
 	// Monitoring
 	statsInterval = 30 * time.Second
@@ -49,6 +52,25 @@ type Event struct {
 	TenantID        string `json:"tenant_id"`
 	Hostname        string `json:"hostname"`
 	OSType          string `json:"os_type"`
+
+	// Set by the ingestor when it clamped Timestamp to server time: the agent's original
+	// timestamp, in Unix milliseconds
+	AgentTimestamp int64 `json:"agent_timestamp,omitempty"`
+
+	// Assigned by the consumer on first insert attempt and kept across retries and spills
+	EventID           string `json:"-"`
+	BatchID           string `json:"-"`
+
+	// Enrichment fields populated by the consumer before insert
+	DstCountry        string `json:"-"`
+	DstASN            uint32 `json:"-"`
+	DstASOrg          string `json:"-"`
+	DstHostname       string `json:"-"`
+	ProcessReputation string `json:"-"`
+	SrcCountry        string `json:"-"`
+
+	// Set when a redaction rule masked part of the payload
+	Redacted bool `json:"-"`
 }
 
 // Consumer processes events from NATS and writes to ClickHouse
@@ -56,9 +78,30 @@ type Consumer struct {
 	natsConn         *nats.Conn
 	jetStream        nats.JetStreamContext
 	clickhouse       driver.Conn
+	subject          string // Filter subject of the durable consumer
+	durable          string // Durable consumer name, shared by every worker and replica
+	enricher         *Enricher
+	sampler          *Sampler
+	redactor         *Redactor
+	spill            *Spill // Local buffer for batches ClickHouse rejects; nil when disabled
+	ledger           *Ledger // Integrity hash chain; nil when disabled
+	lag              *LagMonitor // JetStream consumer lag polling; nil when disabled
+	metricsAddr      string      // Address of the /metrics endpoint; empty when disabled
+	autoscaler       *Autoscaler // Resizes the worker pool from lag; nil for a fixed workerCount
+	schemas          *SchemaValidator // Payload schemas per event type; nil when disabled
+	asyncInsert      *AsyncInsert     // Server-side insert buffering for event batches; nil for synchronous inserts
+	reprocessor      *Reprocessor     // Re-enrichment of stored events for API jobs; nil when disabled
+	tenants          *TenantValidator // License checks of each event's tenant; nil when disabled
 	eventsProcessed  atomic.Uint64
 	eventsInserted   atomic.Uint64
+	eventsSampled    atomic.Uint64 // Counted in telemetry_rollups instead of stored
+	eventsSpilled    atomic.Uint64
+	eventsReingested atomic.Uint64
+	eventsDeadLettered atomic.Uint64 // Published to the DLQ subject instead of stored
+	eventsRefused    atomic.Uint64 // Dropped because their tenant's license is unknown or invalid
 	batchesFlushed   atomic.Uint64
+	flushNanos       atomic.Uint64 // Total time spent flushing batchesFlushed
+	workers          atomic.Int64
 	errors           atomic.Uint64
 	mu               sync.Mutex
 }
@@ -126,20 +169,29 @@ func NewConsumer(natsURL, clickhouseAddr string) (*Consumer, error) {
 		natsConn:   nc,
 		jetStream:  js,
 		clickhouse: conn,
+		subject:    natsSubject,
+		durable:    natsDurable,
+		enricher:   NewEnricherFromEnv(),
+		sampler:    NewSampler(conn),
+		redactor:   NewRedactor(conn),
 	}, nil
 }
 
 // Start begins consuming events from NATS
 func (c *Consumer) Start(ctx context.Context) error {
-	log.Infof("Starting %d consumer workers...", workerCount)
+	workers, maxWorkers := workerCount, workerCount
+	if c.autoscaler != nil {
+		workers, maxWorkers = c.autoscaler.minWorkers, c.autoscaler.maxWorkers
+	}
+	log.Infof("Starting %d consumer workers...", workers)
 
 	// Create JetStream consumer if it doesn't exist
-	_, err := c.jetStream.AddConsumer(natsSubject, &nats.ConsumerConfig{
-		Durable:       natsDurable,
-		FilterSubject: natsSubject,
+	_, err := c.jetStream.AddConsumer(natsStream, &nats.ConsumerConfig{
+		Durable:       c.durable,
+		FilterSubject: c.subject,
 		DeliverPolicy: nats.DeliverAllPolicy,
 		AckPolicy:     nats.AckExplicitPolicy,
-		MaxAckPending: batchSize * workerCount * 2,
+		MaxAckPending: batchSize * maxWorkers * 2,
 		AckWait:       time.Minute,
 	})
 	if err != nil && err != nats.ErrStreamNotFound {
@@ -147,20 +199,47 @@ func (c *Consumer) Start(ctx context.Context) error {
 	}
 
 	// Start multiple workers for parallel processing
-	var wg sync.WaitGroup
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			c.worker(ctx, workerID)
-		}(i)
+	pool := newWorkerPool(ctx, c)
+	pool.resize(workers)
+
+	// Keep per-license sampling policies current
+	go c.sampler.Run(ctx, samplingRefreshInterval)
+
+	// Keep per-license redaction rules current
+	go c.redactor.Run(ctx, redactionRefreshInterval)
+
+	// Keep the replicated license status current
+	if c.tenants != nil {
+		go c.tenants.Run(ctx, tenantRefreshInterval)
+	}
+
+	// Re-enrich stored events for reprocessing jobs created through the API
+	if c.reprocessor != nil {
+		go c.reprocessor.Run(ctx, reprocessPollInterval)
+	}
+
+	// Reingest batches spilled while ClickHouse was unavailable
+	if c.spill != nil {
+		go c.drainSpill(ctx)
+	}
+
+	// Track how far the workers are behind the stream, and size the pool to keep up
+	if c.lag != nil {
+		go c.lag.Run(ctx)
+		if c.autoscaler != nil {
+			go c.autoscaler.Run(ctx, c, pool)
+		}
+	}
+
+	if c.metricsAddr != "" {
+		go c.serveMetrics(ctx, c.metricsAddr)
 	}
 
 	// Start statistics reporter
 	go c.printStats(ctx)
 
 	// Wait for all workers to finish
-	wg.Wait()
+	pool.wait()
 	log.Info("All consumer workers stopped")
 
 	return nil
@@ -171,7 +250,7 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 	log.Infof("Worker %d started", workerID)
 
 	// Subscribe to JetStream with pull-based consumer
-	sub, err := c.jetStream.PullSubscribe(natsSubject, natsDurable, nats.Bind(natsSubject, natsDurable))
+	sub, err := c.jetStream.PullSubscribe(c.subject, c.durable, nats.Bind(natsStream, c.durable))
 	if err != nil {
 		log.Errorf("Worker %d: Failed to subscribe: %v", workerID, err)
 		return
@@ -180,6 +259,7 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 
 	batch := make([]Event, 0, batchSize)
 	batchMsgs := make([]*nats.Msg, 0, batchSize)
+	rollups := rollupBatch{}
 	batchTimer := time.NewTimer(batchTimeout * time.Second)
 	defer batchTimer.Stop()
 
@@ -187,8 +267,8 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 		select {
 		case <-ctx.Done():
 			// Flush remaining events before shutdown
-			if len(batch) > 0 {
-				if c.flushBatchWithAck(workerID, batch, batchMsgs) {
+			if len(batchMsgs) > 0 {
+				if c.flushBatchWithAck(workerID, batch, rollups, batchMsgs) {
 					batch = batch[:0]
 					batchMsgs = batchMsgs[:0]
 				}
@@ -198,8 +278,8 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 
 		case <-batchTimer.C:
 			// Flush on timeout
-			if len(batch) > 0 {
-				if c.flushBatchWithAck(workerID, batch, batchMsgs) {
+			if len(batchMsgs) > 0 {
+				if c.flushBatchWithAck(workerID, batch, rollups, batchMsgs) {
 					batch = batch[:0]
 					batchMsgs = batchMsgs[:0]
 				}
@@ -208,7 +288,7 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 
 		default:
 			// Pull messages from NATS
-			msgs, err := sub.Fetch(batchSize-len(batch), nats.MaxWait(time.Second))
+			msgs, err := sub.Fetch(batchSize-len(batchMsgs), nats.MaxWait(time.Second))
 			if err != nil {
 				if err == nats.ErrTimeout {
 					continue
@@ -228,13 +308,42 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 					continue
 				}
 
-				batch = append(batch, event)
+				// Payloads that break their event type's schema would corrupt typed columns
+				if reason := c.schemas.Validate(&event); reason != "" {
+					c.deadLetter(workerID, msg, &event, reason)
+					continue
+				}
+
+				// Events of unknown, revoked or expired licenses are not stored
+				if reason := c.tenants.Check(&event, time.Now()); reason != "" {
+					if c.tenants.action == TenantActionDeadLetter {
+						c.deadLetter(workerID, msg, &event, reason)
+					} else {
+						msg.Ack()
+						c.eventsRefused.Add(1)
+						log.Debugf("Worker %d: Dropped %s event of tenant %s: %s", workerID, event.EventType, event.TenantID, reason)
+					}
+					continue
+				}
+
+				// Annotate with GeoIP/ASN, rDNS and reputation context
+				c.enricher.Enrich(&event)
+
+				// Low-value events under a sampling policy are only counted
+				if c.sampler.Keep(&event) {
+					// Mask secrets and PII before the payload leaves the consumer
+					c.redactor.Redact(&event)
+					batch = append(batch, event)
+				} else {
+					rollups.add(&event)
+					c.eventsSampled.Add(1)
+				}
 				batchMsgs = append(batchMsgs, msg)
 				c.eventsProcessed.Add(1)
 
 				// Flush when batch is full
-				if len(batch) >= batchSize {
-					if c.flushBatchWithAck(workerID, batch, batchMsgs) {
+				if len(batchMsgs) >= batchSize {
+					if c.flushBatchWithAck(workerID, batch, rollups, batchMsgs) {
 						batch = batch[:0]
 						batchMsgs = batchMsgs[:0]
 					}
@@ -246,25 +355,33 @@ func (c *Consumer) worker(ctx context.Context, workerID int) {
 	}
 }
 
-// flushBatchWithAck writes a batch of events to ClickHouse and acknowledges NATS messages on success
-func (c *Consumer) flushBatchWithAck(workerID int, batch []Event, msgs []*nats.Msg) bool {
-	if len(batch) == 0 {
+// flushBatchWithAck writes a batch of events and the rollup counts of sampled events to ClickHouse
+// and acknowledges NATS messages on success. The rollups are reset once written.
+func (c *Consumer) flushBatchWithAck(workerID int, batch []Event, rollups rollupBatch, msgs []*nats.Msg) bool {
+	if len(msgs) == 0 {
 		return true
 	}
 
 	start := time.Now()
 
-	// Retry logic
+	// Retry logic; a part that was written is not written again
 	var err error
+	eventsDone := len(batch) == 0
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
 			log.Warnf("Worker %d: Retry attempt %d for batch of %d events", workerID, attempt, len(batch))
 			time.Sleep(time.Duration(attempt) * time.Second)
 		}
 
-		err = c.insertBatch(batch)
-		if err == nil {
-			break
+		if !eventsDone {
+			if err = c.insertBatch(batch); err == nil {
+				eventsDone = true
+			}
+		}
+		if eventsDone {
+			if err = c.insertRollups(rollups); err == nil {
+				break
+			}
 		}
 
 		log.Errorf("Worker %d: Insert failed (attempt %d): %v", workerID, attempt+1, err)
@@ -272,6 +389,28 @@ func (c *Consumer) flushBatchWithAck(workerID int, batch []Event, msgs []*nats.M
 
 	if err != nil {
 		log.Errorf("Worker %d: Failed to insert batch after %d retries: %v", workerID, maxRetries, err)
+
+		// Keep the batch on local disk so JetStream does not back up while ClickHouse is down
+		if c.spill != nil {
+			spillErr := c.spillFailedBatch(batch, eventsDone, rollups)
+			if spillErr == nil {
+				for _, msg := range msgs {
+					if err := msg.Ack(); err != nil {
+						log.Warnf("Worker %d: Failed to ack message: %v", workerID, err)
+					}
+				}
+				for key := range rollups {
+					delete(rollups, key)
+				}
+				if !eventsDone {
+					c.eventsSpilled.Add(uint64(len(batch)))
+				}
+				log.Warnf("Worker %d: Spilled batch of %d events to local disk (%d bytes buffered)", workerID, len(batch), c.spill.Size())
+				return true
+			}
+			log.Errorf("Worker %d: Failed to spill batch: %v", workerID, spillErr)
+		}
+
 		c.errors.Add(uint64(len(batch)))
 		// NAK all messages so they can be redelivered
 		for _, msg := range msgs {
@@ -287,49 +426,77 @@ func (c *Consumer) flushBatchWithAck(workerID int, batch []Event, msgs []*nats.M
 		}
 	}
 
+	for key := range rollups {
+		delete(rollups, key)
+	}
+
 	// Update metrics
+	duration := time.Since(start)
 	c.eventsInserted.Add(uint64(len(batch)))
+	c.flushNanos.Add(uint64(duration))
 	c.batchesFlushed.Add(1)
 
-	duration := time.Since(start)
 	log.Debugf("Worker %d: Flushed %d events in %v (%.0f events/sec)",
 		workerID, len(batch), duration, float64(len(batch))/duration.Seconds())
 
 	return true
 }
 
+// eventTypeMap maps event type strings to telemetry_events enum values
+var eventTypeMap = map[string]string{
+	"PROCESS_START":     "process_start",
+	"PROCESS_TERMINATE": "process_terminate",
+	"FILE_ACCESS":       "file_access",
+	"FILE_MODIFY":       "file_modify",
+	"FILE_DELETE":       "file_delete",
+	"NETWORK_CONN":      "network_conn",
+	"REGISTRY_MODIFY":   "registry_modify",
+	"DLP_VIOLATION":     "dlp_violation",
+	"AUTHENTICATION":    "authentication",
+}
+
+// errAppendRow marks an event the ClickHouse client could not convert to the table's columns
+var errAppendRow = errors.New("failed to append row")
+
 // insertBatch performs the actual ClickHouse insert
 func (c *Consumer) insertBatch(batch []Event) error {
-	ctx := context.Background()
+	ctx := c.asyncInsert.Context(context.Background())
 
 	// Prepare batch insert
 	insertBatch, err := c.clickhouse.PrepareBatch(ctx, `
 		INSERT INTO telemetry_events (
-			agent_id, timestamp, event_type, mitre_tactic, mitre_technique,
-			severity, payload, tenant_id, hostname, os_type
+			event_id, batch_id, agent_id, timestamp, event_type, mitre_tactic, mitre_technique,
+			severity, payload, tenant_id, hostname, os_type,
+			dst_country, dst_asn, dst_as_org, dst_hostname, process_reputation,
+			src_country, redacted, agent_timestamp, timestamp_clamped
 		)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare batch: %w", err)
 	}
 
-	// Map event type strings to enum values
-	eventTypeMap := map[string]string{
-		"PROCESS_START":      "process_start",
-		"PROCESS_TERMINATE":  "process_terminate",
-		"FILE_ACCESS":        "file_access",
-		"FILE_MODIFY":        "file_modify",
-		"FILE_DELETE":        "file_delete",
-		"NETWORK_CONN":       "network_conn",
-		"REGISTRY_MODIFY":    "registry_modify",
-		"DLP_VIOLATION":      "dlp_violation",
-		"AUTHENTICATION":     "authentication",
+	// Identify the events once so a retried or spilled batch keeps the IDs the ledger hashes
+	batchID := ""
+	for i := range batch {
+		if batch[i].EventID == "" {
+			batch[i].EventID = uuid.NewString()
+		}
+		if batch[i].BatchID == "" {
+			if batchID == "" {
+				batchID = uuid.NewString()
+			}
+			batch[i].BatchID = batchID
+		}
 	}
 
 	// Append rows
 	for _, event := range batch {
 		// Convert timestamp from milliseconds to DateTime64
 		timestamp := time.UnixMilli(event.Timestamp)
+		agentTimestamp := timestamp
+		if event.AgentTimestamp != 0 {
+			agentTimestamp = time.UnixMilli(event.AgentTimestamp)
+		}
 
 		// Map event type
 		eventType := eventTypeMap[event.EventType]
@@ -338,6 +505,8 @@ func (c *Consumer) insertBatch(batch []Event) error {
 		}
 
 		err = insertBatch.Append(
+			event.EventID,
+			event.BatchID,
 			event.AgentID,
 			timestamp,
 			eventType,
@@ -348,9 +517,18 @@ func (c *Consumer) insertBatch(batch []Event) error {
 			event.TenantID,
 			event.Hostname,
 			event.OSType,
+			event.DstCountry,
+			event.DstASN,
+			event.DstASOrg,
+			event.DstHostname,
+			event.ProcessReputation,
+			event.SrcCountry,
+			event.Redacted,
+			agentTimestamp,
+			event.AgentTimestamp != 0,
 		)
 		if err != nil {
-			return fmt.Errorf("failed to append row: %w", err)
+			return fmt.Errorf("%w: %w", errAppendRow, err)
 		}
 	}
 
@@ -359,6 +537,13 @@ func (c *Consumer) insertBatch(batch []Event) error {
 		return fmt.Errorf("failed to send batch: %w", err)
 	}
 
+	// The events are stored; a ledger failure must not cause them to be written again
+	if c.ledger != nil {
+		if err := c.ledger.Append(ctx, batch); err != nil {
+			log.Errorf("Failed to record batch in integrity ledger, %d events are not chained: %v", len(batch), err)
+		}
+	}
+
 	return nil
 }
 
@@ -379,6 +564,9 @@ func (c *Consumer) printStats(ctx context.Context) {
 			inserted := c.eventsInserted.Load()
 			batches := c.batchesFlushed.Load()
 			errors := c.errors.Load()
+			sampled := c.eventsSampled.Load()
+			spilled := c.eventsSpilled.Load()
+			reingested := c.eventsReingested.Load()
 			now := time.Now()
 			elapsed := now.Sub(lastTime).Seconds()
 
@@ -386,8 +574,13 @@ func (c *Consumer) printStats(ctx context.Context) {
 			insertedPerSec := float64(inserted-lastInserted) / elapsed
 			batchesPerSec := float64(batches-lastBatches) / elapsed
 
-			log.Infof("Performance: %.0f events/sec processed, %.0f events/sec inserted, %.1f batches/sec | Total: %d processed, %d inserted, %d errors",
-				processedPerSec, insertedPerSec, batchesPerSec, processed, inserted, errors)
+			lag := fmt.Sprintf(" | Workers: %d", c.workers.Load())
+			if c.lag != nil {
+				lag += fmt.Sprintf(" | Lag: %d messages, oldest %s", c.lag.Lag(), c.lag.OldestAge().Round(time.Second))
+			}
+
+			log.Infof("Performance: %.0f events/sec processed, %.0f events/sec inserted, %.1f batches/sec | Total: %d processed, %d inserted, %d sampled, %d spilled, %d reingested, %d errors%s",
+				processedPerSec, insertedPerSec, batchesPerSec, processed, inserted, sampled, spilled, reingested, errors, lag)
 
 			lastProcessed = processed
 			lastInserted = inserted
@@ -416,8 +609,7 @@ func (c *Consumer) Close() error {
 
 func main() {
 	// Configure logging
-	log.SetFormatter(&log.JSONFormatter{})
-	log.SetLevel(log.InfoLevel)
+	configureLogging()
 	log.Info("Privé Consumer Worker starting...")
 
 	// Load configuration
@@ -431,6 +623,97 @@ func main() {
 	}
 	defer consumer.Close()
 
+	// Create telemetry_events on a fresh deployment and warn if an existing table has drifted
+	if err := EnsureSchemaFromEnv(consumer.clickhouse); err != nil {
+		log.Fatalf("Failed to bootstrap ClickHouse schema: %v", err)
+	}
+
+	// Slice of the ingest stream to read, for ingestors routing by tenant and event type
+	subject, durable, err := NewSubscriptionFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure subscription: %v", err)
+	}
+	consumer.subject, consumer.durable = subject, durable
+	log.Infof("Consuming %s as durable %s", subject, durable)
+
+	// Optional local spill buffer for ClickHouse outages
+	spill, err := NewSpillFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to open spill buffer: %v", err)
+	}
+	if spill != nil {
+		consumer.spill = spill
+		log.Infof("Spill buffer enabled at %s", spill.dir)
+	}
+
+	// Optional tamper-evidence hash chain over inserted batches
+	if ledger := NewLedgerFromEnv(consumer.clickhouse); ledger != nil {
+		consumer.ledger = ledger
+		log.Infof("Integrity hash chaining enabled (chain %s)", ledger.chainID)
+	}
+
+	// Optional payload schema validation, failing events go to the DLQ subject
+	schemas, err := NewSchemaValidatorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load payload schemas: %v", err)
+	}
+	if schemas != nil {
+		consumer.schemas = schemas
+		log.Infof("Payload schema validation enabled for %d event types (strict: %v), failures go to %s",
+			len(schemas.schemas), schemas.strict, dlqSubject)
+	}
+
+	// Optional tenant validation against the license status replicated by the API
+	tenants, err := NewTenantValidatorFromEnv(consumer.clickhouse)
+	if err != nil {
+		log.Fatalf("Failed to configure tenant validation: %v", err)
+	}
+	if tenants != nil {
+		consumer.tenants = tenants
+		log.Infof("Tenant validation enabled, events of invalid licenses are handled as %s", tenants.action)
+	}
+
+	// Optional async inserts; see AsyncInsert for the durability trade-off of each wait mode
+	asyncInsert, err := NewAsyncInsertFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure async inserts: %v", err)
+	}
+	if asyncInsert != nil {
+		consumer.asyncInsert = asyncInsert
+		if asyncInsert.wait {
+			log.Infof("ClickHouse async inserts enabled (acks wait for the flush, busy timeout %dms)", asyncInsert.busyTimeoutMs)
+		} else {
+			log.Warnf("ClickHouse async inserts enabled without waiting: events are acked before they are written (busy timeout %dms)", asyncInsert.busyTimeoutMs)
+		}
+	}
+
+	// Reprocessing jobs, disabled with CONSUMER_REPROCESS=false
+	consumer.reprocessor = NewReprocessorFromEnv(consumer.clickhouse, consumer.enricher)
+
+	// JetStream lag polling, disabled with CONSUMER_LAG_POLL=false
+	if getEnv("CONSUMER_LAG_POLL", "true") != "false" {
+		lag, err := NewLagMonitorFromEnv(consumer.jetStream, consumer.subject, consumer.durable)
+		if err != nil {
+			log.Fatalf("Failed to configure consumer lag polling: %v", err)
+		}
+		consumer.lag = lag
+	}
+
+	// Optional worker autoscaling, which needs the lag readings
+	autoscaler, err := NewAutoscalerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure worker autoscaling: %v", err)
+	}
+	if autoscaler != nil {
+		if consumer.lag == nil {
+			log.Warn("Worker autoscaling needs consumer lag polling; running a fixed pool")
+		} else {
+			consumer.autoscaler = autoscaler
+			log.Infof("Worker autoscaling enabled (%d-%d workers)", autoscaler.minWorkers, autoscaler.maxWorkers)
+		}
+	}
+	consumer.metricsAddr = getEnv("METRICS_ADDR", ":9102")
+
 	// Create cancellable context
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -453,6 +736,26 @@ func main() {
 	log.Info("Consumer worker stopped gracefully")
 }
 
+// configureLogging applies LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT (json, text)
+func configureLogging() {
+	switch strings.ToLower(getEnv("LOG_FORMAT", "json")) {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.SetFormatter(&log.JSONFormatter{})
+		log.Warnf("Unknown LOG_FORMAT %q, using json", os.Getenv("LOG_FORMAT"))
+	}
+
+	level, err := log.ParseLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Warnf("Invalid LOG_LEVEL %q, using info", os.Getenv("LOG_LEVEL"))
+		level = log.InfoLevel
+	}
+	log.SetLevel(level)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,104 @@
+// Metrics
+// Prometheus text-format endpoint for consumer throughput and JetStream lag
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveMetrics serves /metrics on addr until ctx is cancelled
+func (c *Consumer) serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.handleMetrics)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("Metrics listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("Metrics server failed: %v", err)
+	}
+}
+
+func (c *Consumer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	writeMetric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	writeMetric("prive_consumer_events_processed_total", "counter", "Events read from NATS.", c.eventsProcessed.Load())
+	writeMetric("prive_consumer_events_inserted_total", "counter", "Events written to ClickHouse.", c.eventsInserted.Load())
+	writeMetric("prive_consumer_events_sampled_total", "counter", "Events counted in rollups instead of stored.", c.eventsSampled.Load())
+	writeMetric("prive_consumer_events_spilled_total", "counter", "Events written to the spill buffer.", c.eventsSpilled.Load())
+	writeMetric("prive_consumer_events_reingested_total", "counter", "Spilled events written to ClickHouse.", c.eventsReingested.Load())
+	if c.spill != nil {
+		writeMetric("prive_consumer_spill_segments_quarantined_total", "counter", "Spill segments set aside as corrupt or refused by ClickHouse.", c.spill.quarantined.Load())
+	}
+	writeMetric("prive_consumer_batches_flushed_total", "counter", "Batches flushed to ClickHouse.", c.batchesFlushed.Load())
+	writeMetric("prive_consumer_errors_total", "counter", "Processing and insert errors.", c.errors.Load())
+	writeMetric("prive_consumer_flush_seconds_total", "counter", "Time spent flushing batches to ClickHouse.", time.Duration(c.flushNanos.Load()).Seconds())
+	writeMetric("prive_consumer_workers", "gauge", "Running worker goroutines.", c.workers.Load())
+	writeMetric("prive_consumer_events_dead_lettered_total", "counter", "Events published to the DLQ subject instead of stored.", c.eventsDeadLettered.Load())
+
+	if c.schemas != nil {
+		failures := c.schemas.Failures()
+		eventTypes := make([]string, 0, len(failures))
+		for eventType := range failures {
+			eventTypes = append(eventTypes, eventType)
+		}
+		sort.Strings(eventTypes)
+		b.WriteString("# HELP prive_consumer_schema_validation_failures_total Payloads rejected by their event type's schema.\n")
+		b.WriteString("# TYPE prive_consumer_schema_validation_failures_total counter\n")
+		for _, eventType := range eventTypes {
+			fmt.Fprintf(&b, "prive_consumer_schema_validation_failures_total{event_type=%q} %d\n", eventType, failures[eventType])
+		}
+	}
+
+	if t := c.tenants; t != nil {
+		writeMetric("prive_consumer_events_refused_total", "counter", "Events of invalid licenses dropped instead of stored.", c.eventsRefused.Load())
+		writeMetric("prive_consumer_unknown_tenant_events_total", "counter", "Events whose tenant_id matches no license.", t.unknown.Load())
+		b.WriteString("# HELP prive_consumer_tenant_events_total Events of each license by validation outcome.\n")
+		b.WriteString("# TYPE prive_consumer_tenant_events_total counter\n")
+		for _, counts := range t.Counts() {
+			fmt.Fprintf(&b, "prive_consumer_tenant_events_total{tenant_id=%q,outcome=\"accepted\"} %d\n", counts.tenantID, counts.accepted)
+			fmt.Fprintf(&b, "prive_consumer_tenant_events_total{tenant_id=%q,outcome=\"revoked\"} %d\n", counts.tenantID, counts.revoked)
+			fmt.Fprintf(&b, "prive_consumer_tenant_events_total{tenant_id=%q,outcome=\"expired\"} %d\n", counts.tenantID, counts.expired)
+		}
+	}
+
+	if r := c.reprocessor; r != nil {
+		writeMetric("prive_consumer_events_reprocessed_total", "counter", "Stored events re-enriched by reprocessing jobs.", r.eventsReprocessed.Load())
+		writeMetric("prive_consumer_reprocess_jobs_completed_total", "counter", "Reprocessing jobs completed.", r.jobsCompleted.Load())
+		writeMetric("prive_consumer_reprocess_jobs_failed_total", "counter", "Reprocessing jobs failed.", r.jobsFailed.Load())
+	}
+
+	if m := c.lag; m != nil {
+		alerting := 0
+		if m.alerting.Load() {
+			alerting = 1
+		}
+		writeMetric("prive_consumer_jetstream_pending_messages", "gauge", "Messages not yet delivered to a worker.", m.pending.Load())
+		writeMetric("prive_consumer_jetstream_ack_pending_messages", "gauge", "Messages delivered but not yet acknowledged.", m.ackPending.Load())
+		writeMetric("prive_consumer_jetstream_lag_messages", "gauge", "Messages not yet acknowledged.", m.Lag())
+		writeMetric("prive_consumer_jetstream_oldest_unacked_age_seconds", "gauge", "Age of the oldest unacknowledged message.", m.OldestAge().Seconds())
+		writeMetric("prive_consumer_jetstream_lag_last_poll_timestamp_seconds", "gauge", "Time of the last successful lag poll.", m.lastPoll.Load())
+		writeMetric("prive_consumer_jetstream_lag_poll_errors_total", "counter", "Failed lag polls.", m.pollErrors.Load())
+		writeMetric("prive_consumer_jetstream_lag_alerting", "gauge", "1 while lag or age exceeds its threshold.", alerting)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
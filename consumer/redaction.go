@@ -0,0 +1,254 @@
+// Payload Redaction
+// Per-license masking of secrets and PII in event payloads before they are stored
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// redactionRefreshInterval is how long a rule change takes to reach the consumer
+const redactionRefreshInterval = 30 * time.Second
+
+// defaultRedactionReplacement replaces redacted values when a rule sets none
+const defaultRedactionReplacement = "[REDACTED]"
+
+// redactionPreset is a built-in pattern. Presets that keep their first group mask only the value
+// after a key such as "password=".
+type redactionPreset struct {
+	pattern    *regexp.Regexp
+	keepPrefix bool
+}
+
+// redactionPresets are the built-in rules a license can enable by name. The API validates preset
+// names against the same list.
+var redactionPresets = map[string]redactionPreset{
+	"password": {
+		pattern:    regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret)["']?\s*[=:]\s*["']?|--password[= ])([^\s"'&;,]+)`),
+		keepPrefix: true,
+	},
+	"token": {
+		pattern:    regexp.MustCompile(`(?i)(bearer\s+|(?:api[_-]?key|access[_-]?token|auth[_-]?token|token)["']?\s*[=:]\s*["']?)([A-Za-z0-9._~+/=-]{8,})`),
+		keepPrefix: true,
+	},
+	"aws_access_key": {pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	"private_key":    {pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	"credit_card":    {pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,15}\d\b`)},
+	"ssn":            {pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	"email":          {pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+}
+
+// redactionRule is a compiled rule. A rule with a pattern masks matches inside string values,
+// limited to fields when set; a rule with only fields masks those fields' whole values.
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+	fields      map[string]bool // Lower-cased payload keys, at any nesting level
+}
+
+// Redactor masks payload values matching each license's redaction rules. Rules are read from
+// the redaction_rules table, which the API manages, and refreshed periodically.
+type Redactor struct {
+	clickhouse driver.Conn
+	mu         sync.RWMutex
+	rules      map[string][]redactionRule // By tenant
+}
+
+// NewRedactor creates a redactor backed by the redaction_rules table
+func NewRedactor(conn driver.Conn) *Redactor {
+	return &Redactor{clickhouse: conn, rules: make(map[string][]redactionRule)}
+}
+
+// Run loads the rules and reloads them every interval until ctx is cancelled
+func (r *Redactor) Run(ctx context.Context, interval time.Duration) {
+	if err := r.refresh(ctx); err != nil {
+		log.Warnf("Failed to load redaction rules: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil {
+				log.Warnf("Failed to refresh redaction rules: %v", err)
+			}
+		}
+	}
+}
+
+func (r *Redactor) refresh(ctx context.Context) error {
+	rows, err := r.clickhouse.Query(ctx, `
+		SELECT tenant_id, rule_id, preset, pattern, fields, replacement
+		FROM redaction_rules FINAL
+		WHERE deleted = 0 AND enabled = 1
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rules := make(map[string][]redactionRule)
+	for rows.Next() {
+		var tenantID, ruleID, preset, pattern, replacement string
+		var fields []string
+		if err := rows.Scan(&tenantID, &ruleID, &preset, &pattern, &fields, &replacement); err != nil {
+			return err
+		}
+
+		rule, err := compileRedactionRule(preset, pattern, fields, replacement)
+		if err != nil {
+			// The API validates rules, so this only happens on a hand-edited row
+			log.Warnf("Skipping invalid redaction rule %s of %s: %v", ruleID, tenantID, err)
+			continue
+		}
+		rules[tenantID] = append(rules[tenantID], rule)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+	return nil
+}
+
+func compileRedactionRule(preset, pattern string, fields []string, replacement string) (redactionRule, error) {
+	if replacement == "" {
+		replacement = defaultRedactionReplacement
+	}
+	rule := redactionRule{replacement: replacement}
+
+	if len(fields) > 0 {
+		rule.fields = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			rule.fields[strings.ToLower(field)] = true
+		}
+	}
+
+	switch {
+	case preset != "":
+		builtin, ok := redactionPresets[preset]
+		if !ok {
+			return rule, fmt.Errorf("unknown preset %q", preset)
+		}
+		rule.pattern = builtin.pattern
+		if builtin.keepPrefix {
+			rule.replacement = "${1}" + replacement
+		}
+	case pattern != "":
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return rule, err
+		}
+		rule.pattern = compiled
+	case rule.fields == nil:
+		return rule, errors.New("rule has no preset, pattern or fields")
+	}
+	return rule, nil
+}
+
+// Redact applies the tenant's rules to the event payload and flags the event when anything was
+// masked. Payloads that are not JSON objects are matched as plain text by pattern rules.
+func (r *Redactor) Redact(event *Event) {
+	if r == nil || event.Payload == "" {
+		return
+	}
+	r.mu.RLock()
+	rules := r.rules[event.TenantID]
+	r.mu.RUnlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(event.Payload))
+	decoder.UseNumber() // Keep numbers exactly as sent
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		text := event.Payload
+		for _, rule := range rules {
+			if rule.pattern != nil && rule.fields == nil {
+				text = rule.pattern.ReplaceAllString(text, rule.replacement)
+			}
+		}
+		if text != event.Payload {
+			event.Payload = text
+			event.Redacted = true
+		}
+		return
+	}
+
+	redacted, changed := redactValue(payload, "", rules)
+	if !changed {
+		return
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(redacted); err != nil {
+		log.Warnf("Failed to encode redacted payload: %v", err)
+		return
+	}
+	event.Payload = strings.TrimSuffix(buf.String(), "\n")
+	event.Redacted = true
+}
+
+// redactValue walks a decoded payload; key is the name of the field holding value
+func redactValue(value interface{}, key string, rules []redactionRule) (interface{}, bool) {
+	// Whole-field rules mask the value whatever its type, including nested objects
+	for _, rule := range rules {
+		if rule.pattern == nil && rule.fields[key] {
+			return rule.replacement, true
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		changed := false
+		for field, nested := range v {
+			redacted, fieldChanged := redactValue(nested, strings.ToLower(field), rules)
+			if fieldChanged {
+				v[field] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	case []interface{}:
+		changed := false
+		for i, nested := range v {
+			redacted, itemChanged := redactValue(nested, key, rules)
+			if itemChanged {
+				v[i] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return value, false
+	}
+	original := text
+	for _, rule := range rules {
+		if rule.pattern == nil || (rule.fields != nil && !rule.fields[key]) {
+			continue
+		}
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text, text != original
+}
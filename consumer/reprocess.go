@@ -0,0 +1,614 @@
+// Event Reprocessing
+// Re-applies the current enrichment to stored events for jobs created through the API
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// reprocessPollInterval is how often the consumer looks for a pending job
+	reprocessPollInterval = 30 * time.Second
+
+	// reprocessClaimSettle is how long a claim must survive before the job is run; when two
+	// consumers claim the same job, the later claim wins and the other backs off
+	reprocessClaimSettle = 2 * time.Second
+
+	// reprocessStaleAfter is how long a running job may go without a checkpoint before another
+	// consumer takes it over. A checkpoint is written after every partition.
+	reprocessStaleAfter = 2 * time.Hour
+
+	// reprocessMutationPoll is how often a partition's mutation is checked for completion
+	reprocessMutationPoll = 5 * time.Second
+
+	// reprocessLookupBatch is the number of lookup rows inserted at a time
+	reprocessLookupBatch = 10000
+)
+
+// Enrichments a reprocessing job can re-apply
+const (
+	enrichmentGeoIP      = "geoip"      // dst_country, dst_asn, dst_as_org, src_country
+	enrichmentRDNS       = "rdns"       // dst_hostname
+	enrichmentReputation = "reputation" // process_reputation
+	enrichmentMITRE      = "mitre"      // Bare MITRE IDs in place of the "TA0002_Execution" form of older agents
+)
+
+// Reprocessing job statuses
+const (
+	reprocessPending   = "pending"
+	reprocessRunning   = "running"
+	reprocessCompleted = "completed"
+	reprocessFailed    = "failed"
+	reprocessCancelled = "cancelled"
+)
+
+// errReprocessCancelled stops a job cancelled through the API
+var errReprocessCancelled = errors.New("reprocessing job cancelled")
+
+// reprocessJob is the latest version of a telemetry_reprocess_jobs row
+type reprocessJob struct {
+	tenantID        string
+	jobID           string
+	start, end      time.Time
+	enrichments     []string
+	status          string
+	claimedBy       string
+	totalPartitions uint32
+	donePartitions  uint32
+	totalEvents     uint64
+	processedEvents uint64
+	errorMessage    string
+	requestedBy     string
+	createdAt       time.Time
+	startedAt       *time.Time
+	finishedAt      *time.Time
+}
+
+// reprocessPartition is one monthly telemetry_events partition of a job's range
+type reprocessPartition struct {
+	id     uint32 // toYYYYMM(timestamp)
+	events uint64
+}
+
+// Reprocessor runs reprocessing jobs: it re-reads a tenant's events in a time range and updates
+// their enrichment columns with what the consumer's enricher resolves today, so events stored
+// before a GeoIP or reputation database update carry current intelligence. The distinct IPs and
+// hashes of each monthly partition are resolved once into a Join table, and a single ALTER
+// UPDATE per partition applies them with joinGet. Only enrichment columns are rewritten; the
+// hourly statistics rollup keeps the MITRE values it was built from.
+type Reprocessor struct {
+	clickhouse driver.Conn
+	enricher   *Enricher
+	instanceID string
+
+	eventsReprocessed atomic.Uint64
+	jobsCompleted     atomic.Uint64
+	jobsFailed        atomic.Uint64
+}
+
+// NewReprocessorFromEnv creates the reprocessor. It returns nil when CONSUMER_REPROCESS is
+// false, e.g. on consumer replicas that should only ingest.
+func NewReprocessorFromEnv(conn driver.Conn, enricher *Enricher) *Reprocessor {
+	if getEnv("CONSUMER_REPROCESS", "true") == "false" {
+		return nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "consumer"
+	}
+	return &Reprocessor{
+		clickhouse: conn,
+		enricher:   enricher,
+		instanceID: fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+	}
+}
+
+// Run picks up pending jobs, one at a time, until ctx is cancelled
+func (r *Reprocessor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job, ok, err := r.claim(ctx)
+			if err != nil {
+				log.Warnf("Failed to claim reprocessing job: %v", err)
+				continue
+			}
+			if ok {
+				r.runJob(ctx, job)
+			}
+		}
+	}
+}
+
+// runJob processes a claimed job and records its outcome
+func (r *Reprocessor) runJob(ctx context.Context, job reprocessJob) {
+	entry := log.WithFields(log.Fields{"job_id": job.jobID, "tenant_id": job.tenantID})
+	entry.Infof("Reprocessing events from %s to %s (%s)",
+		job.start.Format(time.RFC3339), job.end.Format(time.RFC3339), strings.Join(job.enrichments, ", "))
+
+	err := r.process(ctx, &job)
+	switch {
+	case ctx.Err() != nil:
+		// Shutting down; the job is taken over once its checkpoint goes stale
+		return
+	case errors.Is(err, errReprocessCancelled):
+		entry.Info("Reprocessing job cancelled")
+		return
+	case err != nil:
+		r.jobsFailed.Add(1)
+		entry.Errorf("Reprocessing job failed: %v", err)
+		job.status = reprocessFailed
+		job.errorMessage = err.Error()
+	default:
+		r.jobsCompleted.Add(1)
+		entry.Infof("Reprocessed %d events", job.processedEvents)
+		job.status = reprocessCompleted
+	}
+
+	now := time.Now().UTC()
+	job.finishedAt = &now
+	if err := r.write(context.Background(), job); err != nil {
+		entry.Errorf("Failed to record reprocessing job outcome: %v", err)
+	}
+}
+
+// claim takes the oldest pending job, or a running one whose consumer stopped checkpointing
+func (r *Reprocessor) claim(ctx context.Context) (reprocessJob, bool, error) {
+	jobs, err := r.query(ctx, `
+		WHERE status = ? OR (status = ? AND updated_at < ?)
+		ORDER BY created_at
+		LIMIT 1`,
+		reprocessPending, reprocessRunning, time.Now().Add(-reprocessStaleAfter))
+	if err != nil || len(jobs) == 0 {
+		return reprocessJob{}, false, err
+	}
+
+	job := jobs[0]
+	if job.status == reprocessRunning {
+		log.WithFields(log.Fields{"job_id": job.jobID, "previous_consumer": job.claimedBy}).
+			Warn("Taking over stale reprocessing job")
+	}
+	job.status = reprocessRunning
+	job.claimedBy = r.instanceID
+	if job.startedAt == nil {
+		now := time.Now().UTC()
+		job.startedAt = &now
+	}
+	if err := r.write(ctx, job); err != nil {
+		return reprocessJob{}, false, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return reprocessJob{}, false, ctx.Err()
+	case <-time.After(reprocessClaimSettle):
+	}
+
+	current, err := r.query(ctx, "WHERE tenant_id = ? AND job_id = ?", job.tenantID, job.jobID)
+	if err != nil {
+		return reprocessJob{}, false, err
+	}
+	if len(current) == 0 || current[0].status != reprocessRunning || current[0].claimedBy != r.instanceID {
+		return reprocessJob{}, false, nil
+	}
+	return job, true, nil
+}
+
+// process reprocesses the job's partitions in order, checkpointing after each, from where a
+// previous run stopped
+func (r *Reprocessor) process(ctx context.Context, job *reprocessJob) error {
+	job.enrichments = r.available(job.enrichments)
+	if len(job.enrichments) == 0 {
+		return fmt.Errorf("none of the requested enrichments is configured on this consumer")
+	}
+
+	partitions, err := r.partitions(ctx, *job)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions: %w", err)
+	}
+	if job.donePartitions == 0 || job.totalPartitions != uint32(len(partitions)) {
+		job.donePartitions = 0
+		job.processedEvents = 0
+		job.totalPartitions = uint32(len(partitions))
+		job.totalEvents = 0
+		for _, p := range partitions {
+			job.totalEvents += p.events
+		}
+	}
+	if err := r.write(ctx, *job); err != nil {
+		return err
+	}
+
+	lookups := ""
+	if containsAny(job.enrichments, enrichmentGeoIP, enrichmentRDNS, enrichmentReputation) {
+		lookups = "telemetry_reprocess_lookup_" + strings.ReplaceAll(uuid.NewSHA1(uuid.Nil, []byte(job.jobID)).String(), "-", "")
+		if err := r.clickhouse.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+lookups+` (
+			key String, country String, asn UInt32, as_org String, hostname String, reputation String
+		) ENGINE = Join(ANY, LEFT, key)`); err != nil {
+			return fmt.Errorf("failed to create lookup table: %w", err)
+		}
+		defer func() {
+			if err := r.clickhouse.Exec(context.Background(), "DROP TABLE IF EXISTS "+lookups); err != nil {
+				log.WithField("job_id", job.jobID).Warnf("Failed to drop lookup table %s: %v", lookups, err)
+			}
+		}()
+	}
+
+	for i := job.donePartitions; i < uint32(len(partitions)); i++ {
+		if err := r.checkCancelled(ctx, *job); err != nil {
+			return err
+		}
+		if err := r.reprocessPartition(ctx, *job, lookups, partitions[i]); err != nil {
+			return fmt.Errorf("partition %d: %w", partitions[i].id, err)
+		}
+		job.donePartitions++
+		job.processedEvents += partitions[i].events
+		r.eventsReprocessed.Add(partitions[i].events)
+
+		// A cancellation during the partition must not be overwritten by the checkpoint
+		if err := r.checkCancelled(ctx, *job); err != nil {
+			return err
+		}
+		if err := r.write(ctx, *job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCancelled returns errReprocessCancelled once the job has been cancelled or removed
+func (r *Reprocessor) checkCancelled(ctx context.Context, job reprocessJob) error {
+	current, err := r.query(ctx, "WHERE tenant_id = ? AND job_id = ?", job.tenantID, job.jobID)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 || current[0].status == reprocessCancelled {
+		return errReprocessCancelled
+	}
+	return nil
+}
+
+// available drops enrichments whose data source this consumer has not loaded
+func (r *Reprocessor) available(requested []string) []string {
+	available := make([]string, 0, len(requested))
+	for _, enrichment := range requested {
+		configured := false
+		switch enrichment {
+		case enrichmentGeoIP:
+			configured = r.enricher != nil && r.enricher.geoIP != nil
+		case enrichmentRDNS:
+			configured = r.enricher != nil && r.enricher.rdns
+		case enrichmentReputation:
+			configured = r.enricher != nil && r.enricher.reputation != nil
+		case enrichmentMITRE:
+			configured = true
+		}
+		if configured {
+			available = append(available, enrichment)
+		} else {
+			log.Warnf("Skipping %s reprocessing: not configured on this consumer", enrichment)
+		}
+	}
+	return available
+}
+
+// partitions returns the monthly partitions holding the job's events, oldest first
+func (r *Reprocessor) partitions(ctx context.Context, job reprocessJob) ([]reprocessPartition, error) {
+	rows, err := r.clickhouse.Query(ctx, `
+		SELECT toYYYYMM(timestamp) AS month, count()
+		FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ?
+		GROUP BY month
+		ORDER BY month
+	`, job.tenantID, job.start, job.end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := []reprocessPartition{}
+	for rows.Next() {
+		var p reprocessPartition
+		if err := rows.Scan(&p.id, &p.events); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// reprocessPartition resolves the partition's distinct IPs and hashes into the lookup table and
+// rewrites the enrichment columns of the job's events in it
+func (r *Reprocessor) reprocessPartition(ctx context.Context, job reprocessJob, lookups string, p reprocessPartition) error {
+	if lookups != "" {
+		if err := r.resolveLookups(ctx, job, lookups, p); err != nil {
+			return err
+		}
+	}
+
+	joinGet := func(column, prefix, expr string) string {
+		return fmt.Sprintf("joinGet('%s', '%s', concat('%s', %s))", lookups, column, prefix, expr)
+	}
+	bareID := func(column string) string {
+		return fmt.Sprintf("%[1]s = if(position(%[1]s, '_') > 1, substring(%[1]s, 1, position(%[1]s, '_') - 1), %[1]s)", column)
+	}
+	const srcIP, hash = "JSONExtractString(payload, 'src_ip')", "JSONExtractString(payload, 'hash')"
+
+	assignments := []string{}
+	for _, enrichment := range job.enrichments {
+		switch enrichment {
+		case enrichmentGeoIP:
+			assignments = append(assignments,
+				"dst_country = "+joinGet("country", "dst:", "dst_ip"),
+				"dst_asn = "+joinGet("asn", "dst:", "dst_ip"),
+				"dst_as_org = "+joinGet("as_org", "dst:", "dst_ip"),
+				"src_country = "+joinGet("country", "src:", srcIP))
+		case enrichmentRDNS:
+			assignments = append(assignments, "dst_hostname = "+joinGet("hostname", "dst:", "dst_ip"))
+		case enrichmentReputation:
+			// Events without a hash keep whatever they have, as at write time
+			assignments = append(assignments, fmt.Sprintf("process_reputation = if(%s = '', process_reputation, %s)",
+				hash, joinGet("reputation", "hash:", hash)))
+		case enrichmentMITRE:
+			assignments = append(assignments, bareID("mitre_tactic"), bareID("mitre_technique"))
+		}
+	}
+
+	// Holds are read for every partition, so one placed while the job runs applies from the next
+	holds, err := r.legalHolds(ctx, job)
+	if err != nil {
+		return err
+	}
+	heldFilter := ""
+	args := []interface{}{job.tenantID, job.start, job.end}
+	for _, hold := range holds {
+		heldFilter += " AND NOT (timestamp >= ? AND timestamp <= ?)"
+		args = append(args, hold.start, hold.end)
+		log.WithFields(log.Fields{"job_id": job.jobID, "hold_id": hold.holdID}).
+			Infof("Leaving events from %s to %s unchanged: under legal hold", hold.start.Format(time.RFC3339), hold.end.Format(time.RFC3339))
+	}
+
+	// The marker literal identifies this mutation in system.mutations
+	marker := fmt.Sprintf("reprocess:%s:%d", job.jobID, p.id)
+	args = append(args, marker)
+	mutationCtx := clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_nondeterministic_mutations": 1, // joinGet reads another table
+	}))
+	if err := r.clickhouse.Exec(mutationCtx, fmt.Sprintf(`
+		ALTER TABLE telemetry_events UPDATE %s
+		IN PARTITION %d
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ?%s AND ? != ''
+	`, strings.Join(assignments, ", "), p.id, heldFilter), args...); err != nil {
+		return fmt.Errorf("failed to start mutation: %w", err)
+	}
+	return r.awaitMutation(ctx, marker)
+}
+
+// legalHold is the time range of an active legal hold, replicated from the API's database
+type legalHold struct {
+	holdID string
+	start  time.Time
+	end    time.Time
+}
+
+// legalHolds returns the tenant's active legal holds overlapping the job's range. Held events
+// are evidence and keep the enrichment they were stored with, whichever agents the hold covers.
+func (r *Reprocessor) legalHolds(ctx context.Context, job reprocessJob) ([]legalHold, error) {
+	rows, err := r.clickhouse.Query(ctx, `
+		SELECT hold_id, start_time, end_time
+		FROM legal_holds FINAL
+		WHERE tenant_id = ? AND active = 1 AND start_time < ? AND end_time >= ?
+	`, job.tenantID, job.end, job.start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legal holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []legalHold{}
+	for rows.Next() {
+		var hold legalHold
+		if err := rows.Scan(&hold.holdID, &hold.start, &hold.end); err != nil {
+			return nil, fmt.Errorf("failed to scan legal hold: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// resolveLookups inserts the current enrichment of every distinct IP and hash of the job's
+// events in the partition into the lookup table
+func (r *Reprocessor) resolveLookups(ctx context.Context, job reprocessJob, lookups string, p reprocessPartition) error {
+	geoIP := containsAny(job.enrichments, enrichmentGeoIP)
+	rdns := containsAny(job.enrichments, enrichmentRDNS)
+	reputation := containsAny(job.enrichments, enrichmentReputation)
+
+	type source struct {
+		prefix string
+		expr   string
+	}
+	sources := []source{}
+	if geoIP || rdns {
+		sources = append(sources, source{"dst:", "dst_ip"})
+	}
+	if geoIP {
+		sources = append(sources, source{"src:", "JSONExtractString(payload, 'src_ip')"})
+	}
+	if reputation {
+		sources = append(sources, source{"hash:", "JSONExtractString(payload, 'hash')"})
+	}
+
+	for _, src := range sources {
+		rows, err := r.clickhouse.Query(ctx, fmt.Sprintf(`
+			SELECT DISTINCT %[1]s
+			FROM telemetry_events
+			WHERE tenant_id = ? AND toYYYYMM(timestamp) = ? AND timestamp >= ? AND timestamp < ? AND %[1]s != ''
+		`, src.expr), job.tenantID, p.id, job.start, job.end)
+		if err != nil {
+			return fmt.Errorf("failed to read distinct %s values: %w", strings.TrimSuffix(src.prefix, ":"), err)
+		}
+
+		batch, err := r.clickhouse.PrepareBatch(ctx, "INSERT INTO "+lookups)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to prepare lookup batch: %w", err)
+		}
+		pending := 0
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return err
+			}
+
+			var geo GeoInfo
+			var hostname, verdict string
+			switch src.prefix {
+			case "hash:":
+				verdict = r.enricher.lookupReputation(value)
+			default:
+				// Values that are not IPs are skipped at write time too
+				ip := net.ParseIP(value)
+				if ip == nil {
+					continue
+				}
+				if geoIP {
+					geo, _ = r.enricher.lookupGeo(value, ip)
+				}
+				if rdns && src.prefix == "dst:" {
+					hostname = r.enricher.lookupRDNS(value)
+				}
+			}
+			if err := batch.Append(src.prefix+value, geo.Country, geo.ASN, geo.ASOrg, hostname, verdict); err != nil {
+				rows.Close()
+				return err
+			}
+
+			if pending++; pending >= reprocessLookupBatch {
+				if err := batch.Send(); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to insert lookups: %w", err)
+				}
+				if batch, err = r.clickhouse.PrepareBatch(ctx, "INSERT INTO "+lookups); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to prepare lookup batch: %w", err)
+				}
+				pending = 0
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := batch.Send(); err != nil {
+			return fmt.Errorf("failed to insert lookups: %w", err)
+		}
+	}
+	return nil
+}
+
+// awaitMutation waits for the marked mutation to finish. A mutation ClickHouse keeps failing
+// on is killed rather than retried forever.
+func (r *Reprocessor) awaitMutation(ctx context.Context, marker string) error {
+	ticker := time.NewTicker(reprocessMutationPoll)
+	defer ticker.Stop()
+
+	for {
+		var pending uint64
+		var failReason string
+		if err := r.clickhouse.QueryRow(ctx, `
+			SELECT count(), any(latest_fail_reason)
+			FROM system.mutations
+			WHERE database = currentDatabase() AND table = 'telemetry_events'
+			  AND is_done = 0 AND position(command, ?) > 0
+		`, marker).Scan(&pending, &failReason); err != nil {
+			return fmt.Errorf("failed to check mutation: %w", err)
+		}
+		if pending == 0 {
+			return nil
+		}
+		if failReason != "" {
+			if err := r.clickhouse.Exec(context.Background(), `
+				KILL MUTATION WHERE database = currentDatabase() AND table = 'telemetry_events'
+				  AND position(command, ?) > 0
+			`, marker); err != nil {
+				log.Warnf("Failed to kill mutation %s: %v", marker, err)
+			}
+			return fmt.Errorf("mutation failed: %s", failReason)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// query returns the latest versions of the jobs matching a WHERE clause
+func (r *Reprocessor) query(ctx context.Context, where string, args ...interface{}) ([]reprocessJob, error) {
+	rows, err := r.clickhouse.Query(ctx, `
+		SELECT tenant_id, job_id, start_time, end_time, enrichments, status, claimed_by,
+		       total_partitions, done_partitions, total_events, processed_events, error,
+		       requested_by, created_at, started_at, finished_at
+		FROM telemetry_reprocess_jobs FINAL
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []reprocessJob{}
+	for rows.Next() {
+		var j reprocessJob
+		if err := rows.Scan(&j.tenantID, &j.jobID, &j.start, &j.end, &j.enrichments, &j.status, &j.claimedBy,
+			&j.totalPartitions, &j.donePartitions, &j.totalEvents, &j.processedEvents, &j.errorMessage,
+			&j.requestedBy, &j.createdAt, &j.startedAt, &j.finishedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// write inserts a new version of the job; the ReplacingMergeTree keeps the latest
+func (r *Reprocessor) write(ctx context.Context, j reprocessJob) error {
+	return r.clickhouse.Exec(ctx, `
+		INSERT INTO telemetry_reprocess_jobs (
+			tenant_id, job_id, start_time, end_time, enrichments, status, claimed_by,
+			total_partitions, done_partitions, total_events, processed_events, error,
+			requested_by, created_at, started_at, finished_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, j.tenantID, j.jobID, j.start, j.end, j.enrichments, j.status, j.claimedBy,
+		j.totalPartitions, j.donePartitions, j.totalEvents, j.processedEvents, j.errorMessage,
+		j.requestedBy, j.createdAt, j.startedAt, j.finishedAt, time.Now().UTC())
+}
+
+// containsAny reports whether values holds any of the wanted strings
+func containsAny(values []string, wanted ...string) bool {
+	for _, value := range values {
+		for _, w := range wanted {
+			if value == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Subject Filtering
+// Which slice of the ingest stream this consumer reads, for ingestors routing by tenant and type
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// natsStream is the JetStream stream the ingestor publishes into
+const natsStream = "EDR_EVENTS"
+
+// NewSubscriptionFromEnv returns the filter subject and durable name configured by
+// CONSUMER_SUBJECT and CONSUMER_DURABLE. The defaults read edr.events.raw, the ingestor's
+// unrouted subject. With INGESTOR_SUBJECT_TEMPLATE=edr.events.{tenant}.{type} the ClickHouse
+// writer filters on edr.events.*.*, and a specialized consumer such as a DLP-only processor
+// uses its own durable with e.g. edr.events.*.dlp_violation. A durable's filter is fixed when
+// it is created, so changing CONSUMER_SUBJECT needs a new CONSUMER_DURABLE.
+func NewSubscriptionFromEnv() (subject, durable string, err error) {
+	subject = getEnv("CONSUMER_SUBJECT", natsSubject)
+	durable = getEnv("CONSUMER_DURABLE", natsDurable)
+
+	if !strings.HasPrefix(subject, "edr.events.") {
+		return "", "", fmt.Errorf("CONSUMER_SUBJECT %q must be under edr.events.", subject)
+	}
+	if subjectMatches(subject, dlqSubject) {
+		return "", "", fmt.Errorf("CONSUMER_SUBJECT %q includes the dead-letter subject %s; dead-lettered events would be re-consumed", subject, dlqSubject)
+	}
+	if durable == "" || strings.ContainsAny(durable, ".*> \t") {
+		return "", "", fmt.Errorf("invalid CONSUMER_DURABLE %q", durable)
+	}
+	return subject, durable, nil
+}
+
+// subjectMatches reports whether a NATS filter subject, with * and > wildcards, matches subject
+func subjectMatches(filter, subject string) bool {
+	filterTokens := strings.Split(filter, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(filterTokens) == len(subjectTokens)
+}
@@ -0,0 +1,210 @@
+// Event Sampling
+// Per-license sampling and per-minute aggregation of high-volume, low-value event types
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+// samplingRefreshInterval is how long a policy change takes to reach the consumer
+const samplingRefreshInterval = 30 * time.Second
+
+// Sampling modes
+const (
+	SamplingModeSample    = "sample"    // Store 1 in N events
+	SamplingModeAggregate = "aggregate" // Store none, only per-minute counts
+)
+
+// unsampledEventTypes are security-relevant event types stored in full whatever the policy says
+var unsampledEventTypes = map[string]bool{
+	"dlp_violation":  true,
+	"authentication": true,
+}
+
+// SamplingPolicy reduces the volume of one event type for one tenant
+type SamplingPolicy struct {
+	Mode            string
+	SampleRate      uint32
+	KeepMinSeverity int32
+
+	seen atomic.Uint64 // Events considered so far, for deterministic 1-in-N sampling
+}
+
+type samplingKey struct {
+	tenantID  string
+	eventType string
+}
+
+// Sampler decides which events are stored individually. Policies are read from the
+// sampling_policies table, which the API manages, and refreshed periodically.
+type Sampler struct {
+	clickhouse driver.Conn
+	mu         sync.RWMutex
+	policies   map[samplingKey]*SamplingPolicy
+}
+
+// NewSampler creates a sampler backed by the sampling_policies table
+func NewSampler(conn driver.Conn) *Sampler {
+	return &Sampler{clickhouse: conn, policies: make(map[samplingKey]*SamplingPolicy)}
+}
+
+// Run loads the policies and reloads them every interval until ctx is cancelled
+func (s *Sampler) Run(ctx context.Context, interval time.Duration) {
+	if err := s.refresh(ctx); err != nil {
+		log.Warnf("Failed to load sampling policies: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refresh(ctx); err != nil {
+				log.Warnf("Failed to refresh sampling policies: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Sampler) refresh(ctx context.Context) error {
+	rows, err := s.clickhouse.Query(ctx, `
+		SELECT tenant_id, event_type, toString(mode), sample_rate, keep_min_severity
+		FROM sampling_policies FINAL
+		WHERE deleted = 0
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.RLock()
+	previous := s.policies
+	s.mu.RUnlock()
+
+	policies := make(map[samplingKey]*SamplingPolicy)
+	for rows.Next() {
+		var key samplingKey
+		var mode string
+		var rate uint32
+		var minSeverity uint8
+		if err := rows.Scan(&key.tenantID, &key.eventType, &mode, &rate, &minSeverity); err != nil {
+			return err
+		}
+		if rate == 0 {
+			rate = 1
+		}
+
+		policy := &SamplingPolicy{Mode: mode, SampleRate: rate, KeepMinSeverity: int32(minSeverity)}
+		// Carry the counter over so a refresh doesn't restart every 1-in-N cycle
+		if old, ok := previous[key]; ok {
+			policy.seen.Store(old.seen.Load())
+		}
+		policies[key] = policy
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.policies = policies
+	s.mu.Unlock()
+	return nil
+}
+
+// Keep reports whether an event is stored individually. High-severity events, events mapped to
+// a MITRE technique, events from processes with a bad reputation and security-relevant event
+// types are always kept.
+func (s *Sampler) Keep(event *Event) bool {
+	if s == nil {
+		return true
+	}
+	eventType := strings.ToLower(event.EventType)
+	if unsampledEventTypes[eventType] {
+		return true
+	}
+
+	s.mu.RLock()
+	policy, ok := s.policies[samplingKey{tenantID: event.TenantID, eventType: eventType}]
+	s.mu.RUnlock()
+	if !ok {
+		return true
+	}
+
+	if event.Severity >= policy.KeepMinSeverity || event.MitreTechnique != "" {
+		return true
+	}
+	if event.ProcessReputation != "" && event.ProcessReputation != "unknown" && event.ProcessReputation != "known_good" {
+		return true
+	}
+
+	switch policy.Mode {
+	case SamplingModeAggregate:
+		return false
+	case SamplingModeSample:
+		return policy.SampleRate <= 1 || policy.seen.Add(1)%uint64(policy.SampleRate) == 1
+	}
+	return true
+}
+
+type rollupKey struct {
+	tenantID    string
+	agentID     string
+	hostname    string
+	eventType   string
+	processName string
+	minute      int64
+}
+
+// rollupBatch accumulates per-minute counts of events that were not stored individually
+type rollupBatch map[rollupKey]uint64
+
+// add counts an event in its minute
+func (r rollupBatch) add(event *Event) {
+	var payload struct {
+		ProcessName string `json:"process_name"`
+	}
+	if event.Payload != "" {
+		json.Unmarshal([]byte(event.Payload), &payload)
+	}
+
+	r[rollupKey{
+		tenantID:    event.TenantID,
+		agentID:     event.AgentID,
+		hostname:    event.Hostname,
+		eventType:   strings.ToLower(event.EventType),
+		processName: payload.ProcessName,
+		minute:      time.UnixMilli(event.Timestamp).Truncate(time.Minute).Unix(),
+	}]++
+}
+
+// insertRollups writes accumulated counts to telemetry_rollups
+func (c *Consumer) insertRollups(rollups rollupBatch) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	batch, err := c.clickhouse.PrepareBatch(context.Background(), `
+		INSERT INTO telemetry_rollups (tenant_id, agent_id, hostname, event_type, process_name, minute, event_count)
+	`)
+	if err != nil {
+		return err
+	}
+	for key, count := range rollups {
+		if err := batch.Append(key.tenantID, key.agentID, key.hostname, key.eventType, key.processName,
+			time.Unix(key.minute, 0).UTC(), count); err != nil {
+			return err
+		}
+	}
+	return batch.Send()
+}
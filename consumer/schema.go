@@ -0,0 +1,363 @@
+// Payload Schemas
+// Optional per-event-type JSON schema validation of payloads, with failing events dead-lettered
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// dlqSubject receives events the consumer will never store. It is inside the ingest stream's
+// edr.events.> subjects but outside the consumer's filter, so it is retained and not re-consumed.
+const dlqSubject = "edr.events.dlq"
+
+// jsonSchema is the supported subset of JSON Schema: type, enum, properties, required,
+// additionalProperties (boolean), items, numeric and length bounds, and pattern. Schemas using
+// other keywords, such as $ref or oneOf, are rejected when loaded rather than half-enforced.
+type jsonSchema struct {
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Pattern              string                 `json:"pattern"`
+
+	// Annotations, accepted and ignored
+	Schema      string          `json:"$schema"`
+	ID          string          `json:"$id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Default     json.RawMessage `json:"default"`
+	Examples    json.RawMessage `json:"examples"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the "type" keyword, written as one type name or a list of them
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// compile checks type names and compiles patterns throughout the schema
+func (s *jsonSchema) compile(path string) error {
+	for _, name := range s.Type {
+		switch name {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+		s.pattern = re
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: schema must be an object", path, name)
+		}
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// validate returns the first violation of the schema by value, described at path
+func (s *jsonSchema) validate(value interface{}, path string) string {
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		return fmt.Sprintf("%s must be %s, got %s", path, strings.Join(s.Type, " or "), schemaTypeOf(value))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if schemaEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%s is not one of the allowed values", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Sprintf("%s.%s is required", path, name)
+			}
+		}
+		// Sorted so the reported violation is stable across deliveries
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Sprintf("%s.%s is not an allowed field", path, name)
+				}
+				continue
+			}
+			if reason := property.validate(v[name], path+"."+name); reason != "" {
+				return reason
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Sprintf("%s must have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Sprintf("%s must have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if reason := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+					return reason
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Sprintf("%s does not match pattern %s", path, s.Pattern)
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Sprintf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Sprintf("%s must be at most %v", path, *s.Maximum)
+		}
+	}
+	return ""
+}
+
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	actual := schemaTypeOf(value)
+	for _, name := range s.Type {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeOf names the JSON type of a value decoded with UseNumber
+func schemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if n, err := v.Float64(); err == nil && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// schemaEqual compares an enum member with a value, numbers by value
+func schemaEqual(allowed, value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		a, ok := allowed.(float64)
+		f, err := n.Float64()
+		return ok && err == nil && a == f
+	}
+	a, _ := json.Marshal(allowed)
+	b, _ := json.Marshal(value)
+	return bytes.Equal(a, b)
+}
+
+// SchemaValidator checks payloads against the schema of their event type. Schemas are files
+// named <event_type>.json in the schema directory.
+type SchemaValidator struct {
+	schemas map[string]*jsonSchema
+	strict  bool // Event types without a schema fail instead of passing
+
+	mu       sync.Mutex
+	failures map[string]*atomic.Uint64 // By event type
+}
+
+// NewSchemaValidatorFromEnv loads schemas from CONSUMER_SCHEMA_DIR. It returns nil when the
+// variable is unset. CONSUMER_SCHEMA_STRICT=true also rejects event types without a schema.
+func NewSchemaValidatorFromEnv() (*SchemaValidator, error) {
+	dir := getEnv("CONSUMER_SCHEMA_DIR", "")
+	if dir == "" {
+		return nil, nil
+	}
+	strict, err := strconv.ParseBool(getEnv("CONSUMER_SCHEMA_STRICT", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONSUMER_SCHEMA_STRICT: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 && !strict {
+		return nil, fmt.Errorf("no *.json schemas in %s", dir)
+	}
+
+	v := &SchemaValidator{
+		schemas:  make(map[string]*jsonSchema, len(paths)),
+		strict:   strict,
+		failures: make(map[string]*atomic.Uint64),
+	}
+	for _, path := range paths {
+		eventType := strings.TrimSuffix(filepath.Base(path), ".json")
+		schema, err := loadSchema(path)
+		if err != nil {
+			return nil, fmt.Errorf("schema for %s: %w", eventType, err)
+		}
+		v.schemas[eventType] = schema
+	}
+	return v, nil
+}
+
+func loadSchema(path string) (*jsonSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var schema jsonSchema
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, fmt.Errorf("unsupported or malformed schema: %w", err)
+	}
+	if err := schema.compile("payload"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Validate returns why the event's payload violates its schema, or "" when it conforms
+func (v *SchemaValidator) Validate(event *Event) string {
+	if v == nil {
+		return ""
+	}
+	schema, ok := v.schemas[event.EventType]
+	if !ok {
+		if v.strict {
+			return v.fail(event.EventType, fmt.Sprintf("no schema for event type %q", event.EventType))
+		}
+		return ""
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(event.Payload))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return v.fail(event.EventType, "payload is not valid JSON")
+	}
+	if decoder.More() {
+		return v.fail(event.EventType, "payload has trailing data after the JSON value")
+	}
+	if reason := schema.validate(payload, "payload"); reason != "" {
+		return v.fail(event.EventType, reason)
+	}
+	return ""
+}
+
+func (v *SchemaValidator) fail(eventType, reason string) string {
+	v.mu.Lock()
+	counter, ok := v.failures[eventType]
+	if !ok {
+		counter = &atomic.Uint64{}
+		v.failures[eventType] = counter
+	}
+	v.mu.Unlock()
+	counter.Add(1)
+	return reason
+}
+
+// Failures returns the validation failure count per event type
+func (v *SchemaValidator) Failures() map[string]uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	counts := make(map[string]uint64, len(v.failures))
+	for eventType, counter := range v.failures {
+		counts[eventType] = counter.Load()
+	}
+	return counts
+}
+
+// deadLetter republishes a message to the DLQ subject with the reason in headers and acks the
+// original. If the publish fails the original is nak'd for redelivery, so nothing is lost.
+func (c *Consumer) deadLetter(workerID int, msg *nats.Msg, event *Event, reason string) {
+	dlqMsg := nats.NewMsg(dlqSubject)
+	dlqMsg.Data = msg.Data
+	dlqMsg.Header.Set("Prive-DLQ-Reason", reason)
+	dlqMsg.Header.Set("Prive-DLQ-Source-Subject", msg.Subject)
+	dlqMsg.Header.Set("Prive-Event-Type", event.EventType)
+	dlqMsg.Header.Set("Prive-Tenant-Id", event.TenantID)
+	dlqMsg.Header.Set("Prive-Agent-Id", event.AgentID)
+
+	if _, err := c.jetStream.PublishMsg(dlqMsg); err != nil {
+		log.Errorf("Worker %d: Failed to dead-letter %s event: %v", workerID, event.EventType, err)
+		msg.Nak()
+		c.errors.Add(1)
+		return
+	}
+	msg.Ack()
+	c.eventsDeadLettered.Add(1)
+	log.Debugf("Worker %d: Dead-lettered %s event from agent %s: %s", workerID, event.EventType, event.AgentID, reason)
+}
@@ -0,0 +1,455 @@
+// Spill Buffer
+// Local disk fallback for batches ClickHouse cannot accept, drained back once it recovers
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// spillDrainInterval is how often spilled batches are retried against ClickHouse
+const spillDrainInterval = 10 * time.Second
+
+// Suffixes of segments moved aside instead of reingested. Renaming one back to .jsonl retries it.
+const (
+	spillCorruptSuffix  = ".corrupt"  // Not readable as spilled records
+	spillRejectedSuffix = ".rejected" // Refused by ClickHouse, outright or spill.maxAttempts times
+)
+
+// errSpillCorrupt marks a segment whose records cannot be decoded
+var errSpillCorrupt = errors.New("spill segment is corrupt")
+
+// permanentInsertCodes are ClickHouse error codes for rows or schema that retrying the same
+// segment cannot fix
+var permanentInsertCodes = map[int32]bool{
+	6:   true, // CANNOT_PARSE_TEXT
+	16:  true, // NO_SUCH_COLUMN_IN_TABLE
+	27:  true, // CANNOT_PARSE_INPUT_ASSERTION_FAILED
+	41:  true, // CANNOT_PARSE_DATETIME
+	47:  true, // UNKNOWN_IDENTIFIER
+	53:  true, // TYPE_MISMATCH
+	70:  true, // CANNOT_CONVERT_TYPE
+	117: true, // INCORRECT_DATA
+}
+
+// Spill segment kinds. Events and rollups go to separate segments so each segment is
+// reingested all-or-nothing.
+const (
+	spillKindEvents  = "events"
+	spillKindRollups = "rollups"
+)
+
+// errSpillFull is returned when a batch would push the spill past its size bound
+var errSpillFull = errors.New("spill buffer is full")
+
+// Spill stores failed batches as append-only segment files: one fsynced, newline-delimited
+// JSON file per batch, named so that lexical order is write order
+type Spill struct {
+	dir         string
+	maxBytes    int64
+	maxAttempts int            // Failed reingests, while ClickHouse is reachable, before a segment is set aside
+	failures    map[string]int // Failed reingests per segment, guarded by mu
+	size        atomic.Int64
+	seq         atomic.Uint64
+	quarantined atomic.Uint64 // Segments moved aside
+	mu          sync.Mutex    // Serializes draining and spilling batches
+}
+
+// spilledEvent is an Event with the consumer-side fields Event does not serialize
+type spilledEvent struct {
+	Event
+	EventID           string `json:"event_id,omitempty"`
+	BatchID           string `json:"batch_id,omitempty"`
+	DstCountry        string `json:"dst_country,omitempty"`
+	DstASN            uint32 `json:"dst_asn,omitempty"`
+	DstASOrg          string `json:"dst_as_org,omitempty"`
+	DstHostname       string `json:"dst_hostname,omitempty"`
+	ProcessReputation string `json:"process_reputation,omitempty"`
+	SrcCountry        string `json:"src_country,omitempty"`
+	Redacted          bool   `json:"redacted,omitempty"`
+}
+
+// spilledRollup is one per-minute count of a rollup batch
+type spilledRollup struct {
+	TenantID    string `json:"tenant_id"`
+	AgentID     string `json:"agent_id"`
+	Hostname    string `json:"hostname"`
+	EventType   string `json:"event_type"`
+	ProcessName string `json:"process_name"`
+	Minute      int64  `json:"minute"`
+	Count       uint64 `json:"count"`
+}
+
+// NewSpillFromEnv creates the spill buffer configured by SPILL_DIR, SPILL_MAX_MB and
+// SPILL_MAX_ATTEMPTS. Spilling is disabled (nil) when SPILL_DIR is unset.
+func NewSpillFromEnv() (*Spill, error) {
+	dir := getEnv("SPILL_DIR", "")
+	if dir == "" {
+		return nil, nil
+	}
+	maxMB, err := strconv.ParseInt(getEnv("SPILL_MAX_MB", "1024"), 10, 64)
+	if err != nil || maxMB <= 0 {
+		return nil, fmt.Errorf("invalid SPILL_MAX_MB %q", getEnv("SPILL_MAX_MB", ""))
+	}
+	maxAttempts, err := strconv.Atoi(getEnv("SPILL_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts <= 0 {
+		return nil, fmt.Errorf("invalid SPILL_MAX_ATTEMPTS %q", getEnv("SPILL_MAX_ATTEMPTS", ""))
+	}
+	return NewSpill(dir, maxMB<<20, maxAttempts)
+}
+
+// NewSpill opens (or creates) a spill directory, picking up segments left by a previous run.
+// A segment that fails to reingest maxAttempts times while ClickHouse is reachable is set aside.
+func NewSpill(dir string, maxBytes int64, maxAttempts int) (*Spill, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	s := &Spill{dir: dir, maxBytes: maxBytes, maxAttempts: maxAttempts, failures: map[string]int{}}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, segment := range segments {
+		if info, err := os.Stat(segment); err == nil {
+			size += info.Size()
+		}
+	}
+	s.size.Store(size)
+
+	// Leftover temp files are batches that were never acknowledged; NATS redelivers them
+	if temps, err := filepath.Glob(filepath.Join(dir, "*.tmp")); err == nil {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}
+
+	if len(segments) > 0 {
+		log.Warnf("Spill buffer has %d pending segments (%d bytes) from a previous run", len(segments), size)
+	}
+	return s, nil
+}
+
+// Size returns the bytes currently spilled
+func (s *Spill) Size() int64 {
+	return s.size.Load()
+}
+
+// write stores records as a new segment and returns its path. The segment is durable when
+// write returns, so the source messages may be acknowledged.
+func (s *Spill) write(kind string, records []interface{}) (string, error) {
+	if len(records) == 0 {
+		return "", nil
+	}
+
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+
+	// Reserve the space first so concurrent workers cannot overshoot the bound together
+	if s.size.Add(int64(len(data))) > s.maxBytes {
+		s.size.Add(-int64(len(data)))
+		return "", errSpillFull
+	}
+
+	name := fmt.Sprintf("%020d-%06d.%s.jsonl", time.Now().UnixNano(), s.seq.Add(1)%1000000, kind)
+	path := filepath.Join(s.dir, name)
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		s.size.Add(-int64(len(data)))
+		os.Remove(path + ".tmp")
+		return "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		s.size.Add(-int64(len(data)))
+		os.Remove(path + ".tmp")
+		return "", err
+	}
+	return path, nil
+}
+
+// discard removes a segment that was written for a batch whose messages are not acknowledged
+// after all
+func (s *Spill) discard(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.size.Add(-info.Size())
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// segments lists spilled segments oldest first
+func (s *Spill) segments() ([]string, error) {
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// spillFailedBatch writes the parts of a batch that did not reach ClickHouse to the spill. It
+// is all-or-nothing: on error nothing of the batch is left spilled, since its messages are
+// NAK'd and redelivered.
+func (c *Consumer) spillFailedBatch(batch []Event, eventsDone bool, rollups rollupBatch) error {
+	// Hold off draining so a segment is not reingested before it might have to be taken back
+	c.spill.mu.Lock()
+	defer c.spill.mu.Unlock()
+
+	var eventsSegment string
+	if !eventsDone && len(batch) > 0 {
+		records := make([]interface{}, 0, len(batch))
+		for _, event := range batch {
+			records = append(records, spilledEvent{
+				Event:             event,
+				EventID:           event.EventID,
+				BatchID:           event.BatchID,
+				DstCountry:        event.DstCountry,
+				DstASN:            event.DstASN,
+				DstASOrg:          event.DstASOrg,
+				DstHostname:       event.DstHostname,
+				ProcessReputation: event.ProcessReputation,
+				SrcCountry:        event.SrcCountry,
+				Redacted:          event.Redacted,
+			})
+		}
+		segment, err := c.spill.write(spillKindEvents, records)
+		if err != nil {
+			return err
+		}
+		eventsSegment = segment
+	}
+
+	if len(rollups) > 0 {
+		records := make([]interface{}, 0, len(rollups))
+		for key, count := range rollups {
+			records = append(records, spilledRollup{
+				TenantID:    key.tenantID,
+				AgentID:     key.agentID,
+				Hostname:    key.hostname,
+				EventType:   key.eventType,
+				ProcessName: key.processName,
+				Minute:      key.minute,
+				Count:       count,
+			})
+		}
+		if _, err := c.spill.write(spillKindRollups, records); err != nil {
+			// Take the events segment back, or the events would be ingested again on redelivery
+			if eventsSegment != "" {
+				if discardErr := c.spill.discard(eventsSegment); discardErr != nil {
+					log.Errorf("Failed to remove spill segment %s of an unspilled batch: %v", eventsSegment, discardErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// drainSpill periodically reingests spilled segments, oldest first. It pauses at the first
+// failure while ClickHouse is unavailable so it is not hammered; segments ClickHouse refuses
+// are set aside so they do not block the rest.
+func (c *Consumer) drainSpill(ctx context.Context) {
+	ticker := time.NewTicker(spillDrainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.spill.mu.Lock()
+			c.drainSpillOnce(ctx)
+			c.spill.mu.Unlock()
+		}
+	}
+}
+
+func (c *Consumer) drainSpillOnce(ctx context.Context) {
+	segments, err := c.spill.segments()
+	if err != nil {
+		log.Errorf("Failed to list spill segments: %v", err)
+		return
+	}
+
+	drained := 0
+	for _, segment := range segments {
+		info, err := os.Stat(segment)
+		if err != nil {
+			continue
+		}
+
+		reingested, err := c.reingestSegment(segment)
+		if err != nil {
+			if !c.skipFailedSegment(ctx, segment, info.Size(), err) {
+				log.Warnf("Spill reingest paused, %d segments (%d bytes) pending: %v", len(segments)-drained, c.spill.Size(), err)
+				return
+			}
+			continue
+		}
+
+		delete(c.spill.failures, segment)
+		if err := os.Remove(segment); err != nil {
+			log.Errorf("Failed to remove reingested spill segment %s: %v", segment, err)
+			return
+		}
+		c.spill.size.Add(-info.Size())
+		c.eventsReingested.Add(uint64(reingested))
+		drained++
+	}
+
+	if drained > 0 {
+		log.Infof("Spill buffer drained: %d segments reingested", drained)
+	}
+}
+
+// skipFailedSegment handles a segment that failed to reingest and reports whether draining may
+// go on with the next one. Corrupt segments and segments ClickHouse refuses outright are set
+// aside at once. Other failures only count against the segment while ClickHouse is reachable;
+// otherwise the outage is to blame and draining pauses.
+func (c *Consumer) skipFailedSegment(ctx context.Context, path string, size int64, cause error) bool {
+	switch {
+	case errors.Is(cause, errSpillCorrupt):
+		return c.quarantine(path, size, spillCorruptSuffix, cause)
+	case permanentInsertError(cause):
+		return c.quarantine(path, size, spillRejectedSuffix, cause)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := c.clickhouse.Ping(pingCtx); err != nil {
+		return false
+	}
+
+	c.spill.failures[path]++
+	if attempts := c.spill.failures[path]; attempts < c.spill.maxAttempts {
+		log.Warnf("Spill segment %s failed to reingest (attempt %d of %d): %v", filepath.Base(path), attempts, c.spill.maxAttempts, cause)
+		return true
+	}
+	return c.quarantine(path, size, spillRejectedSuffix, cause)
+}
+
+// permanentInsertError reports whether ClickHouse refused rows for their data or the table's
+// schema, or the client could not convert them, so that retrying the same rows cannot succeed
+func permanentInsertError(err error) bool {
+	if errors.Is(err, errAppendRow) {
+		return true
+	}
+	var exception *clickhouse.Exception
+	return errors.As(err, &exception) && permanentInsertCodes[exception.Code]
+}
+
+// reingestSegment inserts one segment into ClickHouse and returns the number of events it held
+func (c *Consumer) reingestSegment(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if strings.HasSuffix(path, "."+spillKindRollups+".jsonl") {
+		rollups := rollupBatch{}
+		for scanner.Scan() {
+			var record spilledRollup
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return 0, fmt.Errorf("%w: %v", errSpillCorrupt, err)
+			}
+			rollups[rollupKey{
+				tenantID:    record.TenantID,
+				agentID:     record.AgentID,
+				hostname:    record.Hostname,
+				eventType:   record.EventType,
+				processName: record.ProcessName,
+				minute:      record.Minute,
+			}] += record.Count
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, c.insertRollups(rollups)
+	}
+
+	batch := make([]Event, 0, batchSize)
+	for scanner.Scan() {
+		var record spilledEvent
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return 0, fmt.Errorf("%w: %v", errSpillCorrupt, err)
+		}
+		event := record.Event
+		event.EventID = record.EventID
+		event.BatchID = record.BatchID
+		event.DstCountry = record.DstCountry
+		event.DstASN = record.DstASN
+		event.DstASOrg = record.DstASOrg
+		event.DstHostname = record.DstHostname
+		event.ProcessReputation = record.ProcessReputation
+		event.SrcCountry = record.SrcCountry
+		event.Redacted = record.Redacted
+		batch = append(batch, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if err := c.insertBatch(batch); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// quarantine moves a segment that cannot be reingested aside so it does not block the rest of
+// the spill, and reports whether it was moved
+func (c *Consumer) quarantine(path string, size int64, suffix string, cause error) bool {
+	log.Errorf("Spill segment %s cannot be reingested, moving it aside as %s: %v", path, suffix, cause)
+	if err := os.Rename(path, path+suffix); err != nil {
+		log.Errorf("Failed to move spill segment %s aside: %v", path, err)
+		return false
+	}
+	delete(c.spill.failures, path)
+	c.spill.size.Add(-size)
+	c.spill.quarantined.Add(1)
+	return true
+}
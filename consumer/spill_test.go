@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func testSpillBatch() ([]Event, rollupBatch) {
+	batch := []Event{{EventID: "evt-1", BatchID: "batch-1"}}
+	rollups := rollupBatch{}
+	for i := 0; i < 200; i++ {
+		rollups[rollupKey{tenantID: "tenant", agentID: "agent", eventType: "process", processName: fmt.Sprintf("proc-%d.exe", i), minute: int64(i)}] = 1
+	}
+	return batch, rollups
+}
+
+func TestSpillFailedBatch(t *testing.T) {
+	spill, err := NewSpill(t.TempDir(), 1<<20, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Consumer{spill: spill}
+
+	batch, rollups := testSpillBatch()
+	if err := c.spillFailedBatch(batch, false, rollups); err != nil {
+		t.Fatalf("spillFailedBatch: %v", err)
+	}
+	segments, err := spill.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Errorf("got %d segments, want events and rollups", len(segments))
+	}
+	if spill.Size() == 0 {
+		t.Error("spill size not accounted")
+	}
+}
+
+func TestSpillFailedBatchRollupFailure(t *testing.T) {
+	// Room for the events segment but not the rollups
+	spill, err := NewSpill(t.TempDir(), 4096, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Consumer{spill: spill}
+
+	batch, rollups := testSpillBatch()
+	if err := c.spillFailedBatch(batch, false, nil); err != nil {
+		t.Fatalf("events alone should fit: %v", err)
+	}
+	segments, _ := spill.segments()
+	for _, segment := range segments {
+		if err := spill.discard(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = c.spillFailedBatch(batch, false, rollups)
+	if !errors.Is(err, errSpillFull) {
+		t.Fatalf("spillFailedBatch error = %v, want errSpillFull", err)
+	}
+	// The messages are NAK'd, so no part of the batch may remain to be reingested
+	segments, err = spill.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("segments %v left behind by a batch that was not spilled", segments)
+	}
+	if size := spill.Size(); size != 0 {
+		t.Errorf("spill size = %d, want 0", size)
+	}
+}
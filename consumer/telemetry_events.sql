@@ -0,0 +1,112 @@
+-- telemetry_events DDL applied by the consumer on startup (see bootstrap.go)
+-- Mirrors the telemetry_events statements in the repository's schema.sql; keep the two in sync.
+-- Every statement must be idempotent, and statements are separated by a semicolon at the end
+-- of a line.
+
+CREATE TABLE IF NOT EXISTS telemetry_events
+(
+    -- Event identification and timing
+    event_id            UUID DEFAULT generateUUIDv4(),
+    agent_id            String,
+    tenant_id           String,
+    timestamp           DateTime64(3) DEFAULT now64(3), -- Millisecond precision
+    server_timestamp    DateTime64(3) DEFAULT now64(3),
+
+    -- Event classification
+    event_type          Enum8(
+        'unspecified' = 0,
+        'process_start' = 1,
+        'process_terminate' = 2,
+        'file_access' = 3,
+        'file_modify' = 4,
+        'file_delete' = 5,
+        'network_conn' = 6,
+        'registry_modify' = 7,
+        'dlp_violation' = 8,
+        'authentication' = 9
+    ),
+
+    -- MITRE ATT&CK framework mapping for threat hunting
+    mitre_tactic        LowCardinality(String),  -- e.g., "TA0002_Execution"
+    mitre_technique     LowCardinality(String),  -- e.g., "T1059_Command_and_Scripting"
+    severity            UInt8,                   -- 0=info, 1=low, 2=medium, 3=high, 4=critical
+
+    -- System context
+    hostname            LowCardinality(String),
+    os_type             LowCardinality(String),  -- windows, linux, macos
+
+    -- Event-specific payload (JSON for flexibility)
+    -- Schema varies by event_type:
+    --   PROCESS_START: {"pid":1234,"ppid":500,"cmdline":"...","user":"...","hash":"..."}
+    --   FILE_ACCESS: {"path":"...","operation":"read","hash":"...","size":1024}
+    --   NETWORK_CONN: {"src_ip":"...","dst_ip":"...","dst_port":443,"protocol":"tcp"}
+    --   DLP_VIOLATION: {"rule_id":"...","matched_pattern":"...","file_path":"..."}
+    --   AUTHENTICATION: {"user":"...","src_ip":"...","result":"success","logon_type":"..."}
+    payload             String,
+
+    -- Extracted fields for fast filtering (materialized from JSON payload)
+    -- These are computed on INSERT for better query performance
+    process_name        String MATERIALIZED JSONExtractString(payload, 'process_name'),
+    file_path           String MATERIALIZED JSONExtractString(payload, 'path'),
+    dst_ip              String MATERIALIZED JSONExtractString(payload, 'dst_ip'),
+    dst_port            UInt16 MATERIALIZED JSONExtractUInt(payload, 'dst_port'),
+    username            String MATERIALIZED JSONExtractString(payload, 'user'),
+
+    -- Enrichment columns (populated by the consumer at write time)
+    dst_country         LowCardinality(String) DEFAULT '',  -- ISO country code of dst_ip
+    dst_asn             UInt32 DEFAULT 0,                   -- Autonomous system number of dst_ip
+    dst_as_org          LowCardinality(String) DEFAULT '',  -- AS organisation name
+    dst_hostname        String DEFAULT '',                  -- Reverse DNS of dst_ip (if enabled)
+    process_reputation  LowCardinality(String) DEFAULT '',  -- unknown, known_good, malicious
+    src_country         LowCardinality(String) DEFAULT '',  -- ISO country code of src_ip (logins)
+
+    -- Integrity ledger batch the event was written in (see telemetry_ledger)
+    batch_id            UUID DEFAULT toUUID('00000000-0000-0000-0000-000000000000'),
+
+    -- Set when a redaction rule masked part of the payload before storage
+    redacted            Bool DEFAULT false,
+
+    -- Set when the ingestor clamped an out-of-bounds agent timestamp to server time;
+    -- agent_timestamp keeps the agent's clock reading and otherwise equals timestamp
+    agent_timestamp     DateTime64(3) DEFAULT timestamp,
+    timestamp_clamped   Bool DEFAULT false,
+
+    -- Indexing metadata
+    ingestion_date      Date MATERIALIZED toDate(server_timestamp)
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)  -- Monthly partitions the API retention job drops once expired and archived
+ORDER BY (tenant_id, timestamp, event_type, agent_id, event_id)
+SETTINGS
+    index_granularity = 8192,               -- Default granularity (good for most workloads)
+    min_bytes_for_wide_part = 10485760,     -- Use wide format for parts >10MB (better compression)
+    min_rows_for_wide_part = 100000;
+
+-- Columns added after the initial schema, for tables created by older releases
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_country LowCardinality(String) DEFAULT '' AFTER username;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_asn UInt32 DEFAULT 0 AFTER dst_country;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_as_org LowCardinality(String) DEFAULT '' AFTER dst_asn;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_hostname String DEFAULT '' AFTER dst_as_org;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS process_reputation LowCardinality(String) DEFAULT '' AFTER dst_hostname;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS src_country LowCardinality(String) DEFAULT '' AFTER process_reputation;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS batch_id UUID DEFAULT toUUID('00000000-0000-0000-0000-000000000000') AFTER src_country;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS redacted Bool DEFAULT false AFTER batch_id;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS agent_timestamp DateTime64(3) DEFAULT timestamp AFTER redacted;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS timestamp_clamped Bool DEFAULT false AFTER agent_timestamp;
+
+-- Data-skipping indexes. Only new parts are indexed; existing parts need MATERIALIZE INDEX <name>.
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_mitre_tactic mitre_tactic TYPE set(100) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_mitre_technique mitre_technique TYPE set(1000) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_hostname hostname TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_process process_name TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_process_reputation process_reputation TYPE set(10) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_batch_id batch_id TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_dst_ip dst_ip TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_src_ip JSONExtractString(payload, 'src_ip') TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_dst_hostname lower(dst_hostname) TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_domain lower(JSONExtractString(payload, 'domain')) TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_hash lower(JSONExtractString(payload, 'hash')) TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_severity severity TYPE minmax GRANULARITY 1;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_event_type event_type TYPE set(16) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_agent_id agent_id TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_file_path file_path TYPE bloom_filter(0.01) GRANULARITY 4;
@@ -0,0 +1,229 @@
+// Tenant Validation
+// Refuses events of unknown, revoked or expired licenses using the license_status table the API replicates
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// tenantRefreshInterval is how often license_status is reloaded; the API replicates it every minute
+	tenantRefreshInterval = 30 * time.Second
+
+	// tenantMissRefreshInterval rate-limits the early reloads an unknown tenant triggers, so a
+	// license created since the last reload is accepted within seconds
+	tenantMissRefreshInterval = 10 * time.Second
+)
+
+// What happens to refused events
+const (
+	TenantActionDrop       = "drop" // Acknowledge without storing
+	TenantActionDeadLetter = "dlq"  // Publish to the DLQ subject for inspection or replay
+)
+
+// Reasons an event's tenant is refused, also the Prive-DLQ-Reason of dead-lettered events
+const (
+	tenantUnknown = "unknown_tenant"
+	tenantRevoked = "license_revoked"
+	tenantExpired = "license_expired"
+)
+
+// tenantLicense is the replicated validity of one license
+type tenantLicense struct {
+	active    bool
+	expiresAt *time.Time
+}
+
+// tenantCounters counts a license's events by outcome
+type tenantCounters struct {
+	accepted atomic.Uint64
+	revoked  atomic.Uint64
+	expired  atomic.Uint64
+}
+
+// TenantValidator checks each event's tenant_id against license_status, which the API fills
+// from the licenses table. Until the table has been loaded with at least one license every
+// event is accepted, so a deployment that has not replicated yet keeps ingesting.
+type TenantValidator struct {
+	clickhouse driver.Conn
+	action     string
+
+	mu       sync.RWMutex
+	licenses map[string]tenantLicense
+	loaded   bool
+
+	countersMu sync.Mutex
+	counters   map[string]*tenantCounters // Known licenses only; unknown IDs are unbounded
+
+	unknown  atomic.Uint64
+	missed   chan struct{}
+	lastMiss atomic.Int64
+}
+
+// NewTenantValidatorFromEnv creates the validator configured by CONSUMER_TENANT_VALIDATION
+// (off, drop or dlq); nil when validation is off
+func NewTenantValidatorFromEnv(conn driver.Conn) (*TenantValidator, error) {
+	action := getEnv("CONSUMER_TENANT_VALIDATION", "off")
+	switch action {
+	case "off":
+		return nil, nil
+	case TenantActionDrop, TenantActionDeadLetter:
+	default:
+		return nil, fmt.Errorf("invalid CONSUMER_TENANT_VALIDATION %q; use off, %s or %s", action, TenantActionDrop, TenantActionDeadLetter)
+	}
+
+	return &TenantValidator{
+		clickhouse: conn,
+		action:     action,
+		licenses:   make(map[string]tenantLicense),
+		counters:   make(map[string]*tenantCounters),
+		missed:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Run loads license_status and reloads it every interval, or sooner after an unknown tenant,
+// until ctx is cancelled
+func (v *TenantValidator) Run(ctx context.Context, interval time.Duration) {
+	if err := v.refresh(ctx); err != nil {
+		log.Warnf("Failed to load license status: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-v.missed:
+		}
+		if err := v.refresh(ctx); err != nil {
+			log.Warnf("Failed to refresh license status: %v", err)
+		}
+	}
+}
+
+func (v *TenantValidator) refresh(ctx context.Context) error {
+	rows, err := v.clickhouse.Query(ctx, `
+		SELECT tenant_id, active, expires_at
+		FROM license_status FINAL
+		WHERE deleted = 0
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	licenses := make(map[string]tenantLicense)
+	for rows.Next() {
+		var tenantID string
+		var active uint8
+		var expiresAt *time.Time
+		if err := rows.Scan(&tenantID, &active, &expiresAt); err != nil {
+			return err
+		}
+		licenses[tenantID] = tenantLicense{active: active == 1, expiresAt: expiresAt}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	if !v.loaded && len(licenses) > 0 {
+		log.Infof("Tenant validation active for %d licenses; refused events are handled as %s", len(licenses), v.action)
+	}
+	v.licenses = licenses
+	v.loaded = len(licenses) > 0
+	v.mu.Unlock()
+	return nil
+}
+
+// Check returns why the event's tenant is refused, or "" when the event may be stored.
+// A nil validator accepts every event.
+func (v *TenantValidator) Check(event *Event, now time.Time) string {
+	if v == nil {
+		return ""
+	}
+
+	v.mu.RLock()
+	license, ok := v.licenses[event.TenantID]
+	loaded := v.loaded
+	v.mu.RUnlock()
+
+	if !loaded {
+		return ""
+	}
+	if !ok {
+		v.unknown.Add(1)
+		v.requestRefresh(now)
+		return tenantUnknown
+	}
+
+	counters := v.countersFor(event.TenantID)
+	switch {
+	case !license.active:
+		counters.revoked.Add(1)
+		return tenantRevoked
+	case license.expiresAt != nil && now.After(*license.expiresAt):
+		counters.expired.Add(1)
+		return tenantExpired
+	}
+	counters.accepted.Add(1)
+	return ""
+}
+
+// requestRefresh asks Run to reload early, at most once per tenantMissRefreshInterval
+func (v *TenantValidator) requestRefresh(now time.Time) {
+	last := v.lastMiss.Load()
+	if now.UnixNano()-last < int64(tenantMissRefreshInterval) || !v.lastMiss.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	select {
+	case v.missed <- struct{}{}:
+	default:
+	}
+}
+
+func (v *TenantValidator) countersFor(tenantID string) *tenantCounters {
+	v.countersMu.Lock()
+	defer v.countersMu.Unlock()
+	counters, ok := v.counters[tenantID]
+	if !ok {
+		counters = &tenantCounters{}
+		v.counters[tenantID] = counters
+	}
+	return counters
+}
+
+// tenantEventCounts is a license's event counts by outcome
+type tenantEventCounts struct {
+	tenantID                   string
+	accepted, revoked, expired uint64
+}
+
+// Counts returns the event counts of every license seen, ordered by tenant
+func (v *TenantValidator) Counts() []tenantEventCounts {
+	v.countersMu.Lock()
+	counts := make([]tenantEventCounts, 0, len(v.counters))
+	for tenantID, c := range v.counters {
+		counts = append(counts, tenantEventCounts{
+			tenantID: tenantID,
+			accepted: c.accepted.Load(),
+			revoked:  c.revoked.Load(),
+			expired:  c.expired.Load(),
+		})
+	}
+	v.countersMu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool { return counts[i].tenantID < counts[j].tenantID })
+	return counts
+}
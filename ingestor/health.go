@@ -0,0 +1,101 @@
+// Health and Reflection
+// Standard grpc.health.v1 service driven by NATS connectivity, plus optional server reflection
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	// healthService is the service name probes may ask for; "" reports the server as a whole
+	healthService = "telemetry.TelemetryService"
+
+	// healthCheckInterval is how often NATS connectivity is re-evaluated
+	healthCheckInterval = 2 * time.Second
+
+	// healthProbeTimeout bounds the --health self-check used by the container HEALTHCHECK
+	healthProbeTimeout = 3 * time.Second
+)
+
+// registerHealth adds the health service to the server, and server reflection when
+// GRPC_REFLECTION is enabled. Reflection exposes the full API surface, so keep it off in
+// production.
+func registerHealth(grpcServer *grpc.Server) *health.Server {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(healthService, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	if enabled, _ := strconv.ParseBool(getEnv("GRPC_REFLECTION", "false")); enabled {
+		reflection.Register(grpcServer)
+		log.Warn("gRPC server reflection enabled; disable GRPC_REFLECTION in production")
+	}
+	return healthServer
+}
+
+// watchHealth reports SERVING while the NATS connection is up, since events cannot be accepted
+// without it
+func (s *IngestorService) watchHealth(ctx context.Context, healthServer *health.Server) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	serving := false
+	for {
+		connected := s.natsConn.Status() == nats.CONNECTED
+		if connected != serving {
+			status := healthpb.HealthCheckResponse_NOT_SERVING
+			if connected {
+				status = healthpb.HealthCheckResponse_SERVING
+				log.Info("Health status: SERVING")
+			} else {
+				log.Warnf("Health status: NOT_SERVING (NATS %s)", s.natsConn.Status())
+			}
+			healthServer.SetServingStatus("", status)
+			healthServer.SetServingStatus(healthService, status)
+			serving = connected
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// healthProbe checks the local server's health service and fails unless it is serving. It
+// backs `ingestor --health` for container health checks.
+func healthProbe(grpcPort string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, fmt.Sprintf("localhost:%s", grpcPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status %s", resp.GetStatus())
+	}
+	return nil
+}
@@ -7,11 +7,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -48,6 +49,10 @@ type IngestorService struct {
 	// pb.UnimplementedTelemetryServiceServer
 	natsConn      *nats.Conn
 	jetStream     nats.JetStreamContext
+	router        *SubjectRouter    // Picks each event's subject; nil publishes everything on natsSubject
+	sequences     *SequenceTracker  // Per-agent gap and replay detection; nil when disabled
+	schemas       *SchemaNegotiator // Upgrades older agents' events to the current schema
+	timestamps    *TimestampPolicy  // Rejects or clamps events far from server time; nil when disabled
 	eventsHandled atomic.Uint64
 	bytesIngested atomic.Uint64
 	mu            sync.RWMutex
@@ -169,19 +174,29 @@ func (s *IngestorService) SubmitEvent(ctx context.Context, event interface{}) (i
 
 	// Publish to NATS
 	if err := s.publishEvent(event); err != nil {
+		var schemaErr *UnsupportedSchemaError
+		if errors.As(err, &schemaErr) {
+			return nil, status.Error(codes.FailedPrecondition, schemaErr.Error())
+		}
+		var timestampErr *EventTimestampError
+		if errors.As(err, &timestampErr) {
+			return nil, status.Error(codes.InvalidArgument, timestampErr.Error())
+		}
 		log.Errorf("Failed to publish event: %v", err)
 		return nil, status.Errorf(codes.Internal, "failed to publish event: %v", err)
 	}
 
-	// Return acknowledgment
+	// Return acknowledgment, advertising the schema version the ingestor publishes
 	ack := struct {
 		Success         bool
 		EventID         string
 		ServerTimestamp int64
+		SchemaVersion   uint32
 	}{
 		Success:         true,
 		EventID:         uuid.New().String(),
 		ServerTimestamp: time.Now().UnixMilli(),
+		SchemaVersion:   currentSchemaVersion,
 	}
 
 	return ack, nil
@@ -197,9 +212,35 @@ func (s *IngestorService) publishEvent(event interface{}) error {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
+	var header eventHeader
+	json.Unmarshal(eventJSON, &header)
+	now := time.Now()
+
+	// Older agents' events are upgraded so consumers only ever see the current schema
+	if s.schemas != nil {
+		eventJSON, err = s.schemas.Normalize(header, eventJSON, now)
+		if err != nil {
+			return err
+		}
+	}
+	s.sequences.Observe(header, now)
+
+	// Skewed clocks and long-buffered events would otherwise land in far-off ClickHouse partitions
+	eventJSON, err = s.timestamps.Apply(header, eventJSON, now)
+	if err != nil {
+		return err
+	}
+
+	// Numbered events are deduplicated on their sequence, so an agent retransmitting after a
+	// lost ack is not stored twice
+	msgID := uuid.New().String()
+	if header.Sequence > 0 && header.SequenceEpoch != "" {
+		msgID = fmt.Sprintf("%s:%s:%d", header.AgentID, header.SequenceEpoch, header.Sequence)
+	}
+
 	// Publish to JetStream with deduplication and persistence
-	pubAck, err := s.jetStream.Publish(natsSubject, eventJSON,
-		nats.MsgId(uuid.New().String()), // Deduplication
+	pubAck, err := s.jetStream.Publish(s.router.Subject(header), eventJSON,
+		nats.MsgId(msgID), // Deduplication
 	)
 	if err != nil {
 		return fmt.Errorf("failed to publish to NATS: %w", err)
@@ -253,13 +294,22 @@ func (s *IngestorService) printStats(ctx context.Context) {
 }
 
 func main() {
+	grpcPort := getEnv("INGESTOR_GRPC_PORT", defaultGRPCPort)
+
+	// Container health check: query the running server's health service and exit
+	if len(os.Args) > 1 && os.Args[1] == "--health" {
+		if err := healthProbe(grpcPort); err != nil {
+			fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Configure logging
-	log.SetFormatter(&log.JSONFormatter{})
-	log.SetLevel(log.InfoLevel)
+	configureLogging()
 	log.Info("Sentinel-Enterprise Ingestor starting...")
 
 	// Load configuration from environment
-	grpcPort := getEnv("INGESTOR_GRPC_PORT", defaultGRPCPort)
 	natsURL := getEnv("NATS_URL", nats.DefaultURL)
 
 	// Create ingestor service
@@ -269,10 +319,56 @@ func main() {
 	}
 	defer service.Close()
 
+	// Subject routing by tenant and event type
+	router, err := NewSubjectRouterFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure subject routing: %v", err)
+	}
+	service.router = router
+	log.Infof("Publishing events on %s", router.template)
+
+	// Per-agent sequence validation, disabled with INGESTOR_SEQUENCE_TRACKING=false
+	sequences, err := NewSequenceTrackerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure sequence tracking: %v", err)
+	}
+	service.sequences = sequences
+
+	// Event schema versions accepted from agents, from INGESTOR_SCHEMA_MIN_VERSION to the current one
+	schemas, err := NewSchemaNegotiatorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure schema negotiation: %v", err)
+	}
+	service.schemas = schemas
+	log.Infof("Accepting event schema versions %d-%d", schemas.minVersion, currentSchemaVersion)
+
+	// Event timestamp bounds, disabled by setting INGESTOR_MAX_EVENT_AGE_DAYS and
+	// INGESTOR_MAX_EVENT_FUTURE_MINUTES to 0
+	timestamps, err := NewTimestampPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure event timestamp bounds: %v", err)
+	}
+	service.timestamps = timestamps
+	if timestamps != nil {
+		action := "rejecting"
+		if timestamps.clamp {
+			action = "clamping"
+		}
+		log.Infof("Event timestamp bounds: %s events older than %v or more than %v ahead",
+			action, timestamps.maxAge, timestamps.maxFuture)
+	}
+
 	// Start performance monitoring
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go service.printStats(ctx)
+	if service.sequences != nil {
+		go service.sequences.Run(ctx)
+	}
+	go service.schemas.Run(ctx)
+	if metricsAddr := getEnv("METRICS_ADDR", ":9103"); metricsAddr != "" {
+		go service.serveMetrics(ctx, metricsAddr)
+	}
 
 	// Start gRPC server
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
@@ -288,6 +384,10 @@ func main() {
 	// TODO: Register service with protobuf
 	// pb.RegisterTelemetryServiceServer(grpcServer, service)
 
+	// Health service for load balancers and Kubernetes gRPC probes
+	healthServer := registerHealth(grpcServer)
+	go service.watchHealth(ctx, healthServer)
+
 	log.Infof("Ingestor gRPC server listening on :%s", grpcPort)
 
 	// Graceful shutdown handling
@@ -298,6 +398,7 @@ func main() {
 
 		log.Info("Shutdown signal received, stopping server...")
 		cancel()
+		healthServer.Shutdown() // Report NOT_SERVING so probes drain traffic first
 		grpcServer.GracefulStop()
 	}()
 
@@ -309,6 +410,26 @@ func main() {
 	log.Info("Ingestor service stopped")
 }
 
+// configureLogging applies LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT (json, text)
+func configureLogging() {
+	switch strings.ToLower(getEnv("LOG_FORMAT", "json")) {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.SetFormatter(&log.JSONFormatter{})
+		log.Warnf("Unknown LOG_FORMAT %q, using json", os.Getenv("LOG_FORMAT"))
+	}
+
+	level, err := log.ParseLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Warnf("Invalid LOG_LEVEL %q, using info", os.Getenv("LOG_LEVEL"))
+		level = log.InfoLevel
+	}
+	log.SetLevel(level)
+}
+
 // getEnv retrieves an environment variable with a fallback default
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
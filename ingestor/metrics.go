@@ -0,0 +1,97 @@
+// Metrics
+// Prometheus text-format endpoint for ingest throughput, schema versions and per-agent sequence tracking
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// serveMetrics serves /metrics on addr until ctx is cancelled
+func (s *IngestorService) serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Infof("Metrics listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("Metrics server failed: %v", err)
+	}
+}
+
+func (s *IngestorService) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	writeMetric := func(name, kind, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+
+	writeMetric("prive_ingestor_events_published_total", "counter", "Events published to JetStream.", s.eventsHandled.Load())
+	writeMetric("prive_ingestor_bytes_published_total", "counter", "Serialized event bytes published to JetStream.", s.bytesIngested.Load())
+
+	if s.schemas != nil {
+		writeMetric("prive_ingestor_schema_upgraded_events_total", "counter", "Events upgraded from an older schema version before publishing.", s.schemas.upgraded.Load())
+		writeMetric("prive_ingestor_schema_rejected_events_total", "counter", "Events rejected for an unsupported schema version.", s.schemas.rejected.Load())
+
+		name := "prive_ingestor_agents_by_schema_version"
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, "Agents by the event schema version they last sent.", name)
+		for _, v := range s.schemas.AgentsByVersion() {
+			fmt.Fprintf(&b, "%s{version=\"%d\"} %d\n", name, v.version, v.agents)
+		}
+	}
+
+	if s.timestamps != nil {
+		writeBoundMetric := func(name, help string, past, future uint64) {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+			fmt.Fprintf(&b, "%s{bound=\"%s\"} %d\n", name, timestampPast, past)
+			fmt.Fprintf(&b, "%s{bound=\"%s\"} %d\n", name, timestampFuture, future)
+		}
+		writeBoundMetric("prive_ingestor_timestamp_rejected_events_total", "Events rejected for a timestamp too far in the past or future.",
+			s.timestamps.rejectedPast.Load(), s.timestamps.rejectedFuture.Load())
+		writeBoundMetric("prive_ingestor_timestamp_clamped_events_total", "Events whose out-of-bounds timestamp was replaced with server time.",
+			s.timestamps.clampedPast.Load(), s.timestamps.clampedFuture.Load())
+	}
+
+	if s.sequences != nil {
+		stats := s.sequences.Stats()
+		writeAgentMetric := func(name, kind, help string, value func(agentSequenceStats) uint64) {
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+			for _, agent := range stats {
+				fmt.Fprintf(&b, "%s{agent_id=%q} %d\n", name, agent.agentID, value(agent))
+			}
+		}
+
+		writeAgentMetric("prive_ingestor_sequence_missing_events", "gauge", "Events skipped in the agent's sequence that have not arrived.",
+			func(a agentSequenceStats) uint64 { return a.missing })
+		writeAgentMetric("prive_ingestor_sequence_reordered_events_total", "counter", "Events that arrived after later ones.",
+			func(a agentSequenceStats) uint64 { return a.reordered })
+		writeAgentMetric("prive_ingestor_sequence_replayed_events_total", "counter", "Events whose sequence number was already seen.",
+			func(a agentSequenceStats) uint64 { return a.replayed })
+		writeAgentMetric("prive_ingestor_sequence_jumps_total", "counter", "Implausibly large forward jumps in the agent's sequence.",
+			func(a agentSequenceStats) uint64 { return a.jumps })
+		writeAgentMetric("prive_ingestor_sequence_restarts_total", "counter", "New sequence epochs, i.e. agent restarts.",
+			func(a agentSequenceStats) uint64 { return a.restarts })
+		writeAgentMetric("prive_ingestor_sequence_alerting", "gauge", "1 while the agent's recent gaps exceed the alert threshold.",
+			func(a agentSequenceStats) uint64 {
+				if a.alerting {
+					return 1
+				}
+				return 0
+			})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
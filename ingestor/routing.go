@@ -0,0 +1,100 @@
+// Subject Routing
+// Maps events to NATS subjects by tenant and event type so consumers can subscribe to slices
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Subject template placeholders
+const (
+	subjectTenantPlaceholder = "{tenant}"
+	subjectTypePlaceholder   = "{type}"
+
+	// dlqSubject is where the consumer dead-letters events; routed events must never land on it
+	dlqSubject = "edr.events.dlq"
+)
+
+// SubjectRouter picks the JetStream subject each event is published on. The template is set
+// with INGESTOR_SUBJECT_TEMPLATE, e.g. edr.events.{tenant}.{type}, and must stay under
+// edr.events. so the EDR_EVENTS stream captures it. The default, edr.events.raw, publishes
+// everything on one subject.
+//
+// Consumers subscribe to a slice with a filter subject. With edr.events.{tenant}.{type}:
+//
+//	edr.events.*.*                  every event (the ClickHouse writer)
+//	edr.events.*.dlp_violation      DLP violations from every tenant
+//	edr.events.<tenant_id>.*        one tenant
+type SubjectRouter struct {
+	template string
+	dynamic  bool // The template has placeholders, so events must be inspected
+}
+
+// eventHeader holds the event fields the ingestor itself looks at, for subject routing,
+// sequence tracking, schema negotiation and timestamp bounds
+type eventHeader struct {
+	AgentID       string `json:"agent_id"`
+	Timestamp     int64  `json:"timestamp"` // Unix milliseconds, from the agent's clock
+	TenantID      string `json:"tenant_id"`
+	EventType     string `json:"event_type"`
+	Sequence      uint64 `json:"sequence"`
+	SequenceEpoch string `json:"sequence_epoch"`
+	SchemaVersion uint32 `json:"schema_version"`
+}
+
+// NewSubjectRouterFromEnv creates the router configured by INGESTOR_SUBJECT_TEMPLATE
+func NewSubjectRouterFromEnv() (*SubjectRouter, error) {
+	template := getEnv("INGESTOR_SUBJECT_TEMPLATE", natsSubject)
+	if !strings.HasPrefix(template, "edr.events.") {
+		return nil, fmt.Errorf("INGESTOR_SUBJECT_TEMPLATE %q must start with edr.events.", template)
+	}
+
+	// Check the template yields valid subjects that cannot land on the DLQ subject
+	sample := strings.NewReplacer(subjectTenantPlaceholder, "tenant", subjectTypePlaceholder, "type").Replace(template)
+	for _, token := range strings.Split(sample, ".") {
+		if token == "" || strings.ContainsAny(token, "*> \t{}") {
+			return nil, fmt.Errorf("INGESTOR_SUBJECT_TEMPLATE %q is not a valid subject; only %s and %s may be substituted",
+				template, subjectTenantPlaceholder, subjectTypePlaceholder)
+		}
+	}
+	tokens := strings.Split(template, ".")
+	if template == dlqSubject || (len(tokens) == 3 && strings.Contains(tokens[2], "{")) {
+		return nil, fmt.Errorf("INGESTOR_SUBJECT_TEMPLATE %q could publish on the dead-letter subject %s; add a token", template, dlqSubject)
+	}
+
+	return &SubjectRouter{
+		template: template,
+		dynamic:  strings.Contains(template, subjectTenantPlaceholder) || strings.Contains(template, subjectTypePlaceholder),
+	}, nil
+}
+
+// Subject returns the subject for an event. Events missing a field are routed under
+// "unknown" rather than rejected, so a routing change never drops telemetry.
+func (r *SubjectRouter) Subject(header eventHeader) string {
+	if r == nil {
+		return natsSubject
+	}
+	if !r.dynamic {
+		return r.template
+	}
+
+	return strings.NewReplacer(
+		subjectTenantPlaceholder, subjectToken(header.TenantID),
+		subjectTypePlaceholder, subjectToken(strings.ToLower(header.EventType)),
+	).Replace(r.template)
+}
+
+// subjectToken makes a value safe to use as a single subject token
+func subjectToken(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '*' || r == '>' || r <= ' ' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,197 @@
+// Schema Versions
+// Upgrades events from older agents to the current event schema, or rejects versions the ingestor no longer accepts
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// currentSchemaVersion is the event schema published to JetStream. Events without a
+	// schema_version predate versioning and are version 1.
+	currentSchemaVersion = 2
+
+	// schemaAgentIdleTTL is how long an agent's reported version is kept without events
+	schemaAgentIdleTTL = 24 * time.Hour
+)
+
+// schemaUpgrades[v] rewrites an event from version v to v+1
+var schemaUpgrades = map[uint32]func(event map[string]interface{}){
+	1: upgradeSchemaV1,
+}
+
+// upgradeSchemaV1 strips the names version 1 agents appended to MITRE IDs
+// ("TA0002_Execution", "T1059_Command_and_Scripting"), leaving the bare IDs the
+// mitre_techniques table and coverage queries use
+func upgradeSchemaV1(event map[string]interface{}) {
+	for _, field := range []string{"mitre_tactic", "mitre_technique"} {
+		if value, ok := event[field].(string); ok {
+			if i := strings.IndexByte(value, '_'); i > 0 {
+				event[field] = value[:i]
+			}
+		}
+	}
+}
+
+// UnsupportedSchemaError rejects an event whose schema version the ingestor cannot accept
+type UnsupportedSchemaError struct {
+	Version, Min, Max uint32
+}
+
+func (e *UnsupportedSchemaError) Error() string {
+	if e.Version > e.Max {
+		return fmt.Sprintf("event schema version %d is newer than this ingestor supports (%d-%d); upgrade the ingestor", e.Version, e.Min, e.Max)
+	}
+	return fmt.Sprintf("event schema version %d is no longer supported (%d-%d); upgrade the agent", e.Version, e.Min, e.Max)
+}
+
+// SchemaNegotiator normalizes events to currentSchemaVersion. Agents stamp each event with
+// the schema_version they were built against, and every ack carries currentSchemaVersion so
+// agents learn what the ingestor speaks. Versions from INGESTOR_SCHEMA_MIN_VERSION up are
+// upgraded step by step before publishing, so a schema change rolls out as the fleet updates
+// rather than breaking every deployed agent at once; older and newer versions are rejected.
+// The version each agent last reported is kept for the metrics endpoint.
+type SchemaNegotiator struct {
+	minVersion uint32
+
+	mu     sync.Mutex
+	agents map[string]agentSchema
+
+	upgraded atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// agentSchema is the schema version an agent last reported
+type agentSchema struct {
+	version  uint32
+	lastSeen time.Time
+}
+
+// NewSchemaNegotiatorFromEnv creates the negotiator configured by INGESTOR_SCHEMA_MIN_VERSION
+func NewSchemaNegotiatorFromEnv() (*SchemaNegotiator, error) {
+	minVersion, err := strconv.ParseUint(getEnv("INGESTOR_SCHEMA_MIN_VERSION", "1"), 10, 32)
+	if err != nil || minVersion < 1 || minVersion > currentSchemaVersion {
+		return nil, fmt.Errorf("invalid INGESTOR_SCHEMA_MIN_VERSION %q; must be 1-%d",
+			getEnv("INGESTOR_SCHEMA_MIN_VERSION", ""), currentSchemaVersion)
+	}
+
+	return &SchemaNegotiator{
+		minVersion: uint32(minVersion),
+		agents:     make(map[string]agentSchema),
+	}, nil
+}
+
+// Normalize returns the event JSON at currentSchemaVersion. Current events are returned as is.
+func (n *SchemaNegotiator) Normalize(header eventHeader, eventJSON []byte, now time.Time) ([]byte, error) {
+	version := header.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	n.observe(header.AgentID, version, now)
+
+	if version < n.minVersion || version > currentSchemaVersion {
+		n.rejected.Add(1)
+		return nil, &UnsupportedSchemaError{Version: version, Min: n.minVersion, Max: currentSchemaVersion}
+	}
+	if version == currentSchemaVersion {
+		return eventJSON, nil
+	}
+
+	// Numbers are kept as json.Number so 64-bit sequences and timestamps survive the round trip
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(eventJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return nil, fmt.Errorf("failed to decode version %d event: %w", version, err)
+	}
+	for v := version; v < currentSchemaVersion; v++ {
+		schemaUpgrades[v](event)
+	}
+	event["schema_version"] = currentSchemaVersion
+
+	upgraded, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upgraded event: %w", err)
+	}
+	n.upgraded.Add(1)
+	return upgraded, nil
+}
+
+// observe records the version an agent reported, logging when it changes
+func (n *SchemaNegotiator) observe(agentID string, version uint32, now time.Time) {
+	if agentID == "" {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	previous, ok := n.agents[agentID]
+	n.agents[agentID] = agentSchema{version: version, lastSeen: now}
+	if !ok || previous.version == version {
+		return
+	}
+
+	entry := log.WithFields(log.Fields{"agent_id": agentID, "from": previous.version, "to": version})
+	if version < n.minVersion || version > currentSchemaVersion {
+		entry.Warn("Agent switched to an unsupported event schema version; its events are rejected")
+	} else {
+		entry.Info("Agent event schema version changed")
+	}
+}
+
+// Run forgets agents that have not sent an event for schemaAgentIdleTTL until ctx is cancelled
+func (n *SchemaNegotiator) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.mu.Lock()
+			for agentID, agent := range n.agents {
+				if now.Sub(agent.lastSeen) > schemaAgentIdleTTL {
+					delete(n.agents, agentID)
+				}
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// schemaVersionCount is the number of agents on one schema version
+type schemaVersionCount struct {
+	version uint32
+	agents  int
+}
+
+// AgentsByVersion counts tracked agents per schema version, oldest version first
+func (n *SchemaNegotiator) AgentsByVersion() []schemaVersionCount {
+	n.mu.Lock()
+	counts := make(map[uint32]int)
+	for _, agent := range n.agents {
+		counts[agent.version]++
+	}
+	n.mu.Unlock()
+
+	versions := make([]schemaVersionCount, 0, len(counts))
+	for version, agents := range counts {
+		versions = append(versions, schemaVersionCount{version: version, agents: agents})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].version < versions[j].version })
+	return versions
+}
@@ -0,0 +1,276 @@
+// Sequence Tracking
+// Detects dropped, reordered and replayed events from the per-agent sequence numbers
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxOpenGaps bounds the missing ranges remembered per agent; older ranges stay counted as
+	// missing but a late event inside them is reported as replayed
+	maxOpenGaps = 64
+
+	// sequenceIdleTTL is how long an agent's sequence state is kept without events
+	sequenceIdleTTL = 24 * time.Hour
+)
+
+// Sequence verdicts
+const (
+	sequenceInOrder   = "in_order"
+	sequenceGap       = "gap"       // Events before this one never arrived (yet)
+	sequenceReordered = "reordered" // Arrived late, filling an earlier gap
+	sequenceReplayed  = "replayed"  // Already seen, or too old to tell
+	sequenceJump      = "jump"      // Implausibly far ahead; not counted as missing
+	sequenceUntracked = "untracked" // The agent does not number its events
+)
+
+// seqRange is an inclusive range of missing sequence numbers
+type seqRange struct {
+	from, to uint64
+}
+
+// agentSequence is the sequence state of one agent
+type agentSequence struct {
+	epoch    string
+	last     uint64     // Highest sequence seen in the epoch
+	gaps     []seqRange // Open gaps, oldest first
+	lastSeen time.Time
+
+	missing   uint64 // Events currently missing, across epochs
+	reordered uint64
+	replayed  uint64
+	jumps     uint64
+	restarts  uint64
+
+	windowStart   time.Time
+	windowMissing uint64 // Events that went missing in the current alert window
+	alerting      bool
+}
+
+// SequenceTracker validates per-agent sequence numbers. Agents number events from 1 within an
+// epoch, a random ID chosen when the agent starts, so a new epoch is a restart rather than a
+// replay. Gaps, late arrivals, replays and impossible jumps are counted per agent for the
+// metrics endpoint, and an agent losing more than alertGaps events within alertWindow is
+// logged as a warning: it may have crashed, or something may be suppressing its telemetry.
+type SequenceTracker struct {
+	mu          sync.Mutex
+	agents      map[string]*agentSequence
+	maxJump     uint64 // Forward jumps larger than this are flagged instead of counted as gaps; 0 disables
+	alertGaps   uint64 // 0 disables gap alerting
+	alertWindow time.Duration
+}
+
+// NewSequenceTrackerFromEnv creates the tracker configured by INGESTOR_SEQUENCE_MAX_JUMP,
+// INGESTOR_SEQUENCE_ALERT_GAPS and INGESTOR_SEQUENCE_ALERT_WINDOW. It returns nil when
+// INGESTOR_SEQUENCE_TRACKING is false.
+func NewSequenceTrackerFromEnv() (*SequenceTracker, error) {
+	if getEnv("INGESTOR_SEQUENCE_TRACKING", "true") == "false" {
+		return nil, nil
+	}
+
+	maxJump, err := strconv.ParseUint(getEnv("INGESTOR_SEQUENCE_MAX_JUMP", "1000000"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INGESTOR_SEQUENCE_MAX_JUMP %q", getEnv("INGESTOR_SEQUENCE_MAX_JUMP", ""))
+	}
+	alertGaps, err := strconv.ParseUint(getEnv("INGESTOR_SEQUENCE_ALERT_GAPS", "100"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INGESTOR_SEQUENCE_ALERT_GAPS %q", getEnv("INGESTOR_SEQUENCE_ALERT_GAPS", ""))
+	}
+	alertWindow, err := time.ParseDuration(getEnv("INGESTOR_SEQUENCE_ALERT_WINDOW", "10m"))
+	if err != nil || alertWindow <= 0 {
+		return nil, fmt.Errorf("invalid INGESTOR_SEQUENCE_ALERT_WINDOW %q", getEnv("INGESTOR_SEQUENCE_ALERT_WINDOW", ""))
+	}
+
+	return &SequenceTracker{
+		agents:      make(map[string]*agentSequence),
+		maxJump:     maxJump,
+		alertGaps:   alertGaps,
+		alertWindow: alertWindow,
+	}, nil
+}
+
+// Observe records an event's sequence number and returns its verdict
+func (t *SequenceTracker) Observe(header eventHeader, now time.Time) string {
+	if t == nil || header.Sequence == 0 || header.SequenceEpoch == "" || header.AgentID == "" {
+		return sequenceUntracked
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.agents[header.AgentID]
+	if !ok {
+		// First event since the ingestor started: take it as the baseline rather than
+		// counting everything before it as missing
+		t.agents[header.AgentID] = &agentSequence{
+			epoch:       header.SequenceEpoch,
+			last:        header.Sequence,
+			lastSeen:    now,
+			windowStart: now,
+		}
+		return sequenceInOrder
+	}
+	state.lastSeen = now
+
+	if header.SequenceEpoch != state.epoch {
+		// The agent restarted. Gaps left in the old epoch stay missing; the new epoch counts
+		// from 1, so events lost at startup show up as a gap.
+		state.restarts++
+		state.epoch = header.SequenceEpoch
+		state.last = 0
+		state.gaps = nil
+		log.WithFields(log.Fields{"agent_id": header.AgentID, "epoch": header.SequenceEpoch}).Info("Agent started a new event sequence")
+	}
+
+	if now.Sub(state.windowStart) > t.alertWindow {
+		state.windowStart = now
+		state.windowMissing = 0
+	}
+
+	verdict := sequenceInOrder
+	switch seq := header.Sequence; {
+	case seq == state.last+1:
+		state.last = seq
+
+	case seq > state.last+1:
+		jump := seq - state.last - 1
+		if t.maxJump > 0 && jump > t.maxJump {
+			state.jumps++
+			log.WithFields(log.Fields{
+				"agent_id": header.AgentID,
+				"last":     state.last,
+				"sequence": seq,
+			}).Warn("Agent event sequence jumped implausibly far ahead; possible tampering or corrupted agent state")
+			state.last = seq
+			verdict = sequenceJump
+			break
+		}
+		state.gaps = append(state.gaps, seqRange{from: state.last + 1, to: seq - 1})
+		if len(state.gaps) > maxOpenGaps {
+			state.gaps = state.gaps[len(state.gaps)-maxOpenGaps:]
+		}
+		state.missing += jump
+		state.windowMissing += jump
+		state.last = seq
+		verdict = sequenceGap
+
+	default:
+		if state.fill(seq) {
+			state.missing--
+			state.reordered++
+			if state.windowMissing > 0 {
+				state.windowMissing--
+			}
+			verdict = sequenceReordered
+		} else {
+			state.replayed++
+			log.WithFields(log.Fields{"agent_id": header.AgentID, "sequence": seq}).Debug("Agent event replayed")
+			verdict = sequenceReplayed
+		}
+	}
+
+	t.checkAlert(header.AgentID, state)
+	return verdict
+}
+
+// fill removes seq from the open gaps, reporting whether it was missing
+func (s *agentSequence) fill(seq uint64) bool {
+	for i, gap := range s.gaps {
+		if seq < gap.from || seq > gap.to {
+			continue
+		}
+		switch {
+		case gap.from == gap.to:
+			s.gaps = append(s.gaps[:i], s.gaps[i+1:]...)
+		case seq == gap.from:
+			s.gaps[i].from++
+		case seq == gap.to:
+			s.gaps[i].to--
+		default:
+			s.gaps = append(s.gaps[:i+1], s.gaps[i:]...)
+			s.gaps[i].to = seq - 1
+			s.gaps[i+1].from = seq + 1
+		}
+		return true
+	}
+	return false
+}
+
+// checkAlert warns once when an agent loses too many events within the window, and again on recovery
+func (t *SequenceTracker) checkAlert(agentID string, state *agentSequence) {
+	if t.alertGaps == 0 {
+		return
+	}
+	over := state.windowMissing >= t.alertGaps
+	switch {
+	case over && !state.alerting:
+		state.alerting = true
+		log.WithFields(log.Fields{
+			"agent_id":       agentID,
+			"missing_events": state.windowMissing,
+			"window":         t.alertWindow.String(),
+			"open_gaps":      len(state.gaps),
+		}).Warn("Agent event stream has suspicious sequence gaps; the agent may have crashed or its telemetry is being dropped")
+	case !over && state.alerting:
+		state.alerting = false
+		log.WithField("agent_id", agentID).Info("Agent event sequence gaps back under threshold")
+	}
+}
+
+// Run forgets agents that have been idle for sequenceIdleTTL until ctx is cancelled
+func (t *SequenceTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			for agentID, state := range t.agents {
+				if now.Sub(state.lastSeen) > sequenceIdleTTL {
+					delete(t.agents, agentID)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// agentSequenceStats is a snapshot of one agent's counters for the metrics endpoint
+type agentSequenceStats struct {
+	agentID                                       string
+	missing, reordered, replayed, jumps, restarts uint64
+	alerting                                      bool
+}
+
+// Stats returns every tracked agent's counters, sorted by agent ID
+func (t *SequenceTracker) Stats() []agentSequenceStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]agentSequenceStats, 0, len(t.agents))
+	for agentID, state := range t.agents {
+		stats = append(stats, agentSequenceStats{
+			agentID:   agentID,
+			missing:   state.missing,
+			reordered: state.reordered,
+			replayed:  state.replayed,
+			jumps:     state.jumps,
+			restarts:  state.restarts,
+			alerting:  state.alerting,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].agentID < stats[j].agentID })
+	return stats
+}
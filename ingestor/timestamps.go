@@ -0,0 +1,143 @@
+// Event Timestamps
+// Rejects, or clamps to server time, events whose agent timestamp is too far in the past or future
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Timestamp bounds an event can break
+const (
+	timestampPast   = "past"
+	timestampFuture = "future"
+)
+
+// EventTimestampError rejects an event whose timestamp is outside the accepted bounds
+type EventTimestampError struct {
+	Bound     string // timestampPast or timestampFuture
+	Timestamp time.Time
+	Limit     time.Duration
+}
+
+func (e *EventTimestampError) Error() string {
+	if e.Bound == timestampFuture {
+		return fmt.Sprintf("event timestamp %s is more than %v in the future; check the agent's clock",
+			e.Timestamp.UTC().Format(time.RFC3339), e.Limit)
+	}
+	return fmt.Sprintf("event timestamp %s is older than the %v the ingestor accepts",
+		e.Timestamp.UTC().Format(time.RFC3339), e.Limit)
+}
+
+// TimestampPolicy bounds event timestamps to protect ClickHouse partitioning and time-range
+// queries from agents with skewed clocks and from long-buffered or replayed events. Events older
+// than INGESTOR_MAX_EVENT_AGE_DAYS or further ahead than INGESTOR_MAX_EVENT_FUTURE_MINUTES are
+// rejected, or with INGESTOR_CLAMP_EVENT_TIMESTAMPS stamped with the server time instead, the
+// agent's timestamp being kept in agent_timestamp. The consumer stores it in the column of the
+// same name and sets timestamp_clamped. Events without a timestamp are left alone.
+type TimestampPolicy struct {
+	maxAge    time.Duration // 0 disables the past bound
+	maxFuture time.Duration // 0 disables the future bound
+	clamp     bool
+
+	rejectedPast   atomic.Uint64
+	rejectedFuture atomic.Uint64
+	clampedPast    atomic.Uint64
+	clampedFuture  atomic.Uint64
+}
+
+// NewTimestampPolicyFromEnv creates the policy configured by INGESTOR_MAX_EVENT_AGE_DAYS,
+// INGESTOR_MAX_EVENT_FUTURE_MINUTES and INGESTOR_CLAMP_EVENT_TIMESTAMPS. It returns nil when
+// both bounds are 0.
+func NewTimestampPolicyFromEnv() (*TimestampPolicy, error) {
+	maxAgeDays, err := strconv.Atoi(getEnv("INGESTOR_MAX_EVENT_AGE_DAYS", "30"))
+	if err != nil || maxAgeDays < 0 {
+		return nil, fmt.Errorf("invalid INGESTOR_MAX_EVENT_AGE_DAYS %q; must be 0 or more days",
+			getEnv("INGESTOR_MAX_EVENT_AGE_DAYS", ""))
+	}
+	maxFutureMinutes, err := strconv.Atoi(getEnv("INGESTOR_MAX_EVENT_FUTURE_MINUTES", "15"))
+	if err != nil || maxFutureMinutes < 0 {
+		return nil, fmt.Errorf("invalid INGESTOR_MAX_EVENT_FUTURE_MINUTES %q; must be 0 or more minutes",
+			getEnv("INGESTOR_MAX_EVENT_FUTURE_MINUTES", ""))
+	}
+	clamp, err := strconv.ParseBool(getEnv("INGESTOR_CLAMP_EVENT_TIMESTAMPS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid INGESTOR_CLAMP_EVENT_TIMESTAMPS %q; must be true or false",
+			getEnv("INGESTOR_CLAMP_EVENT_TIMESTAMPS", ""))
+	}
+
+	if maxAgeDays == 0 && maxFutureMinutes == 0 {
+		return nil, nil
+	}
+	return &TimestampPolicy{
+		maxAge:    time.Duration(maxAgeDays) * 24 * time.Hour,
+		maxFuture: time.Duration(maxFutureMinutes) * time.Minute,
+		clamp:     clamp,
+	}, nil
+}
+
+// Apply returns the event JSON if its timestamp is within bounds, the event stamped with now if
+// it is not and clamping is enabled, and an *EventTimestampError otherwise. A nil policy accepts
+// every event.
+func (p *TimestampPolicy) Apply(header eventHeader, eventJSON []byte, now time.Time) ([]byte, error) {
+	if p == nil || header.Timestamp <= 0 {
+		return eventJSON, nil
+	}
+
+	timestamp := time.UnixMilli(header.Timestamp)
+	var bound string
+	var limit time.Duration
+	switch {
+	case p.maxAge > 0 && now.Sub(timestamp) > p.maxAge:
+		bound, limit = timestampPast, p.maxAge
+	case p.maxFuture > 0 && timestamp.Sub(now) > p.maxFuture:
+		bound, limit = timestampFuture, p.maxFuture
+	default:
+		return eventJSON, nil
+	}
+
+	entry := log.WithFields(log.Fields{
+		"agent_id":  header.AgentID,
+		"timestamp": timestamp.UTC().Format(time.RFC3339),
+		"bound":     bound,
+	})
+
+	if !p.clamp {
+		if bound == timestampFuture {
+			p.rejectedFuture.Add(1)
+		} else {
+			p.rejectedPast.Add(1)
+		}
+		entry.Debug("Event rejected for its timestamp")
+		return nil, &EventTimestampError{Bound: bound, Timestamp: timestamp, Limit: limit}
+	}
+
+	// Numbers are kept as json.Number so 64-bit sequences survive the round trip
+	var event map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(eventJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return nil, fmt.Errorf("failed to decode event for timestamp clamping: %w", err)
+	}
+	event["agent_timestamp"] = header.Timestamp
+	event["timestamp"] = now.UnixMilli()
+
+	clamped, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode clamped event: %w", err)
+	}
+	if bound == timestampFuture {
+		p.clampedFuture.Add(1)
+	} else {
+		p.clampedPast.Add(1)
+	}
+	entry.Debug("Event timestamp clamped to server time")
+	return clamped, nil
+}
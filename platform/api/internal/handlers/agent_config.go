@@ -0,0 +1,327 @@
+// Agent Config Schema
+// Validates agent configuration against the versioned schema before it is pushed to agents
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// validateAgentConfig checks config against the agent configuration schema. It returns the
+// config as normalized by the schema and the effective config with defaults applied, or every
+// invalid field keyed by its path under "config".
+func validateAgentConfig(config map[string]interface{}) (map[string]interface{}, *models.AgentConfig, map[string]string) {
+	// An unknown key is usually a typo that would otherwise silently fall back to the default
+	fields := map[string]string{}
+	unknownConfigKeys(reflect.TypeOf(models.AgentConfig{}), config, "config", fields)
+	if len(fields) > 0 {
+		return nil, nil, fields
+	}
+
+	var typed models.AgentConfig
+	raw, _ := json.Marshal(config)
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, nil, map[string]string{"config." + typeErr.Field: "must be " + jsonTypeName(typeErr.Type)}
+		}
+		return nil, nil, map[string]string{"config": err.Error()}
+	}
+
+	if typed.SchemaVersion != 0 && typed.SchemaVersion != models.AgentConfigSchemaVersion {
+		return nil, nil, map[string]string{
+			"config.schema_version": fmt.Sprintf("is not supported; this server validates version %d", models.AgentConfigSchemaVersion),
+		}
+	}
+	if err := binding.Validator.ValidateStruct(&typed); err != nil {
+		var validationErrs validator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return nil, nil, map[string]string{"config": err.Error()}
+		}
+		for _, fe := range validationErrs {
+			fields["config."+validationFieldPath(fe)] = validationMessage(fe)
+		}
+		return nil, nil, fields
+	}
+	for eventType := range typed.SamplingRates {
+		if !ingestEventTypes[eventType] {
+			fields["config.sampling_rates."+eventType] = "is not a known event type"
+		}
+	}
+	if len(fields) > 0 {
+		return nil, nil, fields
+	}
+
+	effective := effectiveAgentConfig(typed)
+	c := effective.Collectors
+	if !*c.Process && !*c.File && !*c.Network && !*c.Registry && !*c.Authentication {
+		return nil, nil, map[string]string{"config.collectors": "must leave at least one collector enabled"}
+	}
+
+	typed.SchemaVersion = models.AgentConfigSchemaVersion
+	normalized := map[string]interface{}{}
+	raw, _ = json.Marshal(typed)
+	json.Unmarshal(raw, &normalized)
+	return normalized, &effective, nil
+}
+
+// effectiveAgentConfig applies the settings of config over the defaults
+func effectiveAgentConfig(config models.AgentConfig) models.AgentConfig {
+	effective := models.DefaultAgentConfig()
+	if c := config.Collectors; c != nil {
+		for _, pair := range []struct{ set, dst **bool }{
+			{&c.Process, &effective.Collectors.Process},
+			{&c.File, &effective.Collectors.File},
+			{&c.Network, &effective.Collectors.Network},
+			{&c.Registry, &effective.Collectors.Registry},
+			{&c.Authentication, &effective.Collectors.Authentication},
+		} {
+			if *pair.set != nil {
+				*pair.dst = *pair.set
+			}
+		}
+	}
+	for eventType, rate := range config.SamplingRates {
+		effective.SamplingRates[eventType] = rate
+	}
+	if config.DLPEnabled != nil {
+		effective.DLPEnabled = config.DLPEnabled
+	}
+	if config.DLPPolicyIDs != nil {
+		effective.DLPPolicyIDs = config.DLPPolicyIDs
+	}
+	if config.HeartbeatIntervalSeconds != 0 {
+		effective.HeartbeatIntervalSeconds = config.HeartbeatIntervalSeconds
+	}
+	if config.BatchSize != 0 {
+		effective.BatchSize = config.BatchSize
+	}
+	if config.MaxBufferSize != 0 {
+		effective.MaxBufferSize = config.MaxBufferSize
+	}
+	if config.LogLevel != "" {
+		effective.LogLevel = config.LogLevel
+	}
+	return effective
+}
+
+// unknownConfigKeys records every key of config, at any struct nesting level, that is not a
+// JSON field of t
+func unknownConfigKeys(t reflect.Type, config map[string]interface{}, path string, fields map[string]string) {
+	known := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.SplitN(t.Field(i).Tag.Get("json"), ",", 2)[0]] = t.Field(i).Type
+	}
+	for key, value := range config {
+		fieldType, ok := known[key]
+		if !ok {
+			fields[path+"."+key] = "is not a setting of the agent configuration schema"
+			continue
+		}
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if nested, ok := value.(map[string]interface{}); ok && fieldType.Kind() == reflect.Struct {
+			unknownConfigKeys(fieldType, nested, path+"."+key, fields)
+		}
+	}
+}
+
+// checkAgentConfigPolicies reports pinned DLP policies that are not policies of the license
+func checkAgentConfigPolicies(db *sql.DB, licenseID string, policyIDs []string) (map[string]string, error) {
+	if len(policyIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := db.Query("SELECT id::text FROM dlp_policies WHERE license_id = $1 AND id::text = ANY($2)", licenseID, pq.Array(policyIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+
+	fields := map[string]string{}
+	for i, id := range policyIDs {
+		if !found[strings.ToLower(id)] {
+			fields[fmt.Sprintf("config.dlp_policy_ids[%d]", i)] = "must be a DLP policy of the agent's license"
+		}
+	}
+	return fields, rows.Err()
+}
+
+// GetAgentConfigSchema returns the current schema version and the default configuration
+func (h *AgentHandler) GetAgentConfigSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version": models.AgentConfigSchemaVersion,
+		"defaults":       models.DefaultAgentConfig(),
+	})
+}
+
+// PreviewAgentConfig validates a proposed config and returns how the agent's effective config
+// would change, without applying it
+func (h *AgentHandler) PreviewAgentConfig(c *gin.Context) {
+	agentID := c.Param("id")
+
+	var req models.UpdateAgentConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	normalized, proposed, fields := validateAgentConfig(req.Config)
+	if fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+
+	var configJSON []byte
+	var licenseID sql.NullString
+	var version int
+	err := h.db.QueryRow(
+		"SELECT config, license_id, version FROM agents WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)",
+		agentID, principalLicense(c),
+	).Scan(&configJSON, &licenseID, &version)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to query agent config: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview configuration"})
+		return
+	}
+
+	if fields, err := checkAgentConfigPolicies(h.db, licenseID.String, proposed.DLPPolicyIDs); err != nil {
+		log.Errorf("Failed to check DLP policies for agent config: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview configuration"})
+		return
+	} else if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+
+	preview := models.AgentConfigPreview{
+		AgentID:         agentID,
+		CurrentVersion:  version,
+		Config:          normalized,
+		EffectiveConfig: proposed,
+		Warnings:        []string{},
+	}
+
+	// Compare effective configs, so a default written out explicitly is not reported as a change
+	current := map[string]interface{}{}
+	if len(configJSON) > 0 {
+		json.Unmarshal(configJSON, &current)
+	}
+	var before map[string]interface{}
+	if _, effective, invalid := validateAgentConfig(current); invalid != nil {
+		preview.Warnings = append(preview.Warnings, "The current config does not conform to the schema; changes are shown against it as stored")
+		before = current
+	} else {
+		before = agentConfigMap(*effective)
+	}
+
+	preview.Changes = diffAgentConfig("", before, agentConfigMap(*proposed))
+	preview.Warnings = append(preview.Warnings, agentConfigWarnings(preview.Changes)...)
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// agentConfigMap converts a config to its JSON object form for diffing
+func agentConfigMap(config models.AgentConfig) map[string]interface{} {
+	m := map[string]interface{}{}
+	raw, _ := json.Marshal(config)
+	json.Unmarshal(raw, &m)
+	return m
+}
+
+// diffAgentConfig lists the differences between two config objects, recursing into nested
+// objects; lists and scalars are compared as whole values
+func diffAgentConfig(prefix string, before, after map[string]interface{}) []models.AgentConfigChange {
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	changes := []models.AgentConfigChange{}
+	for _, key := range sorted {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		old, hadOld := before[key]
+		new, hasNew := after[key]
+
+		switch {
+		case !hadOld:
+			changes = append(changes, models.AgentConfigChange{Path: path, Change: "added", New: new})
+		case !hasNew:
+			changes = append(changes, models.AgentConfigChange{Path: path, Change: "removed", Old: old})
+		default:
+			oldMap, oldIsMap := old.(map[string]interface{})
+			newMap, newIsMap := new.(map[string]interface{})
+			if oldIsMap && newIsMap {
+				changes = append(changes, diffAgentConfig(path, oldMap, newMap)...)
+			} else if !reflect.DeepEqual(old, new) {
+				changes = append(changes, models.AgentConfigChange{Path: path, Change: "changed", Old: old, New: new})
+			}
+		}
+	}
+	return changes
+}
+
+// agentConfigWarnings flags changes that reduce what the agent reports
+func agentConfigWarnings(changes []models.AgentConfigChange) []string {
+	warnings := []string{}
+	for _, change := range changes {
+		switch {
+		case strings.HasPrefix(change.Path, "collectors.") && change.New == false:
+			warnings = append(warnings, fmt.Sprintf("Disables the %s collector; the agent stops reporting those events", strings.TrimPrefix(change.Path, "collectors.")))
+		case change.Path == "dlp_enabled" && change.New == false:
+			warnings = append(warnings, "Disables DLP scanning on the agent")
+		case strings.HasPrefix(change.Path, "sampling_rates."):
+			rate, ok := change.New.(float64)
+			old, hadOld := change.Old.(float64)
+			if ok && rate < 1 && (!hadOld || rate < old) {
+				warnings = append(warnings, fmt.Sprintf("Keeps only %.0f%% of %s events", rate*100, strings.TrimPrefix(change.Path, "sampling_rates.")))
+			}
+		case change.Path == "heartbeat_interval_seconds":
+			if old, ok := change.Old.(float64); ok {
+				if interval, ok := change.New.(float64); ok && interval > old {
+					warnings = append(warnings, fmt.Sprintf("Raises the heartbeat interval from %.0fs to %.0fs; the agent is detected offline later", old, interval))
+				}
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,100 @@
+// Agent Isolation Handlers
+// Manual host isolation and release, queued as agent commands like the isolate_host alert action
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// IsolateAgent queues an isolate command for an agent, delivered in its next heartbeat response
+func (h *AgentHandler) IsolateAgent(c *gin.Context) {
+	var req models.IsolateAgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	fields := map[string]string{}
+	for i, ip := range req.AllowIPs {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				fields[fmt.Sprintf("allow_ips[%d]", i)] = "must be an IP address or CIDR range"
+			}
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+
+	params := map[string]interface{}{}
+	if len(req.AllowIPs) > 0 {
+		params["allow_ips"] = req.AllowIPs
+	}
+	if req.Reason != "" {
+		params["reason"] = req.Reason
+	}
+	h.queueResponseCommand(c, models.AgentCommandIsolate, params, req.RequestedBy)
+}
+
+// ReleaseAgent queues a release command, lifting an agent's isolation
+func (h *AgentHandler) ReleaseAgent(c *gin.Context) {
+	var req models.ReleaseAgentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+	}
+
+	params := map[string]interface{}{}
+	if req.Reason != "" {
+		params["reason"] = req.Reason
+	}
+	h.queueResponseCommand(c, models.AgentCommandRelease, params, req.RequestedBy)
+}
+
+// queueResponseCommand queues a manual response command for the agent in the path. Callers
+// confined to a license can only reach that license's agents.
+func (h *AgentHandler) queueResponseCommand(c *gin.Context, commandType string, params map[string]interface{}, requestedBy string) {
+	var agentID string
+	err := h.db.QueryRow(
+		"SELECT id FROM agents WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	).Scan(&agentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load agent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load agent"})
+		return
+	}
+
+	source := "api"
+	if requestedBy != "" {
+		source = "api:" + requestedBy
+	}
+	commandID, queued, err := queueAgentCommand(h.db, agentID, commandType, params, source)
+	if err != nil {
+		log.Errorf("Failed to queue %s command: %v", commandType, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue command"})
+		return
+	}
+
+	status := http.StatusAccepted
+	if !queued {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"agent_id": agentID, "command_id": commandID, "command_type": commandType, "already_queued": !queued})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+)
+
+func TestQueueResponseCommandConfinedToLicense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		license    string
+		wantStatus int
+		wantQueued bool
+	}{
+		{"same license", "lic-a", http.StatusAccepted, true},
+		{"other license", "lic-b", http.StatusNotFound, false},
+		{"platform principal", "", http.StatusAccepted, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// agent-1 belongs to lic-a
+			db, fake := newFakeDB(func(query string, args []driver.Value) (fakeResult, error) {
+				switch {
+				case strings.Contains(query, "FROM agents"):
+					if scope := args[1].(string); scope != "" && scope != "lic-a" {
+						return fakeResult{columns: []string{"id"}}, nil
+					}
+					return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{"agent-1"}}}, nil
+				case strings.Contains(query, "FROM agent_commands"):
+					return fakeResult{columns: []string{"id"}}, nil
+				default:
+					return fakeResult{affected: 1}, nil
+				}
+			})
+			h := NewAgentHandler(db, "")
+
+			router := gin.New()
+			router.POST("/agents/:id/release", func(c *gin.Context) {
+				if tt.license != "" {
+					c.Set(middleware.ContextUserLicense, tt.license)
+				}
+				h.ReleaseAgent(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/agents/agent-1/release", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if queued := fake.ran("INSERT INTO agent_commands"); queued != tt.wantQueued {
+				t.Errorf("command queued = %v, want %v", queued, tt.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Agent Update Distribution
+// Signed update packages with staged rollout, offered to agents in the heartbeat response
+
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const defaultAgentArch = "amd64"
+
+// SetUpdateSigningKey sets the Ed25519 key update package signatures are verified against.
+// Without it, publishing packages is disabled.
+func (h *AgentHandler) SetUpdateSigningKey(key ed25519.PublicKey) {
+	h.updateKey = key
+}
+
+// verifyPackageSignature checks a base64 Ed25519 signature over the package's SHA-256 digest
+func verifyPackageSignature(key ed25519.PublicKey, sha256Hex, signature string) bool {
+	digest, err := hex.DecodeString(sha256Hex)
+	if err != nil || len(digest) != sha256.Size {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, digest, sig)
+}
+
+// rolloutBucket deterministically places an agent in [0, 100) for a version, so an agent's
+// eligibility is stable across heartbeats and each release samples a different slice of the fleet
+func rolloutBucket(agentID, version string) int {
+	sum := sha256.Sum256([]byte(agentID + "/" + version))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+const agentUpdateColumns = `id, version, os_type, arch, download_url, sha256, signature, COALESCE(size_bytes, 0),
+	COALESCE(release_notes, ''), rollout_percentage, rollout_groups, is_active, COALESCE(published_by, ''),
+	created_at, updated_at`
+
+// scanAgentUpdatePackage scans a row selected with agentUpdateColumns
+func scanAgentUpdatePackage(row interface{ Scan(...interface{}) error }) (models.AgentUpdatePackage, error) {
+	var pkg models.AgentUpdatePackage
+	err := row.Scan(&pkg.ID, &pkg.Version, &pkg.OSType, &pkg.Arch, &pkg.DownloadURL, &pkg.SHA256, &pkg.Signature,
+		&pkg.SizeBytes, &pkg.ReleaseNotes, &pkg.RolloutPercentage, pq.Array(&pkg.RolloutGroups), &pkg.IsActive,
+		&pkg.PublishedBy, &pkg.CreatedAt, &pkg.UpdatedAt)
+	if pkg.RolloutGroups == nil {
+		pkg.RolloutGroups = []string{}
+	}
+	return pkg, err
+}
+
+// PublishAgentUpdate publishes a signed update package. The signature must verify against the
+// configured update signing key; rollout starts at rollout_percentage (0 = published but not offered).
+// Packages are offered to every license's agents, so publishing, rollout changes and withdrawal
+// are routed to platform principals only.
+func (h *AgentHandler) PublishAgentUpdate(c *gin.Context) {
+	if h.updateKey == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Update signing key not configured"})
+		return
+	}
+
+	var req models.PublishAgentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	req.SHA256 = strings.ToLower(req.SHA256)
+	if !verifyPackageSignature(h.updateKey, req.SHA256, req.Signature) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Package signature verification failed"})
+		return
+	}
+
+	if req.Arch == "" {
+		req.Arch = defaultAgentArch
+	}
+	groups, err := normalizeGroups(req.RolloutGroups)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pkg, err := scanAgentUpdatePackage(h.db.QueryRow(`
+		INSERT INTO agent_update_packages (version, os_type, arch, download_url, sha256, signature, size_bytes,
+		                                   release_notes, rollout_percentage, rollout_groups, published_by,
+		                                   created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+		RETURNING `+agentUpdateColumns,
+		req.Version, req.OSType, req.Arch, req.DownloadURL, req.SHA256, req.Signature, req.SizeBytes,
+		req.ReleaseNotes, req.RolloutPercentage, pq.Array(groups), req.PublishedBy,
+	))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Package already published for this version and platform"})
+			return
+		}
+		log.Errorf("Failed to publish agent update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish update"})
+		return
+	}
+
+	log.Infof("Published agent update %s for %s/%s (rollout %d%%)", pkg.Version, pkg.OSType, pkg.Arch, pkg.RolloutPercentage)
+
+	c.JSON(http.StatusCreated, pkg)
+}
+
+// ListAgentUpdates lists published packages, newest first, optionally filtered by ?os_type=
+func (h *AgentHandler) ListAgentUpdates(c *gin.Context) {
+	query := "SELECT " + agentUpdateColumns + " FROM agent_update_packages"
+	args := []interface{}{}
+	if osType := c.Query("os_type"); osType != "" {
+		query += " WHERE os_type = $1"
+		args = append(args, osType)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to query agent updates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+	defer rows.Close()
+
+	packages := make([]models.AgentUpdatePackage, 0)
+	for rows.Next() {
+		pkg, err := scanAgentUpdatePackage(rows)
+		if err != nil {
+			log.Warnf("Failed to scan agent update: %v", err)
+			continue
+		}
+		packages = append(packages, pkg)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"packages": packages,
+		"total":    len(packages),
+	})
+}
+
+// UpdateAgentRollout widens, narrows, pauses or retargets a package rollout
+func (h *AgentHandler) UpdateAgentRollout(c *gin.Context) {
+	packageID := c.Param("id")
+
+	var req models.UpdateAgentRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	var groups interface{}
+	if req.RolloutGroups != nil {
+		normalized, err := normalizeGroups(*req.RolloutGroups)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		groups = pq.Array(normalized)
+	}
+
+	pkg, err := scanAgentUpdatePackage(h.db.QueryRow(`
+		UPDATE agent_update_packages
+		SET rollout_percentage = COALESCE($1, rollout_percentage),
+		    rollout_groups = COALESCE($2, rollout_groups),
+		    is_active = COALESCE($3, is_active),
+		    updated_at = NOW()
+		WHERE id = $4
+		RETURNING `+agentUpdateColumns,
+		req.RolloutPercentage, groups, req.IsActive, packageID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+			return
+		}
+		log.Errorf("Failed to update agent rollout: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rollout"})
+		return
+	}
+
+	log.Infof("Updated rollout of agent update %s: %d%%, active=%v", pkg.Version, pkg.RolloutPercentage, pkg.IsActive)
+
+	c.JSON(http.StatusOK, pkg)
+}
+
+// DeleteAgentUpdate withdraws a package
+func (h *AgentHandler) DeleteAgentUpdate(c *gin.Context) {
+	packageID := c.Param("id")
+
+	result, err := h.db.Exec("DELETE FROM agent_update_packages WHERE id = $1", packageID)
+	if err != nil {
+		log.Errorf("Failed to delete agent update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete package"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Package not found"})
+		return
+	}
+
+	log.Infof("Deleted agent update package: %s", packageID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Package deleted successfully",
+	})
+}
+
+// pendingUpdate returns the newest package the agent is eligible for, or nil when it is current.
+// Nothing is offered without a signing key to verify packages against.
+func (h *AgentHandler) pendingUpdate(agentID, arch string) (*models.AgentUpdateInstruction, error) {
+	if h.updateKey == nil {
+		return nil, nil
+	}
+	if arch == "" {
+		arch = defaultAgentArch
+	}
+
+	var osType, currentVersion sql.NullString
+	var groups []string
+	err := h.db.QueryRow("SELECT os_type, agent_version, groups FROM agents WHERE agent_id = $1", agentID).
+		Scan(&osType, &currentVersion, pq.Array(&groups))
+	if err != nil || !osType.Valid {
+		return nil, err
+	}
+
+	rows, err := h.db.Query(`
+		SELECT `+agentUpdateColumns+`
+		FROM agent_update_packages
+		WHERE os_type = $1 AND arch = $2 AND is_active AND rollout_percentage > 0
+		  AND (cardinality(rollout_groups) = 0 OR rollout_groups && $3)
+	`, osType.String, arch, pq.Array(groups))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *models.AgentUpdatePackage
+	for rows.Next() {
+		pkg, err := scanAgentUpdatePackage(rows)
+		if err != nil {
+			return nil, err
+		}
+		if currentVersion.String != "" && compareVersions(pkg.Version, currentVersion.String) <= 0 {
+			continue
+		}
+		if rolloutBucket(agentID, pkg.Version) >= pkg.RolloutPercentage {
+			continue
+		}
+		if best == nil || compareVersions(pkg.Version, best.Version) > 0 {
+			p := pkg
+			best = &p
+		}
+	}
+	if best == nil {
+		return nil, rows.Err()
+	}
+
+	// Signatures are re-checked so a tampered row is never offered to the fleet
+	if !verifyPackageSignature(h.updateKey, best.SHA256, best.Signature) {
+		log.Errorf("Agent update %s for %s/%s failed signature verification; not offering it", best.Version, best.OSType, best.Arch)
+		return nil, nil
+	}
+
+	return &models.AgentUpdateInstruction{
+		Version:     best.Version,
+		DownloadURL: best.DownloadURL,
+		SHA256:      best.SHA256,
+		Signature:   best.Signature,
+		SizeBytes:   best.SizeBytes,
+	}, nil
+}
@@ -0,0 +1,147 @@
+// Agent Version Tracking
+// Fleet version distribution and detection of agents below the minimum supported version
+
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// compareVersions compares dotted agent versions ("1.4.2", "v2.0.0-rc1") numerically.
+// A pre-release sorts before its release. Returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	coreA, preA := splitVersion(a)
+	coreB, preB := splitVersion(b)
+
+	for i := 0; i < len(coreA) || i < len(coreB); i++ {
+		var x, y int
+		if i < len(coreA) {
+			x = coreA[i]
+		}
+		if i < len(coreB) {
+			y = coreB[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	case preA < preB:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// splitVersion returns the numeric components and pre-release suffix of a version
+func splitVersion(version string) ([]int, string) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i] // Build metadata does not affect ordering
+	}
+
+	pre := ""
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		version, pre = version[:i], version[i+1:]
+	}
+
+	parts := strings.Split(version, ".")
+	core := make([]int, 0, len(parts))
+	for _, part := range parts {
+		n, _ := strconv.Atoi(part)
+		core = append(core, n)
+	}
+	return core, pre
+}
+
+// isOutdated reports whether version is below the minimum; unknown versions count as outdated
+func isOutdated(version, minimum string) bool {
+	if minimum == "" {
+		return false
+	}
+	return version == "" || compareVersions(version, minimum) < 0
+}
+
+// GetAgentVersions returns the version histogram of a license's agents and those below the minimum version.
+// ?min_version= overrides the configured AGENT_MIN_VERSION.
+func (h *AgentHandler) GetAgentVersions(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	minimum := c.DefaultQuery("min_version", h.minVersion)
+
+	rows, err := h.db.Query(`
+		SELECT id, agent_id, hostname, COALESCE(agent_version, ''), status, last_seen
+		FROM agents
+		WHERE license_id = $1 AND deleted_at IS NULL
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to query agent versions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+	defer rows.Close()
+
+	report := models.AgentVersionReport{
+		LicenseID:      licenseID,
+		Versions:       []models.AgentVersionCount{},
+		MinimumVersion: minimum,
+		Outdated:       []models.OutdatedAgent{},
+	}
+	counts := map[string]int{}
+
+	for rows.Next() {
+		var agent models.OutdatedAgent
+		var status sql.NullString
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&agent.ID, &agent.AgentID, &agent.Hostname, &agent.AgentVersion, &status, &lastSeen); err != nil {
+			log.Warnf("Failed to scan agent version: %v", err)
+			continue
+		}
+		agent.Status = status.String
+		if lastSeen.Valid {
+			agent.LastSeen = &lastSeen.Time
+		}
+
+		report.TotalAgents++
+		counts[agent.AgentVersion]++
+		if isOutdated(agent.AgentVersion, minimum) {
+			report.Outdated = append(report.Outdated, agent)
+		}
+	}
+
+	for version, count := range counts {
+		report.Versions = append(report.Versions, models.AgentVersionCount{Version: version, Count: count})
+	}
+	sort.Slice(report.Versions, func(i, j int) bool {
+		return compareVersions(report.Versions[i].Version, report.Versions[j].Version) > 0
+	})
+	sort.Slice(report.Outdated, func(i, j int) bool {
+		return compareVersions(report.Outdated[i].AgentVersion, report.Outdated[j].AgentVersion) < 0
+	})
+	report.OutdatedCount = len(report.Outdated)
+
+	c.JSON(http.StatusOK, report)
+}
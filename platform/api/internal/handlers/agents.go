@@ -3,6 +3,7 @@
 package handlers
 
 import (
+	"crypto/ed25519"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
@@ -19,13 +21,16 @@ import (
 
 // AgentHandler handles agent management requests
 type AgentHandler struct {
-	db *sql.DB
+	db         *sql.DB
+	minVersion string            // Agents below this version are reported as outdated; empty disables the check
+	updateKey  ed25519.PublicKey // Verifies update package signatures; nil disables update distribution
 }
 
 // NewAgentHandler creates a new agent handler
-func NewAgentHandler(db *sql.DB) *AgentHandler {
+func NewAgentHandler(db *sql.DB, minVersion string) *AgentHandler {
 	return &AgentHandler{
-		db: db,
+		db:         db,
+		minVersion: minVersion,
 	}
 }
 
@@ -51,15 +56,15 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 	// Optional filters
 	status := c.Query("status")
 	osType := c.Query("os_type")
+	group := c.Query("group")
 
 	// Build query with filters
 	query := `
 		SELECT id, agent_id, license_id, hostname, ip_address, os_type, os_version,
 		       agent_version, status, last_seen, cpu_usage, memory_usage_mb,
-		       events_sent, config, created_at, updated_at
+		       events_sent, config, groups, created_at, updated_at, deleted_at, version
 		FROM agents
-		WHERE license_id = $1
-	`
+		WHERE license_id = $1` + liveOnly(c)
 	args := []interface{}{licenseID}
 	argCount := 2
 
@@ -75,6 +80,12 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 		argCount++
 	}
 
+	if group != "" {
+		query += fmt.Sprintf(" AND $%d = ANY(groups)", argCount)
+		args = append(args, group)
+		argCount++
+	}
+
 	query += " ORDER BY last_seen DESC NULLS LAST"
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount, argCount+1)
 	args = append(args, limit, offset)
@@ -92,7 +103,7 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 		var agent models.Agent
 		var configJSON []byte
 		var ipAddress, osType, osVersion, agentVersion sql.NullString
-		var lastSeen sql.NullTime
+		var lastSeen, deletedAt sql.NullTime
 		var cpuUsage sql.NullFloat64
 		var memoryUsage sql.NullInt64
 
@@ -111,8 +122,11 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 			&memoryUsage,
 			&agent.EventsSent,
 			&configJSON,
+			pq.Array(&agent.Groups),
 			&agent.CreatedAt,
 			&agent.UpdatedAt,
+			&deletedAt,
+			&agent.Version,
 		)
 
 		if err != nil {
@@ -143,6 +157,9 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 			memMB := int(memoryUsage.Int64)
 			agent.MemoryUsageMB = &memMB
 		}
+		if deletedAt.Valid {
+			agent.DeletedAt = &deletedAt.Time
+		}
 
 		// Parse JSON config
 		if len(configJSON) > 0 {
@@ -153,7 +170,7 @@ func (h *AgentHandler) ListAgents(c *gin.Context) {
 	}
 
 	// Get total count
-	countQuery := "SELECT COUNT(*) FROM agents WHERE license_id = $1"
+	countQuery := "SELECT COUNT(*) FROM agents WHERE license_id = $1" + liveOnly(c)
 	countArgs := []interface{}{licenseID}
 	if status != "" {
 		countQuery += " AND status = $2"
@@ -178,15 +195,14 @@ func (h *AgentHandler) GetAgent(c *gin.Context) {
 	query := `
 		SELECT id, agent_id, license_id, hostname, ip_address, os_type, os_version,
 		       agent_version, status, last_seen, cpu_usage, memory_usage_mb,
-		       events_sent, config, created_at, updated_at
+		       events_sent, config, groups, created_at, updated_at, deleted_at, version
 		FROM agents
-		WHERE id = $1
-	`
+		WHERE id = $1` + liveOnly(c)
 
 	var agent models.Agent
 	var configJSON []byte
 	var ipAddress, osType, osVersion, agentVersion sql.NullString
-	var lastSeen sql.NullTime
+	var lastSeen, deletedAt sql.NullTime
 	var cpuUsage sql.NullFloat64
 	var memoryUsage sql.NullInt64
 
@@ -205,8 +221,11 @@ func (h *AgentHandler) GetAgent(c *gin.Context) {
 		&memoryUsage,
 		&agent.EventsSent,
 		&configJSON,
+		pq.Array(&agent.Groups),
 		&agent.CreatedAt,
 		&agent.UpdatedAt,
+		&deletedAt,
+		&agent.Version,
 	)
 
 	if err != nil {
@@ -242,27 +261,37 @@ func (h *AgentHandler) GetAgent(c *gin.Context) {
 		memMB := int(memoryUsage.Int64)
 		agent.MemoryUsageMB = &memMB
 	}
+	if deletedAt.Valid {
+		agent.DeletedAt = &deletedAt.Time
+	}
 
 	// Parse JSON config
 	if len(configJSON) > 0 {
 		json.Unmarshal(configJSON, &agent.Config)
 	}
 
+	setVersionETag(c, agent.Version)
 	c.JSON(http.StatusOK, agent)
 }
 
-// UpdateAgent updates agent metadata
+// UpdateAgent updates agent metadata. Callers confined to a license can only update that
+// license's agents.
 func (h *AgentHandler) UpdateAgent(c *gin.Context) {
 	agentID := c.Param("id")
 
 	var req models.UpdateAgentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	// Build dynamic update query
-	query := `UPDATE agents SET updated_at = NOW()`
+	query := `UPDATE agents SET updated_at = NOW(), version = version + 1`
 	args := []interface{}{}
 	argCount := 1
 
@@ -301,66 +330,74 @@ func (h *AgentHandler) UpdateAgent(c *gin.Context) {
 		args = append(args, *req.MemoryUsageMB)
 		argCount++
 	}
+	if req.Groups != nil {
+		groups, err := normalizeGroups(req.Groups)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query += fmt.Sprintf(", groups = $%d", argCount)
+		args = append(args, pq.Array(groups))
+		argCount++
+	}
 
-	query += fmt.Sprintf(" WHERE id = $%d", argCount)
-	args = append(args, agentID)
+	query += fmt.Sprintf(" WHERE id = $%d AND deleted_at IS NULL AND ($%d = 0 OR version = $%d) AND ($%d = '' OR license_id::text = $%d) RETURNING version",
+		argCount, argCount+1, argCount+1, argCount+2, argCount+2)
+	args = append(args, agentID, expectedVersion, principalLicense(c))
 
-	result, err := h.db.Exec(query, args...)
+	var version int
+	err := h.db.QueryRow(query, args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "agents", "Agent", agentID)
+		return
+	}
 	if err != nil {
 		log.Errorf("Failed to update agent: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update agent"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
-		return
-	}
-
 	log.Infof("Updated agent: %s", agentID)
 
+	setVersionETag(c, version)
 	c.JSON(http.StatusOK, gin.H{
 		"id":         agentID,
+		"version":    version,
 		"updated_at": time.Now(),
 		"message":    "Agent updated successfully",
 	})
 }
 
-// DeleteAgent removes an agent (decommission)
+// DeleteAgent soft-deletes an agent (decommission). It is hidden from lists and heartbeats
+// are rejected until it is restored or re-registers.
 func (h *AgentHandler) DeleteAgent(c *gin.Context) {
-	agentID := c.Param("id")
-
-	query := `DELETE FROM agents WHERE id = $1`
-
-	result, err := h.db.Exec(query, agentID)
-	if err != nil {
-		log.Errorf("Failed to delete agent: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete agent"})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
-		return
-	}
+	softDeleteRow(c, h.db, "agents", "Agent")
+}
 
-	log.Infof("Deleted agent: %s", agentID)
+// RestoreAgent brings back a soft-deleted agent
+func (h *AgentHandler) RestoreAgent(c *gin.Context) {
+	restoreRow(c, h.db, "agents", "Agent")
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Agent deleted successfully",
-	})
+// PurgeAgent permanently removes a soft-deleted agent
+func (h *AgentHandler) PurgeAgent(c *gin.Context) {
+	purgeRow(c, h.db, "agents", "Agent")
 }
 
-// GetAgentConfig retrieves agent configuration
+// GetAgentConfig retrieves agent configuration along with the DLP policies effective for the agent's groups
 func (h *AgentHandler) GetAgentConfig(c *gin.Context) {
 	agentID := c.Param("id")
 
-	query := `SELECT config FROM agents WHERE id = $1`
+	query := `
+		SELECT config, license_id, groups, version FROM agents
+		WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)
+	`
 
 	var configJSON []byte
-	err := h.db.QueryRow(query, agentID).Scan(&configJSON)
+	var licenseID sql.NullString
+	var groups []string
+	var version int
+	err := h.db.QueryRow(query, agentID, principalLicense(c)).Scan(&configJSON, &licenseID, pq.Array(&groups), &version)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -383,24 +420,91 @@ func (h *AgentHandler) GetAgentConfig(c *gin.Context) {
 		config = make(map[string]interface{})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"agent_id": agentID,
-		"config":   config,
-	})
+	if groups == nil {
+		groups = []string{}
+	}
+
+	policies := []models.DLPPolicy{}
+	if licenseID.Valid {
+		policies, err = effectiveDLPPolicies(h.db, licenseID.String, groups)
+		if err != nil {
+			log.Errorf("Failed to resolve DLP policies for agent %s: %v", agentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve DLP policies"})
+			return
+		}
+	}
+
+	response := gin.H{
+		"agent_id":     agentID,
+		"config":       config,
+		"groups":       groups,
+		"dlp_policies": policies,
+		"version":      version,
+	}
+	// Configs stored before schema validation may not conform; report why instead of failing
+	if _, effective, fields := validateAgentConfig(config); fields != nil {
+		response["config_errors"] = fields
+	} else {
+		response["effective_config"] = effective
+	}
+
+	setVersionETag(c, version)
+	c.JSON(http.StatusOK, response)
 }
 
-// UpdateAgentConfig updates agent configuration
+// UpdateAgentConfig updates agent configuration. The If-Match version guards against two
+// operators overwriting each other's changes, which could silently disable monitoring. Callers
+// confined to a license can only configure that license's agents.
 func (h *AgentHandler) UpdateAgentConfig(c *gin.Context) {
 	agentID := c.Param("id")
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateAgentConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	// A bad config is pushed to the agent as-is, so reject anything the schema does not allow
+	normalized, effective, fields := validateAgentConfig(req.Config)
+	if fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
 		return
 	}
 
+	var licenseID sql.NullString
+	err := h.db.QueryRow(
+		"SELECT license_id FROM agents WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)",
+		agentID, principalLicense(c),
+	).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to query agent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
+		return
+	}
+	if len(effective.DLPPolicyIDs) > 0 {
+		fields, err := checkAgentConfigPolicies(h.db, licenseID.String, effective.DLPPolicyIDs)
+		if err != nil {
+			log.Errorf("Failed to check DLP policies for agent config: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
+			return
+		}
+		if len(fields) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+			return
+		}
+	}
+
 	// Serialize config to JSON
-	configJSON, err := json.Marshal(req.Config)
+	configJSON, err := json.Marshal(normalized)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid configuration format"})
 		return
@@ -408,28 +512,32 @@ func (h *AgentHandler) UpdateAgentConfig(c *gin.Context) {
 
 	query := `
 		UPDATE agents
-		SET config = $1, updated_at = NOW()
-		WHERE id = $2
+		SET config = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3) AND ($4 = '' OR license_id::text = $4)
+		RETURNING version
 	`
 
-	result, err := h.db.Exec(query, string(configJSON), agentID)
+	var version int
+	err = h.db.QueryRow(query, string(configJSON), agentID, expectedVersion, principalLicense(c)).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "agents", "Agent", agentID)
+		return
+	}
 	if err != nil {
 		log.Errorf("Failed to update agent config: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
-		return
-	}
-
 	log.Infof("Updated agent config: %s", agentID)
 
+	setVersionETag(c, version)
 	c.JSON(http.StatusOK, gin.H{
-		"agent_id": agentID,
-		"message":  "Configuration updated successfully",
+		"agent_id":         agentID,
+		"version":          version,
+		"config":           normalized,
+		"effective_config": effective,
+		"message":          "Configuration updated successfully",
 	})
 }
 
@@ -438,9 +546,9 @@ func (h *AgentHandler) GetAgentHealth(c *gin.Context) {
 	agentID := c.Param("id")
 
 	query := `
-		SELECT agent_id, status, last_seen, cpu_usage, memory_usage_mb, created_at
+		SELECT agent_id, status, last_seen, cpu_usage, memory_usage_mb, COALESCE(agent_version, ''), created_at
 		FROM agents
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var health models.AgentHealthResponse
@@ -455,6 +563,7 @@ func (h *AgentHandler) GetAgentHealth(c *gin.Context) {
 		&lastSeen,
 		&cpuUsage,
 		&memoryUsage,
+		&health.AgentVersion,
 		&createdAt,
 	)
 
@@ -509,6 +618,12 @@ func (h *AgentHandler) GetAgentHealth(c *gin.Context) {
 		health.Issues = append(health.Issues, fmt.Sprintf("High memory usage: %d MB", memoryUsage.Int64))
 	}
 
+	// Check agent version
+	if isOutdated(health.AgentVersion, h.minVersion) {
+		health.Outdated = true
+		health.Issues = append(health.Issues, fmt.Sprintf("Agent version %q is below minimum %s", health.AgentVersion, h.minVersion))
+	}
+
 	// Check status
 	if health.Status == "error" || health.Status == "offline" {
 		health.IsHealthy = false
@@ -521,7 +636,7 @@ func (h *AgentHandler) GetAgentHealth(c *gin.Context) {
 func (h *AgentHandler) RegisterAgent(c *gin.Context) {
 	var req models.AgentRegistrationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -540,15 +655,16 @@ func (h *AgentHandler) RegisterAgent(c *gin.Context) {
 
 	// Check if agent already exists
 	var existingID string
-	err = h.db.QueryRow("SELECT id FROM agents WHERE agent_id = $1", req.AgentID).Scan(&existingID)
+	var wasDeleted bool
+	err = h.db.QueryRow("SELECT id, deleted_at IS NOT NULL FROM agents WHERE agent_id = $1", req.AgentID).Scan(&existingID, &wasDeleted)
 
 	if err == nil {
-		// Agent exists, update it
+		// Agent exists, update it. A soft-deleted agent presenting a valid license key is restored.
 		query := `
 			UPDATE agents
 			SET license_id = $1, hostname = $2, ip_address = $3, os_type = $4,
 			    os_version = $5, agent_version = $6, status = 'active',
-			    last_seen = NOW(), updated_at = NOW()
+			    last_seen = NOW(), updated_at = NOW(), deleted_at = NULL
 			WHERE agent_id = $7
 			RETURNING id
 		`
@@ -564,7 +680,11 @@ func (h *AgentHandler) RegisterAgent(c *gin.Context) {
 			return
 		}
 
-		log.Infof("Agent re-registered: %s", req.AgentID)
+		if wasDeleted {
+			log.Infof("Deleted agent re-registered and restored: %s", req.AgentID)
+		} else {
+			log.Infof("Agent re-registered: %s", req.AgentID)
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"id":       existingID,
 			"agent_id": req.AgentID,
@@ -608,20 +728,21 @@ func (h *AgentHandler) RegisterAgent(c *gin.Context) {
 func (h *AgentHandler) ProcessHeartbeat(c *gin.Context) {
 	var req models.AgentHeartbeat
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	query := `
 		UPDATE agents
 		SET last_seen = NOW(), cpu_usage = $1, memory_usage_mb = $2,
-		    events_sent = $3, status = $4, updated_at = NOW()
-		WHERE agent_id = $5
+		    events_sent = $3, status = $4,
+		    agent_version = COALESCE(NULLIF($5, ''), agent_version), updated_at = NOW()
+		WHERE agent_id = $6 AND deleted_at IS NULL
 	`
 
 	result, err := h.db.Exec(query,
 		req.CPUUsage, req.MemoryUsageMB, req.EventsSent,
-		req.Status, req.AgentID,
+		req.Status, req.AgentVersion, req.AgentID,
 	)
 
 	if err != nil {
@@ -636,8 +757,25 @@ func (h *AgentHandler) ProcessHeartbeat(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"agent_id": req.AgentID,
 		"message":  "Heartbeat processed",
-	})
+	}
+
+	// Offer a newer package when the agent falls inside a staged rollout
+	update, err := h.pendingUpdate(req.AgentID, req.Arch)
+	if err != nil {
+		log.Warnf("Failed to resolve agent update for %s: %v", req.AgentID, err)
+	} else if update != nil {
+		response["update"] = update
+	}
+
+	commands, err := h.takePendingCommands(req.AgentID)
+	if err != nil {
+		log.Warnf("Failed to load pending commands for %s: %v", req.AgentID, err)
+	} else if len(commands) > 0 {
+		response["commands"] = commands
+	}
+
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+)
+
+// agentLicenseDB fakes an agents table holding agent-1 for lic-a. Every agents statement must
+// carry the caller's license as its last argument.
+func agentLicenseDB(t *testing.T) *sql.DB {
+	db, _ := newFakeDB(func(query string, args []driver.Value) (fakeResult, error) {
+		if !strings.Contains(query, "agents") {
+			return fakeResult{affected: 1}, nil
+		}
+		if !strings.Contains(query, "license_id::text") {
+			t.Errorf("agents statement is not confined to a license: %s", query)
+		}
+		var columns []string
+		var row []driver.Value
+		switch {
+		case strings.Contains(query, "RETURNING version"), strings.Contains(query, "SELECT version"):
+			columns, row = []string{"version"}, []driver.Value{int64(2)}
+		default:
+			columns, row = []string{"license_id"}, []driver.Value{"lic-a"}
+		}
+		if scope := args[len(args)-1].(string); scope != "" && scope != "lic-a" {
+			return fakeResult{columns: columns}, nil
+		}
+		return fakeResult{columns: columns, rows: [][]driver.Value{row}}, nil
+	})
+	return db
+}
+
+func TestAgentUpdatesConfinedToLicense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		license    string
+		wantStatus int
+	}{
+		{"same license", "lic-a", http.StatusOK},
+		{"other license", "lic-b", http.StatusNotFound},
+		{"platform principal", "", http.StatusOK},
+	}
+
+	routes := []struct {
+		path    string
+		body    string
+		handler func(h *AgentHandler) gin.HandlerFunc
+	}{
+		{"/agents/:id", `{"hostname":"host-1"}`, func(h *AgentHandler) gin.HandlerFunc { return h.UpdateAgent }},
+		{"/agents/:id/config", `{"config":{}}`, func(h *AgentHandler) gin.HandlerFunc { return h.UpdateAgentConfig }},
+	}
+
+	for _, route := range routes {
+		for _, tt := range tests {
+			t.Run(route.path+" "+tt.name, func(t *testing.T) {
+				h := NewAgentHandler(agentLicenseDB(t), "")
+
+				router := gin.New()
+				router.PUT(route.path, func(c *gin.Context) {
+					if tt.license != "" {
+						c.Set(middleware.ContextAPIKeyLicense, tt.license)
+					}
+					route.handler(h)(c)
+				})
+
+				path := strings.Replace(route.path, ":id", "agent-1", 1)
+				req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(route.body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("If-Match", `"1"`)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+				}
+			})
+		}
+	}
+}
@@ -18,12 +18,14 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
+	"github.com/sentinel-enterprise/platform/secrets"
 )
 
 // AIHandler handles AI-powered threat analysis
 type AIHandler struct {
-	db         *sql.DB
-	clickhouse driver.Conn
+	db             *sql.DB
+	clickhouse     driver.Conn
+	secretProvider secrets.SecretProvider // Holds provider API keys; nil keeps them in Postgres
 }
 
 // NewAIHandler creates a new AI handler
@@ -34,16 +36,29 @@ func NewAIHandler(db *sql.DB, ch driver.Conn) *AIHandler {
 	}
 }
 
+// SetSecretProvider stores provider API keys in the secrets backend instead of ai_configs
+func (h *AIHandler) SetSecretProvider(provider secrets.SecretProvider) {
+	h.secretProvider = provider
+}
+
 // GenerateThreatSummary generates AI-powered analysis of security events
 func (h *AIHandler) GenerateThreatSummary(c *gin.Context) {
 	var req models.GenerateSummaryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if err := validateSamplingOptions(req.Sampling); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Get AI configuration for tenant
 	config, err := h.getAIConfig(req.TenantID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("Failed to load AI config: %v", err)
+	}
 	if err != nil || !config.Enabled {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "AI analysis not configured or disabled for this tenant"})
 		return
@@ -55,48 +70,123 @@ func (h *AIHandler) GenerateThreatSummary(c *gin.Context) {
 		provider = config.Provider
 	}
 
+	switch provider {
+	case models.ProviderOpenAI, models.ProviderAnthropic:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported AI provider"})
+		return
+	}
+
+	// Tenant prompt template and guardrails
+	template, err := h.loadPromptTemplate(req.TenantID, req.AnalysisType)
+	if err != nil {
+		log.Errorf("Failed to load prompt template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prompt template"})
+		return
+	}
+	guardrails, err := h.loadAIGuardrails(req.TenantID)
+	if err != nil {
+		log.Errorf("Failed to load AI guardrails: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load AI guardrails"})
+		return
+	}
+	if req.CustomPrompt != "" && !guardrails.AllowCustomPrompt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom prompts are disabled for this tenant"})
+		return
+	}
+	if guardrails.MaxEvents > 0 {
+		sampling := models.AISamplingOptions{}
+		if req.Sampling != nil {
+			sampling = *req.Sampling
+		}
+		if sampling.MaxEvents == 0 || sampling.MaxEvents > guardrails.MaxEvents {
+			sampling.MaxEvents = guardrails.MaxEvents
+		}
+		req.Sampling = &sampling
+	}
+
+	// The analysis ID ties the log lines of each stage together
+	analysisID := uuid.New().String()
+	trace := log.WithFields(log.Fields{
+		"analysis_id":   analysisID,
+		"tenant_id":     req.TenantID,
+		"provider":      provider,
+		"analysis_type": req.AnalysisType,
+	})
 	startTime := time.Now()
 
 	// Fetch events based on request
 	events, err := h.fetchEventsForAnalysis(req)
 	if err != nil {
-		log.Errorf("Failed to fetch events: %v", err)
+		trace.Errorf("Failed to fetch events: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch events"})
 		return
 	}
+	fetchTime := time.Since(startTime)
 
 	if len(events) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No events found for analysis"})
 		return
 	}
 
+	// Reduce events to fit the model's context window
+	input := reduceAnalysisEvents(events, req.Sampling)
+	input.redactFields = make(map[string]bool, len(guardrails.RedactFields))
+	for _, field := range guardrails.RedactFields {
+		input.redactFields[field] = true
+	}
+
+	// Render the prompt, then mask what the guardrails forbid sending
+	prompt := h.buildAnalysisPrompt(req, input, template)
+	redactions := input.redactions
+	redactPrompt(&prompt, guardrails, redactions)
+	if pattern := forbiddenPromptPattern(prompt, guardrails); pattern != "" {
+		recordAIGuardrails(redactions, true)
+		trace.WithField("pattern", pattern).Warn("AI analysis blocked by a forbidden content filter")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Analysis blocked: the prompt matches a forbidden content filter", "pattern": pattern})
+		return
+	}
+	recordAIGuardrails(redactions, false)
+
 	// Generate analysis using selected LLM provider
 	var summary *models.ThreatSummary
-	switch provider {
-	case models.ProviderOpenAI:
-		summary, err = h.analyzeWithOpenAI(config, req, events)
-	case models.ProviderAnthropic:
-		summary, err = h.analyzeWithAnthropic(config, req, events)
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported AI provider"})
-		return
+	call := startAICall(analysisID, req.TenantID, provider, req.AnalysisType)
+	if provider == models.ProviderOpenAI {
+		summary, err = h.analyzeWithOpenAI(config, req, prompt, input, call)
+	} else {
+		summary, err = h.analyzeWithAnthropic(config, req, prompt, input, call)
 	}
+	call.finish(err)
 
 	if err != nil {
-		log.Errorf("AI analysis failed: %v", err)
+		trace.Errorf("AI analysis failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Analysis failed: %v", err)})
 		return
 	}
 
 	// Complete summary metadata
-	summary.ID = uuid.New().String()
+	summary.ID = analysisID
 	summary.TenantID = req.TenantID
 	summary.AnalysisType = req.AnalysisType
 	summary.Provider = provider
 	summary.EventCount = len(events)
+	summary.EventSampling = &input.stats
+	summary.PromptTemplate = prompt.template
+	if len(redactions) > 0 {
+		summary.Redactions = redactions
+	}
 	summary.GeneratedAt = time.Now()
 	summary.ProcessingTimeMs = time.Since(startTime).Milliseconds()
 
+	trace.WithFields(log.Fields{
+		"model":           call.model,
+		"events_fetched":  input.stats.EventsFetched,
+		"events_included": input.stats.EventsIncluded,
+		"fetch_ms":        fetchTime.Milliseconds(),
+		"total_ms":        summary.ProcessingTimeMs,
+		"tokens":          summary.TokensUsed,
+	}).Info("AI analysis completed")
+
 	// Store analysis in history
 	h.storeAnalysisHistory(summary)
 
@@ -132,10 +222,24 @@ func (h *AIHandler) GetAIConfig(c *gin.Context) {
 func (h *AIHandler) UpdateAIConfig(c *gin.Context) {
 	var req models.UpdateAIConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
+	// Provider keys go to the secrets backend; ai_configs keeps only references
+	for name, key := range map[string]*string{"openai_key": req.OpenAIKey, "anthropic_key": req.AnthropicKey} {
+		if key == nil {
+			continue
+		}
+		stored, err := secrets.Store(c.Request.Context(), h.secretProvider, aiSecretName(req.LicenseID, name), *key)
+		if err != nil {
+			log.Errorf("Failed to store AI provider key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store provider key"})
+			return
+		}
+		*key = stored
+	}
+
 	// Check if config exists
 	var exists bool
 	h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM ai_configs WHERE license_id = $1)", req.LicenseID).Scan(&exists)
@@ -304,13 +408,17 @@ func (h *AIHandler) getAIConfig(licenseID string) (*models.AIConfig, error) {
 	}
 
 	if openAIKey.Valid {
-		config.OpenAIKey = openAIKey.String
+		if config.OpenAIKey, err = secrets.Resolve(context.Background(), h.secretProvider, openAIKey.String); err != nil {
+			return nil, fmt.Errorf("failed to resolve OpenAI key: %w", err)
+		}
 	}
 	if openAIModel.Valid {
 		config.OpenAIModel = openAIModel.String
 	}
 	if anthropicKey.Valid {
-		config.AnthropicKey = anthropicKey.String
+		if config.AnthropicKey, err = secrets.Resolve(context.Background(), h.secretProvider, anthropicKey.String); err != nil {
+			return nil, fmt.Errorf("failed to resolve Anthropic key: %w", err)
+		}
 	}
 	if anthropicModel.Valid {
 		config.AnthropicModel = anthropicModel.String
@@ -325,6 +433,32 @@ func (h *AIHandler) fetchEventsForAnalysis(req models.GenerateSummaryRequest) ([
 	}
 
 	ctx := context.Background()
+
+	// Explicit event IDs share the batch lookup used by the telemetry API
+	if len(req.EventIDs) > 0 {
+		eventIDs := req.EventIDs
+		if len(eventIDs) > aiFetchLimit {
+			eventIDs = eventIDs[:aiFetchLimit]
+		}
+
+		events, err := fetchEventsByIDs(ctx, h.clickhouse, req.TenantID, eventIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.TimeRange == nil {
+			return events, nil
+		}
+
+		filtered := make([]models.TelemetryEvent, 0, len(events))
+		for _, event := range events {
+			if !event.Timestamp.Before(req.TimeRange.Start) && !event.Timestamp.After(req.TimeRange.End) {
+				filtered = append(filtered, event)
+			}
+		}
+		return filtered, nil
+	}
+
 	query := `
 		SELECT event_id, agent_id, timestamp, event_type, mitre_tactic, mitre_technique,
 		       severity, hostname, os_type, payload, process_name, file_path, dst_ip, username
@@ -333,23 +467,13 @@ func (h *AIHandler) fetchEventsForAnalysis(req models.GenerateSummaryRequest) ([
 	`
 	args := []interface{}{req.TenantID}
 
-	// Filter by event IDs if provided
-	if len(req.EventIDs) > 0 {
-		placeholders := make([]string, len(req.EventIDs))
-		for i := range req.EventIDs {
-			placeholders[i] = "?"
-			args = append(args, req.EventIDs[i])
-		}
-		query += " AND event_id IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
 	// Filter by time range if provided
 	if req.TimeRange != nil {
 		query += " AND timestamp >= ? AND timestamp <= ?"
 		args = append(args, req.TimeRange.Start, req.TimeRange.End)
 	}
 
-	query += " ORDER BY timestamp ASC LIMIT 1000"
+	query += fmt.Sprintf(" ORDER BY timestamp ASC LIMIT %d", aiFetchLimit)
 
 	rows, err := h.clickhouse.Query(ctx, query, args...)
 	if err != nil {
@@ -390,9 +514,9 @@ func (h *AIHandler) fetchEventsForAnalysis(req models.GenerateSummaryRequest) ([
 	return events, nil
 }
 
-func (h *AIHandler) analyzeWithOpenAI(config *models.AIConfig, req models.GenerateSummaryRequest, events []models.TelemetryEvent) (*models.ThreatSummary, error) {
-	// Build prompt
-	prompt := h.buildAnalysisPrompt(req.AnalysisType, events, req.CustomPrompt)
+// analyzeWithOpenAI runs the analysis on OpenAI, reporting the model, status and token usage on call
+func (h *AIHandler) analyzeWithOpenAI(config *models.AIConfig, req models.GenerateSummaryRequest, prompt analysisPrompt, input *analysisInput, call *aiCall) (*models.ThreatSummary, error) {
+	call.model = config.OpenAIModel
 
 	// Call OpenAI API
 	requestBody := map[string]interface{}{
@@ -400,11 +524,11 @@ func (h *AIHandler) analyzeWithOpenAI(config *models.AIConfig, req models.Genera
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a cybersecurity expert analyzing security events for an EDR/DLP platform. Provide detailed, actionable analysis with specific recommendations.",
+				"content": prompt.system,
 			},
 			{
 				"role":    "user",
-				"content": prompt,
+				"content": prompt.user,
 			},
 		},
 		"max_tokens":  config.MaxTokens,
@@ -427,6 +551,7 @@ func (h *AIHandler) analyzeWithOpenAI(config *models.AIConfig, req models.Genera
 		return nil, err
 	}
 	defer resp.Body.Close()
+	call.statusCode = resp.StatusCode
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("openai API returned status %d", resp.StatusCode)
@@ -439,28 +564,32 @@ func (h *AIHandler) analyzeWithOpenAI(config *models.AIConfig, req models.Genera
 			} `json:"message"`
 		} `json:"choices"`
 		Usage struct {
-			TotalTokens int `json:"total_tokens"`
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
 		} `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, err
 	}
+	call.inputTokens = apiResp.Usage.PromptTokens
+	call.outputTokens = apiResp.Usage.CompletionTokens
 
 	if len(apiResp.Choices) == 0 {
 		return nil, fmt.Errorf("no response from OpenAI")
 	}
 
 	// Parse the AI response
-	summary := h.parseAIResponse(apiResp.Choices[0].Message.Content, req.AnalysisType, events)
+	summary := h.parseAIResponse(apiResp.Choices[0].Message.Content, req.AnalysisType, input.events)
 	summary.TokensUsed = apiResp.Usage.TotalTokens
 
 	return summary, nil
 }
 
-func (h *AIHandler) analyzeWithAnthropic(config *models.AIConfig, req models.GenerateSummaryRequest, events []models.TelemetryEvent) (*models.ThreatSummary, error) {
-	// Build prompt
-	prompt := h.buildAnalysisPrompt(req.AnalysisType, events, req.CustomPrompt)
+// analyzeWithAnthropic runs the analysis on Anthropic, reporting the model, status and token usage on call
+func (h *AIHandler) analyzeWithAnthropic(config *models.AIConfig, req models.GenerateSummaryRequest, prompt analysisPrompt, input *analysisInput, call *aiCall) (*models.ThreatSummary, error) {
+	call.model = config.AnthropicModel
 
 	// Call Anthropic API
 	requestBody := map[string]interface{}{
@@ -469,10 +598,10 @@ func (h *AIHandler) analyzeWithAnthropic(config *models.AIConfig, req models.Gen
 		"messages": []map[string]string{
 			{
 				"role":    "user",
-				"content": prompt,
+				"content": prompt.user,
 			},
 		},
-		"system":      "You are a cybersecurity expert analyzing security events for an EDR/DLP platform. Provide detailed, actionable analysis with specific recommendations.",
+		"system":      prompt.system,
 		"temperature": config.Temperature,
 	}
 
@@ -493,6 +622,7 @@ func (h *AIHandler) analyzeWithAnthropic(config *models.AIConfig, req models.Gen
 		return nil, err
 	}
 	defer resp.Body.Close()
+	call.statusCode = resp.StatusCode
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("anthropic API returned status %d", resp.StatusCode)
@@ -511,83 +641,20 @@ func (h *AIHandler) analyzeWithAnthropic(config *models.AIConfig, req models.Gen
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, err
 	}
+	call.inputTokens = apiResp.Usage.InputTokens
+	call.outputTokens = apiResp.Usage.OutputTokens
 
 	if len(apiResp.Content) == 0 {
 		return nil, fmt.Errorf("no response from Anthropic")
 	}
 
 	// Parse the AI response
-	summary := h.parseAIResponse(apiResp.Content[0].Text, req.AnalysisType, events)
+	summary := h.parseAIResponse(apiResp.Content[0].Text, req.AnalysisType, input.events)
 	summary.TokensUsed = apiResp.Usage.InputTokens + apiResp.Usage.OutputTokens
 
 	return summary, nil
 }
 
-func (h *AIHandler) buildAnalysisPrompt(analysisType models.AnalysisType, events []models.TelemetryEvent, customPrompt string) string {
-	// Build event context
-	eventsJSON, _ := json.MarshalIndent(events, "", "  ")
-
-	basePrompt := fmt.Sprintf(`Analyze the following %d security events and provide a comprehensive %s.
-
-Events:
-%s
-
-`, len(events), analysisType, string(eventsJSON))
-
-	switch analysisType {
-	case models.AnalysisIncidentSummary:
-		basePrompt += `Provide:
-1. Executive Summary (2-3 sentences)
-2. Key Findings (bullet points)
-3. MITRE ATT&CK techniques observed
-4. Risk assessment
-5. Immediate recommendations`
-
-	case models.AnalysisAttackChain:
-		basePrompt += `Reconstruct the attack chain:
-1. Initial access method
-2. Execution timeline
-3. Persistence mechanisms
-4. Privilege escalation attempts
-5. Lateral movement
-6. Data collection/exfiltration
-7. Overall narrative`
-
-	case models.AnalysisRemediationPlan:
-		basePrompt += `Create detailed remediation plan:
-1. Immediate containment steps
-2. Investigation actions
-3. Eradication procedures
-4. Recovery steps
-5. Long-term prevention measures
-Include specific commands where applicable.`
-
-	case models.AnalysisRootCause:
-		basePrompt += `Determine root cause:
-1. Initial vulnerability or weakness
-2. How the attacker exploited it
-3. Why detection/prevention failed
-4. Contributing factors
-5. Lessons learned`
-
-	case models.AnalysisRiskAssessment:
-		basePrompt += `Assess risk:
-1. Overall risk score (0-10)
-2. Likelihood of similar attacks
-3. Potential impact
-4. Current exposure
-5. Risk factors breakdown`
-	}
-
-	if customPrompt != "" {
-		basePrompt += "\n\nAdditional context:\n" + customPrompt
-	}
-
-	basePrompt += "\n\nProvide analysis in a structured format with clear sections."
-
-	return basePrompt
-}
-
 func (h *AIHandler) parseAIResponse(content string, analysisType models.AnalysisType, events []models.TelemetryEvent) *models.ThreatSummary {
 	// Extract key findings (lines starting with - or •)
 	keyFindings := make([]string, 0)
@@ -638,13 +705,19 @@ func (h *AIHandler) parseAIResponse(content string, analysisType models.Analysis
 
 func (h *AIHandler) storeAnalysisHistory(summary *models.ThreatSummary) {
 	query := `
-		INSERT INTO ai_analysis_history (id, tenant_id, analysis_type, provider, summary, event_count, tokens_used, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO ai_analysis_history (id, tenant_id, analysis_type, provider, summary, event_count, tokens_used, created_at, result)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
-	_, err := h.db.Exec(query,
+	// The full structured result is kept so incident reports can be rendered later
+	result, err := json.Marshal(summary)
+	if err != nil {
+		log.Warnf("Failed to encode analysis result: %v", err)
+	}
+
+	_, err = h.db.Exec(query,
 		summary.ID, summary.TenantID, summary.AnalysisType, summary.Provider,
-		summary.Summary, summary.EventCount, summary.TokensUsed, summary.GeneratedAt,
+		summary.Summary, summary.EventCount, summary.TokensUsed, summary.GeneratedAt, nullIfEmpty(string(result)),
 	)
 
 	if err != nil {
@@ -653,6 +726,11 @@ func (h *AIHandler) storeAnalysisHistory(summary *models.ThreatSummary) {
 }
 
 // Helper functions for pointer values
+// aiSecretName names a license's provider key in the secrets backend
+func aiSecretName(licenseID, key string) string {
+	return "ai/" + licenseID + "/" + key
+}
+
 func getStringValue(p *string, def string) string {
 	if p != nil {
 		return *p
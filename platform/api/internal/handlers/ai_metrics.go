@@ -0,0 +1,342 @@
+// AI Metrics
+// Per-provider request, latency, error and token accounting for LLM calls, in Prometheus text format
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// aiLatencyBuckets are the upper bounds, in seconds, of the provider latency histogram.
+// Analyses take seconds to a minute, bounded by the 60 second client timeout.
+var aiLatencyBuckets = []float64{0.5, 1, 2, 5, 10, 20, 30, 45, 60}
+
+// Reasons an LLM call failed, the reason label of prive_api_ai_errors_total
+const (
+	aiErrorTimeout         = "timeout"          // Client timeout or cancelled request
+	aiErrorTransport       = "transport"        // Connection or TLS failure
+	aiErrorRateLimited     = "rate_limited"     // HTTP 429
+	aiErrorServer          = "server_error"     // HTTP 5xx, including overloaded
+	aiErrorClient          = "client_error"     // Other non-200 statuses, e.g. a rejected API key
+	aiErrorInvalidResponse = "invalid_response" // Undecodable or empty response body
+)
+
+// aiTokenPrice is the USD price per million input and output tokens of a model
+type aiTokenPrice struct {
+	input, output float64
+}
+
+// aiModelKey identifies a provider's model
+type aiModelKey struct {
+	provider models.AIProvider
+	model    string
+}
+
+// aiRequestKey identifies the requests counted under one label set
+type aiRequestKey struct {
+	aiModelKey
+	analysisType models.AnalysisType
+	outcome      string
+}
+
+// aiModelStats accumulates latency and usage for one model
+type aiModelStats struct {
+	buckets      []uint64 // Cumulative counts per aiLatencyBuckets bound
+	latencyCount uint64
+	latencySum   float64
+	inputTokens  uint64
+	outputTokens uint64
+	costUSD      float64
+	errors       map[string]uint64
+}
+
+// AIMetrics counts LLM calls per provider and model. The label sets stay small: providers and
+// analysis types are fixed enums, and models are whatever the tenants' AI configs name.
+type AIMetrics struct {
+	mu       sync.Mutex
+	requests map[aiRequestKey]uint64
+	models   map[aiModelKey]*aiModelStats
+	inFlight map[models.AIProvider]int
+	prices   map[string]aiTokenPrice
+
+	blocked    uint64            // Analyses stopped by a forbidden content filter
+	redactions map[string]uint64 // Values masked by guardrails, by field or detector
+}
+
+// aiMetrics records every analysis; InitAIMetrics configures its token prices
+var aiMetrics = &AIMetrics{
+	requests:   make(map[aiRequestKey]uint64),
+	models:     make(map[aiModelKey]*aiModelStats),
+	inFlight:   make(map[models.AIProvider]int),
+	redactions: make(map[string]uint64),
+}
+
+// InitAIMetrics sets the token prices used to estimate spend, as comma separated
+// "model=input:output" entries in USD per million tokens (e.g. "gpt-4o=2.5:10").
+// Models without a price are still counted in tokens but add nothing to the estimate.
+func InitAIMetrics(prices string) error {
+	parsed := make(map[string]aiTokenPrice)
+	for _, entry := range strings.Split(prices, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, price, ok := strings.Cut(entry, "=")
+		input, output, ok2 := strings.Cut(price, ":")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return fmt.Errorf("invalid token price %q; use model=input:output", entry)
+		}
+		in, err := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		if err != nil || in < 0 {
+			return fmt.Errorf("invalid input token price in %q", entry)
+		}
+		out, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
+		if err != nil || out < 0 {
+			return fmt.Errorf("invalid output token price in %q", entry)
+		}
+		parsed[strings.TrimSpace(model)] = aiTokenPrice{input: in, output: out}
+	}
+
+	aiMetrics.mu.Lock()
+	aiMetrics.prices = parsed
+	aiMetrics.mu.Unlock()
+	return nil
+}
+
+// recordAIGuardrails counts the redactions of a rendered prompt and whether it was blocked
+func recordAIGuardrails(redactions map[string]int, blocked bool) {
+	aiMetrics.mu.Lock()
+	defer aiMetrics.mu.Unlock()
+	for name, count := range redactions {
+		aiMetrics.redactions[name] += uint64(count)
+	}
+	if blocked {
+		aiMetrics.blocked++
+	}
+}
+
+// aiCall traces a single LLM request. The provider functions fill in the model, HTTP status
+// and token usage as they learn them; finish records the call once it returns.
+type aiCall struct {
+	analysisID   string
+	tenantID     string
+	provider     models.AIProvider
+	model        string
+	analysisType models.AnalysisType
+	started      time.Time
+
+	statusCode   int
+	inputTokens  int
+	outputTokens int
+}
+
+// startAICall marks a request to provider as in flight
+func startAICall(analysisID, tenantID string, provider models.AIProvider, analysisType models.AnalysisType) *aiCall {
+	aiMetrics.mu.Lock()
+	aiMetrics.inFlight[provider]++
+	aiMetrics.mu.Unlock()
+
+	return &aiCall{
+		analysisID:   analysisID,
+		tenantID:     tenantID,
+		provider:     provider,
+		analysisType: analysisType,
+		started:      time.Now(),
+	}
+}
+
+// finish records the call's latency, outcome and tokens, and logs it with its analysis fields
+func (call *aiCall) finish(err error) {
+	latency := time.Since(call.started)
+	reason := call.errorReason(err)
+	outcome := "success"
+	if reason != "" {
+		outcome = "error"
+	}
+
+	m := aiMetrics
+	m.mu.Lock()
+	m.inFlight[call.provider]--
+	key := aiModelKey{provider: call.provider, model: call.model}
+	m.requests[aiRequestKey{aiModelKey: key, analysisType: call.analysisType, outcome: outcome}]++
+
+	stats := m.models[key]
+	if stats == nil {
+		stats = &aiModelStats{buckets: make([]uint64, len(aiLatencyBuckets)), errors: make(map[string]uint64)}
+		m.models[key] = stats
+	}
+	seconds := latency.Seconds()
+	for i, bound := range aiLatencyBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+	stats.latencyCount++
+	stats.latencySum += seconds
+	stats.inputTokens += uint64(call.inputTokens)
+	stats.outputTokens += uint64(call.outputTokens)
+	cost := 0.0
+	if price, ok := m.prices[call.model]; ok {
+		cost = (float64(call.inputTokens)*price.input + float64(call.outputTokens)*price.output) / 1e6
+		stats.costUSD += cost
+	}
+	if reason != "" {
+		stats.errors[reason]++
+	}
+	m.mu.Unlock()
+
+	entry := log.WithFields(log.Fields{
+		"analysis_id":   call.analysisID,
+		"tenant_id":     call.tenantID,
+		"provider":      call.provider,
+		"model":         call.model,
+		"analysis_type": call.analysisType,
+		"latency_ms":    latency.Milliseconds(),
+		"input_tokens":  call.inputTokens,
+		"output_tokens": call.outputTokens,
+		"cost_usd":      cost,
+	})
+	if err != nil {
+		entry.WithFields(log.Fields{"reason": reason, "status_code": call.statusCode}).Warnf("AI provider call failed: %v", err)
+		return
+	}
+	entry.Info("AI provider call completed")
+}
+
+// errorReason classifies a failed call for the errors counter; empty when err is nil
+func (call *aiCall) errorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return aiErrorTimeout
+	case call.statusCode == http.StatusTooManyRequests:
+		return aiErrorRateLimited
+	case call.statusCode >= 500:
+		return aiErrorServer
+	case call.statusCode != 0 && call.statusCode != http.StatusOK:
+		return aiErrorClient
+	case call.statusCode == 0:
+		return aiErrorTransport
+	default:
+		return aiErrorInvalidResponse
+	}
+}
+
+// ServeAIMetrics writes the AI metrics in Prometheus text format
+func ServeAIMetrics(w http.ResponseWriter, r *http.Request) {
+	m := aiMetrics
+	m.mu.Lock()
+	requestKeys := make([]aiRequestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	modelKeys := make([]aiModelKey, 0, len(m.models))
+	for key := range m.models {
+		modelKeys = append(modelKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.aiModelKey != b.aiModelKey {
+			return lessAIModelKey(a.aiModelKey, b.aiModelKey)
+		}
+		if a.analysisType != b.analysisType {
+			return a.analysisType < b.analysisType
+		}
+		return a.outcome < b.outcome
+	})
+	sort.Slice(modelKeys, func(i, j int) bool { return lessAIModelKey(modelKeys[i], modelKeys[j]) })
+
+	var b strings.Builder
+	writeHeader := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	labels := func(key aiModelKey) string {
+		return fmt.Sprintf("provider=%q,model=%q", key.provider, key.model)
+	}
+
+	writeHeader("prive_api_ai_requests_total", "counter", "LLM analysis requests by provider, model, analysis type and outcome.")
+	for _, key := range requestKeys {
+		fmt.Fprintf(&b, "prive_api_ai_requests_total{%s,analysis_type=%q,outcome=%q} %d\n",
+			labels(key.aiModelKey), key.analysisType, key.outcome, m.requests[key])
+	}
+
+	writeHeader("prive_api_ai_request_duration_seconds", "histogram", "LLM provider call latency.")
+	for _, key := range modelKeys {
+		stats := m.models[key]
+		for i, bound := range aiLatencyBuckets {
+			fmt.Fprintf(&b, "prive_api_ai_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels(key), bound, stats.buckets[i])
+		}
+		fmt.Fprintf(&b, "prive_api_ai_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels(key), stats.latencyCount)
+		fmt.Fprintf(&b, "prive_api_ai_request_duration_seconds_sum{%s} %g\n", labels(key), stats.latencySum)
+		fmt.Fprintf(&b, "prive_api_ai_request_duration_seconds_count{%s} %d\n", labels(key), stats.latencyCount)
+	}
+
+	writeHeader("prive_api_ai_errors_total", "counter", "Failed LLM provider calls by reason.")
+	for _, key := range modelKeys {
+		reasons := make([]string, 0, len(m.models[key].errors))
+		for reason := range m.models[key].errors {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(&b, "prive_api_ai_errors_total{%s,reason=%q} %d\n", labels(key), reason, m.models[key].errors[reason])
+		}
+	}
+
+	writeHeader("prive_api_ai_tokens_total", "counter", "Tokens reported by the provider, by direction.")
+	for _, key := range modelKeys {
+		fmt.Fprintf(&b, "prive_api_ai_tokens_total{%s,direction=\"input\"} %d\n", labels(key), m.models[key].inputTokens)
+		fmt.Fprintf(&b, "prive_api_ai_tokens_total{%s,direction=\"output\"} %d\n", labels(key), m.models[key].outputTokens)
+	}
+
+	writeHeader("prive_api_ai_estimated_cost_usd_total", "counter", "Estimated spend from AI_TOKEN_PRICES; models without a price count zero.")
+	for _, key := range modelKeys {
+		fmt.Fprintf(&b, "prive_api_ai_estimated_cost_usd_total{%s} %g\n", labels(key), m.models[key].costUSD)
+	}
+
+	writeHeader("prive_api_ai_in_flight_requests", "gauge", "LLM provider calls currently waiting for a response.")
+	for _, provider := range []models.AIProvider{models.ProviderOpenAI, models.ProviderAnthropic} {
+		fmt.Fprintf(&b, "prive_api_ai_in_flight_requests{provider=%q} %d\n", provider, m.inFlight[provider])
+	}
+
+	writeHeader("prive_api_ai_guardrail_blocked_total", "counter", "Analyses not sent because the prompt matched a forbidden content filter.")
+	fmt.Fprintf(&b, "prive_api_ai_guardrail_blocked_total %d\n", m.blocked)
+
+	writeHeader("prive_api_ai_guardrail_redactions_total", "counter", "Values masked before prompting, by event field or DLP detector.")
+	redacted := make([]string, 0, len(m.redactions))
+	for name := range m.redactions {
+		redacted = append(redacted, name)
+	}
+	sort.Strings(redacted)
+	for _, name := range redacted {
+		fmt.Fprintf(&b, "prive_api_ai_guardrail_redactions_total{name=%q} %d\n", name, m.redactions[name])
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func lessAIModelKey(a, b aiModelKey) bool {
+	if a.provider != b.provider {
+		return a.provider < b.provider
+	}
+	return a.model < b.model
+}
@@ -0,0 +1,447 @@
+// AI Prompt Templates and Guardrails
+// Per-license analysis prompts with variable substitution, and the redaction and content filters applied before prompting
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// aiRedactedValue replaces event fields masked by a guardrail
+const aiRedactedValue = "[REDACTED]"
+
+// defaultAISystemPrompt frames every analysis unless a template sets its own system prompt
+const defaultAISystemPrompt = "You are a cybersecurity expert analyzing security events for an EDR/DLP platform. Provide detailed, actionable analysis with specific recommendations."
+
+// defaultAnalysisTemplate is the built-in prompt, rendered like a tenant template
+const defaultAnalysisTemplate = `Analyze the following {{events_fetched}} security events and provide a comprehensive {{analysis_type}}.
+{{events_included}} events are shown in full, {{events_summarized}} are summarized as repeated activity and {{events_omitted}} are only counted by type.
+
+{{events}}
+{{instructions}}
+
+Provide analysis in a structured format with clear sections.`
+
+// analysisInstructions are the built-in per-type instructions, the {{instructions}} variable
+var analysisInstructions = map[models.AnalysisType]string{
+	models.AnalysisIncidentSummary: `Provide:
+1. Executive Summary (2-3 sentences)
+2. Key Findings (bullet points)
+3. MITRE ATT&CK techniques observed
+4. Risk assessment
+5. Immediate recommendations`,
+
+	models.AnalysisAttackChain: `Reconstruct the attack chain:
+1. Initial access method
+2. Execution timeline
+3. Persistence mechanisms
+4. Privilege escalation attempts
+5. Lateral movement
+6. Data collection/exfiltration
+7. Overall narrative`,
+
+	models.AnalysisRemediationPlan: `Create detailed remediation plan:
+1. Immediate containment steps
+2. Investigation actions
+3. Eradication procedures
+4. Recovery steps
+5. Long-term prevention measures
+Include specific commands where applicable.`,
+
+	models.AnalysisRootCause: `Determine root cause:
+1. Initial vulnerability or weakness
+2. How the attacker exploited it
+3. Why detection/prevention failed
+4. Contributing factors
+5. Lessons learned`,
+
+	models.AnalysisRiskAssessment: `Assess risk:
+1. Overall risk score (0-10)
+2. Likelihood of similar attacks
+3. Potential impact
+4. Current exposure
+5. Risk factors breakdown`,
+}
+
+// promptVariablePattern matches a {{name}} placeholder in a prompt template
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// analysisPrompt is the rendered prompt sent to the provider
+type analysisPrompt struct {
+	system   string
+	user     string
+	template string // Analysis type key of the tenant template; empty for the built-in prompt
+}
+
+// ListPromptTemplates lists a license's prompt templates with the variables and built-in prompts
+// they replace, so a template can start from the default
+func (h *AIHandler) ListPromptTemplates(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT license_id, analysis_type, COALESCE(system_prompt, ''), template,
+		       COALESCE(updated_by, ''), created_at, updated_at
+		FROM ai_prompt_templates
+		WHERE license_id = $1
+		ORDER BY analysis_type
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to list prompt templates: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prompt templates"})
+		return
+	}
+	defer rows.Close()
+
+	templates := []models.AIPromptTemplate{}
+	for rows.Next() {
+		var t models.AIPromptTemplate
+		if err := rows.Scan(&t.LicenseID, &t.AnalysisType, &t.SystemPrompt, &t.Template,
+			&t.UpdatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			log.Errorf("Failed to scan prompt template: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list prompt templates"})
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":     templates,
+		"count":     len(templates),
+		"variables": models.AIPromptVariables,
+		"builtin": gin.H{
+			"system_prompt": defaultAISystemPrompt,
+			"template":      defaultAnalysisTemplate,
+			"instructions":  analysisInstructions,
+		},
+	})
+}
+
+// SetPromptTemplate creates or replaces the template of an analysis type, or the license's
+// fallback template when the type is "default"
+func (h *AIHandler) SetPromptTemplate(c *gin.Context) {
+	analysisType := c.Param("analysis_type")
+	if !validPromptTemplateKey(analysisType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown analysis type %q; use one of %v or %q", analysisType, models.AnalysisTypes, models.AIPromptDefault)})
+		return
+	}
+
+	var req models.AIPromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if err := validatePromptTemplate(req.Template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := models.AIPromptTemplate{
+		LicenseID:    req.LicenseID,
+		AnalysisType: analysisType,
+		SystemPrompt: req.SystemPrompt,
+		Template:     req.Template,
+		UpdatedBy:    req.UpdatedBy,
+	}
+	err := h.db.QueryRow(`
+		INSERT INTO ai_prompt_templates (license_id, analysis_type, system_prompt, template, updated_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''))
+		ON CONFLICT (license_id, analysis_type) DO UPDATE SET
+			system_prompt = EXCLUDED.system_prompt, template = EXCLUDED.template,
+			updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, req.LicenseID, analysisType, req.SystemPrompt, req.Template, req.UpdatedBy).Scan(&template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to set prompt template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set prompt template"})
+		return
+	}
+
+	log.Infof("Prompt template %s of license %s updated", analysisType, req.LicenseID)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeletePromptTemplate removes a template, reverting the analysis type to the fallback or built-in prompt
+func (h *AIHandler) DeletePromptTemplate(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM ai_prompt_templates WHERE license_id = $1 AND analysis_type = $2", licenseID, c.Param("analysis_type"))
+	if err != nil {
+		log.Errorf("Failed to delete prompt template: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete prompt template"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Prompt template deleted successfully"})
+}
+
+// GetAIGuardrails returns a license's guardrails; licenses without any get the permissive defaults
+func (h *AIHandler) GetAIGuardrails(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	guardrails, err := h.loadAIGuardrails(licenseID)
+	if err != nil {
+		log.Errorf("Failed to load AI guardrails: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve AI guardrails"})
+		return
+	}
+
+	detectors := make([]string, 0, len(dlpDetectors))
+	for name := range dlpDetectors {
+		detectors = append(detectors, name)
+	}
+	sort.Strings(detectors)
+	c.JSON(http.StatusOK, gin.H{"guardrails": guardrails, "detectors": detectors})
+}
+
+// SetAIGuardrails creates or replaces a license's guardrails
+func (h *AIHandler) SetAIGuardrails(c *gin.Context) {
+	var req models.AIGuardrailsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	for _, name := range req.RedactDetectors {
+		if _, ok := dlpDetectors[name]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown detector %q", name)})
+			return
+		}
+	}
+	for _, pattern := range req.ForbiddenPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid forbidden pattern %q: %v", pattern, err)})
+			return
+		}
+	}
+
+	guardrails := models.AIGuardrails{
+		LicenseID:         req.LicenseID,
+		MaxEvents:         req.MaxEvents,
+		AllowCustomPrompt: getBoolValue(req.AllowCustomPrompt, true),
+		RedactFields:      nonNilStrings(req.RedactFields),
+		RedactDetectors:   nonNilStrings(req.RedactDetectors),
+		ForbiddenPatterns: nonNilStrings(req.ForbiddenPatterns),
+		UpdatedBy:         req.UpdatedBy,
+	}
+	err := h.db.QueryRow(`
+		INSERT INTO ai_guardrails (license_id, max_events, allow_custom_prompt, redact_fields,
+		                           redact_detectors, forbidden_patterns, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		ON CONFLICT (license_id) DO UPDATE SET
+			max_events = EXCLUDED.max_events, allow_custom_prompt = EXCLUDED.allow_custom_prompt,
+			redact_fields = EXCLUDED.redact_fields, redact_detectors = EXCLUDED.redact_detectors,
+			forbidden_patterns = EXCLUDED.forbidden_patterns, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING updated_at
+	`, req.LicenseID, guardrails.MaxEvents, guardrails.AllowCustomPrompt, pq.Array(guardrails.RedactFields),
+		pq.Array(guardrails.RedactDetectors), pq.Array(guardrails.ForbiddenPatterns), req.UpdatedBy).Scan(&guardrails.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to set AI guardrails: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set AI guardrails"})
+		return
+	}
+
+	log.Infof("AI guardrails of license %s updated", req.LicenseID)
+	c.JSON(http.StatusOK, guardrails)
+}
+
+// validPromptTemplateKey reports whether key names an analysis type or the fallback template
+func validPromptTemplateKey(key string) bool {
+	if key == models.AIPromptDefault {
+		return true
+	}
+	for _, analysisType := range models.AnalysisTypes {
+		if string(analysisType) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePromptTemplate rejects unknown variables and templates that leave out the events
+func validatePromptTemplate(template string) error {
+	hasEvents := false
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(template, -1) {
+		if _, ok := models.AIPromptVariables[match[1]]; !ok {
+			return fmt.Errorf("unknown template variable {{%s}}", match[1])
+		}
+		if match[1] == "events" {
+			hasEvents = true
+		}
+	}
+	if !hasEvents {
+		return fmt.Errorf("template must include {{events}}")
+	}
+	return nil
+}
+
+// nonNilStrings returns values, or an empty slice in place of nil
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// loadPromptTemplate returns the license's template for analysisType, falling back to its
+// default template; nil when neither exists
+func (h *AIHandler) loadPromptTemplate(licenseID string, analysisType models.AnalysisType) (*models.AIPromptTemplate, error) {
+	var t models.AIPromptTemplate
+	err := h.db.QueryRow(`
+		SELECT license_id, analysis_type, COALESCE(system_prompt, ''), template
+		FROM ai_prompt_templates
+		WHERE license_id = $1 AND analysis_type IN ($2, $3)
+		ORDER BY analysis_type = $3
+		LIMIT 1
+	`, licenseID, string(analysisType), models.AIPromptDefault).Scan(&t.LicenseID, &t.AnalysisType, &t.SystemPrompt, &t.Template)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// loadAIGuardrails returns a license's guardrails, or the defaults when none are configured
+func (h *AIHandler) loadAIGuardrails(licenseID string) (*models.AIGuardrails, error) {
+	guardrails := models.AIGuardrails{
+		LicenseID:         licenseID,
+		AllowCustomPrompt: true,
+		RedactFields:      []string{},
+		RedactDetectors:   []string{},
+		ForbiddenPatterns: []string{},
+	}
+	err := h.db.QueryRow(`
+		SELECT max_events, allow_custom_prompt, COALESCE(redact_fields, '{}'), COALESCE(redact_detectors, '{}'),
+		       COALESCE(forbidden_patterns, '{}'), COALESCE(updated_by, ''), updated_at
+		FROM ai_guardrails
+		WHERE license_id = $1
+	`, licenseID).Scan(&guardrails.MaxEvents, &guardrails.AllowCustomPrompt, pq.Array(&guardrails.RedactFields),
+		pq.Array(&guardrails.RedactDetectors), pq.Array(&guardrails.ForbiddenPatterns), &guardrails.UpdatedBy, &guardrails.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &guardrails, nil
+}
+
+// buildAnalysisPrompt renders the tenant's template, or the built-in prompt when template is nil
+func (h *AIHandler) buildAnalysisPrompt(req models.GenerateSummaryRequest, input *analysisInput, template *models.AIPromptTemplate) analysisPrompt {
+	prompt := analysisPrompt{system: defaultAISystemPrompt}
+	text := defaultAnalysisTemplate
+	if template != nil {
+		prompt.template = template.AnalysisType
+		text = template.Template
+		if template.SystemPrompt != "" {
+			prompt.system = template.SystemPrompt
+		}
+	}
+
+	stats := input.stats
+	timeRange := ""
+	if len(input.events) > 0 {
+		timeRange = input.events[0].Timestamp.UTC().Format(time.RFC3339) + " to " +
+			input.events[len(input.events)-1].Timestamp.UTC().Format(time.RFC3339)
+	}
+	variables := map[string]string{
+		"analysis_type":     string(req.AnalysisType),
+		"events":            input.promptContext(),
+		"events_fetched":    strconv.Itoa(stats.EventsFetched),
+		"events_included":   strconv.Itoa(stats.EventsIncluded),
+		"events_summarized": strconv.Itoa(stats.EventsSummarized),
+		"events_omitted":    strconv.Itoa(stats.EventsOmitted),
+		"time_range":        timeRange,
+		"instructions":      analysisInstructions[req.AnalysisType],
+		"custom_prompt":     req.CustomPrompt,
+	}
+
+	customPromptUsed := false
+	prompt.user = promptVariablePattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := promptVariablePattern.FindStringSubmatch(placeholder)[1]
+		if name == "custom_prompt" {
+			customPromptUsed = true
+		}
+		return variables[name]
+	})
+	if req.CustomPrompt != "" && !customPromptUsed {
+		prompt.user += "\n\nAdditional context:\n" + req.CustomPrompt
+	}
+	return prompt
+}
+
+// redactPrompt masks matches of the guardrail's detectors in the prompt, counting them by detector
+func redactPrompt(prompt *analysisPrompt, guardrails *models.AIGuardrails, redactions map[string]int) {
+	detections := []dlpDetection{}
+	for _, name := range guardrails.RedactDetectors {
+		if detector, ok := dlpDetectors[name]; ok {
+			detections = append(detections, detector.scan(prompt.user)...)
+		}
+	}
+	if len(detections) == 0 {
+		return
+	}
+	sort.Slice(detections, func(i, j int) bool { return detections[i].offset < detections[j].offset })
+
+	var b strings.Builder
+	end := 0
+	for _, d := range detections {
+		if d.offset < end {
+			continue // Overlaps a match already masked
+		}
+		b.WriteString(prompt.user[end:d.offset])
+		fmt.Fprintf(&b, "[REDACTED:%s]", d.detector)
+		end = d.offset + d.length
+		redactions[d.detector]++
+	}
+	b.WriteString(prompt.user[end:])
+	prompt.user = b.String()
+}
+
+// forbiddenPromptPattern returns the first forbidden pattern the prompt matches, or "" when it may be sent
+func forbiddenPromptPattern(prompt analysisPrompt, guardrails *models.AIGuardrails) string {
+	for _, pattern := range guardrails.ForbiddenPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue // Validated on save
+		}
+		if re.MatchString(prompt.system) || re.MatchString(prompt.user) {
+			return pattern
+		}
+	}
+	return ""
+}
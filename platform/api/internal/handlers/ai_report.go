@@ -0,0 +1,371 @@
+// AI Incident Reports
+// Renders a stored AI threat analysis as an incident report for stakeholders and regulators
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// pdfPunctuation maps typographic characters LLMs commonly emit onto their ASCII equivalents;
+// the report PDF uses the standard Courier font, which only covers ASCII reliably
+var pdfPunctuation = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201c", `"`, "\u201d", `"`, "\u2013", "-", "\u2014", "-",
+	"\u2022", "-", "\u2026", "...", "\u2192", "->", "\u00a0", " ",
+)
+
+// GetAnalysisReport renders a stored analysis as an incident report: executive summary,
+// timeline, MITRE ATT&CK mapping, IOC table and remediation steps. format=pdf (default) returns
+// the PDF; format=json returns the stored analysis.
+func (h *AIHandler) GetAnalysisReport(c *gin.Context) {
+	format := c.DefaultQuery("format", "pdf")
+	if format != "pdf" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be pdf or json"})
+		return
+	}
+
+	summary, err := h.loadAnalysis(c.Param("id"), principalLicense(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load analysis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load analysis"})
+		return
+	}
+	if tenantID := c.Query("tenant_id"); tenantID != "" && tenantID != summary.TenantID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+
+	pdf, err := renderLinesPDF(analysisReportTitle(summary), analysisReportLines(summary))
+	if err != nil {
+		log.Errorf("Failed to render incident report PDF: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+		return
+	}
+
+	id := summary.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("incident-report-%s-%s.pdf", summary.GeneratedAt.Format("2006-01-02"), id)))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// loadAnalysis loads a stored analysis, confined to licenseID when it is set. Analyses stored
+// before structured results were kept only have their summary text.
+func (h *AIHandler) loadAnalysis(id, licenseID string) (models.ThreatSummary, error) {
+	var summary models.ThreatSummary
+	var result []byte
+	err := h.db.QueryRow(`
+		SELECT id, tenant_id, analysis_type, provider, summary, event_count, tokens_used, created_at, result
+		FROM ai_analysis_history
+		WHERE id = $1 AND ($2 = '' OR tenant_id::text = $2)
+	`, id, licenseID).Scan(&summary.ID, &summary.TenantID, &summary.AnalysisType, &summary.Provider,
+		&summary.Summary, &summary.EventCount, &summary.TokensUsed, &summary.GeneratedAt, &result)
+	if err != nil {
+		return summary, err
+	}
+
+	if len(result) > 0 {
+		stored := summary
+		if err := json.Unmarshal(result, &stored); err != nil {
+			log.Warnf("Failed to decode stored analysis %s: %v", id, err)
+			return summary, nil
+		}
+		return stored, nil
+	}
+	return summary, nil
+}
+
+func analysisReportTitle(summary models.ThreatSummary) string {
+	words := strings.Fields(strings.ReplaceAll(string(summary.AnalysisType), "_", " "))
+	if len(words) == 0 {
+		return "Incident Report"
+	}
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return "Incident Report: " + strings.Join(words, " ")
+}
+
+// analysisReportLines lays the analysis out as report text lines no wider than pdfLineWidth
+func analysisReportLines(s models.ThreatSummary) []string {
+	lines := []string{
+		fmt.Sprintf("Analysis:  %s", s.ID),
+		fmt.Sprintf("Generated: %s by %s", s.GeneratedAt.Format("2006-01-02 15:04 MST"), s.Provider),
+		fmt.Sprintf("Events:    %d analyzed", s.EventCount),
+	}
+	if !s.TimeRange.Start.IsZero() {
+		lines = append(lines, fmt.Sprintf("Period:    %s - %s",
+			s.TimeRange.Start.Format("2006-01-02 15:04 MST"), s.TimeRange.End.Format("2006-01-02 15:04 MST")))
+	}
+	lines = append(lines, "")
+
+	lines = append(lines, "EXECUTIVE SUMMARY")
+	if r := s.RiskScore; r != nil {
+		lines = append(lines, wrapReportText(fmt.Sprintf("Risk score %.1f / 10 (likelihood %.1f, impact %.1f, urgency %s)",
+			r.Overall, r.Likelihood, r.Impact, r.Urgency), "  ")...)
+		lines = append(lines, wrapReportText(r.Justification, "  ")...)
+		lines = append(lines, "")
+	}
+	if len(s.KeyFindings) > 0 {
+		lines = append(lines, "  Key findings:")
+		for _, finding := range s.KeyFindings {
+			lines = append(lines, wrapReportItem("  - ", finding)...)
+		}
+		lines = append(lines, "")
+	}
+	for _, paragraph := range strings.Split(s.Summary, "\n") {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		lines = append(lines, wrapReportText(paragraph, "  ")...)
+	}
+	lines = append(lines, "")
+
+	if steps := analysisTimeline(s.AttackChain); len(steps) > 0 {
+		lines = append(lines, "TIMELINE")
+		for _, step := range steps {
+			header := fmt.Sprintf("  %s  %s  %s", step.Timestamp.Format("2006-01-02 15:04:05"), step.Hostname, step.EventType)
+			if step.MITRETechnique != "" {
+				header += "  [" + step.MITRETechnique + "]"
+			}
+			lines = append(lines, truncateReportLine(header))
+			lines = append(lines, wrapReportText(step.Description, "      ")...)
+		}
+		if s.AttackChain.Narrative != "" {
+			lines = append(lines, "")
+			lines = append(lines, wrapReportText(s.AttackChain.Narrative, "  ")...)
+		}
+		lines = append(lines, "")
+	}
+
+	if mapping := analysisMITREMapping(s); len(mapping) > 0 {
+		lines = append(lines, "MITRE ATT&CK MAPPING")
+		for _, m := range mapping {
+			lines = append(lines, truncateReportLine(fmt.Sprintf("  %-12s %s", m[0], m[1])))
+		}
+		lines = append(lines, "")
+	}
+
+	if iocs := analysisIOCRows(s.IOCs); len(iocs) > 0 {
+		lines = append(lines, "INDICATORS OF COMPROMISE",
+			fmt.Sprintf("  %-10s %-46s %5s %7s", "TYPE", "VALUE", "CONF", "EVENTS"))
+		for _, row := range iocs {
+			value := row.ioc.Value
+			if len(value) > 46 {
+				value = value[:43] + "..."
+			}
+			lines = append(lines, fmt.Sprintf("  %-10s %-46s %4.0f%% %7d", row.kind, value, row.ioc.Confidence*100, row.ioc.EventCount))
+		}
+		lines = append(lines, "")
+	}
+
+	if len(s.RemediationSteps) > 0 {
+		lines = append(lines, "REMEDIATION")
+		for i, step := range s.RemediationSteps {
+			lines = append(lines, wrapReportItem(fmt.Sprintf("  %d. [%s] ", i+1, strings.ToUpper(step.Priority)), step.Action)...)
+			lines = append(lines, wrapReportText(step.Description, "       ")...)
+			for _, command := range step.Commands {
+				lines = append(lines, truncateReportLine("       $ "+command))
+			}
+			if step.EstimatedTime != "" {
+				lines = append(lines, "       Estimated time: "+step.EstimatedTime)
+			}
+		}
+		lines = append(lines, "")
+	}
+
+	if len(s.Recommendations) > 0 {
+		lines = append(lines, "RECOMMENDATIONS")
+		for _, rec := range s.Recommendations {
+			lines = append(lines, wrapReportItem("  - ", rec)...)
+		}
+	}
+
+	return lines
+}
+
+// analysisTimeline returns the chain's timeline, or its steps in time order when the model
+// did not produce one
+func analysisTimeline(chain *models.AttackChain) []models.ChainStep {
+	if chain == nil {
+		return nil
+	}
+	if len(chain.Timeline) > 0 {
+		return chain.Timeline
+	}
+	var steps []models.ChainStep
+	for _, stage := range analysisChainStages(chain) {
+		steps = append(steps, stage.steps...)
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Timestamp.Before(steps[j].Timestamp) })
+	return steps
+}
+
+type chainStage struct {
+	tactic string
+	steps  []models.ChainStep
+}
+
+func analysisChainStages(chain *models.AttackChain) []chainStage {
+	stages := []chainStage{}
+	if chain.InitialAccess != nil {
+		stages = append(stages, chainStage{"Initial Access", []models.ChainStep{*chain.InitialAccess}})
+	}
+	return append(stages,
+		chainStage{"Execution", chain.Execution},
+		chainStage{"Persistence", chain.Persistence},
+		chainStage{"Privilege Escalation", chain.PrivilegeEsc},
+		chainStage{"Defense Evasion", chain.DefenseEvasion},
+		chainStage{"Credential Access", chain.CredentialAccess},
+		chainStage{"Discovery", chain.Discovery},
+		chainStage{"Lateral Movement", chain.LateralMovement},
+		chainStage{"Collection", chain.Collection},
+		chainStage{"Exfiltration", chain.Exfiltration},
+		chainStage{"Impact", chain.Impact},
+	)
+}
+
+// analysisMITREMapping pairs each technique with the tactics it was observed under, in the
+// attack chain's order, followed by mapped techniques that did not appear in the chain
+func analysisMITREMapping(s models.ThreatSummary) [][2]string {
+	tactics := map[string][]string{}
+	order := []string{}
+	if s.AttackChain != nil {
+		for _, stage := range analysisChainStages(s.AttackChain) {
+			for _, step := range stage.steps {
+				if step.MITRETechnique == "" {
+					continue
+				}
+				if _, ok := tactics[step.MITRETechnique]; !ok {
+					order = append(order, step.MITRETechnique)
+				}
+				if !containsString(tactics[step.MITRETechnique], stage.tactic) {
+					tactics[step.MITRETechnique] = append(tactics[step.MITRETechnique], stage.tactic)
+				}
+			}
+		}
+	}
+	for _, technique := range s.MITREMapping {
+		if _, ok := tactics[technique]; !ok {
+			tactics[technique] = nil
+			order = append(order, technique)
+		}
+	}
+
+	mapping := make([][2]string, 0, len(order))
+	for _, technique := range order {
+		mapping = append(mapping, [2]string{technique, strings.Join(tactics[technique], ", ")})
+	}
+	return mapping
+}
+
+type iocRow struct {
+	kind string
+	ioc  models.IOC
+}
+
+func analysisIOCRows(iocs *models.IOCExtraction) []iocRow {
+	if iocs == nil {
+		return nil
+	}
+	rows := []iocRow{}
+	for _, group := range []struct {
+		kind string
+		iocs []models.IOC
+	}{
+		{"ip", iocs.IPAddresses}, {"domain", iocs.Domains}, {"url", iocs.URLs}, {"hash", iocs.FileHashes},
+		{"file", iocs.FilePaths}, {"registry", iocs.RegistryKeys}, {"process", iocs.ProcessNames},
+		{"command", iocs.CommandLines}, {"email", iocs.EmailAddresses}, {"user", iocs.Usernames},
+	} {
+		for _, ioc := range group.iocs {
+			ioc.Value = pdfASCII(ioc.Value)
+			rows = append(rows, iocRow{kind: group.kind, ioc: ioc})
+		}
+	}
+	return rows
+}
+
+// wrapReportItem wraps text after a list marker, indenting continuation lines under the text
+func wrapReportItem(marker, text string) []string {
+	lines := wrapReportText(text, strings.Repeat(" ", len(marker)))
+	if len(lines) > 0 {
+		lines[0] = marker + strings.TrimLeft(lines[0], " ")
+	}
+	return lines
+}
+
+// wrapReportText word-wraps text to pdfLineWidth with every line indented
+func wrapReportText(text, indent string) []string {
+	words := strings.Fields(pdfASCII(text))
+	lines := []string{}
+	line := indent
+	for _, word := range words {
+		for len(indent)+len(word) > pdfLineWidth {
+			// Break words too long for a line, e.g. paths and hashes
+			if line != indent {
+				lines = append(lines, line)
+			}
+			cut := pdfLineWidth - len(indent)
+			lines = append(lines, indent+word[:cut])
+			word = word[cut:]
+			line = indent
+		}
+		switch {
+		case line == indent:
+			line += word
+		case len(line)+1+len(word) > pdfLineWidth:
+			lines = append(lines, line)
+			line = indent + word
+		default:
+			line += " " + word
+		}
+	}
+	if line != indent {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func truncateReportLine(line string) string {
+	line = pdfASCII(line)
+	if len(line) > pdfLineWidth {
+		return line[:pdfLineWidth-3] + "..."
+	}
+	return line
+}
+
+// pdfASCII reduces text to printable ASCII for the report's standard PDF font
+func pdfASCII(text string) string {
+	text = pdfPunctuation.Replace(text)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case r > unicode.MaxASCII || !unicode.IsPrint(r):
+			return '?'
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,381 @@
+// AI Event Sampling
+// Reduces fetched telemetry to a prompt-sized subset before it is sent to an LLM
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	aiFetchLimit           = 10000 // Events fetched from ClickHouse before sampling
+	defaultAISampleEvents  = 200
+	maxAISampleEvents      = 1000
+	defaultAIFieldLength   = 256
+	aiRepeatGroupThreshold = 3 // Identical events collapsed once they occur this often
+)
+
+// aiDroppedPayloadKeys duplicate top-level fields or carry no analytic value
+var aiDroppedPayloadKeys = map[string]bool{
+	"event_id": true, "agent_id": true, "tenant_id": true, "timestamp": true,
+	"event_type": true, "hostname": true, "os_type": true, "severity": true,
+	"process_name": true, "file_path": true, "dst_ip": true, "username": true,
+	"raw": true, "raw_event": true, "sequence": true, "agent_version": true,
+}
+
+// repeatedActivity is a group of events sharing the same signature
+type repeatedActivity struct {
+	eventType   string
+	hostname    string
+	processName string
+	filePath    string
+	dstIP       string
+	username    string
+	technique   string
+	count       int
+	first       time.Time
+	last        time.Time
+	maxSeverity uint8
+	rep         int // Index of the representative event
+}
+
+// analysisInput is the reduced view of the fetched events used for prompting
+type analysisInput struct {
+	events         []models.TelemetryEvent // All fetched events in time order
+	included       []int
+	groups         []*repeatedActivity
+	omitted        map[string]int
+	maxFieldLength int
+	stats          models.AIEventSamplingStats
+
+	redactFields map[string]bool // Guardrail fields masked while rendering
+	redactions   map[string]int  // Values masked, by field
+}
+
+// validateSamplingOptions rejects options that cannot be applied
+func validateSamplingOptions(opts *models.AISamplingOptions) error {
+	if opts == nil {
+		return nil
+	}
+	switch opts.Strategy {
+	case "", models.AISamplingSeverity, models.AISamplingRepresentative, models.AISamplingChronological:
+	default:
+		return fmt.Errorf("invalid sampling strategy: %s", opts.Strategy)
+	}
+	if opts.MaxEvents < 0 || opts.MaxEvents > maxAISampleEvents {
+		return fmt.Errorf("max_events must be between 1 and %d", maxAISampleEvents)
+	}
+	if opts.MaxFieldLength < 0 {
+		return fmt.Errorf("max_field_length must be positive")
+	}
+	return nil
+}
+
+// reduceAnalysisEvents selects the events sent in full and summarizes the rest
+func reduceAnalysisEvents(events []models.TelemetryEvent, opts *models.AISamplingOptions) *analysisInput {
+	strategy := models.AISamplingSeverity
+	maxEvents := defaultAISampleEvents
+	maxFieldLength := defaultAIFieldLength
+	summarizeRepeats := true
+	if opts != nil {
+		if opts.Strategy != "" {
+			strategy = opts.Strategy
+		}
+		if opts.MaxEvents > 0 {
+			maxEvents = opts.MaxEvents
+		}
+		if opts.MaxFieldLength > 0 {
+			maxFieldLength = opts.MaxFieldLength
+		}
+		summarizeRepeats = getBoolValue(opts.SummarizeRepeats, true)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	input := &analysisInput{
+		events:         events,
+		omitted:        make(map[string]int),
+		maxFieldLength: maxFieldLength,
+		redactions:     make(map[string]int),
+	}
+
+	// Group identical activity so a burst of repeats costs one line
+	grouped := make([]*repeatedActivity, len(events))
+	candidates := make([]int, 0, len(events))
+	if summarizeRepeats {
+		bySignature := make(map[string]*repeatedActivity)
+		order := make([]*repeatedActivity, 0)
+		for i, event := range events {
+			key := strings.Join([]string{
+				event.EventType, event.Hostname, event.ProcessName, event.FilePath,
+				event.DstIP, event.Username, event.MitreTechnique,
+			}, "\x00")
+			group, ok := bySignature[key]
+			if !ok {
+				group = &repeatedActivity{
+					eventType:   event.EventType,
+					hostname:    event.Hostname,
+					processName: event.ProcessName,
+					filePath:    event.FilePath,
+					dstIP:       event.DstIP,
+					username:    event.Username,
+					technique:   event.MitreTechnique,
+					first:       event.Timestamp,
+					maxSeverity: event.Severity,
+					rep:         i,
+				}
+				bySignature[key] = group
+				order = append(order, group)
+			}
+			group.count++
+			group.last = event.Timestamp
+			if event.Severity > group.maxSeverity {
+				group.maxSeverity = event.Severity
+				group.rep = i
+			}
+			grouped[i] = group
+		}
+
+		for _, group := range order {
+			if group.count >= aiRepeatGroupThreshold {
+				input.groups = append(input.groups, group)
+			}
+		}
+		for i, group := range grouped {
+			if group.count < aiRepeatGroupThreshold || group.rep == i {
+				candidates = append(candidates, i)
+			}
+		}
+	} else {
+		for i := range events {
+			candidates = append(candidates, i)
+		}
+	}
+
+	input.included = sampleEventIndexes(events, candidates, strategy, maxEvents)
+	sort.Ints(input.included)
+
+	included := make(map[int]bool, len(input.included))
+	for _, i := range input.included {
+		included[i] = true
+	}
+
+	summarized := 0
+	for _, group := range input.groups {
+		summarized += group.count
+		if included[group.rep] {
+			summarized--
+		}
+	}
+	for i, event := range events {
+		if included[i] {
+			continue
+		}
+		if grouped[i] != nil && grouped[i].count >= aiRepeatGroupThreshold {
+			continue
+		}
+		input.omitted[event.EventType]++
+	}
+
+	input.stats = models.AIEventSamplingStats{
+		Strategy:         strategy,
+		EventsFetched:    len(events),
+		EventsIncluded:   len(input.included),
+		EventsSummarized: summarized,
+		EventsOmitted:    len(events) - len(input.included) - summarized,
+		RepeatGroups:     len(input.groups),
+	}
+
+	return input
+}
+
+// sampleEventIndexes picks up to limit candidates according to the strategy
+func sampleEventIndexes(events []models.TelemetryEvent, candidates []int, strategy string, limit int) []int {
+	if len(candidates) <= limit {
+		return candidates
+	}
+
+	bySeverity := func(ids []int) {
+		sort.SliceStable(ids, func(a, b int) bool {
+			ea, eb := events[ids[a]], events[ids[b]]
+			if ea.Severity != eb.Severity {
+				return ea.Severity > eb.Severity
+			}
+			if (ea.MitreTechnique != "") != (eb.MitreTechnique != "") {
+				return ea.MitreTechnique != ""
+			}
+			return ea.Timestamp.Before(eb.Timestamp)
+		})
+	}
+
+	switch strategy {
+	case models.AISamplingRepresentative:
+		// Round-robin across event type and host so no single source dominates
+		buckets := make(map[string][]int)
+		keys := make([]string, 0)
+		for _, i := range candidates {
+			key := events[i].EventType + "|" + events[i].Hostname
+			if _, ok := buckets[key]; !ok {
+				keys = append(keys, key)
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, key := range keys {
+			bySeverity(buckets[key])
+		}
+
+		selected := make([]int, 0, limit)
+		for round := 0; len(selected) < limit; round++ {
+			for _, key := range keys {
+				if round < len(buckets[key]) && len(selected) < limit {
+					selected = append(selected, buckets[key][round])
+				}
+			}
+		}
+		return selected
+
+	case models.AISamplingChronological:
+		selected := make([]int, 0, limit)
+		for n := 0; n < limit; n++ {
+			selected = append(selected, candidates[n*len(candidates)/limit])
+		}
+		return selected
+
+	default:
+		ordered := append([]int(nil), candidates...)
+		bySeverity(ordered)
+		return ordered[:limit]
+	}
+}
+
+// compactEvent keeps the fields useful for analysis and truncates long values
+func (in *analysisInput) compactEvent(event models.TelemetryEvent) map[string]interface{} {
+	compact := map[string]interface{}{
+		"time":     event.Timestamp.UTC().Format(time.RFC3339),
+		"type":     event.EventType,
+		"severity": eventSeverityName(event.Severity),
+		"host":     in.field("host", event.Hostname),
+	}
+	optional := map[string]string{
+		"mitre":   event.MitreTechnique,
+		"tactic":  event.MitreTactic,
+		"process": event.ProcessName,
+		"path":    event.FilePath,
+		"dst_ip":  event.DstIP,
+		"user":    event.Username,
+	}
+	for key, value := range optional {
+		if value != "" {
+			compact[key] = in.field(key, value)
+		}
+	}
+
+	if len(event.Payload) > 0 {
+		payload := make(map[string]interface{})
+		for key, value := range event.Payload {
+			if aiDroppedPayloadKeys[key] || value == nil {
+				continue
+			}
+			if in.redactFields[key] {
+				payload[key] = in.field(key, "")
+				continue
+			}
+			switch v := value.(type) {
+			case string:
+				if v != "" {
+					payload[key] = in.truncate(v)
+				}
+			case bool, float64:
+				payload[key] = v
+			default:
+				encoded, err := json.Marshal(v)
+				if err != nil {
+					continue
+				}
+				if len(encoded) > in.maxFieldLength {
+					payload[key] = in.truncate(string(encoded))
+				} else {
+					payload[key] = v
+				}
+			}
+		}
+		if len(payload) > 0 {
+			compact["payload"] = payload
+		}
+	}
+
+	return compact
+}
+
+// field renders an event field, masking it when a guardrail redacts the field
+func (in *analysisInput) field(name, value string) string {
+	if !in.redactFields[name] {
+		return in.truncate(value)
+	}
+	in.redactions[name]++
+	return aiRedactedValue
+}
+
+func (in *analysisInput) truncate(value string) string {
+	if len(value) <= in.maxFieldLength {
+		return value
+	}
+	return value[:in.maxFieldLength] + "...(truncated)"
+}
+
+// promptContext renders the reduced events for inclusion in the prompt
+func (in *analysisInput) promptContext() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Events shown in full (%d, one compact JSON object per line, oldest first):\n", len(in.included))
+	for _, i := range in.included {
+		line, err := json.Marshal(in.compactEvent(in.events[i]))
+		if err != nil {
+			continue
+		}
+		b.Write(line)
+		b.WriteString("\n")
+	}
+
+	if len(in.groups) > 0 {
+		b.WriteString("\nRepeated activity (summarized, one representative may appear above):\n")
+		for _, group := range in.groups {
+			fields := make([]string, 0, 6)
+			for _, field := range [][2]string{
+				{"process", group.processName}, {"path", group.filePath}, {"dst_ip", group.dstIP},
+				{"user", group.username}, {"mitre", group.technique},
+			} {
+				if field[1] != "" {
+					fields = append(fields, field[0]+"="+in.field(field[0], field[1]))
+				}
+			}
+			fmt.Fprintf(&b, "- %dx %s on %s [%s] first %s, last %s, max severity %s\n",
+				group.count, group.eventType, in.field("host", group.hostname), strings.Join(fields, ", "),
+				group.first.UTC().Format(time.RFC3339), group.last.UTC().Format(time.RFC3339),
+				eventSeverityName(group.maxSeverity))
+		}
+	}
+
+	if len(in.omitted) > 0 {
+		types := make([]string, 0, len(in.omitted))
+		for eventType := range in.omitted {
+			types = append(types, eventType)
+		}
+		sort.Strings(types)
+		counts := make([]string, 0, len(types))
+		for _, eventType := range types {
+			counts = append(counts, fmt.Sprintf("%s=%d", eventType, in.omitted[eventType]))
+		}
+		fmt.Fprintf(&b, "\nOther events not shown (counts by type): %s\n", strings.Join(counts, ", "))
+	}
+
+	return b.String()
+}
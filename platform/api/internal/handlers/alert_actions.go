@@ -0,0 +1,573 @@
+// Alert Rule Actions
+// Validates alert rule actions and runs them when a rule fires, auditing every execution
+
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// Parameters of each action type; unknown parameters are rejected so typos do not silently
+// fall back to defaults
+type notifyActionParams struct {
+	ChannelIDs []string `json:"channel_ids"`
+	Priority   string   `json:"priority"`
+}
+
+type createCaseActionParams struct {
+	Title    string `json:"title"`
+	Severity string `json:"severity"`
+	Owner    string `json:"owner"`
+}
+
+type isolateHostActionParams struct {
+	AllowIPs []string `json:"allow_ips"`
+}
+
+type runPlaybookActionParams struct {
+	PlaybookID string `json:"playbook_id"`
+}
+
+// decodeAlertAction parses one raw action and its type's parameters
+func decodeAlertAction(raw map[string]interface{}) (models.AlertAction, interface{}, error) {
+	var action models.AlertAction
+	data, _ := json.Marshal(raw)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&action); err != nil {
+		return action, nil, fmt.Errorf("is not a valid action: %v", err)
+	}
+
+	var params interface{}
+	switch action.Type {
+	case models.AlertActionNotify:
+		params = &notifyActionParams{}
+	case models.AlertActionCreateCase:
+		params = &createCaseActionParams{}
+	case models.AlertActionIsolateHost:
+		params = &isolateHostActionParams{}
+	case models.AlertActionRunPlaybook:
+		params = &runPlaybookActionParams{}
+	default:
+		return action, nil, fmt.Errorf("type must be one of notify, create_case, isolate_host, run_playbook")
+	}
+
+	data, _ = json.Marshal(action.Parameters)
+	decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(params); err != nil {
+		return action, nil, fmt.Errorf("has invalid parameters for %s: %v", action.Type, err)
+	}
+
+	switch p := params.(type) {
+	case *createCaseActionParams:
+		if p.Severity != "" && !isValidCaseSeverity(p.Severity) {
+			return action, nil, fmt.Errorf("severity must be low, medium, high or critical")
+		}
+	case *isolateHostActionParams:
+		for _, allowed := range p.AllowIPs {
+			if net.ParseIP(allowed) == nil {
+				if _, _, err := net.ParseCIDR(allowed); err != nil {
+					return action, nil, fmt.Errorf("allow_ips entry %q is not an IP address or CIDR", allowed)
+				}
+			}
+		}
+	case *runPlaybookActionParams:
+		if _, err := uuid.Parse(p.PlaybookID); err != nil {
+			return action, nil, fmt.Errorf("playbook_id must be a playbook ID")
+		}
+	}
+	return action, params, nil
+}
+
+// validateAlertRuleActions checks every action of a rule, keyed by its position
+func validateAlertRuleActions(actions []map[string]interface{}) map[string]string {
+	fields := map[string]string{}
+	if len(actions) > models.MaxAlertRuleActions {
+		fields["actions"] = fmt.Sprintf("must have at most %d actions", models.MaxAlertRuleActions)
+		return fields
+	}
+	for i, raw := range actions {
+		if _, _, err := decodeAlertAction(raw); err != nil {
+			fields[fmt.Sprintf("actions[%d]", i)] = err.Error()
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// alertRuleIsolates reports whether any of a rule's actions isolates a host
+func alertRuleIsolates(actions []map[string]interface{}) bool {
+	for _, raw := range actions {
+		if action, _, err := decodeAlertAction(raw); err == nil && action.Type == models.AlertActionIsolateHost {
+			return true
+		}
+	}
+	return false
+}
+
+// firedAlert is an alert instance that has just been raised
+type firedAlert struct {
+	id        string
+	ruleID    string
+	licenseID string
+	severity  string
+	message   string
+	agentID   string // Telemetry agent ID, when the alert concerns a single agent
+	hostname  string
+}
+
+// AlertActionExecutor runs the actions of the rule behind a fired alert
+type AlertActionExecutor struct {
+	db       *sql.DB
+	notifier *NotificationHandler
+}
+
+// NewAlertActionExecutor creates an alert action executor
+func NewAlertActionExecutor(db *sql.DB) *AlertActionExecutor {
+	return &AlertActionExecutor{db: db, notifier: NewNotificationHandler(db)}
+}
+
+// Execute runs the rule's actions in order and records each outcome. A failed action is logged
+// and audited, and the remaining actions still run unless it set stop_on_failure.
+func (e *AlertActionExecutor) Execute(alert firedAlert) []models.AlertActionExecution {
+	var actionsJSON []byte
+	if err := e.db.QueryRow("SELECT actions FROM alert_rules WHERE id = $1", alert.ruleID).Scan(&actionsJSON); err != nil {
+		log.Errorf("Failed to load actions of alert rule %s: %v", alert.ruleID, err)
+		return nil
+	}
+	var actions []map[string]interface{}
+	if err := json.Unmarshal(actionsJSON, &actions); err != nil {
+		log.Errorf("Invalid actions on alert rule %s: %v", alert.ruleID, err)
+		return nil
+	}
+
+	executions := make([]models.AlertActionExecution, 0, len(actions))
+	stopped := -1
+	for i, raw := range actions {
+		execution := models.AlertActionExecution{
+			ID:          uuid.New().String(),
+			AlertID:     alert.id,
+			RuleID:      alert.ruleID,
+			ActionIndex: i,
+			ExecutedAt:  time.Now().UTC(),
+		}
+
+		action, params, err := decodeAlertAction(raw)
+		execution.ActionType = action.Type
+		switch {
+		case stopped >= 0:
+			execution.Status = models.AlertActionSkipped
+			execution.Error = fmt.Sprintf("action %d failed and stops the rule", stopped)
+		case err != nil:
+			// Rules saved before actions were validated may hold anything
+			execution.Status = models.AlertActionFailed
+			execution.Error = "action " + err.Error()
+		default:
+			execution.Result, err = e.dispatch(alert, params)
+			if err == errAlertActionSkipped {
+				execution.Status = models.AlertActionSkipped
+				execution.Error = execution.Result["reason"].(string)
+			} else if err != nil {
+				execution.Status = models.AlertActionFailed
+				execution.Error = err.Error()
+			} else {
+				execution.Status = models.AlertActionSucceeded
+			}
+		}
+
+		if execution.Status == models.AlertActionFailed {
+			log.Warnf("Alert %s action %d (%s) failed: %s", alert.id, i, execution.ActionType, execution.Error)
+			if action.StopOnFailure && stopped < 0 {
+				stopped = i
+			}
+		}
+		e.audit(execution)
+		executions = append(executions, execution)
+	}
+	return executions
+}
+
+// errAlertActionSkipped marks an action that did not apply to the alert; the result's "reason"
+// says why
+var errAlertActionSkipped = errors.New("action skipped")
+
+func (e *AlertActionExecutor) dispatch(alert firedAlert, params interface{}) (map[string]interface{}, error) {
+	switch p := params.(type) {
+	case *notifyActionParams:
+		return e.notify(alert, *p)
+	case *createCaseActionParams:
+		return e.createCase(alert, *p)
+	case *isolateHostActionParams:
+		return e.isolateHost(alert, *p)
+	case *runPlaybookActionParams:
+		return e.runPlaybook(alert, *p)
+	}
+	return nil, fmt.Errorf("unsupported action")
+}
+
+func (e *AlertActionExecutor) notify(alert firedAlert, params notifyActionParams) (map[string]interface{}, error) {
+	priority := params.Priority
+	if priority == "" {
+		priority = alert.severity
+	}
+	subject := "Privé alert: " + alert.message
+	metadata := map[string]interface{}{"alert_id": alert.id, "rule_id": alert.ruleID, "source": "alert_action"}
+
+	if len(params.ChannelIDs) == 0 {
+		sent := e.notifier.NotifyLicense(alert.licenseID, subject, alert.message, priority, metadata)
+		if sent == 0 {
+			return nil, fmt.Errorf("no notification channel accepted the alert")
+		}
+		return map[string]interface{}{"sent": sent}, nil
+	}
+
+	missing, err := e.notifier.missingChannels(alert.licenseID, params.ChannelIDs)
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]string{}
+	for _, channelID := range params.ChannelIDs {
+		if containsString(missing, channelID) {
+			failed[channelID] = "not a channel of the license"
+			continue
+		}
+		if err := e.notifier.deliverToChannel(channelID, subject, alert.message, alert.message, priority, nil, metadata); err != nil {
+			failed[channelID] = err.Error()
+		}
+	}
+	result := map[string]interface{}{"sent": len(params.ChannelIDs) - len(failed)}
+	if len(failed) > 0 {
+		result["failed"] = failed
+	}
+	if len(failed) == len(params.ChannelIDs) {
+		return result, fmt.Errorf("delivery failed on every channel")
+	}
+	return result, nil
+}
+
+func (e *AlertActionExecutor) createCase(alert firedAlert, params createCaseActionParams) (map[string]interface{}, error) {
+	title := params.Title
+	if title == "" {
+		title = "Alert: " + alert.message
+	}
+	if utf8.RuneCountInString(title) > 255 {
+		title = string([]rune(title)[:255])
+	}
+	severity := params.Severity
+	if severity == "" {
+		severity = alert.severity
+	}
+	if !isValidCaseSeverity(severity) {
+		severity = "medium"
+	}
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	caseID := uuid.New().String()
+	if _, err := tx.Exec(`
+		INSERT INTO cases (id, license_id, title, description, status, severity, owner, created_by)
+		VALUES ($1, $2, $3, $4, 'open', $5, $6, 'alert-rule')
+	`, caseID, alert.licenseID, title, "Opened automatically when an alert rule fired: "+alert.message, severity, nullIfEmpty(params.Owner)); err != nil {
+		return nil, fmt.Errorf("failed to create case: %w", err)
+	}
+	if _, err := insertCaseItem(tx, caseID, models.AttachCaseItemRequest{
+		ItemType: models.CaseItemAlert,
+		ItemID:   alert.id,
+		Summary:  alert.message,
+		AddedBy:  "alert-rule",
+	}); err != nil {
+		return nil, fmt.Errorf("failed to attach alert: %w", err)
+	}
+	if err := insertCaseNote(tx, caseID, "status_change", "alert-rule", "Case opened by alert rule action"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	broadcastCaseUpdate(alert.licenseID, caseID, "created", "alert-rule", "Case opened: "+title)
+	return map[string]interface{}{"case_id": caseID}, nil
+}
+
+func (e *AlertActionExecutor) isolateHost(alert firedAlert, params isolateHostActionParams) (map[string]interface{}, error) {
+	agentID, err := e.resolveAgent(alert)
+	if err != nil {
+		return nil, err
+	}
+	if agentID == "" {
+		return map[string]interface{}{"reason": "the alert does not identify a single enrolled host"}, errAlertActionSkipped
+	}
+
+	commandParams := map[string]interface{}{"alert_id": alert.id}
+	if len(params.AllowIPs) > 0 {
+		commandParams["allow_ips"] = params.AllowIPs
+	}
+	commandID, queued, err := queueAgentCommand(e.db, agentID, models.AgentCommandIsolate, commandParams, "alert_rule:"+alert.ruleID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"agent_id": agentID, "command_id": commandID, "already_queued": !queued}, nil
+}
+
+// resolveAgent returns the agents row ID for the alert's agent, or its hostname when that is
+// all the alert carries
+func (e *AlertActionExecutor) resolveAgent(alert firedAlert) (string, error) {
+	var id string
+	var err error
+	switch {
+	case alert.agentID != "":
+		err = e.db.QueryRow(`
+			SELECT id FROM agents
+			WHERE license_id = $1 AND agent_id = $2 AND deleted_at IS NULL
+		`, alert.licenseID, alert.agentID).Scan(&id)
+	case alert.hostname != "":
+		// Hostnames are not unique; isolating the wrong host is worse than not isolating
+		rows, err := e.db.Query(`
+			SELECT id FROM agents
+			WHERE license_id = $1 AND LOWER(hostname) = LOWER($2) AND deleted_at IS NULL
+			LIMIT 2
+		`, alert.licenseID, alert.hostname)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+		ids := []string{}
+		for rows.Next() {
+			if err := rows.Scan(&id); err != nil {
+				return "", err
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) != 1 {
+			return "", rows.Err()
+		}
+		return ids[0], rows.Err()
+	default:
+		return "", nil
+	}
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// queueAgentCommand queues a command for an agent unless the same command is already pending.
+// It returns the command ID and whether a new command was queued.
+func queueAgentCommand(db *sql.DB, agentID, commandType string, params map[string]interface{}, source string) (string, bool, error) {
+	var existing string
+	err := db.QueryRow(`
+		SELECT id FROM agent_commands
+		WHERE agent_id = $1 AND command_type = $2 AND status = 'pending'
+		LIMIT 1
+	`, agentID, commandType).Scan(&existing)
+	if err == nil {
+		return existing, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", false, err
+	}
+
+	paramsJSON, _ := json.Marshal(params)
+	commandID := uuid.New().String()
+	_, err = db.Exec(`
+		INSERT INTO agent_commands (id, agent_id, command_type, parameters, source)
+		VALUES ($1, $2, $3, $4, $5)
+	`, commandID, agentID, commandType, paramsJSON, source)
+	if err != nil {
+		return "", false, err
+	}
+	log.Warnf("Queued %s command %s for agent %s (%s)", commandType, commandID, agentID, source)
+	return commandID, true, nil
+}
+
+// takePendingCommands returns an agent's pending commands, oldest first, and marks them delivered
+func (h *AgentHandler) takePendingCommands(agentID string) ([]models.AgentCommand, error) {
+	rows, err := h.db.Query(`
+		UPDATE agent_commands SET status = 'delivered', delivered_at = NOW()
+		WHERE status = 'pending' AND agent_id = (SELECT id FROM agents WHERE agent_id = $1 AND deleted_at IS NULL)
+		RETURNING id, command_type, parameters, source, created_at
+	`, agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []models.AgentCommand{}
+	for rows.Next() {
+		var command models.AgentCommand
+		var paramsJSON []byte
+		if err := rows.Scan(&command.ID, &command.CommandType, &paramsJSON, &command.Source, &command.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal(paramsJSON, &command.Parameters)
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].CreatedAt.Before(commands[j].CreatedAt) })
+	return commands, rows.Err()
+}
+
+func (e *AlertActionExecutor) runPlaybook(alert firedAlert, params runPlaybookActionParams) (map[string]interface{}, error) {
+	playbook, err := loadDeceptionPlaybook(e.db, alert.licenseID, params.PlaybookID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("playbook %s not found", params.PlaybookID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !playbook.Enabled {
+		return map[string]interface{}{"reason": "playbook " + playbook.Name + " is disabled"}, errAlertActionSkipped
+	}
+
+	// Playbook steps map onto the same actions; run_playbook itself is not a step, so
+	// playbooks cannot recurse
+	steps := []map[string]interface{}{}
+	var failures []string
+	for _, step := range playbook.Actions {
+		var outcome map[string]interface{}
+		var stepErr error
+		switch step.ActionType {
+		case "send_alert", models.AlertActionNotify:
+			outcome, stepErr = e.notify(alert, notifyActionParams{Priority: alert.severity})
+		case "quarantine_host", models.AlertActionIsolateHost:
+			outcome, stepErr = e.isolateHost(alert, isolateHostActionParams{AllowIPs: playbookStrings(step.Parameters, "allow_ips")})
+		case models.AlertActionCreateCase:
+			outcome, stepErr = e.createCase(alert, createCaseActionParams{Title: "Playbook " + playbook.Name + ": " + alert.message})
+		case "block_ip":
+			outcome, stepErr = e.blockIP(alert, step.Parameters)
+		default:
+			stepErr = fmt.Errorf("unsupported playbook action %q", step.ActionType)
+		}
+
+		status := models.AlertActionSucceeded
+		entry := map[string]interface{}{"action_type": step.ActionType}
+		if stepErr == errAlertActionSkipped {
+			status = models.AlertActionSkipped
+		} else if stepErr != nil {
+			status = models.AlertActionFailed
+			entry["error"] = stepErr.Error()
+			failures = append(failures, step.ActionType)
+		}
+		entry["status"] = status
+		if outcome != nil {
+			entry["result"] = outcome
+		}
+		steps = append(steps, entry)
+	}
+
+	e.db.Exec(`
+		UPDATE deception_playbooks SET execution_count = execution_count + 1, last_executed = NOW()
+		WHERE id = $1
+	`, playbook.ID)
+
+	result := map[string]interface{}{"playbook_id": playbook.ID, "steps": steps}
+	if len(failures) > 0 {
+		return result, fmt.Errorf("playbook steps failed: %s", strings.Join(failures, ", "))
+	}
+	return result, nil
+}
+
+// blockIP queues a block for the IP named by the playbook step on the alert's host
+func (e *AlertActionExecutor) blockIP(alert firedAlert, params map[string]interface{}) (map[string]interface{}, error) {
+	ip, _ := params["ip"].(string)
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("block_ip needs an ip parameter")
+	}
+	agentID, err := e.resolveAgent(alert)
+	if err != nil {
+		return nil, err
+	}
+	if agentID == "" {
+		return map[string]interface{}{"reason": "the alert does not identify a single enrolled host"}, errAlertActionSkipped
+	}
+	commandID, queued, err := queueAgentCommand(e.db, agentID, models.AgentCommandBlockIP, map[string]interface{}{"ip": ip, "alert_id": alert.id}, "alert_rule:"+alert.ruleID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"agent_id": agentID, "command_id": commandID, "already_queued": !queued}, nil
+}
+
+// playbookStrings reads a list of strings from playbook step parameters
+func playbookStrings(params map[string]interface{}, key string) []string {
+	raw, _ := params[key].([]interface{})
+	values := make([]string, 0, len(raw))
+	for _, value := range raw {
+		if s, ok := value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// audit records one action execution
+func (e *AlertActionExecutor) audit(execution models.AlertActionExecution) {
+	resultJSON, _ := json.Marshal(execution.Result)
+	_, err := e.db.Exec(`
+		INSERT INTO alert_action_executions (id, alert_id, rule_id, action_index, action_type, status, result, error, executed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, execution.ID, execution.AlertID, execution.RuleID, execution.ActionIndex, nullIfEmpty(execution.ActionType),
+		execution.Status, resultJSON, nullIfEmpty(execution.Error), execution.ExecutedAt)
+	if err != nil {
+		log.Errorf("Failed to audit alert action execution: %v", err)
+	}
+}
+
+// ListAlertActionExecutions returns the action audit trail of an alert
+func (h *TelemetryHandler) ListAlertActionExecutions(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT id, alert_id, rule_id, action_index, COALESCE(action_type, ''), status, result, COALESCE(error, ''), executed_at
+		FROM alert_action_executions
+		WHERE alert_id = $1
+		  AND ($2 = '' OR alert_id IN (
+		      SELECT a.id FROM alert_instances a JOIN alert_rules r ON r.id = a.rule_id
+		      WHERE a.id = $1 AND r.license_id::text = $2
+		  ))
+		ORDER BY executed_at ASC, action_index ASC
+	`, c.Param("id"), principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to list alert action executions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list alert actions"})
+		return
+	}
+	defer rows.Close()
+
+	executions := []models.AlertActionExecution{}
+	for rows.Next() {
+		var execution models.AlertActionExecution
+		var resultJSON []byte
+		if err := rows.Scan(&execution.ID, &execution.AlertID, &execution.RuleID, &execution.ActionIndex,
+			&execution.ActionType, &execution.Status, &resultJSON, &execution.Error, &execution.ExecutedAt); err != nil {
+			log.Errorf("Failed to scan alert action execution: %v", err)
+			continue
+		}
+		json.Unmarshal(resultJSON, &execution.Result)
+		executions = append(executions, execution)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": executions,
+		"count": len(executions),
+	})
+}
@@ -0,0 +1,334 @@
+// Alert Suppressions
+// False-positive suppression of specific rule and entity combinations, with an audit trail
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const suppressionColumns = `s.id, s.license_id, s.rule_id, r.name, s.entity_type, s.entity_value, s.reason,
+	COALESCE(s.created_by, ''), s.expires_at, s.suppressed_count, s.last_suppressed_at, s.removed_at,
+	COALESCE(s.removed_by, ''), s.created_at`
+
+// AlertSuppressionHandler handles alert suppressions
+type AlertSuppressionHandler struct {
+	db *sql.DB
+}
+
+// NewAlertSuppressionHandler creates a new alert suppression handler
+func NewAlertSuppressionHandler(db *sql.DB) *AlertSuppressionHandler {
+	return &AlertSuppressionHandler{db: db}
+}
+
+// ListSuppressions lists a license's suppressions. Removed and expired entries are included
+// with include_inactive=true.
+func (h *AlertSuppressionHandler) ListSuppressions(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := `SELECT ` + suppressionColumns + `
+		FROM alert_suppressions s
+		JOIN alert_rules r ON r.id = s.rule_id
+		WHERE s.license_id = $1`
+	args := []interface{}{licenseID}
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query += " AND s.rule_id = $2"
+		args = append(args, ruleID)
+	}
+	if c.Query("include_inactive") != "true" {
+		query += " AND s.removed_at IS NULL AND (s.expires_at IS NULL OR s.expires_at > NOW())"
+	}
+	query += " ORDER BY s.created_at DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list alert suppressions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list suppressions"})
+		return
+	}
+	defer rows.Close()
+
+	suppressions := []models.AlertSuppression{}
+	for rows.Next() {
+		s, err := scanSuppression(rows)
+		if err != nil {
+			log.Errorf("Failed to scan alert suppression: %v", err)
+			continue
+		}
+		suppressions = append(suppressions, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": suppressions, "count": len(suppressions)})
+}
+
+// CreateSuppression suppresses a rule for an entity
+func (h *AlertSuppressionHandler) CreateSuppression(c *gin.Context) {
+	var req models.CreateSuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if !containsString(models.SuppressionEntityTypes, req.EntityType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entity_type", "entity_types": models.SuppressionEntityTypes})
+		return
+	}
+	req.EntityValue = strings.TrimSpace(req.EntityValue)
+	if req.EntityValue == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entity_value must not be empty"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create suppression"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The rule must belong to the license the suppression is created for
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO alert_suppressions (license_id, rule_id, entity_type, entity_value, reason, created_by, expires_at)
+		SELECT r.license_id, r.id, $3, $4, $5, NULLIF($6, ''), $7
+		FROM alert_rules r
+		WHERE r.id = $1 AND r.license_id = $2
+		RETURNING id
+	`, req.RuleID, req.LicenseID, req.EntityType, req.EntityValue, req.Reason, req.CreatedBy, req.ExpiresAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "An active suppression already exists for this rule and entity"})
+			return
+		}
+		log.Errorf("Failed to create alert suppression: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create suppression"})
+		return
+	}
+
+	if err := insertSuppressionAudit(tx, id, models.SuppressionActionCreated, req.CreatedBy, map[string]interface{}{
+		"rule_id":      req.RuleID,
+		"entity_type":  req.EntityType,
+		"entity_value": req.EntityValue,
+		"reason":       req.Reason,
+		"expires_at":   req.ExpiresAt,
+	}); err != nil {
+		log.Errorf("Failed to record suppression audit entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create suppression"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit alert suppression: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create suppression"})
+		return
+	}
+
+	suppression, err := h.load(id, "")
+	if err != nil {
+		log.Errorf("Failed to load alert suppression: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load suppression"})
+		return
+	}
+
+	log.Infof("Alert rule %s suppressed for %s %s: %s", req.RuleID, req.EntityType, req.EntityValue, req.Reason)
+	c.JSON(http.StatusCreated, suppression)
+}
+
+// RemoveSuppression ends a suppression. The entry is kept, marked removed, for the audit trail.
+func (h *AlertSuppressionHandler) RemoveSuppression(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.RemoveSuppressionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove suppression"})
+		return
+	}
+	defer tx.Rollback()
+
+	var suppressedCount int64
+	err = tx.QueryRow(`
+		UPDATE alert_suppressions SET removed_at = NOW(), removed_by = NULLIF($2, '')
+		WHERE id = $1 AND removed_at IS NULL AND ($3 = '' OR license_id::text = $3)
+		RETURNING suppressed_count
+	`, id, req.RemovedBy, principalLicense(c)).Scan(&suppressedCount)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suppression not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to remove alert suppression: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove suppression"})
+		return
+	}
+
+	if err := insertSuppressionAudit(tx, id, models.SuppressionActionRemoved, req.RemovedBy, map[string]interface{}{
+		"reason":           req.Reason,
+		"suppressed_count": suppressedCount,
+	}); err != nil {
+		log.Errorf("Failed to record suppression audit entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove suppression"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit alert suppression removal: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove suppression"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Suppression removed successfully", "suppressed_count": suppressedCount})
+}
+
+// GetSuppressionAudit returns the audit trail of a suppression
+func (h *AlertSuppressionHandler) GetSuppressionAudit(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.load(id, principalLicense(c)); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suppression not found"})
+		return
+	} else if err != nil {
+		log.Errorf("Failed to load alert suppression: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load suppression"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, suppression_id, action, COALESCE(performed_by, ''), details, created_at
+		FROM alert_suppression_audit
+		WHERE suppression_id = $1
+		ORDER BY created_at ASC
+	`, id)
+	if err != nil {
+		log.Errorf("Failed to load suppression audit trail: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit trail"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.SuppressionAuditEntry{}
+	for rows.Next() {
+		var entry models.SuppressionAuditEntry
+		var details []byte
+		if err := rows.Scan(&entry.ID, &entry.SuppressionID, &entry.Action, &entry.PerformedBy, &details, &entry.CreatedAt); err != nil {
+			log.Errorf("Failed to scan suppression audit entry: %v", err)
+			continue
+		}
+		if len(details) > 0 {
+			json.Unmarshal(details, &entry.Details)
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": entries, "count": len(entries)})
+}
+
+// load fetches a suppression, confined to licenseID unless it is empty
+func (h *AlertSuppressionHandler) load(id, licenseID string) (models.AlertSuppression, error) {
+	return scanSuppression(h.db.QueryRow(`SELECT `+suppressionColumns+`
+		FROM alert_suppressions s
+		JOIN alert_rules r ON r.id = s.rule_id
+		WHERE s.id = $1 AND ($2 = '' OR s.license_id::text = $2)`, id, licenseID))
+}
+
+func scanSuppression(row rowScanner) (models.AlertSuppression, error) {
+	var s models.AlertSuppression
+	var expiresAt, lastSuppressedAt, removedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.LicenseID, &s.RuleID, &s.RuleName, &s.EntityType, &s.EntityValue, &s.Reason,
+		&s.CreatedBy, &expiresAt, &s.SuppressedCount, &lastSuppressedAt, &removedAt, &s.RemovedBy, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	if expiresAt.Valid {
+		s.ExpiresAt = &expiresAt.Time
+	}
+	if lastSuppressedAt.Valid {
+		s.LastSuppressedAt = &lastSuppressedAt.Time
+	}
+	if removedAt.Valid {
+		s.RemovedAt = &removedAt.Time
+	}
+	s.Active = !removedAt.Valid && (!expiresAt.Valid || expiresAt.Time.After(time.Now()))
+	return s, nil
+}
+
+func insertSuppressionAudit(db sqlExecer, suppressionID, action, performedBy string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO alert_suppression_audit (suppression_id, action, performed_by, details)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+	`, suppressionID, action, performedBy, detailsJSON)
+	return err
+}
+
+// suppressAlert checks whether an alert the rule is about to raise is suppressed for any of its
+// entities (entity type -> value). A match is counted against the suppression and its ID
+// returned; alert evaluation must then drop the alert.
+func suppressAlert(db *sql.DB, ruleID string, entities map[string]string) (string, bool) {
+	types := make([]string, 0, len(entities))
+	values := make([]string, 0, len(entities))
+	for entityType, value := range entities {
+		if value != "" {
+			types = append(types, entityType)
+			values = append(values, value)
+		}
+	}
+	if len(types) == 0 {
+		return "", false
+	}
+
+	var id string
+	err := db.QueryRow(`
+		UPDATE alert_suppressions
+		SET suppressed_count = suppressed_count + 1, last_suppressed_at = NOW()
+		WHERE id = (
+			SELECT id FROM alert_suppressions
+			WHERE rule_id = $1 AND removed_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > NOW())
+			  AND (entity_type, lower(entity_value)) IN (
+			      SELECT t, lower(v) FROM unnest($2::text[], $3::text[]) AS e(t, v))
+			ORDER BY created_at ASC
+			LIMIT 1
+		)
+		RETURNING id
+	`, ruleID, pq.Array(types), pq.Array(values)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", false
+	}
+	if err != nil {
+		// Fail open: a broken suppression lookup must not hide alerts
+		log.Errorf("Failed to check alert suppressions: %v", err)
+		return "", false
+	}
+	return id, true
+}
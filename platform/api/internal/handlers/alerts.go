@@ -0,0 +1,766 @@
+// Alert Triage
+// Persisted alert instances: grouped listing, lifecycle, assignment and notes
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// defaultAlertDays is the window listed when start_time is not given
+	defaultAlertDays = 7
+
+	// maxAlertGroupIDs bounds the alert IDs returned per group
+	maxAlertGroupIDs = 10
+
+	// maxAlertGroupEntities bounds each affected-entity list of a group
+	maxAlertGroupEntities = 20
+)
+
+// alertGroupExpr maps grouping dimensions to the SQL expression extracting them from an alert
+var alertGroupExpr = map[string]string{
+	models.AlertGroupRule:         "a.rule_id::text",
+	models.AlertGroupEntity:       "NULLIF(a.entity_type || ':' || a.entity_value, ':')",
+	models.AlertGroupCorrelation:  "ci.case_id::text",
+	models.CorrelationEntityAgent: correlationEntityExpr[models.CorrelationEntityAgent],
+	models.CorrelationEntityHost:  correlationEntityExpr[models.CorrelationEntityHost],
+	models.CorrelationEntityIP:    correlationEntityExpr[models.CorrelationEntityIP],
+	models.CorrelationEntityUser:  correlationEntityExpr[models.CorrelationEntityUser],
+}
+
+// alertSeverityExpr ranks an alert's severity like severityRank, for taking a group's highest
+const alertSeverityExpr = `CASE a.severity WHEN 'critical' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END`
+
+// alertCaseJoin finds the case an alert was correlated or added into
+const alertCaseJoin = `
+		LEFT JOIN LATERAL (
+			SELECT case_id FROM case_items
+			WHERE item_type = 'alert' AND item_id = a.id::text
+			ORDER BY added_at ASC
+			LIMIT 1
+		) ci ON TRUE`
+
+// alertTransition is a lifecycle action: the statuses it may start from, the status it leads to
+// and the columns it sets ($3 is the acting user, $4 the resolution, $5 the created suppression)
+type alertTransition struct {
+	from   []string
+	to     string
+	update string
+}
+
+var alertTransitions = map[string]alertTransition{
+	models.AlertActionAcknowledge: {
+		from:   []string{models.AlertStatusNew},
+		to:     models.AlertStatusAcknowledged,
+		update: "acknowledged_at = NOW(), acknowledged_by = NULLIF($3, '')",
+	},
+	models.AlertActionResolve: {
+		from:   []string{models.AlertStatusNew, models.AlertStatusAcknowledged},
+		to:     models.AlertStatusResolved,
+		update: "resolved_at = NOW(), resolved_by = NULLIF($3, ''), resolution = NULLIF($4, '')",
+	},
+	models.AlertActionSuppress: {
+		from:   []string{models.AlertStatusNew, models.AlertStatusAcknowledged, models.AlertStatusResolved},
+		to:     models.AlertStatusSuppressed,
+		update: "resolved_at = NOW(), resolved_by = NULLIF($3, ''), resolution = COALESCE(NULLIF($4, ''), resolution), suppression_id = $5::uuid",
+	},
+	models.AlertActionReopen: {
+		from:   []string{models.AlertStatusAcknowledged, models.AlertStatusResolved, models.AlertStatusSuppressed},
+		to:     models.AlertStatusNew,
+		update: "acknowledged_at = NULL, acknowledged_by = NULL, resolved_at = NULL, resolved_by = NULL, resolution = NULL, suppression_id = NULL",
+	},
+}
+
+// AlertHandler serves fired alert instances
+type AlertHandler struct {
+	db *sql.DB
+}
+
+// NewAlertHandler creates a new alert handler
+func NewAlertHandler(db *sql.DB) *AlertHandler {
+	return &AlertHandler{db: db}
+}
+
+// ListAlerts lists a license's alerts, flat or grouped.
+// Query: license_id (required), status, severity and rule_id (comma-separated), assigned_to,
+// start_time and end_time (RFC3339, default the last 7 days), group_by (comma-separated rule,
+// entity, agent, host, ip, user or correlation), limit.
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	endTime := time.Now().UTC()
+	if v := c.Query("end_time"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time format, use RFC3339"})
+			return
+		}
+		endTime = parsed
+	}
+	startTime := endTime.AddDate(0, 0, -defaultAlertDays)
+	if v := c.Query("start_time"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time format, use RFC3339"})
+			return
+		}
+		startTime = parsed
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	where := " WHERE r.license_id = $1 AND a.created_at >= $2 AND a.created_at <= $3"
+	args := []interface{}{licenseID, startTime, endTime}
+
+	if statuses := splitQueryList(c.Query("status")); len(statuses) > 0 {
+		for _, status := range statuses {
+			if !containsString(models.AlertStatuses, status) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status %q; use %s", status, strings.Join(models.AlertStatuses, ", "))})
+				return
+			}
+		}
+		args = append(args, pq.Array(statuses))
+		where += fmt.Sprintf(" AND a.status = ANY($%d)", len(args))
+	}
+	if severities := splitQueryList(strings.ToLower(c.Query("severity"))); len(severities) > 0 {
+		for _, severity := range severities {
+			if _, ok := severityRank[severity]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, medium, high or critical"})
+				return
+			}
+		}
+		args = append(args, pq.Array(severities))
+		where += fmt.Sprintf(" AND a.severity = ANY($%d)", len(args))
+	}
+	if ruleIDs := splitQueryList(c.Query("rule_id")); len(ruleIDs) > 0 {
+		args = append(args, pq.Array(ruleIDs))
+		where += fmt.Sprintf(" AND a.rule_id::text = ANY($%d)", len(args))
+	}
+	if assignedTo := c.Query("assigned_to"); assignedTo != "" {
+		args = append(args, assignedTo)
+		where += fmt.Sprintf(" AND a.assigned_to::text = $%d", len(args))
+	}
+
+	groupBy := splitQueryList(strings.ToLower(c.Query("group_by")))
+	for _, dimension := range groupBy {
+		if _, ok := alertGroupExpr[dimension]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid group_by %q; use rule, entity, agent, host, ip, user or correlation", dimension)})
+			return
+		}
+	}
+
+	if len(groupBy) == 0 {
+		h.listAlertInstances(c, where, args, limit)
+		return
+	}
+	h.listAlertGroups(c, groupBy, where, args, limit)
+}
+
+// listAlertInstances returns the matching alerts, newest first
+func (h *AlertHandler) listAlertInstances(c *gin.Context, where string, args []interface{}, limit int) {
+	args = append(args, limit)
+	rows, err := h.db.Query(`
+		SELECT `+alertInstanceColumns+`
+		FROM alert_instances a
+		JOIN alert_rules r ON a.rule_id = r.id`+alertCaseJoin+where+fmt.Sprintf(`
+		ORDER BY a.created_at DESC
+		LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		log.Errorf("Failed to list alerts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list alerts"})
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.AlertInstance{}
+	for rows.Next() {
+		alert, err := scanAlertInstance(rows)
+		if err != nil {
+			log.Errorf("Failed to scan alert: %v", err)
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": alerts, "count": len(alerts)})
+}
+
+// listAlertGroups aggregates the matching alerts by the grouping dimensions, most recently
+// active group first
+func (h *AlertHandler) listAlertGroups(c *gin.Context, groupBy []string, where string, args []interface{}, limit int) {
+	keyColumns := make([]string, len(groupBy))
+	groupColumns := make([]string, len(groupBy))
+	for i, dimension := range groupBy {
+		keyColumns[i] = fmt.Sprintf("COALESCE(%s, '')", alertGroupExpr[dimension])
+		groupColumns[i] = strconv.Itoa(i + 1)
+	}
+
+	entityAgg := func(expr string) string {
+		return fmt.Sprintf("(ARRAY_AGG(DISTINCT %s) FILTER (WHERE COALESCE(%s, '') <> ''))[1:%d]", expr, expr, maxAlertGroupEntities)
+	}
+
+	args = append(args, limit)
+	rows, err := h.db.Query(`
+		SELECT `+strings.Join(keyColumns, ", ")+`,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE a.status = 'new'),
+		       COUNT(*) FILTER (WHERE a.status = 'acknowledged'),
+		       COUNT(*) FILTER (WHERE a.status = 'resolved'),
+		       COUNT(*) FILTER (WHERE a.status = 'suppressed'),
+		       MAX(`+alertSeverityExpr+`),
+		       MIN(a.created_at), MAX(a.created_at),
+		       (ARRAY_AGG(COALESCE(a.message, '') ORDER BY a.created_at DESC))[1],
+		       CASE WHEN COUNT(DISTINCT r.id) = 1 THEN MAX(r.name) ELSE '' END,
+		       (ARRAY_AGG(a.id::text ORDER BY a.created_at DESC))[1:`+strconv.Itoa(maxAlertGroupIDs)+`],
+		       `+entityAgg(correlationEntityExpr[models.CorrelationEntityAgent])+`,
+		       `+entityAgg(correlationEntityExpr[models.CorrelationEntityHost])+`,
+		       `+entityAgg(correlationEntityExpr[models.CorrelationEntityUser])+`,
+		       `+entityAgg(correlationEntityExpr[models.CorrelationEntityIP])+`
+		FROM alert_instances a
+		JOIN alert_rules r ON a.rule_id = r.id`+alertCaseJoin+where+`
+		GROUP BY `+strings.Join(groupColumns, ", ")+fmt.Sprintf(`
+		ORDER BY MAX(a.created_at) DESC
+		LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		log.Errorf("Failed to group alerts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list alerts"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []models.AlertGroup{}
+	for rows.Next() {
+		keys := make([]string, len(groupBy))
+		var unacknowledged, acknowledged, resolved, suppressed int64
+		var severity int
+		var group models.AlertGroup
+		dest := make([]interface{}, 0, len(groupBy)+16)
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &group.Count, &unacknowledged, &acknowledged, &resolved, &suppressed, &severity,
+			&group.FirstSeen, &group.LatestSeen, &group.LatestMessage, &group.RuleName,
+			pq.Array(&group.LatestAlertIDs), pq.Array(&group.Agents), pq.Array(&group.Hosts),
+			pq.Array(&group.Users), pq.Array(&group.IPs))
+		if err := rows.Scan(dest...); err != nil {
+			log.Errorf("Failed to scan alert group: %v", err)
+			continue
+		}
+
+		group.Key = make(map[string]string, len(groupBy))
+		for i, dimension := range groupBy {
+			group.Key[dimension] = keys[i]
+		}
+		group.Statuses = map[string]int64{
+			models.AlertStatusNew:          unacknowledged,
+			models.AlertStatusAcknowledged: acknowledged,
+			models.AlertStatusResolved:     resolved,
+			models.AlertStatusSuppressed:   suppressed,
+		}
+		group.Severity = "unknown"
+		for name, rank := range severityRank {
+			if rank == severity {
+				group.Severity = name
+			}
+		}
+		group.LatestAlertIDs = nonNilStrings(group.LatestAlertIDs)
+		group.Agents = nonNilStrings(group.Agents)
+		group.Hosts = nonNilStrings(group.Hosts)
+		group.Users = nonNilStrings(group.Users)
+		group.IPs = nonNilStrings(group.IPs)
+		groups = append(groups, group)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": groups, "count": len(groups), "group_by": groupBy})
+}
+
+// GetAlert returns a single alert instance
+func (h *AlertHandler) GetAlert(c *gin.Context) {
+	row := h.db.QueryRow(`
+		SELECT `+alertInstanceColumns+`
+		FROM alert_instances a
+		LEFT JOIN alert_rules r ON a.rule_id = r.id`+alertCaseJoin+`
+		WHERE a.id::text = $1 AND ($2 = '' OR r.license_id::text = $2)
+	`, c.Param("id"), principalLicense(c))
+	alert, err := scanAlertInstance(row)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alert"})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// AcknowledgeAlert marks a new alert as being worked on
+func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
+	h.transition(c, models.AlertActionAcknowledge)
+}
+
+// ResolveAlert closes an alert, optionally recording a resolution
+func (h *AlertHandler) ResolveAlert(c *gin.Context) {
+	h.transition(c, models.AlertActionResolve)
+}
+
+// SuppressAlert closes an alert as noise. With suppress_future the alert's rule is also
+// suppressed for the alert's entity, so the same activity stops raising alerts.
+func (h *AlertHandler) SuppressAlert(c *gin.Context) {
+	h.transition(c, models.AlertActionSuppress)
+}
+
+// ReopenAlert returns an acknowledged or closed alert to new
+func (h *AlertHandler) ReopenAlert(c *gin.Context) {
+	h.transition(c, models.AlertActionReopen)
+}
+
+// transition applies a lifecycle action to an alert and records it in its history
+func (h *AlertHandler) transition(c *gin.Context, action string) {
+	id := c.Param("id")
+	t := alertTransitions[action]
+
+	var req models.AlertTransitionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+	defer tx.Rollback()
+
+	var fromStatus, ruleID, entityType, entityValue string
+	err = tx.QueryRow(`
+		SELECT a.status, COALESCE(a.rule_id::text, ''), COALESCE(a.entity_type, ''), COALESCE(a.entity_value, '')
+		FROM alert_instances a
+		LEFT JOIN alert_rules r ON a.rule_id = r.id
+		WHERE a.id::text = $1 AND ($2 = '' OR r.license_id::text = $2)
+		FOR UPDATE OF a
+	`, id, principalLicense(c)).Scan(&fromStatus, &ruleID, &entityType, &entityValue)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+	if !containsString(t.from, fromStatus) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot %s an alert that is %s", action, fromStatus)})
+		return
+	}
+
+	details := map[string]interface{}{}
+	if req.Resolution != "" && (action == models.AlertActionResolve || action == models.AlertActionSuppress) {
+		details["resolution"] = req.Resolution
+	}
+
+	// Suppressing future alerts silences the rule for the alert's entity
+	var suppressionID string
+	if action == models.AlertActionSuppress && req.SuppressFuture {
+		if ruleID == "" || !containsString(models.SuppressionEntityTypes, entityType) || entityValue == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Alert has no rule and entity to suppress future alerts for"})
+			return
+		}
+		reason := req.Note
+		if reason == "" {
+			reason = "Suppressed from alert " + id
+		}
+		err = tx.QueryRow(`
+			INSERT INTO alert_suppressions (license_id, rule_id, entity_type, entity_value, reason, created_by, expires_at)
+			SELECT r.license_id, r.id, $2, $3, $4, NULLIF($5, ''), $6
+			FROM alert_rules r
+			WHERE r.id::text = $1
+			RETURNING id
+		`, ruleID, entityType, entityValue, reason, req.ChangedBy, req.ExpiresAt).Scan(&suppressionID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				c.JSON(http.StatusConflict, gin.H{"error": "An active suppression already exists for this rule and entity"})
+				return
+			}
+			log.Errorf("Failed to create alert suppression: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+			return
+		}
+		if err := insertSuppressionAudit(tx, suppressionID, models.SuppressionActionCreated, req.ChangedBy, map[string]interface{}{
+			"rule_id":      ruleID,
+			"entity_type":  entityType,
+			"entity_value": entityValue,
+			"reason":       reason,
+			"expires_at":   req.ExpiresAt,
+			"alert_id":     id,
+		}); err != nil {
+			log.Errorf("Failed to record suppression audit entry: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+			return
+		}
+		details["suppression_id"] = suppressionID
+	}
+
+	args := []interface{}{id, t.to}
+	switch action {
+	case models.AlertActionAcknowledge:
+		args = append(args, req.ChangedBy)
+	case models.AlertActionResolve:
+		args = append(args, req.ChangedBy, req.Resolution)
+	case models.AlertActionSuppress:
+		args = append(args, req.ChangedBy, req.Resolution, nullIfEmpty(suppressionID))
+	}
+	if _, err := tx.Exec("UPDATE alert_instances SET status = $2, updated_at = NOW(), "+t.update+" WHERE id::text = $1", args...); err != nil {
+		log.Errorf("Failed to update alert status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+
+	change, err := recordAlertHistory(tx, id, action, fromStatus, t.to, req.ChangedBy, req.Note, details)
+	if err != nil {
+		log.Errorf("Failed to record alert status change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit alert status change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update alert"})
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// AssignAlert assigns an alert to a user, or unassigns it
+func (h *AlertHandler) AssignAlert(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.AssignAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.AssignedTo != "" {
+		if _, err := uuid.Parse(req.AssignedTo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "assigned_to must be a user ID"})
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+		return
+	}
+	defer tx.Rollback()
+
+	var status, previous string
+	err = tx.QueryRow(`
+		SELECT a.status, COALESCE(a.assigned_to::text, '')
+		FROM alert_instances a
+		LEFT JOIN alert_rules r ON a.rule_id = r.id
+		WHERE a.id::text = $1 AND ($2 = '' OR r.license_id::text = $2)
+		FOR UPDATE OF a
+	`, id, principalLicense(c)).Scan(&status, &previous)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+		return
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE alert_instances
+		SET assigned_to = $2::uuid, assigned_at = CASE WHEN $2::uuid IS NULL THEN NULL ELSE NOW() END, updated_at = NOW()
+		WHERE id::text = $1
+	`, id, nullIfEmpty(req.AssignedTo)); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to assign alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+		return
+	}
+
+	change, err := recordAlertHistory(tx, id, models.AlertActionAssign, status, status, req.ChangedBy, "", map[string]interface{}{
+		"assigned_to":          req.AssignedTo,
+		"previous_assigned_to": previous,
+	})
+	if err != nil {
+		log.Errorf("Failed to record alert assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit alert assignment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign alert"})
+		return
+	}
+
+	c.JSON(http.StatusOK, change)
+}
+
+// GetAlertHistory returns the lifecycle of an alert, oldest first
+func (h *AlertHandler) GetAlertHistory(c *gin.Context) {
+	id := c.Param("id")
+	if !h.alertExists(c, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, alert_id, action, COALESCE(from_status, ''), to_status, COALESCE(changed_by, ''),
+		       COALESCE(note, ''), details, changed_at
+		FROM alert_status_history
+		WHERE alert_id::text = $1
+		ORDER BY changed_at ASC
+	`, id)
+	if err != nil {
+		log.Errorf("Failed to list alert history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alert history"})
+		return
+	}
+	defer rows.Close()
+
+	changes := []models.AlertStatusChange{}
+	for rows.Next() {
+		var change models.AlertStatusChange
+		var details []byte
+		if err := rows.Scan(&change.ID, &change.AlertID, &change.Action, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.Note, &details, &change.ChangedAt); err != nil {
+			log.Errorf("Failed to scan alert status change: %v", err)
+			continue
+		}
+		if len(details) > 0 {
+			json.Unmarshal(details, &change.Details)
+		}
+		changes = append(changes, change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": changes, "count": len(changes)})
+}
+
+// ListAlertNotes returns the notes on an alert, oldest first
+func (h *AlertHandler) ListAlertNotes(c *gin.Context) {
+	id := c.Param("id")
+	if !h.alertExists(c, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, alert_id, COALESCE(author, ''), body, created_at
+		FROM alert_notes
+		WHERE alert_id::text = $1
+		ORDER BY created_at ASC
+	`, id)
+	if err != nil {
+		log.Errorf("Failed to list alert notes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list alert notes"})
+		return
+	}
+	defer rows.Close()
+
+	notes := []models.AlertNote{}
+	for rows.Next() {
+		var note models.AlertNote
+		if err := rows.Scan(&note.ID, &note.AlertID, &note.Author, &note.Body, &note.CreatedAt); err != nil {
+			log.Errorf("Failed to scan alert note: %v", err)
+			continue
+		}
+		notes = append(notes, note)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": notes, "count": len(notes)})
+}
+
+// AddAlertNote adds an analyst note to an alert
+func (h *AlertHandler) AddAlertNote(c *gin.Context) {
+	var req models.CreateAlertNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	note := models.AlertNote{Author: req.Author, Body: req.Body}
+	err := h.db.QueryRow(`
+		WITH alert AS (
+			UPDATE alert_instances SET updated_at = NOW()
+			WHERE id::text = $1 AND ($4 = '' OR rule_id IN (SELECT id FROM alert_rules WHERE license_id::text = $4))
+			RETURNING id
+		)
+		INSERT INTO alert_notes (alert_id, author, body)
+		SELECT id, NULLIF($2, ''), $3 FROM alert
+		RETURNING id, alert_id, created_at
+	`, c.Param("id"), req.Author, req.Body, principalLicense(c)).Scan(&note.ID, &note.AlertID, &note.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to add alert note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add alert note"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
+
+// alertExists writes a 404, or a 500 when the lookup fails, unless the alert exists
+// and belongs to the caller's license
+func (h *AlertHandler) alertExists(c *gin.Context, id string) bool {
+	var exists bool
+	if err := h.db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM alert_instances a
+			LEFT JOIN alert_rules r ON a.rule_id = r.id
+			WHERE a.id::text = $1 AND ($2 = '' OR r.license_id::text = $2)
+		)
+	`, id, principalLicense(c)).Scan(&exists); err != nil {
+		log.Errorf("Failed to load alert: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load alert"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+	}
+	return exists
+}
+
+// recordAlertHistory appends a lifecycle action to an alert's history
+func recordAlertHistory(db sqlExecer, alertID, action, fromStatus, toStatus, changedBy, note string, details map[string]interface{}) (models.AlertStatusChange, error) {
+	change := models.AlertStatusChange{
+		AlertID:    alertID,
+		Action:     action,
+		FromStatus: fromStatus,
+		ToStatus:   toStatus,
+		ChangedBy:  changedBy,
+		Note:       note,
+		Details:    details,
+	}
+	var detailsJSON []byte
+	if len(details) > 0 {
+		detailsJSON, _ = json.Marshal(details)
+	}
+	err := db.QueryRow(`
+		INSERT INTO alert_status_history (alert_id, action, from_status, to_status, changed_by, note, details)
+		VALUES ($1::uuid, $2, NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+		RETURNING id, changed_at
+	`, alertID, action, fromStatus, toStatus, changedBy, note, detailsJSON).Scan(&change.ID, &change.ChangedAt)
+	return change, err
+}
+
+// newAlert is an alert about to be raised by a detection source
+type newAlert struct {
+	ruleID      string
+	severity    string
+	message     string
+	entityType  string // One of models.SuppressionEntityTypes, so the alert can be suppressed
+	entityValue string
+	eventIDs    []string
+	details     []byte // JSON
+	source      string // Recorded as the actor of the raised history entry, e.g. watchlist-engine
+}
+
+// raiseAlert persists a fired alert as new, with the raised entry of its history, and returns
+// its ID and creation time
+func raiseAlert(db sqlExecer, alert newAlert) (string, time.Time, error) {
+	var id string
+	var createdAt time.Time
+	err := db.QueryRow(`
+		WITH alert AS (
+			INSERT INTO alert_instances (rule_id, severity, message, entity_type, entity_value, matched_event_ids, details, status)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, 'new')
+			RETURNING id, created_at
+		), history AS (
+			INSERT INTO alert_status_history (alert_id, action, to_status, changed_by, changed_at)
+			SELECT id, 'raised', 'new', NULLIF($8, ''), created_at FROM alert
+		)
+		SELECT id, created_at FROM alert
+	`, alert.ruleID, alert.severity, alert.message, alert.entityType, alert.entityValue,
+		pq.Array(nonNilStrings(alert.eventIDs)), alert.details, alert.source).Scan(&id, &createdAt)
+	return id, createdAt, err
+}
+
+// alertInstanceColumns are the columns scanAlertInstance reads, from alert_instances a,
+// alert_rules r and alertCaseJoin
+const alertInstanceColumns = `a.id, COALESCE(a.rule_id::text, ''), COALESCE(r.name, ''), COALESCE(a.agent_id::text, ''),
+		       COALESCE(a.severity, ''), COALESCE(a.message, ''), COALESCE(a.entity_type, ''), COALESCE(a.entity_value, ''),
+		       a.matched_event_ids, a.details, a.status, COALESCE(a.resolution, ''), COALESCE(a.assigned_to::text, ''),
+		       a.assigned_at, COALESCE(ci.case_id::text, ''), COALESCE(a.suppression_id::text, ''),
+		       (SELECT COUNT(*) FROM alert_notes n WHERE n.alert_id = a.id),
+		       a.created_at, COALESCE(a.updated_at, a.created_at), a.acknowledged_at, COALESCE(a.acknowledged_by, ''),
+		       a.resolved_at, COALESCE(a.resolved_by, '')`
+
+// scanAlertInstance reads one row of alertInstanceColumns
+func scanAlertInstance(row rowScanner) (models.AlertInstance, error) {
+	var alert models.AlertInstance
+	var details []byte
+	var assignedAt, acknowledgedAt, resolvedAt sql.NullTime
+	if err := row.Scan(&alert.ID, &alert.RuleID, &alert.RuleName, &alert.AgentID, &alert.Severity, &alert.Message,
+		&alert.EntityType, &alert.EntityValue, pq.Array(&alert.MatchedEventIDs), &details, &alert.Status,
+		&alert.Resolution, &alert.AssignedTo, &assignedAt, &alert.CaseID, &alert.SuppressionID, &alert.NoteCount,
+		&alert.CreatedAt, &alert.UpdatedAt, &acknowledgedAt, &alert.AcknowledgedBy,
+		&resolvedAt, &alert.ResolvedBy); err != nil {
+		return alert, err
+	}
+	alert.MatchedEventIDs = nonNilStrings(alert.MatchedEventIDs)
+	if assignedAt.Valid {
+		alert.AssignedAt = &assignedAt.Time
+	}
+	if len(details) > 0 {
+		json.Unmarshal(details, &alert.Details)
+	}
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		alert.ResolvedAt = &resolvedAt.Time
+	}
+	return alert, nil
+}
+
+// splitQueryList splits a comma-separated query parameter, dropping empty entries
+func splitQueryList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,358 @@
+// API Key Management
+// Issuance, rotation and revocation of scoped API keys for integrations and service accounts
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const apiKeyColumns = `id, license_id, name, key_prefix, scopes, role, COALESCE(created_by, ''), rotated_from,
+	expires_at, revoked_at, last_used_at, COALESCE(host(last_used_ip), ''), created_at`
+
+// APIKeyHandler handles API key management
+type APIKeyHandler struct {
+	db *sql.DB
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(db *sql.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// CreateAPIKey issues a new key for a license. The key is returned once and only its hash is kept.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if err := validateAPIKeyScopes(c, req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must not be negative"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleReadOnly
+	}
+	req.Role = models.NormalizeRole(req.Role)
+	if !models.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid role %q", req.Role)})
+		return
+	}
+	// A key can only issue keys with its own role or less, unless it is an admin
+	if callerRole := c.GetString(middleware.ContextAPIKeyRole); callerRole != "" && callerRole != models.RoleAdmin &&
+		req.Role != callerRole && req.Role != models.RoleReadOnly {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("cannot grant role %q", req.Role)})
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM licenses WHERE id = $1)", req.LicenseID).Scan(&exists); err != nil {
+		log.Errorf("Failed to look up license: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	apiKey, secret, err := h.issue(h.db, req.LicenseID, req.Name, req.Scopes, req.Role, req.CreatedBy, nil, expiresAt)
+	if err != nil {
+		log.Errorf("Failed to create API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIKeySecretResponse{
+		APIKey:  apiKey,
+		Key:     secret,
+		Message: "API key created successfully; store the key now, it cannot be retrieved again",
+	})
+}
+
+// ListAPIKeys lists the keys of a license, newest first
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE license_id = $1"
+	if c.Query("include_revoked") != "true" {
+		query += " AND revoked_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := h.db.Query(query, licenseID)
+	if err != nil {
+		log.Errorf("Failed to list API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// GetAPIKey returns a key's metadata, including when it was last used
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	key, err := h.load(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// RotateAPIKey issues a replacement with the same name and scopes. The old key stays valid for
+// grace_minutes so clients can switch over, or is revoked immediately when that is 0.
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	var req models.RotateAPIKeyRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+	}
+	if req.GraceMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grace_minutes must not be negative"})
+		return
+	}
+
+	old, err := h.load(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+	if old.RevokedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "API key has been revoked"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The replacement keeps the old key's role and remaining lifetime
+	apiKey, secret, err := h.issue(tx, old.LicenseID, old.Name, old.Scopes, old.Role, old.CreatedBy, &old.ID, old.ExpiresAt)
+	if err != nil {
+		log.Errorf("Failed to rotate API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+
+	if req.GraceMinutes == 0 {
+		_, err = tx.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = $1", old.ID)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE api_keys
+			SET expires_at = LEAST(COALESCE(expires_at, 'infinity'), NOW() + make_interval(mins => $1))
+			WHERE id = $2
+		`, req.GraceMinutes, old.ID)
+	}
+	if err != nil {
+		log.Errorf("Failed to retire rotated API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit API key rotation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIKeySecretResponse{
+		APIKey:  apiKey,
+		Key:     secret,
+		Message: fmt.Sprintf("API key rotated successfully; the previous key stops working in %d minutes", req.GraceMinutes),
+	})
+}
+
+// RevokeAPIKey permanently disables a key. API instances may accept it for up to 30 seconds
+// while their key cache expires.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	query := "UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL"
+	args := []interface{}{c.Param("id")}
+	if licenseID := principalLicense(c); licenseID != "" {
+		query += " AND license_id = $2"
+		args = append(args, licenseID)
+	}
+
+	result, err := h.db.Exec(query, args...)
+	if err != nil {
+		log.Errorf("Failed to revoke API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// issue generates and stores a key
+func (h *APIKeyHandler) issue(exec sqlExecer, licenseID, name string, scopes []string, role, createdBy string, rotatedFrom *string, expiresAt *time.Time) (models.APIKey, string, error) {
+	secret, prefix, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	apiKey := models.APIKey{
+		LicenseID:   licenseID,
+		Name:        name,
+		KeyPrefix:   prefix,
+		Scopes:      scopes,
+		Role:        role,
+		CreatedBy:   createdBy,
+		RotatedFrom: rotatedFrom,
+		ExpiresAt:   expiresAt,
+	}
+	err = exec.QueryRow(`
+		INSERT INTO api_keys (license_id, name, key_prefix, key_hash, scopes, role, created_by, rotated_from, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)
+		RETURNING id, created_at
+	`, licenseID, name, prefix, hash, pq.Array(scopes), role, createdBy, rotatedFrom, expiresAt).Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return apiKey, secret, nil
+}
+
+// principalLicense returns the license the caller is confined to: that of its API key or user
+// session. Admin-token and anonymous callers are not confined and get "".
+//
+// The middleware only checks licenses a request names, so handlers of resources addressed by ID
+// pass this license to their by-ID queries and match license_id against it when it is set, so
+// other licenses' rows are not found.
+func principalLicense(c *gin.Context) string {
+	if licenseID := c.GetString(middleware.ContextAPIKeyLicense); licenseID != "" {
+		return licenseID
+	}
+	return c.GetString(middleware.ContextUserLicense)
+}
+
+// load fetches a key by ID. Callers confined to a license only see their license's keys.
+func (h *APIKeyHandler) load(c *gin.Context, id string) (models.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE id = $1"
+	args := []interface{}{id}
+	if licenseID := principalLicense(c); licenseID != "" {
+		query += " AND license_id = $2"
+		args = append(args, licenseID)
+	}
+	return scanAPIKey(h.db.QueryRow(query, args...))
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var rotatedFrom sql.NullString
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.LicenseID, &key.Name, &key.KeyPrefix, pq.Array(&key.Scopes), &key.Role, &key.CreatedBy,
+		&rotatedFrom, &expiresAt, &revokedAt, &lastUsedAt, &key.LastUsedIP, &key.CreatedAt)
+	if err != nil {
+		return key, err
+	}
+	if rotatedFrom.Valid {
+		key.RotatedFrom = &rotatedFrom.String
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return key, nil
+}
+
+// validateAPIKeyScopes checks that every scope names a known resource and action. A caller
+// that is itself an API key can only grant scopes it holds.
+func validateAPIKeyScopes(c *gin.Context, scopes []string) error {
+	var granted []string
+	if value, ok := c.Get(middleware.ContextAPIKeyScopes); ok {
+		granted, _ = value.([]string)
+	}
+
+	for _, scope := range scopes {
+		if scope != "*" {
+			resource, action, _ := strings.Cut(scope, ":")
+			if !containsString(models.APIKeyResources, resource) || (action != "read" && action != "write" && action != "*") {
+				return fmt.Errorf("invalid scope %q", scope)
+			}
+		}
+		if granted != nil && !apiKeyScopeGrantable(granted, scope) {
+			return fmt.Errorf("cannot grant scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// apiKeyScopeGrantable reports whether holding granted is enough to hand out scope
+func apiKeyScopeGrantable(granted []string, scope string) bool {
+	if scope == "*" {
+		return containsString(granted, "*")
+	}
+	resource, action, _ := strings.Cut(scope, ":")
+	if action == "*" {
+		return containsString(granted, "*") || containsString(granted, resource+":*")
+	}
+	return middleware.ScopeAllows(granted, scope)
+}
@@ -0,0 +1,627 @@
+// Event Volume Baselines
+// Learns each agent's normal hourly event rate per event type and flags significant deviations
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// errBaselineUnavailable is returned when baselining runs without ClickHouse
+var errBaselineUnavailable = errors.New("ClickHouse connection not available")
+
+// BaselineConfig tunes how baselines are learned and what counts as an anomaly
+type BaselineConfig struct {
+	LookbackDays    int     // History used to learn a baseline
+	MinSamples      int     // Days of history an agent needs before it is evaluated
+	ZThreshold      float64 // Standard deviations from the mean that count as anomalous
+	MinDeviation    float64 // Smallest absolute difference from the mean worth flagging, in events
+	SilentMinEvents float64 // Expected hourly events above which a silent agent is flagged
+	Notify          bool    // Send new anomalies to the license's notification channels
+}
+
+// BaselineEngine rebuilds event volume baselines and evaluates the last complete hour against them
+type BaselineEngine struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+	notifier   *NotificationHandler
+	config     BaselineConfig
+}
+
+// NewBaselineEngine creates a baseline engine, filling in defaults for unset configuration
+func NewBaselineEngine(db *sql.DB, ch driver.Conn, config BaselineConfig) *BaselineEngine {
+	if config.LookbackDays < 1 {
+		config.LookbackDays = 28
+	}
+	if config.MinSamples < 1 {
+		config.MinSamples = 7
+	}
+	if config.ZThreshold <= 0 {
+		config.ZThreshold = 3
+	}
+	if config.MinDeviation <= 0 {
+		config.MinDeviation = 20
+	}
+	if config.SilentMinEvents <= 0 {
+		config.SilentMinEvents = 50
+	}
+	return &BaselineEngine{
+		db:         db,
+		clickhouse: ch,
+		notifier:   NewNotificationHandler(db),
+		config:     config,
+	}
+}
+
+// StartBaselineEngine runs the baseline engine periodically in the background
+func StartBaselineEngine(db *sql.DB, ch driver.Conn, config BaselineConfig, interval time.Duration) *BaselineEngine {
+	engine := NewBaselineEngine(db, ch, config)
+	if ch == nil {
+		log.Warn("ClickHouse not available, event volume baselining disabled")
+		return engine
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := engine.Run()
+			if err != nil {
+				log.Errorf("Event volume baselining failed: %v", err)
+				continue
+			}
+			if result.AnomaliesDetected > 0 {
+				log.Infof("Detected %d event volume anomalies for %s (%d baselines updated)",
+					result.AnomaliesDetected, result.HourEvaluated.Format(time.RFC3339), result.BaselinesUpdated)
+			}
+		}
+	}()
+
+	log.Infof("Event volume baseline engine started (interval: %v, lookback: %d days)", interval, engine.config.LookbackDays)
+	return engine
+}
+
+// Run refreshes the baselines for the last complete hour's hour of day and evaluates that hour.
+// Baselines are per hour of day, so 24 hourly runs refresh all of them. Re-running for the same
+// hour is safe; anomalies are recorded once.
+func (e *BaselineEngine) Run() (models.BaselineRunResult, error) {
+	result := models.BaselineRunResult{StartedAt: time.Now()}
+	if e.clickhouse == nil {
+		return result, errBaselineUnavailable
+	}
+
+	ctx := context.Background()
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	result.HourEvaluated = hour
+
+	updated, err := e.rebuildBaselines(ctx, hour)
+	if err != nil {
+		return result, err
+	}
+	result.BaselinesUpdated = updated
+
+	anomalies, err := e.detect(ctx, hour)
+	if err != nil {
+		return result, err
+	}
+	result.AnomaliesDetected = len(anomalies)
+
+	if e.config.Notify && len(anomalies) > 0 {
+		result.Notifications = e.notify(anomalies)
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result, nil
+}
+
+// rebuildBaselines recomputes mean and standard deviation of the hourly count for hour's hour of
+// day over the lookback window, excluding the hour under evaluation. Hours without events count
+// as zero from the first day an agent was seen.
+func (e *BaselineEngine) rebuildBaselines(ctx context.Context, hour time.Time) (int, error) {
+	start := hour.AddDate(0, 0, -e.config.LookbackDays)
+	hourOfDay := hour.Hour()
+
+	rows, err := e.clickhouse.Query(ctx, `
+		SELECT tenant_id, agent_id, event_type, sum(c), sum(c * c), min(slot)
+		FROM (
+			SELECT tenant_id, agent_id, toString(event_type) AS event_type,
+			       toStartOfHour(timestamp, 'UTC') AS slot, count() AS c
+			FROM telemetry_events
+			WHERE timestamp >= ? AND timestamp < ? AND toHour(timestamp, 'UTC') = ?
+			GROUP BY tenant_id, agent_id, event_type, slot
+		)
+		GROUP BY tenant_id, agent_id, event_type
+	`, start, hour, hourOfDay)
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate hourly event counts: %w", err)
+	}
+
+	type aggregate struct {
+		licenseID, agentID, eventType string
+		total, totalSquares           uint64
+	}
+	aggregates := []aggregate{}
+	firstSeen := map[string]time.Time{} // license/agent -> first slot with events
+	for rows.Next() {
+		var a aggregate
+		var first time.Time
+		if err := rows.Scan(&a.licenseID, &a.agentID, &a.eventType, &a.total, &a.totalSquares, &first); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan hourly event counts: %w", err)
+		}
+		key := a.licenseID + "/" + a.agentID
+		if seen, ok := firstSeen[key]; !ok || first.Before(seen) {
+			firstSeen[key] = first
+		}
+		aggregates = append(aggregates, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read hourly event counts: %w", err)
+	}
+
+	licenses, err := e.knownLicenses()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin baseline update: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO event_baselines (license_id, agent_id, event_type, hour_of_day, mean, stddev, samples, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (license_id, agent_id, event_type, hour_of_day)
+		DO UPDATE SET mean = EXCLUDED.mean, stddev = EXCLUDED.stddev, samples = EXCLUDED.samples, updated_at = EXCLUDED.updated_at
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare baseline update: %w", err)
+	}
+	defer stmt.Close()
+
+	refreshedAt := time.Now()
+	updated := 0
+	for _, a := range aggregates {
+		if !licenses[a.licenseID] {
+			continue
+		}
+
+		// One sample per day since the agent first reported at this hour of day
+		days := int(math.Round(hour.Sub(firstSeen[a.licenseID+"/"+a.agentID]).Hours() / 24))
+		if days < 1 {
+			days = 1
+		}
+		if days > e.config.LookbackDays {
+			days = e.config.LookbackDays
+		}
+
+		mean := float64(a.total) / float64(days)
+		variance := float64(a.totalSquares)/float64(days) - mean*mean
+		if variance < 0 {
+			variance = 0
+		}
+
+		if _, err := stmt.Exec(a.licenseID, a.agentID, a.eventType, hourOfDay, mean, math.Sqrt(variance), days, refreshedAt); err != nil {
+			return 0, fmt.Errorf("failed to store baseline: %w", err)
+		}
+		updated++
+	}
+
+	// Agents with no events at this hour of day for the whole window no longer have a baseline
+	if _, err := tx.Exec("DELETE FROM event_baselines WHERE hour_of_day = $1 AND updated_at < $2", hourOfDay, refreshedAt); err != nil {
+		return 0, fmt.Errorf("failed to prune baselines: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit baselines: %w", err)
+	}
+	return updated, nil
+}
+
+// knownLicenses returns the IDs of existing licenses, so telemetry from unknown tenants is skipped
+func (e *BaselineEngine) knownLicenses() (map[string]bool, error) {
+	rows, err := e.db.Query("SELECT id FROM licenses")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load licenses: %w", err)
+	}
+	defer rows.Close()
+
+	licenses := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			licenses[id] = true
+		}
+	}
+	return licenses, nil
+}
+
+// detect compares the hour's event counts with the mature baselines for its hour of day and
+// records spikes, drops and silent agents
+func (e *BaselineEngine) detect(ctx context.Context, hour time.Time) ([]models.VolumeAnomaly, error) {
+	rows, err := e.clickhouse.Query(ctx, `
+		SELECT tenant_id, agent_id, toString(event_type), count()
+		FROM telemetry_events
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY tenant_id, agent_id, event_type
+	`, hour, hour.Add(time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+
+	observed := map[string]int64{}      // license/agent/type -> events this hour
+	agentObserved := map[string]int64{} // license/agent -> events this hour
+	for rows.Next() {
+		var licenseID, agentID, eventType string
+		var count uint64
+		if err := rows.Scan(&licenseID, &agentID, &eventType, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan event counts: %w", err)
+		}
+		observed[licenseID+"/"+agentID+"/"+eventType] = int64(count)
+		agentObserved[licenseID+"/"+agentID] += int64(count)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event counts: %w", err)
+	}
+
+	// Soft-deleted (decommissioned) agents are expected to go quiet
+	baselineRows, err := e.db.Query(`
+		SELECT b.license_id, b.agent_id, b.event_type, b.mean, b.stddev
+		FROM event_baselines b
+		WHERE b.hour_of_day = $1 AND b.samples >= $2
+		  AND NOT EXISTS (SELECT 1 FROM agents a WHERE a.agent_id = b.agent_id AND a.deleted_at IS NOT NULL)
+	`, hour.Hour(), e.config.MinSamples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baselines: %w", err)
+	}
+
+	type agentExpectation struct {
+		licenseID, agentID string
+		expected, variance float64
+	}
+	candidates := []models.VolumeAnomaly{}
+	baselined := map[string]bool{}
+	agents := map[string]*agentExpectation{}
+	for baselineRows.Next() {
+		var b models.EventBaseline
+		if err := baselineRows.Scan(&b.LicenseID, &b.AgentID, &b.EventType, &b.Mean, &b.Stddev); err != nil {
+			continue
+		}
+		agentKey := b.LicenseID + "/" + b.AgentID
+		key := agentKey + "/" + b.EventType
+		baselined[key] = true
+
+		agent, ok := agents[agentKey]
+		if !ok {
+			agent = &agentExpectation{licenseID: b.LicenseID, agentID: b.AgentID}
+			agents[agentKey] = agent
+		}
+		agent.expected += b.Mean
+		agent.variance += b.Stddev * b.Stddev
+
+		count := observed[key]
+		kind, z := e.classify(float64(count), b.Mean, b.Stddev)
+		if kind == "" || (kind == models.AnomalyDrop && agentObserved[agentKey] == 0) {
+			continue // A silent agent is reported once below rather than per event type
+		}
+		candidates = append(candidates, models.VolumeAnomaly{
+			LicenseID: b.LicenseID,
+			AgentID:   b.AgentID,
+			EventType: b.EventType,
+			Kind:      kind,
+			Observed:  count,
+			Expected:  b.Mean,
+			Stddev:    b.Stddev,
+			ZScore:    z,
+		})
+	}
+	baselineRows.Close()
+
+	// Event types an established agent has never produced at this hour
+	for key, count := range observed {
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) != 3 || baselined[key] || agents[parts[0]+"/"+parts[1]] == nil {
+			continue
+		}
+		kind, z := e.classify(float64(count), 0, 0)
+		if kind != models.AnomalySpike {
+			continue
+		}
+		candidates = append(candidates, models.VolumeAnomaly{
+			LicenseID: parts[0],
+			AgentID:   parts[1],
+			EventType: parts[2],
+			Kind:      kind,
+			Observed:  count,
+			ZScore:    z,
+		})
+	}
+
+	for key, agent := range agents {
+		if agentObserved[key] > 0 || agent.expected < e.config.SilentMinEvents {
+			continue
+		}
+		stddev := math.Sqrt(agent.variance)
+		candidates = append(candidates, models.VolumeAnomaly{
+			LicenseID: agent.licenseID,
+			AgentID:   agent.agentID,
+			EventType: models.AnomalyAllEventTypes,
+			Kind:      models.AnomalySilent,
+			Expected:  agent.expected,
+			Stddev:    stddev,
+			ZScore:    -agent.expected / deviationScale(agent.expected, stddev),
+		})
+	}
+
+	anomalies := []models.VolumeAnomaly{}
+	for _, anomaly := range candidates {
+		anomaly.HourStart = hour
+		anomaly.Status = models.AnomalyStatusOpen
+
+		err := e.db.QueryRow(`
+			INSERT INTO volume_anomalies (license_id, agent_id, event_type, kind, hour_start, observed, expected, stddev, z_score)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (license_id, agent_id, event_type, hour_start) DO NOTHING
+			RETURNING id, created_at
+		`, anomaly.LicenseID, anomaly.AgentID, anomaly.EventType, anomaly.Kind, anomaly.HourStart,
+			anomaly.Observed, anomaly.Expected, anomaly.Stddev, anomaly.ZScore).Scan(&anomaly.ID, &anomaly.CreatedAt)
+		if err == sql.ErrNoRows {
+			continue // Already recorded by an earlier run
+		}
+		if err != nil {
+			log.Errorf("Failed to record volume anomaly for agent %s: %v", anomaly.AgentID, err)
+			continue
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, nil
+}
+
+// classify returns the anomaly kind and z-score of an observed count against a baseline, or an
+// empty kind when the count is within normal variation
+func (e *BaselineEngine) classify(observed, mean, stddev float64) (string, float64) {
+	z := (observed - mean) / deviationScale(mean, stddev)
+	switch {
+	case z >= e.config.ZThreshold && observed-mean >= e.config.MinDeviation:
+		return models.AnomalySpike, z
+	case z <= -e.config.ZThreshold && mean-observed >= e.config.MinDeviation:
+		return models.AnomalyDrop, z
+	}
+	return "", z
+}
+
+// deviationScale floors the standard deviation so perfectly regular or sparse counts do not
+// turn every small change into a huge z-score. Counts are at least Poisson-distributed.
+func deviationScale(mean, stddev float64) float64 {
+	return math.Max(1, math.Max(stddev, math.Sqrt(mean)))
+}
+
+// notify sends one summary per license for newly detected anomalies
+func (e *BaselineEngine) notify(anomalies []models.VolumeAnomaly) int {
+	byLicense := map[string][]models.VolumeAnomaly{}
+	for _, anomaly := range anomalies {
+		byLicense[anomaly.LicenseID] = append(byLicense[anomaly.LicenseID], anomaly)
+	}
+
+	sent := 0
+	for licenseID, items := range byLicense {
+		sort.Slice(items, func(i, j int) bool { return math.Abs(items[i].ZScore) > math.Abs(items[j].ZScore) })
+
+		priority := "medium"
+		lines := make([]string, 0, len(items))
+		for _, anomaly := range items {
+			if anomaly.Kind != models.AnomalyDrop {
+				priority = "high"
+			}
+			lines = append(lines, describeAnomaly(anomaly))
+		}
+
+		subject := fmt.Sprintf("Privé event volume anomalies: %d detected", len(items))
+		message := fmt.Sprintf("Event volume deviations for %s UTC:\n%s",
+			items[0].HourStart.Format("2006-01-02 15:04"), strings.Join(lines, "\n"))
+		sent += e.notifier.NotifyLicense(licenseID, subject, message, priority, map[string]interface{}{
+			"source":    "baseline",
+			"anomalies": len(items),
+			"hour":      items[0].HourStart,
+		})
+	}
+	return sent
+}
+
+// describeAnomaly renders one anomaly as a line of a notification
+func describeAnomaly(anomaly models.VolumeAnomaly) string {
+	switch anomaly.Kind {
+	case models.AnomalySilent:
+		return fmt.Sprintf("- %s went silent (expected ~%.0f events)", anomaly.AgentID, anomaly.Expected)
+	case models.AnomalySpike:
+		return fmt.Sprintf("- %s: %d %s events, expected ~%.0f (z=%.1f)", anomaly.AgentID, anomaly.Observed, anomaly.EventType, anomaly.Expected, anomaly.ZScore)
+	default:
+		return fmt.Sprintf("- %s: only %d %s events, expected ~%.0f (z=%.1f)", anomaly.AgentID, anomaly.Observed, anomaly.EventType, anomaly.Expected, anomaly.ZScore)
+	}
+}
+
+// BaselineHandler exposes baselines and the anomalies detected against them
+type BaselineHandler struct {
+	db     *sql.DB
+	engine *BaselineEngine
+}
+
+// NewBaselineHandler creates a new baseline handler
+func NewBaselineHandler(db *sql.DB, engine *BaselineEngine) *BaselineHandler {
+	if engine == nil {
+		engine = NewBaselineEngine(db, nil, BaselineConfig{})
+	}
+	return &BaselineHandler{db: db, engine: engine}
+}
+
+// ListBaselines lists the learned baselines of a license, optionally for one agent or hour of day
+func (h *BaselineHandler) ListBaselines(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := `
+		SELECT license_id, agent_id, event_type, hour_of_day, mean, stddev, samples, updated_at
+		FROM event_baselines
+		WHERE license_id = $1`
+	args := []interface{}{licenseID}
+	argCount := 2
+
+	if agentID := c.Query("agent_id"); agentID != "" {
+		query += fmt.Sprintf(" AND agent_id = $%d", argCount)
+		args = append(args, agentID)
+		argCount++
+	}
+	if value := c.Query("hour_of_day"); value != "" {
+		hourOfDay, err := strconv.Atoi(value)
+		if err != nil || hourOfDay < 0 || hourOfDay > 23 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hour_of_day must be between 0 and 23"})
+			return
+		}
+		query += fmt.Sprintf(" AND hour_of_day = $%d", argCount)
+		args = append(args, hourOfDay)
+		argCount++
+	}
+	query += " ORDER BY agent_id, event_type, hour_of_day LIMIT 5000"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list baselines: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list baselines"})
+		return
+	}
+	defer rows.Close()
+
+	baselines := []models.EventBaseline{}
+	for rows.Next() {
+		var b models.EventBaseline
+		if err := rows.Scan(&b.LicenseID, &b.AgentID, &b.EventType, &b.HourOfDay, &b.Mean, &b.Stddev, &b.Samples, &b.UpdatedAt); err != nil {
+			continue
+		}
+		baselines = append(baselines, b)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"baselines": baselines,
+		"count":     len(baselines),
+	})
+}
+
+// ListVolumeAnomalies lists detected anomalies, newest first, filtered by agent, kind and status
+func (h *BaselineHandler) ListVolumeAnomalies(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	query := `
+		SELECT id, license_id, agent_id, event_type, kind, hour_start, observed,
+		       expected, stddev, z_score, status, created_at
+		FROM volume_anomalies
+		WHERE license_id = $1`
+	args := []interface{}{licenseID}
+	argCount := 2
+
+	for _, filter := range []string{"agent_id", "kind", "status"} {
+		if value := c.Query(filter); value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", filter, argCount)
+			args = append(args, value)
+			argCount++
+		}
+	}
+	query += fmt.Sprintf(" ORDER BY hour_start DESC, ABS(z_score) DESC LIMIT $%d", argCount)
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list volume anomalies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list anomalies"})
+		return
+	}
+	defer rows.Close()
+
+	anomalies := []models.VolumeAnomaly{}
+	for rows.Next() {
+		var a models.VolumeAnomaly
+		err := rows.Scan(&a.ID, &a.LicenseID, &a.AgentID, &a.EventType, &a.Kind, &a.HourStart, &a.Observed,
+			&a.Expected, &a.Stddev, &a.ZScore, &a.Status, &a.CreatedAt)
+		if err != nil {
+			continue
+		}
+		anomalies = append(anomalies, a)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"anomalies": anomalies,
+		"count":     len(anomalies),
+	})
+}
+
+// AcknowledgeVolumeAnomaly marks an anomaly as reviewed
+func (h *BaselineHandler) AcknowledgeVolumeAnomaly(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec(
+		"UPDATE volume_anomalies SET status = $1 WHERE id = $2 AND ($3 = '' OR license_id::text = $3)",
+		models.AnomalyStatusAcknowledged, id, principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to acknowledge volume anomaly: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge anomaly"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Anomaly not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Anomaly acknowledged successfully"})
+}
+
+// RunBaseline triggers an immediate baseline refresh and evaluation of the last complete hour
+func (h *BaselineHandler) RunBaseline(c *gin.Context) {
+	result, err := h.engine.Run()
+	if err == errBaselineUnavailable {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to run baselining: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run baselining"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
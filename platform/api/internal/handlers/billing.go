@@ -0,0 +1,73 @@
+// Self-Serve Billing Handlers (Stripe)
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/billing"
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// maxStripeWebhookBytes bounds the webhook body read into memory
+const maxStripeWebhookBytes = 1 << 20
+
+// BillingHandler handles checkout and billing provider webhooks
+type BillingHandler struct {
+	billing *billing.Service
+}
+
+// NewBillingHandler creates a new billing handler
+func NewBillingHandler(billing *billing.Service) *BillingHandler {
+	return &BillingHandler{billing: billing}
+}
+
+// CreateCheckout starts a Stripe checkout for a tier
+func (h *BillingHandler) CreateCheckout(c *gin.Context) {
+	var req models.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if h.billing == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Billing not configured"})
+		return
+	}
+
+	checkout, err := h.billing.CreateCheckout(req)
+	if err != nil {
+		log.Errorf("Failed to create checkout: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, checkout)
+}
+
+// StripeWebhook applies Stripe subscription events to licenses
+func (h *BillingHandler) StripeWebhook(c *gin.Context) {
+	if h.billing == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Billing not configured"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxStripeWebhookBytes)
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	if err := h.billing.HandleWebhook(payload, c.GetHeader("Stripe-Signature")); err != nil {
+		log.Errorf("Failed to handle Stripe webhook: %v", err)
+		// Non-2xx makes Stripe retry the delivery
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
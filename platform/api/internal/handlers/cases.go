@@ -0,0 +1,719 @@
+// Incident Case Management Handler
+// Bundles related alerts, events, IOCs, AI analyses and deception events into cases
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// CaseHandler handles incident case operations
+type CaseHandler struct {
+	db *sql.DB
+}
+
+// NewCaseHandler creates a new case handler
+func NewCaseHandler(db *sql.DB) *CaseHandler {
+	return &CaseHandler{db: db}
+}
+
+// caseItemTables maps PostgreSQL-backed item types to the table holding them.
+// Telemetry events live in ClickHouse and are not existence-checked.
+var caseItemTables = map[models.CaseItemType]string{
+	models.CaseItemAlert:          "alert_instances",
+	models.CaseItemIOC:            "shared_iocs",
+	models.CaseItemAIAnalysis:     "ai_analysis_history",
+	models.CaseItemDeceptionEvent: "deception_events",
+}
+
+// CreateCase opens a new case, optionally attaching initial items
+func (h *CaseHandler) CreateCase(c *gin.Context) {
+	var req models.CreateCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if !isValidCaseSeverity(req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be one of: low, medium, high, critical"})
+		return
+	}
+
+	// The same object listed twice is attached once
+	seen := make(map[string]bool)
+	items := make([]models.AttachCaseItemRequest, 0, len(req.Items))
+	for _, item := range req.Items {
+		if err := h.validateCaseItem(item); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		key := string(item.ItemType) + ":" + item.ItemID
+		if !seen[key] {
+			seen[key] = true
+			items = append(items, item)
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create case"})
+		return
+	}
+	defer tx.Rollback()
+
+	caseID := uuid.New().String()
+	query := `
+		INSERT INTO cases (id, license_id, title, description, status, severity, owner, tags, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at, updated_at
+	`
+
+	var createdAt, updatedAt time.Time
+	err = tx.QueryRow(query,
+		caseID,
+		req.LicenseID,
+		req.Title,
+		req.Description,
+		models.CaseStatusOpen,
+		req.Severity,
+		nullIfEmpty(req.Owner),
+		pq.Array(req.Tags),
+		nullIfEmpty(req.CreatedBy),
+	).Scan(&createdAt, &updatedAt)
+	if err != nil {
+		log.Errorf("Failed to create case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create case"})
+		return
+	}
+
+	for _, item := range items {
+		if item.AddedBy == "" {
+			item.AddedBy = req.CreatedBy
+		}
+		if _, err := insertCaseItem(tx, caseID, item); err != nil && err != sql.ErrNoRows {
+			log.Errorf("Failed to attach item to case: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create case"})
+			return
+		}
+	}
+
+	if err := insertCaseNote(tx, caseID, "status_change", req.CreatedBy, "Case opened"); err != nil {
+		log.Errorf("Failed to add case note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create case"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create case"})
+		return
+	}
+
+	broadcastCaseUpdate(req.LicenseID, caseID, "created", req.CreatedBy, "Case opened: "+req.Title)
+
+	c.JSON(http.StatusCreated, models.Case{
+		ID:          caseID,
+		LicenseID:   req.LicenseID,
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      models.CaseStatusOpen,
+		Severity:    req.Severity,
+		Owner:       req.Owner,
+		Tags:        req.Tags,
+		ItemCount:   len(items),
+		CreatedBy:   req.CreatedBy,
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	})
+}
+
+// ListCases lists cases for a license with optional filters
+func (h *CaseHandler) ListCases(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := `
+		SELECT c.id, c.license_id, c.title, c.description, c.status, c.severity,
+		       c.owner, c.tags, c.created_by, c.closed_at, c.created_at, c.updated_at,
+		       (SELECT COUNT(*) FROM case_items ci WHERE ci.case_id = c.id)
+		FROM cases c
+		WHERE c.license_id = $1
+	`
+	args := []interface{}{licenseID}
+	argCount := 2
+
+	if status := c.Query("status"); status != "" {
+		query += fmt.Sprintf(" AND c.status = $%d", argCount)
+		args = append(args, status)
+		argCount++
+	}
+	if severity := c.Query("severity"); severity != "" {
+		query += fmt.Sprintf(" AND c.severity = $%d", argCount)
+		args = append(args, severity)
+		argCount++
+	}
+	if owner := c.Query("owner"); owner != "" {
+		query += fmt.Sprintf(" AND c.owner = $%d", argCount)
+		args = append(args, owner)
+		argCount++
+	}
+
+	query += " ORDER BY c.updated_at DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list cases: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list cases"})
+		return
+	}
+	defer rows.Close()
+
+	cases := []models.Case{}
+	for rows.Next() {
+		cs, err := scanCase(rows)
+		if err != nil {
+			log.Warnf("Failed to scan case: %v", err)
+			continue
+		}
+		cases = append(cases, cs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cases": cases,
+		"count": len(cases),
+	})
+}
+
+// GetCase retrieves a case with its attached items and timeline
+func (h *CaseHandler) GetCase(c *gin.Context) {
+	id := c.Param("id")
+
+	query := `
+		SELECT c.id, c.license_id, c.title, c.description, c.status, c.severity,
+		       c.owner, c.tags, c.created_by, c.closed_at, c.created_at, c.updated_at,
+		       (SELECT COUNT(*) FROM case_items ci WHERE ci.case_id = c.id)
+		FROM cases c
+		WHERE c.id = $1 AND ($2 = '' OR c.license_id::text = $2)
+	`
+
+	cs, err := scanCase(h.db.QueryRow(query, id, principalLicense(c)))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve case"})
+		return
+	}
+
+	cs.Items, err = h.listCaseItems(id)
+	if err != nil {
+		log.Errorf("Failed to list case items: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve case"})
+		return
+	}
+
+	cs.Notes, err = h.listCaseNotes(id)
+	if err != nil {
+		log.Errorf("Failed to list case notes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve case"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cs)
+}
+
+// UpdateCase updates case fields, recording status and owner changes on the timeline
+func (h *CaseHandler) UpdateCase(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if req.Status != nil && !isValidCaseStatus(*req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of: open, investigating, contained, closed"})
+		return
+	}
+	if req.Severity != nil && !isValidCaseSeverity(*req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be one of: low, medium, high, critical"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent updates record accurate transitions
+	var currentStatus, licenseID string
+	var currentOwner sql.NullString
+	err = tx.QueryRow(
+		"SELECT status, owner, license_id FROM cases WHERE id = $1 AND ($2 = '' OR license_id::text = $2) FOR UPDATE",
+		id, principalLicense(c),
+	).Scan(&currentStatus, &currentOwner, &licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+		return
+	}
+
+	query := "UPDATE cases SET updated_at = NOW()"
+	args := []interface{}{}
+	argCount := 1
+
+	if req.Title != nil {
+		query += fmt.Sprintf(", title = $%d", argCount)
+		args = append(args, *req.Title)
+		argCount++
+	}
+	if req.Description != nil {
+		query += fmt.Sprintf(", description = $%d", argCount)
+		args = append(args, *req.Description)
+		argCount++
+	}
+	if req.Severity != nil {
+		query += fmt.Sprintf(", severity = $%d", argCount)
+		args = append(args, *req.Severity)
+		argCount++
+	}
+	if req.Owner != nil {
+		query += fmt.Sprintf(", owner = $%d", argCount)
+		args = append(args, nullIfEmpty(*req.Owner))
+		argCount++
+	}
+	if req.Tags != nil {
+		query += fmt.Sprintf(", tags = $%d", argCount)
+		args = append(args, pq.Array(*req.Tags))
+		argCount++
+	}
+	if req.Status != nil {
+		query += fmt.Sprintf(", status = $%d", argCount)
+		args = append(args, *req.Status)
+		argCount++
+
+		if *req.Status == models.CaseStatusClosed {
+			query += ", closed_at = NOW()"
+		} else {
+			query += ", closed_at = NULL"
+		}
+	}
+
+	query += fmt.Sprintf(" WHERE id = $%d", argCount)
+	args = append(args, id)
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		log.Errorf("Failed to update case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+		return
+	}
+
+	if req.Status != nil && string(*req.Status) != currentStatus {
+		content := fmt.Sprintf("Status changed from %s to %s", currentStatus, *req.Status)
+		if err := insertCaseNote(tx, id, "status_change", req.UpdatedBy, content); err != nil {
+			log.Errorf("Failed to add case note: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+			return
+		}
+	}
+	if req.Owner != nil && *req.Owner != currentOwner.String {
+		content := fmt.Sprintf("Case assigned to %s", *req.Owner)
+		if *req.Owner == "" {
+			content = "Case unassigned"
+		}
+		if err := insertCaseNote(tx, id, "assignment", req.UpdatedBy, content); err != nil {
+			log.Errorf("Failed to add case note: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit case update: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update case"})
+		return
+	}
+
+	summary := "Case updated"
+	if req.Status != nil && string(*req.Status) != currentStatus {
+		summary = fmt.Sprintf("Status changed from %s to %s", currentStatus, *req.Status)
+	}
+	broadcastCaseUpdate(licenseID, id, "updated", req.UpdatedBy, summary)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Case updated successfully"})
+}
+
+// DeleteCase deletes a case along with its items and notes
+func (h *CaseHandler) DeleteCase(c *gin.Context) {
+	id := c.Param("id")
+
+	var licenseID string
+	err := h.db.QueryRow(
+		"DELETE FROM cases WHERE id = $1 AND ($2 = '' OR license_id::text = $2) RETURNING license_id",
+		id, principalLicense(c),
+	).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to delete case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete case"})
+		return
+	}
+
+	broadcastCaseUpdate(licenseID, id, "deleted", c.Query("deleted_by"), "Case deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Case deleted successfully"})
+}
+
+// AttachCaseItem links an alert, event, IOC, AI analysis or deception event to a case
+func (h *CaseHandler) AttachCaseItem(c *gin.Context) {
+	caseID := c.Param("id")
+
+	var req models.AttachCaseItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if err := h.validateCaseItem(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach item"})
+		return
+	}
+	defer tx.Rollback()
+
+	var licenseID string
+	err = tx.QueryRow(
+		"SELECT license_id FROM cases WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		caseID, principalLicense(c),
+	).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to check case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach item"})
+		return
+	}
+
+	item, err := insertCaseItem(tx, caseID, req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "Item already attached to case"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to attach item to case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach item"})
+		return
+	}
+
+	content := fmt.Sprintf("Attached %s %s", req.ItemType, req.ItemID)
+	if err := insertCaseNote(tx, caseID, "item_added", req.AddedBy, content); err != nil {
+		log.Errorf("Failed to add case note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach item"})
+		return
+	}
+
+	tx.Exec("UPDATE cases SET updated_at = NOW() WHERE id = $1", caseID)
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit case item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach item"})
+		return
+	}
+
+	broadcastCaseUpdate(licenseID, caseID, "item_attached", req.AddedBy, content)
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// DetachCaseItem removes an attached item from a case
+func (h *CaseHandler) DetachCaseItem(c *gin.Context) {
+	caseID := c.Param("id")
+	itemID := c.Param("item_id")
+
+	var itemType, itemRef, licenseID string
+	err := h.db.QueryRow(`
+		DELETE FROM case_items i USING cases c
+		WHERE i.id = $1 AND i.case_id = $2 AND c.id = i.case_id
+		  AND ($3 = '' OR c.license_id::text = $3)
+		RETURNING i.item_type, i.item_id, c.license_id
+	`, itemID, caseID, principalLicense(c)).Scan(&itemType, &itemRef, &licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case item not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to detach case item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to detach item"})
+		return
+	}
+
+	content := fmt.Sprintf("Removed %s %s", itemType, itemRef)
+	if err := insertCaseNote(h.db, caseID, "item_removed", c.Query("removed_by"), content); err != nil {
+		log.Warnf("Failed to add case note: %v", err)
+	}
+	broadcastCaseUpdate(licenseID, caseID, "item_detached", c.Query("removed_by"), content)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item detached successfully"})
+}
+
+// AddCaseNote adds an analyst note to the case timeline
+func (h *CaseHandler) AddCaseNote(c *gin.Context) {
+	caseID := c.Param("id")
+
+	var req models.AddCaseNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	noteID := uuid.New().String()
+	var createdAt time.Time
+	var licenseID string
+	err := h.db.QueryRow(`
+		INSERT INTO case_notes (id, case_id, note_type, author, content)
+		SELECT $1, id, 'note', $3, $4 FROM cases WHERE id = $2 AND ($5 = '' OR license_id::text = $5)
+		RETURNING created_at, (SELECT license_id FROM cases WHERE id = $2)
+	`, noteID, caseID, nullIfEmpty(req.Author), req.Content, principalLicense(c)).Scan(&createdAt, &licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to add case note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add note"})
+		return
+	}
+
+	h.db.Exec("UPDATE cases SET updated_at = NOW() WHERE id = $1", caseID)
+	broadcastCaseUpdate(licenseID, caseID, "note_added", req.Author, "Note added")
+
+	c.JSON(http.StatusCreated, models.CaseNote{
+		ID:        noteID,
+		CaseID:    caseID,
+		NoteType:  "note",
+		Author:    req.Author,
+		Content:   req.Content,
+		CreatedAt: createdAt,
+	})
+}
+
+// broadcastCaseUpdate notifies WebSocket clients following the case
+func broadcastCaseUpdate(licenseID, caseID, action, actor, summary string) {
+	BroadcastCaseUpdate(licenseID, models.WSCaseUpdateNotification{
+		CaseID:    caseID,
+		Action:    action,
+		Summary:   summary,
+		Actor:     actor,
+		Timestamp: time.Now(),
+	})
+}
+
+// validateCaseItem checks the item type and, for PostgreSQL-backed items, that the target exists
+func (h *CaseHandler) validateCaseItem(item models.AttachCaseItemRequest) error {
+	if item.ItemType == models.CaseItemEvent {
+		return nil
+	}
+
+	table, ok := caseItemTables[item.ItemType]
+	if !ok {
+		return fmt.Errorf("item_type must be one of: event, alert, ioc, ai_analysis, deception_event")
+	}
+
+	if _, err := uuid.Parse(item.ItemID); err != nil {
+		return fmt.Errorf("invalid %s id: %s", item.ItemType, item.ItemID)
+	}
+
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE id = $1)", table)
+	if err := h.db.QueryRow(query, item.ItemID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up %s %s", item.ItemType, item.ItemID)
+	}
+	if !exists {
+		return fmt.Errorf("%s %s not found", item.ItemType, item.ItemID)
+	}
+
+	return nil
+}
+
+func (h *CaseHandler) listCaseItems(caseID string) ([]models.CaseItem, error) {
+	rows, err := h.db.Query(`
+		SELECT id, case_id, item_type, item_id, summary, added_by, added_at
+		FROM case_items
+		WHERE case_id = $1
+		ORDER BY added_at ASC
+	`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.CaseItem{}
+	for rows.Next() {
+		var item models.CaseItem
+		var summary, addedBy sql.NullString
+		if err := rows.Scan(&item.ID, &item.CaseID, &item.ItemType, &item.ItemID, &summary, &addedBy, &item.AddedAt); err != nil {
+			continue
+		}
+		item.Summary = summary.String
+		item.AddedBy = addedBy.String
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (h *CaseHandler) listCaseNotes(caseID string) ([]models.CaseNote, error) {
+	rows, err := h.db.Query(`
+		SELECT id, case_id, note_type, author, content, created_at
+		FROM case_notes
+		WHERE case_id = $1
+		ORDER BY created_at ASC
+	`, caseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []models.CaseNote{}
+	for rows.Next() {
+		var note models.CaseNote
+		var author sql.NullString
+		if err := rows.Scan(&note.ID, &note.CaseID, &note.NoteType, &author, &note.Content, &note.CreatedAt); err != nil {
+			continue
+		}
+		note.Author = author.String
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insertCaseItem attaches an item; returns sql.ErrNoRows if it is already attached
+func insertCaseItem(db sqlExecer, caseID string, req models.AttachCaseItemRequest) (models.CaseItem, error) {
+	item := models.CaseItem{
+		ID:       uuid.New().String(),
+		CaseID:   caseID,
+		ItemType: req.ItemType,
+		ItemID:   req.ItemID,
+		Summary:  req.Summary,
+		AddedBy:  req.AddedBy,
+	}
+
+	err := db.QueryRow(`
+		INSERT INTO case_items (id, case_id, item_type, item_id, summary, added_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (case_id, item_type, item_id) DO NOTHING
+		RETURNING added_at
+	`, item.ID, caseID, req.ItemType, req.ItemID, nullIfEmpty(req.Summary), nullIfEmpty(req.AddedBy)).Scan(&item.AddedAt)
+
+	return item, err
+}
+
+// insertCaseNote appends an entry to a case timeline
+func insertCaseNote(db sqlExecer, caseID, noteType, author, content string) error {
+	_, err := db.Exec(`
+		INSERT INTO case_notes (id, case_id, note_type, author, content)
+		VALUES ($1, $2, $3, $4, $5)
+	`, uuid.New().String(), caseID, noteType, nullIfEmpty(author), content)
+	return err
+}
+
+// scanCase scans a case row including its item count
+func scanCase(row rowScanner) (models.Case, error) {
+	var cs models.Case
+	var description, owner, createdBy sql.NullString
+	var closedAt sql.NullTime
+
+	err := row.Scan(
+		&cs.ID,
+		&cs.LicenseID,
+		&cs.Title,
+		&description,
+		&cs.Status,
+		&cs.Severity,
+		&owner,
+		pq.Array(&cs.Tags),
+		&createdBy,
+		&closedAt,
+		&cs.CreatedAt,
+		&cs.UpdatedAt,
+		&cs.ItemCount,
+	)
+	if err != nil {
+		return cs, err
+	}
+
+	cs.Description = description.String
+	cs.Owner = owner.String
+	cs.CreatedBy = createdBy.String
+	if closedAt.Valid {
+		cs.ClosedAt = &closedAt.Time
+	}
+
+	return cs, nil
+}
+
+func isValidCaseStatus(status models.CaseStatus) bool {
+	switch status {
+	case models.CaseStatusOpen, models.CaseStatusInvestigating, models.CaseStatusContained, models.CaseStatusClosed:
+		return true
+	}
+	return false
+}
+
+func isValidCaseSeverity(severity string) bool {
+	switch severity {
+	case "low", "medium", "high", "critical":
+		return true
+	}
+	return false
+}
+
+// nullIfEmpty stores empty optional strings as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
@@ -33,7 +34,7 @@ func NewCollaborativeHandler(db *sql.DB) *CollaborativeHandler {
 func (h *CollaborativeHandler) PublishRule(c *gin.Context) {
 	var req models.PublishRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -238,7 +239,7 @@ func (h *CollaborativeHandler) GetRule(c *gin.Context) {
 func (h *CollaborativeHandler) VoteRule(c *gin.Context) {
 	var req models.RuleVoteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -293,7 +294,7 @@ func (h *CollaborativeHandler) VoteRule(c *gin.Context) {
 func (h *CollaborativeHandler) DownloadRule(c *gin.Context) {
 	var req models.DownloadRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -409,7 +410,7 @@ func (h *CollaborativeHandler) GetCommunityStats(c *gin.Context) {
 func (h *CollaborativeHandler) PublishIOC(c *gin.Context) {
 	var req models.PublishIOCRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -537,3 +538,334 @@ func (h *CollaborativeHandler) SearchIOCs(c *gin.Context) {
 		"total": len(iocs),
 	})
 }
+
+// AddComment adds a comment to a shared rule
+func (h *CollaborativeHandler) AddComment(c *gin.Context) {
+	var req models.RuleCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	ruleID := c.Param("id")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE shared_rules SET comment_count = comment_count + 1 WHERE id = $1 AND status = 'approved'", ruleID)
+	if err != nil {
+		log.Errorf("Failed to update comment count: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	comment := models.RuleComment{
+		ID:      uuid.New().String(),
+		RuleID:  ruleID,
+		Author:  h.communityAuthor(req.LicenseID, req.Anonymous),
+		Comment: req.Comment,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO rule_comments (id, rule_id, author, license_id, comment, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING created_at
+	`, comment.ID, ruleID, comment.Author, req.LicenseID, req.Comment).Scan(&comment.CreatedAt)
+	if err != nil {
+		log.Errorf("Failed to add comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// GetComments lists the comments on a shared rule, oldest first
+func (h *CollaborativeHandler) GetComments(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT id, rule_id, author, comment, created_at
+		FROM rule_comments
+		WHERE rule_id = $1
+		ORDER BY created_at
+	`, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to list comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+	defer rows.Close()
+
+	comments := make([]models.RuleComment, 0)
+	for rows.Next() {
+		var comment models.RuleComment
+		if err := rows.Scan(&comment.ID, &comment.RuleID, &comment.Author, &comment.Comment, &comment.CreatedAt); err != nil {
+			log.Warnf("Failed to scan comment: %v", err)
+			continue
+		}
+		comments = append(comments, comment)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"total":    len(comments),
+	})
+}
+
+// GetIOC retrieves a specific shared IOC
+func (h *CollaborativeHandler) GetIOC(c *gin.Context) {
+	query := `
+		SELECT id, type, value, description, threat_type, confidence, tags,
+		       first_seen, last_seen, submitted_by, submitted_at, report_count, is_verified
+		FROM shared_iocs
+		WHERE id = $1
+	`
+
+	var ioc models.SharedIOC
+	var tagsJSON []byte
+	err := h.db.QueryRow(query, c.Param("id")).Scan(
+		&ioc.ID, &ioc.Type, &ioc.Value, &ioc.Description, &ioc.ThreatType,
+		&ioc.Confidence, &tagsJSON, &ioc.FirstSeen, &ioc.LastSeen,
+		&ioc.SubmittedBy, &ioc.SubmittedAt, &ioc.ReportCount, &ioc.IsVerified,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IOC not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get IOC: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve IOC"})
+		return
+	}
+
+	json.Unmarshal(tagsJSON, &ioc.Tags)
+	c.JSON(http.StatusOK, ioc)
+}
+
+// ReportIOC records a sighting, false positive or note against a shared IOC. Confirmations
+// raise the IOC's report count.
+func (h *CollaborativeHandler) ReportIOC(c *gin.Context) {
+	var req models.ReportIOCRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	iocID := c.Param("id")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	update := "UPDATE shared_iocs SET updated_at = NOW() WHERE id = $1"
+	if req.ReportType == "confirmed" {
+		update = "UPDATE shared_iocs SET report_count = report_count + 1, last_seen = NOW(), updated_at = NOW() WHERE id = $1"
+	}
+	result, err := tx.Exec(update, iocID)
+	if err != nil {
+		log.Errorf("Failed to update IOC: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report IOC"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "IOC not found"})
+		return
+	}
+
+	reportID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO ioc_reports (id, ioc_id, license_id, report_type, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+	`, reportID, iocID, req.LicenseID, req.ReportType, req.Comment)
+	if err != nil {
+		log.Errorf("Failed to record IOC report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report IOC"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit IOC report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report IOC"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":      reportID,
+		"ioc_id":  iocID,
+		"message": "IOC report recorded",
+	})
+}
+
+// PublishQuery publishes a hunting query to the community
+func (h *CollaborativeHandler) PublishQuery(c *gin.Context) {
+	var req models.PublishQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	queryID := uuid.New().String()
+	author := h.communityAuthor(req.LicenseID, req.Anonymous)
+
+	var submittedAt time.Time
+	err := h.db.QueryRow(`
+		INSERT INTO hunting_queries (id, name, description, query, query_language, category,
+		                             mitre_techniques, tags, author, submitter_license_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
+		RETURNING created_at
+	`, queryID, req.Name, req.Description, req.Query, req.QueryLanguage, req.Category,
+		pq.Array(req.MITRETechniques), pq.Array(req.Tags), author, req.LicenseID,
+	).Scan(&submittedAt)
+	if err != nil {
+		log.Errorf("Failed to publish query: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish query"})
+		return
+	}
+
+	log.Infof("Hunting query published: %s by %s", req.Name, author)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":           queryID,
+		"submitted_at": submittedAt,
+		"message":      "Query published successfully",
+	})
+}
+
+// SearchQueries searches for community-shared hunting queries
+func (h *CollaborativeHandler) SearchQueries(c *gin.Context) {
+	query := c.DefaultQuery("query", "")
+	category := c.DefaultQuery("category", "")
+	language := c.DefaultQuery("query_language", "")
+	sortBy := c.DefaultQuery("sort_by", "recent")
+	limit := 50
+	offset := 0
+
+	baseQuery := `
+		SELECT id, name, description, query, query_language, category, mitre_techniques, tags,
+		       author, created_at, updated_at, use_count, rating
+		FROM hunting_queries
+		WHERE 1=1
+	`
+
+	args := []interface{}{}
+	argCount := 1
+
+	if query != "" {
+		baseQuery += fmt.Sprintf(" AND (name ILIKE $%d OR description ILIKE $%d)", argCount, argCount)
+		args = append(args, "%"+query+"%")
+		argCount++
+	}
+
+	if category != "" {
+		baseQuery += fmt.Sprintf(" AND category = $%d", argCount)
+		args = append(args, category)
+		argCount++
+	}
+
+	if language != "" {
+		baseQuery += fmt.Sprintf(" AND query_language = $%d", argCount)
+		args = append(args, language)
+		argCount++
+	}
+
+	switch sortBy {
+	case "popular":
+		baseQuery += " ORDER BY use_count DESC, rating DESC"
+	case "rating":
+		baseQuery += " ORDER BY rating DESC, use_count DESC"
+	default:
+		baseQuery += " ORDER BY created_at DESC"
+	}
+
+	baseQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argCount, argCount+1)
+	args = append(args, limit, offset)
+
+	rows, err := h.db.Query(baseQuery, args...)
+	if err != nil {
+		log.Errorf("Failed to search queries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+	defer rows.Close()
+
+	queries := make([]models.HuntingQuery, 0)
+	for rows.Next() {
+		q, err := scanHuntingQuery(rows)
+		if err != nil {
+			log.Warnf("Failed to scan query: %v", err)
+			continue
+		}
+		queries = append(queries, q)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queries": queries,
+		"total":   len(queries),
+	})
+}
+
+// GetQuery retrieves a specific shared hunting query
+func (h *CollaborativeHandler) GetQuery(c *gin.Context) {
+	row := h.db.QueryRow(`
+		SELECT id, name, description, query, query_language, category, mitre_techniques, tags,
+		       author, created_at, updated_at, use_count, rating
+		FROM hunting_queries
+		WHERE id = $1
+	`, c.Param("id"))
+
+	q, err := scanHuntingQuery(row)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get query: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve query"})
+		return
+	}
+
+	c.JSON(http.StatusOK, q)
+}
+
+// scanHuntingQuery scans a hunting_queries row selected by SearchQueries or GetQuery
+func scanHuntingQuery(row rowScanner) (models.HuntingQuery, error) {
+	var q models.HuntingQuery
+	var description, category, author sql.NullString
+	err := row.Scan(
+		&q.ID, &q.Name, &description, &q.Query, &q.QueryLanguage, &category,
+		pq.Array(&q.MITRETechniques), pq.Array(&q.Tags),
+		&author, &q.SubmittedAt, &q.UpdatedAt, &q.UseCount, &q.Rating,
+	)
+	q.Description = description.String
+	q.Category = category.String
+	q.Author = author.String
+	q.IsPublic = true
+	return q, err
+}
+
+// communityAuthor is the name shown on community content: the license's company name, or
+// "Anonymous" when the submitter asked for it or the license has none
+func (h *CollaborativeHandler) communityAuthor(licenseID string, anonymous bool) string {
+	if anonymous {
+		return "Anonymous"
+	}
+	var orgName string
+	h.db.QueryRow("SELECT company_name FROM licenses WHERE id = $1", licenseID).Scan(&orgName)
+	if orgName == "" {
+		return "Anonymous"
+	}
+	return orgName
+}
@@ -0,0 +1,103 @@
+// Community Moderation Handlers
+// Verification and removal of shared rules, IOCs and hunting queries
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// VerifyRule marks a shared rule verified, or removes the mark
+func (h *CollaborativeHandler) VerifyRule(c *gin.Context) {
+	h.verifySharedItem(c, "shared_rules", "Rule")
+}
+
+// VerifyIOC marks a shared IOC verified, or removes the mark
+func (h *CollaborativeHandler) VerifyIOC(c *gin.Context) {
+	h.verifySharedItem(c, "shared_iocs", "IOC")
+}
+
+// RemoveRule removes a shared rule with its votes, comments and download history
+func (h *CollaborativeHandler) RemoveRule(c *gin.Context) {
+	h.removeSharedItem(c, "DELETE FROM shared_rules WHERE id = $1", "Rule")
+}
+
+// RemoveIOC removes a shared IOC with its reports
+func (h *CollaborativeHandler) RemoveIOC(c *gin.Context) {
+	h.removeSharedItem(c, "DELETE FROM shared_iocs WHERE id = $1", "IOC")
+}
+
+// RemoveQuery removes a shared hunting query
+func (h *CollaborativeHandler) RemoveQuery(c *gin.Context) {
+	h.removeSharedItem(c, "DELETE FROM hunting_queries WHERE id = $1", "Query")
+}
+
+// RemoveComment removes one comment from a shared rule
+func (h *CollaborativeHandler) RemoveComment(c *gin.Context) {
+	result, err := h.db.Exec("DELETE FROM rule_comments WHERE id = $1 AND rule_id = $2", c.Param("comment_id"), c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to remove comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove comment"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	log.Infof("Moderation: removed comment %s from rule %s", c.Param("comment_id"), c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": "Comment removed"})
+}
+
+// verifySharedItem sets the verification of a row of table, which must have the
+// is_verified, verified_by and verified_at columns
+func (h *CollaborativeHandler) verifySharedItem(c *gin.Context, table, kind string) {
+	var req models.ModerationVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE `+table+`
+		SET is_verified = $1,
+		    verified_by = CASE WHEN $1 THEN $2 ELSE NULL END,
+		    verified_at = CASE WHEN $1 THEN NOW() ELSE NULL END,
+		    updated_at = NOW()
+		WHERE id = $3
+	`, req.Verified, req.VerifiedBy, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to verify %s: %v", kind, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update verification"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+		return
+	}
+
+	log.Infof("Moderation: %s %s verified=%v by %s", kind, c.Param("id"), req.Verified, req.VerifiedBy)
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "is_verified": req.Verified})
+}
+
+// removeSharedItem runs a moderation delete of the item in the path
+func (h *CollaborativeHandler) removeSharedItem(c *gin.Context, query, kind string) {
+	result, err := h.db.Exec(query, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to remove %s: %v", kind, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove " + kind})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": kind + " not found"})
+		return
+	}
+
+	log.Infof("Moderation: removed %s %s", kind, c.Param("id"))
+	c.JSON(http.StatusOK, gin.H{"message": kind + " removed"})
+}
@@ -0,0 +1,538 @@
+// Alert Correlation Engine
+// Automatically groups alerts sharing an entity within a time window into incident cases
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// correlationEntityExpr maps entity types to the SQL expression extracting them from an alert
+var correlationEntityExpr = map[string]string{
+	models.CorrelationEntityAgent: "a.agent_id::text",
+	models.CorrelationEntityHost:  "a.details->>'hostname'",
+	models.CorrelationEntityIP:    "COALESCE(NULLIF(a.details->>'src_ip', ''), a.details->>'dst_ip')",
+	models.CorrelationEntityUser:  "COALESCE(NULLIF(a.details->>'username', ''), a.details->>'user')",
+}
+
+// severityRank orders alert severities so a case takes the highest of its alerts
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// CorrelationEngine groups uncorrelated alerts into cases according to correlation rules
+type CorrelationEngine struct {
+	db *sql.DB
+}
+
+// NewCorrelationEngine creates a new correlation engine
+func NewCorrelationEngine(db *sql.DB) *CorrelationEngine {
+	return &CorrelationEngine{db: db}
+}
+
+// StartCorrelationEngine runs the correlation engine periodically in the background
+func StartCorrelationEngine(db *sql.DB, interval time.Duration) *CorrelationEngine {
+	engine := NewCorrelationEngine(db)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := engine.Run()
+			if err != nil {
+				log.Errorf("Alert correlation failed: %v", err)
+				continue
+			}
+			if result.AlertsCorrelated > 0 {
+				log.Infof("Correlated %d alerts (%d cases created, %d updated)",
+					result.AlertsCorrelated, result.CasesCreated, result.CasesUpdated)
+			}
+		}
+	}()
+
+	log.Infof("Alert correlation engine started (interval: %v)", interval)
+	return engine
+}
+
+// correlatedAlert is an alert candidate for correlation
+type correlatedAlert struct {
+	id        string
+	entity    string
+	severity  string
+	createdAt time.Time
+}
+
+// Run evaluates every enabled correlation rule once
+func (e *CorrelationEngine) Run() (models.CorrelationRunResult, error) {
+	return e.RunLicense("")
+}
+
+// RunLicense evaluates the enabled correlation rules of one license once. An empty licenseID
+// evaluates every license's rules.
+func (e *CorrelationEngine) RunLicense(licenseID string) (models.CorrelationRunResult, error) {
+	result := models.CorrelationRunResult{StartedAt: time.Now()}
+
+	rows, err := e.db.Query(`
+		SELECT id, license_id, name, entity_type, window_minutes, min_alerts
+		FROM correlation_rules
+		WHERE enabled = TRUE AND ($1 = '' OR license_id::text = $1)
+		ORDER BY created_at ASC
+	`, licenseID)
+	if err != nil {
+		return result, fmt.Errorf("failed to load correlation rules: %w", err)
+	}
+
+	rules := []models.CorrelationRule{}
+	for rows.Next() {
+		var rule models.CorrelationRule
+		if err := rows.Scan(&rule.ID, &rule.LicenseID, &rule.Name, &rule.EntityType, &rule.WindowMinutes, &rule.MinAlerts); err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	rows.Close()
+
+	for _, rule := range rules {
+		if err := e.applyRule(rule, &result); err != nil {
+			log.Errorf("Correlation rule %s failed: %v", rule.ID, err)
+			continue
+		}
+		result.RulesEvaluated++
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result, nil
+}
+
+// applyRule groups the rule's uncorrelated alerts by entity and files them into cases
+func (e *CorrelationEngine) applyRule(rule models.CorrelationRule, result *models.CorrelationRunResult) error {
+	expr, ok := correlationEntityExpr[rule.EntityType]
+	if !ok {
+		return fmt.Errorf("unsupported entity type: %s", rule.EntityType)
+	}
+
+	// Alerts already attached to any case are skipped so each alert is correlated once
+	query := fmt.Sprintf(`
+		SELECT a.id, %s AS entity, COALESCE(a.severity, 'medium'), a.created_at
+		FROM alert_instances a
+		JOIN alert_rules r ON a.rule_id = r.id
+		WHERE r.license_id = $1
+		  AND a.created_at >= NOW() - ($2 * INTERVAL '1 minute')
+		  AND a.status IN ('new', 'acknowledged')
+		  AND COALESCE(%s, '') <> ''
+		  AND NOT EXISTS (
+		      SELECT 1 FROM case_items ci
+		      WHERE ci.item_type = 'alert' AND ci.item_id = a.id::text
+		  )
+		ORDER BY a.created_at ASC
+	`, expr, expr)
+
+	rows, err := e.db.Query(query, rule.LicenseID, rule.WindowMinutes)
+	if err != nil {
+		return fmt.Errorf("failed to query alerts: %w", err)
+	}
+
+	groups := make(map[string][]correlatedAlert)
+	order := []string{}
+	for rows.Next() {
+		var alert correlatedAlert
+		if err := rows.Scan(&alert.id, &alert.entity, &alert.severity, &alert.createdAt); err != nil {
+			continue
+		}
+		if _, seen := groups[alert.entity]; !seen {
+			order = append(order, alert.entity)
+		}
+		groups[alert.entity] = append(groups[alert.entity], alert)
+	}
+	rows.Close()
+
+	minAlerts := rule.MinAlerts
+	if minAlerts < 1 {
+		minAlerts = 2
+	}
+
+	for _, entity := range order {
+		alerts := groups[entity]
+		if err := e.correlateGroup(rule, entity, alerts, minAlerts, result); err != nil {
+			log.Errorf("Failed to correlate alerts for %s %s: %v", rule.EntityType, entity, err)
+		}
+	}
+
+	return nil
+}
+
+// correlateGroup attaches a group of alerts to an open correlated case for the entity,
+// opening a new case once the group reaches the rule's threshold
+func (e *CorrelationEngine) correlateGroup(rule models.CorrelationRule, entity string, alerts []correlatedAlert, minAlerts int, result *models.CorrelationRunResult) error {
+	correlationKey := rule.EntityType + ":" + entity
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var caseID string
+	err = tx.QueryRow(`
+		SELECT id FROM cases
+		WHERE license_id = $1 AND correlation_key = $2 AND status <> 'closed'
+		  AND updated_at >= NOW() - ($3 * INTERVAL '1 minute')
+		ORDER BY updated_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`, rule.LicenseID, correlationKey, rule.WindowMinutes).Scan(&caseID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		if len(alerts) < minAlerts {
+			return nil
+		}
+
+		severity := "low"
+		for _, alert := range alerts {
+			if severityRank[alert.severity] > severityRank[severity] {
+				severity = alert.severity
+			}
+		}
+
+		caseID = uuid.New().String()
+		_, err = tx.Exec(`
+			INSERT INTO cases (id, license_id, title, description, status, severity, created_by,
+			                   correlation_rule_id, correlation_key)
+			VALUES ($1, $2, $3, $4, 'open', $5, 'correlation-engine', $6, $7)
+		`,
+			caseID,
+			rule.LicenseID,
+			fmt.Sprintf("Correlated alerts on %s %s", rule.EntityType, entity),
+			fmt.Sprintf("Opened automatically by correlation rule %q", rule.Name),
+			severity,
+			rule.ID,
+			correlationKey,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create case: %w", err)
+		}
+
+		note := fmt.Sprintf("Case opened by correlation rule %q: %d alerts share %s %s", rule.Name, len(alerts), rule.EntityType, entity)
+		if err := insertCaseNote(tx, caseID, "status_change", "correlation-engine", note); err != nil {
+			return err
+		}
+		result.CasesCreated++
+
+	case err != nil:
+		return fmt.Errorf("failed to find correlated case: %w", err)
+
+	default:
+		note := fmt.Sprintf("Correlation rule %q attached %d new alerts", rule.Name, len(alerts))
+		if err := insertCaseNote(tx, caseID, "item_added", "correlation-engine", note); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE cases SET updated_at = NOW() WHERE id = $1", caseID); err != nil {
+			return err
+		}
+		result.CasesUpdated++
+	}
+
+	for _, alert := range alerts {
+		_, err := insertCaseItem(tx, caseID, models.AttachCaseItemRequest{
+			ItemType: models.CaseItemAlert,
+			ItemID:   alert.id,
+			Summary:  fmt.Sprintf("Correlated on %s %s", rule.EntityType, entity),
+			AddedBy:  "correlation-engine",
+		})
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to attach alert: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	result.AlertsCorrelated += len(alerts)
+	return nil
+}
+
+// CorrelationHandler handles correlation rule management and correlation graphs
+type CorrelationHandler struct {
+	db     *sql.DB
+	engine *CorrelationEngine
+}
+
+// NewCorrelationHandler creates a new correlation handler
+func NewCorrelationHandler(db *sql.DB, engine *CorrelationEngine) *CorrelationHandler {
+	if engine == nil {
+		engine = NewCorrelationEngine(db)
+	}
+	return &CorrelationHandler{db: db, engine: engine}
+}
+
+// ListCorrelationRules lists correlation rules for a license
+func (h *CorrelationHandler) ListCorrelationRules(c *gin.Context) {
+	licenseID := c.Query("license_id")
+
+	rows, err := h.db.Query(`
+		SELECT id, license_id, name, description, entity_type, window_minutes,
+		       min_alerts, enabled, created_at, updated_at
+		FROM correlation_rules
+		WHERE license_id = $1
+		ORDER BY created_at DESC
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to list correlation rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list correlation rules"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.CorrelationRule{}
+	for rows.Next() {
+		var rule models.CorrelationRule
+		var description sql.NullString
+		err := rows.Scan(
+			&rule.ID,
+			&rule.LicenseID,
+			&rule.Name,
+			&description,
+			&rule.EntityType,
+			&rule.WindowMinutes,
+			&rule.MinAlerts,
+			&rule.Enabled,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		rule.Description = description.String
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// CreateCorrelationRule creates a new correlation rule
+func (h *CorrelationHandler) CreateCorrelationRule(c *gin.Context) {
+	var req models.CreateCorrelationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if _, ok := correlationEntityExpr[req.EntityType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entity_type must be one of: agent, host, ip, user"})
+		return
+	}
+	if req.MinAlerts < 1 {
+		req.MinAlerts = 2
+	}
+
+	ruleID := uuid.New().String()
+	var createdAt, updatedAt time.Time
+	err := h.db.QueryRow(`
+		INSERT INTO correlation_rules (id, license_id, name, description, entity_type, window_minutes, min_alerts, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at, updated_at
+	`, ruleID, req.LicenseID, req.Name, req.Description, req.EntityType, req.WindowMinutes, req.MinAlerts, req.Enabled).Scan(&createdAt, &updatedAt)
+	if err != nil {
+		log.Errorf("Failed to create correlation rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create correlation rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CorrelationRule{
+		ID:            ruleID,
+		LicenseID:     req.LicenseID,
+		Name:          req.Name,
+		Description:   req.Description,
+		EntityType:    req.EntityType,
+		WindowMinutes: req.WindowMinutes,
+		MinAlerts:     req.MinAlerts,
+		Enabled:       req.Enabled,
+		CreatedAt:     createdAt,
+		UpdatedAt:     updatedAt,
+	})
+}
+
+// UpdateCorrelationRule updates a correlation rule of the caller's license
+func (h *CorrelationHandler) UpdateCorrelationRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateCorrelationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if req.WindowMinutes != nil && *req.WindowMinutes < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window_minutes must be at least 1"})
+		return
+	}
+	if req.MinAlerts != nil && *req.MinAlerts < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_alerts must be at least 1"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE correlation_rules
+		SET name = COALESCE($1, name),
+		    description = COALESCE($2, description),
+		    window_minutes = COALESCE($3, window_minutes),
+		    min_alerts = COALESCE($4, min_alerts),
+		    enabled = COALESCE($5, enabled),
+		    updated_at = NOW()
+		WHERE id = $6 AND ($7 = '' OR license_id::text = $7)
+	`, req.Name, req.Description, req.WindowMinutes, req.MinAlerts, req.Enabled, id, principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to update correlation rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update correlation rule"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Correlation rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Correlation rule updated successfully"})
+}
+
+// DeleteCorrelationRule deletes a correlation rule of the caller's license
+func (h *CorrelationHandler) DeleteCorrelationRule(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.db.Exec("DELETE FROM correlation_rules WHERE id = $1 AND ($2 = '' OR license_id::text = $2)", id, principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to delete correlation rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete correlation rule"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Correlation rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Correlation rule deleted successfully"})
+}
+
+// RunCorrelation triggers an immediate correlation pass. Callers confined to a license only
+// run their license's rules.
+func (h *CorrelationHandler) RunCorrelation(c *gin.Context) {
+	result, err := h.engine.RunLicense(principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to run correlation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run correlation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCorrelationGraph returns the alerts of a case linked to the entities they share
+func (h *CorrelationHandler) GetCorrelationGraph(c *gin.Context) {
+	caseID := c.Param("id")
+
+	var exists bool
+	if err := h.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM cases WHERE id = $1 AND ($2 = '' OR license_id::text = $2))",
+		caseID, principalLicense(c),
+	).Scan(&exists); err != nil {
+		log.Errorf("Failed to check case: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build correlation graph"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Case not found"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT a.id, a.agent_id, a.severity, a.message, a.details, a.created_at
+		FROM case_items ci
+		JOIN alert_instances a ON ci.item_id = a.id::text
+		WHERE ci.case_id = $1 AND ci.item_type = 'alert'
+		ORDER BY a.created_at ASC
+	`, caseID)
+	if err != nil {
+		log.Errorf("Failed to load case alerts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build correlation graph"})
+		return
+	}
+	defer rows.Close()
+
+	graph := models.CorrelationGraph{
+		CaseID: caseID,
+		Nodes:  []models.GraphNode{},
+		Edges:  []models.GraphEdge{},
+	}
+	entityNodes := make(map[string]bool)
+
+	addEntity := func(alertNode, entityType, value string) {
+		if value == "" {
+			return
+		}
+		nodeID := entityType + ":" + value
+		if !entityNodes[nodeID] {
+			entityNodes[nodeID] = true
+			graph.Nodes = append(graph.Nodes, models.GraphNode{ID: nodeID, Type: entityType, Label: value})
+		}
+		graph.Edges = append(graph.Edges, models.GraphEdge{Source: alertNode, Target: nodeID, Relation: "involves"})
+	}
+
+	for rows.Next() {
+		var alertID string
+		var agentID, severity, message sql.NullString
+		var detailsJSON []byte
+		var createdAt time.Time
+
+		if err := rows.Scan(&alertID, &agentID, &severity, &message, &detailsJSON, &createdAt); err != nil {
+			continue
+		}
+
+		details := map[string]interface{}{}
+		json.Unmarshal(detailsJSON, &details)
+
+		alertNode := "alert:" + alertID
+		graph.Nodes = append(graph.Nodes, models.GraphNode{
+			ID:    alertNode,
+			Type:  "alert",
+			Label: message.String,
+			Data: map[string]interface{}{
+				"severity":   severity.String,
+				"created_at": createdAt,
+			},
+		})
+
+		addEntity(alertNode, models.CorrelationEntityAgent, agentID.String)
+		addEntity(alertNode, models.CorrelationEntityHost, payloadString(details, "hostname"))
+		addEntity(alertNode, models.CorrelationEntityIP, payloadString(details, "src_ip"))
+		addEntity(alertNode, models.CorrelationEntityIP, payloadString(details, "dst_ip"))
+		user := payloadString(details, "username")
+		if user == "" {
+			user = payloadString(details, "user")
+		}
+		addEntity(alertNode, models.CorrelationEntityUser, user)
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+)
+
+func TestCorrelationRulesConfinedToLicense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		license    string
+		wantStatus int
+	}{
+		{"same license", "lic-a", http.StatusOK},
+		{"other license", "lic-b", http.StatusNotFound},
+		{"platform principal", "", http.StatusOK},
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		for _, tt := range tests {
+			t.Run(method+" "+tt.name, func(t *testing.T) {
+				// rule-1 belongs to lic-a
+				db, _ := newFakeDB(func(query string, args []driver.Value) (fakeResult, error) {
+					if !strings.Contains(query, "license_id::text") {
+						t.Errorf("correlation rule statement is not confined to a license: %s", query)
+					}
+					if scope := args[len(args)-1].(string); scope != "" && scope != "lic-a" {
+						return fakeResult{}, nil
+					}
+					return fakeResult{affected: 1}, nil
+				})
+				h := NewCorrelationHandler(db, nil)
+
+				router := gin.New()
+				router.Use(func(c *gin.Context) {
+					if tt.license != "" {
+						c.Set(middleware.ContextUserLicense, tt.license)
+					}
+				})
+				router.PUT("/correlation/rules/:id", h.UpdateCorrelationRule)
+				router.DELETE("/correlation/rules/:id", h.DeleteCorrelationRule)
+
+				req := httptest.NewRequest(method, "/correlation/rules/rule-1", strings.NewReader(`{"enabled":false}`))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRunCorrelationScopedToLicense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, license := range []string{"lic-a", ""} {
+		var scope interface{}
+		db, _ := newFakeDB(func(query string, args []driver.Value) (fakeResult, error) {
+			if strings.Contains(query, "FROM correlation_rules") {
+				scope = args[0]
+			}
+			return fakeResult{columns: []string{"id", "license_id", "name", "entity_type", "window_minutes", "min_alerts"}}, nil
+		})
+		h := NewCorrelationHandler(db, nil)
+
+		router := gin.New()
+		router.POST("/correlation/run", func(c *gin.Context) {
+			if license != "" {
+				c.Set(middleware.ContextAPIKeyLicense, license)
+			}
+			h.RunCorrelation(c)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/correlation/run", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("license %q: status = %d, want %d", license, w.Code, http.StatusOK)
+		}
+		if scope != license {
+			t.Errorf("license %q: rules loaded for %v", license, scope)
+		}
+	}
+}
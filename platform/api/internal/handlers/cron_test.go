@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+		check   func(s *cronSchedule) bool
+	}{
+		{"every minute", "* * * * *", false, func(s *cronSchedule) bool { return s.minute == 1<<60-1 && !s.domRestricted && !s.dowRestricted }},
+		{"step", "*/15 * * * *", false, func(s *cronSchedule) bool { return s.minute == 1|1<<15|1<<30|1<<45 }},
+		{"range with step", "0 8-18/5 * * *", false, func(s *cronSchedule) bool { return s.hour == 1<<8|1<<13|1<<18 }},
+		{"value with step runs to the end", "0 20/2 * * *", false, func(s *cronSchedule) bool { return s.hour == 1<<20|1<<22 }},
+		{"list", "0,30 * * * *", false, func(s *cronSchedule) bool { return s.minute == 1|1<<30 }},
+		{"weekday names", "0 9 * * mon-fri", false, func(s *cronSchedule) bool { return s.dow == 0b0111110 && s.dowRestricted }},
+		{"month names", "0 0 1 jan,JUL *", false, func(s *cronSchedule) bool { return s.month == 1<<1|1<<7 }},
+		{"sunday as 7", "0 0 * * 7", false, func(s *cronSchedule) bool { return s.dow == 1 }},
+		{"macro", "@daily", false, func(s *cronSchedule) bool { return s.minute == 1 && s.hour == 1 }},
+		{"question mark", "0 0 ? * *", false, func(s *cronSchedule) bool { return !s.domRestricted }},
+		{"too few fields", "* * * *", true, nil},
+		{"too many fields", "* * * * * *", true, nil},
+		{"minute out of range", "60 * * * *", true, nil},
+		{"day of month zero", "0 0 0 * *", true, nil},
+		{"zero step", "*/0 * * * *", true, nil},
+		{"inverted range", "0 5-1 * * *", true, nil},
+		{"unknown name", "0 0 * * fun", true, nil},
+		{"unknown macro", "@fortnightly", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && !tt.check(sched) {
+				t.Errorf("parseCron(%q) = %+v", tt.expr, *sched)
+			}
+		})
+	}
+}
+
+func TestNextCronRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		from     string
+		want     string
+		wantErr  bool
+	}{
+		{"next step", "*/15 * * * *", "UTC", "2024-01-01T10:07:30Z", "2024-01-01T10:15:00Z", false},
+		{"strictly after", "0 10 * * *", "UTC", "2024-01-01T10:00:00Z", "2024-01-02T10:00:00Z", false},
+		{"skips the weekend", "0 9 * * mon-fri", "UTC", "2024-01-06T12:00:00Z", "2024-01-08T09:00:00Z", false},
+		{"sunday as 7", "0 0 * * 7", "UTC", "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z", false},
+		{"day of month or weekday", "0 0 13 * fri", "UTC", "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z", false},
+		{"next month", "0 0 1 * *", "UTC", "2024-01-31T23:59:00Z", "2024-02-01T00:00:00Z", false},
+		{"leap day", "0 0 29 2 *", "UTC", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z", false},
+		{"time zone", "@daily", "America/New_York", "2024-01-01T12:00:00Z", "2024-01-02T05:00:00Z", false},
+		{"skipped by DST", "30 2 * * *", "America/New_York", "2024-03-09T12:00:00Z", "2024-03-11T06:30:00Z", false},
+		{"never matches", "0 0 30 2 *", "UTC", "2024-01-01T00:00:00Z", "", true},
+		{"invalid expression", "0 0 * *", "UTC", "2024-01-01T00:00:00Z", "", true},
+		{"unknown time zone", "0 0 * * *", "Mars/Olympus", "2024-01-01T00:00:00Z", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			got, err := nextCronRun(tt.expr, tt.timezone, from)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nextCronRun(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !got.Equal(want) {
+				t.Errorf("nextCronRun(%q, %s, %s) = %s, want %s", tt.expr, tt.timezone, tt.from, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
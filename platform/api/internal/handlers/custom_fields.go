@@ -0,0 +1,467 @@
+// Custom Telemetry Fields
+// Tenant-defined payload fields materialized as ClickHouse columns for fast filtering
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+var (
+	customFieldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+	// Payload keys are embedded in column DDL, so only plain identifiers are accepted
+	customFieldKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}(\.[A-Za-z0-9_-]{1,64}){0,4}$`)
+	customFieldSanitize   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// customFieldTypes maps field types to their ClickHouse column type, extraction function and
+// skipping index
+var customFieldTypes = map[string]struct {
+	column  string
+	extract string
+	index   string
+}{
+	models.CustomFieldString: {"String", "JSONExtractString", "bloom_filter(0.01)"},
+	models.CustomFieldInt:    {"Int64", "JSONExtractInt", "minmax"},
+	models.CustomFieldFloat:  {"Float64", "JSONExtractFloat", "minmax"},
+	models.CustomFieldBool:   {"UInt8", "JSONExtractBool", "set(2)"},
+}
+
+const customFieldColumns = `id, license_id, name, payload_key, field_type, column_name, indexed, COALESCE(created_by, ''), created_at`
+
+// CustomFieldHandler handles custom field configuration
+type CustomFieldHandler struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+}
+
+// NewCustomFieldHandler creates a new custom field handler
+func NewCustomFieldHandler(db *sql.DB, ch driver.Conn) *CustomFieldHandler {
+	return &CustomFieldHandler{db: db, clickhouse: ch}
+}
+
+// customFieldColumn names the column for a payload key and type. The name depends only on the
+// key and type, so tenants extracting the same field share one column.
+func customFieldColumn(payloadKey, fieldType string) string {
+	sum := sha256.Sum256([]byte(payloadKey))
+	name := strings.Trim(customFieldSanitize.ReplaceAllString(strings.ToLower(payloadKey), "_"), "_")
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("cf_%s_%s_%s", fieldType, name, hex.EncodeToString(sum[:4]))
+}
+
+// customFieldExtract builds the materialization expression, e.g.
+// JSONExtractString(payload, 'http', 'user_agent')
+func customFieldExtract(payloadKey, fieldType string) string {
+	path := strings.Split(payloadKey, ".")
+	for i, part := range path {
+		path[i] = "'" + part + "'"
+	}
+	return fmt.Sprintf("%s(payload, %s)", customFieldTypes[fieldType].extract, strings.Join(path, ", "))
+}
+
+// CreateCustomField defines a custom field and adds its materialized column. Existing events are
+// extracted on read until ClickHouse merges their parts, so the field is queryable immediately.
+func (h *CustomFieldHandler) CreateCustomField(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.CreateCustomFieldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.Type == "" {
+		req.Type = models.CustomFieldString
+	}
+	if _, ok := customFieldTypes[req.Type]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of string, int, float, bool"})
+		return
+	}
+	if !customFieldNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be lowercase letters, digits and underscores, starting with a letter"})
+		return
+	}
+	if !customFieldKeyPattern.MatchString(req.PayloadKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "payload_key must be a dotted path of letters, digits, '_' and '-'"})
+		return
+	}
+
+	column := customFieldColumn(req.PayloadKey, req.Type)
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The column is in use again, so a pending drop must not remove it
+	if err := lockCustomFieldColumn(tx, column); err != nil {
+		log.Errorf("Failed to lock custom field column %s: %v", column, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM custom_field_column_drops WHERE column_name = $1", column); err != nil {
+		log.Errorf("Failed to cancel drop of custom field column %s: %v", column, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+	if err := h.ensureColumn(c.Request.Context(), column, req.PayloadKey, req.Type, req.Indexed); err != nil {
+		log.Errorf("Failed to add custom field column %s: %v", column, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+
+	row := tx.QueryRow(`
+		INSERT INTO custom_fields (license_id, name, payload_key, field_type, column_name, indexed, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING `+customFieldColumns,
+		req.LicenseID, req.Name, req.PayloadKey, req.Type, column, req.Indexed, req.CreatedBy)
+	field, err := scanCustomField(row)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Custom field already exists"})
+			return
+		}
+		log.Errorf("Failed to create custom field: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit custom field: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create custom field"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, field)
+}
+
+// ListCustomFields lists the custom fields of a license
+func (h *CustomFieldHandler) ListCustomFields(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id is required"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT `+customFieldColumns+` FROM custom_fields WHERE license_id = $1 ORDER BY name`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to list custom fields: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list custom fields"})
+		return
+	}
+	defer rows.Close()
+
+	fields := []models.CustomField{}
+	for rows.Next() {
+		field, err := scanCustomField(rows)
+		if err != nil {
+			log.Errorf("Failed to scan custom field: %v", err)
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": fields, "count": len(fields)})
+}
+
+// DeleteCustomField removes a field definition. A column no license defines any more is queued
+// for the custom_field_cleanup job: dropping a column waits on the table's running merges, which
+// is too slow and too heavy for a request.
+func (h *CustomFieldHandler) DeleteCustomField(c *gin.Context) {
+	id, licenseID := c.Param("id"), principalLicense(c)
+
+	var column string
+	err := h.db.QueryRow(
+		"SELECT column_name FROM custom_fields WHERE id::text = $1 AND ($2 = '' OR license_id::text = $2)",
+		id, licenseID,
+	).Scan(&column)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom field not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get custom field: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomFieldColumn(tx, column); err != nil {
+		log.Errorf("Failed to lock custom field column %s: %v", column, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+	result, err := tx.Exec(
+		"DELETE FROM custom_fields WHERE id::text = $1 AND ($2 = '' OR license_id::text = $2)",
+		id, licenseID,
+	)
+	if err != nil {
+		log.Errorf("Failed to delete custom field: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom field not found"})
+		return
+	}
+
+	var remaining int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM custom_fields WHERE column_name = $1", column).Scan(&remaining); err != nil {
+		log.Errorf("Failed to check custom field column usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+	if remaining == 0 {
+		if _, err := tx.Exec(`
+			INSERT INTO custom_field_column_drops (column_name) VALUES ($1)
+			ON CONFLICT (column_name) DO NOTHING
+		`, column); err != nil {
+			log.Errorf("Failed to queue drop of custom field column %s: %v", column, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit custom field deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field deleted successfully"})
+}
+
+// RunColumnCleanup is the custom_field_cleanup scheduled job: it drops the ClickHouse columns,
+// and their indexes, that deleted custom fields left unused
+func (h *CustomFieldHandler) RunColumnCleanup(job models.ScheduledJob) (string, error) {
+	if h.clickhouse == nil {
+		return "", fmt.Errorf("ClickHouse connection not available")
+	}
+
+	rows, err := h.db.Query("SELECT column_name FROM custom_field_column_drops ORDER BY requested_at")
+	if err != nil {
+		return "", fmt.Errorf("failed to load queued column drops: %w", err)
+	}
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to load queued column drops: %w", err)
+		}
+		columns = append(columns, column)
+	}
+	rows.Close()
+
+	dropped, failed := 0, 0
+	for _, column := range columns {
+		ok, err := h.dropColumn(column)
+		if err != nil {
+			log.Warnf("Failed to drop custom field column %s: %v", column, err)
+			failed++
+			continue
+		}
+		if ok {
+			dropped++
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("%d of %d unused custom field columns could not be dropped", failed, len(columns))
+	}
+	return fmt.Sprintf("%d unused custom field columns dropped", dropped), nil
+}
+
+// dropColumn drops a queued column, holding the column lock so no field can be defined on it
+// meanwhile. It reports false when a field was defined on the column again since it was queued.
+// On failure the column stays queued for the next run.
+func (h *CustomFieldHandler) dropColumn(column string) (bool, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCustomFieldColumn(tx, column); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec("DELETE FROM custom_field_column_drops WHERE column_name = $1", column)
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return false, nil
+	}
+	var inUse bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM custom_fields WHERE column_name = $1)", column).Scan(&inUse); err != nil {
+		return false, err
+	}
+
+	if !inUse {
+		ctx := context.Background()
+		if err := h.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE telemetry_events DROP INDEX IF EXISTS idx_%s", column)); err != nil {
+			return false, err
+		}
+		if err := h.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE telemetry_events DROP COLUMN IF EXISTS %s", column)); err != nil {
+			return false, err
+		}
+	}
+	return !inUse, tx.Commit()
+}
+
+// lockCustomFieldColumn serializes, until tx ends, everything that decides whether a column is
+// in use: defining a field on it, deleting one and dropping the column
+func lockCustomFieldColumn(tx *sql.Tx, column string) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('custom_field_column:' || $1))", column)
+	return err
+}
+
+// ensureColumn adds the materialized column, and its skipping index when requested
+func (h *CustomFieldHandler) ensureColumn(ctx context.Context, column, payloadKey, fieldType string, indexed bool) error {
+	spec := customFieldTypes[fieldType]
+	if err := h.clickhouse.Exec(ctx, fmt.Sprintf(
+		"ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS %s %s MATERIALIZED %s",
+		column, spec.column, customFieldExtract(payloadKey, fieldType),
+	)); err != nil {
+		return err
+	}
+	if !indexed {
+		return nil
+	}
+
+	if err := h.clickhouse.Exec(ctx, fmt.Sprintf(
+		"ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_%s %s TYPE %s GRANULARITY 4",
+		column, column, spec.index,
+	)); err != nil {
+		return err
+	}
+	// Build the index for existing parts in the background; new parts are indexed on insert
+	if err := h.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE telemetry_events MATERIALIZE INDEX idx_%s", column)); err != nil {
+		log.Warnf("Failed to materialize custom field index %s: %v", column, err)
+	}
+	return nil
+}
+
+func scanCustomField(row rowScanner) (models.CustomField, error) {
+	var field models.CustomField
+	err := row.Scan(&field.ID, &field.LicenseID, &field.Name, &field.PayloadKey, &field.Type,
+		&field.Column, &field.Indexed, &field.CreatedBy, &field.CreatedAt)
+	return field, err
+}
+
+// customFieldFilters builds the WHERE clauses for a query's custom field filters, resolving
+// field names against the tenant's definitions
+func customFieldFilters(db *sql.DB, tenantID string, filters map[string][]string) (string, []interface{}, error) {
+	if len(filters) == 0 {
+		return "", nil, nil
+	}
+
+	rows, err := db.Query("SELECT name, field_type, column_name FROM custom_fields WHERE license_id = $1", tenantID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	type definition struct{ fieldType, column string }
+	defined := make(map[string]definition)
+	for rows.Next() {
+		var name string
+		var def definition
+		if err := rows.Scan(&name, &def.fieldType, &def.column); err != nil {
+			return "", nil, err
+		}
+		defined[name] = def
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+
+	var clauses strings.Builder
+	args := []interface{}{}
+	for name, values := range filters {
+		def, ok := defined[name]
+		if !ok {
+			return "", nil, &customFieldError{fmt.Sprintf("unknown custom field %q", name)}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			arg, err := customFieldValue(def.fieldType, value)
+			if err != nil {
+				return "", nil, &customFieldError{fmt.Sprintf("custom field %q: %v", name, err)}
+			}
+			placeholders[i] = "?"
+			args = append(args, arg)
+		}
+		clauses.WriteString(" AND " + def.column + " IN (" + strings.Join(placeholders, ",") + ")")
+	}
+	return clauses.String(), args, nil
+}
+
+// customFieldFilters resolves a telemetry query's custom field filters, writing the error
+// response and returning false when they cannot be applied
+func (h *TelemetryHandler) customFieldFilters(c *gin.Context, req models.QueryEventsRequest) (string, []interface{}, bool) {
+	clauses, args, err := customFieldFilters(h.db, req.TenantID, req.CustomFields)
+	if err != nil {
+		if _, invalid := err.(*customFieldError); invalid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return "", nil, false
+		}
+		log.Errorf("Failed to resolve custom field filters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve custom field filters"})
+		return "", nil, false
+	}
+	return clauses, args, true
+}
+
+// customFieldValue converts a filter value to the column's type
+func customFieldValue(fieldType, value string) (interface{}, error) {
+	switch fieldType {
+	case models.CustomFieldInt:
+		return strconv.ParseInt(value, 10, 64)
+	case models.CustomFieldFloat:
+		return strconv.ParseFloat(value, 64)
+	case models.CustomFieldBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return uint8(1), nil
+		}
+		return uint8(0), nil
+	}
+	return value, nil
+}
+
+// customFieldError is a custom field filter the caller got wrong, as opposed to a lookup failure
+type customFieldError struct{ message string }
+
+func (e *customFieldError) Error() string { return e.message }
@@ -11,39 +11,65 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/api/option"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
+	"github.com/sentinel-enterprise/platform/secrets"
 )
 
 // DataLakeHandler handles data lake operations
 type DataLakeHandler struct {
-	db *sql.DB
+	db         *sql.DB
+	clickhouse driver.Conn // Restore target; restores are unavailable without it
+	archiveKey []byte      // AES-256 key of client-side encrypted datasets
+
+	secretProvider secrets.SecretProvider // Holds storage credentials; nil keeps them in Postgres
+	queryCache     *archiveQueryCache     // Archived-data query results; nil disables caching
+
+	queryConcurrency int // Datasets scanned in parallel by archived-data queries
+
+	residencyShards map[string]string // ClickHouse shard per residency zone; empty when unsharded
 }
 
 // NewDataLakeHandler creates a new data lake handler
 func NewDataLakeHandler(db *sql.DB) *DataLakeHandler {
-	return &DataLakeHandler{db: db}
+	return &DataLakeHandler{
+		db:         db,
+		queryCache: newArchiveQueryCache(time.Hour, 256),
+	}
+}
+
+// SetSecretProvider stores storage credentials in the secrets backend instead of data_lake_configs
+func (h *DataLakeHandler) SetSecretProvider(provider secrets.SecretProvider) {
+	h.secretProvider = provider
+}
+
+// dataLakeSecretName names a license's storage credential in the secrets backend
+func dataLakeSecretName(licenseID, key string) string {
+	return "datalake/" + licenseID + "/" + key
 }
 
 // CreateDataLakeConfig creates a new data lake configuration
 func (h *DataLakeHandler) CreateDataLakeConfig(c *gin.Context) {
 	var req models.CreateDataLakeConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -53,9 +79,41 @@ func (h *DataLakeHandler) CreateDataLakeConfig(c *gin.Context) {
 		return
 	}
 
+	// Licenses pinned to a zone must store data in one of its regions
+	residency, err := h.loadResidency(req.LicenseID)
+	if err != nil {
+		log.Errorf("Failed to load data residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create configuration"})
+		return
+	}
+	if residency != nil {
+		if req.Region == "" {
+			req.Region = residency.DefaultRegion
+		}
+		if !residencyAllows(residency, req.Provider, req.Region) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("region %q is not allowed by the license's %s data residency", req.Region, residency.Zone)})
+			return
+		}
+	}
+
 	configID := uuid.New().String()
 
-	// Store configuration (encrypt sensitive data in production)
+	// Storage credentials go to the secrets backend; the table keeps only references
+	for name, value := range map[string]*string{
+		"access_key":       &req.AccessKey,
+		"secret_key":       &req.SecretKey,
+		"credentials_json": &req.CredentialsJSON,
+	} {
+		stored, err := secrets.Store(c.Request.Context(), h.secretProvider, dataLakeSecretName(req.LicenseID, name), *value)
+		if err != nil {
+			log.Errorf("Failed to store data lake credentials: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store credentials"})
+			return
+		}
+		*value = stored
+	}
+
+	// Store configuration
 	query := `
 		INSERT INTO data_lake_configs (
 			id, license_id, provider, enabled, bucket_name, region,
@@ -70,16 +128,16 @@ func (h *DataLakeHandler) CreateDataLakeConfig(c *gin.Context) {
 	metadata, _ := json.Marshal(req.Metadata)
 	var createdAt, updatedAt time.Time
 
-	err := h.db.QueryRow(query,
+	err = h.db.QueryRow(query,
 		configID,
 		req.LicenseID,
 		req.Provider,
 		req.BucketName,
 		req.Region,
-		req.AccessKey, // In production, encrypt with KMS
-		req.SecretKey, // In production, encrypt with KMS
+		req.AccessKey,
+		req.SecretKey,
 		req.ProjectID,
-		req.CredentialsJSON, // In production, encrypt with KMS
+		req.CredentialsJSON,
 		req.RetentionPolicy.HotStorageDays,
 		req.RetentionPolicy.WarmStorageDays,
 		req.RetentionPolicy.ColdStorageDays,
@@ -176,10 +234,31 @@ func (h *DataLakeHandler) UpdateDataLakeConfig(c *gin.Context) {
 
 	var req models.UpdateDataLakeConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
+	if req.Region != nil {
+		var provider models.DataLakeProvider
+		err := h.db.QueryRow("SELECT provider FROM data_lake_configs WHERE license_id = $1", licenseID).Scan(&provider)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuration not found"})
+			return
+		}
+		if err == nil {
+			err = h.checkResidency(licenseID, provider, *req.Region)
+		}
+		if errors.Is(err, errResidencyViolation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to check data residency: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update configuration"})
+			return
+		}
+	}
+
 	query := `
 		UPDATE data_lake_configs
 		SET enabled = COALESCE($1, enabled),
@@ -189,6 +268,8 @@ func (h *DataLakeHandler) UpdateDataLakeConfig(c *gin.Context) {
 		    delete_after_days = COALESCE($5, delete_after_days),
 		    compression_type = COALESCE($6, compression_type),
 		    encryption_enabled = COALESCE($7, encryption_enabled),
+		    region = COALESCE($9, region),
+		    bucket_name = COALESCE($10, bucket_name),
 		    updated_at = NOW()
 		WHERE license_id = $8
 	`
@@ -210,6 +291,8 @@ func (h *DataLakeHandler) UpdateDataLakeConfig(c *gin.Context) {
 		req.CompressionType,
 		req.EncryptionEnabled,
 		licenseID,
+		req.Region,
+		req.BucketName,
 	)
 
 	if err != nil {
@@ -231,37 +314,26 @@ func (h *DataLakeHandler) UpdateDataLakeConfig(c *gin.Context) {
 func (h *DataLakeHandler) CreateArchiveJob(c *gin.Context) {
 	var req models.CreateArchiveJobRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
-	jobID := uuid.New().String()
-
-	query := `
-		INSERT INTO archive_jobs (
-			id, license_id, job_type, status, start_time,
-			source_location, target_location, metadata
-		) VALUES ($1, $2, $3, $4, NOW(), $5, $6, $7)
-		RETURNING created_at
-	`
-
-	metadata, _ := json.Marshal(req.Metadata)
-	var createdAt time.Time
-
-	sourceLocation := fmt.Sprintf("clickhouse://events/%s/%s",
-		req.StartDate.Format("2006-01-02"),
-		req.EndDate.Format("2006-01-02"))
+	if req.JobType == models.JobTypeRestore {
+		h.createRestoreJob(c, req)
+		return
+	}
 
-	err := h.db.QueryRow(query,
-		jobID,
-		req.LicenseID,
-		req.JobType,
-		models.JobStatusPending,
-		sourceLocation,
-		req.TargetLocation,
-		metadata,
-	).Scan(&createdAt)
+	if err := h.checkDataLakeResidency(req.LicenseID); err != nil {
+		if errors.Is(err, errResidencyViolation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		log.Errorf("Failed to check data residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create archive job"})
+		return
+	}
 
+	jobID, sourceLocation, createdAt, err := h.insertArchiveJob(req)
 	if err != nil {
 		log.Errorf("Failed to create archive job: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create archive job"})
@@ -297,7 +369,7 @@ func (h *DataLakeHandler) GetArchiveJob(c *gin.Context) {
 	query := `
 		SELECT id, license_id, job_type, status, start_time, end_time,
 		       events_processed, bytes_processed, source_location,
-		       target_location, error, progress, metadata,
+		       COALESCE(target_location, ''), COALESCE(error, ''), progress, metadata,
 		       created_at, updated_at
 		FROM archive_jobs
 		WHERE id = $1
@@ -337,9 +409,26 @@ func (h *DataLakeHandler) GetArchiveJob(c *gin.Context) {
 
 	json.Unmarshal(metadataJSON, &job.Metadata)
 
+	if job.JobType == models.JobTypeRestore {
+		if job.Datasets, err = h.restoreProgress(job.ID); err != nil {
+			log.Warnf("Failed to load restore progress for job %s: %v", job.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, job)
 }
 
+// ArchiveJobLicense returns the license of the archive job in the path, or "" if there is no
+// such job. It resolves the license for the feature gate on routes addressed by job ID.
+func (h *DataLakeHandler) ArchiveJobLicense(c *gin.Context) (string, error) {
+	var licenseID sql.NullString
+	err := h.db.QueryRow("SELECT license_id FROM archive_jobs WHERE id::text = $1", c.Param("id")).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return licenseID.String, err
+}
+
 // ListArchiveJobs lists archive jobs for a license
 func (h *DataLakeHandler) ListArchiveJobs(c *gin.Context) {
 	licenseID := c.Query("license_id")
@@ -348,7 +437,7 @@ func (h *DataLakeHandler) ListArchiveJobs(c *gin.Context) {
 	query := `
 		SELECT id, license_id, job_type, status, start_time, end_time,
 		       events_processed, bytes_processed, source_location,
-		       target_location, error, progress, created_at, updated_at
+		       COALESCE(target_location, ''), COALESCE(error, ''), progress, created_at, updated_at
 		FROM archive_jobs
 		WHERE license_id = $1
 	`
@@ -465,7 +554,7 @@ func (h *DataLakeHandler) ListArchivedDatasets(c *gin.Context) {
 func (h *DataLakeHandler) QueryArchivedData(c *gin.Context) {
 	var req models.QueryArchivedDataRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -473,15 +562,22 @@ func (h *DataLakeHandler) QueryArchivedData(c *gin.Context) {
 
 	// Get relevant datasets
 	query := `
-		SELECT id, storage_path, compressed_size
+		SELECT id, dataset_name, storage_path, event_count, compressed_size,
+		       COALESCE(compression_type, ''), COALESCE(is_encrypted, FALSE), COALESCE(checksum, ''),
+		       COALESCE(metadata->>'encryption', '')
 		FROM archived_datasets
 		WHERE license_id = $1
 		  AND start_date <= $2
 		  AND end_date >= $3
-		ORDER BY start_date
 	`
+	args := []interface{}{req.LicenseID, req.EndDate, req.StartDate}
+	if len(req.DatasetIDs) > 0 {
+		query += " AND id = ANY($4)"
+		args = append(args, pq.Array(req.DatasetIDs))
+	}
+	query += " ORDER BY start_date"
 
-	rows, err := h.db.Query(query, req.LicenseID, req.EndDate, req.StartDate)
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		log.Errorf("Failed to query datasets: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query datasets"})
@@ -489,20 +585,20 @@ func (h *DataLakeHandler) QueryArchivedData(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var datasetPaths []string
-	var totalSize int64
+	var datasets []pendingDataset
+	var datasetVersions []string
 
 	for rows.Next() {
-		var id, path string
-		var size int64
-		if err := rows.Scan(&id, &path, &size); err != nil {
+		var d pendingDataset
+		if err := rows.Scan(&d.id, &d.name, &d.storagePath, &d.eventCount, &d.compressedSize,
+			&d.compressionType, &d.isEncrypted, &d.checksum, &d.encryption); err != nil {
 			continue
 		}
-		datasetPaths = append(datasetPaths, path)
-		totalSize += size
+		datasets = append(datasets, d)
+		datasetVersions = append(datasetVersions, d.id+":"+d.checksum)
 	}
 
-	if len(datasetPaths) == 0 {
+	if len(datasets) == 0 {
 		c.JSON(http.StatusOK, models.QueryArchivedDataResponse{
 			Results:         []map[string]interface{}{},
 			TotalEvents:     0,
@@ -512,24 +608,50 @@ func (h *DataLakeHandler) QueryArchivedData(c *gin.Context) {
 		return
 	}
 
-	// In production, implement actual querying from S3/GCS
-	// This is a placeholder response
-	results := []map[string]interface{}{
-		{
-			"message": "Archived data query not fully implemented",
-			"datasets_found": len(datasetPaths),
-			"total_size_bytes": totalSize,
-		},
+	// Repeated queries over the same datasets are served from the cache
+	cacheKey := archiveQueryKey(req, datasetVersions)
+	if h.queryCache != nil && !req.NoCache {
+		if cached, ok := h.queryCache.get(cacheKey); ok {
+			cached.CacheHit = true
+			cached.DataScannedGB = 0
+			cached.QueryTimeMs = time.Since(startTime).Milliseconds()
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+	}
+
+	lake, err := h.loadDataLakeConfig(req.LicenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data lake configuration not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load data lake configuration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load data lake configuration"})
+		return
 	}
 
-	queryTime := time.Since(startTime).Milliseconds()
+	scan, err := h.scanArchivedDatasets(c.Request.Context(), req, lake, datasets)
+	if err != nil {
+		log.Errorf("Failed to query archived data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to query archived data: %v", err)})
+		return
+	}
 
 	response := models.QueryArchivedDataResponse{
-		Results:         results,
-		TotalEvents:     0,
-		DatasetsQueried: len(datasetPaths),
-		QueryTimeMs:     queryTime,
-		DataScannedGB:   float64(totalSize) / (1024 * 1024 * 1024),
+		Results:         scan.results,
+		TotalEvents:     scan.matched,
+		DatasetsQueried: len(datasets),
+		QueryTimeMs:     time.Since(startTime).Milliseconds(),
+		DataScannedGB:   float64(scan.bytesDownloaded) / (1024 * 1024 * 1024),
+		Truncated:       scan.truncated,
+	}
+	if req.IncludeMetrics {
+		response.Metrics = scan.metrics()
+	}
+
+	if h.queryCache != nil {
+		h.queryCache.put(cacheKey, response)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -608,7 +730,7 @@ func (h *DataLakeHandler) GetDataLakeStatistics(c *gin.Context) {
 func (h *DataLakeHandler) TestDataLakeConnection(c *gin.Context) {
 	var req models.TestDataLakeConnectionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -765,7 +887,50 @@ func (h *DataLakeHandler) testGCSConnection(req models.TestDataLakeConnectionReq
 	}
 }
 
+// insertArchiveJob records a pending archive job and returns its ID, source location and creation time
+func (h *DataLakeHandler) insertArchiveJob(req models.CreateArchiveJobRequest) (string, string, time.Time, error) {
+	jobID := uuid.New().String()
+
+	query := `
+		INSERT INTO archive_jobs (
+			id, license_id, job_type, status, start_time,
+			source_location, target_location, metadata
+		) VALUES ($1, $2, $3, $4, NOW(), $5, $6, $7)
+		RETURNING created_at
+	`
+
+	metadata, _ := json.Marshal(req.Metadata)
+	var createdAt time.Time
+
+	sourceLocation := fmt.Sprintf("clickhouse://events/%s/%s",
+		req.StartDate.Format("2006-01-02"),
+		req.EndDate.Format("2006-01-02"))
+
+	err := h.db.QueryRow(query,
+		jobID,
+		req.LicenseID,
+		req.JobType,
+		models.JobStatusPending,
+		sourceLocation,
+		req.TargetLocation,
+		metadata,
+	).Scan(&createdAt)
+
+	return jobID, sourceLocation, createdAt, err
+}
+
 func (h *DataLakeHandler) processArchiveJob(jobID string, req models.CreateArchiveJobRequest) {
+	// Residency can change between scheduling and running, so check again before writing
+	if err := h.checkDataLakeResidency(req.LicenseID); err != nil {
+		h.db.Exec(`
+			UPDATE archive_jobs
+			SET status = $1, end_time = NOW(), error = $2, updated_at = NOW()
+			WHERE id = $3
+		`, models.JobStatusFailed, err.Error(), jobID)
+		log.Errorf("Archive job %s failed: %v", jobID, err)
+		return
+	}
+
 	// Update job status to running
 	h.db.Exec("UPDATE archive_jobs SET status = $1 WHERE id = $2", models.JobStatusRunning, jobID)
 
@@ -0,0 +1,259 @@
+// Data Lake Archived Data Queries
+// Scans archived datasets in parallel, streaming rows through the query filters
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	defaultArchiveQueryLimit       = 1000
+	maxArchiveQueryLimit           = 10000
+	defaultArchiveQueryConcurrency = 4
+)
+
+// SetQueryConcurrency sets how many datasets an archived-data query downloads and scans at once.
+// Each worker holds one dataset on local disk, not in memory.
+func (h *DataLakeHandler) SetQueryConcurrency(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	h.queryConcurrency = workers
+}
+
+// archiveRowFilter decides whether an archived row matches a query
+type archiveRowFilter struct {
+	licenseID string
+	start     time.Time
+	end       time.Time
+	text      []byte // Lower-cased free-text term from the query field
+	fields    map[string]string
+}
+
+// archiveMatch is a matching row with its parsed timestamp for ordering
+type archiveMatch struct {
+	row       map[string]interface{}
+	timestamp time.Time
+}
+
+// archiveScan collects the results and counters of a query across all workers
+type archiveScan struct {
+	results   []map[string]interface{}
+	matched   int64
+	truncated bool
+
+	bytesDownloaded int64 // Updated atomically by the workers
+	bytesScanned    int64
+	downloadNanos   int64
+	scanNanos       int64
+}
+
+// scanArchivedDatasets streams every dataset through the filter on a bounded worker pool and
+// merges the matches. The scan stops as soon as the result limit is reached.
+func (h *DataLakeHandler) scanArchivedDatasets(ctx context.Context, req models.QueryArchivedDataRequest, lake restoreStorage, datasets []pendingDataset) (*archiveScan, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultArchiveQueryLimit
+	}
+	if limit > maxArchiveQueryLimit {
+		limit = maxArchiveQueryLimit
+	}
+	workers := h.queryConcurrency
+	if workers <= 0 {
+		workers = defaultArchiveQueryConcurrency
+	}
+	if workers > len(datasets) {
+		workers = len(datasets)
+	}
+
+	filter := archiveRowFilter{
+		licenseID: req.LicenseID,
+		start:     req.StartDate,
+		end:       req.EndDate,
+		text:      bytes.ToLower(bytes.TrimSpace([]byte(req.Query))),
+		fields:    make(map[string]string, len(req.Filters)),
+	}
+	for field, value := range req.Filters {
+		filter.fields[field] = fmt.Sprint(value)
+	}
+
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	scan := &archiveScan{results: []map[string]interface{}{}}
+	jobs := make(chan pendingDataset)
+	matches := make(chan archiveMatch, 256)
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dataset := range jobs {
+				err := h.scanArchivedDataset(scanCtx, lake, dataset, filter, scan, matches)
+				if err != nil && scanCtx.Err() == nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("dataset %s: %w", dataset.name, err) })
+					cancel()
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, dataset := range datasets {
+			select {
+			case jobs <- dataset:
+			case <-scanCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(matches)
+	}()
+
+	collected := make([]archiveMatch, 0)
+	for match := range matches {
+		scan.matched++
+		if len(collected) < limit {
+			collected = append(collected, match)
+		} else if !scan.truncated {
+			scan.truncated = true
+			cancel()
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if firstErr != nil && !scan.truncated {
+		return nil, firstErr
+	}
+
+	sort.SliceStable(collected, func(i, j int) bool {
+		return collected[i].timestamp.Before(collected[j].timestamp)
+	})
+	for _, match := range collected {
+		scan.results = append(scan.results, match.row)
+	}
+	return scan, nil
+}
+
+// scanArchivedDataset streams one dataset, sending matching rows to matches
+func (h *DataLakeHandler) scanArchivedDataset(ctx context.Context, lake restoreStorage, dataset pendingDataset, filter archiveRowFilter, scan *archiveScan, matches chan<- archiveMatch) error {
+	downloadStart := time.Now()
+	body, closeDataset, err := h.openDataset(ctx, lake, dataset)
+	if err != nil {
+		return err
+	}
+	defer closeDataset()
+	atomic.AddInt64(&scan.downloadNanos, int64(time.Since(downloadStart)))
+	atomic.AddInt64(&scan.bytesDownloaded, dataset.compressedSize)
+
+	scanStart := time.Now()
+	defer func() { atomic.AddInt64(&scan.scanNanos, int64(time.Since(scanStart))) }()
+
+	counter := &countingReader{reader: body}
+	defer func() { atomic.AddInt64(&scan.bytesScanned, counter.n) }()
+
+	decoder := json.NewDecoder(counter)
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+
+		row, timestamp, ok := filter.match(raw)
+		if !ok {
+			continue
+		}
+		select {
+		case matches <- archiveMatch{row: row, timestamp: timestamp}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// match applies the tenant, time range, field and free-text filters to a raw row
+func (f archiveRowFilter) match(raw []byte) (map[string]interface{}, time.Time, bool) {
+	if len(f.text) > 0 && !bytes.Contains(bytes.ToLower(raw), f.text) {
+		return nil, time.Time{}, false
+	}
+
+	var row map[string]interface{}
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, time.Time{}, false
+	}
+
+	// Archives are per license; never return another tenant's rows
+	if tenant, _ := row["tenant_id"].(string); tenant != f.licenseID {
+		return nil, time.Time{}, false
+	}
+
+	var timestamp archiveTime
+	if value, ok := row["timestamp"].(string); ok {
+		encoded, _ := json.Marshal(value)
+		if err := timestamp.UnmarshalJSON(encoded); err != nil {
+			return nil, time.Time{}, false
+		}
+	}
+	if timestamp.Before(f.start) || timestamp.After(f.end) {
+		return nil, time.Time{}, false
+	}
+
+	for field, expected := range f.fields {
+		value, ok := row[field]
+		if !ok || fmt.Sprint(value) != expected {
+			return nil, time.Time{}, false
+		}
+	}
+	return row, timestamp.Time, true
+}
+
+// metrics reports where the query spent its time. Decompression happens in the same streaming
+// pass as filtering, so it is included in the filtering time.
+func (s *archiveScan) metrics() *models.QueryMetrics {
+	metrics := &models.QueryMetrics{
+		DownloadTimeMs:  time.Duration(s.downloadNanos).Milliseconds(),
+		FilteringMs:     time.Duration(s.scanNanos).Milliseconds(),
+		BytesDownloaded: s.bytesDownloaded,
+		BytesScanned:    s.bytesScanned,
+	}
+	if s.bytesDownloaded > 0 {
+		metrics.CompressionRatio = float64(s.bytesScanned) / float64(s.bytesDownloaded)
+	}
+	return metrics
+}
+
+// countingReader counts the decompressed bytes read from a dataset
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,104 @@
+// Data Lake Query Cache
+// Caches archived-data query results so repeated investigation queries skip object storage
+
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// archiveQueryCache holds query results in memory with a TTL, evicting the oldest entry once
+// maxEntries is reached
+type archiveQueryCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[string]archiveQueryCacheEntry
+}
+
+type archiveQueryCacheEntry struct {
+	response models.QueryArchivedDataResponse
+	storedAt time.Time
+}
+
+func newArchiveQueryCache(ttl time.Duration, maxEntries int) *archiveQueryCache {
+	return &archiveQueryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]archiveQueryCacheEntry),
+	}
+}
+
+// SetQueryCache configures archived-data query caching; a zero ttl disables it
+func (h *DataLakeHandler) SetQueryCache(ttl time.Duration, maxEntries int) {
+	if ttl <= 0 || maxEntries <= 0 {
+		h.queryCache = nil
+		return
+	}
+	h.queryCache = newArchiveQueryCache(ttl, maxEntries)
+}
+
+// archiveQueryKey hashes the query together with the datasets it covers. Dataset checksums are
+// part of the key, so re-archiving a period produces a miss instead of stale results.
+func archiveQueryKey(req models.QueryArchivedDataRequest, datasets []string) string {
+	sorted := append([]string(nil), datasets...)
+	sort.Strings(sorted)
+
+	filters, _ := json.Marshal(req.Filters) // Map keys marshal in sorted order
+	parts := []string{
+		req.LicenseID,
+		req.StartDate.UTC().Format(time.RFC3339Nano),
+		req.EndDate.UTC().Format(time.RFC3339Nano),
+		strings.Join(strings.Fields(req.Query), " "),
+		string(filters),
+		strconv.Itoa(req.Limit),
+		strings.Join(sorted, ","),
+	}
+	if req.IncludeMetrics {
+		parts = append(parts, "metrics")
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (q *archiveQueryCache) get(key string) (models.QueryArchivedDataResponse, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[key]
+	if !ok {
+		return models.QueryArchivedDataResponse{}, false
+	}
+	if time.Since(entry.storedAt) > q.ttl {
+		delete(q.entries, key)
+		return models.QueryArchivedDataResponse{}, false
+	}
+	return entry.response, true
+}
+
+func (q *archiveQueryCache) put(key string, response models.QueryArchivedDataResponse) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.entries[key]; !exists && len(q.entries) >= q.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, entry := range q.entries {
+			if oldestKey == "" || entry.storedAt.Before(oldest) {
+				oldestKey, oldest = k, entry.storedAt
+			}
+		}
+		delete(q.entries, oldestKey)
+	}
+	q.entries[key] = archiveQueryCacheEntry{response: response, storedAt: time.Now()}
+}
@@ -0,0 +1,285 @@
+// Data Residency
+// Pins a license's data lake storage, and its ClickHouse shard where the deployment has one per
+// zone, to a geographic zone, and rejects storage outside it
+
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// errResidencyViolation marks storage that would leave a license's residency zone
+var errResidencyViolation = errors.New("data residency violation")
+
+// SetResidencyShards maps residency zones to ClickHouse shards, from "zone=shard" entries. When
+// set, only zones with a shard can be chosen, so a license's events never land outside its zone.
+func (h *DataLakeHandler) SetResidencyShards(entries []string) {
+	h.residencyShards = make(map[string]string)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			log.Warnf("Ignoring invalid ClickHouse residency shard %q; expected zone=shard", entry)
+			continue
+		}
+		zone := strings.TrimSpace(parts[0])
+		if _, ok := models.ResidencyZones[zone]; !ok {
+			log.Warnf("Ignoring ClickHouse residency shard for unknown zone %q", zone)
+			continue
+		}
+		h.residencyShards[zone] = strings.TrimSpace(parts[1])
+	}
+}
+
+// ListResidencyZones returns the zones a license can be pinned to and their storage regions
+func (h *DataLakeHandler) ListResidencyZones(c *gin.Context) {
+	type zone struct {
+		ID string `json:"id"`
+		models.ResidencyZone
+		ClickHouseShard string `json:"clickhouse_shard,omitempty"`
+		Available       bool   `json:"available"` // False when the deployment has no shard for the zone
+	}
+
+	zones := make([]zone, 0, len(models.ResidencyZones))
+	for id, z := range models.ResidencyZones {
+		shard := h.residencyShards[id]
+		zones = append(zones, zone{ID: id, ResidencyZone: z, ClickHouseShard: shard, Available: len(h.residencyShards) == 0 || shard != ""})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ID < zones[j].ID })
+
+	c.JSON(http.StatusOK, gin.H{"items": zones, "count": len(zones)})
+}
+
+// GetDataResidency returns a license's data residency and whether its data lake complies
+func (h *DataLakeHandler) GetDataResidency(c *gin.Context) {
+	residency, err := h.loadResidency(c.Param("license_id"))
+	if err != nil {
+		log.Errorf("Failed to get data residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data residency"})
+		return
+	}
+	if residency == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data residency not configured"})
+		return
+	}
+
+	if err := h.markDataLakeCompliance(residency); err != nil {
+		log.Errorf("Failed to check data lake residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data residency"})
+		return
+	}
+	c.JSON(http.StatusOK, residency)
+}
+
+// SetDataResidency creates or replaces a license's data residency. An existing data lake
+// configuration outside the new zone is reported, and its archive jobs fail until it is moved.
+func (h *DataLakeHandler) SetDataResidency(c *gin.Context) {
+	licenseID := c.Param("license_id")
+
+	var req models.DataResidencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if err := h.validateResidency(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AllowedRegions == nil {
+		req.AllowedRegions = []string{}
+	}
+
+	residency := models.DataResidency{
+		LicenseID:       licenseID,
+		Zone:            req.Zone,
+		AllowedRegions:  req.AllowedRegions,
+		DefaultRegion:   req.DefaultRegion,
+		ClickHouseShard: h.residencyShards[req.Zone],
+		UpdatedBy:       req.UpdatedBy,
+	}
+	err := h.db.QueryRow(`
+		INSERT INTO data_residency_configs (license_id, zone, allowed_regions, default_region, updated_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))
+		ON CONFLICT (license_id) DO UPDATE SET
+			zone = EXCLUDED.zone, allowed_regions = EXCLUDED.allowed_regions,
+			default_region = EXCLUDED.default_region, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`, licenseID, req.Zone, pq.Array(req.AllowedRegions), req.DefaultRegion, req.UpdatedBy).Scan(&residency.CreatedAt, &residency.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to set data residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set data residency"})
+		return
+	}
+
+	if err := h.markDataLakeCompliance(&residency); err != nil {
+		log.Errorf("Failed to check data lake residency: %v", err)
+	}
+	if residency.DataLakeCompliant != nil && !*residency.DataLakeCompliant {
+		log.Warnf("Data lake of license %s is outside its new residency zone %s; archive jobs will fail until it is moved", licenseID, req.Zone)
+	}
+	log.Infof("Data residency of license %s set to %s", licenseID, req.Zone)
+	c.JSON(http.StatusOK, residency)
+}
+
+// DeleteDataResidency removes a license's data residency, lifting its storage restrictions
+func (h *DataLakeHandler) DeleteDataResidency(c *gin.Context) {
+	licenseID := c.Param("license_id")
+
+	result, err := h.db.Exec("DELETE FROM data_residency_configs WHERE license_id = $1", licenseID)
+	if err != nil {
+		log.Errorf("Failed to delete data residency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete data residency"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data residency not configured"})
+		return
+	}
+
+	log.Warnf("Data residency of license %s removed", licenseID)
+	c.JSON(http.StatusOK, gin.H{"message": "Data residency removed successfully"})
+}
+
+// validateResidency checks the zone and that every region belongs to it
+func (h *DataLakeHandler) validateResidency(req models.DataResidencyRequest) error {
+	zone, ok := models.ResidencyZones[req.Zone]
+	if !ok {
+		zones := make([]string, 0, len(models.ResidencyZones))
+		for id := range models.ResidencyZones {
+			zones = append(zones, id)
+		}
+		sort.Strings(zones)
+		return fmt.Errorf("unknown zone %q; available zones: %s", req.Zone, strings.Join(zones, ", "))
+	}
+	if len(h.residencyShards) > 0 && h.residencyShards[req.Zone] == "" {
+		return fmt.Errorf("this deployment has no ClickHouse shard in zone %s", req.Zone)
+	}
+
+	for _, region := range req.AllowedRegions {
+		if !zoneHasRegion(zone, "", region) {
+			return fmt.Errorf("region %s is not in zone %s", region, req.Zone)
+		}
+	}
+	if req.DefaultRegion != "" {
+		residency := models.DataResidency{Zone: req.Zone, AllowedRegions: req.AllowedRegions}
+		if !residencyAllows(&residency, "", req.DefaultRegion) {
+			return fmt.Errorf("default_region %s is not an allowed region", req.DefaultRegion)
+		}
+	}
+	return nil
+}
+
+// loadResidency returns a license's data residency, or nil when none is configured
+func (h *DataLakeHandler) loadResidency(licenseID string) (*models.DataResidency, error) {
+	var residency models.DataResidency
+	err := h.db.QueryRow(`
+		SELECT license_id, zone, COALESCE(allowed_regions, '{}'), COALESCE(default_region, ''),
+		       COALESCE(updated_by, ''), created_at, updated_at
+		FROM data_residency_configs
+		WHERE license_id = $1
+	`, licenseID).Scan(&residency.LicenseID, &residency.Zone, pq.Array(&residency.AllowedRegions),
+		&residency.DefaultRegion, &residency.UpdatedBy, &residency.CreatedAt, &residency.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	residency.ClickHouseShard = h.residencyShards[residency.Zone]
+	return &residency, nil
+}
+
+// markDataLakeCompliance sets DataLakeCompliant from the license's data lake configuration
+func (h *DataLakeHandler) markDataLakeCompliance(residency *models.DataResidency) error {
+	var provider models.DataLakeProvider
+	var region string
+	err := h.db.QueryRow(`
+		SELECT provider, COALESCE(region, '') FROM data_lake_configs WHERE license_id = $1
+	`, residency.LicenseID).Scan(&provider, &region)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	compliant := residencyAllows(residency, provider, region)
+	residency.DataLakeCompliant = &compliant
+	return nil
+}
+
+// checkResidency returns an error wrapping errResidencyViolation when storing a license's data
+// in region of provider would leave its residency zone. Licenses without residency pass.
+func (h *DataLakeHandler) checkResidency(licenseID string, provider models.DataLakeProvider, region string) error {
+	residency, err := h.loadResidency(licenseID)
+	if err != nil {
+		return fmt.Errorf("failed to load data residency: %w", err)
+	}
+	if residency == nil || residencyAllows(residency, provider, region) {
+		return nil
+	}
+	if region == "" {
+		return fmt.Errorf("%w: license is pinned to zone %s but no region is set", errResidencyViolation, residency.Zone)
+	}
+	return fmt.Errorf("%w: region %s is outside zone %s", errResidencyViolation, region, residency.Zone)
+}
+
+// checkDataLakeResidency checks the license's current data lake configuration
+func (h *DataLakeHandler) checkDataLakeResidency(licenseID string) error {
+	var provider models.DataLakeProvider
+	var region string
+	err := h.db.QueryRow(`
+		SELECT provider, COALESCE(region, '') FROM data_lake_configs WHERE license_id = $1
+	`, licenseID).Scan(&provider, &region)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load data lake configuration: %w", err)
+	}
+	return h.checkResidency(licenseID, provider, region)
+}
+
+// residencyAllows reports whether region is in the residency's zone and allowed regions. An empty
+// provider accepts a region of any provider.
+func residencyAllows(residency *models.DataResidency, provider models.DataLakeProvider, region string) bool {
+	if region == "" || !zoneHasRegion(models.ResidencyZones[residency.Zone], provider, region) {
+		return false
+	}
+	if len(residency.AllowedRegions) == 0 {
+		return true
+	}
+	for _, allowed := range residency.AllowedRegions {
+		if strings.EqualFold(allowed, region) {
+			return true
+		}
+	}
+	return false
+}
+
+func zoneHasRegion(zone models.ResidencyZone, provider models.DataLakeProvider, region string) bool {
+	for zoneProvider, regions := range zone.Regions {
+		if provider != "" && zoneProvider != provider {
+			continue
+		}
+		for _, candidate := range regions {
+			if strings.EqualFold(candidate, region) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,777 @@
+// Data Lake Restore
+// Rehydrates archived datasets from S3/GCS back into ClickHouse for investigations
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+	"github.com/sentinel-enterprise/platform/secrets"
+)
+
+const (
+	// restoreBatchSize is the number of rows inserted, and checkpointed, at a time
+	restoreBatchSize = 10000
+
+	// restoreAttempts is how often a dataset is tried before the job is marked failed
+	restoreAttempts = 3
+
+	// restoreStaleAfter is how long a running restore may go without checkpointing before
+	// another API instance (or a restart) takes it over
+	restoreStaleAfter = 10 * time.Minute
+
+	// restoreMainTable restores into live telemetry; rows past the tenant's retention are removed
+	// again by the next retention run
+	restoreMainTable = "telemetry_events"
+
+	// archiveEncryptionAESGCM marks datasets encrypted client-side with the archive key
+	// (12-byte nonce followed by the AES-256-GCM ciphertext). Other encrypted datasets use
+	// server-side encryption and download as plaintext.
+	archiveEncryptionAESGCM = "aes-256-gcm"
+)
+
+// restoreTablePattern limits restore targets to dedicated restore tables
+var restoreTablePattern = regexp.MustCompile(`^telemetry_restore_[a-z0-9_]{1,48}$`)
+
+// restoreColumns are the stored (non-materialized) telemetry_events columns an archive row carries
+const restoreColumns = `event_id, agent_id, tenant_id, timestamp, server_timestamp, event_type,
+	mitre_tactic, mitre_technique, severity, hostname, os_type, payload,
+	dst_country, dst_asn, dst_as_org, dst_hostname, process_reputation, src_country, redacted,
+	agent_timestamp, timestamp_clamped`
+
+// archivedEvent is one row of an archived dataset: gzip-compressed newline-delimited JSON
+// (ClickHouse JSONEachRow) of telemetry_events
+type archivedEvent struct {
+	EventID           string      `json:"event_id"`
+	AgentID           string      `json:"agent_id"`
+	TenantID          string      `json:"tenant_id"`
+	Timestamp         archiveTime `json:"timestamp"`
+	ServerTimestamp   archiveTime `json:"server_timestamp"`
+	EventType         string      `json:"event_type"`
+	MitreTactic       string      `json:"mitre_tactic"`
+	MitreTechnique    string      `json:"mitre_technique"`
+	Severity          uint8       `json:"severity"`
+	Hostname          string      `json:"hostname"`
+	OSType            string      `json:"os_type"`
+	Payload           string      `json:"payload"`
+	DstCountry        string      `json:"dst_country"`
+	DstASN            uint32      `json:"dst_asn"`
+	DstASOrg          string      `json:"dst_as_org"`
+	DstHostname       string      `json:"dst_hostname"`
+	ProcessReputation string      `json:"process_reputation"`
+	SrcCountry        string      `json:"src_country"`
+	Redacted          bool        `json:"redacted"`
+	AgentTimestamp    archiveTime `json:"agent_timestamp"` // Absent from archives written before clamping
+	TimestampClamped  bool        `json:"timestamp_clamped"`
+}
+
+// archiveTime accepts both RFC 3339 and ClickHouse's default DateTime64 text format
+type archiveTime struct {
+	time.Time
+}
+
+func (t *archiveTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05"} {
+		if parsed, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", s)
+}
+
+// pendingDataset is a dataset of a restore job with its checkpoint
+type pendingDataset struct {
+	id              string
+	name            string
+	storagePath     string
+	eventCount      int64
+	compressedSize  int64
+	compressionType string
+	isEncrypted     bool
+	checksum        string
+	encryption      string
+	rowsCommitted   int64
+	rowsSkipped     int64
+}
+
+// EnableRestore lets restore jobs insert into ClickHouse. archiveKey decrypts datasets that
+// were encrypted client-side; it may be nil when the data lake uses server-side encryption.
+func (h *DataLakeHandler) EnableRestore(ch driver.Conn, archiveKey []byte) {
+	h.clickhouse = ch
+	h.archiveKey = archiveKey
+}
+
+// createRestoreJob validates and records a restore job, then starts it in the background.
+// Restores go to a dedicated telemetry_restore_* table (created without TTL, so old data stays)
+// unless target_location names one or telemetry_events.
+func (h *DataLakeHandler) createRestoreJob(c *gin.Context, req models.CreateArchiveJobRequest) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	if req.TargetLocation != "" && req.TargetLocation != restoreMainTable && !restoreTablePattern.MatchString(req.TargetLocation) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_location must be telemetry_events or a telemetry_restore_<name> table"})
+		return
+	}
+
+	query := "SELECT id FROM archived_datasets WHERE license_id = $1"
+	args := []interface{}{req.LicenseID}
+	if len(req.DatasetIDs) > 0 {
+		query += " AND id::text = ANY($2)"
+		args = append(args, pq.Array(req.DatasetIDs))
+	} else {
+		query += " AND start_date <= $2 AND end_date >= $3"
+		args = append(args, req.EndDate, req.StartDate)
+	}
+	query += " ORDER BY start_date"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to look up archived datasets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore job"})
+		return
+	}
+	datasetIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			datasetIDs = append(datasetIDs, id)
+		}
+	}
+	rows.Close()
+	if len(datasetIDs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No archived datasets found to restore"})
+		return
+	}
+	if len(req.DatasetIDs) > 0 && len(datasetIDs) != len(req.DatasetIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "One or more datasets not found"})
+		return
+	}
+
+	jobID := uuid.New().String()
+	target := req.TargetLocation
+	if target == "" {
+		target = "telemetry_restore_" + strings.ReplaceAll(jobID, "-", "")[:12]
+	}
+	sourceLocation := fmt.Sprintf("datalake://datasets/%s/%s", req.StartDate.Format("2006-01-02"), req.EndDate.Format("2006-01-02"))
+	metadata, _ := json.Marshal(req.Metadata)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore job"})
+		return
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	if err := tx.QueryRow(`
+		INSERT INTO archive_jobs (id, license_id, job_type, status, start_time, source_location, target_location, metadata)
+		VALUES ($1, $2, $3, $4, NOW(), $5, $6, $7)
+		RETURNING created_at
+	`, jobID, req.LicenseID, models.JobTypeRestore, models.JobStatusPending, sourceLocation, target, metadata).Scan(&createdAt); err != nil {
+		log.Errorf("Failed to create restore job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore job"})
+		return
+	}
+	for i, datasetID := range datasetIDs {
+		if _, err := tx.Exec(
+			"INSERT INTO restore_job_datasets (job_id, dataset_id, position) VALUES ($1, $2, $3)",
+			jobID, datasetID, i,
+		); err != nil {
+			log.Errorf("Failed to record restore dataset: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore job"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit restore job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create restore job"})
+		return
+	}
+
+	go h.runRestoreJob(jobID)
+
+	progress, _ := h.restoreProgress(jobID)
+	c.JSON(http.StatusCreated, models.ArchiveJob{
+		ID:             jobID,
+		LicenseID:      req.LicenseID,
+		JobType:        models.JobTypeRestore,
+		Status:         models.JobStatusPending,
+		StartTime:      createdAt,
+		SourceLocation: sourceLocation,
+		TargetLocation: target,
+		Metadata:       req.Metadata,
+		Datasets:       progress,
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+	})
+}
+
+// ResumeRestoreJob restarts a failed restore. Datasets already restored are skipped and a
+// partially restored dataset continues after its last checkpoint.
+func (h *DataLakeHandler) ResumeRestoreJob(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	jobID := c.Param("id")
+
+	var jobType models.ArchiveJobType
+	var status models.ArchiveJobStatus
+	err := h.db.QueryRow(
+		"SELECT job_type, status FROM archive_jobs WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		jobID, principalLicense(c),
+	).Scan(&jobType, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get archive job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+		return
+	}
+	if jobType != models.JobTypeRestore {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only restore jobs can be resumed"})
+		return
+	}
+	if status != models.JobStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Job is %s; only failed restores can be resumed", status)})
+		return
+	}
+
+	go h.runRestoreJob(jobID)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Restore job resumed successfully", "job_id": jobID})
+}
+
+// ResumeRestoreJobs picks up restores left pending or interrupted by a restart. It is run once
+// at startup; failed restores wait for an explicit resume.
+func (h *DataLakeHandler) ResumeRestoreJobs() {
+	if h.clickhouse == nil {
+		return
+	}
+	rows, err := h.db.Query(`
+		SELECT id FROM archive_jobs
+		WHERE job_type = $1
+		  AND (status = $2 OR (status = $3 AND updated_at < NOW() - ($4 * INTERVAL '1 second')))
+		ORDER BY created_at
+	`, models.JobTypeRestore, models.JobStatusPending, models.JobStatusRunning, int(restoreStaleAfter.Seconds()))
+	if err != nil {
+		log.Errorf("Failed to look up interrupted restore jobs: %v", err)
+		return
+	}
+	jobIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			jobIDs = append(jobIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, jobID := range jobIDs {
+		log.Infof("Resuming interrupted restore job %s", jobID)
+		h.runRestoreJob(jobID)
+	}
+}
+
+// runRestoreJob claims a restore job and restores its remaining datasets in order. The claim
+// keeps two API instances from running the same job; checkpoints refresh it.
+func (h *DataLakeHandler) runRestoreJob(jobID string) {
+	var licenseID, target string
+	err := h.db.QueryRow(`
+		UPDATE archive_jobs SET status = $2, error = NULL, end_time = NULL, updated_at = NOW()
+		WHERE id = $1 AND job_type = $3
+		  AND (status IN ($4, $5) OR (status = $2 AND updated_at < NOW() - ($6 * INTERVAL '1 second')))
+		RETURNING license_id, target_location
+	`, jobID, models.JobStatusRunning, models.JobTypeRestore, models.JobStatusPending, models.JobStatusFailed,
+		int(restoreStaleAfter.Seconds())).Scan(&licenseID, &target)
+	if err == sql.ErrNoRows {
+		return // Already running elsewhere, or finished
+	}
+	if err != nil {
+		log.Errorf("Failed to claim restore job %s: %v", jobID, err)
+		return
+	}
+
+	if err := h.restore(jobID, licenseID, target); err != nil {
+		log.Errorf("Restore job %s failed: %v", jobID, err)
+		h.db.Exec(`
+			UPDATE archive_jobs SET status = $1, error = $2, end_time = NOW(), updated_at = NOW()
+			WHERE id = $3
+		`, models.JobStatusFailed, err.Error(), jobID)
+		return
+	}
+
+	h.db.Exec(`
+		UPDATE archive_jobs SET status = $1, progress = 1.0, end_time = NOW(), updated_at = NOW()
+		WHERE id = $2
+	`, models.JobStatusCompleted, jobID)
+	log.Infof("Restore job %s completed into %s", jobID, target)
+}
+
+func (h *DataLakeHandler) restore(jobID, licenseID, target string) error {
+	ctx := context.Background()
+	if err := h.ensureRestoreTable(ctx, target); err != nil {
+		return fmt.Errorf("failed to prepare %s: %w", target, err)
+	}
+
+	lake, err := h.loadDataLakeConfig(licenseID)
+	if err != nil {
+		return fmt.Errorf("failed to load data lake configuration: %w", err)
+	}
+
+	datasets, err := h.pendingRestoreDatasets(jobID)
+	if err != nil {
+		return fmt.Errorf("failed to load restore datasets: %w", err)
+	}
+
+	for _, dataset := range datasets {
+		h.db.Exec("UPDATE restore_job_datasets SET status = 'running', error = NULL, updated_at = NOW() WHERE job_id = $1 AND dataset_id = $2",
+			jobID, dataset.id)
+
+		var restoreErr error
+		for attempt := 1; attempt <= restoreAttempts; attempt++ {
+			if restoreErr = h.restoreDataset(ctx, jobID, licenseID, target, lake, dataset); restoreErr == nil {
+				break
+			}
+			log.Warnf("Restore of dataset %s failed (attempt %d/%d): %v", dataset.name, attempt, restoreAttempts, restoreErr)
+			if attempt < restoreAttempts {
+				time.Sleep(time.Duration(attempt*attempt) * 5 * time.Second)
+				// Pick up the checkpoint the failed attempt reached
+				h.db.QueryRow("SELECT rows_committed, rows_skipped FROM restore_job_datasets WHERE job_id = $1 AND dataset_id = $2",
+					jobID, dataset.id).Scan(&dataset.rowsCommitted, &dataset.rowsSkipped)
+			}
+		}
+		if restoreErr != nil {
+			h.db.Exec("UPDATE restore_job_datasets SET status = 'failed', error = $3, updated_at = NOW() WHERE job_id = $1 AND dataset_id = $2",
+				jobID, dataset.id, restoreErr.Error())
+			return fmt.Errorf("dataset %s: %w", dataset.name, restoreErr)
+		}
+
+		h.db.Exec(`
+			UPDATE restore_job_datasets SET status = 'completed', completed_at = NOW(), updated_at = NOW()
+			WHERE job_id = $1 AND dataset_id = $2
+		`, jobID, dataset.id)
+		h.db.Exec("UPDATE archive_jobs SET bytes_processed = bytes_processed + $1, updated_at = NOW() WHERE id = $2",
+			dataset.compressedSize, jobID)
+
+		details, _ := json.Marshal(map[string]interface{}{"job_id": jobID, "target": target})
+		h.db.Exec(`
+			INSERT INTO data_access_logs (license_id, action, dataset_id, query_details)
+			VALUES ($1, 'restore', $2, $3)
+		`, licenseID, dataset.id, details)
+	}
+	return nil
+}
+
+// restoreDataset downloads a dataset, verifies its checksum and inserts its rows after the
+// dataset's checkpoint. Each batch carries a deduplication token derived from its position, so
+// a batch re-sent after a crash between insert and checkpoint is dropped by ClickHouse where
+// insert deduplication is enabled.
+func (h *DataLakeHandler) restoreDataset(ctx context.Context, jobID, licenseID, target string, lake restoreStorage, dataset pendingDataset) error {
+	body, closeDataset, err := h.openDataset(ctx, lake, dataset)
+	if err != nil {
+		return err
+	}
+	defer closeDataset()
+
+	decoder := json.NewDecoder(body)
+	var row int64
+	committed, skipped := dataset.rowsCommitted, dataset.rowsSkipped
+	batch := make([]archivedEvent, 0, restoreBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := h.insertRestoreBatch(ctx, target, fmt.Sprintf("%s:%s:%d", jobID, dataset.id, committed), batch); err != nil {
+			return err
+		}
+		inserted := int64(len(batch))
+		committed = row
+		batch = batch[:0]
+
+		_, err := h.db.Exec(`
+			UPDATE restore_job_datasets SET rows_committed = $3, rows_skipped = $4, updated_at = NOW()
+			WHERE job_id = $1 AND dataset_id = $2
+		`, jobID, dataset.id, committed, skipped)
+		if err != nil {
+			return fmt.Errorf("failed to checkpoint: %w", err)
+		}
+		h.db.Exec(`
+			UPDATE archive_jobs j SET events_processed = events_processed + $2, updated_at = NOW(),
+			       progress = LEAST(1.0, (
+			           SELECT COALESCE(SUM(r.rows_committed)::numeric / NULLIF(SUM(d.event_count), 0), 0)
+			           FROM restore_job_datasets r JOIN archived_datasets d ON d.id = r.dataset_id
+			           WHERE r.job_id = j.id))
+			WHERE id = $1
+		`, jobID, inserted)
+		return nil
+	}
+
+	for {
+		var event archivedEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The stream cannot be realigned after a syntax error
+			return fmt.Errorf("failed to read row %d: %w", row+1, err)
+		}
+		row++
+		if row <= dataset.rowsCommitted {
+			continue // Restored before the last failure
+		}
+
+		// Archives are per license; never let a row land in another tenant's data
+		if event.TenantID != licenseID {
+			skipped++
+			continue
+		}
+		batch = append(batch, event)
+		if len(batch) == restoreBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// Record the final position even when the tail of the dataset was all skipped rows
+	_, err = h.db.Exec(`
+		UPDATE restore_job_datasets SET rows_committed = $3, rows_skipped = $4, updated_at = NOW()
+		WHERE job_id = $1 AND dataset_id = $2
+	`, jobID, dataset.id, row, skipped)
+	return err
+}
+
+// openDataset downloads an archived dataset to a temporary file, verifies its checksum and
+// returns the decrypted, decompressed row stream. The caller must call the returned close func.
+func (h *DataLakeHandler) openDataset(ctx context.Context, lake restoreStorage, dataset pendingDataset) (io.Reader, func(), error) {
+	file, err := os.CreateTemp("", "sentinel-dataset-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := []func(){func() {
+		file.Close()
+		os.Remove(file.Name())
+	}}
+	closeAll := func() {
+		for i := len(cleanup) - 1; i >= 0; i-- {
+			cleanup[i]()
+		}
+	}
+	fail := func(err error) (io.Reader, func(), error) {
+		closeAll()
+		return nil, nil, err
+	}
+
+	object, err := lake.open(ctx, dataset.storagePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to download: %w", err))
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), object)
+	object.Close()
+	if err != nil {
+		return fail(fmt.Errorf("failed to download: %w", err))
+	}
+	if dataset.checksum != "" && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), dataset.checksum) {
+		return fail(errors.New("checksum mismatch; the archived object is corrupt or was modified"))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	var body io.Reader = file
+	if dataset.isEncrypted && dataset.encryption == archiveEncryptionAESGCM {
+		ciphertext, err := io.ReadAll(file)
+		if err != nil {
+			return fail(err)
+		}
+		plaintext, err := decryptArchive(h.archiveKey, ciphertext)
+		if err != nil {
+			return fail(fmt.Errorf("failed to decrypt: %w", err))
+		}
+		body = bytes.NewReader(plaintext)
+	}
+
+	switch dataset.compressionType {
+	case "", "gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return fail(fmt.Errorf("failed to decompress: %w", err))
+		}
+		cleanup = append(cleanup, func() { reader.Close() })
+		body = reader
+	case "none":
+	default:
+		return fail(fmt.Errorf("unsupported compression type %s", dataset.compressionType))
+	}
+
+	return body, closeAll, nil
+}
+
+func (h *DataLakeHandler) insertRestoreBatch(ctx context.Context, target, dedupToken string, events []archivedEvent) error {
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"insert_deduplication_token": dedupToken,
+	}))
+	batch, err := h.clickhouse.PrepareBatch(ctx, "INSERT INTO "+target+" ("+restoreColumns+")")
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	for _, e := range events {
+		eventID, err := uuid.Parse(e.EventID)
+		if err != nil {
+			eventID = uuid.New()
+		}
+		agentTimestamp := e.AgentTimestamp.Time
+		if agentTimestamp.IsZero() {
+			agentTimestamp = e.Timestamp.Time
+		}
+		if err := batch.Append(
+			eventID, e.AgentID, e.TenantID, e.Timestamp.Time, e.ServerTimestamp.Time, e.EventType,
+			e.MitreTactic, e.MitreTechnique, e.Severity, e.Hostname, e.OSType, e.Payload,
+			e.DstCountry, e.DstASN, e.DstASOrg, e.DstHostname, e.ProcessReputation, e.SrcCountry,
+			e.Redacted, agentTimestamp, e.TimestampClamped,
+		); err != nil {
+			batch.Abort()
+			return fmt.Errorf("failed to append row: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to insert: %w", err)
+	}
+	return nil
+}
+
+// ensureRestoreTable creates a dedicated restore table shaped like telemetry_events. Any TTL it
+// inherits is removed so restored data is not immediately expired again.
+func (h *DataLakeHandler) ensureRestoreTable(ctx context.Context, target string) error {
+	if target == restoreMainTable {
+		return nil
+	}
+	if !restoreTablePattern.MatchString(target) {
+		return fmt.Errorf("invalid restore table %q", target)
+	}
+
+	var exists uint64
+	if err := h.clickhouse.QueryRow(ctx,
+		"SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = ?", target,
+	).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+	if err := h.clickhouse.Exec(ctx, "CREATE TABLE IF NOT EXISTS "+target+" AS telemetry_events"); err != nil {
+		return err
+	}
+	return removeTableTTL(ctx, h.clickhouse, target)
+}
+
+// pendingRestoreDatasets returns the job's datasets not yet restored, in restore order
+func (h *DataLakeHandler) pendingRestoreDatasets(jobID string) ([]pendingDataset, error) {
+	rows, err := h.db.Query(`
+		SELECT d.id, d.dataset_name, d.storage_path, d.event_count, d.compressed_size,
+		       COALESCE(d.compression_type, ''), COALESCE(d.is_encrypted, FALSE), COALESCE(d.checksum, ''),
+		       COALESCE(d.metadata->>'encryption', ''), r.rows_committed, r.rows_skipped
+		FROM restore_job_datasets r
+		JOIN archived_datasets d ON d.id = r.dataset_id
+		WHERE r.job_id = $1 AND r.status <> 'completed'
+		ORDER BY r.position
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	datasets := []pendingDataset{}
+	for rows.Next() {
+		var d pendingDataset
+		if err := rows.Scan(&d.id, &d.name, &d.storagePath, &d.eventCount, &d.compressedSize,
+			&d.compressionType, &d.isEncrypted, &d.checksum, &d.encryption, &d.rowsCommitted, &d.rowsSkipped); err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, d)
+	}
+	return datasets, rows.Err()
+}
+
+// restoreProgress returns the per-dataset progress of a restore job
+func (h *DataLakeHandler) restoreProgress(jobID string) ([]models.RestoreDatasetProgress, error) {
+	rows, err := h.db.Query(`
+		SELECT r.dataset_id, d.dataset_name, r.status, d.event_count, r.rows_committed, r.rows_skipped,
+		       COALESCE(r.error, ''), r.completed_at
+		FROM restore_job_datasets r
+		JOIN archived_datasets d ON d.id = r.dataset_id
+		WHERE r.job_id = $1
+		ORDER BY r.position
+	`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := []models.RestoreDatasetProgress{}
+	for rows.Next() {
+		var p models.RestoreDatasetProgress
+		if err := rows.Scan(&p.DatasetID, &p.DatasetName, &p.Status, &p.EventCount, &p.RowsCommitted, &p.RowsSkipped,
+			&p.Error, &p.CompletedAt); err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, rows.Err()
+}
+
+// restoreStorage reads archived objects from a license's data lake bucket
+type restoreStorage struct {
+	provider        models.DataLakeProvider
+	bucket          string
+	region          string
+	accessKey       string
+	secretKey       string
+	credentialsJSON string
+}
+
+func (h *DataLakeHandler) loadDataLakeConfig(licenseID string) (restoreStorage, error) {
+	var s restoreStorage
+	err := h.db.QueryRow(`
+		SELECT provider, bucket_name, COALESCE(region, ''), COALESCE(access_key, ''),
+		       COALESCE(secret_key, ''), COALESCE(credentials_json, '')
+		FROM data_lake_configs
+		WHERE license_id = $1
+	`, licenseID).Scan(&s.provider, &s.bucket, &s.region, &s.accessKey, &s.secretKey, &s.credentialsJSON)
+	if err != nil {
+		return s, err
+	}
+
+	ctx := context.Background()
+	for _, value := range []*string{&s.accessKey, &s.secretKey, &s.credentialsJSON} {
+		if *value, err = secrets.Resolve(ctx, h.secretProvider, *value); err != nil {
+			return s, fmt.Errorf("failed to resolve storage credentials: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// open streams an archived object. storagePath is either a key in the configured bucket or a
+// full s3:// or gs:// URL.
+func (s restoreStorage) open(ctx context.Context, storagePath string) (io.ReadCloser, error) {
+	bucket, key := s.bucket, storagePath
+	for _, scheme := range []string{"s3://", "gs://"} {
+		if strings.HasPrefix(storagePath, scheme) {
+			parts := strings.SplitN(strings.TrimPrefix(storagePath, scheme), "/", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid storage path %s", storagePath)
+			}
+			bucket, key = parts[0], parts[1]
+		}
+	}
+
+	switch s.provider {
+	case models.ProviderS3:
+		cfg, err := config.LoadDefaultConfig(ctx,
+			config.WithRegion(s.region),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(s.accessKey, s.secretKey, "")),
+		)
+		if err != nil {
+			return nil, err
+		}
+		out, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out.Body, nil
+
+	case models.ProviderGCS:
+		client, err := storage.NewClient(ctx, option.WithCredentialsJSON([]byte(s.credentialsJSON)))
+		if err != nil {
+			return nil, err
+		}
+		reader, err := client.Bucket(bucket).Object(key).NewReader(ctx)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		return gcsObject{Reader: reader, client: client}, nil
+	}
+	return nil, fmt.Errorf("restores from %s are not supported", s.provider)
+}
+
+// gcsObject closes the GCS client along with the object reader
+type gcsObject struct {
+	*storage.Reader
+	client *storage.Client
+}
+
+func (o gcsObject) Close() error {
+	err := o.Reader.Close()
+	o.client.Close()
+	return err
+}
+
+// decryptArchive decrypts a client-side encrypted dataset: a 12-byte nonce followed by the
+// AES-256-GCM ciphertext
+func decryptArchive(key, data []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, errors.New("dataset is encrypted but no 32-byte archive key is configured")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
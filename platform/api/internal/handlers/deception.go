@@ -4,17 +4,15 @@
 package handlers
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
@@ -22,7 +20,8 @@ import (
 
 // DeceptionHandler handles deception technology operations
 type DeceptionHandler struct {
-	db *sql.DB
+	db         *sql.DB
+	clickhouse driver.Conn // Optional; network telemetry for honeypot auto-deployment
 }
 
 // NewDeceptionHandler creates a new deception handler
@@ -34,7 +33,7 @@ func NewDeceptionHandler(db *sql.DB) *DeceptionHandler {
 func (h *DeceptionHandler) CreateHoneypot(c *gin.Context) {
 	var req models.CreateHoneypotRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -100,10 +99,9 @@ func (h *DeceptionHandler) ListHoneypots(c *gin.Context) {
 		SELECT id, license_id, name, honeypot_type, status, deployment_mode,
 		       target_platform, configuration, location, is_active,
 		       interaction_count, last_interaction, deployed_at,
-		       created_at, updated_at
+		       created_at, updated_at, deleted_at, version
 		FROM honeypots
-		WHERE license_id = $1
-	`
+		WHERE license_id = $1` + liveOnly(c)
 
 	args := []interface{}{licenseID}
 	if status != "" {
@@ -125,7 +123,7 @@ func (h *DeceptionHandler) ListHoneypots(c *gin.Context) {
 	for rows.Next() {
 		var honeypot models.Honeypot
 		var configJSON []byte
-		var lastInteraction sql.NullTime
+		var lastInteraction, deletedAt sql.NullTime
 
 		err := rows.Scan(
 			&honeypot.ID,
@@ -143,6 +141,8 @@ func (h *DeceptionHandler) ListHoneypots(c *gin.Context) {
 			&honeypot.DeployedAt,
 			&honeypot.CreatedAt,
 			&honeypot.UpdatedAt,
+			&deletedAt,
+			&honeypot.Version,
 		)
 
 		if err != nil {
@@ -153,6 +153,9 @@ func (h *DeceptionHandler) ListHoneypots(c *gin.Context) {
 		if lastInteraction.Valid {
 			honeypot.LastInteraction = &lastInteraction.Time
 		}
+		if deletedAt.Valid {
+			honeypot.DeletedAt = &deletedAt.Time
+		}
 
 		honeypots = append(honeypots, honeypot)
 	}
@@ -171,14 +174,13 @@ func (h *DeceptionHandler) GetHoneypot(c *gin.Context) {
 		SELECT id, license_id, name, honeypot_type, status, deployment_mode,
 		       target_platform, configuration, location, is_active,
 		       interaction_count, last_interaction, deployed_at, metadata,
-		       created_at, updated_at
+		       created_at, updated_at, deleted_at, version
 		FROM honeypots
-		WHERE id = $1
-	`
+		WHERE id = $1` + liveOnly(c)
 
 	var honeypot models.Honeypot
 	var configJSON, metadataJSON []byte
-	var lastInteraction sql.NullTime
+	var lastInteraction, deletedAt sql.NullTime
 
 	err := h.db.QueryRow(query, id).Scan(
 		&honeypot.ID,
@@ -197,6 +199,8 @@ func (h *DeceptionHandler) GetHoneypot(c *gin.Context) {
 		&metadataJSON,
 		&honeypot.CreatedAt,
 		&honeypot.UpdatedAt,
+		&deletedAt,
+		&honeypot.Version,
 	)
 
 	if err == sql.ErrNoRows {
@@ -215,7 +219,11 @@ func (h *DeceptionHandler) GetHoneypot(c *gin.Context) {
 	if lastInteraction.Valid {
 		honeypot.LastInteraction = &lastInteraction.Time
 	}
+	if deletedAt.Valid {
+		honeypot.DeletedAt = &deletedAt.Time
+	}
 
+	setVersionETag(c, honeypot.Version)
 	c.JSON(http.StatusOK, honeypot)
 }
 
@@ -223,9 +231,14 @@ func (h *DeceptionHandler) GetHoneypot(c *gin.Context) {
 func (h *DeceptionHandler) UpdateHoneypot(c *gin.Context) {
 	id := c.Param("id")
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateHoneypotRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -234,56 +247,57 @@ func (h *DeceptionHandler) UpdateHoneypot(c *gin.Context) {
 		SET name = COALESCE($1, name),
 		    status = COALESCE($2, status),
 		    is_active = COALESCE($3, is_active),
-		    updated_at = NOW()
-		WHERE id = $4
+		    updated_at = NOW(),
+		    version = version + 1
+		WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5)
+		RETURNING version
 	`
 
-	result, err := h.db.Exec(query, req.Name, req.Status, req.IsActive, id)
+	var version int
+	err := h.db.QueryRow(query, req.Name, req.Status, req.IsActive, id, expectedVersion).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "honeypots", "Honeypot", id)
+		return
+	}
 	if err != nil {
 		log.Errorf("Failed to update honeypot: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update honeypot"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Honeypot not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Honeypot updated successfully"})
+	setVersionETag(c, version)
+	c.JSON(http.StatusOK, gin.H{"message": "Honeypot updated successfully", "version": version})
 }
 
-// DeleteHoneypot deletes a honeypot
+// DeleteHoneypot soft-deletes a honeypot; its recorded interactions are kept
 func (h *DeceptionHandler) DeleteHoneypot(c *gin.Context) {
-	id := c.Param("id")
-
-	result, err := h.db.Exec("DELETE FROM honeypots WHERE id = $1", id)
-	if err != nil {
-		log.Errorf("Failed to delete honeypot: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete honeypot"})
-		return
-	}
+	softDeleteRow(c, h.db, "honeypots", "Honeypot")
+}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Honeypot not found"})
-		return
-	}
+// RestoreHoneypot brings back a soft-deleted honeypot
+func (h *DeceptionHandler) RestoreHoneypot(c *gin.Context) {
+	restoreRow(c, h.db, "honeypots", "Honeypot")
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Honeypot deleted successfully"})
+// PurgeHoneypot permanently removes a soft-deleted honeypot
+func (h *DeceptionHandler) PurgeHoneypot(c *gin.Context) {
+	purgeRow(c, h.db, "honeypots", "Honeypot")
 }
 
 // CreateHoneyToken creates a new honey token
 func (h *DeceptionHandler) CreateHoneyToken(c *gin.Context) {
 	var req models.CreateHoneyTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if err := validateHoneyTokenContext(req.ExpectedContext); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	tokenID := uuid.New().String()
-	tokenValue := h.generateHoneyToken(req.TokenType)
 
 	// Generate callback URL if not provided
 	callbackURL := req.CallbackURL
@@ -291,18 +305,43 @@ func (h *DeceptionHandler) CreateHoneyToken(c *gin.Context) {
 		callbackURL = fmt.Sprintf("https://api.prive-platform.com/v1/deception/callback/%s", tokenID)
 	}
 
+	tokenValue, err := generateHoneyTokenValue(req.TokenType, req.Template, callbackURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Office document tokens are delivered as a decoy file; remember the format for re-downloads
+	if req.TokenType == models.TokenTypeOfficeDocument {
+		if req.DocumentFormat == "" {
+			req.DocumentFormat = defaultHoneyDocumentFormat
+		}
+		if _, ok := honeyDocumentFormats[req.DocumentFormat]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "document_format must be docx, xlsx or pdf"})
+			return
+		}
+		if req.Metadata == nil {
+			req.Metadata = map[string]interface{}{}
+		}
+		req.Metadata["document_format"] = req.DocumentFormat
+	}
+
 	metadataJSON, _ := json.Marshal(req.Metadata)
+	var contextJSON []byte
+	if req.ExpectedContext != nil {
+		contextJSON, _ = json.Marshal(req.ExpectedContext)
+	}
 
 	query := `
 		INSERT INTO honey_tokens (
 			id, license_id, name, token_type, token_value, callback_url,
-			is_active, metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, TRUE, $7)
+			is_active, metadata, expected_context
+		) VALUES ($1, $2, $3, $4, $5, $6, TRUE, $7, $8)
 		RETURNING created_at, updated_at
 	`
 
 	var createdAt, updatedAt time.Time
-	err := h.db.QueryRow(query,
+	err = h.db.QueryRow(query,
 		tokenID,
 		req.LicenseID,
 		req.Name,
@@ -310,6 +349,7 @@ func (h *DeceptionHandler) CreateHoneyToken(c *gin.Context) {
 		tokenValue,
 		callbackURL,
 		metadataJSON,
+		contextJSON,
 	).Scan(&createdAt, &updatedAt)
 
 	if err != nil {
@@ -318,6 +358,11 @@ func (h *DeceptionHandler) CreateHoneyToken(c *gin.Context) {
 		return
 	}
 
+	if req.TokenType == models.TokenTypeOfficeDocument {
+		sendHoneyDocument(c, http.StatusCreated, tokenID, req.Name, req.DocumentFormat, beaconURLFromToken(tokenValue))
+		return
+	}
+
 	token := models.HoneyToken{
 		ID:          tokenID,
 		LicenseID:   req.LicenseID,
@@ -328,6 +373,7 @@ func (h *DeceptionHandler) CreateHoneyToken(c *gin.Context) {
 		IsActive:    true,
 		AccessCount: 0,
 		Metadata:    req.Metadata,
+		ExpectedContext: req.ExpectedContext,
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
 	}
@@ -341,7 +387,7 @@ func (h *DeceptionHandler) ListHoneyTokens(c *gin.Context) {
 
 	query := `
 		SELECT id, license_id, name, token_type, token_value, callback_url,
-		       is_active, access_count, last_accessed, created_at, updated_at
+		       is_active, access_count, last_accessed, expected_context, created_at, updated_at
 		FROM honey_tokens
 		WHERE license_id = $1
 		ORDER BY created_at DESC
@@ -359,6 +405,7 @@ func (h *DeceptionHandler) ListHoneyTokens(c *gin.Context) {
 	for rows.Next() {
 		var token models.HoneyToken
 		var lastAccessed sql.NullTime
+		var contextJSON []byte
 
 		err := rows.Scan(
 			&token.ID,
@@ -370,6 +417,7 @@ func (h *DeceptionHandler) ListHoneyTokens(c *gin.Context) {
 			&token.IsActive,
 			&token.AccessCount,
 			&lastAccessed,
+			&contextJSON,
 			&token.CreatedAt,
 			&token.UpdatedAt,
 		)
@@ -381,6 +429,9 @@ func (h *DeceptionHandler) ListHoneyTokens(c *gin.Context) {
 		if lastAccessed.Valid {
 			token.LastAccessed = &lastAccessed.Time
 		}
+		if len(contextJSON) > 0 {
+			json.Unmarshal(contextJSON, &token.ExpectedContext)
+		}
 
 		tokens = append(tokens, token)
 	}
@@ -395,11 +446,13 @@ func (h *DeceptionHandler) ListHoneyTokens(c *gin.Context) {
 func (h *DeceptionHandler) RecordDeceptionEvent(c *gin.Context) {
 	var event models.DeceptionEvent
 	if err := c.ShouldBindJSON(&event); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	eventID := uuid.New().String()
+	h.applyHoneyTokenContext(&event, time.Now())
+	score := applyDeceptionScore(&event)
 	detailsJSON, _ := json.Marshal(event.Details)
 	metadataJSON, _ := json.Marshal(event.Metadata)
 
@@ -457,6 +510,8 @@ func (h *DeceptionHandler) RecordDeceptionEvent(c *gin.Context) {
 	event.DetectedAt = detectedAt
 	event.AlertCreated = false
 
+	h.raiseDeceptionAlert(&event, score)
+
 	c.JSON(http.StatusCreated, event)
 }
 
@@ -538,8 +593,13 @@ func (h *DeceptionHandler) ListDeceptionEvents(c *gin.Context) {
 
 // GetDeceptionStatistics retrieves statistics about deception deployments
 func (h *DeceptionHandler) GetDeceptionStatistics(c *gin.Context) {
-	licenseID := c.Query("license_id")
+	stats := h.statistics(c.Query("license_id"))
+
+	c.JSON(http.StatusOK, stats)
+}
 
+// statistics summarises a license's honeypots, honey tokens and deception events
+func (h *DeceptionHandler) statistics(licenseID string) models.DeceptionStatistics {
 	stats := models.DeceptionStatistics{
 		LicenseID: licenseID,
 	}
@@ -550,7 +610,7 @@ func (h *DeceptionHandler) GetDeceptionStatistics(c *gin.Context) {
 		       COUNT(CASE WHEN is_active = TRUE THEN 1 END),
 		       COUNT(CASE WHEN status = 'compromised' THEN 1 END)
 		FROM honeypots
-		WHERE license_id = $1
+		WHERE license_id = $1 AND deleted_at IS NULL
 	`, licenseID).Scan(&stats.TotalHoneypots, &stats.ActiveHoneypots, &stats.CompromisedHoneypots)
 
 	// Honey token statistics
@@ -577,7 +637,7 @@ func (h *DeceptionHandler) GetDeceptionStatistics(c *gin.Context) {
 		stats.ThreatScore = 100
 	}
 
-	c.JSON(http.StatusOK, stats)
+	return stats
 }
 
 // ListHoneypotTemplates lists available honeypot templates
@@ -625,26 +685,3 @@ func (h *DeceptionHandler) ListHoneypotTemplates(c *gin.Context) {
 		"count":     len(templates),
 	})
 }
-
-// Helper functions
-
-func (h *DeceptionHandler) generateHoneyToken(tokenType models.HoneyTokenType) string {
-	switch tokenType {
-	case models.TokenTypeAWSKey:
-		return fmt.Sprintf("AKIA%s", h.randomString(16))
-	case models.TokenTypeAPIKey:
-		return h.randomString(32)
-	case models.TokenTypeDatabaseCreds:
-		return fmt.Sprintf("user:honey_%s", h.randomString(12))
-	case models.TokenTypeDNSQuery:
-		return fmt.Sprintf("%s.canarytoken.com", h.randomString(16))
-	default:
-		return h.randomString(24)
-	}
-}
-
-func (h *DeceptionHandler) randomString(length int) string {
-	bytes := make([]byte, length/2)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
-}
@@ -0,0 +1,622 @@
+// Deception Auto-Deployment
+// Discovers the tenant's subnets and services and places honeypots that blend in with them
+
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	defaultAutoDeployHoneypots = 5
+	defaultAutoDeployLookback  = 7 * 24
+	maxDiscoveredServices      = 5000
+	autoDeployMinPrefix        = 16 // Larger subnets are not scanned for free addresses
+)
+
+// honeypotService describes the honeypot that imitates a service port
+type honeypotService struct {
+	honeypotType models.HoneypotType
+	platform     string // Empty follows the subnet's dominant OS
+	banners      map[string]string
+}
+
+// honeypotServices maps well-known service ports to the honeypot that imitates them
+var honeypotServices = map[int]honeypotService{
+	22:    {models.HoneypotTypeSSH, "linux", map[string]string{"linux": "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6"}},
+	445:   {models.HoneypotTypeSMB, "windows", map[string]string{"windows": "Windows Server 2019 Standard 17763"}},
+	139:   {models.HoneypotTypeSMB, "windows", map[string]string{"windows": "Windows Server 2019 Standard 17763"}},
+	3389:  {models.HoneypotTypeRDP, "windows", map[string]string{"windows": "Microsoft Terminal Services"}},
+	80:    {models.HoneypotTypeHTTP, "", map[string]string{"linux": "nginx/1.24.0", "windows": "Microsoft-IIS/10.0"}},
+	443:   {models.HoneypotTypeHTTP, "", map[string]string{"linux": "nginx/1.24.0", "windows": "Microsoft-IIS/10.0"}},
+	8080:  {models.HoneypotTypeHTTP, "", map[string]string{"linux": "Apache-Coyote/1.1", "windows": "Apache-Coyote/1.1"}},
+	8443:  {models.HoneypotTypeAPIEndpoint, "", map[string]string{"linux": "nginx/1.24.0", "windows": "Microsoft-HTTPAPI/2.0"}},
+	1433:  {models.HoneypotTypeDatabase, "windows", map[string]string{"windows": "Microsoft SQL Server 2019"}},
+	3306:  {models.HoneypotTypeDatabase, "linux", map[string]string{"linux": "8.0.36-0ubuntu0.22.04.1"}},
+	5432:  {models.HoneypotTypeDatabase, "linux", map[string]string{"linux": "PostgreSQL 15.6"}},
+	27017: {models.HoneypotTypeDatabase, "linux", map[string]string{"linux": "MongoDB 6.0.14"}},
+}
+
+// hostnameSeries splits a hostname into a prefix and a trailing number, e.g. web-07 -> web-, 07
+var hostnameSeries = regexp.MustCompile(`^(.*?)(\d+)$`)
+
+// SetClickHouse enables service discovery from network telemetry for auto-deployment
+func (h *DeceptionHandler) SetClickHouse(ch driver.Conn) {
+	h.clickhouse = ch
+}
+
+// discoveredHost is a host seen in the tenant's network
+type discoveredHost struct {
+	ip       uint32
+	hostname string
+	osType   string
+	ports    map[int]int64 // Port -> observations
+}
+
+// discoveredSubnet groups hosts by subnet for placement
+type discoveredSubnet struct {
+	network *net.IPNet
+	hosts   map[uint32]*discoveredHost
+	used    map[uint32]bool // Hosts, existing honeypots and excluded addresses
+	covered map[models.HoneypotType]int
+}
+
+// AutoDeployHoneypots recommends honeypots for unused addresses that imitate the services
+// around them, and creates them unless preview is set
+func (h *DeceptionHandler) AutoDeployHoneypots(c *gin.Context) {
+	var req models.AutoDeployRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.MaxHoneypots == 0 {
+		req.MaxHoneypots = defaultAutoDeployHoneypots
+	}
+	if req.LookbackHours == 0 {
+		req.LookbackHours = defaultAutoDeployLookback
+	}
+	for _, honeypotType := range req.HoneypotTypes {
+		if !autoDeployableType(honeypotType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("honeypot_type %s cannot be auto-deployed", honeypotType)})
+			return
+		}
+	}
+
+	var allowed []*net.IPNet
+	for _, cidr := range req.Subnets {
+		_, network, _ := net.ParseCIDR(cidr)
+		if ones, _ := network.Mask.Size(); ones < autoDeployMinPrefix {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("subnet %s is larger than /%d", cidr, autoDeployMinPrefix)})
+			return
+		}
+		allowed = append(allowed, network)
+	}
+
+	ctx := c.Request.Context()
+	hosts, err := h.discoverHosts(ctx, req)
+	if err != nil {
+		log.Errorf("Failed to discover network for auto-deployment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discover network"})
+		return
+	}
+
+	subnets := groupSubnets(hosts, allowed)
+	if err := h.markExistingHoneypots(req.LicenseID, subnets); err != nil {
+		log.Errorf("Failed to load existing honeypots: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load existing honeypots"})
+		return
+	}
+	for _, excluded := range req.ExcludeIPs {
+		if ip, ok := ipv4ToUint(net.ParseIP(excluded)); ok {
+			for _, subnet := range subnets {
+				subnet.used[ip] = true
+			}
+		}
+	}
+
+	response := models.AutoDeployResponse{
+		Preview:         req.Preview,
+		Subnets:         summarizeSubnets(subnets),
+		Recommendations: recommendHoneypots(subnets, req.HoneypotTypes, req.MaxHoneypots),
+	}
+
+	if !req.Preview && len(response.Recommendations) > 0 {
+		deployed, err := h.deployRecommendations(req.LicenseID, response.Recommendations)
+		if err != nil {
+			log.Errorf("Failed to auto-deploy honeypots: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deploy honeypots"})
+			return
+		}
+		response.Deployed = deployed
+		log.Infof("Auto-deployed %d honeypots for license %s", len(deployed), req.LicenseID)
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func autoDeployableType(honeypotType models.HoneypotType) bool {
+	for _, service := range honeypotServices {
+		if service.honeypotType == honeypotType {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverHosts merges agent inventory, services observed in network telemetry and the supplied
+// inventory into one host list keyed by IPv4 address
+func (h *DeceptionHandler) discoverHosts(ctx context.Context, req models.AutoDeployRequest) (map[uint32]*discoveredHost, error) {
+	hosts := make(map[uint32]*discoveredHost)
+	host := func(ip net.IP) *discoveredHost {
+		key, ok := ipv4ToUint(ip)
+		if !ok || !ip.IsPrivate() {
+			return nil
+		}
+		if hosts[key] == nil {
+			hosts[key] = &discoveredHost{ip: key, ports: make(map[int]int64)}
+		}
+		return hosts[key]
+	}
+
+	rows, err := h.db.Query(`
+		SELECT host(ip_address), hostname, COALESCE(os_type, '')
+		FROM agents
+		WHERE license_id = $1 AND ip_address IS NOT NULL AND deleted_at IS NULL
+	`, req.LicenseID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var ip, hostname, osType string
+		if err := rows.Scan(&ip, &hostname, &osType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if entry := host(net.ParseIP(ip)); entry != nil {
+			entry.hostname, entry.osType = hostname, strings.ToLower(osType)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Internal destinations of network connections reveal servers without agents
+	if h.clickhouse != nil {
+		since := time.Now().UTC().Add(-time.Duration(req.LookbackHours) * time.Hour)
+		chRows, err := h.clickhouse.Query(ctx, `
+			SELECT dst_ip, dst_port, count() AS observations
+			FROM telemetry_events
+			WHERE tenant_id = ? AND event_type = 'network_conn' AND timestamp >= ? AND dst_ip != '' AND dst_port > 0
+			GROUP BY dst_ip, dst_port
+			ORDER BY observations DESC
+			LIMIT ?
+		`, req.LicenseID, since, maxDiscoveredServices)
+		if err != nil {
+			return nil, err
+		}
+		defer chRows.Close()
+		for chRows.Next() {
+			var ip string
+			var port uint16
+			var observations uint64
+			if err := chRows.Scan(&ip, &port, &observations); err != nil {
+				return nil, err
+			}
+			if entry := host(net.ParseIP(ip)); entry != nil {
+				entry.ports[int(port)] += int64(observations)
+			}
+		}
+		if err := chRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, asset := range req.Inventory {
+		entry := host(net.ParseIP(asset.IP))
+		if entry == nil {
+			continue
+		}
+		if asset.Hostname != "" {
+			entry.hostname = asset.Hostname
+		}
+		if asset.OSType != "" {
+			entry.osType = strings.ToLower(asset.OSType)
+		}
+		for _, port := range asset.OpenPorts {
+			entry.ports[port]++
+		}
+	}
+	return hosts, nil
+}
+
+// groupSubnets assigns hosts to the allowed subnets, or to their /24 when none are given
+func groupSubnets(hosts map[uint32]*discoveredHost, allowed []*net.IPNet) []*discoveredSubnet {
+	byCIDR := make(map[string]*discoveredSubnet)
+	for _, network := range allowed {
+		byCIDR[network.String()] = newDiscoveredSubnet(network)
+	}
+
+	for ip, entry := range hosts {
+		addr := uintToIPv4(ip)
+		var network *net.IPNet
+		if len(allowed) == 0 {
+			network = &net.IPNet{IP: addr.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		} else {
+			for _, candidate := range allowed {
+				if candidate.Contains(addr) {
+					network = candidate
+					break
+				}
+			}
+			if network == nil {
+				continue
+			}
+		}
+		subnet, ok := byCIDR[network.String()]
+		if !ok {
+			subnet = newDiscoveredSubnet(network)
+			byCIDR[network.String()] = subnet
+		}
+		subnet.hosts[ip] = entry
+		subnet.used[ip] = true
+	}
+
+	subnets := make([]*discoveredSubnet, 0, len(byCIDR))
+	for _, subnet := range byCIDR {
+		subnets = append(subnets, subnet)
+	}
+	sort.Slice(subnets, func(i, j int) bool { return subnets[i].network.String() < subnets[j].network.String() })
+	return subnets
+}
+
+func newDiscoveredSubnet(network *net.IPNet) *discoveredSubnet {
+	return &discoveredSubnet{
+		network: network,
+		hosts:   make(map[uint32]*discoveredHost),
+		used:    make(map[uint32]bool),
+		covered: make(map[models.HoneypotType]int),
+	}
+}
+
+// markExistingHoneypots reserves the addresses of live honeypots and records which honeypot
+// types each subnet already has
+func (h *DeceptionHandler) markExistingHoneypots(licenseID string, subnets []*discoveredSubnet) error {
+	rows, err := h.db.Query(`
+		SELECT honeypot_type, COALESCE(location, '')
+		FROM honeypots
+		WHERE license_id = $1 AND deleted_at IS NULL
+	`, licenseID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var honeypotType models.HoneypotType
+		var location string
+		if err := rows.Scan(&honeypotType, &location); err != nil {
+			return err
+		}
+		addr := net.ParseIP(location)
+		ip, ok := ipv4ToUint(addr)
+		if !ok {
+			continue
+		}
+		for _, subnet := range subnets {
+			if subnet.network.Contains(addr) {
+				subnet.used[ip] = true
+				subnet.covered[honeypotType]++
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// services aggregates the ports in use across a subnet's hosts, busiest first
+func (s *discoveredSubnet) services() []models.ObservedService {
+	byPort := make(map[int]*models.ObservedService)
+	for _, entry := range s.hosts {
+		for port, observations := range entry.ports {
+			service, ok := byPort[port]
+			if !ok {
+				service = &models.ObservedService{Port: port}
+				byPort[port] = service
+			}
+			service.Hosts++
+			service.Observations += observations
+		}
+	}
+
+	services := make([]models.ObservedService, 0, len(byPort))
+	for _, service := range byPort {
+		services = append(services, *service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Observations != services[j].Observations {
+			return services[i].Observations > services[j].Observations
+		}
+		return services[i].Port < services[j].Port
+	})
+	return services
+}
+
+// dominantOS is the most common OS of a subnet's hosts
+func (s *discoveredSubnet) dominantOS() string {
+	counts := make(map[string]int)
+	best := ""
+	for _, entry := range s.hosts {
+		if entry.osType == "" {
+			continue
+		}
+		counts[entry.osType]++
+		if counts[entry.osType] > counts[best] || (counts[entry.osType] == counts[best] && entry.osType < best) {
+			best = entry.osType
+		}
+	}
+	return best
+}
+
+// freeAddress picks an unused host address next to the existing hosts, so the honeypot sits
+// inside the populated range rather than at its edge
+func (s *discoveredSubnet) freeAddress() (uint32, bool) {
+	base, _ := ipv4ToUint(s.network.IP)
+	ones, bits := s.network.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	if size < 4 {
+		return 0, false
+	}
+	first, last := base+2, base+size-2 // Skip the network, gateway (.1) and broadcast addresses
+
+	used := make([]uint32, 0, len(s.hosts))
+	for ip := range s.hosts {
+		used = append(used, ip)
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i] < used[j] })
+
+	for _, ip := range used {
+		for candidate := ip + 1; candidate <= last && candidate <= ip+16; candidate++ {
+			if !s.used[candidate] {
+				return candidate, true
+			}
+		}
+	}
+	for candidate := first; candidate <= last; candidate++ {
+		if !s.used[candidate] {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// blendHostname continues the naming series of the subnet's hosts, e.g. web-03 after web-01 and
+// web-02, so the honeypot looks like the next server in line
+func (s *discoveredSubnet) blendHostname(honeypotType models.HoneypotType, taken map[string]bool) string {
+	type series struct {
+		count, width, max int
+	}
+	prefixes := make(map[string]*series)
+	for _, entry := range s.hosts {
+		match := hostnameSeries.FindStringSubmatch(strings.ToLower(entry.hostname))
+		if match == nil || match[1] == "" {
+			continue
+		}
+		number, _ := strconv.Atoi(match[2])
+		p, ok := prefixes[match[1]]
+		if !ok {
+			p = &series{}
+			prefixes[match[1]] = p
+		}
+		p.count++
+		if number > p.max {
+			p.max = number
+		}
+		if len(match[2]) > p.width {
+			p.width = len(match[2])
+		}
+	}
+
+	bestPrefix := ""
+	for prefix, p := range prefixes {
+		if bestPrefix == "" || p.count > prefixes[bestPrefix].count || (p.count == prefixes[bestPrefix].count && prefix < bestPrefix) {
+			bestPrefix = prefix
+		}
+	}
+	if bestPrefix == "" {
+		bestPrefix = fmt.Sprintf("%s-srv-", honeypotType)
+		prefixes[bestPrefix] = &series{width: 2}
+	}
+
+	p := prefixes[bestPrefix]
+	for number := p.max + 1; ; number++ {
+		name := fmt.Sprintf("%s%0*d", bestPrefix, p.width, number)
+		if !taken[name] {
+			taken[name] = true
+			return name
+		}
+	}
+}
+
+func summarizeSubnets(subnets []*discoveredSubnet) []models.AutoDeploySubnet {
+	summaries := make([]models.AutoDeploySubnet, 0, len(subnets))
+	for _, subnet := range subnets {
+		honeypots := 0
+		for _, count := range subnet.covered {
+			honeypots += count
+		}
+		summaries = append(summaries, models.AutoDeploySubnet{
+			CIDR:      subnet.network.String(),
+			Hosts:     len(subnet.hosts),
+			Honeypots: honeypots,
+			OSType:    subnet.dominantOS(),
+			Services:  subnet.services(),
+		})
+	}
+	return summaries
+}
+
+// recommendHoneypots scores every service a honeypot can imitate in every subnet and keeps the
+// best placements. Services an existing honeypot already imitates in the subnet score lower.
+func recommendHoneypots(subnets []*discoveredSubnet, allowedTypes []models.HoneypotType, max int) []models.HoneypotRecommendation {
+	type candidate struct {
+		subnet  *discoveredSubnet
+		service models.ObservedService
+		score   float64
+	}
+
+	var candidates []candidate
+	for _, subnet := range subnets {
+		seenTypes := make(map[models.HoneypotType]bool)
+		for _, service := range subnet.services() {
+			imitation, ok := honeypotServices[service.Port]
+			if !ok || seenTypes[imitation.honeypotType] {
+				continue
+			}
+			if len(allowedTypes) > 0 && !containsHoneypotType(allowedTypes, imitation.honeypotType) {
+				continue
+			}
+			seenTypes[imitation.honeypotType] = true
+
+			// Services many hosts expose are the ones an attacker expects and probes first
+			score := float64(service.Hosts)*10 + float64(service.Observations)/100
+			score /= float64(1 + subnet.covered[imitation.honeypotType])
+			candidates = append(candidates, candidate{subnet: subnet, service: service, score: score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	recommendations := []models.HoneypotRecommendation{}
+	taken := make(map[string]bool)
+	for _, cand := range candidates {
+		if len(recommendations) >= max {
+			break
+		}
+		ip, ok := cand.subnet.freeAddress()
+		if !ok {
+			continue
+		}
+		cand.subnet.used[ip] = true
+
+		imitation := honeypotServices[cand.service.Port]
+		platform := imitation.platform
+		if platform == "" {
+			platform = cand.subnet.dominantOS()
+		}
+		if platform != "windows" {
+			platform = "linux"
+		}
+		recommendations = append(recommendations, models.HoneypotRecommendation{
+			Name:           cand.subnet.blendHostname(imitation.honeypotType, taken),
+			HoneypotType:   imitation.honeypotType,
+			TargetPlatform: platform,
+			Location:       uintToIPv4(ip).String(),
+			Subnet:         cand.subnet.network.String(),
+			ListenPort:     cand.service.Port,
+			ServiceBanner:  imitation.banners[platform],
+			Score:          cand.score,
+			Reason: fmt.Sprintf("port %d is served by %d hosts in %s (%d observations)",
+				cand.service.Port, cand.service.Hosts, cand.subnet.network, cand.service.Observations),
+		})
+	}
+	return recommendations
+}
+
+func containsHoneypotType(types []models.HoneypotType, honeypotType models.HoneypotType) bool {
+	for _, t := range types {
+		if t == honeypotType {
+			return true
+		}
+	}
+	return false
+}
+
+// deployRecommendations creates the recommended honeypots in one transaction
+func (h *DeceptionHandler) deployRecommendations(licenseID string, recommendations []models.HoneypotRecommendation) ([]models.Honeypot, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deployed := make([]models.Honeypot, 0, len(recommendations))
+	for _, rec := range recommendations {
+		honeypot := models.Honeypot{
+			ID:             uuid.New().String(),
+			LicenseID:      licenseID,
+			Name:           rec.Name,
+			HoneypotType:   rec.HoneypotType,
+			Status:         models.HoneypotStatusActive,
+			DeploymentMode: "network",
+			TargetPlatform: rec.TargetPlatform,
+			Configuration: models.HoneypotConfiguration{
+				ListenPort:         rec.ListenPort,
+				ServiceBanner:      rec.ServiceBanner,
+				LogAllInteractions: true,
+				AlertOnInteraction: true,
+			},
+			Location: rec.Location,
+			IsActive: true,
+			Metadata: map[string]interface{}{
+				"auto_deployed": true,
+				"subnet":        rec.Subnet,
+				"reason":        rec.Reason,
+			},
+			Version: 1,
+		}
+		configJSON, _ := json.Marshal(honeypot.Configuration)
+		metadataJSON, _ := json.Marshal(honeypot.Metadata)
+
+		err := tx.QueryRow(`
+			INSERT INTO honeypots (
+				id, license_id, name, honeypot_type, status, deployment_mode,
+				target_platform, configuration, location, is_active, metadata
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, TRUE, $10)
+			RETURNING deployed_at, created_at, updated_at
+		`, honeypot.ID, licenseID, honeypot.Name, honeypot.HoneypotType, honeypot.Status,
+			honeypot.DeploymentMode, honeypot.TargetPlatform, configJSON, honeypot.Location, metadataJSON,
+		).Scan(&honeypot.DeployedAt, &honeypot.CreatedAt, &honeypot.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deployed = append(deployed, honeypot)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deployed, nil
+}
+
+// ipv4ToUint converts an IPv4 address to its integer form for range arithmetic
+func ipv4ToUint(ip net.IP) (uint32, bool) {
+	v4 := ip.To4()
+	if v4 == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v4), true
+}
+
+func uintToIPv4(ip uint32) net.IP {
+	addr := make(net.IP, 4)
+	binary.BigEndian.PutUint32(addr, ip)
+	return addr
+}
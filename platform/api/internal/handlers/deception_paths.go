@@ -0,0 +1,280 @@
+// Deception Attacker Paths
+// Graph of how attacker sources move through honeypots and honey tokens, for path and heatmap views
+
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	defaultAttackerPathHours = 7 * 24
+	maxAttackerPathHours     = 90 * 24
+	maxAttackerPathEvents    = 20000
+)
+
+// attackerTouch is one deception event reduced to what the path graph needs
+type attackerTouch struct {
+	sourceIP        string
+	hostname        string
+	user            string
+	assetID         string
+	assetKind       string
+	assetName       string
+	assetType       string
+	interactionType string
+	severity        string
+	at              time.Time
+}
+
+// GetAttackerPaths returns the attacker path graph of a license: which sources touched which
+// deception assets, in what order and how quickly, and which assets catch attackers first.
+func (h *DeceptionHandler) GetAttackerPaths(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(defaultAttackerPathHours)))
+	if hours <= 0 || hours > maxAttackerPathHours {
+		hours = defaultAttackerPathHours
+	}
+	end := time.Now().UTC()
+	start := end.Add(-time.Duration(hours) * time.Hour)
+
+	query := `
+		SELECT host(de.source_ip), COALESCE(de.source_hostname, ''), COALESCE(de.source_user, ''),
+		       COALESCE(de.honeypot_id::text, ''), COALESCE(hp.name, ''), COALESCE(hp.honeypot_type, ''),
+		       COALESCE(de.honey_token_id::text, ''), COALESCE(ht.name, ''), COALESCE(ht.token_type, ''),
+		       de.interaction_type, COALESCE(de.severity, 'low'), de.detected_at
+		FROM deception_events de
+		LEFT JOIN honeypots hp ON hp.id = de.honeypot_id
+		LEFT JOIN honey_tokens ht ON ht.id = de.honey_token_id
+		WHERE de.license_id = $1 AND de.detected_at >= $2
+		  AND (de.honeypot_id IS NOT NULL OR de.honey_token_id IS NOT NULL)`
+	args := []interface{}{licenseID, start}
+	if sourceIP := c.Query("source_ip"); sourceIP != "" {
+		query += " AND host(de.source_ip) = $3"
+		args = append(args, sourceIP)
+	}
+	query += " ORDER BY de.source_ip, de.detected_at LIMIT " + strconv.Itoa(maxAttackerPathEvents+1)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to query deception events for attacker paths: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build attacker paths"})
+		return
+	}
+	defer rows.Close()
+
+	touches := make([]attackerTouch, 0)
+	truncated := false
+	for rows.Next() {
+		var t attackerTouch
+		var honeypotID, honeypotName, honeypotType, tokenID, tokenName, tokenType string
+		if err := rows.Scan(&t.sourceIP, &t.hostname, &t.user, &honeypotID, &honeypotName, &honeypotType,
+			&tokenID, &tokenName, &tokenType, &t.interactionType, &t.severity, &t.at); err != nil {
+			log.Errorf("Failed to scan deception event: %v", err)
+			continue
+		}
+		if len(touches) == maxAttackerPathEvents {
+			truncated = true
+			break
+		}
+		if honeypotID != "" {
+			t.assetID, t.assetKind, t.assetName, t.assetType = honeypotID, models.DeceptionAssetHoneypot, honeypotName, honeypotType
+		} else {
+			t.assetID, t.assetKind, t.assetName, t.assetType = tokenID, models.DeceptionAssetHoneyToken, tokenName, tokenType
+		}
+		touches = append(touches, t)
+	}
+
+	graph := buildAttackerPathGraph(touches)
+	graph.LicenseID = licenseID
+	graph.TimeRange = models.TimeRange{Start: start, End: end}
+	graph.Truncated = truncated
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// buildAttackerPathGraph assembles the graph from touches ordered by source and time
+func buildAttackerPathGraph(touches []attackerTouch) models.AttackerPathGraph {
+	graph := models.AttackerPathGraph{
+		Sources:         []models.AttackerSourceNode{},
+		Assets:          []models.DeceptionAssetNode{},
+		SourceEdges:     []models.AttackerSourceEdge{},
+		TransitionEdges: []models.DeceptionTransition{},
+		Paths:           []models.AttackerPath{},
+		EventsAnalyzed:  len(touches),
+	}
+
+	assets := make(map[string]*models.DeceptionAssetNode)
+	assetSources := make(map[string]map[string]bool)
+	depthSum := make(map[string]int)
+	depthCount := make(map[string]int)
+	transitions := make(map[[2]string]*models.DeceptionTransition)
+	gapSum := make(map[[2]string]float64)
+
+	for i := 0; i < len(touches); {
+		j := i
+		for j < len(touches) && touches[j].sourceIP == touches[i].sourceIP {
+			j++
+		}
+		source, edges, path := buildSourcePath(touches[i:j])
+		graph.Sources = append(graph.Sources, source)
+		graph.SourceEdges = append(graph.SourceEdges, edges...)
+		graph.Paths = append(graph.Paths, path)
+
+		for _, t := range touches[i:j] {
+			graph.Heatmap[t.at.UTC().Weekday()][t.at.UTC().Hour()]++
+			asset, ok := assets[t.assetID]
+			if !ok {
+				asset = &models.DeceptionAssetNode{ID: t.assetID, Kind: t.assetKind, Name: t.assetName, Type: t.assetType}
+				assets[t.assetID] = asset
+				assetSources[t.assetID] = make(map[string]bool)
+			}
+			asset.Interactions++
+			assetSources[t.assetID][t.sourceIP] = true
+		}
+
+		// First and deep touches count each asset once per source, at its first position
+		seen := make(map[string]bool)
+		for position, step := range path.Steps {
+			if position > 0 {
+				key := [2]string{path.Steps[position-1].AssetID, step.AssetID}
+				transition, ok := transitions[key]
+				if !ok {
+					transition = &models.DeceptionTransition{FromAssetID: key[0], ToAssetID: key[1]}
+					transitions[key] = transition
+				}
+				transition.Count++
+				gapSum[key] += step.GapSeconds
+			}
+
+			if seen[step.AssetID] {
+				continue
+			}
+			seen[step.AssetID] = true
+			if len(seen) == 1 {
+				assets[step.AssetID].FirstTouches++
+			} else {
+				assets[step.AssetID].DeepTouches++
+			}
+			depthSum[step.AssetID] += len(seen)
+			depthCount[step.AssetID]++
+		}
+		i = j
+	}
+
+	for id, asset := range assets {
+		asset.UniqueSources = len(assetSources[id])
+		if depthCount[id] > 0 {
+			asset.AvgDepth = float64(depthSum[id]) / float64(depthCount[id])
+		}
+		graph.Assets = append(graph.Assets, *asset)
+	}
+	sort.Slice(graph.Assets, func(i, j int) bool {
+		if graph.Assets[i].FirstTouches != graph.Assets[j].FirstTouches {
+			return graph.Assets[i].FirstTouches > graph.Assets[j].FirstTouches
+		}
+		return graph.Assets[i].Interactions > graph.Assets[j].Interactions
+	})
+
+	for key, transition := range transitions {
+		transition.AvgGapSeconds = gapSum[key] / float64(transition.Count)
+		graph.TransitionEdges = append(graph.TransitionEdges, *transition)
+	}
+	sort.Slice(graph.TransitionEdges, func(i, j int) bool {
+		return graph.TransitionEdges[i].Count > graph.TransitionEdges[j].Count
+	})
+
+	sort.SliceStable(graph.Sources, func(i, j int) bool {
+		return graph.Sources[i].Interactions > graph.Sources[j].Interactions
+	})
+	return graph
+}
+
+// buildSourcePath summarizes one source's touches, ordered by time
+func buildSourcePath(touches []attackerTouch) (models.AttackerSourceNode, []models.AttackerSourceEdge, models.AttackerPath) {
+	first, last := touches[0], touches[len(touches)-1]
+	source := models.AttackerSourceNode{
+		SourceIP:     first.sourceIP,
+		Interactions: len(touches),
+		FirstSeen:    first.at,
+		LastSeen:     last.at,
+		MaxSeverity:  first.severity,
+	}
+	path := models.AttackerPath{
+		SourceIP: first.sourceIP,
+		Steps:    []models.AttackerPathStep{},
+		Duration: last.at.Sub(first.at).Seconds(),
+	}
+
+	edges := make(map[string]*models.AttackerSourceEdge)
+	edgeOrder := make([]string, 0)
+	for _, t := range touches {
+		if t.hostname != "" && !containsString(source.Hostnames, t.hostname) {
+			source.Hostnames = append(source.Hostnames, t.hostname)
+		}
+		if t.user != "" && !containsString(source.Users, t.user) {
+			source.Users = append(source.Users, t.user)
+		}
+		if severityRank[t.severity] > severityRank[source.MaxSeverity] {
+			source.MaxSeverity = t.severity
+		}
+
+		edge, ok := edges[t.assetID]
+		if !ok {
+			edge = &models.AttackerSourceEdge{SourceIP: t.sourceIP, AssetID: t.assetID, FirstSeen: t.at}
+			edges[t.assetID] = edge
+			edgeOrder = append(edgeOrder, t.assetID)
+		}
+		edge.Interactions++
+		edge.LastSeen = t.at
+
+		// Repeated interactions with the same asset extend the current step
+		if n := len(path.Steps); n > 0 && path.Steps[n-1].AssetID == t.assetID {
+			step := &path.Steps[n-1]
+			step.Interactions++
+			step.LastAt = t.at
+			if !containsString(step.InteractionTypes, t.interactionType) {
+				step.InteractionTypes = append(step.InteractionTypes, t.interactionType)
+			}
+			if severityRank[t.severity] > severityRank[step.MaxSeverity] {
+				step.MaxSeverity = t.severity
+			}
+			continue
+		}
+
+		step := models.AttackerPathStep{
+			AssetID:          t.assetID,
+			AssetName:        t.assetName,
+			Kind:             t.assetKind,
+			InteractionTypes: []string{t.interactionType},
+			MaxSeverity:      t.severity,
+			Interactions:     1,
+			FirstAt:          t.at,
+			LastAt:           t.at,
+		}
+		if n := len(path.Steps); n > 0 {
+			step.GapSeconds = t.at.Sub(path.Steps[n-1].LastAt).Seconds()
+		}
+		path.Steps = append(path.Steps, step)
+	}
+
+	source.AssetsTouched = len(edges)
+	sourceEdges := make([]models.AttackerSourceEdge, 0, len(edgeOrder))
+	for _, assetID := range edgeOrder {
+		sourceEdges = append(sourceEdges, *edges[assetID])
+	}
+	return source, sourceEdges, path
+}
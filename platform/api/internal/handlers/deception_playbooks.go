@@ -0,0 +1,164 @@
+// Deception Playbooks
+// Stored response playbooks, run by alert rules with a run_playbook action
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// playbookActionTypes are the playbook steps the alert action executor can run
+var playbookActionTypes = map[string]bool{
+	"send_alert":                  true,
+	"quarantine_host":             true,
+	"block_ip":                    true,
+	models.AlertActionNotify:      true,
+	models.AlertActionIsolateHost: true,
+	models.AlertActionCreateCase:  true,
+}
+
+const deceptionPlaybookColumns = `id, license_id, name, COALESCE(description, ''), enabled, trigger_conditions,
+	actions, execution_count, last_executed, created_at, updated_at`
+
+func scanDeceptionPlaybook(row rowScanner) (models.DeceptionPlaybook, error) {
+	var playbook models.DeceptionPlaybook
+	var conditionsJSON, actionsJSON []byte
+	var lastExecuted sql.NullTime
+	err := row.Scan(&playbook.ID, &playbook.LicenseID, &playbook.Name, &playbook.Description, &playbook.Enabled,
+		&conditionsJSON, &actionsJSON, &playbook.ExecutionCount, &lastExecuted, &playbook.CreatedAt, &playbook.UpdatedAt)
+	if err != nil {
+		return playbook, err
+	}
+	json.Unmarshal(conditionsJSON, &playbook.TriggerConditions)
+	json.Unmarshal(actionsJSON, &playbook.Actions)
+	if lastExecuted.Valid {
+		playbook.LastExecuted = &lastExecuted.Time
+	}
+	return playbook, nil
+}
+
+// loadDeceptionPlaybook returns a license's playbook with its steps in priority order
+func loadDeceptionPlaybook(db *sql.DB, licenseID, playbookID string) (models.DeceptionPlaybook, error) {
+	playbook, err := scanDeceptionPlaybook(db.QueryRow(
+		"SELECT "+deceptionPlaybookColumns+" FROM deception_playbooks WHERE id = $1 AND license_id = $2",
+		playbookID, licenseID,
+	))
+	if err != nil {
+		return playbook, err
+	}
+	sort.SliceStable(playbook.Actions, func(i, j int) bool {
+		return playbook.Actions[i].Priority < playbook.Actions[j].Priority
+	})
+	return playbook, nil
+}
+
+// CreatePlaybook stores a deception playbook
+func (h *DeceptionHandler) CreatePlaybook(c *gin.Context) {
+	var req models.CreateDeceptionPlaybookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	fields := map[string]string{}
+	isolates := false
+	for i, action := range req.Actions {
+		if !playbookActionTypes[action.ActionType] {
+			fields[fmt.Sprintf("actions[%d].action_type", i)] = "must be one of send_alert, notify, quarantine_host, isolate_host, block_ip, create_case"
+		}
+		if action.ActionType == "quarantine_host" || action.ActionType == models.AlertActionIsolateHost {
+			isolates = true
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+	if isolates && !middleware.HasPermission(c, models.PermAgentsIsolate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Isolating hosts requires the agents:isolate permission"})
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if req.TriggerConditions == nil {
+		req.TriggerConditions = map[string]interface{}{}
+	}
+	conditionsJSON, _ := json.Marshal(req.TriggerConditions)
+	actionsJSON, _ := json.Marshal(req.Actions)
+
+	playbook, err := scanDeceptionPlaybook(h.db.QueryRow(`
+		INSERT INTO deception_playbooks (id, license_id, name, description, enabled, trigger_conditions, actions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+deceptionPlaybookColumns,
+		uuid.New().String(), req.LicenseID, req.Name, nullIfEmpty(req.Description), enabled, conditionsJSON, actionsJSON,
+	))
+	if err != nil {
+		log.Errorf("Failed to create deception playbook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create playbook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, playbook)
+}
+
+// ListPlaybooks lists a license's deception playbooks
+func (h *DeceptionHandler) ListPlaybooks(c *gin.Context) {
+	rows, err := h.db.Query(
+		"SELECT "+deceptionPlaybookColumns+" FROM deception_playbooks WHERE license_id = $1 ORDER BY name",
+		c.Query("license_id"),
+	)
+	if err != nil {
+		log.Errorf("Failed to list deception playbooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list playbooks"})
+		return
+	}
+	defer rows.Close()
+
+	playbooks := []models.DeceptionPlaybook{}
+	for rows.Next() {
+		playbook, err := scanDeceptionPlaybook(rows)
+		if err != nil {
+			log.Errorf("Failed to scan deception playbook: %v", err)
+			continue
+		}
+		playbooks = append(playbooks, playbook)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": playbooks,
+		"count": len(playbooks),
+	})
+}
+
+// DeletePlaybook removes a deception playbook. Rules that still run it record a failed action.
+func (h *DeceptionHandler) DeletePlaybook(c *gin.Context) {
+	result, err := h.db.Exec(
+		"DELETE FROM deception_playbooks WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete deception playbook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete playbook"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playbook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Playbook deleted"})
+}
@@ -0,0 +1,222 @@
+// Deception Event Scoring
+// Classifies interactions with deception assets and raises alerts for the ones worth waking someone for
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// interactionScores is the base score per interaction type. Touching a decoy is never legitimate,
+// so even an unrecognised interaction starts above a plain scan.
+var interactionScores = map[string]int{
+	"scan":            20,
+	"access":          45,
+	"file_access":     50,
+	"beacon":          70,
+	"credential_use":  80,
+	"exploit_attempt": 90,
+}
+
+const (
+	defaultInteractionScore = 40
+
+	// Scans are aggregated per source: one alert once this many land within the window
+	scanAggregationThreshold = 10
+	scanAggregationWindow    = 15 * time.Minute
+)
+
+// scoreDeceptionEvent returns a 0-100 score and the severity it maps to
+func scoreDeceptionEvent(event models.DeceptionEvent) (int, string) {
+	score, ok := interactionScores[event.InteractionType]
+	if !ok {
+		score = defaultInteractionScore
+	}
+
+	switch event.EventType {
+	case models.EventTypeHoneyTokenAccess:
+		// A honey token can only be used by someone who found and took it; how far the access
+		// strays from where the token lives grades how likely that someone is an intruder
+		score += honeyTokenBonus(event.Details)
+	case models.EventTypeCredentialAttempt:
+		score += 20
+	case models.EventTypeFileAccess:
+		score += 10
+	}
+
+	if event.Details.Command != "" {
+		score += 10
+	}
+	if event.Details.AuthenticationInfo != "" {
+		score += 10
+	}
+	if event.Details.BytesTransferred > 0 {
+		score += 5
+	}
+
+	if score > 100 {
+		score = 100
+	}
+
+	switch {
+	case score >= 85:
+		return score, "critical"
+	case score >= 60:
+		return score, "high"
+	case score >= 35:
+		return score, "medium"
+	default:
+		return score, "low"
+	}
+}
+
+// applyDeceptionScore sets the event severity to the scored one unless the reporter already
+// claimed something more severe
+func applyDeceptionScore(event *models.DeceptionEvent) int {
+	score, severity := scoreDeceptionEvent(*event)
+	if severityRank[severity] > severityRank[event.Severity] {
+		event.Severity = severity
+	}
+	return score
+}
+
+// raiseDeceptionAlert creates an alert for a recorded event when it warrants one. High and critical
+// interactions alert individually; scans are only alerted once a source crosses the aggregation
+// threshold, and then once per window.
+func (h *DeceptionHandler) raiseDeceptionAlert(event *models.DeceptionEvent, score int) {
+	var message string
+	count := 1
+
+	switch {
+	case severityRank[event.Severity] >= severityRank["high"]:
+		message = fmt.Sprintf("Deception %s: %s from %s", event.EventType, event.InteractionType, event.SourceIP)
+	case event.InteractionType == "scan":
+		var alerted bool
+		err := h.db.QueryRow(`
+			SELECT COUNT(*), COALESCE(BOOL_OR(alert_created), FALSE)
+			FROM deception_events
+			WHERE license_id = $1 AND source_ip = $2 AND interaction_type = 'scan'
+			  AND detected_at >= NOW() - ($3 * INTERVAL '1 second')
+		`, event.LicenseID, event.SourceIP, int(scanAggregationWindow.Seconds())).Scan(&count, &alerted)
+		if err != nil {
+			log.Errorf("Failed to aggregate deception scans: %v", err)
+			return
+		}
+		if alerted || count < scanAggregationThreshold {
+			return
+		}
+		event.Severity = "medium"
+		message = fmt.Sprintf("Deception assets scanned %d times from %s in %s", count, event.SourceIP, scanAggregationWindow)
+	default:
+		return
+	}
+
+	ruleID, err := h.deceptionAlertRule(event.LicenseID)
+	if err != nil {
+		log.Errorf("Failed to resolve deception alert rule: %v", err)
+		return
+	}
+
+	if suppressionID, suppressed := suppressAlert(h.db, ruleID, map[string]string{
+		"source_ip": event.SourceIP,
+		"hostname":  event.SourceHostname,
+		"username":  event.SourceUser,
+	}); suppressed {
+		log.Infof("Deception alert suppressed by %s: %s", suppressionID, message)
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"source":             "deception",
+		"deception_event_id": event.ID,
+		"event_type":         event.EventType,
+		"interaction_type":   event.InteractionType,
+		"honeypot_id":        event.HoneypotID,
+		"honey_token_id":     event.HoneyTokenID,
+		"source_ip":          event.SourceIP,
+		"source_hostname":    event.SourceHostname,
+		"source_user":        event.SourceUser,
+		"score":              score,
+		"event_count":        count,
+		"context_deviations": event.Details.ContextDeviations,
+	})
+
+	alertID, createdAt, err := raiseAlert(h.db, newAlert{
+		ruleID:      ruleID,
+		severity:    event.Severity,
+		message:     message,
+		entityType:  "source_ip",
+		entityValue: event.SourceIP,
+		eventIDs:    []string{event.ID},
+		details:     details,
+		source:      "deception",
+	})
+	if err != nil {
+		log.Errorf("Failed to create deception alert: %v", err)
+		return
+	}
+
+	h.db.Exec(`
+		UPDATE deception_events SET alert_created = TRUE, alert_id = $1, severity = $2
+		WHERE id = $3
+	`, alertID, event.Severity, event.ID)
+
+	event.AlertCreated = true
+	event.AlertID = alertID
+
+	BroadcastAlert(event.LicenseID, models.WSAlertNotification{
+		AlertID:    alertID,
+		RuleName:   deceptionAlertRuleName,
+		Severity:   event.Severity,
+		Message:    message,
+		EventCount: count,
+		Hostname:   event.SourceHostname,
+		CreatedAt:  createdAt,
+	})
+
+	// Delivery and rule actions can be slow (SMTP, webhooks); don't hold up the sensor
+	// reporting the event
+	licenseID, eventID, severity := event.LicenseID, event.ID, event.Severity
+	fired := firedAlert{id: alertID, ruleID: ruleID, licenseID: licenseID, severity: severity, message: message, hostname: event.SourceHostname}
+	go func() {
+		notifier := NewNotificationHandler(h.db)
+		notifier.NotifyLicense(licenseID, "Privé deception alert: "+message, message, severity, map[string]interface{}{
+			"alert_id":           alertID,
+			"deception_event_id": eventID,
+			"source":             "deception",
+		})
+		NewAlertActionExecutor(h.db).Execute(fired)
+	}()
+
+	log.Warnf("Deception alert %s raised (%s, score %d): %s", alertID, severity, score, message)
+}
+
+const deceptionAlertRuleName = "Deception asset interaction"
+
+// deceptionAlertRule returns the license's built-in deception alert rule, creating it on first use.
+// alert_instances are license-scoped through their rule, so deception alerts need one too.
+func (h *DeceptionHandler) deceptionAlertRule(licenseID string) (string, error) {
+	var ruleID string
+	err := h.db.QueryRow(`
+		SELECT id FROM alert_rules
+		WHERE license_id = $1 AND condition->>'source' = 'deception'
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, licenseID).Scan(&ruleID)
+	if err == nil {
+		return ruleID, nil
+	}
+
+	err = h.db.QueryRow(`
+		INSERT INTO alert_rules (license_id, name, description, severity, enabled, condition)
+		VALUES ($1, $2, 'Raised automatically when a honeypot or honey token is touched', 'high', TRUE, '{"source": "deception"}')
+		RETURNING id
+	`, licenseID, deceptionAlertRuleName).Scan(&ruleID)
+	return ruleID, err
+}
@@ -6,10 +6,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"sort"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/models"
@@ -17,13 +20,15 @@ import (
 
 // DLPHandler handles DLP policy management requests
 type DLPHandler struct {
-	db *sql.DB
+	db         *sql.DB
+	clickhouse driver.Conn // Violation events; nil disables the violations view
 }
 
 // NewDLPHandler creates a new DLP handler
-func NewDLPHandler(db *sql.DB) *DLPHandler {
+func NewDLPHandler(db *sql.DB, ch driver.Conn) *DLPHandler {
 	return &DLPHandler{
-		db: db,
+		db:         db,
+		clickhouse: ch,
 	}
 }
 
@@ -37,9 +42,9 @@ func (h *DLPHandler) ListDLPPolicies(c *gin.Context) {
 
 	query := `
 		SELECT id, license_id, name, description, severity, enabled, rule_type,
-		       config, fingerprint_count, created_at, updated_at
+		       config, fingerprint_count, ` + dlpPolicyGroupsExpr + `, created_at, updated_at, deleted_at, version
 		FROM dlp_policies
-		WHERE license_id = $1
+		WHERE license_id = $1` + liveOnly(c) + `
 		ORDER BY created_at DESC
 	`
 
@@ -55,6 +60,7 @@ func (h *DLPHandler) ListDLPPolicies(c *gin.Context) {
 	for rows.Next() {
 		var policy models.DLPPolicy
 		var configJSON []byte
+		var deletedAt sql.NullTime
 
 		err := rows.Scan(
 			&policy.ID,
@@ -66,14 +72,20 @@ func (h *DLPHandler) ListDLPPolicies(c *gin.Context) {
 			&policy.RuleType,
 			&configJSON,
 			&policy.FingerprintCount,
+			pq.Array(&policy.Groups),
 			&policy.CreatedAt,
 			&policy.UpdatedAt,
+			&deletedAt,
+			&policy.Version,
 		)
 
 		if err != nil {
 			log.Warnf("Failed to scan policy: %v", err)
 			continue
 		}
+		if deletedAt.Valid {
+			policy.DeletedAt = &deletedAt.Time
+		}
 
 		// Parse JSON config
 		if len(configJSON) > 0 {
@@ -95,13 +107,13 @@ func (h *DLPHandler) GetDLPPolicy(c *gin.Context) {
 
 	query := `
 		SELECT id, license_id, name, description, severity, enabled, rule_type,
-		       config, fingerprint_count, created_at, updated_at
+		       config, fingerprint_count, ` + dlpPolicyGroupsExpr + `, created_at, updated_at, deleted_at, version
 		FROM dlp_policies
-		WHERE id = $1
-	`
+		WHERE id = $1` + liveOnly(c)
 
 	var policy models.DLPPolicy
 	var configJSON []byte
+	var deletedAt sql.NullTime
 
 	err := h.db.QueryRow(query, policyID).Scan(
 		&policy.ID,
@@ -113,8 +125,11 @@ func (h *DLPHandler) GetDLPPolicy(c *gin.Context) {
 		&policy.RuleType,
 		&configJSON,
 		&policy.FingerprintCount,
+		pq.Array(&policy.Groups),
 		&policy.CreatedAt,
 		&policy.UpdatedAt,
+		&deletedAt,
+		&policy.Version,
 	)
 
 	if err != nil {
@@ -126,12 +141,16 @@ func (h *DLPHandler) GetDLPPolicy(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
 		return
 	}
+	if deletedAt.Valid {
+		policy.DeletedAt = &deletedAt.Time
+	}
 
 	// Parse JSON config
 	if len(configJSON) > 0 {
 		json.Unmarshal(configJSON, &policy.Config)
 	}
 
+	setVersionETag(c, policy.Version)
 	c.JSON(http.StatusOK, policy)
 }
 
@@ -140,7 +159,7 @@ func (h *DLPHandler) CreateDLPPolicy(c *gin.Context) {
 	var req models.CreateDLPPolicyRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -150,6 +169,13 @@ func (h *DLPHandler) CreateDLPPolicy(c *gin.Context) {
 		return
 	}
 
+	config, fieldErrs := validateDLPConfig(req.RuleType, req.Config)
+	if fieldErrs != nil {
+		c.JSON(http.StatusBadRequest, dlpConfigErrorResponse(fieldErrs))
+		return
+	}
+	req.Config = config
+
 	// Validate license exists
 	var licenseExists bool
 	err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM licenses WHERE id = $1 AND is_active = TRUE)", req.TenantID).Scan(&licenseExists)
@@ -158,6 +184,11 @@ func (h *DLPHandler) CreateDLPPolicy(c *gin.Context) {
 		return
 	}
 
+	if err := h.validateEDMDatasets(req.TenantID, req.Config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Generate policy ID
 	policyID := uuid.New().String()
 
@@ -197,6 +228,7 @@ func (h *DLPHandler) CreateDLPPolicy(c *gin.Context) {
 		Enabled:     req.Enabled,
 		RuleType:    req.RuleType,
 		Config:      req.Config,
+		Groups:      []string{},
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
 	}
@@ -210,16 +242,21 @@ func (h *DLPHandler) CreateDLPPolicy(c *gin.Context) {
 func (h *DLPHandler) UpdateDLPPolicy(c *gin.Context) {
 	policyID := c.Param("id")
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateDLPPolicyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	// Build dynamic update query
 	query := `
 		UPDATE dlp_policies
-		SET updated_at = NOW()
+		SET updated_at = NOW(), version = version + 1
 	`
 	args := []interface{}{}
 	argCount := 1
@@ -245,61 +282,67 @@ func (h *DLPHandler) UpdateDLPPolicy(c *gin.Context) {
 		argCount++
 	}
 	if req.Config != nil {
-		configJSON, _ := json.Marshal(req.Config)
+		var licenseID, ruleType string
+		if err := h.db.QueryRow("SELECT license_id, rule_type FROM dlp_policies WHERE id = $1 AND deleted_at IS NULL", policyID).Scan(&licenseID, &ruleType); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+		config, fieldErrs := validateDLPConfig(ruleType, *req.Config)
+		if fieldErrs != nil {
+			c.JSON(http.StatusBadRequest, dlpConfigErrorResponse(fieldErrs))
+			return
+		}
+		if err := h.validateEDMDatasets(licenseID, config); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		configJSON, _ := json.Marshal(config)
 		query += `, config = $` + string(rune('0'+argCount))
 		args = append(args, string(configJSON))
 		argCount++
 	}
 
-	query += ` WHERE id = $` + string(rune('0'+argCount))
-	args = append(args, policyID)
+	versionArg := string(rune('0' + argCount + 1))
+	query += ` WHERE id = $` + string(rune('0'+argCount)) + ` AND deleted_at IS NULL`
+	query += ` AND ($` + versionArg + ` = 0 OR version = $` + versionArg + `) RETURNING version`
+	args = append(args, policyID, expectedVersion)
 
-	result, err := h.db.Exec(query, args...)
+	var version int
+	err := h.db.QueryRow(query, args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "dlp_policies", "Policy", policyID)
+		return
+	}
 	if err != nil {
 		log.Errorf("Failed to update DLP policy: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update policy"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
-		return
-	}
-
 	log.Infof("Updated DLP policy: %s", policyID)
 
+	setVersionETag(c, version)
 	c.JSON(http.StatusOK, gin.H{
 		"id":         policyID,
+		"version":    version,
 		"updated_at": time.Now(),
 		"message":    "Policy updated successfully",
 	})
 }
 
-// DeleteDLPPolicy deletes a DLP policy
+// DeleteDLPPolicy soft-deletes a DLP policy; agents stop receiving it until it is restored
 func (h *DLPHandler) DeleteDLPPolicy(c *gin.Context) {
-	policyID := c.Param("id")
-
-	query := `DELETE FROM dlp_policies WHERE id = $1`
-
-	result, err := h.db.Exec(query, policyID)
-	if err != nil {
-		log.Errorf("Failed to delete DLP policy: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete policy"})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
-		return
-	}
+	softDeleteRow(c, h.db, "dlp_policies", "Policy")
+}
 
-	log.Infof("Deleted DLP policy: %s", policyID)
+// RestoreDLPPolicy brings back a soft-deleted DLP policy with its fingerprints and assignments
+func (h *DLPHandler) RestoreDLPPolicy(c *gin.Context) {
+	restoreRow(c, h.db, "dlp_policies", "Policy")
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Policy deleted successfully",
-	})
+// PurgeDLPPolicy permanently removes a soft-deleted DLP policy
+func (h *DLPHandler) PurgeDLPPolicy(c *gin.Context) {
+	purgeRow(c, h.db, "dlp_policies", "Policy")
 }
 
 // AddFingerprints adds fingerprints to a DLP policy
@@ -308,7 +351,7 @@ func (h *DLPHandler) AddFingerprints(c *gin.Context) {
 
 	var req models.AddFingerprintsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -330,8 +373,8 @@ func (h *DLPHandler) AddFingerprints(c *gin.Context) {
 		_, err := tx.Exec(insertQuery,
 			uuid.New().String(),
 			policyID,
-			fp.Hash,
-			fp.Source,
+			fp,
+			req.Source,
 		)
 		if err != nil {
 			log.Errorf("Failed to insert fingerprint: %v", err)
@@ -344,14 +387,18 @@ func (h *DLPHandler) AddFingerprints(c *gin.Context) {
 	updateQuery := `
 		UPDATE dlp_policies
 		SET fingerprint_count = fingerprint_count + $1, updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND deleted_at IS NULL
 	`
-	_, err = tx.Exec(updateQuery, len(req.Fingerprints), policyID)
+	result, err := tx.Exec(updateQuery, len(req.Fingerprints), policyID)
 	if err != nil {
 		log.Errorf("Failed to update fingerprint count: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update policy"})
 		return
 	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
@@ -424,21 +471,21 @@ func (h *DLPHandler) DeleteFingerprint(c *gin.Context) {
 func (h *DLPHandler) TestDLPPolicy(c *gin.Context) {
 	var req models.TestDLPPolicyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	// Get policy from database
 	query := `
-		SELECT id, name, severity, rule_type, config
+		SELECT id, license_id, name, severity, rule_type, config
 		FROM dlp_policies
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	var policyID, name, severity, ruleType string
+	var policyID, licenseID, name, severity, ruleType string
 	var configJSON []byte
 
-	err := h.db.QueryRow(query, req.PolicyID).Scan(&policyID, &name, &severity, &ruleType, &configJSON)
+	err := h.db.QueryRow(query, req.PolicyID).Scan(&policyID, &licenseID, &name, &severity, &ruleType, &configJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
@@ -448,20 +495,100 @@ func (h *DLPHandler) TestDLPPolicy(c *gin.Context) {
 		return
 	}
 
-	// For now, return mock results (in production, this would run actual DLP scan)
-	// TODO: Integrate with actual DLP engine from agent code
+	// Fingerprints are BLAKE3 hashes of document chunks, only computed by the agent
+	if ruleType == models.DLPRuleFingerprint {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Fingerprint policies match documents on the agent and cannot be tested against sample data"})
+		return
+	}
+
+	var config map[string]interface{}
+	if len(configJSON) > 0 {
+		json.Unmarshal(configJSON, &config)
+	}
+
+	// Built-in detectors enabled by name, plus the policy's own keyword dictionary
+	scanStart := time.Now()
+	detections := []dlpDetection{}
+	for _, detectorName := range configStrings(config, "detectors") {
+		if detector, ok := dlpDetectors[detectorName]; ok {
+			detections = append(detections, detector.scan(req.TestData)...)
+		}
+	}
+	if keywords := configStrings(config, "keywords"); len(keywords) > 0 {
+		custom := dictionaryDetector("keywords", "", keywords)
+		detections = append(detections, custom.scan(req.TestData)...)
+	}
+
+	matches := make([]models.DLPMatch, 0, len(detections))
+	for _, d := range detections {
+		matchType := "detector"
+		if d.detector == "keywords" {
+			matchType = "keyword"
+		}
+		matches = append(matches, models.DLPMatch{
+			PolicyID:   policyID,
+			PolicyName: name,
+			Offset:     d.offset,
+			Length:     d.length,
+			Confidence: d.confidence,
+			MatchType:  matchType,
+			Detector:   d.detector,
+		})
+	}
+
+	// The policy's own patterns
+	if ruleType == models.DLPRuleRegex {
+		var regexConfig models.DLPRegexConfig
+		if err := decodeDLPConfig(config, &regexConfig); err != nil {
+			log.Warnf("Failed to decode config of regex policy %s: %v", policyID, err)
+		}
+		for _, p := range regexConfig.Patterns {
+			re, err := compileDLPPattern(p)
+			if err != nil {
+				continue
+			}
+			confidence := p.Confidence
+			if confidence == 0 {
+				confidence = defaultRegexConfidence
+			}
+			for _, loc := range re.FindAllStringIndex(req.TestData, -1) {
+				matches = append(matches, models.DLPMatch{
+					PolicyID:   policyID,
+					PolicyName: name,
+					Offset:     loc[0],
+					Length:     loc[1] - loc[0],
+					Confidence: confidence,
+					MatchType:  "regex",
+					Detector:   p.Name,
+				})
+			}
+		}
+	}
+
+	// Exact data match against the policy's datasets
+	edmMatches, err := scanEDMDatasets(h.db, licenseID, configStrings(config, "edm_datasets"), req.TestData)
+	if err != nil {
+		log.Errorf("Failed to scan EDM datasets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan EDM datasets"})
+		return
+	}
+	for _, m := range edmMatches {
+		matches = append(matches, models.DLPMatch{
+			PolicyID:   policyID,
+			PolicyName: name,
+			Offset:     m.offset,
+			Length:     m.length,
+			Confidence: float64(m.matchedColumns) / float64(m.totalColumns),
+			MatchType:  "edm",
+			Detector:   m.datasetName,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Offset < matches[j].Offset })
+
 	results := models.TestDLPPolicyResponse{
-		Matches: []models.DLPMatch{
-			{
-				PolicyID:   policyID,
-				PolicyName: name,
-				Offset:     42,
-				Length:     11,
-				Confidence: 0.95,
-				MatchType:  "exact",
-			},
-		},
-		ScanDurationMs: 15,
+		Matches:        matches,
+		ScanDurationMs: time.Since(scanStart).Milliseconds(),
 		DataSizeBytes:  len(req.TestData),
 	}
 
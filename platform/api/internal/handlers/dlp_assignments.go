@@ -0,0 +1,192 @@
+// DLP Policy Assignment Handlers
+// Targets DLP policies at agent groups; unassigned policies apply to every agent of the license
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const maxGroupNameLength = 255
+
+// dlpPolicyGroupsExpr selects the groups a dlp_policies row is assigned to
+const dlpPolicyGroupsExpr = "ARRAY(SELECT a.group_name FROM dlp_policy_assignments a WHERE a.policy_id = dlp_policies.id ORDER BY a.group_name)"
+
+// normalizeGroups trims, de-duplicates and validates group names
+func normalizeGroups(groups []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			return nil, fmt.Errorf("group names must not be empty")
+		}
+		if len(group) > maxGroupNameLength {
+			return nil, fmt.Errorf("group name %q exceeds %d characters", group, maxGroupNameLength)
+		}
+		if !seen[group] {
+			seen[group] = true
+			normalized = append(normalized, group)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// effectiveDLPPolicies returns the enabled policies of a license that apply to an agent in the given groups
+func effectiveDLPPolicies(db *sql.DB, licenseID string, groups []string) ([]models.DLPPolicy, error) {
+	rows, err := db.Query(`
+		SELECT id, license_id, name, description, severity, enabled, rule_type,
+		       config, fingerprint_count, `+dlpPolicyGroupsExpr+`, created_at, updated_at
+		FROM dlp_policies
+		WHERE license_id = $1 AND enabled = TRUE AND deleted_at IS NULL
+		  AND (NOT EXISTS (SELECT 1 FROM dlp_policy_assignments a WHERE a.policy_id = dlp_policies.id)
+		       OR EXISTS (SELECT 1 FROM dlp_policy_assignments a WHERE a.policy_id = dlp_policies.id AND a.group_name = ANY($2)))
+		ORDER BY created_at
+	`, licenseID, pq.Array(groups))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []models.DLPPolicy{}
+	for rows.Next() {
+		var policy models.DLPPolicy
+		var description sql.NullString
+		var configJSON []byte
+		if err := rows.Scan(&policy.ID, &policy.TenantID, &policy.Name, &description, &policy.Severity,
+			&policy.Enabled, &policy.RuleType, &configJSON, &policy.FingerprintCount,
+			pq.Array(&policy.Groups), &policy.CreatedAt, &policy.UpdatedAt); err != nil {
+			return nil, err
+		}
+		policy.Description = description.String
+		if len(configJSON) > 0 {
+			json.Unmarshal(configJSON, &policy.Config)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// GetDLPPolicyAssignments lists the agent groups a policy is assigned to
+func (h *DLPHandler) GetDLPPolicyAssignments(c *gin.Context) {
+	policyID := c.Param("id")
+
+	var groups []string
+	var version int
+	err := h.db.QueryRow(
+		"SELECT "+dlpPolicyGroupsExpr+", version FROM dlp_policies WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)",
+		policyID, principalLicense(c),
+	).Scan(pq.Array(&groups), &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+		log.Errorf("Failed to query DLP policy assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+	if groups == nil {
+		groups = []string{}
+	}
+
+	setVersionETag(c, version)
+	c.JSON(http.StatusOK, gin.H{
+		"policy_id":    policyID,
+		"groups":       groups,
+		"license_wide": len(groups) == 0,
+		"version":      version,
+	})
+}
+
+// SetDLPPolicyAssignments replaces the agent groups a policy is assigned to. Assignments share
+// the policy's version, so the If-Match ETag comes from either GET endpoint.
+func (h *DLPHandler) SetDLPPolicyAssignments(c *gin.Context) {
+	policyID := c.Param("id")
+
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetDLPPolicyAssignmentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	groups, err := normalizeGroups(req.Groups)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRow(`
+		UPDATE dlp_policies SET updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+		  AND ($3 = '' OR license_id::text = $3)
+		RETURNING version
+	`, policyID, expectedVersion, principalLicense(c)).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "dlp_policies", "Policy", policyID)
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to update DLP policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignments"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM dlp_policy_assignments WHERE policy_id = $1", policyID); err != nil {
+		log.Errorf("Failed to clear DLP policy assignments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignments"})
+		return
+	}
+
+	for _, group := range groups {
+		if _, err := tx.Exec(
+			"INSERT INTO dlp_policy_assignments (policy_id, group_name, created_at) VALUES ($1, $2, NOW())",
+			policyID, group); err != nil {
+			log.Errorf("Failed to insert DLP policy assignment: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignments"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	log.Infof("Assigned DLP policy %s to groups %v", policyID, groups)
+
+	setVersionETag(c, version)
+	c.JSON(http.StatusOK, gin.H{
+		"policy_id":    policyID,
+		"groups":       groups,
+		"license_wide": len(groups) == 0,
+		"version":      version,
+		"message":      "Assignments updated successfully",
+	})
+}
@@ -0,0 +1,125 @@
+// DLP Policy Config Schemas
+// Typed config per rule type, validated when a policy is authored so malformed policies are rejected with field-level errors
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// defaultRegexConfidence is the confidence of a regex pattern that does not set one
+const defaultRegexConfidence = 0.8
+
+// dlpConfigTypes maps each validated rule type to its config struct
+var dlpConfigTypes = map[string]reflect.Type{
+	models.DLPRuleRegex:       reflect.TypeOf(models.DLPRegexConfig{}),
+	models.DLPRuleKeyword:     reflect.TypeOf(models.DLPKeywordConfig{}),
+	models.DLPRuleFingerprint: reflect.TypeOf(models.DLPFingerprintConfig{}),
+	models.DLPRuleEDM:         reflect.TypeOf(models.DLPEDMConfig{}),
+	models.DLPRuleDetector:    reflect.TypeOf(models.DLPDetectorConfig{}),
+}
+
+// validateDLPConfig checks config against the schema of ruleType. It returns the config as
+// normalized by the typed struct, or every invalid field keyed by its path under "config".
+// Rule types without a schema (ml) pass unchanged.
+func validateDLPConfig(ruleType string, config map[string]interface{}) (map[string]interface{}, map[string]string) {
+	configType, ok := dlpConfigTypes[ruleType]
+	if !ok {
+		return config, nil
+	}
+
+	// Unknown keys are usually a misspelt setting or one belonging to another rule type
+	fields := map[string]string{}
+	known := map[string]bool{}
+	for i := 0; i < configType.NumField(); i++ {
+		known[strings.SplitN(configType.Field(i).Tag.Get("json"), ",", 2)[0]] = true
+	}
+	for key := range config {
+		if !known[key] {
+			fields["config."+key] = fmt.Sprintf("is not a setting of %s policies", ruleType)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+
+	typed := reflect.New(configType).Interface()
+	if err := decodeDLPConfig(config, typed); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return nil, map[string]string{"config." + typeErr.Field: "must be " + jsonTypeName(typeErr.Type)}
+		}
+		return nil, map[string]string{"config": err.Error()}
+	}
+	if err := binding.Validator.ValidateStruct(typed); err != nil {
+		var validationErrs validator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return nil, map[string]string{"config": err.Error()}
+		}
+		for _, fe := range validationErrs {
+			fields["config."+validationFieldPath(fe)] = validationMessage(fe)
+		}
+		return nil, fields
+	}
+
+	// Checks the struct tags cannot express
+	switch cfg := typed.(type) {
+	case *models.DLPRegexConfig:
+		for i, p := range cfg.Patterns {
+			if _, err := compileDLPPattern(p); err != nil {
+				fields[fmt.Sprintf("config.patterns[%d].pattern", i)] = "must be a valid regular expression: " + err.Error()
+			}
+		}
+	case *models.DLPDetectorConfig:
+		for i, name := range cfg.Detectors {
+			if _, ok := dlpDetectors[name]; !ok {
+				fields[fmt.Sprintf("config.detectors[%d]", i)] = "must be a built-in detector name"
+			}
+		}
+	case *models.DLPFingerprintConfig:
+		if cfg.SimilarityThreshold > 0 && (cfg.Algorithm == "" || cfg.Algorithm == "sha256") {
+			fields["config.similarity_threshold"] = "requires a fuzzy algorithm (simhash or ssdeep)"
+		}
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+
+	normalized := map[string]interface{}{}
+	raw, _ := json.Marshal(typed)
+	json.Unmarshal(raw, &normalized)
+	return normalized, nil
+}
+
+// dlpConfigErrorResponse builds the 400 body for an invalid policy config
+func dlpConfigErrorResponse(fields map[string]string) gin.H {
+	return gin.H{"error": "Validation failed", "fields": fields}
+}
+
+// decodeDLPConfig decodes a stored or submitted config map into a config struct
+func decodeDLPConfig(config map[string]interface{}, dst interface{}) error {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// compileDLPPattern compiles a regex policy pattern, case-insensitive unless it opts out
+func compileDLPPattern(p models.DLPRegexPattern) (*regexp.Regexp, error) {
+	if p.CaseSensitive {
+		return regexp.Compile(p.Pattern)
+	}
+	return regexp.Compile("(?i)" + p.Pattern)
+}
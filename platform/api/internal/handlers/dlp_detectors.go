@@ -0,0 +1,306 @@
+// Built-in DLP Detectors
+// Named PII/PCI/secret detectors (validated regex plus checksums) and keyword dictionaries that policies enable by name
+
+package handlers
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// dlpDetector finds one kind of sensitive data. Candidates matched by pattern are
+// confirmed by validate (checksums, reserved ranges) when it is set.
+type dlpDetector struct {
+	name        string
+	description string
+	category    string // pii, pci, financial, credentials, classification
+	pattern     *regexp.Regexp
+	validate    func(match string) bool
+	confidence  float64
+}
+
+// dlpDetectors is the built-in detector library, keyed by the name policies use in config.detectors
+var dlpDetectors = map[string]dlpDetector{}
+
+func init() {
+	for _, d := range []dlpDetector{
+		{
+			name:        "us_ssn",
+			description: "US Social Security Number (excludes reserved area, group and serial numbers)",
+			category:    "pii",
+			pattern:     regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b`),
+			validate:    validSSN,
+			confidence:  0.9,
+		},
+		{
+			name:        "credit_card",
+			description: "Payment card number (Visa, Mastercard, Amex, Discover, JCB, Diners) with Luhn check",
+			category:    "pci",
+			pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			validate:    validCardNumber,
+			confidence:  0.95,
+		},
+		{
+			name:        "iban",
+			description: "International Bank Account Number with mod-97 check",
+			category:    "financial",
+			pattern:     regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+			validate:    validIBAN,
+			confidence:  0.95,
+		},
+		{
+			name:        "email_address",
+			description: "Email address",
+			category:    "pii",
+			pattern:     regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+			confidence:  0.8,
+		},
+		{
+			name:        "phone_number",
+			description: "Phone number in North American or international format",
+			category:    "pii",
+			pattern:     regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]\d{3}[ .-]\d{4}\b`),
+			validate:    validPhone,
+			confidence:  0.6,
+		},
+		{
+			name:        "aws_access_key_id",
+			description: "AWS access key ID",
+			category:    "credentials",
+			pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+			confidence:  0.95,
+		},
+		{
+			name:        "aws_secret_access_key",
+			description: "AWS secret access key assigned to a recognisable variable name",
+			category:    "credentials",
+			pattern:     regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`),
+			confidence:  0.9,
+		},
+		{
+			name:        "github_token",
+			description: "GitHub personal access, OAuth, app or refresh token",
+			category:    "credentials",
+			pattern:     regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`),
+			confidence:  0.95,
+		},
+		{
+			name:        "private_key",
+			description: "PEM-encoded private key header",
+			category:    "credentials",
+			pattern:     regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----`),
+			confidence:  0.99,
+		},
+		dictionaryDetector(
+			"confidential_marking",
+			"Document classification markings (confidential, internal use only, ...)",
+			[]string{"confidential", "strictly confidential", "internal use only", "proprietary and confidential",
+				"do not distribute", "attorney-client privileged", "trade secret"},
+		),
+		dictionaryDetector(
+			"medical_terms",
+			"Protected health information vocabulary (diagnosis, prescription, ...)",
+			[]string{"diagnosis", "prescription", "medical record number", "patient id", "icd-10",
+				"health insurance claim", "treatment plan"},
+		),
+	} {
+		dlpDetectors[d.name] = d
+	}
+}
+
+// dictionaryDetector builds a case-insensitive whole-word keyword detector
+func dictionaryDetector(name, description string, keywords []string) dlpDetector {
+	return dlpDetector{
+		name:        name,
+		description: description,
+		category:    "classification",
+		pattern:     keywordPattern(keywords),
+		confidence:  0.7,
+	}
+}
+
+// keywordPattern compiles keywords into one case-insensitive whole-word regex
+func keywordPattern(keywords []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			quoted = append(quoted, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// dlpDetection is a validated detector hit in scanned data
+type dlpDetection struct {
+	detector   string
+	offset     int
+	length     int
+	confidence float64
+}
+
+// scan returns every validated match of the detector in data
+func (d dlpDetector) scan(data string) []dlpDetection {
+	if d.pattern == nil {
+		return nil
+	}
+
+	detections := []dlpDetection{}
+	for _, loc := range d.pattern.FindAllStringIndex(data, -1) {
+		if d.validate != nil && !d.validate(data[loc[0]:loc[1]]) {
+			continue
+		}
+		detections = append(detections, dlpDetection{
+			detector:   d.name,
+			offset:     loc[0],
+			length:     loc[1] - loc[0],
+			confidence: d.confidence,
+		})
+	}
+	return detections
+}
+
+// configStrings reads a string list from a policy config
+func configStrings(config map[string]interface{}, key string) []string {
+	raw, ok := config[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if s, ok := v.(string); ok && s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// digitsOnly strips separators from a candidate number
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validSSN excludes area 000, 666 and 900-999, group 00 and serial 0000
+func validSSN(match string) bool {
+	digits := digitsOnly(match)
+	if len(digits) != 9 {
+		return false
+	}
+	area, group, serial := digits[:3], digits[3:5], digits[5:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validCardNumber checks length, issuer prefix and the Luhn checksum
+func validCardNumber(match string) bool {
+	digits := digitsOnly(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	issuer := false
+	for _, prefix := range []string{"4", "51", "52", "53", "54", "55", "22", "23", "24", "25", "26", "27",
+		"34", "37", "6011", "65", "35", "300", "301", "302", "303", "304", "305", "36", "38"} {
+		if strings.HasPrefix(digits, prefix) {
+			issuer = true
+			break
+		}
+	}
+	if !issuer {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks length and the ISO 13616 mod-97 checksum
+func validIBAN(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// Move the country code and check digits to the end, then map letters to 10-35
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			numeric.WriteString(fmt.Sprintf("%d", r-'A'+10))
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validPhone requires 10 to 15 digits, the E.164 range
+func validPhone(match string) bool {
+	n := len(digitsOnly(match))
+	return n >= 10 && n <= 15
+}
+
+// ListDLPDetectors lists the built-in detectors policies can enable by name
+func (h *DLPHandler) ListDLPDetectors(c *gin.Context) {
+	category := c.Query("category")
+
+	detectors := make([]models.DLPDetector, 0, len(dlpDetectors))
+	for _, d := range dlpDetectors {
+		if category != "" && d.category != category {
+			continue
+		}
+		detectors = append(detectors, models.DLPDetector{
+			Name:        d.name,
+			Description: d.description,
+			Category:    d.category,
+			Validated:   d.validate != nil,
+			Confidence:  d.confidence,
+		})
+	}
+	sort.Slice(detectors, func(i, j int) bool {
+		if detectors[i].Category != detectors[j].Category {
+			return detectors[i].Category < detectors[j].Category
+		}
+		return detectors[i].Name < detectors[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"detectors": detectors,
+		"count":     len(detectors),
+	})
+}
@@ -0,0 +1,452 @@
+// DLP Exact Data Match Handlers
+// Uploads of known sensitive records, stored as salted cell hashes, and matching content against them
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	maxEDMRows       = 100000
+	maxEDMColumns    = 32
+	maxEDMCandidates = 50000 // Distinct tokens and n-grams hashed per scan
+	maxEDMNgram      = 3     // Multi-word cells ("Jane Doe") are matched as n-grams of up to this many tokens
+)
+
+// normalizeEDMValue canonicalises a cell or token so formatting differences do not defeat matching.
+// Values made only of digits and separators (SSNs, phone and card numbers) reduce to their digits.
+func normalizeEDMValue(value string) string {
+	value = strings.ToLower(strings.Join(strings.Fields(value), " "))
+
+	numeric := value != ""
+	hasDigit := false
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			hasDigit = true
+		} else if !strings.ContainsRune(" -.()/+", r) {
+			numeric = false
+			break
+		}
+	}
+	if numeric && hasDigit {
+		return digitsOnly(value)
+	}
+	return value
+}
+
+// edmHash is the hex HMAC-SHA256 of a normalized value under the dataset salt
+func edmHash(salt []byte, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// edmCandidate is a token or n-gram of scanned content
+type edmCandidate struct {
+	offset int
+	length int
+}
+
+// edmCandidates splits content into tokens and n-grams keyed by normalized value
+func edmCandidates(data string) map[string]edmCandidate {
+	type token struct {
+		start, end int
+	}
+
+	tokens := []token{}
+	start := -1
+	for i, r := range data {
+		separator := unicode.IsSpace(r) || strings.ContainsRune(",;|\"'<>[]{}", r)
+		if separator && start >= 0 {
+			tokens = append(tokens, token{start, i})
+			start = -1
+		} else if !separator && start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{start, len(data)})
+	}
+
+	candidates := map[string]edmCandidate{}
+	for i := range tokens {
+		for n := 1; n <= maxEDMNgram && i+n <= len(tokens); n++ {
+			if len(candidates) >= maxEDMCandidates {
+				return candidates
+			}
+			first, last := tokens[i], tokens[i+n-1]
+			raw := strings.TrimRight(data[first.start:last.end], ".:!?)")
+			value := normalizeEDMValue(raw)
+			if value == "" {
+				continue
+			}
+			if _, seen := candidates[value]; !seen {
+				candidates[value] = edmCandidate{offset: first.start, length: len(raw)}
+			}
+		}
+	}
+	return candidates
+}
+
+// edmMatch is a dataset row whose cells co-occur in scanned content
+type edmMatch struct {
+	datasetID      string
+	datasetName    string
+	rowIndex       int
+	matchedColumns int
+	totalColumns   int
+	offset         int
+	length         int
+}
+
+// scanEDMDatasets matches content against the given datasets of a license
+func scanEDMDatasets(db *sql.DB, licenseID string, datasetIDs []string, data string) ([]edmMatch, error) {
+	if len(datasetIDs) == 0 {
+		return nil, nil
+	}
+
+	candidates := edmCandidates(data)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT id, name, salt, array_length(columns, 1), min_matches
+		FROM dlp_edm_datasets
+		WHERE license_id = $1 AND id::text = ANY($2)
+	`, licenseID, pq.Array(datasetIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	type dataset struct {
+		id, name, salt      string
+		columns, minMatches int
+	}
+	datasets := []dataset{}
+	for rows.Next() {
+		var d dataset
+		if err := rows.Scan(&d.id, &d.name, &d.salt, &d.columns, &d.minMatches); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		datasets = append(datasets, d)
+	}
+	rows.Close()
+
+	matches := []edmMatch{}
+	for _, d := range datasets {
+		salt, err := hex.DecodeString(d.salt)
+		if err != nil {
+			return nil, fmt.Errorf("dataset %s has an invalid salt", d.id)
+		}
+
+		byHash := make(map[string]edmCandidate, len(candidates))
+		hashes := make([]string, 0, len(candidates))
+		for value, candidate := range candidates {
+			hash := edmHash(salt, value)
+			byHash[hash] = candidate
+			hashes = append(hashes, hash)
+		}
+
+		hits, err := db.Query(`
+			SELECT row_index, COUNT(DISTINCT column_index), array_agg(cell_hash)
+			FROM dlp_edm_hashes
+			WHERE dataset_id = $1 AND cell_hash = ANY($2)
+			GROUP BY row_index
+			HAVING COUNT(DISTINCT column_index) >= $3
+			ORDER BY row_index
+		`, d.id, pq.Array(hashes), d.minMatches)
+		if err != nil {
+			return nil, err
+		}
+
+		for hits.Next() {
+			match := edmMatch{datasetID: d.id, datasetName: d.name, totalColumns: d.columns}
+			var matched []string
+			if err := hits.Scan(&match.rowIndex, &match.matchedColumns, pq.Array(&matched)); err != nil {
+				hits.Close()
+				return nil, err
+			}
+
+			// Report the span covering every matched cell
+			end := 0
+			match.offset = len(data)
+			for _, hash := range matched {
+				candidate := byHash[strings.TrimSpace(hash)]
+				if candidate.offset < match.offset {
+					match.offset = candidate.offset
+				}
+				if candidate.offset+candidate.length > end {
+					end = candidate.offset + candidate.length
+				}
+			}
+			match.length = end - match.offset
+			matches = append(matches, match)
+		}
+		hits.Close()
+	}
+
+	return matches, nil
+}
+
+// CreateEDMDataset uploads a CSV of sensitive records (multipart field "file", header row required).
+// Form fields: license_id, name, description, min_matches, created_by.
+func (h *DLPHandler) CreateEDMDataset(c *gin.Context) {
+	licenseID := c.PostForm("license_id")
+	name := strings.TrimSpace(c.PostForm("name"))
+	if licenseID == "" || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id and name required"})
+		return
+	}
+
+	minMatches := 2
+	if v := c.PostForm("min_matches"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_matches must be a positive integer"})
+			return
+		}
+		minMatches = parsed
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "CSV file required in form field 'file'"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	var licenseExists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM licenses WHERE id = $1 AND is_active = TRUE)", licenseID).Scan(&licenseExists)
+	if err != nil || !licenseExists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid license_id"})
+		return
+	}
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	columns, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to read CSV header: %v", err)})
+		return
+	}
+	if len(columns) > maxEDMColumns {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("CSV has more than %d columns", maxEDMColumns)})
+		return
+	}
+	if minMatches > len(columns) {
+		minMatches = len(columns)
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		log.Errorf("Failed to generate EDM salt: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	dataset := models.EDMDataset{
+		LicenseID:   licenseID,
+		Name:        name,
+		Description: c.PostForm("description"),
+		Columns:     columns,
+		MinMatches:  minMatches,
+		CreatedBy:   c.PostForm("created_by"),
+	}
+	err = tx.QueryRow(`
+		INSERT INTO dlp_edm_datasets (license_id, name, description, columns, salt, min_matches, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, licenseID, name, dataset.Description, pq.Array(columns), hex.EncodeToString(salt), minMatches, dataset.CreatedBy).
+		Scan(&dataset.ID, &dataset.CreatedAt, &dataset.UpdatedAt)
+	if err != nil {
+		log.Errorf("Failed to create EDM dataset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+		return
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("dlp_edm_hashes", "dataset_id", "row_index", "column_index", "cell_hash"))
+	if err != nil {
+		log.Errorf("Failed to prepare EDM hash copy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+		return
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stmt.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid CSV at row %d: %v", dataset.RowCount+2, err)})
+			return
+		}
+		if dataset.RowCount >= maxEDMRows {
+			stmt.Close()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("dataset exceeds %d rows", maxEDMRows)})
+			return
+		}
+
+		for column, cell := range record {
+			value := normalizeEDMValue(cell)
+			if value == "" {
+				continue
+			}
+			if _, err := stmt.Exec(dataset.ID, dataset.RowCount, column, edmHash(salt, value)); err != nil {
+				stmt.Close()
+				log.Errorf("Failed to store EDM hash: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+				return
+			}
+		}
+		dataset.RowCount++
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		log.Errorf("Failed to flush EDM hashes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+		return
+	}
+	stmt.Close()
+
+	if _, err := tx.Exec("UPDATE dlp_edm_datasets SET row_count = $1 WHERE id = $2", dataset.RowCount, dataset.ID); err != nil {
+		log.Errorf("Failed to update EDM row count: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dataset"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+		return
+	}
+
+	log.Infof("Created EDM dataset %s (%s) with %d rows", dataset.Name, dataset.ID, dataset.RowCount)
+
+	c.JSON(http.StatusCreated, dataset)
+}
+
+// ListEDMDatasets lists a license's exact data match datasets
+func (h *DLPHandler) ListEDMDatasets(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, license_id, name, COALESCE(description, ''), columns, row_count, min_matches,
+		       COALESCE(created_by, ''), created_at, updated_at
+		FROM dlp_edm_datasets
+		WHERE license_id = $1
+		ORDER BY created_at DESC
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to query EDM datasets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+	defer rows.Close()
+
+	datasets := make([]models.EDMDataset, 0)
+	for rows.Next() {
+		var d models.EDMDataset
+		if err := rows.Scan(&d.ID, &d.LicenseID, &d.Name, &d.Description, pq.Array(&d.Columns),
+			&d.RowCount, &d.MinMatches, &d.CreatedBy, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			log.Warnf("Failed to scan EDM dataset: %v", err)
+			continue
+		}
+		datasets = append(datasets, d)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"datasets": datasets,
+		"total":    len(datasets),
+	})
+}
+
+// DeleteEDMDataset removes a dataset and its hashes
+func (h *DLPHandler) DeleteEDMDataset(c *gin.Context) {
+	datasetID := c.Param("id")
+
+	result, err := h.db.Exec(
+		"DELETE FROM dlp_edm_datasets WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		datasetID, principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete EDM dataset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dataset"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dataset not found"})
+		return
+	}
+
+	log.Infof("Deleted EDM dataset: %s", datasetID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Dataset deleted successfully",
+	})
+}
+
+// validateEDMDatasets checks that every dataset in config.edm_datasets belongs to the license
+func (h *DLPHandler) validateEDMDatasets(licenseID string, config map[string]interface{}) error {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, id := range configStrings(config, "edm_datasets") {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var found int
+	err := h.db.QueryRow(
+		"SELECT COUNT(*) FROM dlp_edm_datasets WHERE license_id = $1 AND id::text = ANY($2)",
+		licenseID, pq.Array(ids)).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(ids) {
+		return fmt.Errorf("unknown EDM dataset in edm_datasets")
+	}
+	return nil
+}
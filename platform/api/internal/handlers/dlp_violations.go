@@ -0,0 +1,249 @@
+// DLP Violation Handlers
+// Surfaces dlp_violation telemetry from ClickHouse joined with policy metadata from PostgreSQL
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	defaultViolationDays  = 7
+	maxViolationLimit     = 1000
+	violationTopN         = 10
+	violationPolicyIDExpr = "JSONExtractString(payload, 'rule_id')"
+	// DLP payloads carry file_path; the materialized file_path column reads the generic path key
+	violationFileExpr = "if(file_path != '', file_path, JSONExtractString(payload, 'file_path'))"
+)
+
+// eventSeverityNames maps the ClickHouse severity level to its name
+var eventSeverityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func eventSeverityName(level uint8) string {
+	if int(level) < len(eventSeverityNames) {
+		return eventSeverityNames[level]
+	}
+	return "critical"
+}
+
+// dlpPolicyMeta is the policy metadata attached to each violation
+type dlpPolicyMeta struct {
+	name     string
+	ruleType string
+}
+
+// ListDLPViolations returns dlp_violation events for a license with top users and policies.
+// Filters: policy_id, user, severity, start_time/end_time (RFC3339, default last 7 days).
+func (h *DLPHandler) ListDLPViolations(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	endTime := time.Now().UTC()
+	if v := c.Query("end_time"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time format, use RFC3339"})
+			return
+		}
+		endTime = parsed
+	}
+	startTime := endTime.AddDate(0, 0, -defaultViolationDays)
+	if v := c.Query("start_time"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time format, use RFC3339"})
+			return
+		}
+		startTime = parsed
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > maxViolationLimit {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	where := " WHERE tenant_id = ? AND event_type = 'dlp_violation' AND timestamp >= ? AND timestamp <= ?"
+	args := []interface{}{licenseID, startTime, endTime}
+
+	if policyID := c.Query("policy_id"); policyID != "" {
+		where += " AND " + violationPolicyIDExpr + " = ?"
+		args = append(args, policyID)
+	}
+	if user := c.Query("user"); user != "" {
+		where += " AND username = ?"
+		args = append(args, user)
+	}
+	if severity := strings.ToLower(c.Query("severity")); severity != "" {
+		level, ok := severityRank[severity]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, medium, high or critical"})
+			return
+		}
+		where += " AND severity = ?"
+		args = append(args, level)
+	}
+
+	policies, err := h.loadPolicyMeta(licenseID)
+	if err != nil {
+		log.Errorf("Failed to load DLP policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+
+	ctx := context.Background()
+	query := `
+		SELECT toString(event_id), timestamp, agent_id, hostname, username, ` + violationFileExpr + `,
+		       JSONExtractString(payload, 'matched_pattern'), severity, ` + violationPolicyIDExpr + `
+		FROM telemetry_events` + where + `
+		ORDER BY timestamp DESC
+		LIMIT ? OFFSET ?`
+
+	rows, err := h.clickhouse.Query(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		log.Errorf("Failed to query DLP violations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+	defer rows.Close()
+
+	violations := make([]models.DLPViolation, 0)
+	for rows.Next() {
+		var v models.DLPViolation
+		var severity uint8
+		if err := rows.Scan(&v.EventID, &v.Timestamp, &v.AgentID, &v.Hostname, &v.Username,
+			&v.FilePath, &v.MatchedPattern, &severity, &v.PolicyID); err != nil {
+			log.Warnf("Failed to scan DLP violation: %v", err)
+			continue
+		}
+		v.Severity = eventSeverityName(severity)
+		if meta, ok := policies[v.PolicyID]; ok {
+			v.PolicyName = meta.name
+			v.RuleType = meta.ruleType
+		}
+		violations = append(violations, v)
+	}
+
+	summary, err := h.summarizeViolations(ctx, where, args, policies)
+	if err != nil {
+		log.Errorf("Failed to aggregate DLP violations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.DLPViolationsResponse{
+		Violations: violations,
+		Summary:    summary,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Limit:      limit,
+		Offset:     offset,
+	})
+}
+
+// summarizeViolations computes severity totals and the top violating users and policies
+func (h *DLPHandler) summarizeViolations(ctx context.Context, where string, args []interface{}, policies map[string]dlpPolicyMeta) (models.DLPViolationSummary, error) {
+	summary := models.DLPViolationSummary{
+		BySeverity:  map[string]uint64{},
+		TopUsers:    []models.DLPViolationCount{},
+		TopPolicies: []models.DLPViolationCount{},
+	}
+
+	rows, err := h.clickhouse.Query(ctx, "SELECT severity, count() FROM telemetry_events"+where+" GROUP BY severity", args...)
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var severity uint8
+		var count uint64
+		if err := rows.Scan(&severity, &count); err != nil {
+			continue
+		}
+		summary.BySeverity[eventSeverityName(severity)] += count
+		summary.Total += count
+	}
+	rows.Close()
+
+	top := func(expr string) ([]models.DLPViolationCount, error) {
+		rows, err := h.clickhouse.Query(ctx,
+			"SELECT "+expr+" AS k, count() AS c FROM telemetry_events"+where+" AND k != '' GROUP BY k ORDER BY c DESC LIMIT ?",
+			append(args, violationTopN)...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		counts := []models.DLPViolationCount{}
+		for rows.Next() {
+			var entry models.DLPViolationCount
+			if err := rows.Scan(&entry.Key, &entry.Count); err != nil {
+				continue
+			}
+			counts = append(counts, entry)
+		}
+		return counts, nil
+	}
+
+	if summary.TopUsers, err = top("username"); err != nil {
+		return summary, err
+	}
+	if summary.TopPolicies, err = top(violationPolicyIDExpr); err != nil {
+		return summary, err
+	}
+	for i := range summary.TopPolicies {
+		summary.TopPolicies[i].Name = policies[summary.TopPolicies[i].Key].name
+	}
+
+	return summary, nil
+}
+
+// violationSummary aggregates a license's DLP violations over a time range
+func (h *DLPHandler) violationSummary(ctx context.Context, licenseID string, start, end time.Time) (models.DLPViolationSummary, error) {
+	policies, err := h.loadPolicyMeta(licenseID)
+	if err != nil {
+		return models.DLPViolationSummary{}, err
+	}
+
+	where := " WHERE tenant_id = ? AND event_type = 'dlp_violation' AND timestamp >= ? AND timestamp <= ?"
+	return h.summarizeViolations(ctx, where, []interface{}{licenseID, start, end}, policies)
+}
+
+// loadPolicyMeta returns the license's DLP policies keyed by ID
+func (h *DLPHandler) loadPolicyMeta(licenseID string) (map[string]dlpPolicyMeta, error) {
+	rows, err := h.db.Query("SELECT id, name, rule_type FROM dlp_policies WHERE license_id = $1", licenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := map[string]dlpPolicyMeta{}
+	for rows.Next() {
+		var id string
+		var meta dlpPolicyMeta
+		if err := rows.Scan(&id, &meta.name, &meta.ruleType); err != nil {
+			continue
+		}
+		policies[id] = meta
+	}
+	return policies, rows.Err()
+}
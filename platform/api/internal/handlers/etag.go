@@ -0,0 +1,67 @@
+// Optimistic Concurrency
+// Version-based ETags so concurrent edits to the same resource are rejected instead of lost
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// setVersionETag returns a resource's version as its ETag
+func setVersionETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion reads the version an update expects from the If-Match header. "*" skips the
+// check and yields 0. A missing or malformed header is answered here and ok is false.
+func ifMatchVersion(c *gin.Context) (version int, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the resource's ETag is required"})
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match must be an ETag returned by GET"})
+		return 0, false
+	}
+	return version, true
+}
+
+// versionMismatch answers a conditional update that matched no row: 404 when the resource is
+// gone or belongs to another license than the caller's, otherwise 409 with the current version
+// so the client can re-read and retry.
+func versionMismatch(c *gin.Context, db *sql.DB, table, entity, id string) {
+	var current int
+	err := db.QueryRow(
+		fmt.Sprintf("SELECT version FROM %s WHERE id = $1 AND deleted_at IS NULL AND ($2 = '' OR license_id::text = $2)", table),
+		id, principalLicense(c),
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s not found", entity)})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to read %s version: %v", table, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update %s", strings.ToLower(entity))})
+		return
+	}
+
+	setVersionETag(c, current)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":           fmt.Sprintf("%s was modified by another request", entity),
+		"current_version": current,
+	})
+}
@@ -0,0 +1,112 @@
+// Live Events Polling Handler
+// REST long-polling fallback for clients that cannot use WebSockets, served from the hub replay buffer
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// maxStreamWait stays below the server WriteTimeout so a held poll is never cut off
+	maxStreamWait     = 8 * time.Second
+	defaultStreamWait = 5 * time.Second
+	maxStreamEvents   = 500
+)
+
+// StreamEvents returns live messages newer than ?since= for a tenant. With ?wait= (seconds)
+// the request is held until a message arrives or the wait expires. Poll again with next_cursor.
+func StreamEvents(c *gin.Context) {
+	if globalHub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket hub not initialized"})
+		return
+	}
+
+	tenantID := c.Query("tenant_id")
+	if tenantID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant_id required"})
+		return
+	}
+
+	latest := atomic.LoadUint64(&globalHub.cursor)
+
+	// Without a cursor the client starts from now
+	since := latest
+	if v := c.Query("since"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since cursor"})
+			return
+		}
+		since = parsed
+	}
+
+	wait := defaultStreamWait
+	if v := c.Query("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wait"})
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait > maxStreamWait {
+		wait = maxStreamWait
+	}
+
+	limit := maxStreamEvents
+	if v := c.Query("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed < maxStreamEvents {
+			limit = parsed
+		}
+	}
+
+	client := &WSClient{tenantID: tenantID, hub: globalHub}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		// Take the wake-up channel before reading so a message added in between is not missed
+		changed := globalHub.replay.changed()
+		latest = atomic.LoadUint64(&globalHub.cursor)
+		buffered, gap := globalHub.replay.since(tenantID, since, latest)
+
+		events := make([]models.WSMessage, 0, len(buffered))
+		for _, msg := range buffered {
+			if globalHub.shouldSendToClient(client, msg) {
+				events = append(events, msg)
+			}
+		}
+
+		if len(events) > 0 || gap || wait == 0 {
+			nextCursor := latest
+			if len(events) > limit {
+				events = events[:limit]
+				nextCursor = events[limit-1].Cursor
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"events":      events,
+				"count":       len(events),
+				"next_cursor": nextCursor,
+				"gap":         gap,
+			})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			wait = 0
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeResult is what a fakeDB query or statement returns
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+// fakeDB is a database/sql driver that answers every statement with handle, so handler tests
+// can check the SQL and arguments a request produces without a Postgres server
+type fakeDB struct {
+	handle func(query string, args []driver.Value) (fakeResult, error)
+
+	mu       sync.Mutex
+	executed []string
+}
+
+// newFakeDB opens a *sql.DB backed by handle
+func newFakeDB(handle func(query string, args []driver.Value) (fakeResult, error)) (*sql.DB, *fakeDB) {
+	f := &fakeDB{handle: handle}
+	return sql.OpenDB(f), f
+}
+
+// ran reports whether a statement containing fragment was executed
+func (f *fakeDB) ran(fragment string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, query := range f.executed {
+		if strings.Contains(query, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeDB) run(query string, args []driver.Value) (fakeResult, error) {
+	f.mu.Lock()
+	f.executed = append(f.executed, query)
+	f.mu.Unlock()
+	return f.handle(query, args)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	result, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
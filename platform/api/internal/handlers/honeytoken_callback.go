@@ -0,0 +1,86 @@
+// Honey Token Callback Handler
+// Receives beacon hits from planted documents and web bugs and records them as deception events
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// transparentPixel is a 1x1 transparent PNG served to beacon requests
+var transparentPixel = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x48, 0x44, 0x52,
+	0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4,
+	0x89, 0x00, 0x00, 0x00, 0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49, 0x45, 0x4e, 0x44, 0xae,
+	0x42, 0x60, 0x82,
+}
+
+// HoneyTokenCallback records a beacon hit for a honey token and answers with a transparent pixel.
+// The response is identical whether or not the token exists, so probing reveals nothing.
+func (h *DeceptionHandler) HoneyTokenCallback(c *gin.Context) {
+	tokenID := c.Param("id")
+
+	defer func() {
+		c.Header("Cache-Control", "no-store, no-cache, must-revalidate")
+		c.Data(http.StatusOK, "image/png", transparentPixel)
+	}()
+
+	var licenseID string
+	var isActive bool
+	err := h.db.QueryRow("SELECT license_id, is_active FROM honey_tokens WHERE id = $1", tokenID).Scan(&licenseID, &isActive)
+	if err != nil || !isActive {
+		return
+	}
+
+	event := models.DeceptionEvent{
+		LicenseID:       licenseID,
+		EventType:       models.EventTypeHoneyTokenAccess,
+		HoneyTokenID:    tokenID,
+		SourceIP:        c.ClientIP(),
+		InteractionType: "beacon",
+		Details: models.DeceptionEventDetails{
+			Protocol:     c.Request.Proto,
+			UserAgent:    c.Request.UserAgent(),
+			AccessedFile: c.Param("asset"),
+			RequestHeaders: map[string]string{
+				"Referer":         c.GetHeader("Referer"),
+				"Accept-Language": c.GetHeader("Accept-Language"),
+				"X-Forwarded-For": c.GetHeader("X-Forwarded-For"),
+			},
+		},
+	}
+	h.applyHoneyTokenContext(&event, time.Now())
+	score := applyDeceptionScore(&event)
+	detailsJSON, _ := json.Marshal(event.Details)
+
+	err = h.db.QueryRow(`
+		INSERT INTO deception_events (
+			license_id, event_type, honey_token_id, source_ip, interaction_type, severity, details, alert_created
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, FALSE)
+		RETURNING id, detected_at
+	`, event.LicenseID, event.EventType, tokenID, event.SourceIP, event.InteractionType, event.Severity, detailsJSON,
+	).Scan(&event.ID, &event.DetectedAt)
+	if err != nil {
+		log.Errorf("Failed to record honey token beacon: %v", err)
+		return
+	}
+
+	h.db.Exec(`
+		UPDATE honey_tokens
+		SET access_count = access_count + 1,
+		    last_accessed = NOW()
+		WHERE id = $1
+	`, tokenID)
+
+	log.Warnf("Honey token %s triggered from %s", tokenID, c.ClientIP())
+
+	h.raiseDeceptionAlert(&event, score)
+}
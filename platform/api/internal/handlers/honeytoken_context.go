@@ -0,0 +1,152 @@
+// Honey Token Context
+// Grades honey token access by whether it came from the network and hours the token is expected in
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// Score a honey token event earns over its interaction: the full bonus when the token has no
+// expected context, otherwise a share per way the access departs from it
+const (
+	honeyTokenUncheckedBonus = 30
+	honeyTokenContextBonus   = 15
+)
+
+// honeyTokenContextMaxNetworks bounds the networks one expected context may list
+const honeyTokenContextMaxNetworks = 50
+
+var honeyTokenWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validateHoneyTokenContext checks networks, timezone and days of an expected context
+func validateHoneyTokenContext(ctx *models.HoneyTokenExpectedContext) error {
+	if ctx == nil {
+		return nil
+	}
+	if len(ctx.Networks) == 0 && ctx.BusinessHours == nil {
+		return fmt.Errorf("expected_context must set networks or business_hours")
+	}
+	if len(ctx.Networks) > honeyTokenContextMaxNetworks {
+		return fmt.Errorf("expected_context allows at most %d networks", honeyTokenContextMaxNetworks)
+	}
+	for _, cidr := range ctx.Networks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("expected_context network %q is not a CIDR", cidr)
+		}
+	}
+	if hours := ctx.BusinessHours; hours != nil {
+		if hours.StartHour >= hours.EndHour {
+			return fmt.Errorf("business_hours start_hour must be before end_hour")
+		}
+		if hours.Timezone != "" {
+			if _, err := time.LoadLocation(hours.Timezone); err != nil {
+				return fmt.Errorf("business_hours timezone %q is not a known timezone", hours.Timezone)
+			}
+		}
+		for _, day := range hours.Days {
+			if _, ok := honeyTokenWeekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("business_hours day %q must be one of mon, tue, wed, thu, fri, sat, sun", day)
+			}
+		}
+	}
+	return nil
+}
+
+// honeyTokenContextDeviations lists how an access from sourceIP at the given time departs from
+// the expected context
+func honeyTokenContextDeviations(ctx models.HoneyTokenExpectedContext, sourceIP string, at time.Time) []string {
+	deviations := []string{}
+
+	if len(ctx.Networks) > 0 {
+		ip := net.ParseIP(sourceIP)
+		inside := false
+		for _, cidr := range ctx.Networks {
+			if _, network, err := net.ParseCIDR(cidr); err == nil && ip != nil && network.Contains(ip) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			deviations = append(deviations, models.ContextDeviationNetwork)
+		}
+	}
+
+	if hours := ctx.BusinessHours; hours != nil {
+		loc := time.UTC
+		if hours.Timezone != "" {
+			if tz, err := time.LoadLocation(hours.Timezone); err == nil {
+				loc = tz
+			}
+		}
+		local := at.In(loc)
+
+		workday := local.Weekday() >= time.Monday && local.Weekday() <= time.Friday
+		if len(hours.Days) > 0 {
+			workday = false
+			for _, day := range hours.Days {
+				if honeyTokenWeekdays[strings.ToLower(day)] == local.Weekday() {
+					workday = true
+					break
+				}
+			}
+		}
+		if !workday || local.Hour() < hours.StartHour || local.Hour() >= hours.EndHour {
+			deviations = append(deviations, models.ContextDeviationOffHours)
+		}
+	}
+
+	return deviations
+}
+
+// applyHoneyTokenContext compares a honey token event against the token's expected context and
+// records the outcome in the event details, where scoring picks it up
+func (h *DeceptionHandler) applyHoneyTokenContext(event *models.DeceptionEvent, at time.Time) {
+	event.Details.ContextChecked = false
+	event.Details.ContextDeviations = nil
+	if event.HoneyTokenID == "" {
+		return
+	}
+
+	var contextJSON []byte
+	err := h.db.QueryRow("SELECT expected_context FROM honey_tokens WHERE id = $1", event.HoneyTokenID).Scan(&contextJSON)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Errorf("Failed to load honey token context: %v", err)
+		}
+		return
+	}
+	if len(contextJSON) == 0 {
+		return
+	}
+
+	var ctx models.HoneyTokenExpectedContext
+	if err := json.Unmarshal(contextJSON, &ctx); err != nil {
+		log.Errorf("Invalid expected context on honey token %s: %v", event.HoneyTokenID, err)
+		return
+	}
+	event.Details.ContextChecked = true
+	event.Details.ContextDeviations = honeyTokenContextDeviations(ctx, event.SourceIP, at)
+}
+
+// honeyTokenBonus is the score a honey token event earns over its interaction. A token with an
+// expected context earns it per deviation, so a touch from where it lives is graded lower than
+// one from an unexpected network at night.
+func honeyTokenBonus(details models.DeceptionEventDetails) int {
+	if !details.ContextChecked {
+		return honeyTokenUncheckedBonus
+	}
+	return honeyTokenContextBonus * len(details.ContextDeviations)
+}
@@ -0,0 +1,303 @@
+// Honey Token Documents
+// Builds decoy Word, Excel and PDF files whose remote resources call back to the token when opened
+
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// honeyDocumentFormat describes a downloadable decoy document format
+type honeyDocumentFormat struct {
+	extension   string
+	contentType string
+	build       func(title, beaconURL string) ([]byte, error)
+}
+
+var honeyDocumentFormats = map[string]honeyDocumentFormat{
+	"docx": {"docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", buildHoneyDOCX},
+	"xlsx": {"xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buildHoneyXLSX},
+	"pdf":  {"pdf", "application/pdf", buildHoneyPDF},
+}
+
+const defaultHoneyDocumentFormat = "docx"
+
+var beaconURLPattern = regexp.MustCompile(`https?://[^"\s<>]+`)
+
+// beaconURLFromToken extracts the beacon URL embedded in an office_document or web_bug token value
+func beaconURLFromToken(tokenValue string) string {
+	return beaconURLPattern.FindString(tokenValue)
+}
+
+// zipEntry is one part of an Office Open XML package
+type zipEntry struct {
+	name    string
+	content string
+}
+
+// writeZip packages the entries in order; [Content_Types].xml must come first for some readers
+func writeZip(entries []zipEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	modified := time.Now().UTC()
+
+	for _, entry := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// buildHoneyDOCX builds a Word document with an INCLUDEPICTURE field whose result is a linked
+// (not embedded) picture, so Word fetches the beacon every time the document is opened
+func buildHoneyDOCX(title, beaconURL string) ([]byte, error) {
+	title = html.EscapeString(title)
+	beacon := html.EscapeString(beaconURL)
+
+	document := xmlHeader + `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+		`xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office"><w:body>` +
+		`<w:p><w:r><w:rPr><w:b/><w:sz w:val="32"/></w:rPr><w:t>` + title + `</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>CONFIDENTIAL - For internal use only. Do not distribute.</w:t></w:r></w:p>` +
+		`<w:p>` +
+		`<w:r><w:fldChar w:fldCharType="begin"/></w:r>` +
+		`<w:r><w:instrText xml:space="preserve"> INCLUDEPICTURE "` + beacon + `" \d \* MERGEFORMAT </w:instrText></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="separate"/></w:r>` +
+		`<w:r><w:pict><v:shape id="beacon" style="width:1pt;height:1pt" stroked="f">` +
+		`<v:imagedata r:id="rIdBeacon" o:title=""/></v:shape></w:pict></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="end"/></w:r>` +
+		`</w:p>` +
+		`<w:sectPr/></w:body></w:document>`
+
+	return writeZip([]zipEntry{
+		{"[Content_Types].xml", xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+			`</Relationships>`},
+		{"word/document.xml", document},
+		{"word/_rels/document.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rIdBeacon" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="` + beacon + `" TargetMode="External"/>` +
+			`</Relationships>`},
+	})
+}
+
+// buildHoneyXLSX builds a workbook with decoy rows and a drawing that links an external picture,
+// which Excel requests when the sheet is rendered
+func buildHoneyXLSX(title, beaconURL string) ([]byte, error) {
+	beacon := html.EscapeString(beaconURL)
+
+	rows := [][]string{
+		{title},
+		{"Account", "Username", "Password", "Notes"},
+		{"VPN", "svc_vpn", randomFrom(charsetAlnum, 14), "Rotated quarterly"},
+		{"Domain Admin", "adm_" + randomFrom(charsetLowerNum, 6), randomFrom(charsetAlnum, 16), "Break glass only"},
+		{"Backup Server", "backup", randomFrom(charsetAlnum, 12), ""},
+	}
+
+	var sheetData strings.Builder
+	for r, row := range rows {
+		fmt.Fprintf(&sheetData, `<row r="%d">`, r+1)
+		for col, value := range row {
+			fmt.Fprintf(&sheetData, `<c r="%c%d" t="inlineStr"><is><t>%s</t></is></c>`, 'A'+col, r+1, html.EscapeString(value))
+		}
+		sheetData.WriteString(`</row>`)
+	}
+
+	return writeZip([]zipEntry{
+		{"[Content_Types].xml", xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Credentials" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheetData>` + sheetData.String() + `</sheetData><drawing r:id="rId1"/></worksheet>`},
+		{"xl/worksheets/_rels/sheet1.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"/>` +
+			`</Relationships>`},
+		{"xl/drawings/drawing1.xml", xmlHeader + `<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" ` +
+			`xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<xdr:oneCellAnchor><xdr:from><xdr:col>6</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>0</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>` +
+			`<xdr:ext cx="9525" cy="9525"/>` +
+			`<xdr:pic><xdr:nvPicPr><xdr:cNvPr id="2" name="Picture 1"/><xdr:cNvPicPr/></xdr:nvPicPr>` +
+			`<xdr:blipFill><a:blip r:link="rIdBeacon"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>` +
+			`<xdr:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="9525" cy="9525"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr>` +
+			`</xdr:pic><xdr:clientData/></xdr:oneCellAnchor></xdr:wsDr>`},
+		{"xl/drawings/_rels/drawing1.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rIdBeacon" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="` + beacon + `" TargetMode="External"/>` +
+			`</Relationships>`},
+	})
+}
+
+// pdfEscape encodes a string as the body of a PDF literal string shown in a WinAnsiEncoding font.
+// Text is transcoded to Windows-1252, whose bytes above ASCII are written as octal escapes;
+// characters it cannot represent become "?".
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\r':
+		case '\n':
+			b.WriteByte(' ')
+		default:
+			c, ok := charmap.Windows1252.EncodeRune(r)
+			if !ok || c < ' ' {
+				c = '?'
+			}
+			if c < 0x7f {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "\\%03o", c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// buildHoneyPDF builds a one-page PDF whose open action requests the beacon URL. Readers that
+// prompt before following URI actions still reveal the opener once the prompt is accepted. The
+// document is written by hand because PDF libraries do not emit URI open actions.
+func buildHoneyPDF(title, beaconURL string) ([]byte, error) {
+	content := fmt.Sprintf("BT /F1 18 Tf 72 720 Td (%s) Tj ET\nBT /F1 11 Tf 72 690 Td (CONFIDENTIAL - For internal use only. Do not distribute.) Tj ET\n",
+		pdfEscape(title))
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /OpenAction 5 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 6 0 R " +
+			"/Annots [<< /Type /Annot /Subtype /Link /Rect [0 0 612 792] /Border [0 0 0] /A 5 0 R >>] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /S /URI /URI (%s) >>", pdfEscape(beaconURL)),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes(), nil
+}
+
+// honeyDocumentFilename turns the token name into a plausible file name
+func honeyDocumentFilename(name, extension string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ' || r == '.':
+			return '_'
+		}
+		return -1
+	}, name)
+	if cleaned == "" {
+		cleaned = "document"
+	}
+	return cleaned + "." + extension
+}
+
+// sendHoneyDocument renders the decoy document and writes it as an attachment
+func sendHoneyDocument(c *gin.Context, status int, tokenID, name, format, beaconURL string) {
+	docFormat := honeyDocumentFormats[format]
+	data, err := docFormat.build(name, beaconURL)
+	if err != nil {
+		log.Errorf("Failed to build honey document: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build document"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", honeyDocumentFilename(name, docFormat.extension)))
+	c.Header("X-Honey-Token-ID", tokenID)
+	c.Data(status, docFormat.contentType, data)
+}
+
+// DownloadHoneyTokenDocument regenerates the decoy document for an office_document or web_bug token.
+// ?format= selects docx, xlsx or pdf; it defaults to the format chosen at creation.
+func (h *DeceptionHandler) DownloadHoneyTokenDocument(c *gin.Context) {
+	tokenID := c.Param("id")
+
+	var name, tokenType, tokenValue string
+	var storedFormat sql.NullString
+	err := h.db.QueryRow(`
+		SELECT name, token_type, token_value, metadata->>'document_format'
+		FROM honey_tokens
+		WHERE id = $1 AND ($2 = '' OR license_id::text = $2)
+	`, tokenID, principalLicense(c)).Scan(&name, &tokenType, &tokenValue, &storedFormat)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Honey token not found"})
+		return
+	}
+
+	beaconURL := beaconURLFromToken(tokenValue)
+	if beaconURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s tokens have no document", tokenType)})
+		return
+	}
+
+	format := defaultHoneyDocumentFormat
+	if storedFormat.String != "" {
+		format = storedFormat.String
+	}
+	if f := c.Query("format"); f != "" {
+		format = f
+	}
+	if _, ok := honeyDocumentFormats[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be docx, xlsx or pdf"})
+		return
+	}
+
+	sendHoneyDocument(c, http.StatusOK, tokenID, name, format, beaconURL)
+}
@@ -0,0 +1,220 @@
+// Honey Token Value Generators
+// Type-appropriate, realistic credential formats so canaries are indistinguishable from real secrets
+
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	charsetUpper    = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	charsetLower    = "abcdefghijklmnopqrstuvwxyz"
+	charsetDigits   = "0123456789"
+	charsetHex      = "0123456789abcdef"
+	charsetBase32   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	charsetAlnum    = charsetUpper + charsetLower + charsetDigits
+	charsetBase64   = charsetAlnum + "+/"
+	charsetLowerNum = charsetLower + charsetDigits
+
+	maxTemplateLength      = 1024
+	maxTemplatePlaceholder = 256
+)
+
+// templatePlaceholder matches {kind} or {kind:length} in a custom token template
+var templatePlaceholder = regexp.MustCompile(`\{([a-z0-9]+)(?::(\d+))?\}`)
+
+// randomFrom returns n characters drawn uniformly from charset using crypto/rand
+func randomFrom(charset string, n int) string {
+	max := big.NewInt(int64(len(charset)))
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(fmt.Sprintf("crypto/rand unavailable: %v", err))
+		}
+		b[i] = charset[idx.Int64()]
+	}
+	return string(b)
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// generateHoneyTokenValue builds the planted value for a token. A template, when given,
+// overrides the built-in format for the type; the custom type requires one.
+func generateHoneyTokenValue(tokenType models.HoneyTokenType, template, callbackURL string) (string, error) {
+	if template != "" {
+		return renderTokenTemplate(template)
+	}
+
+	switch tokenType {
+	case models.TokenTypeAWSKey:
+		return generateAWSCredentials(), nil
+	case models.TokenTypeAzureStorage:
+		return generateAzureConnectionString(), nil
+	case models.TokenTypeSlackToken:
+		return generateSlackToken(), nil
+	case models.TokenTypeGitHubToken:
+		return generateGitHubToken(), nil
+	case models.TokenTypeAPIKey:
+		return generateJWTKey(), nil
+	case models.TokenTypeDatabaseCreds:
+		return generateDatabaseURL(), nil
+	case models.TokenTypeOfficeDocument, models.TokenTypeWebBug:
+		return generateBeaconSnippet(tokenType, callbackURL), nil
+	case models.TokenTypeDNSQuery:
+		return fmt.Sprintf("%s.canarytoken.com", randomFrom(charsetLowerNum, 16)), nil
+	case models.TokenTypeCustom:
+		return "", fmt.Errorf("template is required for custom honey tokens")
+	default:
+		return randomFrom(charsetHex, 24), nil
+	}
+}
+
+// generateAWSCredentials returns an AWS shared-credentials profile with a key pair in AWS's formats:
+// a 20 character AKIA access key ID (base32 alphabet) and a 40 character secret
+func generateAWSCredentials() string {
+	return fmt.Sprintf("[default]\naws_access_key_id = AKIA%s\naws_secret_access_key = %s\nregion = us-east-1\n",
+		randomFrom(charsetBase32, 16), randomFrom(charsetBase64, 40))
+}
+
+// generateAzureConnectionString returns an Azure Storage connection string with a 64 byte account key
+func generateAzureConnectionString() string {
+	prefixes := []string{"st", "stprod", "stbackup", "stcorp", "stdata"}
+	account := prefixes[randomIndex(len(prefixes))] + randomFrom(charsetLowerNum, 8)
+	return fmt.Sprintf("DefaultEndpointsProtocol=https;AccountName=%s;AccountKey=%s;EndpointSuffix=core.windows.net",
+		account, base64.StdEncoding.EncodeToString(randomBytes(64)))
+}
+
+// generateSlackToken returns a bot token shaped like xoxb-<team>-<bot>-<secret>
+func generateSlackToken() string {
+	return fmt.Sprintf("xoxb-%s-%s-%s", randomFrom(charsetDigits, 12), randomFrom(charsetDigits, 13), randomFrom(charsetAlnum, 24))
+}
+
+// generateGitHubToken returns a ghp_ personal access token whose last 6 characters are the
+// base62 CRC32 checksum of the random part, as GitHub's own tokens are
+func generateGitHubToken() string {
+	entropy := randomFrom(charsetAlnum, 30)
+	checksum := base62(uint64(crc32.ChecksumIEEE([]byte(entropy))))
+	return "ghp_" + entropy + strings.Repeat("0", 6-len(checksum)) + checksum
+}
+
+// base62 encodes n with digits, then upper, then lower case letters
+func base62(n uint64) string {
+	const alphabet = charsetDigits + charsetUpper + charsetLower
+	if n == 0 {
+		return "0"
+	}
+	var out []byte
+	for n > 0 {
+		out = append([]byte{alphabet[n%62]}, out...)
+		n /= 62
+	}
+	return string(out)
+}
+
+// generateJWTKey returns a JWT-shaped API key (HS256 header, plausible claims, random signature)
+func generateJWTKey() string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"sub":   "svc_" + randomFrom(charsetLowerNum, 10),
+		"scope": "api:read api:write",
+		"iat":   time.Now().Add(-time.Duration(randomIndex(90*24)) * time.Hour).Unix(),
+		"jti":   uuid.New().String(),
+	})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(claims) + "." + enc.EncodeToString(randomBytes(32))
+}
+
+// generateDatabaseURL returns a PostgreSQL connection URL for a plausible service account
+func generateDatabaseURL() string {
+	services := []string{"billing", "reporting", "payroll", "crm", "analytics"}
+	service := services[randomIndex(len(services))]
+	return fmt.Sprintf("postgresql://svc_%s:%s@%s-db-%s.internal:5432/%s_prod",
+		service, randomFrom(charsetAlnum, 20), service, randomFrom(charsetLowerNum, 4), service)
+}
+
+// generateBeaconSnippet returns markup that fetches the callback URL when opened.
+// Office documents use an INCLUDEPICTURE field, which Word resolves on open; web bugs use a 1x1 image.
+func generateBeaconSnippet(tokenType models.HoneyTokenType, callbackURL string) string {
+	beacon := strings.TrimRight(callbackURL, "/") + "/" + randomFrom(charsetLowerNum, 12) + ".png"
+	if tokenType == models.TokenTypeOfficeDocument {
+		return fmt.Sprintf(`INCLUDEPICTURE "%s" \d \* MERGEFORMAT`, beacon)
+	}
+	return fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display:none">`, beacon)
+}
+
+// randomIndex returns a uniform random int in [0, n)
+func randomIndex(n int) int {
+	idx, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(idx.Int64())
+}
+
+// renderTokenTemplate expands placeholders in a custom token format. Supported placeholders:
+// {hex:N}, {alnum:N}, {upper:N}, {lower:N}, {digits:N}, {base32:N}, {base64:N} and {uuid}.
+// Everything else is copied literally, e.g. "sk_live_{alnum:24}".
+func renderTokenTemplate(template string) (string, error) {
+	if len(template) > maxTemplateLength {
+		return "", fmt.Errorf("template exceeds %d characters", maxTemplateLength)
+	}
+
+	charsets := map[string]string{
+		"hex":    charsetHex,
+		"alnum":  charsetAlnum,
+		"upper":  charsetUpper,
+		"lower":  charsetLower,
+		"digits": charsetDigits,
+		"base32": charsetBase32,
+		"base64": charsetBase64,
+	}
+
+	var renderErr error
+	value := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		parts := templatePlaceholder.FindStringSubmatch(placeholder)
+		kind, lengthStr := parts[1], parts[2]
+
+		if kind == "uuid" {
+			return uuid.New().String()
+		}
+
+		charset, ok := charsets[kind]
+		if !ok {
+			renderErr = fmt.Errorf("unknown template placeholder: {%s}", kind)
+			return placeholder
+		}
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil || length < 1 || length > maxTemplatePlaceholder {
+			renderErr = fmt.Errorf("placeholder {%s} needs a length between 1 and %d", kind, maxTemplatePlaceholder)
+			return placeholder
+		}
+		return randomFrom(charset, length)
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	if value == template {
+		return "", fmt.Errorf("template has no placeholders, so every token would be identical")
+	}
+	return value, nil
+}
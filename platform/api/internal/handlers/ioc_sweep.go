@@ -0,0 +1,335 @@
+// IOC Sweep
+// Checks a tenant's telemetry for many published indicators at once
+
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// iocSweepColumns maps IOC types to the telemetry expressions they are matched against. The
+// expressions are the ones the idx_ioc_* bloom filter indexes in schema.sql are built on, so IN
+// lists over them skip granules that cannot contain an indicator.
+var iocSweepColumns = map[string][]string{
+	models.IOCTypeIP:     {"dst_ip", "JSONExtractString(payload, 'src_ip')"},
+	models.IOCTypeDomain: {"lower(dst_hostname)", "lower(JSONExtractString(payload, 'domain'))"},
+	models.IOCTypeHash:   {"lower(JSONExtractString(payload, 'hash'))"},
+}
+
+// iocSweepTypes fixes the order IOC types are queried and reported in
+var iocSweepTypes = []string{models.IOCTypeIP, models.IOCTypeDomain, models.IOCTypeHash}
+
+// SweepIOCs reports which of a list of indicators appear in a tenant's telemetry in a time
+// range, with per-indicator counts and the most recent matching events
+func (h *TelemetryHandler) SweepIOCs(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.IOCSweepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time format, use RFC3339"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time format, use RFC3339"})
+		return
+	}
+	if !endTime.After(startTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+		return
+	}
+
+	// Normalize and de-duplicate, keeping the caller's order for the unmatched list
+	byType := map[string]map[string]bool{}
+	indicators := make([]models.IOCSweepIndicator, 0, len(req.IOCs))
+	fields := map[string]string{}
+	for i, ioc := range req.IOCs {
+		normalized, err := normalizeIOC(ioc)
+		if err != nil {
+			fields[fmt.Sprintf("iocs[%d].value", i)] = err.Error()
+			continue
+		}
+		if byType[normalized.Type] == nil {
+			byType[normalized.Type] = map[string]bool{}
+		}
+		if !byType[normalized.Type][normalized.Value] {
+			byType[normalized.Type][normalized.Value] = true
+			indicators = append(indicators, normalized)
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+
+	guardrails := h.guardrailsFor(req.TenantID)
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if req.Limit > 1000 {
+		req.Limit = 1000
+	}
+	req.Limit = guardrails.clampLimit(req.Limit)
+
+	queryStart := time.Now()
+	ctx := queryContext(context.Background(), guardrails)
+
+	matched := []models.IOCSweepMatch{}
+	for _, iocType := range iocSweepTypes {
+		if len(byType[iocType]) == 0 {
+			continue
+		}
+		matches, err := h.sweepIOCType(ctx, req.TenantID, startTime, endTime, iocType, byType[iocType])
+		if err != nil {
+			if queryLimitError(c, err, guardrails) {
+				return
+			}
+			log.Errorf("Failed to sweep %s IOCs: %v", iocType, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+			return
+		}
+		matched = append(matched, matches...)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].EventCount != matched[j].EventCount {
+			return matched[i].EventCount > matched[j].EventCount
+		}
+		return matched[i].Type+":"+matched[i].Value < matched[j].Type+":"+matched[j].Value
+	})
+
+	seen := map[string]bool{}
+	for _, match := range matched {
+		seen[match.Type+":"+match.Value] = true
+	}
+	unmatched := []models.IOCSweepIndicator{}
+	for _, indicator := range indicators {
+		if !seen[indicator.Type+":"+indicator.Value] {
+			unmatched = append(unmatched, indicator)
+		}
+	}
+
+	events := []models.IOCSweepEvent{}
+	truncated := false
+	if len(matched) > 0 {
+		events, truncated, err = h.sweepIOCEvents(ctx, req.TenantID, startTime, endTime, byType, req.Limit)
+		if err != nil {
+			if queryLimitError(c, err, guardrails) {
+				return
+			}
+			log.Errorf("Failed to fetch IOC sweep events: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.IOCSweepResponse{
+		Matched:     matched,
+		Unmatched:   unmatched,
+		Events:      events,
+		Truncated:   truncated,
+		TimeRange:   models.TimeRange{Start: startTime, End: endTime},
+		QueryTimeMs: time.Since(queryStart).Milliseconds(),
+	})
+}
+
+// sweepIOCType counts the events, agents and first and last sighting of each indicator of one
+// type. An event carrying an indicator in several fields is counted once.
+func (h *TelemetryHandler) sweepIOCType(ctx context.Context, tenantID string, start, end time.Time, iocType string, values map[string]bool) ([]models.IOCSweepMatch, error) {
+	list := make([]string, 0, len(values))
+	for value := range values {
+		list = append(list, value)
+	}
+	sort.Strings(list)
+
+	condition, conditionArgs := iocSweepCondition(iocType, list)
+	// Indicator values cannot contain newlines, so one joined parameter carries the whole list
+	query := fmt.Sprintf(`
+		SELECT ioc, count(), uniqExact(agent_id), min(timestamp), max(timestamp)
+		FROM telemetry_events
+		ARRAY JOIN arrayDistinct(arrayFilter(v -> has(splitByChar('\n', ?), v), [%s])) AS ioc
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ? AND (%s)
+		GROUP BY ioc
+	`, strings.Join(iocSweepColumns[iocType], ", "), condition)
+	args := append([]interface{}{strings.Join(list, "\n"), tenantID, start, end}, conditionArgs...)
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.IOCSweepMatch{}
+	for rows.Next() {
+		match := models.IOCSweepMatch{Type: iocType}
+		if err := rows.Scan(&match.Value, &match.EventCount, &match.AgentCount, &match.FirstSeen, &match.LastSeen); err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+// sweepIOCEvents returns the most recent events matching any indicator, each annotated with the
+// indicators it matched, and whether more matched than limit
+func (h *TelemetryHandler) sweepIOCEvents(ctx context.Context, tenantID string, start, end time.Time, byType map[string]map[string]bool, limit int) ([]models.IOCSweepEvent, bool, error) {
+	var conditions, columns, columnTypes []string
+	args := []interface{}{tenantID, start, end}
+	for _, iocType := range iocSweepTypes {
+		if len(byType[iocType]) == 0 {
+			continue
+		}
+		list := make([]string, 0, len(byType[iocType]))
+		for value := range byType[iocType] {
+			list = append(list, value)
+		}
+		condition, conditionArgs := iocSweepCondition(iocType, list)
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+		for _, expr := range iocSweepColumns[iocType] {
+			columns = append(columns, expr)
+			columnTypes = append(columnTypes, iocType)
+		}
+	}
+
+	query := "SELECT " + telemetryEventColumns + ", " + strings.Join(columns, ", ") + ` FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ? AND (` + strings.Join(conditions, " OR ") + `)
+		ORDER BY timestamp DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	events := []models.IOCSweepEvent{}
+	truncated := false
+	for rows.Next() {
+		if len(events) == limit {
+			truncated = true
+			break
+		}
+		values := make([]string, len(columns))
+		extra := make([]interface{}, len(values))
+		for i := range values {
+			extra[i] = &values[i]
+		}
+		event, err := scanTelemetryEvent(extraColumnsRow{row: rows, extra: extra})
+		if err != nil {
+			log.Warnf("Failed to scan event: %v", err)
+			continue
+		}
+
+		matched := iocSweepEventMatches(values, columnTypes, byType)
+		events = append(events, models.IOCSweepEvent{Event: event, IOCs: matched})
+	}
+	return events, truncated, rows.Err()
+}
+
+// iocSweepEventMatches lists the indicators among an event's selected values as type:value
+func iocSweepEventMatches(values, columnTypes []string, byType map[string]map[string]bool) []string {
+	matched := []string{}
+	for i, value := range values {
+		ioc := columnTypes[i] + ":" + value
+		if value != "" && byType[columnTypes[i]][value] && !containsString(matched, ioc) {
+			matched = append(matched, ioc)
+		}
+	}
+	return matched
+}
+
+// iocSweepCondition matches any of the type's expressions against the values. A literal IN list
+// per expression is what lets ClickHouse consult the bloom filter indexes.
+func iocSweepCondition(iocType string, values []string) (string, []interface{}) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+	var conditions []string
+	var args []interface{}
+	for _, expr := range iocSweepColumns[iocType] {
+		conditions = append(conditions, expr+" IN ("+placeholders+")")
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
+	return strings.Join(conditions, " OR "), args
+}
+
+// extraColumnsRow scans columns selected after telemetryEventColumns into extra, so
+// scanTelemetryEvent can be reused for queries that select more
+type extraColumnsRow struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (r extraColumnsRow) Scan(dest ...interface{}) error {
+	return r.row.Scan(append(dest, r.extra...)...)
+}
+
+// normalizeIOC refangs and canonicalizes an indicator, inferring its type when not given
+func normalizeIOC(ioc models.IOCSweepIndicator) (models.IOCSweepIndicator, error) {
+	// Threat reports defang indicators so they cannot be clicked, e.g. 10.0.0[.]1
+	value := strings.TrimSpace(ioc.Value)
+	value = strings.NewReplacer("[.]", ".", "(.)", ".", "[dot]", ".").Replace(value)
+
+	iocType := ioc.Type
+	if iocType == "" {
+		switch {
+		case net.ParseIP(value) != nil:
+			iocType = models.IOCTypeIP
+		case isIOCHash(value):
+			iocType = models.IOCTypeHash
+		default:
+			iocType = models.IOCTypeDomain
+		}
+	}
+
+	switch iocType {
+	case models.IOCTypeIP:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return ioc, fmt.Errorf("is not an IP address")
+		}
+		value = ip.String()
+	case models.IOCTypeHash:
+		if !isIOCHash(value) {
+			return ioc, fmt.Errorf("must be an MD5, SHA-1 or SHA-256 hash in hex")
+		}
+		value = strings.ToLower(value)
+	case models.IOCTypeDomain:
+		value = strings.ToLower(strings.TrimSuffix(value, "."))
+		if !strings.Contains(value, ".") || strings.ContainsAny(value, " \t\r\n/:@") {
+			return ioc, fmt.Errorf("is not a domain name")
+		}
+	}
+	return models.IOCSweepIndicator{Type: iocType, Value: value}, nil
+}
+
+// isIOCHash reports whether value is an MD5, SHA-1 or SHA-256 digest in hex
+func isIOCHash(value string) bool {
+	switch len(value) {
+	case 32, 40, 64:
+		_, err := hex.DecodeString(value)
+		return err == nil
+	}
+	return false
+}
@@ -0,0 +1,921 @@
+// Legal Hold
+// Preserves a license's telemetry and audit history for litigation and exports it as a signed,
+// independently verifiable package
+
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// maxLegalHoldEvents bounds one export package; larger scopes must be split across holds
+	maxLegalHoldEvents = 5000000
+
+	// Files of an export package that the manifest does not list
+	legalHoldManifestFile  = "manifest.json"
+	legalHoldSignatureFile = "manifest.sig"
+)
+
+// legalHoldReadme explains how to verify a package without access to the platform
+const legalHoldReadme = `This package is a legal hold export of security telemetry and audit records.
+
+Verifying it:
+1. manifest.sig is the base64 Ed25519 signature of the exact bytes of manifest.json. Verify it
+   with the base64 public key in manifest.json, after checking that key against the one the
+   platform publishes at GET /api/v1/legal-hold/public-key.
+2. manifest.json lists every other file with its SHA256 digest and size. Recompute them.
+
+Any difference means the package was altered after it was exported.
+`
+
+// legalHoldSigner signs export manifests; the license service signs with the platform key
+type legalHoldSigner interface {
+	Sign(data []byte) []byte
+	PublicKey() ed25519.PublicKey
+}
+
+// LegalHoldHandler manages legal holds and their exports
+type LegalHoldHandler struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+	signer     legalHoldSigner // nil disables exports
+}
+
+// NewLegalHoldHandler creates a new legal hold handler
+func NewLegalHoldHandler(db *sql.DB, ch driver.Conn) *LegalHoldHandler {
+	return &LegalHoldHandler{db: db, clickhouse: ch}
+}
+
+// SetSigner sets the key export manifests are signed with
+func (h *LegalHoldHandler) SetSigner(signer legalHoldSigner) {
+	h.signer = signer
+}
+
+// CreateLegalHold places a legal hold on a license's data
+func (h *LegalHoldHandler) CreateLegalHold(c *gin.Context) {
+	var req models.CreateLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	hold, status, err := h.createHold(req)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			log.Errorf("Failed to create legal hold: %v", err)
+			c.JSON(status, gin.H{"error": "Failed to create legal hold"})
+			return
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// ListLegalHolds lists a license's legal holds, optionally filtered by ?status=
+func (h *LegalHoldHandler) ListLegalHolds(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := "SELECT " + legalHoldColumns + " FROM legal_holds WHERE license_id = $1"
+	args := []interface{}{licenseID}
+	if status := c.Query("status"); status != "" {
+		if status != models.LegalHoldActive && status != models.LegalHoldReleased {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active or released"})
+			return
+		}
+		query += " AND status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to query legal holds: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve legal holds"})
+		return
+	}
+	defer rows.Close()
+
+	holds := []models.LegalHold{}
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			log.Warnf("Failed to scan legal hold: %v", err)
+			continue
+		}
+		holds = append(holds, *hold)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": holds, "count": len(holds)})
+}
+
+// GetLegalHold returns a legal hold with its exports
+func (h *LegalHoldHandler) GetLegalHold(c *gin.Context) {
+	hold, err := h.loadHold(c.Param("id"), principalLicense(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Legal hold not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get legal hold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve legal hold"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, hold_id, license_id, event_count, audit_count, manifest_sha256, signature,
+		       size_bytes, COALESCE(created_by, ''), created_at
+		FROM legal_hold_exports
+		WHERE hold_id = $1
+		ORDER BY created_at DESC
+	`, hold.ID)
+	if err != nil {
+		log.Errorf("Failed to query legal hold exports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve legal hold"})
+		return
+	}
+	defer rows.Close()
+
+	hold.Exports = []models.LegalHoldExport{}
+	for rows.Next() {
+		var export models.LegalHoldExport
+		if err := rows.Scan(&export.ID, &export.HoldID, &export.LicenseID, &export.EventCount, &export.AuditCount,
+			&export.ManifestSHA256, &export.Signature, &export.SizeBytes, &export.CreatedBy, &export.CreatedAt); err != nil {
+			log.Warnf("Failed to scan legal hold export: %v", err)
+			continue
+		}
+		hold.Exports = append(hold.Exports, export)
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// ReleaseLegalHold ends a legal hold so retention applies to its data again
+func (h *LegalHoldHandler) ReleaseLegalHold(c *gin.Context) {
+	holdID := c.Param("id")
+
+	var req models.ReleaseLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if _, err := uuid.Parse(holdID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active legal hold not found"})
+		return
+	}
+
+	var licenseID string
+	var startTime, endTime time.Time
+	err := h.db.QueryRow(`
+		UPDATE legal_holds SET status = $1, released_by = NULLIF($2, ''), released_at = NOW()
+		WHERE id = $3 AND status = $4 AND ($5 = '' OR license_id::text = $5)
+		RETURNING license_id, start_time, end_time
+	`, models.LegalHoldReleased, req.ReleasedBy, holdID, models.LegalHoldActive, principalLicense(c)).Scan(&licenseID, &startTime, &endTime)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active legal hold not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to release legal hold: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release legal hold"})
+		return
+	}
+
+	// Released in PostgreSQL first: if replication fails, ClickHouse keeps protecting the
+	// range, which only holds back reprocessing rather than exposing held events to it
+	if err := h.replicateHold(c.Request.Context(), licenseID, holdID, startTime, endTime, false); err != nil {
+		log.Errorf("Failed to replicate release of legal hold %s: %v", holdID, err)
+	}
+
+	log.Warnf("Legal hold %s released by %s; retention applies to its data again", holdID, req.ReleasedBy)
+	c.JSON(http.StatusOK, gin.H{"message": "Legal hold released successfully"})
+}
+
+// GetLegalHoldPublicKey returns the key export signatures verify with
+func (h *LegalHoldHandler) GetLegalHoldPublicKey(c *gin.Context) {
+	if h.signer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Export signing key not configured"})
+		return
+	}
+	publicKey := h.signer.PublicKey()
+	fingerprint := sha256.Sum256(publicKey)
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":   "Ed25519",
+		"public_key":  base64.StdEncoding.EncodeToString(publicKey),
+		"fingerprint": hex.EncodeToString(fingerprint[:]),
+	})
+}
+
+// ExportLegalHold assembles the events, audit records and integrity ledger in a hold's scope
+// into a zip package with a signed manifest, and returns it as a download. The package is not
+// kept; its manifest digest and signature are recorded so it can be recognized later.
+func (h *LegalHoldHandler) ExportLegalHold(c *gin.Context) {
+	if h.signer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Export signing key not configured"})
+		return
+	}
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.LegalHoldExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if (req.HoldID == "") == (req.Hold == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of hold_id or hold is required"})
+		return
+	}
+
+	var hold *models.LegalHold
+	if req.HoldID != "" {
+		var err error
+		hold, err = h.loadHold(req.HoldID, principalLicense(c))
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Legal hold not found"})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to get legal hold: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export legal hold"})
+			return
+		}
+	} else {
+		if err := binding.Validator.ValidateStruct(req.Hold); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+		if req.Hold.CreatedBy == "" {
+			req.Hold.CreatedBy = req.RequestedBy
+		}
+		var status int
+		var err error
+		hold, status, err = h.createHold(*req.Hold)
+		if err != nil {
+			if status == http.StatusInternalServerError {
+				log.Errorf("Failed to create legal hold: %v", err)
+				c.JSON(status, gin.H{"error": "Failed to create legal hold"})
+				return
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := context.Background()
+	eventFilter, eventArgs := legalHoldEventFilter(hold)
+	var eventCount uint64
+	if err := h.clickhouse.QueryRow(ctx, "SELECT count() FROM telemetry_events WHERE "+eventFilter, eventArgs...).Scan(&eventCount); err != nil {
+		log.Errorf("Failed to count legal hold events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export legal hold"})
+		return
+	}
+	if eventCount > maxLegalHoldEvents {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":       fmt.Sprintf("Hold covers %d events; exports are limited to %d. Split the time range across holds.", eventCount, maxLegalHoldEvents),
+			"event_count": eventCount,
+			"hold_id":     hold.ID,
+		})
+		return
+	}
+
+	file, err := os.CreateTemp("", "legal-hold-*.zip")
+	if err != nil {
+		log.Errorf("Failed to create legal hold package: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export legal hold"})
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	export, err := h.buildPackage(ctx, file, hold, req.RequestedBy)
+	if err != nil {
+		log.Errorf("Failed to build legal hold package for %s: %v", hold.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export legal hold"})
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO legal_hold_exports (id, hold_id, license_id, event_count, audit_count, manifest_sha256,
+			signature, size_bytes, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+	`, export.ID, export.HoldID, export.LicenseID, export.EventCount, export.AuditCount, export.ManifestSHA256,
+		export.Signature, export.SizeBytes, export.CreatedBy, export.CreatedAt)
+	if err != nil {
+		log.Errorf("Failed to record legal hold export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export legal hold"})
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{"hold_id": hold.ID, "export_id": export.ID, "requested_by": req.RequestedBy})
+	if _, err := h.db.Exec(`
+		INSERT INTO data_access_logs (license_id, action, query_details)
+		VALUES ($1, 'legal_hold_export', $2)
+	`, hold.LicenseID, details); err != nil {
+		log.Warnf("Failed to log legal hold export access: %v", err)
+	}
+
+	log.Infof("Exported legal hold %s: %d events, %d audit records, manifest %s",
+		hold.ID, export.EventCount, export.AuditCount, export.ManifestSHA256)
+
+	c.Header("X-Legal-Hold-Id", hold.ID)
+	c.Header("X-Export-Id", export.ID)
+	c.Header("X-Manifest-SHA256", export.ManifestSHA256)
+	c.FileAttachment(file.Name(), fmt.Sprintf("legal-hold-%s-%s.zip", hold.ID, export.CreatedAt.UTC().Format("20060102T150405Z")))
+}
+
+// VerifyLegalHoldExport checks an uploaded export package: the manifest signature against the
+// platform key and every listed file against its digest
+func (h *LegalHoldHandler) VerifyLegalHoldExport(c *gin.Context) {
+	if h.signer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Export signing key not configured"})
+		return
+	}
+
+	upload, err := c.FormFile("package")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "package file required"})
+		return
+	}
+	file, err := upload.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read package"})
+		return
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, upload.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "package is not a zip archive"})
+		return
+	}
+
+	result := verifyLegalHoldPackage(archive, h.signer.PublicKey())
+	if result.Manifest != nil {
+		manifestDigest := ""
+		for _, f := range archive.File {
+			if f.Name == legalHoldManifestFile {
+				manifestDigest, _, _ = zipFileDigest(f)
+			}
+		}
+		err := h.db.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM legal_hold_exports WHERE id::text = $1 AND manifest_sha256 = $2)",
+			result.Manifest.ExportID, manifestDigest).Scan(&result.KnownExport)
+		if err != nil {
+			log.Warnf("Failed to look up legal hold export: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// createHold validates and inserts a hold, returning the status to respond with on failure
+func (h *LegalHoldHandler) createHold(req models.CreateLegalHoldRequest) (*models.LegalHold, int, error) {
+	if !req.EndTime.After(req.StartTime) {
+		return nil, http.StatusBadRequest, fmt.Errorf("end_time must be after start_time")
+	}
+	if req.AgentIDs == nil {
+		req.AgentIDs = []string{}
+	}
+
+	hold := &models.LegalHold{
+		LicenseID:       req.LicenseID,
+		Name:            req.Name,
+		MatterReference: req.MatterReference,
+		StartTime:       req.StartTime.UTC(),
+		EndTime:         req.EndTime.UTC(),
+		AgentIDs:        req.AgentIDs,
+		Status:          models.LegalHoldActive,
+		CreatedBy:       req.CreatedBy,
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO legal_holds (license_id, name, matter_reference, start_time, end_time, agent_ids, status, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, ''))
+		RETURNING id, created_at
+	`, hold.LicenseID, hold.Name, hold.MatterReference, hold.StartTime, hold.EndTime, pq.Array(hold.AgentIDs),
+		hold.Status, hold.CreatedBy).Scan(&hold.ID, &hold.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && (pqErr.Code == "23503" || pqErr.Code == "22P02") {
+			return nil, http.StatusNotFound, fmt.Errorf("License not found")
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// The hold only takes effect once the consumer can see it, so it is not placed without the replica
+	if err := h.replicateHold(context.Background(), hold.LicenseID, hold.ID, hold.StartTime, hold.EndTime, true); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	log.Warnf("Legal hold %s placed on license %s from %s to %s; retention is suspended for this range",
+		hold.ID, hold.LicenseID, hold.StartTime.Format(time.RFC3339), hold.EndTime.Format(time.RFC3339))
+	return hold, http.StatusCreated, nil
+}
+
+// replicateHold copies a hold's range and state to ClickHouse, where the consumer reads it
+// before reprocessing stored events
+func (h *LegalHoldHandler) replicateHold(ctx context.Context, licenseID, holdID string, startTime, endTime time.Time, active bool) error {
+	if h.clickhouse == nil {
+		log.Warnf("ClickHouse not available, legal hold %s not replicated", holdID)
+		return nil
+	}
+	var state uint8
+	if active {
+		state = 1
+	}
+	err := h.clickhouse.Exec(ctx, `
+		INSERT INTO legal_holds (tenant_id, hold_id, start_time, end_time, active, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, licenseID, holdID, startTime, endTime, state, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to replicate legal hold: %w", err)
+	}
+	return nil
+}
+
+// legalHoldColumns is the column list matching scanLegalHold
+const legalHoldColumns = `id, license_id, name, COALESCE(matter_reference, ''), start_time, end_time,
+	COALESCE(agent_ids, '{}'), status, COALESCE(created_by, ''), created_at, COALESCE(released_by, ''), released_at`
+
+func scanLegalHold(row rowScanner) (*models.LegalHold, error) {
+	var hold models.LegalHold
+	var releasedAt sql.NullTime
+	err := row.Scan(&hold.ID, &hold.LicenseID, &hold.Name, &hold.MatterReference, &hold.StartTime, &hold.EndTime,
+		pq.Array(&hold.AgentIDs), &hold.Status, &hold.CreatedBy, &hold.CreatedAt, &hold.ReleasedBy, &releasedAt)
+	if err != nil {
+		return nil, err
+	}
+	if releasedAt.Valid {
+		hold.ReleasedAt = &releasedAt.Time
+	}
+	return &hold, nil
+}
+
+// loadHold fetches a hold by ID. Callers confined to a license only see their license's holds.
+func (h *LegalHoldHandler) loadHold(holdID, licenseID string) (*models.LegalHold, error) {
+	if _, err := uuid.Parse(holdID); err != nil {
+		return nil, sql.ErrNoRows
+	}
+	return scanLegalHold(h.db.QueryRow(
+		"SELECT "+legalHoldColumns+" FROM legal_holds WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		holdID, licenseID,
+	))
+}
+
+// legalHoldEventFilter is the telemetry_events (and agent_logs) WHERE clause for a hold's scope
+func legalHoldEventFilter(hold *models.LegalHold) (string, []interface{}) {
+	filter := "tenant_id = ? AND timestamp >= ? AND timestamp <= ?"
+	args := []interface{}{hold.LicenseID, hold.StartTime, hold.EndTime}
+	if len(hold.AgentIDs) > 0 {
+		placeholders := make([]string, len(hold.AgentIDs))
+		for i, agentID := range hold.AgentIDs {
+			placeholders[i] = "?"
+			args = append(args, agentID)
+		}
+		filter += " AND agent_id IN (" + strings.Join(placeholders, ",") + ")"
+	}
+	return filter, args
+}
+
+// buildPackage writes the export package for hold to file
+func (h *LegalHoldHandler) buildPackage(ctx context.Context, file *os.File, hold *models.LegalHold, requestedBy string) (*models.LegalHoldExport, error) {
+	pkg := &legalHoldPackage{zw: zip.NewWriter(file)}
+	export := &models.LegalHoldExport{
+		ID:        uuid.New().String(),
+		HoldID:    hold.ID,
+		LicenseID: hold.LicenseID,
+		CreatedBy: requestedBy,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := pkg.addFile("README.txt", []byte(legalHoldReadme), 0); err != nil {
+		return nil, err
+	}
+
+	// Telemetry in scope, oldest first
+	eventFilter, eventArgs := legalHoldEventFilter(hold)
+	events, err := pkg.addJSONL("events.jsonl", func(emit func(interface{}) error) error {
+		rows, err := h.clickhouse.Query(ctx, "SELECT "+telemetryEventColumns+" FROM telemetry_events WHERE "+
+			eventFilter+" ORDER BY timestamp, event_id", eventArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to query events: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			event, err := scanTelemetryEvent(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			if err := emit(event); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	export.EventCount = events
+
+	// The consumer's hash chain over the same range, so event integrity can be checked offline
+	if _, err := pkg.addJSONL("integrity/telemetry_ledger.jsonl", func(emit func(interface{}) error) error {
+		rows, err := h.clickhouse.Query(ctx, `
+			SELECT chain_id, seq, toString(batch_id), event_count, first_timestamp, last_timestamp,
+				events_hash, prev_hash, chain_hash
+			FROM telemetry_ledger
+			WHERE tenant_id = ? AND last_timestamp >= ? AND first_timestamp <= ?
+			ORDER BY chain_id, seq
+		`, hold.LicenseID, hold.StartTime, hold.EndTime)
+		if err != nil {
+			return fmt.Errorf("failed to query ledger: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var entry ledgerRow
+			if err := rows.Scan(&entry.chainID, &entry.seq, &entry.batchID, &entry.eventCount, &entry.firstTimestamp,
+				&entry.lastTimestamp, &entry.eventsHash, &entry.prevHash, &entry.chainHash); err != nil {
+				return fmt.Errorf("failed to scan ledger entry: %w", err)
+			}
+			if err := emit(map[string]interface{}{
+				"chain_id": entry.chainID, "seq": entry.seq, "batch_id": entry.batchID, "event_count": entry.eventCount,
+				"first_timestamp": entry.firstTimestamp, "last_timestamp": entry.lastTimestamp,
+				"events_hash": entry.eventsHash, "prev_hash": entry.prevHash, "chain_hash": entry.chainHash,
+			}); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Agent log lines in scope; the hold's filter applies to agent_logs unchanged
+	if _, err := pkg.addJSONL("logs/agent_logs.jsonl", func(emit func(interface{}) error) error {
+		rows, err := h.clickhouse.Query(ctx, `
+			SELECT toString(log_id), agent_id, hostname, timestamp, received_at, source, level, message
+			FROM agent_logs
+			WHERE `+eventFilter+`
+			ORDER BY timestamp, agent_id`, eventArgs...)
+		if err != nil {
+			return fmt.Errorf("failed to query agent logs: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var l models.AgentLog
+			if err := rows.Scan(&l.LogID, &l.AgentID, &l.Hostname, &l.Timestamp, &l.ReceivedAt, &l.Source, &l.Level, &l.Message); err != nil {
+				return fmt.Errorf("failed to scan agent log: %w", err)
+			}
+			if err := emit(l); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	// Hourly statistics over the range. The rollup has no agent dimension, so it would include
+	// other agents' activity and is left out of holds limited to some agents.
+	if len(hold.AgentIDs) == 0 {
+		if _, err := pkg.addJSONL("statistics/telemetry_stats_hourly.jsonl", func(emit func(interface{}) error) error {
+			rows, err := h.clickhouse.Query(ctx, `
+				SELECT event_hour, event_type, severity, mitre_tactic,
+					sum(event_count), uniqMerge(agents_state), uniqMerge(hosts_state)
+				FROM `+statsRollupTable+`
+				WHERE tenant_id = ? AND event_hour >= toStartOfHour(?) AND event_hour <= ?
+				GROUP BY event_hour, event_type, severity, mitre_tactic
+				ORDER BY event_hour, event_type, severity, mitre_tactic
+			`, hold.LicenseID, hold.StartTime, hold.EndTime)
+			if err != nil {
+				return fmt.Errorf("failed to query hourly statistics: %w", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var eventHour time.Time
+				var eventType, mitreTactic string
+				var severity uint8
+				var events, agents, hosts uint64
+				if err := rows.Scan(&eventHour, &eventType, &severity, &mitreTactic, &events, &agents, &hosts); err != nil {
+					return fmt.Errorf("failed to scan hourly statistics: %w", err)
+				}
+				if err := emit(map[string]interface{}{
+					"event_hour": eventHour, "event_type": eventType, "severity": severity, "mitre_tactic": mitreTactic,
+					"event_count": events, "unique_agents": agents, "unique_hosts": hosts,
+				}); err != nil {
+					return err
+				}
+			}
+			return rows.Err()
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Audit trails of the license over the same range
+	auditSources := []struct {
+		path  string
+		query string
+	}{
+		{"audit/license_audit_log.jsonl", `
+			SELECT id, action, performed_by, details, created_at FROM license_audit_log
+			WHERE license_id = $1 AND created_at >= $2 AND created_at <= $3 ORDER BY created_at`},
+		{"audit/data_access_logs.jsonl", `
+			SELECT id, user_id, action, dataset_id, ip_address, user_agent, query_details, accessed_at FROM data_access_logs
+			WHERE license_id = $1 AND accessed_at >= $2 AND accessed_at <= $3 ORDER BY accessed_at`},
+		{"audit/alert_suppression_audit.jsonl", `
+			SELECT a.id, a.suppression_id, s.rule_id, s.entity_type, s.entity_value, a.action, a.performed_by, a.details, a.created_at
+			FROM alert_suppression_audit a JOIN alert_suppressions s ON s.id = a.suppression_id
+			WHERE s.license_id = $1 AND a.created_at >= $2 AND a.created_at <= $3 ORDER BY a.created_at`},
+	}
+	for _, source := range auditSources {
+		records, err := pkg.addJSONL(source.path, func(emit func(interface{}) error) error {
+			return emitSQLRows(h.db, emit, source.query, hold.LicenseID, hold.StartTime, hold.EndTime)
+		})
+		if err != nil {
+			return nil, err
+		}
+		export.AuditCount += records
+	}
+
+	holdJSON, _ := json.MarshalIndent(hold, "", "  ")
+	if err := pkg.addFile("hold.json", holdJSON, 1); err != nil {
+		return nil, err
+	}
+
+	// The manifest covers every file written so far and is signed as written
+	manifest := models.LegalHoldManifest{
+		Format:          models.LegalHoldPackageFormat,
+		ExportID:        export.ID,
+		HoldID:          hold.ID,
+		LicenseID:       hold.LicenseID,
+		MatterReference: hold.MatterReference,
+		StartTime:       hold.StartTime,
+		EndTime:         hold.EndTime,
+		AgentIDs:        hold.AgentIDs,
+		GeneratedAt:     export.CreatedAt,
+		GeneratedBy:     requestedBy,
+		PublicKey:       base64.StdEncoding.EncodeToString(h.signer.PublicKey()),
+		Files:           pkg.files,
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	manifestDigest := sha256.Sum256(manifestJSON)
+	export.ManifestSHA256 = hex.EncodeToString(manifestDigest[:])
+	export.Signature = base64.StdEncoding.EncodeToString(h.signer.Sign(manifestJSON))
+
+	if err := pkg.addFile(legalHoldManifestFile, manifestJSON, 0); err != nil {
+		return nil, err
+	}
+	if err := pkg.addFile(legalHoldSignatureFile, []byte(export.Signature+"\n"), 0); err != nil {
+		return nil, err
+	}
+	if err := pkg.zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish package: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	export.SizeBytes = info.Size()
+	return export, nil
+}
+
+// legalHoldPackage writes package files to a zip, recording each file's digest for the manifest
+type legalHoldPackage struct {
+	zw    *zip.Writer
+	files []models.LegalHoldFile
+}
+
+// addFile writes a whole file. The manifest and its signature are not recorded.
+func (p *legalHoldPackage) addFile(path string, data []byte, records int64) error {
+	w, err := p.zw.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if path != legalHoldManifestFile && path != legalHoldSignatureFile {
+		digest := sha256.Sum256(data)
+		p.files = append(p.files, models.LegalHoldFile{Path: path, SHA256: hex.EncodeToString(digest[:]), SizeBytes: int64(len(data)), Records: records})
+	}
+	return nil
+}
+
+// addJSONL writes one JSON record per line as fill emits them and returns the record count
+func (p *legalHoldPackage) addJSONL(path string, fill func(emit func(interface{}) error) error) (int64, error) {
+	w, err := p.zw.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add %s: %w", path, err)
+	}
+	digest := sha256.New()
+	counter := &countingWriter{}
+	encoder := json.NewEncoder(io.MultiWriter(w, digest, counter))
+	encoder.SetEscapeHTML(false)
+
+	var records int64
+	err = fill(func(record interface{}) error {
+		records++
+		return encoder.Encode(record)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	p.files = append(p.files, models.LegalHoldFile{Path: path, SHA256: hex.EncodeToString(digest.Sum(nil)), SizeBytes: counter.n, Records: records})
+	return records, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// emitSQLRows emits each row of a Postgres query as an object keyed by column name. JSON
+// columns are embedded as JSON, other byte values as text.
+func emitSQLRows(db *sql.DB, emit func(interface{}) error, query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				if len(b) > 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b) {
+					record[column] = json.RawMessage(b)
+				} else {
+					record[column] = string(b)
+				}
+				continue
+			}
+			record[column] = values[i]
+		}
+		if err := emit(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// verifyLegalHoldPackage checks a package's manifest signature and file digests
+func verifyLegalHoldPackage(archive *zip.Reader, publicKey ed25519.PublicKey) models.LegalHoldVerification {
+	result := models.LegalHoldVerification{Issues: []string{}}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	manifestFile, signatureFile := files[legalHoldManifestFile], files[legalHoldSignatureFile]
+	if manifestFile == nil || signatureFile == nil {
+		result.Issues = append(result.Issues, "package has no manifest.json or manifest.sig")
+		return result
+	}
+	manifestJSON, err := readZipFile(manifestFile)
+	if err != nil {
+		result.Issues = append(result.Issues, "manifest.json is unreadable")
+		return result
+	}
+	signatureText, err := readZipFile(signatureFile)
+	if err != nil {
+		result.Issues = append(result.Issues, "manifest.sig is unreadable")
+		return result
+	}
+
+	var manifest models.LegalHoldManifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil || manifest.Format != models.LegalHoldPackageFormat {
+		result.Issues = append(result.Issues, "manifest.json is not a legal hold manifest")
+		return result
+	}
+	result.Manifest = &manifest
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signatureText)))
+	result.SignatureValid = err == nil && ed25519.Verify(publicKey, manifestJSON, signature)
+	if !result.SignatureValid {
+		if manifest.PublicKey != base64.StdEncoding.EncodeToString(publicKey) {
+			result.Issues = append(result.Issues, "manifest is not signed with this platform's key")
+		} else {
+			result.Issues = append(result.Issues, "manifest signature is invalid")
+		}
+	}
+
+	listed := make(map[string]bool, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		listed[entry.Path] = true
+		f := files[entry.Path]
+		if f == nil {
+			result.Issues = append(result.Issues, fmt.Sprintf("%s is missing", entry.Path))
+			continue
+		}
+		digest, size, err := zipFileDigest(f)
+		if err != nil {
+			result.Issues = append(result.Issues, fmt.Sprintf("%s is unreadable", entry.Path))
+			continue
+		}
+		if digest != entry.SHA256 || size != entry.SizeBytes {
+			result.Issues = append(result.Issues, fmt.Sprintf("%s does not match its manifest digest", entry.Path))
+		}
+	}
+
+	unlisted := []string{}
+	for name := range files {
+		if !listed[name] && name != legalHoldManifestFile && name != legalHoldSignatureFile {
+			unlisted = append(unlisted, name)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, name := range unlisted {
+		result.Issues = append(result.Issues, fmt.Sprintf("%s is not listed in the manifest", name))
+	}
+
+	result.Valid = result.SignatureValid && len(result.Issues) == 0
+	return result
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zipFileDigest returns the hex SHA256 and size of a zip entry's contents
+func zipFileDigest(f *zip.File) (string, int64, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Close()
+	digest := sha256.New()
+	size, err := io.Copy(digest, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), size, nil
+}
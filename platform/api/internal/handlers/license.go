@@ -3,7 +3,14 @@
 package handlers
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -29,7 +36,7 @@ func (h *LicenseHandler) CreateLicense(c *gin.Context) {
 	var req models.CreateLicenseRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -58,7 +65,7 @@ func (h *LicenseHandler) ValidateLicense(c *gin.Context) {
 	var req models.ValidateLicenseRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -67,7 +74,7 @@ func (h *LicenseHandler) ValidateLicense(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.ValidateLicense(req.LicenseKey, req.AgentID)
+	response, err := h.service.ValidateLicense(req, c.ClientIP())
 	if err != nil {
 		log.Errorf("Failed to validate license: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -82,7 +89,8 @@ func (h *LicenseHandler) ValidateLicense(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// ListLicenses retrieves all licenses
+// ListLicenses retrieves licenses, filtered by ?tier=, ?is_active=, ?expiring_within_days= and
+// ?search= (customer name, email or company), paginated by ?limit= and ?offset=
 func (h *LicenseHandler) ListLicenses(c *gin.Context) {
 	if h.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
@@ -90,10 +98,52 @@ func (h *LicenseHandler) ListLicenses(c *gin.Context) {
 	}
 
 	// Parse pagination parameters
-	limit := 50
-	offset := 0
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	// Parse filters
+	var filter models.LicenseListFilter
+	if tier := c.Query("tier"); tier != "" {
+		switch models.LicenseTier(tier) {
+		case models.TierFree, models.TierPro, models.TierEnterprise:
+			filter.Tier = models.LicenseTier(tier)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "tier must be free, professional or enterprise"})
+			return
+		}
+	}
+	if isActive := c.Query("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "is_active must be true or false"})
+			return
+		}
+		filter.IsActive = &active
+	}
+	if days := c.Query("expiring_within_days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiring_within_days must be a positive integer"})
+			return
+		}
+		filter.ExpiringWithinDays = n
+	}
+	filter.LicenseID = principalLicense(c)
+	filter.Search = strings.TrimSpace(c.Query("search"))
+	if len(filter.Search) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "search must be at most 255 characters"})
+		return
+	}
 
-	licenses, total, err := h.service.ListLicenses(limit, offset)
+	licenses, total, err := h.service.ListLicenses(filter, limit, offset)
 	if err != nil {
 		log.Errorf("Failed to list licenses: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -159,7 +209,7 @@ func (h *LicenseHandler) GenerateTrialLicense(c *gin.Context) {
 
 	var req TrialRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -199,3 +249,461 @@ func (h *LicenseHandler) GetLicenseUsage(c *gin.Context) {
 
 	c.JSON(http.StatusOK, usage)
 }
+
+// ListMachineBindings returns the machines holding seats on a license
+func (h *LicenseHandler) ListMachineBindings(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	bindings, err := h.service.ListMachineBindings(licenseID)
+	if err != nil {
+		log.Errorf("Failed to list machine bindings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list machine bindings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"machines": bindings,
+		"count":    len(bindings),
+	})
+}
+
+// ReleaseMachineBinding frees a machine's seat, e.g. after hardware replacement
+func (h *LicenseHandler) ReleaseMachineBinding(c *gin.Context) {
+	licenseID := c.Param("id")
+	bindingID := c.Param("bindingId")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if err := h.service.ReleaseMachineBinding(licenseID, bindingID); err != nil {
+		if err.Error() == "machine binding not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Machine binding not found"})
+			return
+		}
+		log.Errorf("Failed to release machine binding: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release machine binding"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Machine binding released successfully"})
+}
+
+// GetRevocationList returns the signed CRL of revoked license IDs for offline validation
+func (h *LicenseHandler) GetRevocationList(c *gin.Context) {
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	crl, err := h.service.GetRevocationList()
+	if err != nil {
+		log.Errorf("Failed to build revocation list: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build revocation list"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, crl)
+}
+
+// GetLicenseFeatures returns tier defaults, overrides and effective features for a license
+func (h *LicenseHandler) GetLicenseFeatures(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	features, err := h.service.GetLicenseFeatures(licenseID)
+	if err != nil {
+		if err.Error() == "license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to get license features: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get license features"})
+		return
+	}
+
+	c.JSON(http.StatusOK, features)
+}
+
+// SetFeatureOverride grants or revokes a single feature on a license
+func (h *LicenseHandler) SetFeatureOverride(c *gin.Context) {
+	licenseID := c.Param("id")
+	feature := c.Param("feature")
+
+	var req models.SetFeatureOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if !models.IsKnownFeature(feature) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown feature: " + feature})
+		return
+	}
+
+	if err := h.service.SetFeatureOverride(licenseID, feature, *req.Enabled); err != nil {
+		if err.Error() == "license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to set feature override: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set feature override"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feature override updated successfully"})
+}
+
+// ClearFeatureOverride reverts a feature to its tier default
+func (h *LicenseHandler) ClearFeatureOverride(c *gin.Context) {
+	licenseID := c.Param("id")
+	feature := c.Param("feature")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if err := h.service.ClearFeatureOverride(licenseID, feature); err != nil {
+		if err.Error() == "license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to clear feature override: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear feature override"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feature override cleared successfully"})
+}
+
+// GetLicenseUsageHistory returns the usage time series and overage status for a license.
+// start and end are RFC3339; the default range is the last 30 days.
+func (h *LicenseHandler) GetLicenseUsageHistory(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -30)
+	if v := c.Query("start"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time, expected RFC3339"})
+			return
+		}
+		start = parsed
+	}
+	if v := c.Query("end"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time, expected RFC3339"})
+			return
+		}
+		end = parsed
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start must be before end"})
+		return
+	}
+
+	history, err := h.service.GetUsageHistory(licenseID, start, end)
+	if err != nil {
+		if err.Error() == "license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to get license usage history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get license usage history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// ListChildLicenses returns the licenses a parent license manages, with usage and caps rolled
+// up across the parent and its active children
+func (h *LicenseHandler) ListChildLicenses(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	hierarchy, err := h.service.ListChildLicenses(licenseID)
+	if err != nil {
+		if err.Error() == "license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+			return
+		}
+		log.Errorf("Failed to list child licenses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list child licenses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hierarchy)
+}
+
+// LinkChildLicense places a license under this one, letting it manage and query the child.
+// Linking hands the parent the child's telemetry, so only platform principals may do it: an
+// administrator of the parent license cannot adopt another customer's license.
+func (h *LicenseHandler) LinkChildLicense(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	if principalLicense(c) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only platform administrators can link child licenses"})
+		return
+	}
+
+	var req models.LinkChildLicenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if err := h.service.LinkChildLicense(licenseID, req.ChildLicenseID); err != nil {
+		var hierarchyErr *service.HierarchyError
+		switch {
+		case errors.As(err, &hierarchyErr):
+			c.JSON(http.StatusConflict, gin.H{"error": hierarchyErr.Error()})
+		case err.Error() == "license not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+		case err.Error() == "child license not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Child license not found"})
+		default:
+			log.Errorf("Failed to link child license: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link child license"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Child license linked successfully"})
+}
+
+// UnlinkChildLicense removes a license from this one's hierarchy
+func (h *LicenseHandler) UnlinkChildLicense(c *gin.Context) {
+	licenseID := c.Param("id")
+	childID := c.Param("childId")
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if err := h.service.UnlinkChildLicense(licenseID, childID); err != nil {
+		if err.Error() == "child license not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Child license not found"})
+			return
+		}
+		log.Errorf("Failed to unlink child license: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink child license"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Child license unlinked successfully"})
+}
+
+// BulkCreateLicenses imports licenses from a JSON body or a CSV upload (Content-Type: text/csv).
+// CSV columns: customer_email, customer_name, company_name, tier, duration_days; mode is passed as ?mode=.
+func (h *LicenseHandler) BulkCreateLicenses(c *gin.Context) {
+	var req models.BulkCreateLicensesRequest
+
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		licenses, err := parseLicenseCSV(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Licenses = licenses
+		req.Mode = models.BulkMode(c.Query("mode"))
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	if len(req.Licenses) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No licenses provided"})
+		return
+	}
+	if len(req.Licenses) > service.MaxBulkLicenses {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many licenses (max %d)", service.MaxBulkLicenses)})
+		return
+	}
+	if req.Mode != "" && req.Mode != models.BulkModeAtomic && req.Mode != models.BulkModeBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or best_effort"})
+		return
+	}
+
+	response, err := h.service.BulkCreateLicenses(req.Licenses, req.Mode)
+	if err != nil {
+		log.Errorf("Failed to bulk create licenses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if response.Failed > 0 {
+		if response.Created == 0 {
+			status = http.StatusUnprocessableEntity
+		} else {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	c.JSON(status, response)
+}
+
+// parseLicenseCSV reads license requests from CSV with a header row
+func parseLicenseCSV(r io.Reader) ([]models.CreateLicenseRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"customer_email", "customer_name", "tier"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV is missing required column: %s", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	licenses := []models.CreateLicenseRequest{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV at line %d: %w", line, err)
+		}
+		if len(licenses) >= service.MaxBulkLicenses {
+			return nil, fmt.Errorf("too many licenses (max %d)", service.MaxBulkLicenses)
+		}
+
+		req := models.CreateLicenseRequest{
+			CustomerEmail: field(record, "customer_email"),
+			CustomerName:  field(record, "customer_name"),
+			CompanyName:   field(record, "company_name"),
+			Tier:          models.LicenseTier(strings.ToLower(field(record, "tier"))),
+		}
+		if days := field(record, "duration_days"); days != "" {
+			req.DurationDays, err = strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration_days at line %d: %s", line, days)
+			}
+		}
+		licenses = append(licenses, req)
+	}
+
+	return licenses, nil
+}
+
+// ExportLicenses dumps every license as JSON (default) or CSV (?format=csv). The export carries
+// signed license keys; callers confined to a license only get their own.
+func (h *LicenseHandler) ExportLicenses(c *gin.Context) {
+	if h.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "License service not available"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	licenses, err := h.service.ExportLicenses(principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to export licenses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export licenses"})
+		return
+	}
+
+	filename := fmt.Sprintf("licenses-%s.%s", time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"licenses": licenses,
+			"count":    len(licenses),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	writer := newCSVSafeWriter(c.Writer)
+	writer.Write([]string{
+		"id", "license_key", "customer_email", "customer_name", "company_name", "tier",
+		"max_agents", "max_users", "issued_at", "expires_at", "is_active", "created_at",
+	})
+	for _, license := range licenses {
+		expiresAt := ""
+		if license.ExpiresAt != nil {
+			expiresAt = license.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			license.ID,
+			license.LicenseKey,
+			license.CustomerEmail,
+			license.CustomerName,
+			license.CompanyName,
+			string(license.Tier),
+			strconv.Itoa(license.MaxAgents),
+			strconv.Itoa(license.MaxUsers),
+			license.IssuedAt.UTC().Format(time.RFC3339),
+			expiresAt,
+			strconv.FormatBool(license.IsActive),
+			license.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Errorf("Failed to write license export: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// License Status Replication
+// Copies license validity from PostgreSQL to ClickHouse, where the consumer checks each event's tenant
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// licenseStatusFullSyncInterval is how often every license is rewritten and deleted licenses
+	// are tombstoned; runs in between only copy licenses updated since the last run
+	licenseStatusFullSyncInterval = time.Hour
+
+	// licenseStatusSyncOverlap re-reads recent updates, covering transactions that committed
+	// after the previous run read past their updated_at
+	licenseStatusSyncOverlap = time.Minute
+)
+
+// LicenseStatusSync replicates the licenses table's validity columns to license_status
+type LicenseStatusSync struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+
+	mu        sync.Mutex
+	watermark time.Time // PostgreSQL time of the last successful run
+	lastFull  time.Time
+}
+
+// StartLicenseStatusSync replicates license status periodically in the background
+func StartLicenseStatusSync(db *sql.DB, ch driver.Conn, interval time.Duration) *LicenseStatusSync {
+	s := &LicenseStatusSync{db: db, clickhouse: ch}
+	if ch == nil {
+		log.Warn("ClickHouse not available, license status replication disabled")
+		return s
+	}
+
+	go func() {
+		if _, err := s.Run(); err != nil {
+			log.Errorf("License status replication failed: %v", err)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := s.Run(); err != nil {
+				log.Errorf("License status replication failed: %v", err)
+			}
+		}
+	}()
+
+	log.Infof("License status replication started (interval: %v)", interval)
+	return s
+}
+
+// Run copies licenses changed since the previous run, or all of them once an hour, and
+// returns how many rows it wrote
+func (s *LicenseStatusSync) Run() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	full := s.watermark.IsZero() || time.Since(s.lastFull) >= licenseStatusFullSyncInterval
+	query := `
+		SELECT id::text, COALESCE(is_active, TRUE), expires_at, NOW()
+		FROM licenses`
+	args := []interface{}{}
+	if !full {
+		query += " WHERE updated_at > $1"
+		args = append(args, s.watermark.Add(-licenseStatusSyncOverlap))
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read licenses: %w", err)
+	}
+	defer rows.Close()
+
+	type licenseStatus struct {
+		id        string
+		active    uint8
+		expiresAt *time.Time
+	}
+	statuses := []licenseStatus{}
+	present := make(map[string]bool)
+	var dbNow time.Time
+	for rows.Next() {
+		var st licenseStatus
+		var active bool
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&st.id, &active, &expiresAt, &dbNow); err != nil {
+			return 0, fmt.Errorf("failed to scan license: %w", err)
+		}
+		if active {
+			st.active = 1
+		}
+		if expiresAt.Valid {
+			st.expiresAt = &expiresAt.Time
+		}
+		statuses = append(statuses, st)
+		present[st.id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read licenses: %w", err)
+	}
+	if dbNow.IsZero() {
+		if err := s.db.QueryRow("SELECT NOW()").Scan(&dbNow); err != nil {
+			return 0, fmt.Errorf("failed to read database time: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	var deleted []string
+	if full {
+		deleted, err = s.deletedLicenses(ctx, present)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(statuses) == 0 && len(deleted) == 0 {
+		s.advance(dbNow, full)
+		return 0, nil
+	}
+
+	batch, err := s.clickhouse.PrepareBatch(ctx, "INSERT INTO license_status (tenant_id, active, expires_at, deleted, updated_at)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	now := time.Now().UTC()
+	for _, st := range statuses {
+		if err := batch.Append(st.id, st.active, st.expiresAt, uint8(0), now); err != nil {
+			return 0, fmt.Errorf("failed to append license status: %w", err)
+		}
+	}
+	for _, id := range deleted {
+		if err := batch.Append(id, uint8(0), nil, uint8(1), now); err != nil {
+			return 0, fmt.Errorf("failed to append license tombstone: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return 0, fmt.Errorf("failed to write license status: %w", err)
+	}
+
+	s.advance(dbNow, full)
+	if len(deleted) > 0 {
+		log.Infof("License status replication: %d licenses updated, %d deleted licenses tombstoned", len(statuses), len(deleted))
+	}
+	return len(statuses) + len(deleted), nil
+}
+
+// deletedLicenses lists replicated licenses that no longer exist in PostgreSQL
+func (s *LicenseStatusSync) deletedLicenses(ctx context.Context, present map[string]bool) ([]string, error) {
+	rows, err := s.clickhouse.Query(ctx, "SELECT tenant_id FROM license_status FINAL WHERE deleted = 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replicated licenses: %w", err)
+	}
+	defer rows.Close()
+
+	deleted := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan replicated license: %w", err)
+		}
+		if !present[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, rows.Err()
+}
+
+func (s *LicenseStatusSync) advance(dbNow time.Time, full bool) {
+	s.watermark = dbNow
+	if full {
+		s.lastFull = time.Now()
+	}
+}
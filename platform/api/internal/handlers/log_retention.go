@@ -0,0 +1,436 @@
+// Log Retention
+// Expires old notification_logs and license_audit_log entries. Notification logs are purged by
+// dropping whole monthly partitions; audit log entries can be archived to files before deletion.
+
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// logRetentionBatchSize bounds each delete, keeping locks and WAL bursts short
+	logRetentionBatchSize = 10000
+
+	defaultLogPartitionsAhead = 2
+)
+
+// auditLogHoldFilter excludes audit entries covered by an active legal hold on their license
+const auditLogHoldFilter = `
+	NOT EXISTS (
+		SELECT 1 FROM legal_holds h
+		WHERE h.license_id = a.license_id AND h.status = $2
+		  AND a.created_at >= h.start_time AND a.created_at <= h.end_time
+	)`
+
+// LogRetentionManager applies the deployment's log retention
+type LogRetentionManager struct {
+	db     *sql.DB
+	config models.LogRetentionConfig
+
+	mu      sync.Mutex
+	lastRun *models.LogRetentionRunResult
+}
+
+// NewLogRetentionManager creates a new log retention manager
+func NewLogRetentionManager(db *sql.DB, config models.LogRetentionConfig) *LogRetentionManager {
+	if config.NotificationLogDays < 0 {
+		config.NotificationLogDays = 0
+	}
+	if config.AuditLogDays < 0 {
+		config.AuditLogDays = 0
+	}
+	if config.AuditLogMode != models.LogRetentionArchive {
+		config.AuditLogMode = models.LogRetentionDelete
+	}
+	if config.PartitionsAhead < 1 {
+		config.PartitionsAhead = defaultLogPartitionsAhead
+	}
+	return &LogRetentionManager{db: db, config: config}
+}
+
+// StartLogRetentionJob runs log retention periodically in the background. The first run is
+// immediate so the upcoming notification log partitions exist before they are written to.
+func StartLogRetentionJob(db *sql.DB, config models.LogRetentionConfig, interval time.Duration) *LogRetentionManager {
+	manager := NewLogRetentionManager(db, config)
+	if manager.config.AuditLogMode == models.LogRetentionArchive && manager.config.ArchiveDir == "" {
+		log.Warn("Audit log archive mode without an archive directory, license audit log entries will not be expired")
+	}
+
+	run := func() {
+		result, err := manager.Apply(false)
+		if err != nil {
+			log.Errorf("Log retention failed: %v", err)
+			return
+		}
+		log.Infof("Log retention applied: %d notification partitions created, %d dropped, %d notification logs and %d audit log entries expired (%d held)",
+			len(result.CreatedPartitions), len(result.NotificationLogs.DroppedPartitions),
+			result.NotificationLogs.ExpiredEntries, result.AuditLog.ExpiredEntries, result.AuditLog.HeldEntries)
+	}
+
+	go func() {
+		run()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+
+	log.Infof("Log retention job started (interval: %v)", interval)
+	return manager
+}
+
+// Status returns the retention configuration and the result of the last run
+func (m *LogRetentionManager) Status() models.LogRetentionStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return models.LogRetentionStatus{Config: m.config, LastRun: m.lastRun}
+}
+
+// Apply enforces log retention once. With dryRun, expired entries are counted but nothing is
+// created, dropped, archived or deleted.
+func (m *LogRetentionManager) Apply(dryRun bool) (models.LogRetentionRunResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	result := models.LogRetentionRunResult{
+		DryRun:            dryRun,
+		CreatedPartitions: []string{},
+		StartedAt:         now,
+		NotificationLogs: models.LogRetentionTableResult{
+			Table:             "notification_logs",
+			RetentionDays:     m.config.NotificationLogDays,
+			Mode:              models.LogRetentionDelete,
+			DroppedPartitions: []string{},
+			ArchiveFiles:      []string{},
+		},
+		AuditLog: models.LogRetentionTableResult{
+			Table:             "license_audit_log",
+			RetentionDays:     m.config.AuditLogDays,
+			Mode:              m.config.AuditLogMode,
+			DroppedPartitions: []string{},
+			ArchiveFiles:      []string{},
+		},
+	}
+
+	if !dryRun {
+		result.CreatedPartitions = m.ensurePartitions(now)
+	}
+
+	if m.config.NotificationLogDays > 0 {
+		if err := m.expireNotificationLogs(&result.NotificationLogs, now, dryRun); err != nil {
+			return result, err
+		}
+	}
+	if m.config.AuditLogDays > 0 {
+		if err := m.expireAuditLog(&result.AuditLog, now, dryRun); err != nil {
+			return result, err
+		}
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	if !dryRun {
+		m.lastRun = &result
+	}
+	return result, nil
+}
+
+// ensurePartitions creates the notification log partitions for this month and the months ahead.
+// A month whose rows already landed in the default partition cannot be created and stays there.
+func (m *LogRetentionManager) ensurePartitions(now time.Time) []string {
+	created := []string{}
+	for i := 0; i <= m.config.PartitionsAhead; i++ {
+		month := time.Date(now.Year(), now.Month()+time.Month(i), 1, 0, 0, 0, 0, time.UTC)
+		partition := "notification_logs_p" + month.Format("200601")
+
+		var exists bool
+		if err := m.db.QueryRow("SELECT to_regclass($1) IS NOT NULL", partition).Scan(&exists); err != nil {
+			log.Errorf("Failed to check notification log partition %s: %v", partition, err)
+			continue
+		}
+		if exists {
+			continue
+		}
+		if _, err := m.db.Exec("SELECT create_notification_log_partition($1)", month.Format("2006-01-02")); err != nil {
+			log.Errorf("Failed to create notification log partition %s: %v", partition, err)
+			continue
+		}
+		created = append(created, partition)
+	}
+	return created
+}
+
+// expireNotificationLogs drops the monthly partitions older than the cutoff, then deletes the
+// remaining expired rows of the cutoff's month and the default partition
+func (m *LogRetentionManager) expireNotificationLogs(table *models.LogRetentionTableResult, now time.Time, dryRun bool) error {
+	cutoff := now.AddDate(0, 0, -m.config.NotificationLogDays)
+	table.Cutoff = &cutoff
+
+	if dryRun {
+		monthStart := time.Date(cutoff.Year(), cutoff.Month(), 1, 0, 0, 0, 0, time.UTC)
+		partitions, err := m.expiredNotificationPartitions(cutoff)
+		if err != nil {
+			return err
+		}
+		table.DroppedPartitions = partitions
+
+		if err := m.db.QueryRow(`
+			SELECT COUNT(*) FROM notification_logs
+			WHERE sent_at < $1 AND (sent_at >= $2 OR tableoid = 'notification_logs_default'::regclass)
+		`, cutoff, monthStart).Scan(&table.ExpiredEntries); err != nil {
+			return fmt.Errorf("failed to count expired notification logs: %w", err)
+		}
+		return nil
+	}
+
+	rows, err := m.db.Query("SELECT drop_notification_log_partitions($1)", cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to drop notification log partitions: %w", err)
+	}
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err == nil {
+			table.DroppedPartitions = append(table.DroppedPartitions, partition)
+		}
+	}
+	rows.Close()
+
+	for {
+		res, err := m.db.Exec(`
+			DELETE FROM notification_logs WHERE (id, sent_at) IN (
+				SELECT id, sent_at FROM notification_logs WHERE sent_at < $1 LIMIT $2
+			)
+		`, cutoff, logRetentionBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to delete expired notification logs: %w", err)
+		}
+		deleted, _ := res.RowsAffected()
+		table.ExpiredEntries += deleted
+		if deleted < logRetentionBatchSize {
+			return nil
+		}
+	}
+}
+
+// expiredNotificationPartitions lists the monthly partitions drop_notification_log_partitions
+// would drop for the cutoff
+func (m *LogRetentionManager) expiredNotificationPartitions(cutoff time.Time) ([]string, error) {
+	rows, err := m.db.Query(`
+		SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'notification_logs'::regclass AND c.relname ~ '^notification_logs_p[0-9]{6}$'
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification log partitions: %w", err)
+	}
+	defer rows.Close()
+
+	partitions := []string{}
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			continue
+		}
+		yyyymm, err := strconv.Atoi(partition[len(partition)-6:])
+		if err != nil {
+			continue
+		}
+		monthEnd := time.Date(yyyymm/100, time.Month(yyyymm%100), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+		if !monthEnd.After(cutoff) {
+			partitions = append(partitions, partition)
+		}
+	}
+	return partitions, rows.Err()
+}
+
+// expireAuditLog deletes, or archives and then deletes, audit entries older than the cutoff.
+// Entries within an active legal hold on their license are kept.
+func (m *LogRetentionManager) expireAuditLog(table *models.LogRetentionTableResult, now time.Time, dryRun bool) error {
+	cutoff := now.AddDate(0, 0, -m.config.AuditLogDays)
+	table.Cutoff = &cutoff
+
+	if err := m.db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE `+auditLogHoldFilter+`), COUNT(*) FILTER (WHERE NOT `+auditLogHoldFilter+`)
+		FROM license_audit_log a WHERE a.created_at < $1
+	`, cutoff, models.LegalHoldActive).Scan(&table.ExpiredEntries, &table.HeldEntries); err != nil {
+		return fmt.Errorf("failed to count expired audit log entries: %w", err)
+	}
+	if dryRun || table.ExpiredEntries == 0 {
+		return nil
+	}
+
+	table.ExpiredEntries = 0
+	if m.config.AuditLogMode == models.LogRetentionArchive {
+		return m.archiveAuditLog(table, cutoff, now)
+	}
+
+	for {
+		res, err := m.db.Exec(`
+			DELETE FROM license_audit_log WHERE id IN (
+				SELECT a.id FROM license_audit_log a
+				WHERE a.created_at < $1 AND `+auditLogHoldFilter+`
+				LIMIT $3
+			)
+		`, cutoff, models.LegalHoldActive, logRetentionBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to delete expired audit log entries: %w", err)
+		}
+		deleted, _ := res.RowsAffected()
+		table.ExpiredEntries += deleted
+		if deleted < logRetentionBatchSize {
+			return nil
+		}
+	}
+}
+
+// auditLogArchiveRecord is one archived license_audit_log entry
+type auditLogArchiveRecord struct {
+	ID          string          `json:"id"`
+	LicenseID   *string         `json:"license_id"`
+	Action      string          `json:"action"`
+	PerformedBy *string         `json:"performed_by"`
+	Details     json.RawMessage `json:"details,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// archiveAuditLog writes expired audit entries in batches to gzipped JSONL files, each with a
+// SHA-256 sidecar, and deletes a batch only once its file is written
+func (m *LogRetentionManager) archiveAuditLog(table *models.LogRetentionTableResult, cutoff, now time.Time) error {
+	if m.config.ArchiveDir == "" {
+		return fmt.Errorf("audit log archive mode requires an archive directory")
+	}
+	if err := os.MkdirAll(m.config.ArchiveDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create audit log archive directory: %w", err)
+	}
+
+	for batch := 1; ; batch++ {
+		rows, err := m.db.Query(`
+			SELECT a.id, a.license_id, a.action, a.performed_by, a.details, a.created_at
+			FROM license_audit_log a
+			WHERE a.created_at < $1 AND `+auditLogHoldFilter+`
+			ORDER BY a.created_at, a.id
+			LIMIT $3
+		`, cutoff, models.LegalHoldActive, logRetentionBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read expired audit log entries: %w", err)
+		}
+
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		ids := []string{}
+		for rows.Next() {
+			var record auditLogArchiveRecord
+			var licenseID, performedBy sql.NullString
+			var details []byte
+			if err := rows.Scan(&record.ID, &licenseID, &record.Action, &performedBy, &details, &record.CreatedAt); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan audit log entry: %w", err)
+			}
+			if licenseID.Valid {
+				record.LicenseID = &licenseID.String
+			}
+			if performedBy.Valid {
+				record.PerformedBy = &performedBy.String
+			}
+			if len(details) > 0 {
+				record.Details = details
+			}
+			if err := encoder.Encode(record); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to encode audit log entry: %w", err)
+			}
+			ids = append(ids, record.ID)
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			return nil
+		}
+
+		name := fmt.Sprintf("license_audit_log_%s_%04d.jsonl.gz", now.Format("20060102T150405Z"), batch)
+		if err := writeArchiveFile(filepath.Join(m.config.ArchiveDir, name), buf.Bytes()); err != nil {
+			return err
+		}
+		table.ArchiveFiles = append(table.ArchiveFiles, name)
+
+		res, err := m.db.Exec("DELETE FROM license_audit_log WHERE id = ANY($1)", pq.Array(ids))
+		if err != nil {
+			return fmt.Errorf("failed to delete archived audit log entries: %w", err)
+		}
+		deleted, _ := res.RowsAffected()
+		table.ExpiredEntries += deleted
+
+		if len(ids) < logRetentionBatchSize {
+			return nil
+		}
+	}
+}
+
+// writeArchiveFile compresses data to path, via a temporary file so a partial archive is never
+// left under the final name, and writes its checksum to path.sha256
+func writeArchiveFile(path string, data []byte) error {
+	compressed, err := compressData(data)
+	if err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, compressed, 0o640); err != nil {
+		return fmt.Errorf("failed to write archive %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write archive %s: %w", path, err)
+	}
+
+	checksum := calculateChecksum(compressed) + "  " + filepath.Base(path) + "\n"
+	if err := os.WriteFile(path+".sha256", []byte(checksum), 0o640); err != nil {
+		return fmt.Errorf("failed to write archive checksum %s: %w", path, err)
+	}
+	return nil
+}
+
+// LogRetentionHandler exposes log retention configuration and manual enforcement
+type LogRetentionHandler struct {
+	manager *LogRetentionManager
+}
+
+// NewLogRetentionHandler creates a new log retention handler
+func NewLogRetentionHandler(manager *LogRetentionManager) *LogRetentionHandler {
+	return &LogRetentionHandler{manager: manager}
+}
+
+// GetLogRetention returns the deployment's log retention configuration and last run
+func (h *LogRetentionHandler) GetLogRetention(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.Status())
+}
+
+// ApplyLogRetention enforces log retention immediately, or with ?dry_run=true reports what
+// would expire
+func (h *LogRetentionHandler) ApplyLogRetention(c *gin.Context) {
+	result, err := h.manager.Apply(c.Query("dry_run") == "true")
+	if err != nil {
+		log.Errorf("Failed to apply log retention: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply log retention"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,337 @@
+// Agent Logs
+// Raw log line ingestion and search, kept apart from the structured event pipeline
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// maxLogBatchLines bounds a single log batch; larger volumes should be split
+	maxLogBatchLines = 5000
+
+	// maxLogMessageBytes bounds a single line; longer messages are truncated, not rejected
+	maxLogMessageBytes = 16 * 1024
+
+	// maxLogSourceLength bounds the source label, which is stored as LowCardinality
+	maxLogSourceLength = 64
+
+	// maxLogQueryWindow bounds the time range of a log search
+	maxLogQueryWindow = 31 * 24 * time.Hour
+
+	// defaultLogContext is the window either side of event_id when context_seconds is not set
+	defaultLogContext = 5 * time.Minute
+
+	// logQueryTimeoutSeconds caps a log search's ClickHouse execution time
+	logQueryTimeoutSeconds = 30
+)
+
+// logLevelAliases maps common spellings onto models.LogLevels
+var logLevelAliases = map[string]string{
+	"trace": "debug", "verbose": "debug",
+	"information": "info", "informational": "info",
+	"warn": "warning",
+	"err":  "error",
+	"crit": "critical", "fatal": "critical", "alert": "critical", "emerg": "critical", "emergency": "critical", "panic": "critical",
+}
+
+// LogHandler ingests raw agent log lines straight into ClickHouse and searches them. Lines
+// bypass NATS and the consumer, so log volume cannot delay structured events.
+type LogHandler struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+	limiter    *ingestRateLimiter
+}
+
+// NewLogHandler creates a log handler. linesPerSecond limits each license's ingestion rate
+// (0 disables the limit).
+func NewLogHandler(db *sql.DB, ch driver.Conn, linesPerSecond int) *LogHandler {
+	return &LogHandler{db: db, clickhouse: ch, limiter: newIngestRateLimiter(linesPerSecond)}
+}
+
+// IngestLogs accepts a batch of raw log lines from a registered agent
+func (h *LogHandler) IngestLogs(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	licenseKey := c.GetHeader(LicenseKeyHeader)
+	if licenseKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": LicenseKeyHeader + " header required"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBatchBytes)
+
+	var req models.LogIngestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if len(req.Lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lines must not be empty"})
+		return
+	}
+	if len(req.Lines) > maxLogBatchLines {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d lines per batch", maxLogBatchLines)})
+		return
+	}
+
+	agent, ok := authenticateIngestAgent(c, h.db, licenseKey, req.AgentID)
+	if !ok {
+		return
+	}
+
+	if wait, ok := h.limiter.take(agent.licenseID, len(req.Lines)); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Log ingestion rate limit exceeded"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	batch, err := h.clickhouse.PrepareBatch(ctx, "INSERT INTO agent_logs (tenant_id, agent_id, hostname, timestamp, source, level, message)")
+	if err != nil {
+		log.Errorf("Failed to prepare log insert: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to store logs"})
+		return
+	}
+
+	now := time.Now().UTC()
+	response := models.IngestBatchResponse{Rejected: []models.IngestRejection{}}
+	for i, line := range req.Lines {
+		timestamp, source, level, message, err := normalizeLogLine(line, now)
+		if err != nil {
+			response.Rejected = append(response.Rejected, models.IngestRejection{Index: i, Error: err.Error()})
+			continue
+		}
+		if err := batch.Append(agent.licenseID, req.AgentID, agent.hostname, timestamp, source, level, message); err != nil {
+			response.Rejected = append(response.Rejected, models.IngestRejection{Index: i, Error: err.Error()})
+			continue
+		}
+		response.Accepted++
+	}
+
+	if response.Accepted == 0 {
+		batch.Abort()
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if err := batch.Send(); err != nil {
+		log.Errorf("Failed to store agent logs: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to store logs"})
+		return
+	}
+
+	log.Debugf("Log ingest: agent=%s accepted=%d rejected=%d", req.AgentID, response.Accepted, len(response.Rejected))
+	c.JSON(http.StatusAccepted, response)
+}
+
+// normalizeLogLine validates a submitted line and returns its stored timestamp, source, level
+// and message
+func normalizeLogLine(line models.LogLine, now time.Time) (time.Time, string, string, string, error) {
+	message := strings.TrimRight(line.Message, "\r\n")
+	if strings.TrimSpace(message) == "" {
+		return time.Time{}, "", "", "", fmt.Errorf("message must not be empty")
+	}
+	if len(message) > maxLogMessageBytes {
+		message = strings.ToValidUTF8(message[:maxLogMessageBytes], "")
+	}
+
+	source := strings.ToLower(strings.TrimSpace(line.Source))
+	if source == "" {
+		source = "agent"
+	}
+	if len(source) > maxLogSourceLength {
+		return time.Time{}, "", "", "", fmt.Errorf("source exceeds %d characters", maxLogSourceLength)
+	}
+
+	level, ok := normalizeLogLevel(line.Level)
+	if !ok {
+		return time.Time{}, "", "", "", fmt.Errorf("unknown level %q", line.Level)
+	}
+
+	timestamp := now
+	if line.Timestamp != 0 {
+		timestamp = time.UnixMilli(line.Timestamp).UTC()
+	}
+	return timestamp, source, level, message, nil
+}
+
+// normalizeLogLevel maps a level or one of its aliases onto models.LogLevels
+func normalizeLogLevel(level string) (string, bool) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "" || containsString(models.LogLevels, level) {
+		return level, true
+	}
+	if alias, ok := logLevelAliases[level]; ok {
+		return alias, true
+	}
+	return "", false
+}
+
+// QueryLogs searches a tenant's agent logs by agent, time and message text
+func (h *LogHandler) QueryLogs(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.LogQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	var start, end time.Time
+	agentIDs := req.AgentIDs
+	if req.EventID != "" {
+		// Centre the window on the event and show its agent's logs
+		var agentID string
+		var eventTime time.Time
+		err := h.clickhouse.QueryRow(ctx,
+			"SELECT agent_id, timestamp FROM telemetry_events WHERE tenant_id = ? AND event_id = ? LIMIT 1",
+			req.TenantID, req.EventID,
+		).Scan(&agentID, &eventTime)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to look up event for log context: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up event"})
+			return
+		}
+		window := defaultLogContext
+		if req.ContextSeconds > 0 {
+			window = time.Duration(req.ContextSeconds) * time.Second
+		}
+		start, end = eventTime.Add(-window), eventTime.Add(window)
+		if len(agentIDs) == 0 {
+			agentIDs = []string{agentID}
+		}
+	} else {
+		if req.StartTime == "" || req.EndTime == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_time and end_time, or event_id, required"})
+			return
+		}
+		var err error
+		if start, err = time.Parse(time.RFC3339, req.StartTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time format (use RFC3339)"})
+			return
+		}
+		if end, err = time.Parse(time.RFC3339, req.EndTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time format (use RFC3339)"})
+			return
+		}
+	}
+	if !end.After(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+		return
+	}
+	if end.Sub(start) > maxLogQueryWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("time range must not exceed %d days", int(maxLogQueryWindow.Hours()/24))})
+		return
+	}
+
+	levels := make([]string, 0, len(req.Levels))
+	for _, level := range req.Levels {
+		normalized, ok := normalizeLogLevel(level)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown level %q", level)})
+			return
+		}
+		levels = append(levels, normalized)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+	if limit > 10000 {
+		limit = 10000
+	}
+	direction := "DESC"
+	if strings.EqualFold(req.OrderDirection, "asc") {
+		direction = "ASC"
+	}
+
+	query := `
+		SELECT toString(log_id), agent_id, hostname, timestamp, received_at, source, level, message
+		FROM agent_logs
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ?`
+	args := []interface{}{req.TenantID, start, end}
+	for _, filter := range []struct {
+		column string
+		values []string
+	}{
+		{"agent_id", agentIDs},
+		{"hostname", req.Hostnames},
+		{"source", req.Sources},
+		{"level", levels},
+	} {
+		if len(filter.values) > 0 {
+			query += " AND " + filter.column + " IN ?"
+			args = append(args, filter.values)
+		}
+	}
+	if text := strings.TrimSpace(req.Text); text != "" {
+		// Matches lower(message) so the ngram index on it can skip granules
+		query += " AND lower(message) LIKE ?"
+		args = append(args, likePattern(strings.ToLower(text)))
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp %s LIMIT ?", direction)
+	args = append(args, limit+1)
+
+	queryStart := time.Now()
+	rows, err := h.clickhouse.Query(queryContext(ctx, QueryGuardrails{MaxExecutionSeconds: logQueryTimeoutSeconds}), query, args...)
+	if err != nil {
+		log.Errorf("Failed to query agent logs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query logs"})
+		return
+	}
+	defer rows.Close()
+
+	logs := []models.AgentLog{}
+	for rows.Next() {
+		var l models.AgentLog
+		if err := rows.Scan(&l.LogID, &l.AgentID, &l.Hostname, &l.Timestamp, &l.ReceivedAt, &l.Source, &l.Level, &l.Message); err != nil {
+			log.Errorf("Failed to scan agent log: %v", err)
+			continue
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorf("Failed to read agent logs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query logs"})
+		return
+	}
+
+	truncated := len(logs) > limit
+	if truncated {
+		logs = logs[:limit]
+	}
+
+	c.JSON(http.StatusOK, models.LogQueryResponse{
+		Logs:        logs,
+		Count:       len(logs),
+		Truncated:   truncated,
+		StartTime:   start,
+		EndTime:     end,
+		QueryTimeMs: time.Since(queryStart).Milliseconds(),
+	})
+}
@@ -0,0 +1,394 @@
+// MITRE ATT&CK Detection Posture
+// Maps alert rules and downloaded community rules to the techniques they detect, and combines that
+// capability with the techniques observed in telemetry
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// GetMITRERuleCoverage returns the techniques the license's rules are designed to detect,
+// regardless of whether matching activity was ever seen
+func (h *TelemetryHandler) GetMITRERuleCoverage(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	posture, err := h.mitrePosture(c.Request.Context(), licenseID, false)
+	if err != nil {
+		log.Errorf("Failed to compute MITRE rule coverage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute rule coverage"})
+		return
+	}
+	c.JSON(http.StatusOK, posture)
+}
+
+// GetMITREPosture combines rule coverage ("what can we detect") with observed coverage
+// ("what have we seen"). ?status= limits techniques to one posture status, e.g. gap.
+func (h *TelemetryHandler) GetMITREPosture(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.PostureCovered, models.PostureDetectable, models.PostureObservedOnly, models.PostureGap:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of: covered, detectable, observed_only, gap"})
+		return
+	}
+
+	posture, err := h.mitrePosture(c.Request.Context(), licenseID, true)
+	if err != nil {
+		log.Errorf("Failed to compute MITRE posture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute posture"})
+		return
+	}
+
+	if status != "" {
+		filtered := make([]models.TechniquePosture, 0)
+		for _, technique := range posture.Techniques {
+			if technique.Status == status {
+				filtered = append(filtered, technique)
+			}
+		}
+		posture.Techniques = filtered
+	}
+	c.JSON(http.StatusOK, posture)
+}
+
+// mitreTechniqueRef is a technique from the ATT&CK tables
+type mitreTechniqueRef struct {
+	name      string
+	tacticIDs []string
+	parentID  string
+}
+
+// mitrePosture builds the posture of a license over the live top-level techniques
+func (h *TelemetryHandler) mitrePosture(ctx context.Context, licenseID string, includeObserved bool) (models.MITREPosture, error) {
+	posture := models.MITREPosture{
+		LicenseID:        licenseID,
+		IncludesObserved: includeObserved,
+		Tactics:          []models.TacticPosture{},
+		Techniques:       []models.TechniquePosture{},
+		GeneratedAt:      time.Now().UTC(),
+	}
+
+	catalog, err := h.mitreTechniqueCatalog(ctx)
+	if err != nil {
+		return posture, err
+	}
+
+	byID := make(map[string]*models.TechniquePosture)
+	for id, ref := range catalog {
+		if ref.parentID != "" {
+			continue
+		}
+		byID[id] = &models.TechniquePosture{
+			TechniqueID: id,
+			Name:        ref.name,
+			TacticIDs:   ref.tacticIDs,
+			Rules:       []models.CoveringRule{},
+		}
+	}
+
+	// resolve maps a technique or sub-technique ID to its top-level posture entry
+	resolve := func(techniqueID string) *models.TechniquePosture {
+		top := techniqueID
+		if dot := strings.Index(techniqueID, "."); dot > 0 {
+			top = techniqueID[:dot]
+		}
+		entry, ok := byID[top]
+		if !ok {
+			return nil
+		}
+		if top != techniqueID && !containsString(entry.SubTechniques, techniqueID) {
+			entry.SubTechniques = append(entry.SubTechniques, techniqueID)
+		}
+		return entry
+	}
+
+	rules, err := h.coveringRules(ctx, licenseID)
+	if err != nil {
+		return posture, err
+	}
+	unknown := make(map[string]bool)
+	for _, rule := range rules {
+		posture.RulesEvaluated++
+		if len(rule.techniques) == 0 {
+			posture.UnmappedRules++
+			continue
+		}
+		for _, techniqueID := range rule.techniques {
+			entry := resolve(techniqueID)
+			if entry == nil {
+				unknown[techniqueID] = true
+				continue
+			}
+			if !coveringRuleListed(entry.Rules, rule.CoveringRule) {
+				entry.Rules = append(entry.Rules, rule.CoveringRule)
+			}
+		}
+	}
+	for techniqueID := range unknown {
+		posture.UnknownTechniques = append(posture.UnknownTechniques, techniqueID)
+	}
+	sort.Strings(posture.UnknownTechniques)
+
+	if includeObserved {
+		rows, err := h.clickhouse.Query(ctx, `
+			SELECT mitre_technique, count() AS cnt, max(timestamp) AS last_seen
+			FROM telemetry_events
+			WHERE tenant_id = ? AND mitre_technique != ''
+			GROUP BY mitre_technique
+		`, licenseID)
+		if err != nil {
+			return posture, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var techniqueID string
+			var count uint64
+			var lastSeen time.Time
+			if err := rows.Scan(&techniqueID, &count, &lastSeen); err != nil {
+				return posture, err
+			}
+			entry := resolve(techniqueID)
+			if entry == nil {
+				continue
+			}
+			entry.EventCount += int64(count)
+			if entry.LastSeen == nil || lastSeen.After(*entry.LastSeen) {
+				seen := lastSeen
+				entry.LastSeen = &seen
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return posture, err
+		}
+	}
+
+	for _, entry := range byID {
+		detectable, observed := len(entry.Rules) > 0, entry.EventCount > 0
+		switch {
+		case detectable && observed:
+			entry.Status = models.PostureCovered
+			posture.CoveredCount++
+		case detectable:
+			entry.Status = models.PostureDetectable
+		case observed:
+			entry.Status = models.PostureObservedOnly
+			posture.ObservedOnlyCount++
+		default:
+			entry.Status = models.PostureGap
+		}
+		if detectable {
+			posture.DetectableCount++
+		}
+		if observed {
+			posture.ObservedCount++
+		}
+		sort.Strings(entry.SubTechniques)
+		posture.Techniques = append(posture.Techniques, *entry)
+	}
+	sort.Slice(posture.Techniques, func(i, j int) bool {
+		return posture.Techniques[i].TechniqueID < posture.Techniques[j].TechniqueID
+	})
+
+	posture.TotalTechniques = len(posture.Techniques)
+	posture.DetectablePercent = percentOf(posture.DetectableCount, posture.TotalTechniques)
+	posture.ObservedPercent = percentOf(posture.ObservedCount, posture.TotalTechniques)
+
+	posture.Tactics, err = h.tacticPosture(ctx, posture.Techniques)
+	return posture, err
+}
+
+// mitreTechniqueCatalog loads the live techniques and sub-techniques
+func (h *TelemetryHandler) mitreTechniqueCatalog(ctx context.Context) (map[string]mitreTechniqueRef, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT technique_id, name, COALESCE(tactic_ids, '{}'), COALESCE(tactic_id, ''), COALESCE(parent_technique_id, '')
+		FROM mitre_techniques
+		WHERE NOT deprecated
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	catalog := make(map[string]mitreTechniqueRef)
+	for rows.Next() {
+		var id, primaryTactic string
+		var ref mitreTechniqueRef
+		if err := rows.Scan(&id, &ref.name, pq.Array(&ref.tacticIDs), &primaryTactic, &ref.parentID); err != nil {
+			return nil, err
+		}
+		if len(ref.tacticIDs) == 0 && primaryTactic != "" {
+			ref.tacticIDs = []string{primaryTactic}
+		}
+		if ref.tacticIDs == nil {
+			ref.tacticIDs = []string{}
+		}
+		catalog[id] = ref
+	}
+	return catalog, rows.Err()
+}
+
+// mappedRule is a rule with the techniques it names
+type mappedRule struct {
+	models.CoveringRule
+	techniques []string
+}
+
+// coveringRules loads the license's enabled alert rules and downloaded community rules. Alert
+// rules name techniques in mitre_techniques, or in their condition's mitre_technique filter.
+func (h *TelemetryHandler) coveringRules(ctx context.Context, licenseID string) ([]mappedRule, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(severity, ''), COALESCE(mitre_techniques, '{}'), condition
+		FROM alert_rules
+		WHERE license_id = $1 AND enabled = TRUE
+	`, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []mappedRule
+	for rows.Next() {
+		rule := mappedRule{CoveringRule: models.CoveringRule{Source: models.CoveringRuleAlert}}
+		var conditionJSON []byte
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Severity, pq.Array(&rule.techniques), &conditionJSON); err != nil {
+			return nil, err
+		}
+		var condition map[string]interface{}
+		if json.Unmarshal(conditionJSON, &condition) == nil {
+			for _, techniqueID := range conditionTechniques(condition) {
+				if !containsString(rule.techniques, techniqueID) {
+					rule.techniques = append(rule.techniques, techniqueID)
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	communityRows, err := h.db.QueryContext(ctx, `
+		SELECT DISTINCT sr.id, sr.name, COALESCE(sr.rule_type, ''), COALESCE(sr.mitre_techniques, '{}')
+		FROM shared_rules sr
+		JOIN rule_downloads rd ON rd.rule_id = sr.id
+		WHERE rd.license_id = $1
+	`, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer communityRows.Close()
+
+	for communityRows.Next() {
+		rule := mappedRule{CoveringRule: models.CoveringRule{Source: models.CoveringRuleCommunity}}
+		if err := communityRows.Scan(&rule.ID, &rule.Name, &rule.RuleType, pq.Array(&rule.techniques)); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, communityRows.Err()
+}
+
+// conditionTechniques returns the technique IDs a rule condition filters on
+func conditionTechniques(condition map[string]interface{}) []string {
+	var techniques []string
+	for _, key := range []string{"mitre_technique", "mitre_techniques"} {
+		switch value := condition[key].(type) {
+		case string:
+			if mitreTechniquePattern.MatchString(value) {
+				techniques = append(techniques, value)
+			}
+		case []interface{}:
+			for _, item := range value {
+				if id, ok := item.(string); ok && mitreTechniquePattern.MatchString(id) {
+					techniques = append(techniques, id)
+				}
+			}
+		}
+	}
+	return techniques
+}
+
+func coveringRuleListed(rules []models.CoveringRule, rule models.CoveringRule) bool {
+	for _, listed := range rules {
+		if listed.ID == rule.ID && listed.Source == rule.Source {
+			return true
+		}
+	}
+	return false
+}
+
+// tacticPosture summarizes technique posture per tactic, in tactic ID order
+func (h *TelemetryHandler) tacticPosture(ctx context.Context, techniques []models.TechniquePosture) ([]models.TacticPosture, error) {
+	rows, err := h.db.QueryContext(ctx, `SELECT tactic_id, name FROM mitre_tactics WHERE NOT deprecated ORDER BY tactic_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tactics := []models.TacticPosture{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var tactic models.TacticPosture
+		if err := rows.Scan(&tactic.TacticID, &tactic.TacticName); err != nil {
+			return nil, err
+		}
+		index[tactic.TacticID] = len(tactics)
+		tactics = append(tactics, tactic)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, technique := range techniques {
+		for _, tacticID := range technique.TacticIDs {
+			i, ok := index[tacticID]
+			if !ok {
+				continue
+			}
+			tactics[i].TotalTechniques++
+			if len(technique.Rules) > 0 {
+				tactics[i].DetectableCount++
+			}
+			if technique.EventCount > 0 {
+				tactics[i].ObservedCount++
+			}
+		}
+	}
+	for i := range tactics {
+		tactics[i].DetectablePercent = percentOf(tactics[i].DetectableCount, tactics[i].TotalTechniques)
+		tactics[i].ObservedPercent = percentOf(tactics[i].ObservedCount, tactics[i].TotalTechniques)
+	}
+	return tactics, nil
+}
+
+func percentOf(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
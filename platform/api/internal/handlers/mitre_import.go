@@ -0,0 +1,409 @@
+// MITRE ATT&CK Import
+// Loads tactics, techniques and sub-techniques from MITRE's official ATT&CK STIX 2.1 bundles
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// defaultMITREBundleURL is MITRE's attack-stix-data repository; %s is the domain
+	defaultMITREBundleURL = "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/%s-attack/%s-attack.json"
+	maxMITREBundleBytes   = 256 << 20 // The enterprise bundle is around 50MB
+	mitreImportTimeout    = 5 * time.Minute
+)
+
+// MITREHandler imports ATT&CK data into the mitre_tactics and mitre_techniques tables
+type MITREHandler struct {
+	db        *sql.DB
+	client    *http.Client
+	bundleURL string // Format string with the domain twice; MITRE_ATTACK_URL overrides it for mirrors
+}
+
+// NewMITREHandler creates a new MITRE ATT&CK handler
+func NewMITREHandler(db *sql.DB) *MITREHandler {
+	bundleURL := defaultMITREBundleURL
+	if url := os.Getenv("MITRE_ATTACK_URL"); url != "" {
+		bundleURL = url
+	}
+	return &MITREHandler{
+		db:        db,
+		client:    &http.Client{Timeout: mitreImportTimeout},
+		bundleURL: bundleURL,
+	}
+}
+
+// stixObject holds the fields of the STIX objects the importer reads: tactics, techniques,
+// data components and sources, detection relationships and the collection
+type stixObject struct {
+	Type               string    `json:"type"`
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	Modified           time.Time `json:"modified"`
+	Revoked            bool      `json:"revoked"`
+	Deprecated         bool      `json:"x_mitre_deprecated"`
+	ExternalReferences []struct {
+		SourceName string `json:"source_name"`
+		ExternalID string `json:"external_id"`
+		URL        string `json:"url"`
+	} `json:"external_references"`
+	KillChainPhases []struct {
+		KillChainName string `json:"kill_chain_name"`
+		PhaseName     string `json:"phase_name"`
+	} `json:"kill_chain_phases"`
+	Platforms        []string `json:"x_mitre_platforms"`
+	DataSources      []string `json:"x_mitre_data_sources"`
+	IsSubtechnique   bool     `json:"x_mitre_is_subtechnique"`
+	Shortname        string   `json:"x_mitre_shortname"`
+	Version          string   `json:"x_mitre_version"`
+	DataSourceRef    string   `json:"x_mitre_data_source_ref"`
+	RelationshipType string   `json:"relationship_type"`
+	SourceRef        string   `json:"source_ref"`
+	TargetRef        string   `json:"target_ref"`
+}
+
+// attackID returns the ATT&CK ID (TA0001, T1059.001) and page URL of an object
+func (o stixObject) attackID() (string, string) {
+	for _, ref := range o.ExternalReferences {
+		if strings.HasPrefix(ref.SourceName, "mitre-") && ref.ExternalID != "" {
+			return ref.ExternalID, ref.URL
+		}
+	}
+	return "", ""
+}
+
+func (o stixObject) retired() bool {
+	return o.Revoked || o.Deprecated
+}
+
+// ImportATTACK fetches an ATT&CK STIX bundle and upserts its tactics and techniques. A bundle
+// may also be uploaded as the multipart file "bundle" for deployments without internet access.
+func (h *MITREHandler) ImportATTACK(c *gin.Context) {
+	var req models.MITREImportRequest
+	var bundle io.Reader
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+		upload, err := c.FormFile("bundle")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bundle file required"})
+			return
+		}
+		file, err := upload.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read bundle"})
+			return
+		}
+		defer file.Close()
+		bundle = file
+		req.URL = "upload:" + upload.Filename
+	} else if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	var result models.MITREImport
+	var err error
+	if bundle != nil {
+		result, err = h.importBundle(c.Request.Context(), bundle, req)
+	} else {
+		result, err = h.Import(c.Request.Context(), req)
+	}
+	if err != nil {
+		log.Errorf("Failed to import MITRE ATT&CK data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import ATT&CK data", "details": err.Error()})
+		return
+	}
+
+	log.Infof("Imported MITRE ATT&CK %s %s: %d tactics, %d techniques, %d sub-techniques (%d new, %d updated)",
+		result.Domain, result.ATTACKVersion, result.Tactics, result.Techniques, result.SubTechniques, result.Inserted, result.Updated)
+	c.JSON(http.StatusOK, result)
+}
+
+// ListMITREImports returns the most recent ATT&CK imports
+func (h *MITREHandler) ListMITREImports(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT id, domain, COALESCE(attack_version, ''), source_url, tactics, techniques, subtechniques,
+		       inserted, updated, deprecated, COALESCE(imported_by, ''), imported_at
+		FROM mitre_imports
+		ORDER BY imported_at DESC
+		LIMIT 50
+	`)
+	if err != nil {
+		log.Errorf("Failed to list MITRE imports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list imports"})
+		return
+	}
+	defer rows.Close()
+
+	imports := []models.MITREImport{}
+	for rows.Next() {
+		var imp models.MITREImport
+		if err := rows.Scan(&imp.ID, &imp.Domain, &imp.ATTACKVersion, &imp.SourceURL, &imp.Tactics, &imp.Techniques,
+			&imp.SubTechniques, &imp.Inserted, &imp.Updated, &imp.Deprecated, &imp.ImportedBy, &imp.ImportedAt); err != nil {
+			log.Errorf("Failed to scan MITRE import: %v", err)
+			continue
+		}
+		imports = append(imports, imp)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": imports, "count": len(imports)})
+}
+
+// Import downloads the bundle of req.Domain, or req.URL when set, and imports it
+func (h *MITREHandler) Import(ctx context.Context, req models.MITREImportRequest) (models.MITREImport, error) {
+	if req.Domain == "" {
+		req.Domain = models.MITREDomainEnterprise
+	}
+	if req.URL == "" {
+		req.URL = fmt.Sprintf(h.bundleURL, req.Domain, req.Domain)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mitreImportTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return models.MITREImport{}, err
+	}
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		return models.MITREImport{}, fmt.Errorf("failed to download bundle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.MITREImport{}, fmt.Errorf("bundle download returned status %d", resp.StatusCode)
+	}
+
+	return h.importBundle(ctx, resp.Body, req)
+}
+
+// importBundle parses a STIX bundle and upserts it in one transaction, so a failed import
+// leaves the previous ATT&CK data in place
+func (h *MITREHandler) importBundle(ctx context.Context, r io.Reader, req models.MITREImportRequest) (models.MITREImport, error) {
+	if req.Domain == "" {
+		req.Domain = models.MITREDomainEnterprise
+	}
+
+	var bundle struct {
+		Type    string       `json:"type"`
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r, maxMITREBundleBytes)).Decode(&bundle); err != nil {
+		return models.MITREImport{}, fmt.Errorf("invalid STIX bundle: %w", err)
+	}
+	if bundle.Type != "bundle" {
+		return models.MITREImport{}, fmt.Errorf("expected a STIX bundle, got type %q", bundle.Type)
+	}
+
+	result := models.MITREImport{Domain: req.Domain, SourceURL: req.URL, ImportedBy: req.ImportedBy}
+	tactics, techniques := latestByAttackID(bundle.Objects, "x-mitre-tactic"), latestByAttackID(bundle.Objects, "attack-pattern")
+	if len(tactics) == 0 || len(techniques) == 0 {
+		return result, fmt.Errorf("bundle has %d tactics and %d techniques", len(tactics), len(techniques))
+	}
+	for _, obj := range bundle.Objects {
+		if obj.Type == "x-mitre-collection" {
+			result.ATTACKVersion = obj.Version
+		}
+	}
+	detections := detectionDataSources(bundle.Objects)
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	// Techniques name tactics by kill chain phase, e.g. initial-access
+	tacticByPhase := make(map[string]string)
+	for _, tactic := range tactics {
+		tacticID, url := tactic.attackID()
+		tacticByPhase[tactic.Shortname] = tacticID
+
+		var inserted bool
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO mitre_tactics (tactic_id, name, description, url, shortname, stix_id, attack_version, deprecated, modified_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (tactic_id) DO UPDATE SET
+				name = EXCLUDED.name, description = EXCLUDED.description, url = EXCLUDED.url,
+				shortname = EXCLUDED.shortname, stix_id = EXCLUDED.stix_id, attack_version = EXCLUDED.attack_version,
+				deprecated = EXCLUDED.deprecated, modified_at = EXCLUDED.modified_at, updated_at = NOW()
+			RETURNING (xmax = 0)
+		`, tacticID, tactic.Name, tactic.Description, url, tactic.Shortname, tactic.ID, result.ATTACKVersion,
+			tactic.retired(), tactic.Modified).Scan(&inserted)
+		if err != nil {
+			return result, fmt.Errorf("failed to upsert tactic %s: %w", tacticID, err)
+		}
+		result.Tactics++
+		countMITREUpsert(&result, inserted, tactic.retired())
+	}
+
+	for _, technique := range techniques {
+		techniqueID, url := technique.attackID()
+
+		tacticIDs := []string{}
+		for _, phase := range technique.KillChainPhases {
+			if tacticID, ok := tacticByPhase[phase.PhaseName]; ok && !containsString(tacticIDs, tacticID) {
+				tacticIDs = append(tacticIDs, tacticID)
+			}
+		}
+		var primaryTactic, parentID sql.NullString
+		if len(tacticIDs) > 0 {
+			primaryTactic = sql.NullString{String: tacticIDs[0], Valid: true}
+		}
+		if technique.IsSubtechnique {
+			if dot := strings.Index(techniqueID, "."); dot > 0 {
+				parentID = sql.NullString{String: techniqueID[:dot], Valid: true}
+			}
+		}
+
+		dataSources := technique.DataSources
+		if len(dataSources) == 0 {
+			dataSources = detections[technique.ID]
+		}
+		if dataSources == nil {
+			dataSources = []string{}
+		}
+		platforms := technique.Platforms
+		if platforms == nil {
+			platforms = []string{}
+		}
+
+		var inserted bool
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO mitre_techniques (
+				technique_id, tactic_id, name, description, platforms, data_sources, url, tactic_ids,
+				parent_technique_id, is_subtechnique, stix_id, attack_version, deprecated, modified_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			ON CONFLICT (technique_id) DO UPDATE SET
+				tactic_id = EXCLUDED.tactic_id, name = EXCLUDED.name, description = EXCLUDED.description,
+				platforms = EXCLUDED.platforms, data_sources = EXCLUDED.data_sources, url = EXCLUDED.url,
+				tactic_ids = EXCLUDED.tactic_ids, parent_technique_id = EXCLUDED.parent_technique_id,
+				is_subtechnique = EXCLUDED.is_subtechnique, stix_id = EXCLUDED.stix_id,
+				attack_version = EXCLUDED.attack_version, deprecated = EXCLUDED.deprecated,
+				modified_at = EXCLUDED.modified_at, updated_at = NOW()
+			RETURNING (xmax = 0)
+		`, techniqueID, primaryTactic, technique.Name, technique.Description, pq.Array(platforms), pq.Array(dataSources),
+			url, pq.Array(tacticIDs), parentID, technique.IsSubtechnique, technique.ID, result.ATTACKVersion,
+			technique.retired(), technique.Modified).Scan(&inserted)
+		if err != nil {
+			return result, fmt.Errorf("failed to upsert technique %s: %w", techniqueID, err)
+		}
+		if technique.IsSubtechnique {
+			result.SubTechniques++
+		} else {
+			result.Techniques++
+		}
+		countMITREUpsert(&result, inserted, technique.retired())
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO mitre_imports (domain, attack_version, source_url, tactics, techniques, subtechniques, inserted, updated, deprecated, imported_by)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
+		RETURNING id, imported_at
+	`, result.Domain, result.ATTACKVersion, result.SourceURL, result.Tactics, result.Techniques, result.SubTechniques,
+		result.Inserted, result.Updated, result.Deprecated, result.ImportedBy).Scan(&result.ID, &result.ImportedAt)
+	if err != nil {
+		return result, fmt.Errorf("failed to record import: %w", err)
+	}
+
+	return result, tx.Commit()
+}
+
+func countMITREUpsert(result *models.MITREImport, inserted, retired bool) {
+	if inserted {
+		result.Inserted++
+	} else {
+		result.Updated++
+	}
+	if retired {
+		result.Deprecated++
+	}
+}
+
+// latestByAttackID returns the objects of a STIX type with an ATT&CK ID, one per ID. Where a
+// revoked object shares an ID with its replacement, the live one wins, then the newest.
+func latestByAttackID(objects []stixObject, stixType string) []stixObject {
+	byID := make(map[string]stixObject)
+	for _, obj := range objects {
+		if obj.Type != stixType {
+			continue
+		}
+		id, _ := obj.attackID()
+		if id == "" {
+			continue
+		}
+		current, ok := byID[id]
+		if !ok || (current.retired() && !obj.retired()) ||
+			(current.retired() == obj.retired() && obj.Modified.After(current.Modified)) {
+			byID[id] = obj
+		}
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	// Parents sort before their sub-techniques
+	sort.Strings(ids)
+	result := make([]stixObject, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, byID[id])
+	}
+	return result
+}
+
+// detectionDataSources maps technique STIX IDs to "Data Source: Component" names from detects
+// relationships. Newer bundles describe data sources only this way.
+func detectionDataSources(objects []stixObject) map[string][]string {
+	sourceNames := make(map[string]string)
+	components := make(map[string]stixObject)
+	for _, obj := range objects {
+		switch obj.Type {
+		case "x-mitre-data-source":
+			sourceNames[obj.ID] = obj.Name
+		case "x-mitre-data-component":
+			components[obj.ID] = obj
+		}
+	}
+
+	detections := make(map[string][]string)
+	for _, obj := range objects {
+		if obj.Type != "relationship" || obj.RelationshipType != "detects" || obj.retired() {
+			continue
+		}
+		component, ok := components[obj.SourceRef]
+		if !ok || component.retired() {
+			continue
+		}
+		name := component.Name
+		if source := sourceNames[component.DataSourceRef]; source != "" {
+			name = source + ": " + component.Name
+		}
+		if !containsString(detections[obj.TargetRef], name) {
+			detections[obj.TargetRef] = append(detections[obj.TargetRef], name)
+		}
+	}
+	for _, names := range detections {
+		sort.Strings(names)
+	}
+	return detections
+}
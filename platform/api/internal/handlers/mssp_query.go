@@ -0,0 +1,329 @@
+// Cross-Tenant Telemetry Query
+// Combined event views across the child licenses an MSSP or parent organization manages
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// crossTenantOrderColumns are the columns a cross-tenant query may be ordered by
+var crossTenantOrderColumns = map[string]bool{"timestamp": true, "severity": true, "hostname": true}
+
+// QueryEventsAcrossTenants queries events across the child licenses of the license in
+// tenant_id and breaks the matches down per tenant. Only licenses whose parent_license_id is
+// the caller's license can be included, and every child queried gets a data access log entry.
+func (h *TelemetryHandler) QueryEventsAcrossTenants(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.CrossTenantQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if _, err := uuid.Parse(req.TenantID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"tenant_id": "must be a license ID"}})
+		return
+	}
+	if len(req.CustomFields) > 0 {
+		// Custom field columns are defined per tenant, so one filter cannot span tenants
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"custom_fields": "cannot be used across tenants"}})
+		return
+	}
+
+	startTime, endTime, err := parseQueryRange(req.QueryEventsRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.OrderBy = strings.ToLower(req.OrderBy)
+	if req.OrderBy == "" {
+		req.OrderBy = "timestamp"
+	}
+	if !crossTenantOrderColumns[req.OrderBy] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"order_by": "must be timestamp, severity or hostname"}})
+		return
+	}
+	req.OrderDirection = strings.ToUpper(req.OrderDirection)
+	if req.OrderDirection == "" {
+		req.OrderDirection = "DESC"
+	}
+	if req.OrderDirection != "ASC" && req.OrderDirection != "DESC" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"order_direction": "must be asc or desc"}})
+		return
+	}
+
+	tenants, names, err := h.crossTenantScope(req.TenantID, req.TenantIDs)
+	if err != nil {
+		log.Errorf("Failed to load child licenses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load child licenses"})
+		return
+	}
+	if denied := unmanagedTenants(req.TenantIDs, names); len(denied) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "License does not manage these tenants", "tenant_ids": denied})
+		return
+	}
+	if len(tenants) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "License does not manage any child licenses"})
+		return
+	}
+
+	guardrails := h.guardrailsFor(req.TenantID)
+	if req.Limit == 0 {
+		req.Limit = 100
+	}
+	if req.Limit > 10000 {
+		req.Limit = 10000
+	}
+	req.Limit = guardrails.clampLimit(req.Limit)
+
+	queryStart := time.Now()
+
+	// Anchored on tenant_id and the timestamp range like single-tenant queries, so every
+	// child's partitions and primary key granules are pruned the same way
+	placeholders := make([]string, len(tenants))
+	args := make([]interface{}, 0, len(tenants)+2)
+	for i, tenantID := range tenants {
+		placeholders[i] = "?"
+		args = append(args, tenantID)
+	}
+	where := "tenant_id IN (" + strings.Join(placeholders, ",") + ") AND timestamp >= ? AND timestamp <= ?"
+	args = append(args, startTime, endTime)
+	filters, filterArgs := eventQueryFilters(req.QueryEventsRequest)
+	where += filters
+	args = append(args, filterArgs...)
+
+	ctx := queryContext(c.Request.Context(), guardrails)
+	query := "SELECT " + telemetryEventColumns + " FROM telemetry_events WHERE " + where
+	estimate, ok := h.checkQueryCost(ctx, c, guardrails, query, args, startTime, endTime, req.Confirm)
+	if !ok {
+		return
+	}
+
+	query += " ORDER BY " + req.OrderBy + " " + req.OrderDirection + " LIMIT ? OFFSET ?"
+	rows, err := h.clickhouse.Query(ctx, query, append(args, req.Limit, req.Offset)...)
+	if err != nil {
+		if queryLimitError(c, err, guardrails) {
+			return
+		}
+		log.Errorf("Failed to query events across tenants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+	defer rows.Close()
+
+	events := make([]models.TelemetryEvent, 0)
+	for rows.Next() {
+		event, err := scanTelemetryEvent(rows)
+		if err != nil {
+			log.Warnf("Failed to scan event: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		if queryLimitError(c, err, guardrails) {
+			return
+		}
+		log.Errorf("Failed to query events across tenants: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+
+	breakdown, total, err := h.tenantBreakdown(ctx, where, args, tenants, names)
+	if err != nil {
+		if queryLimitError(c, err, guardrails) {
+			return
+		}
+		log.Errorf("Failed to break down events by tenant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+
+	h.logCrossTenantAccess(c, req, tenants, startTime, endTime)
+
+	c.JSON(http.StatusOK, models.CrossTenantQueryResponse{
+		Events:      events,
+		Tenants:     breakdown,
+		Total:       total,
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+		QueryTimeMs: time.Since(queryStart).Milliseconds(),
+		Estimate:    estimate,
+	})
+}
+
+// crossTenantScope returns the tenants a parent license may query, with their display names.
+// requested narrows the result to those IDs; the parent may include itself.
+func (h *TelemetryHandler) crossTenantScope(parentID string, requested []string) ([]string, map[string]string, error) {
+	rows, err := h.db.Query(`
+		SELECT id, COALESCE(NULLIF(company_name, ''), customer_name)
+		FROM licenses
+		WHERE (parent_license_id = $1 OR id = $1) AND is_active = true
+	`, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, nil, err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	tenants := make([]string, 0, len(names))
+	if len(requested) > 0 {
+		for _, id := range uniqueStrings(requested) {
+			if _, ok := names[id]; ok {
+				tenants = append(tenants, id)
+			}
+		}
+		return tenants, names, nil
+	}
+
+	// By default the view covers the children only; the parent's own telemetry is one
+	// tenant_ids entry away
+	for id := range names {
+		if id != parentID {
+			tenants = append(tenants, id)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, names, nil
+}
+
+// unmanagedTenants returns the requested tenant IDs that are not in the caller's scope
+func unmanagedTenants(requested []string, names map[string]string) []string {
+	denied := []string{}
+	for _, id := range uniqueStrings(requested) {
+		if _, ok := names[id]; !ok {
+			denied = append(denied, id)
+		}
+	}
+	return denied
+}
+
+// tenantBreakdown totals the events matching a cross-tenant query per tenant. Tenants without
+// matches are listed with zero counts.
+func (h *TelemetryHandler) tenantBreakdown(ctx context.Context, where string, args []interface{}, tenants []string, names map[string]string) ([]models.TenantEventBreakdown, int64, error) {
+	byTenant := make(map[string]*models.TenantEventBreakdown, len(tenants))
+	for _, tenantID := range tenants {
+		byTenant[tenantID] = &models.TenantEventBreakdown{
+			TenantID:         tenantID,
+			Name:             names[tenantID],
+			EventsBySeverity: map[uint8]int64{},
+		}
+	}
+
+	rows, err := h.clickhouse.Query(ctx, `
+		SELECT tenant_id, severity, toInt64(count())
+		FROM telemetry_events
+		WHERE `+where+`
+		GROUP BY tenant_id, severity`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	for rows.Next() {
+		var tenantID string
+		var severity uint8
+		var count int64
+		if err := rows.Scan(&tenantID, &severity, &count); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if tenant, ok := byTenant[tenantID]; ok {
+			tenant.EventsBySeverity[severity] = count
+			tenant.EventCount += count
+			total += count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err = h.clickhouse.Query(ctx, `
+		SELECT tenant_id, toInt64(uniq(agent_id)), toInt64(uniq(hostname))
+		FROM telemetry_events
+		WHERE `+where+`
+		GROUP BY tenant_id`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tenantID string
+		var agents, hosts int64
+		if err := rows.Scan(&tenantID, &agents, &hosts); err != nil {
+			return nil, 0, err
+		}
+		if tenant, ok := byTenant[tenantID]; ok {
+			tenant.UniqueAgents = agents
+			tenant.UniqueHosts = hosts
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	breakdown := make([]models.TenantEventBreakdown, 0, len(byTenant))
+	for _, tenant := range byTenant {
+		breakdown = append(breakdown, *tenant)
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].EventCount != breakdown[j].EventCount {
+			return breakdown[i].EventCount > breakdown[j].EventCount
+		}
+		return breakdown[i].Name < breakdown[j].Name
+	})
+	return breakdown, total, nil
+}
+
+// logCrossTenantAccess records the query in each child license's data access log, so a
+// child can see when and by whom its telemetry was read through its parent
+func (h *TelemetryHandler) logCrossTenantAccess(c *gin.Context, req models.CrossTenantQueryRequest, tenants []string, start, end time.Time) {
+	details, _ := json.Marshal(map[string]interface{}{
+		"parent_license_id": req.TenantID,
+		"tenant_count":      len(tenants),
+		"start_time":        start,
+		"end_time":          end,
+		"search_text":       req.SearchText,
+	})
+	userID := c.GetString(middleware.ContextUserID)
+
+	for _, tenantID := range tenants {
+		if tenantID == req.TenantID {
+			continue
+		}
+		if _, err := h.db.Exec(`
+			INSERT INTO data_access_logs (license_id, user_id, action, ip_address, user_agent, query_details)
+			VALUES ($1, $2, 'cross_tenant_query', $3, $4, $5)
+		`, tenantID, nullIfEmpty(userID), nullIfEmpty(c.ClientIP()), c.Request.UserAgent(), details); err != nil {
+			log.Warnf("Failed to log cross-tenant access to %s: %v", tenantID, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Notification Circuit Breakers
+// Stops sending to failing notification channels and hands their messages to a fallback channel
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// breakerFailureThreshold consecutive failures open a channel's circuit
+	breakerFailureThreshold = 5
+
+	// breakerCooldown is how long an open circuit skips sends before one trial send is let through
+	breakerCooldown = time.Minute
+)
+
+// Circuit states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// errCircuitOpen is the delivery error while a channel's circuit is open
+var errCircuitOpen = errors.New("circuit open: channel has been failing, send skipped")
+
+// channelBreaker tracks the recent delivery results of one channel
+type channelBreaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // A half-open trial send is in flight
+}
+
+// breakerRegistry holds the breakers of every channel
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*channelBreaker
+}
+
+// notificationBreakers is shared by every NotificationHandler, since the alerting engines each
+// create their own handler but send through the same providers
+var notificationBreakers = &breakerRegistry{breakers: make(map[string]*channelBreaker)}
+
+// allow reports whether a send to the channel may go ahead. Once an open circuit has cooled down,
+// a single trial send is allowed; its result closes or reopens the circuit.
+func (r *breakerRegistry) allow(channelID string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breaker, ok := r.breakers[channelID]
+	if !ok {
+		return true
+	}
+	switch breaker.state {
+	case circuitOpen:
+		if now.Sub(breaker.openedAt) < breakerCooldown {
+			return false
+		}
+		breaker.state = circuitHalfOpen
+		breaker.trial = true
+		return true
+	case circuitHalfOpen:
+		if breaker.trial {
+			return false
+		}
+		breaker.trial = true
+		return true
+	}
+	return true
+}
+
+// record updates the channel's breaker with the result of a send
+func (r *breakerRegistry) record(channelID, channelType string, sendErr error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breaker, ok := r.breakers[channelID]
+	if sendErr == nil {
+		if ok && breaker.state != circuitClosed {
+			log.WithFields(log.Fields{"channel_id": channelID, "channel_type": channelType}).Info("Notification channel recovered, circuit closed")
+		}
+		delete(r.breakers, channelID)
+		return
+	}
+
+	if !ok {
+		breaker = &channelBreaker{state: circuitClosed}
+		r.breakers[channelID] = breaker
+	}
+	breaker.failures++
+	breaker.trial = false
+
+	if breaker.state == circuitHalfOpen || (breaker.state == circuitClosed && breaker.failures >= breakerFailureThreshold) {
+		breaker.state = circuitOpen
+		breaker.openedAt = now
+		log.WithFields(log.Fields{
+			"channel_id":   channelID,
+			"channel_type": channelType,
+			"failures":     breaker.failures,
+			"retry_in":     breakerCooldown.String(),
+		}).Warnf("Notification channel circuit opened, sends are skipped until it recovers: %v", sendErr)
+	}
+}
+
+// reset closes the channel's circuit, e.g. after a successful test send
+func (r *breakerRegistry) reset(channelID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.breakers, channelID)
+}
+
+// state returns the channel's circuit state
+func (r *breakerRegistry) state(channelID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breaker, ok := r.breakers[channelID]
+	if !ok {
+		return circuitClosed
+	}
+	return breaker.state
+}
+
+// notificationOutcome is the result of notifyChannel
+type notificationOutcome struct {
+	logID string
+	err   error // Error of the channel itself
+
+	fallbackChannelID string // Set when the fallback was tried
+	fallbackLogID     string
+	fallbackErr       error
+}
+
+// delivered reports whether the message reached the channel or its fallback
+func (o notificationOutcome) delivered() bool {
+	return o.err == nil || (o.fallbackChannelID != "" && o.fallbackErr == nil)
+}
+
+// status is the delivery status reported to callers: sent, fallback or failed
+func (o notificationOutcome) status() string {
+	switch {
+	case o.err == nil:
+		return "sent"
+	case o.delivered():
+		return "fallback"
+	}
+	return "failed"
+}
+
+// notifyChannel delivers a message through a loaded, enabled channel and logs the attempt. send
+// performs the delivery and is skipped while the channel's circuit is open. When delivery fails,
+// a message of at least the channel's fallback_min_priority goes to its fallback channel, as
+// plain text, and is logged there with fallback_from set. Fallbacks are followed one hop only.
+// allowFallback is false when the fallback channel already gets the message anyway.
+func (h *NotificationHandler) notifyChannel(channel models.NotificationChannel, send func() error, subject, message, priority string, metadata map[string]interface{}, allowFallback bool) notificationOutcome {
+	var outcome notificationOutcome
+	outcome.err = h.sendThroughBreaker(channel.ID, channel.Type, send)
+	outcome.logID = h.logNotification(channel.ID, channel.Type, subject, message, priority, metadata, outcome.err, "")
+	if outcome.err == nil || !allowFallback || channel.FallbackChannelID == nil {
+		return outcome
+	}
+	if severityRank[priority] < severityRank[channel.FallbackMinPriority] {
+		return outcome
+	}
+
+	fallbackID := *channel.FallbackChannelID
+	outcome.fallbackChannelID = fallbackID
+
+	var fallback models.NotificationChannel
+	var configJSON []byte
+	err := h.db.QueryRow(`
+		SELECT id, type, enabled, config FROM notification_channels WHERE id = $1 AND deleted_at IS NULL
+	`, fallbackID).Scan(&fallback.ID, &fallback.Type, &fallback.Enabled, &configJSON)
+	switch {
+	case err == sql.ErrNoRows:
+		outcome.fallbackErr = fmt.Errorf("fallback channel %s not found", fallbackID)
+	case err != nil:
+		outcome.fallbackErr = fmt.Errorf("failed to retrieve fallback channel: %w", err)
+	case !fallback.Enabled:
+		outcome.fallbackErr = fmt.Errorf("fallback channel %s is disabled", fallbackID)
+	}
+	if outcome.fallbackErr != nil {
+		log.Errorf("Notification via %s channel %s failed and its fallback is unusable: %v", channel.Type, channel.ID, outcome.fallbackErr)
+		return outcome
+	}
+	json.Unmarshal(configJSON, &fallback.Config)
+
+	outcome.fallbackErr = h.sendThroughBreaker(fallback.ID, fallback.Type, func() error {
+		return h.deliver(fallback, subject, message, priority, metadata)
+	})
+	outcome.fallbackLogID = h.logNotification(fallback.ID, fallback.Type, subject, message, priority, metadata, outcome.fallbackErr, channel.ID)
+
+	if outcome.fallbackErr != nil {
+		log.Errorf("Notification via %s channel %s and its %s fallback %s both failed: %v", channel.Type, channel.ID, fallback.Type, fallback.ID, outcome.fallbackErr)
+	} else {
+		log.Warnf("Notification via %s channel %s failed (%v), delivered through %s fallback %s", channel.Type, channel.ID, outcome.err, fallback.Type, fallback.ID)
+	}
+	return outcome
+}
+
+// sendThroughBreaker runs send unless the channel's circuit is open, and records the result
+func (h *NotificationHandler) sendThroughBreaker(channelID, channelType string, send func() error) error {
+	if !notificationBreakers.allow(channelID, time.Now()) {
+		return errCircuitOpen
+	}
+	err := send()
+	notificationBreakers.record(channelID, channelType, err, time.Now())
+	return err
+}
+
+// fallbackChannelExists reports whether fallbackID is a live channel of the license
+func (h *NotificationHandler) fallbackChannelExists(licenseID, fallbackID string) (bool, error) {
+	var exists bool
+	err := h.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM notification_channels WHERE id::text = $1 AND license_id::text = $2 AND deleted_at IS NULL
+		)
+	`, fallbackID, licenseID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,471 @@
+// Notification Groups and Broadcast
+// Named sets of channels, and one-call fan-out of a notification to many channels in parallel
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// maxBroadcastChannels bounds the channels one broadcast may reach
+	maxBroadcastChannels = 100
+
+	// broadcastConcurrency is how many channels a broadcast delivers to at once
+	broadcastConcurrency = 10
+)
+
+// notificationGroupQuery selects groups with their member channel IDs, matching scanNotificationGroup
+const notificationGroupQuery = `
+	SELECT g.id, g.license_id, g.name, COALESCE(g.description, ''), g.created_at, g.updated_at,
+	       COALESCE(array_agg(gc.channel_id::text ORDER BY gc.channel_id) FILTER (WHERE gc.channel_id IS NOT NULL), '{}')
+	FROM notification_groups g
+	LEFT JOIN notification_group_channels gc ON gc.group_id = g.id
+`
+
+func scanNotificationGroup(row interface{ Scan(...interface{}) error }) (*models.NotificationGroup, error) {
+	var group models.NotificationGroup
+	err := row.Scan(&group.ID, &group.LicenseID, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt,
+		pq.Array(&group.ChannelIDs))
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// ListNotificationGroups lists a license's notification groups
+func (h *NotificationHandler) ListNotificationGroups(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rows, err := h.db.Query(notificationGroupQuery+" WHERE g.license_id = $1 GROUP BY g.id ORDER BY g.name", licenseID)
+	if err != nil {
+		log.Errorf("Failed to query notification groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notification groups"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []models.NotificationGroup{}
+	for rows.Next() {
+		group, err := scanNotificationGroup(rows)
+		if err != nil {
+			log.Warnf("Failed to scan notification group: %v", err)
+			continue
+		}
+		groups = append(groups, *group)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": groups, "count": len(groups)})
+}
+
+// GetNotificationGroup retrieves a notification group
+func (h *NotificationHandler) GetNotificationGroup(c *gin.Context) {
+	group, err := scanNotificationGroup(h.db.QueryRow(
+		notificationGroupQuery+" WHERE g.id = $1 AND ($2 = '' OR g.license_id::text = $2) GROUP BY g.id",
+		c.Param("id"), principalLicense(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification group not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notification group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// CreateNotificationGroup creates a named set of a license's channels
+func (h *NotificationHandler) CreateNotificationGroup(c *gin.Context) {
+	var req models.CreateNotificationGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	channelIDs := uniqueStrings(req.ChannelIDs)
+	if missing, err := h.missingChannels(req.LicenseID, channelIDs); err != nil {
+		log.Errorf("Failed to check group channels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification group"})
+		return
+	} else if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Channels not found for this license", "channel_ids": missing})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification group"})
+		return
+	}
+	defer tx.Rollback()
+
+	group := models.NotificationGroup{
+		LicenseID:   req.LicenseID,
+		Name:        req.Name,
+		Description: req.Description,
+		ChannelIDs:  channelIDs,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO notification_groups (license_id, name, description)
+		VALUES ($1, $2, NULLIF($3, ''))
+		RETURNING id, created_at, updated_at
+	`, req.LicenseID, req.Name, req.Description).Scan(&group.ID, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "A notification group with this name already exists"})
+			return
+		}
+		log.Errorf("Failed to create notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification group"})
+		return
+	}
+
+	if err := setGroupChannels(tx, group.ID, channelIDs); err != nil {
+		log.Errorf("Failed to set notification group channels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification group"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create notification group"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// UpdateNotificationGroup renames a group or replaces its channels
+func (h *NotificationHandler) UpdateNotificationGroup(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateNotificationGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+		return
+	}
+	defer tx.Rollback()
+
+	var licenseID string
+	err = tx.QueryRow(`
+		UPDATE notification_groups
+		SET name = COALESCE($1, name), description = COALESCE($2, description), updated_at = NOW()
+		WHERE id = $3 AND ($4 = '' OR license_id::text = $4)
+		RETURNING license_id
+	`, req.Name, req.Description, id, principalLicense(c)).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification group not found"})
+		return
+	}
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "A notification group with this name already exists"})
+			return
+		}
+		log.Errorf("Failed to update notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+		return
+	}
+
+	if req.ChannelIDs != nil {
+		channelIDs := uniqueStrings(*req.ChannelIDs)
+		missing, err := h.missingChannels(licenseID, channelIDs)
+		if err != nil {
+			log.Errorf("Failed to check group channels: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+			return
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Channels not found for this license", "channel_ids": missing})
+			return
+		}
+		if _, err := tx.Exec("DELETE FROM notification_group_channels WHERE group_id = $1", id); err != nil {
+			log.Errorf("Failed to clear notification group channels: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+			return
+		}
+		if err := setGroupChannels(tx, id, channelIDs); err != nil {
+			log.Errorf("Failed to set notification group channels: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification group updated successfully"})
+}
+
+// DeleteNotificationGroup deletes a group; its channels are unaffected
+func (h *NotificationHandler) DeleteNotificationGroup(c *gin.Context) {
+	result, err := h.db.Exec(
+		"DELETE FROM notification_groups WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete notification group: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification group"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification group deleted successfully"})
+}
+
+// BroadcastNotification sends a notification to every targeted channel of a license in parallel
+// and reports the outcome per channel. Disabled channels are skipped.
+func (h *NotificationHandler) BroadcastNotification(c *gin.Context) {
+	var req models.BroadcastNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if len(req.ChannelIDs) == 0 && len(req.ChannelTypes) == 0 && len(req.Groups) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one of channel_ids, channel_types or groups is required"})
+		return
+	}
+	for _, channelType := range req.ChannelTypes {
+		if !isValidChannelType(channelType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid channel type: %s", channelType)})
+			return
+		}
+	}
+	if req.Priority == "" {
+		req.Priority = "medium"
+	}
+
+	// Resolve groups by ID or name, so a caller can target "on-call" without looking it up
+	groupIDs := []string{}
+	if len(req.Groups) > 0 {
+		rows, err := h.db.Query(`
+			SELECT id::text, name FROM notification_groups
+			WHERE license_id = $1 AND (id::text = ANY($2) OR name = ANY($2))
+		`, req.LicenseID, pq.Array(req.Groups))
+		if err != nil {
+			log.Errorf("Failed to resolve notification groups: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to broadcast notification"})
+			return
+		}
+		found := map[string]bool{}
+		for rows.Next() {
+			var id, name string
+			if err := rows.Scan(&id, &name); err != nil {
+				continue
+			}
+			groupIDs = append(groupIDs, id)
+			found[id], found[name] = true, true
+		}
+		rows.Close()
+		for _, group := range req.Groups {
+			if !found[group] {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Notification group not found: %s", group)})
+				return
+			}
+		}
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, name, type, enabled, config, fallback_channel_id, fallback_min_priority FROM notification_channels
+		WHERE license_id = $1 AND deleted_at IS NULL
+		  AND (id::text = ANY($2) OR type = ANY($3)
+		       OR id IN (SELECT channel_id FROM notification_group_channels WHERE group_id::text = ANY($4)))
+		ORDER BY name
+	`, req.LicenseID, pq.Array(req.ChannelIDs), pq.Array(req.ChannelTypes), pq.Array(groupIDs))
+	if err != nil {
+		log.Errorf("Failed to load broadcast channels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to broadcast notification"})
+		return
+	}
+	channels := []models.NotificationChannel{}
+	for rows.Next() {
+		var channel models.NotificationChannel
+		var configJSON []byte
+		if err := rows.Scan(&channel.ID, &channel.Name, &channel.Type, &channel.Enabled, &configJSON, &channel.FallbackChannelID, &channel.FallbackMinPriority); err != nil {
+			log.Warnf("Failed to scan notification channel: %v", err)
+			continue
+		}
+		json.Unmarshal(configJSON, &channel.Config)
+		channels = append(channels, channel)
+	}
+	rows.Close()
+
+	if len(channels) > maxBroadcastChannels {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Broadcast targets %d channels; at most %d are allowed", len(channels), maxBroadcastChannels)})
+		return
+	}
+
+	response := models.BroadcastNotificationResponse{Results: make([]models.NotificationDeliveryResult, len(channels))}
+
+	// A fallback that is itself an enabled target already gets the message
+	targeted := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		if channel.Enabled {
+			targeted[channel.ID] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, broadcastConcurrency)
+	for i, channel := range channels {
+		result := &response.Results[i]
+		result.ChannelID, result.ChannelName, result.ChannelType = channel.ID, channel.Name, channel.Type
+		if !channel.Enabled {
+			result.Status = "skipped"
+			result.Error = "channel is disabled"
+			continue
+		}
+
+		wg.Add(1)
+		go func(channel models.NotificationChannel, result *models.NotificationDeliveryResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			startTime := time.Now()
+			outcome := h.notifyChannel(channel, func() error {
+				return h.deliver(channel, req.Subject, req.Message, req.Priority, req.Metadata)
+			}, req.Subject, req.Message, req.Priority, req.Metadata, channel.FallbackChannelID == nil || !targeted[*channel.FallbackChannelID])
+			result.LatencyMs = time.Since(startTime).Milliseconds()
+			result.LogID = outcome.logID
+			result.Status = outcome.status()
+			if outcome.err != nil {
+				log.Errorf("Failed to broadcast notification via %s channel %s: %v", channel.Type, channel.ID, outcome.err)
+				result.Error = outcome.err.Error()
+			}
+			if outcome.fallbackChannelID != "" {
+				result.FallbackChannelID = outcome.fallbackChannelID
+				result.FallbackLogID = outcome.fallbackLogID
+				if outcome.fallbackErr != nil {
+					result.FallbackError = outcome.fallbackErr.Error()
+				}
+			}
+		}(channel, result)
+	}
+	wg.Wait()
+
+	// Explicitly requested channels that do not exist are reported rather than ignored
+	resolved := map[string]bool{}
+	for _, channel := range channels {
+		resolved[channel.ID] = true
+	}
+	for _, channelID := range uniqueStrings(req.ChannelIDs) {
+		if !resolved[channelID] {
+			response.Results = append(response.Results, models.NotificationDeliveryResult{
+				ChannelID: channelID,
+				Status:    "failed",
+				Error:     "channel not found",
+			})
+		}
+	}
+
+	for _, result := range response.Results {
+		switch result.Status {
+		case "sent":
+			response.Sent++
+		case "fallback":
+			response.Fallback++
+		case "failed":
+			response.Failed++
+		case "skipped":
+			response.Skipped++
+		}
+	}
+	response.Total = len(response.Results)
+
+	log.Infof("Broadcast notification for license %s: %d sent, %d through fallback, %d failed, %d skipped",
+		req.LicenseID, response.Sent, response.Fallback, response.Failed, response.Skipped)
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		if response.Sent+response.Fallback == 0 {
+			status = http.StatusBadGateway
+		} else {
+			status = http.StatusMultiStatus
+		}
+	}
+	c.JSON(status, response)
+}
+
+// missingChannels returns the IDs that are not live channels of the license
+func (h *NotificationHandler) missingChannels(licenseID string, channelIDs []string) ([]string, error) {
+	rows, err := h.db.Query(`
+		SELECT id::text FROM notification_channels
+		WHERE license_id = $1 AND deleted_at IS NULL AND id::text = ANY($2)
+	`, licenseID, pq.Array(channelIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+
+	missing := []string{}
+	for _, id := range channelIDs {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, rows.Err()
+}
+
+// setGroupChannels adds channels to a group
+func setGroupChannels(tx *sql.Tx, groupID string, channelIDs []string) error {
+	_, err := tx.Exec(`
+		INSERT INTO notification_group_channels (group_id, channel_id)
+		SELECT $1, unnest($2::uuid[])
+	`, groupID, pq.Array(channelIDs))
+	return err
+}
+
+// uniqueStrings returns values without duplicates, in first-seen order
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
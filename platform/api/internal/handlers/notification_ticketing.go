@@ -0,0 +1,600 @@
+// Ticketing Channels
+// Jira and ServiceNow channels that open a ticket per alert and close it when the alert resolves
+
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// ticketingClient is used for every Jira and ServiceNow request
+var ticketingClient = &http.Client{Timeout: 15 * time.Second}
+
+// maxTicketSummary is the longest summary Jira and ServiceNow accept
+const maxTicketSummary = 255
+
+// Default severity mappings, used for severities a channel does not map itself
+var (
+	defaultJiraPriorities = map[string]string{"critical": "Highest", "high": "High", "medium": "Medium", "low": "Low"}
+	defaultSNUrgency      = map[string]string{"critical": "1", "high": "1", "medium": "2", "low": "3"}
+	defaultSNImpact       = map[string]string{"critical": "1", "high": "2", "medium": "2", "low": "3"}
+)
+
+// createdTicket identifies a ticket in the external system
+type createdTicket struct {
+	externalID  string
+	externalKey string
+	url         string
+}
+
+// parseJiraConfig decodes a jira channel's stored config
+func parseJiraConfig(config map[string]interface{}) models.JiraConfig {
+	var jiraConfig models.JiraConfig
+	configJSON, _ := json.Marshal(config)
+	json.Unmarshal(configJSON, &jiraConfig)
+	jiraConfig.BaseURL = strings.TrimRight(jiraConfig.BaseURL, "/")
+	return jiraConfig
+}
+
+// parseServiceNowConfig decodes a servicenow channel's stored config
+func parseServiceNowConfig(config map[string]interface{}) models.ServiceNowConfig {
+	var snConfig models.ServiceNowConfig
+	configJSON, _ := json.Marshal(config)
+	json.Unmarshal(configJSON, &snConfig)
+	snConfig.InstanceURL = strings.TrimRight(snConfig.InstanceURL, "/")
+	return snConfig
+}
+
+// openTicket opens a Jira issue or ServiceNow incident for a notification and records it. When
+// the metadata names an alert that already has an open ticket on the channel, nothing is opened,
+// so re-notifying an alert does not file duplicates.
+func (h *NotificationHandler) openTicket(channel models.NotificationChannel, subject, message, priority string, metadata map[string]interface{}) error {
+	alertID := ""
+	if value, ok := metadata["alert_id"]; ok && value != nil {
+		alertID = fmt.Sprint(value)
+	}
+
+	if alertID != "" {
+		var exists bool
+		err := h.db.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM notification_tickets
+				WHERE channel_id = $1 AND alert_id::text = $2 AND status = 'open'
+			)
+		`, channel.ID, alertID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check for an open ticket: %w", err)
+		}
+		if exists {
+			log.WithFields(log.Fields{"channel_id": channel.ID, "alert_id": alertID}).Debug("Alert already has an open ticket, not opening another")
+			return nil
+		}
+	}
+
+	var ticket createdTicket
+	var err error
+	switch channel.Type {
+	case "jira":
+		ticket, err = createJiraIssue(parseJiraConfig(channel.Config), subject, message, priority)
+	case "servicenow":
+		ticket, err = createServiceNowIncident(parseServiceNowConfig(channel.Config), subject, message, priority)
+	default:
+		return fmt.Errorf("%s is not a ticketing channel", channel.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO notification_tickets (channel_id, alert_id, system, external_id, external_key, url)
+		VALUES ($1, (SELECT id FROM alert_instances WHERE id::text = $2), $3, $4, $5, $6)
+	`, channel.ID, alertID, channel.Type, ticket.externalID, nullIfEmpty(ticket.externalKey), nullIfEmpty(ticket.url))
+	if err != nil {
+		// The ticket exists; failing the delivery would only open a duplicate on retry
+		log.Errorf("Failed to record %s ticket %s: %v", channel.Type, ticket.externalID, err)
+	}
+	return nil
+}
+
+// createJiraIssue opens an issue in the project mapped for the priority
+func createJiraIssue(jiraConfig models.JiraConfig, subject, message, priority string) (createdTicket, error) {
+	projectKey := jiraConfig.ProjectKey
+	if mapped, ok := jiraConfig.ProjectMap[priority]; ok && mapped != "" {
+		projectKey = mapped
+	}
+	issueType := jiraConfig.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": projectKey},
+		"summary":     truncateRunes(subject, maxTicketSummary),
+		"description": message,
+		"issuetype":   map[string]string{"name": issueType},
+	}
+	if name := mappedValue(jiraConfig.PriorityMap, defaultJiraPriorities, priority); name != "" {
+		fields["priority"] = map[string]string{"name": name}
+	}
+	if len(jiraConfig.Labels) > 0 {
+		fields["labels"] = jiraConfig.Labels
+	}
+	if jiraConfig.Assignee != "" {
+		// Jira Cloud identifies users by accountId, Server and Data Center by name
+		if jiraConfig.PersonalAccessToken == "" {
+			fields["assignee"] = map[string]string{"accountId": jiraConfig.Assignee}
+		} else {
+			fields["assignee"] = map[string]string{"name": jiraConfig.Assignee}
+		}
+	}
+
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	err := ticketingRequest(http.MethodPost, jiraConfig.BaseURL+"/rest/api/2/issue", map[string]interface{}{"fields": fields}, jiraAuth(jiraConfig), &created)
+	if err != nil {
+		return createdTicket{}, fmt.Errorf("failed to create Jira issue: %w", err)
+	}
+	return createdTicket{
+		externalID:  created.ID,
+		externalKey: created.Key,
+		url:         jiraConfig.BaseURL + "/browse/" + created.Key,
+	}, nil
+}
+
+// closeJiraIssue moves the issue through the channel's close transition and comments on it. The
+// comment comes last so a failed transition, which is retried, does not leave repeated comments.
+func closeJiraIssue(jiraConfig models.JiraConfig, issueKey, notes string) error {
+	auth := jiraAuth(jiraConfig)
+	issueURL := jiraConfig.BaseURL + "/rest/api/2/issue/" + url.PathEscape(issueKey)
+
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := ticketingRequest(http.MethodGet, issueURL+"/transitions", nil, auth, &available); err != nil {
+		return fmt.Errorf("failed to list Jira transitions: %w", err)
+	}
+
+	name := jiraConfig.CloseTransition
+	if name == "" {
+		name = "Done"
+	}
+	for _, transition := range available.Transitions {
+		// Matched on the transition or on the status it leads to, since workflows name them differently
+		if strings.EqualFold(transition.Name, name) || strings.EqualFold(transition.To.Name, name) {
+			body := map[string]interface{}{"transition": map[string]string{"id": transition.ID}}
+			if err := ticketingRequest(http.MethodPost, issueURL+"/transitions", body, auth, nil); err != nil {
+				return fmt.Errorf("failed to transition Jira issue: %w", err)
+			}
+			if err := ticketingRequest(http.MethodPost, issueURL+"/comment", map[string]string{"body": notes}, auth, nil); err != nil {
+				log.Warnf("Closed Jira issue %s but failed to comment on it: %v", issueKey, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("jira issue %s has no %q transition from its current status", issueKey, name)
+}
+
+// jiraAuth authenticates with a personal access token, or Cloud's email and API token
+func jiraAuth(jiraConfig models.JiraConfig) func(*http.Request) {
+	return func(req *http.Request) {
+		if jiraConfig.PersonalAccessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+jiraConfig.PersonalAccessToken)
+			return
+		}
+		req.SetBasicAuth(jiraConfig.Email, jiraConfig.APIToken)
+	}
+}
+
+// createServiceNowIncident opens an incident with the urgency and impact mapped for the priority
+func createServiceNowIncident(snConfig models.ServiceNowConfig, subject, message, priority string) (createdTicket, error) {
+	auth, err := serviceNowAuth(snConfig)
+	if err != nil {
+		return createdTicket{}, err
+	}
+
+	incident := map[string]string{
+		"short_description": truncateRunes(subject, maxTicketSummary),
+		"description":       message,
+		"urgency":           mappedValue(snConfig.UrgencyMap, defaultSNUrgency, priority),
+		"impact":            mappedValue(snConfig.ImpactMap, defaultSNImpact, priority),
+	}
+	if snConfig.AssignmentGroup != "" {
+		incident["assignment_group"] = snConfig.AssignmentGroup
+	}
+	if snConfig.CallerID != "" {
+		incident["caller_id"] = snConfig.CallerID
+	}
+	if snConfig.Category != "" {
+		incident["category"] = snConfig.Category
+	}
+
+	var created struct {
+		Result struct {
+			SysID  string `json:"sys_id"`
+			Number string `json:"number"`
+		} `json:"result"`
+	}
+	if err := ticketingRequest(http.MethodPost, snConfig.InstanceURL+"/api/now/table/incident", incident, auth, &created); err != nil {
+		return createdTicket{}, fmt.Errorf("failed to create ServiceNow incident: %w", err)
+	}
+	return createdTicket{
+		externalID:  created.Result.SysID,
+		externalKey: created.Result.Number,
+		url:         snConfig.InstanceURL + "/nav_to.do?uri=incident.do?sys_id=" + created.Result.SysID,
+	}, nil
+}
+
+// resolveServiceNowIncident moves the incident to Resolved with the channel's close code
+func resolveServiceNowIncident(snConfig models.ServiceNowConfig, sysID, notes string) error {
+	auth, err := serviceNowAuth(snConfig)
+	if err != nil {
+		return err
+	}
+	closeCode := snConfig.CloseCode
+	if closeCode == "" {
+		closeCode = "Solved (Permanently)"
+	}
+	if snConfig.CloseNotes != "" {
+		notes = snConfig.CloseNotes
+	}
+
+	update := map[string]string{
+		"state":       "6", // Resolved
+		"close_code":  closeCode,
+		"close_notes": notes,
+	}
+	if err := ticketingRequest(http.MethodPatch, snConfig.InstanceURL+"/api/now/table/incident/"+url.PathEscape(sysID), update, auth, nil); err != nil {
+		return fmt.Errorf("failed to resolve ServiceNow incident: %w", err)
+	}
+	return nil
+}
+
+// serviceNowAuth authenticates with basic auth, or with an OAuth token from the password grant
+// when the channel has a client ID
+func serviceNowAuth(snConfig models.ServiceNowConfig) (func(*http.Request), error) {
+	if snConfig.ClientID == "" {
+		return func(req *http.Request) {
+			req.SetBasicAuth(snConfig.Username, snConfig.Password)
+		}, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {snConfig.ClientID},
+		"client_secret": {snConfig.ClientSecret},
+		"username":      {snConfig.Username},
+		"password":      {snConfig.Password},
+	}
+	resp, err := ticketingClient.PostForm(snConfig.InstanceURL+"/oauth_token.do", form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request ServiceNow token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("servicenow token request returned status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("servicenow token response has no access_token")
+	}
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}, nil
+}
+
+// ticketingRequest sends a JSON request and decodes the JSON response into out, if given. A
+// non-2xx response is returned as an error including the start of its body, which is where Jira
+// and ServiceNow explain rejected fields.
+func ticketingRequest(method, requestURL string, body interface{}, auth func(*http.Request), out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, requestURL, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	auth(req)
+
+	resp, err := ticketingClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return nil
+}
+
+// testTicketingChannel checks a ticketing channel's URL and credentials without opening a ticket
+func testTicketingChannel(channelType string, config map[string]interface{}) error {
+	switch channelType {
+	case "jira":
+		jiraConfig := parseJiraConfig(config)
+		return ticketingRequest(http.MethodGet, jiraConfig.BaseURL+"/rest/api/2/myself", nil, jiraAuth(jiraConfig), nil)
+	case "servicenow":
+		snConfig := parseServiceNowConfig(config)
+		auth, err := serviceNowAuth(snConfig)
+		if err != nil {
+			return err
+		}
+		return ticketingRequest(http.MethodGet, snConfig.InstanceURL+"/api/now/table/incident?sysparm_limit=1&sysparm_fields=sys_id", nil, auth, nil)
+	}
+	return fmt.Errorf("%s is not a ticketing channel", channelType)
+}
+
+// validateTicketingConfig checks the URL, credentials and severity mappings of a ticketing channel
+func validateTicketingConfig(channelType string, config map[string]interface{}) error {
+	switch channelType {
+	case "jira":
+		jiraConfig := parseJiraConfig(config)
+		if !isAbsoluteHTTPURL(jiraConfig.BaseURL) {
+			return fmt.Errorf("jira base_url must be an absolute http or https URL")
+		}
+		if jiraConfig.PersonalAccessToken == "" && (jiraConfig.Email == "" || jiraConfig.APIToken == "") {
+			return fmt.Errorf("jira requires email and api_token, or personal_access_token")
+		}
+		if jiraConfig.ProjectKey == "" {
+			return fmt.Errorf("jira project_key required")
+		}
+		if err := validateSeverityMap("project_map", jiraConfig.ProjectMap, nil); err != nil {
+			return err
+		}
+		return validateSeverityMap("priority_map", jiraConfig.PriorityMap, nil)
+
+	case "servicenow":
+		snConfig := parseServiceNowConfig(config)
+		if !isAbsoluteHTTPURL(snConfig.InstanceURL) {
+			return fmt.Errorf("servicenow instance_url must be an absolute http or https URL")
+		}
+		if snConfig.Username == "" || snConfig.Password == "" {
+			return fmt.Errorf("servicenow username and password required")
+		}
+		if snConfig.ClientID != "" && snConfig.ClientSecret == "" {
+			return fmt.Errorf("servicenow client_secret required with client_id")
+		}
+		levels := map[string]bool{"1": true, "2": true, "3": true}
+		if err := validateSeverityMap("urgency_map", snConfig.UrgencyMap, levels); err != nil {
+			return err
+		}
+		return validateSeverityMap("impact_map", snConfig.ImpactMap, levels)
+	}
+	return fmt.Errorf("%s is not a ticketing channel", channelType)
+}
+
+// validateSeverityMap checks that a mapping is keyed by alert severity and, if allowed is
+// given, maps to one of its values
+func validateSeverityMap(name string, mapping map[string]string, allowed map[string]bool) error {
+	for severity, value := range mapping {
+		if _, ok := severityRank[severity]; !ok {
+			return fmt.Errorf("%s key %q must be low, medium, high or critical", name, severity)
+		}
+		if value == "" || (allowed != nil && !allowed[value]) {
+			return fmt.Errorf("%s value %q for %s is not valid", name, value, severity)
+		}
+	}
+	return nil
+}
+
+// maskTicketingCredentials hides the tokens of a ticketing channel. The password is masked with
+// the other channels' passwords.
+func maskTicketingCredentials(config map[string]interface{}) {
+	for _, key := range []string{"api_token", "personal_access_token", "client_secret"} {
+		if _, ok := config[key]; ok {
+			config[key] = "********"
+		}
+	}
+}
+
+// isAbsoluteHTTPURL reports whether raw is an http or https URL with a host
+func isAbsoluteHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// mappedValue looks a severity up in the channel's mapping, then in the defaults
+func mappedValue(mapping, defaults map[string]string, severity string) string {
+	if value, ok := mapping[severity]; ok && value != "" {
+		return value
+	}
+	return defaults[severity]
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// TicketSyncResult summarizes a ticket sync run
+type TicketSyncResult struct {
+	Checked int
+	Closed  int
+	Failed  int
+}
+
+// SyncTickets closes the open tickets of alerts that were resolved or suppressed, on
+// channels with close_on_resolve set. A ticket that fails to close keeps its status and the
+// error, and is retried on the next run. licenseID limits the sync to one license when set.
+func (h *NotificationHandler) SyncTickets(licenseID string) (TicketSyncResult, error) {
+	var result TicketSyncResult
+
+	query := `
+		SELECT t.id, t.system, t.external_id, COALESCE(t.external_key, ''), a.id, a.status, ch.config
+		FROM notification_tickets t
+		JOIN notification_channels ch ON ch.id = t.channel_id AND ch.deleted_at IS NULL
+		JOIN alert_instances a ON a.id = t.alert_id
+		WHERE t.status = 'open' AND a.status IN ('resolved', 'suppressed')`
+	args := []interface{}{}
+	if licenseID != "" {
+		query += " AND ch.license_id = $1"
+		args = append(args, licenseID)
+	}
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to load open tickets: %w", err)
+	}
+
+	type pendingTicket struct {
+		id, system, externalID, externalKey, alertID, alertStatus string
+		config                                                    map[string]interface{}
+	}
+	var tickets []pendingTicket
+	for rows.Next() {
+		var ticket pendingTicket
+		var configJSON []byte
+		if err := rows.Scan(&ticket.id, &ticket.system, &ticket.externalID, &ticket.externalKey, &ticket.alertID, &ticket.alertStatus, &configJSON); err != nil {
+			log.Warnf("Failed to scan ticket: %v", err)
+			continue
+		}
+		json.Unmarshal(configJSON, &ticket.config)
+		tickets = append(tickets, ticket)
+	}
+	rows.Close()
+
+	for _, ticket := range tickets {
+		notes := fmt.Sprintf("Alert %s was marked %s in Prive.", ticket.alertID, strings.ReplaceAll(ticket.alertStatus, "_", " "))
+
+		var closeErr error
+		switch ticket.system {
+		case "jira":
+			jiraConfig := parseJiraConfig(ticket.config)
+			if !jiraConfig.CloseOnResolve {
+				continue
+			}
+			closeErr = closeJiraIssue(jiraConfig, ticket.externalKey, notes)
+		case "servicenow":
+			snConfig := parseServiceNowConfig(ticket.config)
+			if !snConfig.CloseOnResolve {
+				continue
+			}
+			closeErr = resolveServiceNowIncident(snConfig, ticket.externalID, notes)
+		default:
+			continue
+		}
+		result.Checked++
+
+		if closeErr != nil {
+			result.Failed++
+			log.Errorf("Failed to close %s ticket %s: %v", ticket.system, ticket.externalID, closeErr)
+			if _, err := h.db.Exec(`UPDATE notification_tickets SET last_error = $2 WHERE id = $1`, ticket.id, closeErr.Error()); err != nil {
+				log.Errorf("Failed to record ticket error: %v", err)
+			}
+			continue
+		}
+		if _, err := h.db.Exec(`
+			UPDATE notification_tickets SET status = 'closed', closed_at = NOW(), last_error = NULL WHERE id = $1
+		`, ticket.id); err != nil {
+			return result, fmt.Errorf("failed to mark ticket %s closed: %w", ticket.id, err)
+		}
+		result.Closed++
+	}
+
+	return result, nil
+}
+
+// ListTickets lists the tickets opened through a license's ticketing channels
+func (h *NotificationHandler) ListTickets(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	query := `
+		SELECT t.id, t.channel_id, t.alert_id, t.system, t.external_id, COALESCE(t.external_key, ''),
+		       COALESCE(t.url, ''), t.status, COALESCE(t.last_error, ''), t.created_at, t.closed_at
+		FROM notification_tickets t
+		JOIN notification_channels ch ON ch.id = t.channel_id
+		WHERE ch.license_id = $1`
+	args := []interface{}{licenseID}
+	if alertID := c.Query("alert_id"); alertID != "" {
+		args = append(args, alertID)
+		query += fmt.Sprintf(" AND t.alert_id::text = $%d", len(args))
+	}
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND t.status = $%d", len(args))
+	}
+	query += " ORDER BY t.created_at DESC LIMIT 500"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to query notification tickets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
+		return
+	}
+	defer rows.Close()
+
+	tickets := make([]models.NotificationTicket, 0)
+	for rows.Next() {
+		var ticket models.NotificationTicket
+		var channelID, alertID sql.NullString
+		var closedAt sql.NullTime
+		if err := rows.Scan(&ticket.ID, &channelID, &alertID, &ticket.System, &ticket.ExternalID, &ticket.ExternalKey,
+			&ticket.URL, &ticket.Status, &ticket.LastError, &ticket.CreatedAt, &closedAt); err != nil {
+			log.Warnf("Failed to scan ticket: %v", err)
+			continue
+		}
+		if channelID.Valid {
+			ticket.ChannelID = &channelID.String
+		}
+		if alertID.Valid {
+			ticket.AlertID = &alertID.String
+		}
+		if closedAt.Valid {
+			ticket.ClosedAt = &closedAt.Time
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tickets": tickets,
+		"total":   len(tickets),
+	})
+}
@@ -6,10 +6,13 @@ import (
 	"bytes"
 	"crypto/tls"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/smtp"
+	"net/textproto"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -40,9 +43,10 @@ func (h *NotificationHandler) ListChannels(c *gin.Context) {
 	}
 
 	query := `
-		SELECT id, license_id, name, type, enabled, config, created_at, updated_at
+		SELECT id, license_id, name, type, enabled, config, created_at, updated_at, deleted_at, version,
+		       fallback_channel_id, fallback_min_priority
 		FROM notification_channels
-		WHERE license_id = $1
+		WHERE license_id = $1` + liveOnly(c) + `
 		ORDER BY created_at DESC
 	`
 
@@ -58,16 +62,26 @@ func (h *NotificationHandler) ListChannels(c *gin.Context) {
 	for rows.Next() {
 		var channel models.NotificationChannel
 		var configJSON []byte
+		var deletedAt sql.NullTime
+		var fallbackID sql.NullString
 
 		err := rows.Scan(
 			&channel.ID, &channel.LicenseID, &channel.Name, &channel.Type,
-			&channel.Enabled, &configJSON, &channel.CreatedAt, &channel.UpdatedAt,
+			&channel.Enabled, &configJSON, &channel.CreatedAt, &channel.UpdatedAt, &deletedAt, &channel.Version,
+			&fallbackID, &channel.FallbackMinPriority,
 		)
 
 		if err != nil {
 			log.Warnf("Failed to scan channel: %v", err)
 			continue
 		}
+		if deletedAt.Valid {
+			channel.DeletedAt = &deletedAt.Time
+		}
+		if fallbackID.Valid {
+			channel.FallbackChannelID = &fallbackID.String
+		}
+		channel.Circuit = notificationBreakers.state(channel.ID)
 
 		// Parse JSON config (mask sensitive fields)
 		if len(configJSON) > 0 {
@@ -84,6 +98,8 @@ func (h *NotificationHandler) ListChannels(c *gin.Context) {
 			if _, ok := config["integration_key"]; ok {
 				config["integration_key"] = "********"
 			}
+			maskWebhookAuth(config)
+			maskTicketingCredentials(config)
 
 			channel.Config = config
 		}
@@ -102,17 +118,20 @@ func (h *NotificationHandler) GetChannel(c *gin.Context) {
 	channelID := c.Param("id")
 
 	query := `
-		SELECT id, license_id, name, type, enabled, config, created_at, updated_at
+		SELECT id, license_id, name, type, enabled, config, created_at, updated_at, deleted_at, version,
+		       fallback_channel_id, fallback_min_priority
 		FROM notification_channels
-		WHERE id = $1
-	`
+		WHERE id = $1` + liveOnly(c)
 
 	var channel models.NotificationChannel
 	var configJSON []byte
+	var deletedAt sql.NullTime
+	var fallbackID sql.NullString
 
 	err := h.db.QueryRow(query, channelID).Scan(
 		&channel.ID, &channel.LicenseID, &channel.Name, &channel.Type,
-		&channel.Enabled, &configJSON, &channel.CreatedAt, &channel.UpdatedAt,
+		&channel.Enabled, &configJSON, &channel.CreatedAt, &channel.UpdatedAt, &deletedAt, &channel.Version,
+		&fallbackID, &channel.FallbackMinPriority,
 	)
 
 	if err != nil {
@@ -124,6 +143,13 @@ func (h *NotificationHandler) GetChannel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query failed"})
 		return
 	}
+	if deletedAt.Valid {
+		channel.DeletedAt = &deletedAt.Time
+	}
+	if fallbackID.Valid {
+		channel.FallbackChannelID = &fallbackID.String
+	}
+	channel.Circuit = notificationBreakers.state(channel.ID)
 
 	// Parse JSON config (mask sensitive fields)
 	if len(configJSON) > 0 {
@@ -140,10 +166,13 @@ func (h *NotificationHandler) GetChannel(c *gin.Context) {
 		if _, ok := config["integration_key"]; ok {
 			config["integration_key"] = "********"
 		}
+		maskWebhookAuth(config)
+		maskTicketingCredentials(config)
 
 		channel.Config = config
 	}
 
+	setVersionETag(c, channel.Version)
 	c.JSON(http.StatusOK, channel)
 }
 
@@ -151,13 +180,13 @@ func (h *NotificationHandler) GetChannel(c *gin.Context) {
 func (h *NotificationHandler) CreateChannel(c *gin.Context) {
 	var req models.CreateChannelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	// Validate channel type
 	if !isValidChannelType(req.Type) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel type. Must be: email, slack, pagerduty, or webhook"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel type. Must be: email, slack, pagerduty, webhook, jira, or servicenow"})
 		return
 	}
 
@@ -167,18 +196,35 @@ func (h *NotificationHandler) CreateChannel(c *gin.Context) {
 		return
 	}
 
+	if req.FallbackChannelID != "" {
+		exists, err := h.fallbackChannelExists(req.LicenseID, req.FallbackChannelID)
+		if err != nil {
+			log.Errorf("Failed to check fallback channel: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"fallback_channel_id": "must be a live channel of the same license"}})
+			return
+		}
+	}
+	if req.FallbackMinPriority == "" {
+		req.FallbackMinPriority = "critical"
+	}
+
 	channelID := uuid.New().String()
 	configJSON, _ := json.Marshal(req.Config)
 
 	query := `
-		INSERT INTO notification_channels (id, license_id, name, type, enabled, config, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		INSERT INTO notification_channels (id, license_id, name, type, enabled, config, fallback_channel_id, fallback_min_priority, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 		RETURNING created_at, updated_at
 	`
 
 	var createdAt, updatedAt time.Time
 	err := h.db.QueryRow(query,
 		channelID, req.LicenseID, req.Name, req.Type, req.Enabled, string(configJSON),
+		nullIfEmpty(req.FallbackChannelID), req.FallbackMinPriority,
 	).Scan(&createdAt, &updatedAt)
 
 	if err != nil {
@@ -200,14 +246,58 @@ func (h *NotificationHandler) CreateChannel(c *gin.Context) {
 func (h *NotificationHandler) UpdateChannel(c *gin.Context) {
 	channelID := c.Param("id")
 
+	expectedVersion, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	var req models.UpdateChannelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
+	setsFallback := req.FallbackChannelID != nil && *req.FallbackChannelID != ""
+	if setsFallback && *req.FallbackChannelID == channelID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"fallback_channel_id": "cannot be the channel itself"}})
+		return
+	}
+	if setsFallback || req.Config != nil {
+		var licenseID, channelType string
+		err := h.db.QueryRow("SELECT license_id, type FROM notification_channels WHERE id = $1 AND deleted_at IS NULL", channelID).Scan(&licenseID, &channelType)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to query channel: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+			return
+		}
+
+		// Configs are validated like on create, so a broken webhook template is caught here
+		if req.Config != nil {
+			if err := validateChannelConfig(channelType, *req.Config); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if setsFallback {
+			exists, err := h.fallbackChannelExists(licenseID, *req.FallbackChannelID)
+			if err != nil {
+				log.Errorf("Failed to check fallback channel: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
+				return
+			}
+			if !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"fallback_channel_id": "must be a live channel of the same license"}})
+				return
+			}
+		}
+	}
+
 	// Build dynamic update query
-	query := "UPDATE notification_channels SET updated_at = NOW()"
+	query := "UPDATE notification_channels SET updated_at = NOW(), version = version + 1"
 	args := []interface{}{}
 	argCount := 1
 
@@ -227,58 +317,62 @@ func (h *NotificationHandler) UpdateChannel(c *gin.Context) {
 		args = append(args, string(configJSON))
 		argCount++
 	}
+	if req.FallbackChannelID != nil {
+		query += fmt.Sprintf(", fallback_channel_id = $%d", argCount)
+		args = append(args, nullIfEmpty(*req.FallbackChannelID))
+		argCount++
+	}
+	if req.FallbackMinPriority != nil {
+		query += fmt.Sprintf(", fallback_min_priority = $%d", argCount)
+		args = append(args, *req.FallbackMinPriority)
+		argCount++
+	}
 
-	query += fmt.Sprintf(" WHERE id = $%d", argCount)
-	args = append(args, channelID)
+	query += fmt.Sprintf(" WHERE id = $%d AND deleted_at IS NULL AND ($%d = 0 OR version = $%d) RETURNING version", argCount, argCount+1, argCount+1)
+	args = append(args, channelID, expectedVersion)
 
-	result, err := h.db.Exec(query, args...)
+	var version int
+	err := h.db.QueryRow(query, args...).Scan(&version)
+	if err == sql.ErrNoRows {
+		versionMismatch(c, h.db, "notification_channels", "Channel", channelID)
+		return
+	}
 	if err != nil {
 		log.Errorf("Failed to update channel: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
-		return
-	}
-
 	log.Infof("Updated notification channel: %s", channelID)
 
+	setVersionETag(c, version)
 	c.JSON(http.StatusOK, gin.H{
 		"id":      channelID,
+		"version": version,
 		"message": "Channel updated successfully",
 	})
 }
 
-// DeleteChannel deletes a notification channel
+// DeleteChannel soft-deletes a notification channel; nothing is delivered to it until it is restored
 func (h *NotificationHandler) DeleteChannel(c *gin.Context) {
-	channelID := c.Param("id")
-
-	result, err := h.db.Exec("DELETE FROM notification_channels WHERE id = $1", channelID)
-	if err != nil {
-		log.Errorf("Failed to delete channel: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete channel"})
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
-		return
-	}
+	softDeleteRow(c, h.db, "notification_channels", "Channel")
+}
 
-	log.Infof("Deleted notification channel: %s", channelID)
+// RestoreChannel brings back a soft-deleted notification channel
+func (h *NotificationHandler) RestoreChannel(c *gin.Context) {
+	restoreRow(c, h.db, "notification_channels", "Channel")
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Channel deleted successfully"})
+// PurgeChannel permanently removes a soft-deleted notification channel
+func (h *NotificationHandler) PurgeChannel(c *gin.Context) {
+	purgeRow(c, h.db, "notification_channels", "Channel")
 }
 
 // SendNotification sends a notification via a configured channel
 func (h *NotificationHandler) SendNotification(c *gin.Context) {
 	var req models.SendNotificationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -286,9 +380,9 @@ func (h *NotificationHandler) SendNotification(c *gin.Context) {
 	var channel models.NotificationChannel
 	var configJSON []byte
 
-	query := "SELECT id, type, enabled, config FROM notification_channels WHERE id = $1"
+	query := "SELECT id, type, enabled, config, fallback_channel_id, fallback_min_priority FROM notification_channels WHERE id = $1 AND deleted_at IS NULL"
 	err := h.db.QueryRow(query, req.ChannelID).Scan(
-		&channel.ID, &channel.Type, &channel.Enabled, &configJSON,
+		&channel.ID, &channel.Type, &channel.Enabled, &configJSON, &channel.FallbackChannelID, &channel.FallbackMinPriority,
 	)
 
 	if err != nil {
@@ -312,43 +406,44 @@ func (h *NotificationHandler) SendNotification(c *gin.Context) {
 	startTime := time.Now()
 	var sendErr error
 
-	switch channel.Type {
-	case "email":
-		sendErr = h.sendEmail(channel.Config, req.Subject, req.Message)
-	case "slack":
-		sendErr = h.sendSlack(channel.Config, req.Subject, req.Message, req.Priority)
-	case "pagerduty":
-		sendErr = h.sendPagerDuty(channel.Config, req.Subject, req.Message, req.Priority)
-	case "webhook":
-		sendErr = h.sendWebhook(channel.Config, req.Subject, req.Message, req.Metadata)
-	default:
+	if !isSupportedChannelType(channel.Type) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported channel type"})
 		return
 	}
+	outcome := h.notifyChannel(channel, func() error {
+		return h.deliver(channel, req.Subject, req.Message, req.Priority, req.Metadata)
+	}, req.Subject, req.Message, req.Priority, req.Metadata, true)
+	sendErr = outcome.err
 
 	latency := time.Since(startTime).Milliseconds()
 
-	// Log notification
-	logID := uuid.New().String()
-	status := "sent"
-	errorMsg := ""
-	if sendErr != nil {
-		status = "failed"
-		errorMsg = sendErr.Error()
-	}
-
-	metadataJSON, _ := json.Marshal(req.Metadata)
-	h.db.Exec(`
-		INSERT INTO notification_logs (id, channel_id, channel_type, subject, message, priority, status, error, sent_at, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), $9)
-	`, logID, req.ChannelID, channel.Type, req.Subject, req.Message, req.Priority, status, errorMsg, string(metadataJSON))
+	logID := outcome.logID
+	status := outcome.status()
 
-	if sendErr != nil {
+	if !outcome.delivered() {
 		log.Errorf("Failed to send notification: %v", sendErr)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		response := gin.H{
 			"error":      "Failed to send notification",
 			"details":    sendErr.Error(),
 			"latency_ms": latency,
+		}
+		if outcome.fallbackChannelID != "" {
+			response["fallback_channel_id"] = outcome.fallbackChannelID
+			response["fallback_error"] = outcome.fallbackErr.Error()
+		}
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if sendErr != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"log_id":              logID,
+			"status":              status,
+			"details":             sendErr.Error(),
+			"fallback_channel_id": outcome.fallbackChannelID,
+			"fallback_log_id":     outcome.fallbackLogID,
+			"latency_ms":          latency,
+			"message":             "Channel failed, notification sent through its fallback channel",
 		})
 		return
 	}
@@ -367,7 +462,7 @@ func (h *NotificationHandler) SendNotification(c *gin.Context) {
 func (h *NotificationHandler) TestChannel(c *gin.Context) {
 	var req models.TestChannelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
@@ -375,7 +470,7 @@ func (h *NotificationHandler) TestChannel(c *gin.Context) {
 	var channel models.NotificationChannel
 	var configJSON []byte
 
-	query := "SELECT id, type, config FROM notification_channels WHERE id = $1"
+	query := "SELECT id, type, config FROM notification_channels WHERE id = $1 AND deleted_at IS NULL"
 	err := h.db.QueryRow(query, req.ChannelID).Scan(&channel.ID, &channel.Type, &configJSON)
 
 	if err != nil {
@@ -403,7 +498,10 @@ func (h *NotificationHandler) TestChannel(c *gin.Context) {
 	case "pagerduty":
 		sendErr = h.sendPagerDuty(channel.Config, testSubject, testMessage, "low")
 	case "webhook":
-		sendErr = h.sendWebhook(channel.Config, testSubject, testMessage, map[string]interface{}{"test": true})
+		sendErr = h.sendWebhook(channel.Config, testSubject, testMessage, "low", map[string]interface{}{"test": true})
+	case "jira", "servicenow":
+		// Checks the credentials without opening a ticket
+		sendErr = testTicketingChannel(channel.Type, channel.Config)
 	}
 
 	latency := time.Since(startTime).Milliseconds()
@@ -419,13 +517,179 @@ func (h *NotificationHandler) TestChannel(c *gin.Context) {
 		response.Error = sendErr.Error()
 	} else {
 		response.Message = "Test notification sent successfully"
+		notificationBreakers.reset(channel.ID) // A working channel need not wait out its cooldown
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// isSupportedChannelType reports whether deliver knows how to send to the channel type
+func isSupportedChannelType(channelType string) bool {
+	switch channelType {
+	case "email", "slack", "pagerduty", "webhook", "jira", "servicenow":
+		return true
+	}
+	return false
+}
+
+// deliver sends a message through a channel. Ticketing channels open a ticket.
+func (h *NotificationHandler) deliver(channel models.NotificationChannel, subject, message, priority string, metadata map[string]interface{}) error {
+	config := channel.Config
+	switch channel.Type {
+	case "email":
+		return h.sendEmail(config, subject, message)
+	case "slack":
+		return h.sendSlack(config, subject, message, priority)
+	case "pagerduty":
+		return h.sendPagerDuty(config, subject, message, priority)
+	case "webhook":
+		return h.sendWebhook(config, subject, message, priority, metadata)
+	case "jira", "servicenow":
+		return h.openTicket(channel, subject, message, priority, metadata)
+	}
+	return fmt.Errorf("unsupported channel type: %s", channel.Type)
+}
+
+// logNotification records a delivery attempt in notification_logs and returns the log ID.
+// fallbackFrom is the failed channel the attempt stood in for, or empty.
+func (h *NotificationHandler) logNotification(channelID, channelType, subject, message, priority string, metadata map[string]interface{}, sendErr error, fallbackFrom string) string {
+	logID := uuid.New().String()
+	status := "sent"
+	errorMsg := ""
+	if sendErr != nil {
+		status = "failed"
+		errorMsg = sendErr.Error()
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+	h.db.Exec(`
+		INSERT INTO notification_logs (id, channel_id, channel_type, subject, message, priority, status, error, fallback_from, sent_at, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10)
+	`, logID, channelID, channelType, subject, message, priority, status, errorMsg, nullIfEmpty(fallbackFrom), string(metadataJSON))
+
+	return logID
+}
+
+// NotifyLicense sends a message to every enabled channel of a license. Failures are logged per
+// channel and do not stop delivery to the others; a failed channel whose fallback is not one of
+// the license's enabled channels hands the message to it. It returns the number of channels the
+// message reached directly or through their fallback.
+func (h *NotificationHandler) NotifyLicense(licenseID, subject, message, priority string, metadata map[string]interface{}) int {
+	rows, err := h.db.Query(`
+		SELECT id, type, config, fallback_channel_id, fallback_min_priority FROM notification_channels
+		WHERE license_id = $1 AND enabled = TRUE AND deleted_at IS NULL
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to load notification channels: %v", err)
+		return 0
+	}
+
+	channels := []models.NotificationChannel{}
+	for rows.Next() {
+		var channel models.NotificationChannel
+		var configJSON []byte
+		if err := rows.Scan(&channel.ID, &channel.Type, &configJSON, &channel.FallbackChannelID, &channel.FallbackMinPriority); err != nil {
+			continue
+		}
+		json.Unmarshal(configJSON, &channel.Config)
+		channels = append(channels, channel)
+	}
+	rows.Close()
+
+	notified := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		notified[channel.ID] = true
+	}
+
+	sent := 0
+	for _, channel := range channels {
+		channel := channel
+		outcome := h.notifyChannel(channel, func() error {
+			return h.deliver(channel, subject, message, priority, metadata)
+		}, subject, message, priority, metadata, channel.FallbackChannelID == nil || !notified[*channel.FallbackChannelID])
+		if outcome.err != nil {
+			log.Errorf("Failed to send notification via %s: %v", channel.Type, outcome.err)
+		}
+		if outcome.delivered() {
+			sent++
+		}
+	}
+	return sent
+}
+
+// emailAttachment is a file attached to an email notification
+type emailAttachment struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// deliverToChannel sends a message through one enabled channel and logs the attempt. Email
+// channels receive the HTML body and attachments; other channels, and the fallback channel if the
+// channel fails, receive the plain summary. It returns nil when the fallback delivered it.
+func (h *NotificationHandler) deliverToChannel(channelID, subject, htmlBody, summary, priority string, attachments []emailAttachment, metadata map[string]interface{}) error {
+	var channel models.NotificationChannel
+	var configJSON []byte
+	err := h.db.QueryRow("SELECT id, type, enabled, config, fallback_channel_id, fallback_min_priority FROM notification_channels WHERE id = $1 AND deleted_at IS NULL", channelID).Scan(
+		&channel.ID, &channel.Type, &channel.Enabled, &configJSON, &channel.FallbackChannelID, &channel.FallbackMinPriority,
+	)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("channel %s not found", channelID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve channel: %w", err)
+	}
+	if !channel.Enabled {
+		return fmt.Errorf("channel %s is disabled", channelID)
+	}
+	json.Unmarshal(configJSON, &channel.Config)
+
+	outcome := h.notifyChannel(channel, func() error {
+		if channel.Type == "email" {
+			return h.sendEmailWithAttachments(channel.Config, subject, htmlBody, attachments)
+		}
+		return h.deliver(channel, subject, summary, priority, metadata)
+	}, subject, summary, priority, metadata, true)
+
+	if outcome.delivered() {
+		return nil
+	}
+	return outcome.err
+}
+
 // sendEmail sends an email notification
 func (h *NotificationHandler) sendEmail(config map[string]interface{}, subject, message string) error {
+	return h.sendEmailWithAttachments(config, subject, message, nil)
+}
+
+// buildMultipartEmail wraps an HTML body and attachments in a multipart/mixed message body
+func buildMultipartEmail(message string, attachments []emailAttachment) (string, string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=\"utf-8\""}})
+	part.Write([]byte(message))
+
+	for _, attachment := range attachments {
+		part, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.filename)},
+		})
+		encoded := base64.StdEncoding.EncodeToString(attachment.data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	writer.Close()
+
+	return "multipart/mixed; boundary=" + writer.Boundary(), buf.String()
+}
+
+// sendEmailWithAttachments sends an HTML email, as multipart/mixed when there are attachments
+func (h *NotificationHandler) sendEmailWithAttachments(config map[string]interface{}, subject, message string, attachments []emailAttachment) error {
 	var emailConfig models.EmailConfig
 	configJSON, _ := json.Marshal(config)
 	json.Unmarshal(configJSON, &emailConfig)
@@ -447,6 +711,9 @@ func (h *NotificationHandler) sendEmail(config map[string]interface{}, subject,
 	headers["Subject"] = subject
 	headers["MIME-Version"] = "1.0"
 	headers["Content-Type"] = "text/html; charset=\"utf-8\""
+	if len(attachments) > 0 {
+		headers["Content-Type"], message = buildMultipartEmail(message, attachments)
+	}
 
 	body := ""
 	for k, v := range headers {
@@ -616,73 +883,41 @@ func (h *NotificationHandler) sendPagerDuty(config map[string]interface{}, subje
 	return nil
 }
 
-// sendWebhook sends a custom webhook notification
-func (h *NotificationHandler) sendWebhook(config map[string]interface{}, subject, message string, metadata map[string]interface{}) error {
-	var webhookConfig models.WebhookConfig
-	configJSON, _ := json.Marshal(config)
-	json.Unmarshal(configJSON, &webhookConfig)
+// sendWebhook sends a custom webhook notification, with the channel's body template, query
+// parameters and auth scheme applied
+func (h *NotificationHandler) sendWebhook(config map[string]interface{}, subject, message, priority string, metadata map[string]interface{}) error {
+	webhookConfig := parseWebhookConfig(config)
 
 	if webhookConfig.URL == "" {
 		return fmt.Errorf("webhook URL not configured")
 	}
 
-	if webhookConfig.Method == "" {
-		webhookConfig.Method = "POST"
-	}
-	if webhookConfig.Timeout == 0 {
-		webhookConfig.Timeout = 10
-	}
-
 	// Build payload
-	payload := map[string]interface{}{
-		"subject":   subject,
-		"message":   message,
-		"timestamp": time.Now().Format(time.RFC3339),
-	}
-	if metadata != nil {
-		payload["metadata"] = metadata
-	}
-
-	payloadJSON, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest(webhookConfig.Method, webhookConfig.URL, bytes.NewBuffer(payloadJSON))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Prive-Platform/1.0")
-
-	// Add custom headers
-	for k, v := range webhookConfig.Headers {
-		req.Header.Set(k, v)
-	}
-
-	client := &http.Client{
-		Timeout: time.Duration(webhookConfig.Timeout) * time.Second,
-	}
-
-	resp, err := client.Do(req)
+	now := time.Now()
+	payloadJSON, err := renderWebhookBody(webhookConfig, models.WebhookTemplateData{
+		Subject:   subject,
+		Message:   message,
+		Priority:  priority,
+		Timestamp: now,
+		Metadata:  metadata,
+	})
 	if err != nil {
-		return fmt.Errorf("webhook request failed: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("webhook returned non-2xx status: %d", resp.StatusCode)
-	}
-
-	return nil
+	return postWebhook(webhookConfig, payloadJSON, now)
 }
 
 // Helper functions
 
 func isValidChannelType(channelType string) bool {
 	validTypes := map[string]bool{
-		"email":     true,
-		"slack":     true,
-		"pagerduty": true,
-		"webhook":   true,
+		"email":      true,
+		"slack":      true,
+		"pagerduty":  true,
+		"webhook":    true,
+		"jira":       true,
+		"servicenow": true,
 	}
 	return validTypes[channelType]
 }
@@ -711,6 +946,9 @@ func validateChannelConfig(channelType string, config map[string]interface{}) er
 		if _, ok := config["url"]; !ok {
 			return fmt.Errorf("url required for webhook channel")
 		}
+		return validateWebhookConfig(config)
+	case "jira", "servicenow":
+		return validateTicketingConfig(channelType, config)
 	}
 	return nil
 }
@@ -0,0 +1,221 @@
+// Telemetry Query Guardrails
+// Pre-flight scan estimates and execution limits for ad-hoc telemetry queries
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// clickhouseTimeoutExceeded is ClickHouse's TIMEOUT_EXCEEDED error code
+const clickhouseTimeoutExceeded = 159
+
+// QueryGuardrails bounds what a single telemetry query may scan, return and how long it may
+// run. Zero values disable the corresponding check.
+type QueryGuardrails struct {
+	ConfirmScanRows     uint64 // Estimates above this need "confirm": true
+	MaxScanRows         uint64 // Estimates above this are rejected outright
+	MaxExecutionSeconds int    // Passed to ClickHouse as max_execution_time
+	MaxResultRows       uint64 // Passed to ClickHouse as max_result_rows
+}
+
+// SetQueryGuardrails configures the default scan thresholds and execution limits for telemetry
+// queries; tiers and licenses may override them
+func (h *TelemetryHandler) SetQueryGuardrails(guardrails QueryGuardrails) {
+	h.guardrails = guardrails
+}
+
+// queryContext applies a tenant's execution time and result size limits to a ClickHouse query
+// context
+func queryContext(ctx context.Context, guardrails QueryGuardrails) context.Context {
+	settings := clickhouse.Settings{}
+	if guardrails.MaxExecutionSeconds > 0 {
+		settings["max_execution_time"] = guardrails.MaxExecutionSeconds
+	}
+	if guardrails.MaxResultRows > 0 {
+		settings["max_result_rows"] = guardrails.MaxResultRows
+		settings["result_overflow_mode"] = "throw"
+	}
+	if len(settings) == 0 {
+		return ctx
+	}
+	return clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+}
+
+// estimateQueryCost asks ClickHouse how many parts, granules and rows a query would read
+// after partition and primary key pruning, without executing it
+func (h *TelemetryHandler) estimateQueryCost(ctx context.Context, guardrails QueryGuardrails, query string, args []interface{}, start, end time.Time) (*models.QueryCostEstimate, error) {
+	rows, err := h.clickhouse.Query(ctx, "EXPLAIN ESTIMATE "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	estimate := &models.QueryCostEstimate{
+		RangeDays:       end.Sub(start).Hours() / 24,
+		ConfirmScanRows: guardrails.ConfirmScanRows,
+		MaxScanRows:     guardrails.MaxScanRows,
+	}
+	for rows.Next() {
+		var database, table string
+		var parts, scanRows, marks uint64
+		if err := rows.Scan(&database, &table, &parts, &scanRows, &marks); err != nil {
+			return nil, err
+		}
+		estimate.Parts += parts
+		estimate.Rows += scanRows
+		estimate.Marks += marks
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	estimate.RequiresConfirmation = guardrails.ConfirmScanRows > 0 && estimate.Rows > guardrails.ConfirmScanRows
+	estimate.Rejected = guardrails.MaxScanRows > 0 && estimate.Rows > guardrails.MaxScanRows
+	return estimate, nil
+}
+
+// checkQueryCost estimates a query and answers the request when it is over a threshold.
+// Estimation failures are logged and the query proceeds, still bounded by max_execution_time.
+func (h *TelemetryHandler) checkQueryCost(ctx context.Context, c *gin.Context, guardrails QueryGuardrails, query string, args []interface{}, start, end time.Time, confirmed bool) (*models.QueryCostEstimate, bool) {
+	if guardrails.ConfirmScanRows == 0 && guardrails.MaxScanRows == 0 {
+		return nil, true
+	}
+
+	estimate, err := h.estimateQueryCost(ctx, guardrails, query, args, start, end)
+	if err != nil {
+		log.Warnf("Failed to estimate telemetry query cost: %v", err)
+		return nil, true
+	}
+
+	if estimate.Rejected {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Query would scan too much data; narrow the time range or add filters",
+			"estimate": estimate,
+		})
+		return nil, false
+	}
+	if estimate.RequiresConfirmation && !confirmed {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":    "Query is expensive; resubmit with \"confirm\": true to run it",
+			"estimate": estimate,
+		})
+		return nil, false
+	}
+
+	return estimate, true
+}
+
+// eventQueryFilters builds the optional WHERE clauses of a telemetry query. Callers anchor the
+// query on tenant_id and the timestamp range first, which prunes partitions and primary key
+// granules; the filters follow in the order their data-skipping indexes discard granules (see
+// the expected plans in schema.sql), with the unindexed payload search last.
+func eventQueryFilters(req models.QueryEventsRequest) (string, []interface{}) {
+	var clauses strings.Builder
+	args := []interface{}{}
+
+	in := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			placeholders[i] = "?"
+			args = append(args, value)
+		}
+		clauses.WriteString(" AND " + column + " IN (" + strings.Join(placeholders, ",") + ")")
+	}
+
+	// Sort key columns after timestamp, backed by idx_event_type and idx_agent_id. event_type is
+	// an Enum8 of lower-case names, and an unknown name fails the whole query.
+	eventTypes := make([]string, len(req.EventTypes))
+	for i, eventType := range req.EventTypes {
+		eventTypes[i] = strings.ToLower(eventType)
+	}
+	in("event_type", eventTypes)
+	in("agent_id", req.AgentIDs)
+
+	// Bloom filter and set indexes
+	in("hostname", req.Hostnames)
+	in("process_name", req.ProcessNames)
+	in("file_path", req.FilePaths)
+	in("dst_ip", req.DstIPs)
+	in("mitre_tactic", req.MitreTactics)
+	in("mitre_technique", req.MitreTechniques)
+
+	// idx_severity skips granules holding only lower-severity events
+	if req.MinSeverity != nil {
+		clauses.WriteString(" AND severity >= ?")
+		args = append(args, *req.MinSeverity)
+	}
+
+	if req.SearchText != "" {
+		clauses.WriteString(" AND positionCaseInsensitive(payload, ?) > 0")
+		args = append(args, req.SearchText)
+	}
+
+	return clauses.String(), args
+}
+
+// parseQueryRange parses the RFC3339 time range of a telemetry query
+func parseQueryRange(req models.QueryEventsRequest) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid start_time format, use RFC3339")
+	}
+	end, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid end_time format, use RFC3339")
+	}
+	return start, end, nil
+}
+
+// EstimateQuery returns the scan estimate for a telemetry query without running it, so the
+// UI can warn before submitting
+func (h *TelemetryHandler) EstimateQuery(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.QueryEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	start, end, err := parseQueryRange(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters, filterArgs := eventQueryFilters(req)
+	customFilters, customArgs, ok := h.customFieldFilters(c, req)
+	if !ok {
+		return
+	}
+	query := "SELECT event_id FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ?" + filters + customFilters
+	args := append([]interface{}{req.TenantID, start, end}, filterArgs...)
+	args = append(args, customArgs...)
+
+	guardrails := h.guardrailsFor(req.TenantID)
+	estimate, err := h.estimateQueryCost(queryContext(c.Request.Context(), guardrails), guardrails, query, args, start, end)
+	if err != nil {
+		log.Errorf("Failed to estimate telemetry query cost: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to estimate query cost"})
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
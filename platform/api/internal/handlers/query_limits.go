@@ -0,0 +1,217 @@
+// Per-Tenant Query Limits
+// Tier and license-level ClickHouse execution limits so one tenant cannot monopolize the cluster
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// clickhouseTooManyRows is ClickHouse's TOO_MANY_ROWS_OR_BYTES error code, raised when a result
+// exceeds max_result_rows
+const clickhouseTooManyRows = 396
+
+// queryLimitsCacheTTL bounds how long a license's effective limits are reused before re-reading
+const queryLimitsCacheTTL = time.Minute
+
+type cachedGuardrails struct {
+	guardrails QueryGuardrails
+	fetchedAt  time.Time
+}
+
+// SetTierQueryGuardrails sets the limits of a license tier. Zero fields inherit the global
+// guardrails.
+func (h *TelemetryHandler) SetTierQueryGuardrails(tier string, guardrails QueryGuardrails) {
+	h.limitsMu.Lock()
+	defer h.limitsMu.Unlock()
+	if h.tierGuardrails == nil {
+		h.tierGuardrails = make(map[string]QueryGuardrails)
+	}
+	h.tierGuardrails[tier] = guardrails
+	h.limitsCache = nil
+}
+
+// guardrailsFor returns the effective limits of a license: global defaults, then its tier's
+// limits, then its own overrides
+func (h *TelemetryHandler) guardrailsFor(licenseID string) QueryGuardrails {
+	h.limitsMu.Lock()
+	if cached, ok := h.limitsCache[licenseID]; ok && time.Since(cached.fetchedAt) < queryLimitsCacheTTL {
+		h.limitsMu.Unlock()
+		return cached.guardrails
+	}
+	h.limitsMu.Unlock()
+
+	guardrails, _, _, err := h.loadGuardrails(licenseID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Warnf("Failed to load query limits for %s: %v", licenseID, err)
+	}
+
+	h.limitsMu.Lock()
+	if h.limitsCache == nil {
+		h.limitsCache = make(map[string]cachedGuardrails)
+	}
+	h.limitsCache[licenseID] = cachedGuardrails{guardrails: guardrails, fetchedAt: time.Now()}
+	h.limitsMu.Unlock()
+	return guardrails
+}
+
+// loadGuardrails resolves a license's limits from Postgres. On error the global guardrails are
+// returned.
+func (h *TelemetryHandler) loadGuardrails(licenseID string) (QueryGuardrails, string, models.TenantQueryLimits, error) {
+	var tier string
+	var overridesJSON []byte
+	var overrides models.TenantQueryLimits
+
+	err := h.db.QueryRow("SELECT tier, COALESCE(query_limits, '{}') FROM licenses WHERE id = $1", licenseID).
+		Scan(&tier, &overridesJSON)
+	if err != nil {
+		return h.guardrails, "", overrides, err
+	}
+	if err := json.Unmarshal(overridesJSON, &overrides); err != nil {
+		return h.guardrails, tier, overrides, fmt.Errorf("invalid query_limits: %w", err)
+	}
+
+	h.limitsMu.Lock()
+	tierGuardrails := h.tierGuardrails[tier]
+	h.limitsMu.Unlock()
+
+	guardrails := h.guardrails.inherit(tierGuardrails)
+	if overrides.MaxExecutionSeconds != nil {
+		guardrails.MaxExecutionSeconds = *overrides.MaxExecutionSeconds
+	}
+	if overrides.MaxResultRows != nil {
+		guardrails.MaxResultRows = *overrides.MaxResultRows
+	}
+	if overrides.ConfirmScanRows != nil {
+		guardrails.ConfirmScanRows = *overrides.ConfirmScanRows
+	}
+	if overrides.MaxScanRows != nil {
+		guardrails.MaxScanRows = *overrides.MaxScanRows
+	}
+	return guardrails, tier, overrides, nil
+}
+
+// inherit returns g with the non-zero limits of override applied
+func (g QueryGuardrails) inherit(override QueryGuardrails) QueryGuardrails {
+	if override.ConfirmScanRows > 0 {
+		g.ConfirmScanRows = override.ConfirmScanRows
+	}
+	if override.MaxScanRows > 0 {
+		g.MaxScanRows = override.MaxScanRows
+	}
+	if override.MaxExecutionSeconds > 0 {
+		g.MaxExecutionSeconds = override.MaxExecutionSeconds
+	}
+	if override.MaxResultRows > 0 {
+		g.MaxResultRows = override.MaxResultRows
+	}
+	return g
+}
+
+// clampLimit caps a requested row limit at the tenant's max_result_rows
+func (g QueryGuardrails) clampLimit(limit int) int {
+	if g.MaxResultRows > 0 && uint64(limit) > g.MaxResultRows {
+		return int(g.MaxResultRows)
+	}
+	return limit
+}
+
+// queryLimitError answers the request when ClickHouse aborted a query for exceeding a tenant
+// limit. Other errors are left to the caller.
+func queryLimitError(c *gin.Context, err error, guardrails QueryGuardrails) bool {
+	var exception *clickhouse.Exception
+	if !errors.As(err, &exception) {
+		return false
+	}
+
+	switch exception.Code {
+	case clickhouseTimeoutExceeded:
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":                 fmt.Sprintf("Query exceeded the maximum execution time of %d seconds; narrow the time range or add filters", guardrails.MaxExecutionSeconds),
+			"code":                  "query_timeout",
+			"max_execution_seconds": guardrails.MaxExecutionSeconds,
+		})
+		return true
+	case clickhouseTooManyRows:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":           fmt.Sprintf("Query result exceeds the limit of %d rows; add filters or lower the limit", guardrails.MaxResultRows),
+			"code":            "result_limit_exceeded",
+			"max_result_rows": guardrails.MaxResultRows,
+		})
+		return true
+	}
+	return false
+}
+
+// GetQueryLimits returns a license's query limit overrides and the limits in effect
+func (h *TelemetryHandler) GetQueryLimits(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	guardrails, tier, overrides, err := h.loadGuardrails(licenseID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load query limits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load query limits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TenantQueryLimitsResponse{
+		LicenseID: licenseID,
+		Tier:      tier,
+		Overrides: overrides,
+		Effective: models.TenantQueryLimits{
+			MaxExecutionSeconds: &guardrails.MaxExecutionSeconds,
+			MaxResultRows:       &guardrails.MaxResultRows,
+			ConfirmScanRows:     &guardrails.ConfirmScanRows,
+			MaxScanRows:         &guardrails.MaxScanRows,
+		},
+	})
+}
+
+// UpdateQueryLimits replaces a license's query limit overrides. Omitted fields revert to the
+// tier limits; 0 removes a limit for the license.
+func (h *TelemetryHandler) UpdateQueryLimits(c *gin.Context) {
+	licenseID := c.Param("id")
+
+	var req models.TenantQueryLimits
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.MaxExecutionSeconds != nil && *req.MaxExecutionSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_execution_seconds must not be negative"})
+		return
+	}
+
+	overrides, _ := json.Marshal(req)
+	result, err := h.db.Exec("UPDATE licenses SET query_limits = $2, updated_at = NOW() WHERE id = $1", licenseID, overrides)
+	if err != nil {
+		log.Errorf("Failed to update query limits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update query limits"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+		return
+	}
+
+	h.limitsMu.Lock()
+	delete(h.limitsCache, licenseID)
+	h.limitsMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Query limits updated successfully"})
+}
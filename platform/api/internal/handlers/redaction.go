@@ -0,0 +1,243 @@
+// Payload Redaction
+// Per-license redaction rules applied by the consumer before events are stored
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// RedactionHandler manages redaction rules. Rules live in ClickHouse, where the consumer reads
+// them; changes apply to events ingested after the consumer's next refresh, never retroactively.
+type RedactionHandler struct {
+	clickhouse driver.Conn
+}
+
+// NewRedactionHandler creates a new redaction handler
+func NewRedactionHandler(ch driver.Conn) *RedactionHandler {
+	return &RedactionHandler{clickhouse: ch}
+}
+
+// ListRedactionRules lists the redaction rules of a license along with the available presets
+func (h *RedactionHandler) ListRedactionRules(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rules, err := h.listRules(c.Request.Context(), licenseID, "")
+	if err != nil {
+		log.Errorf("Failed to list redaction rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list redaction rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": rules, "count": len(rules), "presets": models.RedactionPresets})
+}
+
+// CreateRedactionRule adds a redaction rule to a license
+func (h *RedactionHandler) CreateRedactionRule(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.RedactionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if err := validateRedactionRule(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := redactionRuleFromRequest(uuid.New().String(), req)
+	if err := h.writeRule(c.Request.Context(), rule, false); err != nil {
+		log.Errorf("Failed to create redaction rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create redaction rule"})
+		return
+	}
+
+	log.Infof("Redaction rule %s (%s) created for license %s", rule.ID, rule.Name, rule.LicenseID)
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRedactionRule replaces a redaction rule
+func (h *RedactionHandler) UpdateRedactionRule(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.RedactionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if err := validateRedactionRule(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.listRules(c.Request.Context(), req.LicenseID, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to look up redaction rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update redaction rule"})
+		return
+	}
+	if len(existing) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Redaction rule not found"})
+		return
+	}
+
+	rule := redactionRuleFromRequest(c.Param("id"), req)
+	if err := h.writeRule(c.Request.Context(), rule, false); err != nil {
+		log.Errorf("Failed to update redaction rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update redaction rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRedactionRule removes a redaction rule. Events already stored stay redacted.
+func (h *RedactionHandler) DeleteRedactionRule(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	existing, err := h.listRules(c.Request.Context(), licenseID, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to look up redaction rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete redaction rule"})
+		return
+	}
+	if len(existing) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Redaction rule not found"})
+		return
+	}
+
+	rule := existing[0]
+	rule.UpdatedAt = time.Now().UTC()
+	if err := h.writeRule(c.Request.Context(), rule, true); err != nil {
+		log.Errorf("Failed to delete redaction rule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete redaction rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Redaction rule deleted successfully"})
+}
+
+// validateRedactionRule checks that a rule has a known preset, a valid pattern or only fields
+func validateRedactionRule(req models.RedactionRuleRequest) error {
+	switch {
+	case req.Preset != "" && req.Pattern != "":
+		return fmt.Errorf("preset and pattern are mutually exclusive")
+	case req.Preset != "":
+		if !containsString(models.RedactionPresets, req.Preset) {
+			return fmt.Errorf("unknown preset %q; available presets: %v", req.Preset, models.RedactionPresets)
+		}
+	case req.Pattern != "":
+		// The consumer also uses Go's RE2 engine, so a pattern that compiles here behaves the same there
+		if _, err := regexp.Compile(req.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	case len(req.Fields) == 0:
+		return fmt.Errorf("a rule needs a preset, a pattern or fields to mask")
+	}
+	return nil
+}
+
+func redactionRuleFromRequest(id string, req models.RedactionRuleRequest) models.RedactionRule {
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	fields := req.Fields
+	if fields == nil {
+		fields = []string{}
+	}
+	return models.RedactionRule{
+		ID:          id,
+		LicenseID:   req.LicenseID,
+		Name:        req.Name,
+		Preset:      req.Preset,
+		Pattern:     req.Pattern,
+		Fields:      fields,
+		Replacement: req.Replacement,
+		Enabled:     enabled,
+		UpdatedBy:   req.UpdatedBy,
+		UpdatedAt:   time.Now().UTC(),
+	}
+}
+
+// listRules returns a license's live rules, or the single rule with ruleID when it is set
+func (h *RedactionHandler) listRules(ctx context.Context, licenseID, ruleID string) ([]models.RedactionRule, error) {
+	query := `
+		SELECT rule_id, tenant_id, name, preset, pattern, fields, replacement, enabled, updated_by, updated_at
+		FROM redaction_rules FINAL
+		WHERE tenant_id = ? AND deleted = 0`
+	args := []interface{}{licenseID}
+	if ruleID != "" {
+		query += " AND rule_id = ?"
+		args = append(args, ruleID)
+	}
+	query += " ORDER BY name"
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.RedactionRule{}
+	for rows.Next() {
+		var r models.RedactionRule
+		var enabled uint8
+		if err := rows.Scan(&r.ID, &r.LicenseID, &r.Name, &r.Preset, &r.Pattern, &r.Fields, &r.Replacement,
+			&enabled, &r.UpdatedBy, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		r.Enabled = enabled == 1
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// writeRule inserts a new version of a rule; the ReplacingMergeTree keeps the latest
+func (h *RedactionHandler) writeRule(ctx context.Context, r models.RedactionRule, deleted bool) error {
+	var enabledFlag, deletedFlag uint8
+	if r.Enabled {
+		enabledFlag = 1
+	}
+	if deleted {
+		deletedFlag = 1
+	}
+	return h.clickhouse.Exec(ctx, `
+		INSERT INTO redaction_rules (tenant_id, rule_id, name, preset, pattern, fields, replacement, enabled, updated_by, updated_at, deleted)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.LicenseID, r.ID, r.Name, r.Preset, r.Pattern, r.Fields, r.Replacement, enabledFlag, r.UpdatedBy, r.UpdatedAt, deletedFlag)
+}
@@ -0,0 +1,298 @@
+// Report Rendering
+// Turns a SecurityReport into an HTML email body, a PDF document, or a short plain-text summary
+
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"severityName": eventSeverityName,
+	"pct":          func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+	"date":         func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #1f2933; max-width: 760px; margin: 0 auto; padding: 24px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 17px; border-bottom: 1px solid #d9e2ec; padding-bottom: 4px; margin-top: 28px; }
+table { border-collapse: collapse; width: 100%; margin-top: 8px; }
+th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #eef2f7; font-size: 14px; }
+th { background: #f5f7fa; }
+.muted { color: #7b8794; font-size: 13px; }
+.metric { font-size: 26px; font-weight: 600; }
+.error { color: #b42318; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="muted">{{date .PeriodStart}} &ndash; {{date .PeriodEnd}} &middot; generated {{date .GeneratedAt}}</div>
+
+{{with .TopThreats}}
+<h2>Top Threats</h2>
+<p><span class="metric">{{.TotalEvents}}</span> events from {{.UniqueAgents}} agents on {{.UniqueHosts}} hosts</p>
+<table>
+<tr><th>Severity</th><th>Events</th></tr>
+{{range $level, $count := .EventsBySeverity}}<tr><td>{{severityName $level}}</td><td>{{$count}}</td></tr>
+{{end}}
+</table>
+{{if .TopMitreTactics}}
+<table>
+<tr><th>MITRE tactic</th><th>Events</th><th>Share</th></tr>
+{{range .TopMitreTactics}}<tr><td>{{.ID}}</td><td>{{.EventCount}}</td><td>{{pct .Percentage}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+
+{{with .MITRECoverage}}
+<h2>MITRE ATT&amp;CK Coverage</h2>
+<p><span class="metric">{{pct .CoveragePercent}}</span> &mdash; {{.DetectedCount}} of {{.TotalTechniques}} techniques observed</p>
+{{if .DetectedTechniques}}
+<table>
+<tr><th>Technique</th><th>Events</th><th>Last seen</th></tr>
+{{range .DetectedTechniques}}<tr><td>{{.TechniqueID}}</td><td>{{.EventCount}}</td><td>{{date .LastSeen}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+
+{{with .DLPViolations}}
+<h2>DLP Violations</h2>
+<p><span class="metric">{{.Total}}</span> violations</p>
+<table>
+<tr><th>Severity</th><th>Violations</th></tr>
+{{range $severity, $count := .BySeverity}}<tr><td>{{$severity}}</td><td>{{$count}}</td></tr>
+{{end}}
+</table>
+{{if .TopPolicies}}
+<table>
+<tr><th>Policy</th><th>Violations</th></tr>
+{{range .TopPolicies}}<tr><td>{{if .Name}}{{.Name}}{{else}}{{.Key}}{{end}}</td><td>{{.Count}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{if .TopUsers}}
+<table>
+<tr><th>User</th><th>Violations</th></tr>
+{{range .TopUsers}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+
+{{with .Deception}}
+<h2>Deception</h2>
+<table>
+<tr><td>Active honeypots</td><td>{{.ActiveHoneypots}} of {{.TotalHoneypots}}</td></tr>
+<tr><td>Compromised honeypots</td><td>{{.CompromisedHoneypots}}</td></tr>
+<tr><td>Active honey tokens</td><td>{{.ActiveHoneyTokens}} of {{.TotalHoneyTokens}}</td></tr>
+<tr><td>Interactions (7 days)</td><td>{{.Events7d}}</td></tr>
+<tr><td>Unique source IPs</td><td>{{.UniqueSourceIPs}}</td></tr>
+<tr><td>Threat score</td><td>{{printf "%.0f" .ThreatScore}} / 100</td></tr>
+</table>
+{{end}}
+
+{{if .Errors}}
+<h2>Unavailable Sections</h2>
+<ul>
+{{range $section, $err := .Errors}}<li class="error">{{$section}}: {{$err}}</li>
+{{end}}
+</ul>
+{{end}}
+</body>
+</html>
+`))
+
+// renderReportHTML renders the report as a standalone HTML document
+func renderReportHTML(report models.SecurityReport) (string, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, report); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// reportTopN caps the event type and host breakdowns in text renderings
+const reportTopN = 10
+
+// reportCount is one labelled count in a text rendering breakdown
+type reportCount struct {
+	Label string
+	Count int64
+}
+
+// reportTextTemplate lays the report out as fixed-width text for the PDF rendering. Each
+// section starts with a blank line; reportLines splits the output into lines.
+var reportTextTemplate = texttemplate.Must(texttemplate.New("report-text").Funcs(texttemplate.FuncMap{
+	"date":               func(t time.Time) string { return t.Format("2006-01-02 15:04 MST") },
+	"severityCounts":     reportSeverityCounts,
+	"topCounts":          reportTopCounts,
+	"dlpSeverityCounts":  reportDLPSeverityCounts,
+	"techniquesByEvents": reportTechniquesByEvents,
+}).Parse(`
+{{- if .PeriodStart.IsZero}}Generated: {{date .GeneratedAt}}{{else}}Period: {{date .PeriodStart}} - {{date .PeriodEnd}}{{end}}
+{{with .TopThreats}}
+TOP THREATS
+{{printf "  %d events from %d agents on %d hosts" .TotalEvents .UniqueAgents .UniqueHosts}}
+{{range severityCounts .EventsBySeverity}}{{printf "  %-10s %d" .Label .Count}}
+{{end}}{{range .TopMitreTactics}}{{printf "  %-24s %d (%.1f%%)" .ID .EventCount .Percentage}}
+{{end}}{{range topCounts .EventsByType}}{{printf "  type %-19s %d" .Label .Count}}
+{{end}}{{range topCounts .EventsByHost}}{{printf "  host %-19s %d" .Label .Count}}
+{{end}}{{end}}
+{{- with .MITRECoverage}}
+MITRE ATT&CK COVERAGE
+{{printf "  %.1f%% - %d of %d techniques observed" .CoveragePercent .DetectedCount .TotalTechniques}}
+{{range techniquesByEvents .DetectedTechniques}}{{printf "  %-12s %d events, last seen %s" .TechniqueID .EventCount (.LastSeen.Format "2006-01-02")}}
+{{end}}{{end}}
+{{- with .DLPViolations}}
+DLP VIOLATIONS
+{{printf "  %d violations" .Total}}
+{{range dlpSeverityCounts .BySeverity}}{{printf "  %-10s %d" .Label .Count}}
+{{end}}{{range .TopPolicies}}{{printf "  policy %s: %d" (or .Name .Key) .Count}}
+{{end}}{{range .TopUsers}}{{printf "  user %s: %d" .Key .Count}}
+{{end}}{{end}}
+{{- with .Deception}}
+DECEPTION
+{{printf "  Active honeypots: %d of %d (%d compromised)" .ActiveHoneypots .TotalHoneypots .CompromisedHoneypots}}
+{{printf "  Active honey tokens: %d of %d" .ActiveHoneyTokens .TotalHoneyTokens}}
+{{printf "  Interactions (7 days): %d from %d source IPs" .Events7d .UniqueSourceIPs}}
+{{printf "  Threat score: %.0f / 100" .ThreatScore}}
+{{end}}
+{{- if .Errors}}
+UNAVAILABLE SECTIONS
+{{range $section, $err := .Errors}}{{printf "  %s: %s" $section $err}}
+{{end}}{{end}}`))
+
+// reportLines renders the report through reportTextTemplate and splits it into text lines
+func reportLines(report models.SecurityReport) ([]string, error) {
+	var buf bytes.Buffer
+	if err := reportTextTemplate.Execute(&buf, report); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"), nil
+}
+
+// reportSeverityCounts orders event counts from the most to the least severe level
+func reportSeverityCounts(counts map[uint8]int64) []reportCount {
+	levels := make([]int, 0, len(counts))
+	for level := range counts {
+		levels = append(levels, int(level))
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(levels)))
+
+	result := make([]reportCount, 0, len(levels))
+	for _, level := range levels {
+		result = append(result, reportCount{Label: eventSeverityName(uint8(level)), Count: counts[uint8(level)]})
+	}
+	return result
+}
+
+// reportTopCounts returns the reportTopN largest counts, largest first
+func reportTopCounts(counts map[string]int64) []reportCount {
+	result := []reportCount{}
+	for i, key := range sortedCounts(counts) {
+		if i == reportTopN {
+			break
+		}
+		result = append(result, reportCount{Label: key, Count: counts[key]})
+	}
+	return result
+}
+
+// reportDLPSeverityCounts orders DLP violation counts from critical to info
+func reportDLPSeverityCounts(counts map[string]uint64) []reportCount {
+	result := []reportCount{}
+	for _, severity := range []string{"critical", "high", "medium", "low", "info"} {
+		if count, ok := counts[severity]; ok {
+			result = append(result, reportCount{Label: severity, Count: int64(count)})
+		}
+	}
+	return result
+}
+
+// reportTechniquesByEvents orders detected techniques by event count, busiest first
+func reportTechniquesByEvents(techniques []models.DetectedTechnique) []models.DetectedTechnique {
+	sorted := append([]models.DetectedTechnique(nil), techniques...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].EventCount > sorted[j].EventCount })
+	return sorted
+}
+
+// reportSummary is the short plain-text version sent to chat and webhook channels
+func reportSummary(report models.SecurityReport) string {
+	parts := []string{}
+	if s := report.TopThreats; s != nil {
+		parts = append(parts, fmt.Sprintf("%d events (%d high, %d critical)", s.TotalEvents, s.EventsBySeverity[3], s.EventsBySeverity[4]))
+	}
+	if cov := report.MITRECoverage; cov != nil {
+		parts = append(parts, fmt.Sprintf("MITRE coverage %.1f%%", cov.CoveragePercent))
+	}
+	if dlp := report.DLPViolations; dlp != nil {
+		parts = append(parts, fmt.Sprintf("%d DLP violations", dlp.Total))
+	}
+	if d := report.Deception; d != nil {
+		parts = append(parts, fmt.Sprintf("%d deception interactions", d.Events7d))
+	}
+	return fmt.Sprintf("%s (%s - %s): %s", report.Title,
+		report.PeriodStart.Format("2006-01-02"), report.PeriodEnd.Format("2006-01-02"), strings.Join(parts, ", "))
+}
+
+// pdfLineWidth is the number of 10pt monospaced characters that fit between 1 inch margins
+const pdfLineWidth = 78
+
+// renderReportPDF lays the report lines out as a multi-page PDF
+func renderReportPDF(report models.SecurityReport) ([]byte, error) {
+	lines, err := reportLines(report)
+	if err != nil {
+		return nil, err
+	}
+	return renderLinesPDF(report.Title, lines)
+}
+
+// renderLinesPDF lays pre-formatted text lines out as a multi-page US Letter PDF under a title.
+// The Go fonts are embedded so any Unicode text renders. Lines are set monospaced and not
+// wrapped; callers keep them within pdfLineWidth characters.
+func renderLinesPDF(title string, lines []string) ([]byte, error) {
+	pdf := fpdf.New("P", "pt", "Letter", "")
+	pdf.SetMargins(72, 52, 72)
+	pdf.SetAutoPageBreak(true, 72)
+	pdf.AddUTF8FontFromBytes("GoMono", "", gomono.TTF)
+	pdf.AddUTF8FontFromBytes("Go", "B", gobold.TTF)
+	pdf.SetTitle(title, true)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-52)
+		pdf.SetFont("GoMono", "", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "L", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Go", "B", 16)
+	pdf.CellFormat(0, 28, title, "", 1, "L", false, 0, "")
+	pdf.SetFont("GoMono", "", 10)
+	for _, line := range lines {
+		pdf.CellFormat(0, 14, line, "", 1, "L", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+func TestReportLines(t *testing.T) {
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	report := models.SecurityReport{
+		Title:       "Weekly Report",
+		PeriodStart: start,
+		PeriodEnd:   start.Add(7 * 24 * time.Hour),
+		TopThreats: &models.Statistics{
+			TotalEvents:      12,
+			UniqueAgents:     2,
+			UniqueHosts:      3,
+			EventsBySeverity: map[uint8]int64{1: 4, 4: 8},
+			EventsByHost:     map[string]int64{"web-01": 5, "db-01": 7},
+		},
+		DLPViolations: &models.DLPViolationSummary{
+			Total:       3,
+			BySeverity:  map[string]uint64{"low": 1, "critical": 2},
+			TopPolicies: []models.DLPViolationCount{{Key: "p-1", Name: "Kundendaten Ü", Count: 3}},
+		},
+		Errors: map[string]string{"deception": "timeout"},
+	}
+
+	got, err := reportLines(report)
+	if err != nil {
+		t.Fatalf("reportLines() error = %v", err)
+	}
+	want := []string{
+		"Period: 2026-03-02 00:00 UTC - 2026-03-09 00:00 UTC",
+		"",
+		"TOP THREATS",
+		"  12 events from 2 agents on 3 hosts",
+		fmt.Sprintf("  %-10s 8", eventSeverityName(4)),
+		fmt.Sprintf("  %-10s 4", eventSeverityName(1)),
+		"  host db-01               7",
+		"  host web-01              5",
+		"",
+		"DLP VIOLATIONS",
+		"  3 violations",
+		"  critical   2",
+		"  low        1",
+		"  policy Kundendaten Ü: 3",
+		"",
+		"UNAVAILABLE SECTIONS",
+		"  deception: timeout",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reportLines() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRenderLinesPDF(t *testing.T) {
+	lines := make([]string, 120)
+	for i := range lines {
+		lines[i] = "Ünïcödé ЖЗИ ΣΩ 漢"
+	}
+
+	pdf, err := renderLinesPDF("Rapport d'incident — été", lines)
+	if err != nil {
+		t.Fatalf("renderLinesPDF() error = %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.Contains(pdf, []byte("%%EOF")) {
+		t.Fatalf("renderLinesPDF() did not produce a complete PDF")
+	}
+	if pages := bytes.Count(pdf, []byte("/Type /Page\n")); pages < 3 {
+		t.Errorf("rendered %d pages, want at least 3 for %d lines", pages, len(lines))
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{`a (b) \c`, `a \(b\) \\c`},
+		{"line\r\nbreak", "line break"},
+		{"café €5", `caf\351 \2005`},
+		{"漢字", "??"},
+	}
+	for _, tt := range tests {
+		if got := pdfEscape(tt.in); got != tt.want {
+			t.Errorf("pdfEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
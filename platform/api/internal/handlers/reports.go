@@ -0,0 +1,447 @@
+// Scheduled Security Reports
+// Builds posture reports from the statistics, coverage, DLP and deception views and
+// delivers them on a cron schedule through notification channels
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// reportSections lists the available sections in rendering order
+var reportSections = []string{
+	models.ReportSectionTopThreats,
+	models.ReportSectionMITRECoverage,
+	models.ReportSectionDLPViolations,
+	models.ReportSectionDeception,
+}
+
+const (
+	defaultReportPeriodDays = 7
+	maxReportPeriodDays     = 366
+	reportQueryTimeout      = 2 * time.Minute
+)
+
+// ReportHandler generates security reports and manages their schedules
+type ReportHandler struct {
+	db        *sql.DB
+	telemetry *TelemetryHandler
+	dlp       *DLPHandler
+	deception *DeceptionHandler
+	notifier  *NotificationHandler
+	scheduler *Scheduler
+}
+
+// NewReportHandler creates a report handler that reads from the given handlers' data sources
+func NewReportHandler(db *sql.DB, telemetry *TelemetryHandler, dlp *DLPHandler, deception *DeceptionHandler, notifier *NotificationHandler, scheduler *Scheduler) *ReportHandler {
+	return &ReportHandler{
+		db:        db,
+		telemetry: telemetry,
+		dlp:       dlp,
+		deception: deception,
+		notifier:  notifier,
+		scheduler: scheduler,
+	}
+}
+
+// normalizeReportParams applies defaults and validates sections, format and period
+func normalizeReportParams(params *models.ReportParams) error {
+	if len(params.Sections) == 0 {
+		params.Sections = reportSections
+	}
+	for _, section := range params.Sections {
+		if !containsString(reportSections, section) {
+			return fmt.Errorf("unknown report section: %s (expected one of %s)", section, strings.Join(reportSections, ", "))
+		}
+	}
+
+	if params.Format == "" {
+		params.Format = models.ReportFormatHTML
+	}
+	if params.Format != models.ReportFormatHTML && params.Format != models.ReportFormatPDF {
+		return fmt.Errorf("unsupported report format: %s", params.Format)
+	}
+
+	if params.PeriodDays == 0 {
+		params.PeriodDays = defaultReportPeriodDays
+	}
+	if params.PeriodDays < 1 || params.PeriodDays > maxReportPeriodDays {
+		return fmt.Errorf("period_days must be between 1 and %d", maxReportPeriodDays)
+	}
+
+	if params.Title == "" {
+		params.Title = "Security Report"
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// buildReport collects the requested sections for a license. A section whose data source is
+// unavailable is recorded in the report's errors instead of failing the report.
+func (h *ReportHandler) buildReport(licenseID string, params models.ReportParams) models.SecurityReport {
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -params.PeriodDays)
+
+	report := models.SecurityReport{
+		LicenseID:   licenseID,
+		Title:       params.Title,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: end,
+		Sections:    params.Sections,
+		Errors:      map[string]string{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reportQueryTimeout)
+	defer cancel()
+
+	for _, section := range params.Sections {
+		switch section {
+		case models.ReportSectionTopThreats:
+			if h.telemetry.clickhouse == nil {
+				report.Errors[section] = "ClickHouse connection not available"
+				continue
+			}
+			stats, err := h.telemetry.statistics(ctx, licenseID, start, end)
+			if err != nil {
+				log.Errorf("Failed to build report statistics for %s: %v", licenseID, err)
+				report.Errors[section] = "failed to query statistics"
+				continue
+			}
+			report.TopThreats = &stats
+
+		case models.ReportSectionMITRECoverage:
+			if h.telemetry.clickhouse == nil {
+				report.Errors[section] = "ClickHouse connection not available"
+				continue
+			}
+			coverage, err := h.telemetry.mitreCoverage(ctx, licenseID)
+			if err != nil {
+				log.Errorf("Failed to build report MITRE coverage for %s: %v", licenseID, err)
+				report.Errors[section] = "failed to query MITRE coverage"
+				continue
+			}
+			report.MITRECoverage = &coverage
+
+		case models.ReportSectionDLPViolations:
+			if h.dlp.clickhouse == nil {
+				report.Errors[section] = "ClickHouse connection not available"
+				continue
+			}
+			summary, err := h.dlp.violationSummary(ctx, licenseID, start, end)
+			if err != nil {
+				log.Errorf("Failed to build report DLP summary for %s: %v", licenseID, err)
+				report.Errors[section] = "failed to query DLP violations"
+				continue
+			}
+			report.DLPViolations = &summary
+
+		case models.ReportSectionDeception:
+			stats := h.deception.statistics(licenseID)
+			report.Deception = &stats
+		}
+	}
+
+	if len(report.Errors) == 0 {
+		report.Errors = nil
+	}
+	return report
+}
+
+// reportFilename names a rendered report after its title and end date
+func reportFilename(report models.SecurityReport, extension string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, report.Title)
+	if name == "" {
+		name = "security-report"
+	}
+	return fmt.Sprintf("%s-%s.%s", strings.ToLower(name), report.PeriodEnd.Format("2006-01-02"), extension)
+}
+
+// RunScheduledReport is the scheduler job for report schedules: it builds the report and
+// delivers it to every configured channel. The run fails only if no channel received it.
+func (h *ReportHandler) RunScheduledReport(job models.ScheduledJob) (string, error) {
+	if job.LicenseID == "" {
+		return "", fmt.Errorf("report schedule has no license")
+	}
+
+	var params models.ReportParams
+	paramsJSON, _ := json.Marshal(job.Params)
+	if err := json.Unmarshal(paramsJSON, &params); err != nil {
+		return "", fmt.Errorf("invalid report parameters: %w", err)
+	}
+	if err := normalizeReportParams(&params); err != nil {
+		return "", err
+	}
+	if len(params.ChannelIDs) == 0 {
+		return "", fmt.Errorf("report schedule has no delivery channels")
+	}
+
+	report := h.buildReport(job.LicenseID, params)
+	body, err := renderReportHTML(report)
+	if err != nil {
+		return "", fmt.Errorf("failed to render report: %w", err)
+	}
+
+	var attachments []emailAttachment
+	if params.Format == models.ReportFormatPDF {
+		pdf, err := renderReportPDF(report)
+		if err != nil {
+			return "", fmt.Errorf("failed to render report PDF: %w", err)
+		}
+		attachments = append(attachments, emailAttachment{
+			filename:    reportFilename(report, "pdf"),
+			contentType: "application/pdf",
+			data:        pdf,
+		})
+	}
+
+	subject := fmt.Sprintf("%s: %s - %s", report.Title, report.PeriodStart.Format("2006-01-02"), report.PeriodEnd.Format("2006-01-02"))
+	summary := reportSummary(report)
+	metadata := map[string]interface{}{
+		"scheduled_job_id": job.ID,
+		"report_sections":  params.Sections,
+		"report_format":    params.Format,
+	}
+
+	delivered := 0
+	failures := []string{}
+	for _, channelID := range params.ChannelIDs {
+		if err := h.notifier.deliverToChannel(channelID, subject, body, summary, "low", attachments, metadata); err != nil {
+			log.Warnf("Failed to deliver report %s to channel %s: %v", job.ID, channelID, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", channelID, err))
+			continue
+		}
+		delivered++
+	}
+
+	if delivered == 0 {
+		return "", fmt.Errorf("report not delivered: %s", strings.Join(failures, "; "))
+	}
+
+	result := fmt.Sprintf("report delivered to %d of %d channels", delivered, len(params.ChannelIDs))
+	if len(report.Errors) > 0 {
+		result += fmt.Sprintf(" (%d sections unavailable)", len(report.Errors))
+	}
+	return result, nil
+}
+
+// reportSchedule decodes a report job's params for API responses
+func reportSchedule(job models.ScheduledJob) models.ReportSchedule {
+	schedule := models.ReportSchedule{ScheduledJob: job}
+	paramsJSON, _ := json.Marshal(job.Params)
+	json.Unmarshal(paramsJSON, &schedule.Report)
+	schedule.Params = nil
+	return schedule
+}
+
+// CreateReportSchedule schedules a recurring report for a license
+func (h *ReportHandler) CreateReportSchedule(c *gin.Context) {
+	var req models.CreateReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	params := models.ReportParams{
+		Title:      req.Title,
+		Sections:   req.Sections,
+		Format:     req.Format,
+		ChannelIDs: req.ChannelIDs,
+		PeriodDays: req.PeriodDays,
+	}
+	if err := normalizeReportParams(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Channels must exist and belong to the license
+	var owned int
+	if err := h.db.QueryRow(
+		"SELECT COUNT(*) FROM notification_channels WHERE license_id = $1 AND id::text = ANY($2) AND deleted_at IS NULL",
+		req.LicenseID, pq.Array(params.ChannelIDs),
+	).Scan(&owned); err != nil {
+		log.Errorf("Failed to verify report channels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify notification channels"})
+		return
+	}
+	if owned != len(params.ChannelIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "One or more notification channels not found for this license"})
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = h.scheduler.timezone
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	next, err := h.scheduler.NextRun(req.CronExpression, req.Timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var nextRun *time.Time
+	if enabled {
+		nextRun = &next
+	}
+
+	paramsJSON, _ := json.Marshal(params)
+
+	job, err := scanScheduledJob(h.db.QueryRow(`
+		INSERT INTO scheduled_jobs (license_id, name, job_type, cron_expression, timezone, enabled, params, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+scheduledJobColumns,
+		req.LicenseID, req.Name, models.ScheduledJobReport, req.CronExpression, req.Timezone, enabled, paramsJSON, nextRun,
+	))
+	if err != nil {
+		log.Errorf("Failed to create report schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report schedule"})
+		return
+	}
+
+	log.Infof("Created report schedule %s for license %s (%q %s)", job.Name, job.LicenseID, job.CronExpression, job.Timezone)
+
+	c.JSON(http.StatusCreated, reportSchedule(job))
+}
+
+// ListReportSchedules lists report schedules, optionally filtered by ?license_id=
+func (h *ReportHandler) ListReportSchedules(c *gin.Context) {
+	query := "SELECT " + scheduledJobColumns + " FROM scheduled_jobs WHERE job_type = $1"
+	args := []interface{}{models.ScheduledJobReport}
+
+	if licenseID := c.Query("license_id"); licenseID != "" {
+		args = append(args, licenseID)
+		query += fmt.Sprintf(" AND license_id = $%d", len(args))
+	}
+	query += " ORDER BY name"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list report schedules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list report schedules"})
+		return
+	}
+	defer rows.Close()
+
+	schedules := []models.ReportSchedule{}
+	for rows.Next() {
+		job, err := scanScheduledJob(rows)
+		if err != nil {
+			log.Errorf("Failed to scan report schedule: %v", err)
+			continue
+		}
+		schedules = append(schedules, reportSchedule(job))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"total":     len(schedules),
+	})
+}
+
+// DeleteReportSchedule removes a report schedule
+func (h *ReportHandler) DeleteReportSchedule(c *gin.Context) {
+	result, err := h.db.Exec(
+		"DELETE FROM scheduled_jobs WHERE id = $1 AND job_type = $2 AND ($3 = '' OR license_id::text = $3)",
+		c.Param("id"), models.ScheduledJobReport, principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete report schedule: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report schedule"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report schedule deleted successfully"})
+}
+
+// PreviewReport renders a report on demand without delivering it.
+// Query: license_id (required), sections (comma-separated), period_days, format (html, pdf or json)
+func (h *ReportHandler) PreviewReport(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id is required"})
+		return
+	}
+
+	params := models.ReportParams{
+		Title:  c.Query("title"),
+		Format: c.DefaultQuery("format", models.ReportFormatHTML),
+	}
+	if sections := c.Query("sections"); sections != "" {
+		params.Sections = strings.Split(sections, ",")
+	}
+	if days := c.Query("period_days"); days != "" {
+		parsed, err := strconv.Atoi(days)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period_days must be a number"})
+			return
+		}
+		params.PeriodDays = parsed
+	}
+
+	asJSON := params.Format == "json"
+	if asJSON {
+		params.Format = models.ReportFormatHTML
+	}
+	if err := normalizeReportParams(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := h.buildReport(licenseID, params)
+
+	switch {
+	case asJSON:
+		c.JSON(http.StatusOK, report)
+	case params.Format == models.ReportFormatPDF:
+		pdf, err := renderReportPDF(report)
+		if err != nil {
+			log.Errorf("Failed to render report PDF: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", reportFilename(report, "pdf")))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	default:
+		body, err := renderReportHTML(report)
+		if err != nil {
+			log.Errorf("Failed to render report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(body))
+	}
+}
@@ -0,0 +1,475 @@
+// Hot Storage Retention Handler
+// Enforces per-license HotStorageDays on the ClickHouse telemetry table and its hourly rollup, coordinated with the data lake archive
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// defaultHotStorageDays applies to tenants without a data lake configuration
+const defaultHotStorageDays = 90
+
+// statsRollupTable summarises telemetry_events by hour. It expires with the events it counts, so
+// statistics never cover hours whose events are gone, nor miss hours whose events are still held.
+const statsRollupTable = "telemetry_stats_hourly"
+
+// agentLogRetentionDays is how long agent_logs lines are kept outside legal holds
+const agentLogRetentionDays = 30
+
+// RetentionManager applies hot storage retention to telemetry_events and its hourly rollup, and
+// expires agent_logs.
+// Telemetry tenant_id values are license IDs.
+type RetentionManager struct {
+	db          *sql.DB
+	clickhouse  driver.Conn
+	defaultDays int // Hot storage days for tenants without a data lake configuration
+}
+
+// NewRetentionManager creates a new retention manager
+func NewRetentionManager(db *sql.DB, ch driver.Conn, defaultDays int) *RetentionManager {
+	if defaultDays < 1 {
+		defaultDays = defaultHotStorageDays
+	}
+	return &RetentionManager{db: db, clickhouse: ch, defaultDays: defaultDays}
+}
+
+// StartRetentionJob runs retention enforcement periodically in the background
+func StartRetentionJob(db *sql.DB, ch driver.Conn, defaultDays int, interval time.Duration) *RetentionManager {
+	manager := NewRetentionManager(db, ch, defaultDays)
+	if ch == nil {
+		log.Warn("ClickHouse not available, hot storage retention job disabled")
+		return manager
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := manager.Apply(false)
+			if err != nil {
+				log.Errorf("Retention enforcement failed: %v", err)
+				continue
+			}
+			log.Infof("Retention enforced: %d partitions dropped, %d tenants evaluated",
+				len(result.DroppedPartitions), len(result.Tenants))
+		}
+	}()
+
+	log.Infof("Hot storage retention job started (interval: %v)", interval)
+	return manager
+}
+
+// tenantRetentionConfig is the retention-relevant part of a data lake configuration
+type tenantRetentionConfig struct {
+	licenseID       string
+	hotStorageDays  int
+	autoArchive     bool
+	archivedThrough *time.Time
+	legalHoldFrom   *time.Time // Nothing from here on may be deleted
+}
+
+// Apply enforces retention once. With dryRun, the plan is computed but nothing is changed.
+func (m *RetentionManager) Apply(dryRun bool) (models.RetentionRunResult, error) {
+	result := models.RetentionRunResult{
+		DryRun:            dryRun,
+		StartedAt:         time.Now(),
+		DroppedPartitions: []string{},
+		Tenants:           []models.TenantRetention{},
+	}
+
+	if m.clickhouse == nil {
+		return result, fmt.Errorf("clickhouse connection not available")
+	}
+
+	configs, err := m.loadConfigs()
+	if err != nil {
+		return result, err
+	}
+	holds, err := m.loadLegalHolds()
+	if err != nil {
+		return result, err
+	}
+	for i := range configs {
+		if from, ok := holds[configs[i].licenseID]; ok {
+			configs[i].legalHoldFrom = &from
+		}
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// The longest retention bounds what may be dropped at partition level
+	maxHotDays := m.defaultDays
+	for _, cfg := range configs {
+		if cfg.hotStorageDays > maxHotDays {
+			maxHotDays = cfg.hotStorageDays
+		}
+	}
+
+	// Held data must outlive partition drops, whichever license it belongs to
+	var earliestHold time.Time
+	for _, from := range holds {
+		if earliestHold.IsZero() || from.Before(earliestHold) {
+			earliestHold = from
+		}
+	}
+
+	// 1. Tables created by older releases carry a table TTL, which expires rows whether or not
+	// they were archived or are under legal hold; retention only removes data in the steps below
+	if !dryRun {
+		for _, table := range []string{"telemetry_events", statsRollupTable, "agent_logs"} {
+			if err := removeTableTTL(ctx, m.clickhouse, table); err != nil {
+				return result, fmt.Errorf("failed to remove %s TTL: %w", table, err)
+			}
+		}
+	}
+
+	// 2. Per-tenant deletes for tenants retaining less than the table maximum
+	for _, cfg := range configs {
+		tenant := m.planTenant(cfg, now)
+
+		if tenant.EffectiveCutoff != nil && cfg.hotStorageDays < maxHotDays {
+			var expired uint64
+			if err := m.clickhouse.QueryRow(ctx,
+				"SELECT count() FROM telemetry_events WHERE tenant_id = ? AND timestamp < ?",
+				cfg.licenseID, *tenant.EffectiveCutoff).Scan(&expired); err != nil {
+				log.Errorf("Failed to count expired events for %s: %v", cfg.licenseID, err)
+				tenant.Action = models.RetentionActionError
+				result.Tenants = append(result.Tenants, tenant)
+				continue
+			}
+			tenant.ExpiredEvents = int64(expired)
+
+			if expired == 0 {
+				tenant.Action = models.RetentionActionNone
+			} else if !dryRun {
+				// Mutation; ClickHouse rewrites the affected parts asynchronously
+				err := m.clickhouse.Exec(ctx,
+					"ALTER TABLE telemetry_events DELETE WHERE tenant_id = ? AND timestamp < ?",
+					cfg.licenseID, *tenant.EffectiveCutoff)
+				if err != nil {
+					log.Errorf("Failed to expire events for %s: %v", cfg.licenseID, err)
+					tenant.Action = models.RetentionActionError
+				} else {
+					// The hour the cutoff falls in keeps its rollup while some of its events remain
+					err := m.clickhouse.Exec(ctx,
+						"ALTER TABLE "+statsRollupTable+" DELETE WHERE tenant_id = ? AND event_hour < ?",
+						cfg.licenseID, tenant.EffectiveCutoff.Truncate(time.Hour))
+					if err != nil {
+						log.Errorf("Failed to expire hourly statistics for %s: %v", cfg.licenseID, err)
+						tenant.Action = models.RetentionActionError
+					}
+				}
+			}
+		} else if tenant.Action == models.RetentionActionDelete {
+			// Covered by partition drops
+			tenant.Action = models.RetentionActionNone
+		}
+
+		result.Tenants = append(result.Tenants, tenant)
+	}
+
+	// 3. Drop whole monthly partitions older than every tenant's retention,
+	// provided no tenant is still waiting on its archive for that range
+	partitionCutoff := now.AddDate(0, 0, -maxHotDays)
+	for _, cfg := range configs {
+		if cfg.autoArchive && (cfg.archivedThrough == nil || cfg.archivedThrough.Before(partitionCutoff)) {
+			if cfg.archivedThrough == nil {
+				partitionCutoff = time.Time{}
+				break
+			}
+			partitionCutoff = *cfg.archivedThrough
+		}
+	}
+	if !partitionCutoff.IsZero() && !earliestHold.IsZero() && earliestHold.Before(partitionCutoff) {
+		partitionCutoff = earliestHold
+	}
+
+	if !partitionCutoff.IsZero() {
+		partitions, err := m.expiredPartitions(ctx, "telemetry_events", partitionCutoff)
+		if err != nil {
+			return result, err
+		}
+		for _, partition := range partitions {
+			if !dryRun {
+				if err := m.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE telemetry_events DROP PARTITION ID '%s'", partition)); err != nil {
+					log.Errorf("Failed to drop partition %s: %v", partition, err)
+					continue
+				}
+			}
+			result.DroppedPartitions = append(result.DroppedPartitions, partition)
+		}
+
+		// The rollup is partitioned by month the same way
+		if !dryRun {
+			rollupPartitions, err := m.expiredPartitions(ctx, statsRollupTable, partitionCutoff)
+			if err != nil {
+				return result, err
+			}
+			for _, partition := range rollupPartitions {
+				if err := m.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID '%s'", statsRollupTable, partition)); err != nil {
+					log.Errorf("Failed to drop %s partition %s: %v", statsRollupTable, partition, err)
+				}
+			}
+		}
+	}
+
+	// 4. Agent log lines, which are not archived
+	if !dryRun {
+		if err := m.expireAgentLogs(ctx, now, holds); err != nil {
+			return result, err
+		}
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result, nil
+}
+
+// expireAgentLogs removes agent log lines older than agentLogRetentionDays. Daily partitions are
+// dropped up to the earliest legal hold; past that, lines are deleted for every license except
+// from the start of its own hold on.
+func (m *RetentionManager) expireAgentLogs(ctx context.Context, now time.Time, holds map[string]time.Time) error {
+	cutoff := now.AddDate(0, 0, -agentLogRetentionDays)
+	partitionCutoff := cutoff
+	for _, from := range holds {
+		if from.Before(partitionCutoff) {
+			partitionCutoff = from
+		}
+	}
+
+	partitions, err := m.expiredPartitions(ctx, "agent_logs", partitionCutoff)
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		if err := m.clickhouse.Exec(ctx, fmt.Sprintf("ALTER TABLE agent_logs DROP PARTITION ID '%s'", partition)); err != nil {
+			log.Errorf("Failed to drop agent_logs partition %s: %v", partition, err)
+		}
+	}
+	if !partitionCutoff.Before(cutoff) {
+		return nil
+	}
+
+	filter := "timestamp < ?"
+	args := []interface{}{cutoff}
+	for licenseID, from := range holds {
+		if from.Before(cutoff) {
+			filter += " AND NOT (tenant_id = ? AND timestamp >= ?)"
+			args = append(args, licenseID, from)
+		}
+	}
+	var expired uint64
+	if err := m.clickhouse.QueryRow(ctx, "SELECT count() FROM agent_logs WHERE "+filter, args...).Scan(&expired); err != nil {
+		return fmt.Errorf("failed to count expired agent logs: %w", err)
+	}
+	if expired == 0 {
+		return nil
+	}
+	if err := m.clickhouse.Exec(ctx, "ALTER TABLE agent_logs DELETE WHERE "+filter, args...); err != nil {
+		log.Errorf("Failed to expire agent logs: %v", err)
+	}
+	return nil
+}
+
+// planTenant computes the retention cutoff for a tenant, holding back anything not yet archived
+func (m *RetentionManager) planTenant(cfg tenantRetentionConfig, now time.Time) models.TenantRetention {
+	cutoff := now.AddDate(0, 0, -cfg.hotStorageDays)
+	tenant := models.TenantRetention{
+		LicenseID:       cfg.licenseID,
+		HotStorageDays:  cfg.hotStorageDays,
+		AutoArchive:     cfg.autoArchive,
+		Cutoff:          cutoff,
+		ArchivedThrough: cfg.archivedThrough,
+		LegalHoldFrom:   cfg.legalHoldFrom,
+		Action:          models.RetentionActionDelete,
+	}
+
+	var effective time.Time
+	switch {
+	case !cfg.autoArchive:
+		effective = cutoff
+	case cfg.archivedThrough == nil:
+		tenant.Action = models.RetentionActionHoldForArchive
+		return tenant
+	case cfg.archivedThrough.Before(cutoff):
+		effective = *cfg.archivedThrough
+		tenant.Action = models.RetentionActionHoldForArchive
+	default:
+		effective = cutoff
+	}
+
+	if cfg.legalHoldFrom != nil && cfg.legalHoldFrom.Before(effective) {
+		effective = *cfg.legalHoldFrom
+		tenant.Action = models.RetentionActionLegalHold
+	}
+	tenant.EffectiveCutoff = &effective
+	return tenant
+}
+
+// loadConfigs reads hot storage settings and archive progress for every license with a data lake config
+func (m *RetentionManager) loadConfigs() ([]tenantRetentionConfig, error) {
+	rows, err := m.db.Query(`
+		SELECT c.license_id, COALESCE(c.hot_storage_days, $1), COALESCE(c.enable_auto_archive, FALSE) AND c.enabled,
+		       (SELECT MAX(d.end_date) FROM archived_datasets d WHERE d.license_id = c.license_id)
+		FROM data_lake_configs c
+	`, m.defaultDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retention configs: %w", err)
+	}
+	defer rows.Close()
+
+	configs := []tenantRetentionConfig{}
+	for rows.Next() {
+		var cfg tenantRetentionConfig
+		var archivedThrough sql.NullTime
+		if err := rows.Scan(&cfg.licenseID, &cfg.hotStorageDays, &cfg.autoArchive, &archivedThrough); err != nil {
+			continue
+		}
+		if cfg.hotStorageDays < 1 {
+			cfg.hotStorageDays = 1
+		}
+		if archivedThrough.Valid {
+			cfg.archivedThrough = &archivedThrough.Time
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, rows.Err()
+}
+
+// loadLegalHolds returns the start of the earliest active legal hold per license
+func (m *RetentionManager) loadLegalHolds() (map[string]time.Time, error) {
+	rows, err := m.db.Query(`
+		SELECT license_id, MIN(start_time) FROM legal_holds WHERE status = $1 GROUP BY license_id
+	`, models.LegalHoldActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load legal holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := map[string]time.Time{}
+	for rows.Next() {
+		var licenseID string
+		var from time.Time
+		if err := rows.Scan(&licenseID, &from); err != nil {
+			return nil, fmt.Errorf("failed to scan legal hold: %w", err)
+		}
+		holds[licenseID] = from
+	}
+	return holds, rows.Err()
+}
+
+// expiredPartitions lists a table's monthly or daily partitions whose entire range is before the cutoff
+func (m *RetentionManager) expiredPartitions(ctx context.Context, table string, cutoff time.Time) ([]string, error) {
+	rows, err := m.clickhouse.Query(ctx, `
+		SELECT DISTINCT partition_id
+		FROM system.parts
+		WHERE database = currentDatabase() AND table = ? AND active
+		ORDER BY partition_id
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	partitions := []string{}
+	for rows.Next() {
+		var partitionID string
+		if err := rows.Scan(&partitionID); err != nil {
+			continue
+		}
+
+		// Partition IDs are toYYYYMM, or toYYYYMMDD for daily partitions, of the table's time column
+		id, err := strconv.Atoi(partitionID)
+		if err != nil {
+			continue
+		}
+		var partitionEnd time.Time
+		switch len(partitionID) {
+		case 6:
+			partitionEnd = time.Date(id/100, time.Month(id%100), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+		case 8:
+			partitionEnd = time.Date(id/10000, time.Month(id/100%100), id%100, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+		default:
+			continue
+		}
+		if !partitionEnd.After(cutoff) {
+			partitions = append(partitions, partitionID)
+		}
+	}
+
+	return partitions, nil
+}
+
+// removeTableTTL removes the table TTL of a ClickHouse table, if it has one
+func removeTableTTL(ctx context.Context, ch driver.Conn, table string) error {
+	var hasTTL uint8
+	if err := ch.QueryRow(ctx, `
+		SELECT position(engine_full, ' TTL ') > 0
+		FROM system.tables
+		WHERE database = currentDatabase() AND name = ?
+	`, table).Scan(&hasTTL); err != nil {
+		return err
+	}
+	if hasTTL == 0 {
+		return nil
+	}
+	return ch.Exec(ctx, "ALTER TABLE "+table+" REMOVE TTL")
+}
+
+// RetentionHandler exposes hot storage retention status and manual enforcement
+type RetentionHandler struct {
+	manager *RetentionManager
+}
+
+// NewRetentionHandler creates a new retention handler
+func NewRetentionHandler(manager *RetentionManager) *RetentionHandler {
+	return &RetentionHandler{manager: manager}
+}
+
+// GetRetentionPlan returns what the next retention run would do without changing anything
+func (h *RetentionHandler) GetRetentionPlan(c *gin.Context) {
+	if h.manager.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	result, err := h.manager.Apply(true)
+	if err != nil {
+		log.Errorf("Failed to plan retention: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute retention plan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ApplyRetention enforces retention immediately
+func (h *RetentionHandler) ApplyRetention(c *gin.Context) {
+	if h.manager.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	result, err := h.manager.Apply(c.Query("dry_run") == "true")
+	if err != nil {
+		log.Errorf("Failed to apply retention: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply retention"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,680 @@
+// SAML 2.0 Service Provider
+// Authentication requests, XML signature verification and assertion validation
+
+package handlers
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	samlProtocolNS  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+	xmlDSigNS       = "http://www.w3.org/2000/09/xmldsig#"
+	xmlNamespace    = "http://www.w3.org/XML/1998/namespace"
+
+	samlStatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer          = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlBindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlNameIDEmail     = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlNameIDTransient = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	xmlExcC14N       = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	xmlDSigEnveloped = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+
+	// samlMaxResponseSize bounds the body posted to the assertion consumer service
+	samlMaxResponseSize = 1 << 20
+
+	// samlMaxDepth bounds element nesting in responses; real ones are about ten levels deep
+	samlMaxDepth = 64
+
+	// samlClockSkew is the clock difference tolerated when checking assertion lifetimes
+	samlClockSkew = time.Minute
+)
+
+// samlSignatureAlgorithms and samlDigestAlgorithms are the XML signature algorithms accepted
+// from identity providers. SHA-1 is not accepted.
+var (
+	samlSignatureAlgorithms = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+	}
+	samlDigestAlgorithms = map[string]crypto.Hash{
+		"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+		"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+	}
+)
+
+// samlProvider is a configured SAML identity provider with its signing certificate
+type samlProvider struct {
+	config models.SSOProvider
+	key    *rsa.PublicKey
+}
+
+func newSAMLProvider(config models.SSOProvider) (*samlProvider, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(config.Certificate)); block != nil {
+		der = block.Bytes
+	} else {
+		// IdP metadata carries the certificate as bare base64
+		decoded, err := base64.StdEncoding.DecodeString(stripXMLSpace(config.Certificate))
+		if err != nil {
+			return nil, errors.New("certificate must be PEM or base64 encoded")
+		}
+		der = decoded
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate must hold an RSA key")
+	}
+
+	if config.EntityID == "" {
+		config.EntityID = config.RedirectURL
+	}
+	return &samlProvider{config: config, key: key}, nil
+}
+
+// authnRequestURL returns the IdP URL that starts a login, carrying an AuthnRequest with the
+// given ID through the HTTP-Redirect binding
+func (p *samlProvider) authnRequestURL(requestID, relayState string, now time.Time) (string, error) {
+	var request bytes.Buffer
+	fmt.Fprintf(&request, `<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`,
+		samlProtocolNS, samlAssertionNS, xmlEscape(requestID), now.UTC().Format(time.RFC3339),
+		xmlEscape(p.config.SSOURL), xmlEscape(p.config.RedirectURL), samlBindingPOST)
+	fmt.Fprintf(&request, `<saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+		xmlEscape(p.config.EntityID))
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(request.Bytes()); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(p.config.SSOURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid sso_url: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	query.Set("RelayState", relayState)
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// parseResponse verifies a base64 encoded SAML response posted to the assertion consumer
+// service and returns the identity it asserts. Only content covered by a valid signature is
+// read: the assertion must be signed itself or sit in a signed response. The response must
+// answer the AuthnRequest with ID requestID; unsolicited responses are refused.
+func (p *samlProvider) parseResponse(encoded, requestID string, now time.Time) (*ssoIdentity, error) {
+	raw, err := base64.StdEncoding.DecodeString(stripXMLSpace(encoded))
+	if err != nil {
+		return nil, errors.New("SAMLResponse is not base64 encoded")
+	}
+	response, err := parseXMLDocument(raw)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SAML response: %w", err)
+	}
+	if !response.is(samlProtocolNS, "Response") {
+		return nil, errors.New("document is not a SAML response")
+	}
+	if response.child(samlAssertionNS, "EncryptedAssertion") != nil {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.children(samlAssertionNS, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("response holds %d assertions, expected one", len(assertions))
+	}
+	assertion := assertions[0]
+
+	responseSigned, err := verifyEnvelopedSignature(response, response, p.key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response signature: %w", err)
+	}
+	assertionSigned, err := verifyEnvelopedSignature(response, assertion, p.key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid assertion signature: %w", err)
+	}
+	if !responseSigned && !assertionSigned {
+		return nil, errors.New("response is not signed")
+	}
+
+	if destination := response.attr("Destination"); destination != "" && destination != p.config.RedirectURL {
+		return nil, fmt.Errorf("response is destined for %q", destination)
+	}
+	if response.attr("InResponseTo") != requestID {
+		return nil, errors.New("response does not answer this login's request")
+	}
+	if code := response.child(samlProtocolNS, "Status").child(samlProtocolNS, "StatusCode").attr("Value"); code != samlStatusSuccess {
+		return nil, fmt.Errorf("identity provider returned status %q", code)
+	}
+	if issuer := response.child(samlAssertionNS, "Issuer"); issuer != nil && issuer.text() != p.config.Issuer {
+		return nil, fmt.Errorf("response was issued by %q", issuer.text())
+	}
+	if issuer := assertion.child(samlAssertionNS, "Issuer").text(); issuer != p.config.Issuer {
+		return nil, fmt.Errorf("assertion was issued by %q", issuer)
+	}
+
+	conditions := assertion.child(samlAssertionNS, "Conditions")
+	if conditions == nil {
+		return nil, errors.New("assertion has no conditions")
+	}
+	if err := samlCheckValidity(conditions, now); err != nil {
+		return nil, err
+	}
+	restrictions := conditions.children(samlAssertionNS, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, errors.New("assertion is not restricted to an audience")
+	}
+	for _, restriction := range restrictions {
+		if !containsString(restriction.childTexts(samlAssertionNS, "Audience"), p.config.EntityID) {
+			return nil, errors.New("assertion is not intended for this service provider")
+		}
+	}
+
+	subject := assertion.child(samlAssertionNS, "Subject")
+	nameID := subject.child(samlAssertionNS, "NameID")
+	if nameID.text() == "" {
+		return nil, errors.New("assertion has no NameID")
+	}
+	if nameID.attr("Format") == samlNameIDTransient {
+		return nil, errors.New("transient NameIDs cannot identify users, configure a persistent NameID")
+	}
+	if !p.bearerConfirmed(subject, requestID, now) {
+		return nil, errors.New("assertion has no valid bearer subject confirmation")
+	}
+
+	attributes := map[string][]string{}
+	for _, statement := range assertion.children(samlAssertionNS, "AttributeStatement") {
+		for _, attribute := range statement.children(samlAssertionNS, "Attribute") {
+			name := attribute.attr("Name")
+			attributes[name] = append(attributes[name], attribute.childTexts(samlAssertionNS, "AttributeValue")...)
+		}
+	}
+
+	identity := &ssoIdentity{
+		Subject: nameID.text(),
+		Groups:  attributes[p.config.GroupsClaim],
+	}
+	if names := attributes[p.config.NameAttribute]; p.config.NameAttribute != "" && len(names) > 0 {
+		identity.FullName = names[0]
+	}
+	if p.config.EmailAttribute != "" {
+		if emails := attributes[p.config.EmailAttribute]; len(emails) > 0 {
+			identity.Email = emails[0]
+		}
+	} else if nameID.attr("Format") == samlNameIDEmail {
+		identity.Email = identity.Subject
+	}
+	return identity, nil
+}
+
+// bearerConfirmed reports whether the subject has a bearer confirmation for this service
+// provider, answering requestID, that has not expired
+func (p *samlProvider) bearerConfirmed(subject *xmlNode, requestID string, now time.Time) bool {
+	for _, confirmation := range subject.children(samlAssertionNS, "SubjectConfirmation") {
+		if confirmation.attr("Method") != samlBearer {
+			continue
+		}
+		data := confirmation.child(samlAssertionNS, "SubjectConfirmationData")
+		if data.attr("Recipient") != p.config.RedirectURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		if data.attr("NotOnOrAfter") == "" || data.attr("NotBefore") != "" {
+			continue
+		}
+		if samlCheckValidity(data, now) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// samlCheckValidity checks an element's NotBefore and NotOnOrAfter attributes
+func samlCheckValidity(el *xmlNode, now time.Time) error {
+	if notBefore := el.attr("NotBefore"); notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("invalid NotBefore %q", notBefore)
+		}
+		if now.Add(samlClockSkew).Before(t) {
+			return errors.New("assertion is not valid yet")
+		}
+	}
+	if notOnOrAfter := el.attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("invalid NotOnOrAfter %q", notOnOrAfter)
+		}
+		if !now.Add(-samlClockSkew).Before(t) {
+			return errors.New("assertion has expired")
+		}
+	}
+	return nil
+}
+
+// verifyEnvelopedSignature checks the XML signature that is a direct child of el and reports
+// whether there was one. The signature must reference el by an ID that is unique in the
+// document, so a signature over one element cannot vouch for another, and is verified with
+// the configured key only; keys embedded in the document are ignored.
+func verifyEnvelopedSignature(root, el *xmlNode, key *rsa.PublicKey) (bool, error) {
+	signatures := el.children(xmlDSigNS, "Signature")
+	if len(signatures) == 0 {
+		return false, nil
+	}
+	if len(signatures) > 1 {
+		return false, errors.New("element has more than one signature")
+	}
+	signature := signatures[0]
+
+	id := el.attr("ID")
+	if id == "" {
+		return false, errors.New("signed element has no ID")
+	}
+	if root.countID(id) != 1 {
+		return false, errors.New("signed element ID is not unique")
+	}
+
+	signedInfo := signature.child(xmlDSigNS, "SignedInfo")
+	c14nMethod := signedInfo.child(xmlDSigNS, "CanonicalizationMethod")
+	if c14nMethod.attr("Algorithm") != xmlExcC14N {
+		return false, fmt.Errorf("unsupported canonicalization method %q", c14nMethod.attr("Algorithm"))
+	}
+	signatureMethod := signedInfo.child(xmlDSigNS, "SignatureMethod").attr("Algorithm")
+	signatureHash, ok := samlSignatureAlgorithms[signatureMethod]
+	if !ok {
+		return false, fmt.Errorf("unsupported signature method %q", signatureMethod)
+	}
+
+	references := signedInfo.children(xmlDSigNS, "Reference")
+	if len(references) != 1 {
+		return false, errors.New("signature must have exactly one reference")
+	}
+	reference := references[0]
+	if reference.attr("URI") != "#"+id {
+		return false, errors.New("signature does not reference the signed element")
+	}
+
+	var enveloped, exclusive bool
+	var inclusive []string
+	for _, transform := range reference.child(xmlDSigNS, "Transforms").children(xmlDSigNS, "Transform") {
+		switch algorithm := transform.attr("Algorithm"); algorithm {
+		case xmlDSigEnveloped:
+			enveloped = true
+		case xmlExcC14N:
+			exclusive = true
+			inclusive = inclusiveNamespaces(transform)
+		default:
+			return false, fmt.Errorf("unsupported transform %q", algorithm)
+		}
+	}
+	if !enveloped || !exclusive {
+		return false, errors.New("reference must use the enveloped signature and exclusive C14N transforms")
+	}
+
+	digestMethod := reference.child(xmlDSigNS, "DigestMethod").attr("Algorithm")
+	digestHash, ok := samlDigestAlgorithms[digestMethod]
+	if !ok {
+		return false, fmt.Errorf("unsupported digest method %q", digestMethod)
+	}
+	digestValue, err := base64.StdEncoding.DecodeString(stripXMLSpace(reference.child(xmlDSigNS, "DigestValue").text()))
+	if err != nil {
+		return false, errors.New("malformed digest value")
+	}
+	digest := digestHash.New()
+	canonicalize(digest, el, signature, inclusive)
+	if subtle.ConstantTimeCompare(digest.Sum(nil), digestValue) != 1 {
+		return false, errors.New("digest of the signed element does not match")
+	}
+
+	signatureValue, err := base64.StdEncoding.DecodeString(stripXMLSpace(signature.child(xmlDSigNS, "SignatureValue").text()))
+	if err != nil {
+		return false, errors.New("malformed signature value")
+	}
+	signed := signatureHash.New()
+	canonicalize(signed, signedInfo, nil, inclusiveNamespaces(c14nMethod))
+	if err := rsa.VerifyPKCS1v15(key, signatureHash, signed.Sum(nil), signatureValue); err != nil {
+		return false, errors.New("signature verification failed")
+	}
+	return true, nil
+}
+
+// inclusiveNamespaces returns the InclusiveNamespaces prefix list of an exclusive C14N
+// transform, "#default" standing for the default namespace
+func inclusiveNamespaces(method *xmlNode) []string {
+	prefixes := strings.Fields(method.child(xmlExcC14N, "InclusiveNamespaces").attr("PrefixList"))
+	for i, prefix := range prefixes {
+		if prefix == "#default" {
+			prefixes[i] = ""
+		}
+	}
+	return prefixes
+}
+
+// xmlNode is an element of a parsed XML document. Signature verification needs the document
+// as written, prefixes and namespace declarations included, which encoding/xml's unmarshaling
+// does not preserve.
+type xmlNode struct {
+	parent  *xmlNode
+	prefix  string
+	local   string
+	space   string    // Namespace URI
+	nsDecls []xmlAttr // Namespace declarations: the declared prefix and its URI
+	attrs   []xmlAttr
+	content []xmlContent
+}
+
+type xmlAttr struct {
+	prefix string
+	local  string
+	space  string
+	value  string
+}
+
+// xmlContent is a child element or a run of character data
+type xmlContent struct {
+	element *xmlNode
+	text    string
+}
+
+// parseXMLDocument parses a document into xmlNodes. Documents with a DTD are refused, so no
+// entity can expand or redefine content, and comments are dropped as canonicalization does.
+func parseXMLDocument(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *xmlNode
+	depth := 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root != nil && current == nil {
+				return nil, errors.New("document has more than one root element")
+			}
+			if depth++; depth > samlMaxDepth {
+				return nil, errors.New("document is nested too deeply")
+			}
+			node := &xmlNode{parent: current, prefix: t.Name.Space, local: t.Name.Local}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					node.nsDecls = append(node.nsDecls, xmlAttr{prefix: a.Name.Local, value: a.Value})
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					node.nsDecls = append(node.nsDecls, xmlAttr{value: a.Value})
+				default:
+					node.attrs = append(node.attrs, xmlAttr{prefix: a.Name.Space, local: a.Name.Local, value: a.Value})
+				}
+			}
+			var ok bool
+			if node.space, ok = node.lookupNamespace(node.prefix); !ok {
+				return nil, fmt.Errorf("undeclared namespace prefix %q", node.prefix)
+			}
+			for i := range node.attrs {
+				if node.attrs[i].prefix == "" {
+					continue
+				}
+				if node.attrs[i].space, ok = node.lookupNamespace(node.attrs[i].prefix); !ok {
+					return nil, fmt.Errorf("undeclared namespace prefix %q", node.attrs[i].prefix)
+				}
+			}
+
+			if current == nil {
+				root = node
+			} else {
+				current.content = append(current.content, xmlContent{element: node})
+			}
+			current = node
+
+		case xml.EndElement:
+			if current == nil || t.Name.Space != current.prefix || t.Name.Local != current.local {
+				return nil, errors.New("mismatched end element")
+			}
+			current = current.parent
+			depth--
+
+		case xml.CharData:
+			if current == nil {
+				if len(bytes.TrimSpace(t)) > 0 {
+					return nil, errors.New("text outside the root element")
+				}
+				continue
+			}
+			current.content = append(current.content, xmlContent{text: string(t)})
+
+		case xml.ProcInst:
+			if t.Target != "xml" || root != nil {
+				return nil, errors.New("processing instructions are not supported")
+			}
+
+		case xml.Directive:
+			return nil, errors.New("DTDs are not supported")
+		}
+	}
+	if root == nil || current != nil {
+		return nil, errors.New("document is incomplete")
+	}
+	return root, nil
+}
+
+// lookupNamespace resolves a prefix, "" being the default namespace, in the element's scope
+func (n *xmlNode) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for node := n; node != nil; node = node.parent {
+		for _, decl := range node.nsDecls {
+			if decl.prefix == prefix {
+				return decl.value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+func (n *xmlNode) is(space, local string) bool {
+	return n != nil && n.space == space && n.local == local
+}
+
+// attr returns the value of an unqualified attribute. Lookups on a nil node return "", so
+// optional elements can be chained.
+func (n *xmlNode) attr(local string) string {
+	if n == nil {
+		return ""
+	}
+	for _, a := range n.attrs {
+		if a.prefix == "" && a.local == local {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the given name, or nil
+func (n *xmlNode) child(space, local string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, content := range n.content {
+		if content.element.is(space, local) {
+			return content.element
+		}
+	}
+	return nil
+}
+
+// children returns the child elements with the given name
+func (n *xmlNode) children(space, local string) []*xmlNode {
+	var elements []*xmlNode
+	if n == nil {
+		return elements
+	}
+	for _, content := range n.content {
+		if content.element.is(space, local) {
+			elements = append(elements, content.element)
+		}
+	}
+	return elements
+}
+
+// text returns the element's own character data with surrounding whitespace removed
+func (n *xmlNode) text() string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, content := range n.content {
+		if content.element == nil {
+			b.WriteString(content.text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// childTexts returns the text of each child element with the given name
+func (n *xmlNode) childTexts(space, local string) []string {
+	var texts []string
+	for _, el := range n.children(space, local) {
+		texts = append(texts, el.text())
+	}
+	return texts
+}
+
+// countID counts the elements in the subtree whose ID attribute is id
+func (n *xmlNode) countID(id string) int {
+	count := 0
+	if n.attr("ID") == id {
+		count++
+	}
+	for _, content := range n.content {
+		if content.element != nil {
+			count += content.element.countID(id)
+		}
+	}
+	return count
+}
+
+var (
+	c14nTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// canonicalize writes the subtree rooted at el in exclusive XML canonicalization without
+// comments, leaving out the element exclude (the enveloped signature). inclusive lists the
+// prefixes that are declared wherever they are in scope rather than only where used.
+func canonicalize(w io.Writer, el, exclude *xmlNode, inclusive []string) {
+	canonicalizeElement(w, el, exclude, inclusive, map[string]string{})
+}
+
+// canonicalizeElement writes one element. rendered holds the namespace declarations output
+// ancestors wrote; a namespace is only declared again when its URI differs.
+func canonicalizeElement(w io.Writer, el, exclude *xmlNode, inclusive []string, rendered map[string]string) {
+	used := []string{el.prefix}
+	for _, a := range el.attrs {
+		if a.prefix != "" {
+			used = append(used, a.prefix)
+		}
+	}
+	for _, prefix := range inclusive {
+		if _, ok := el.lookupNamespace(prefix); ok {
+			used = append(used, prefix)
+		}
+	}
+
+	scope := make(map[string]string, len(rendered)+len(used))
+	for prefix, uri := range rendered {
+		scope[prefix] = uri
+	}
+	var decls []xmlAttr
+	for _, prefix := range used {
+		if prefix == "xml" {
+			continue
+		}
+		uri, _ := el.lookupNamespace(prefix)
+		if scope[prefix] == uri {
+			continue
+		}
+		scope[prefix] = uri
+		decls = append(decls, xmlAttr{prefix: prefix, value: uri})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	attrs := append([]xmlAttr(nil), el.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	name := qualifiedName(el.prefix, el.local)
+	io.WriteString(w, "<"+name)
+	for _, decl := range decls {
+		io.WriteString(w, " "+qualifiedName("xmlns", decl.prefix)+`="`+c14nAttrEscaper.Replace(decl.value)+`"`)
+	}
+	for _, a := range attrs {
+		io.WriteString(w, " "+qualifiedName(a.prefix, a.local)+`="`+c14nAttrEscaper.Replace(a.value)+`"`)
+	}
+	io.WriteString(w, ">")
+	for _, content := range el.content {
+		switch {
+		case content.element == nil:
+			io.WriteString(w, c14nTextEscaper.Replace(content.text))
+		case content.element != exclude:
+			canonicalizeElement(w, content.element, exclude, inclusive, scope)
+		}
+	}
+	io.WriteString(w, "</"+name+">")
+}
+
+// qualifiedName joins a prefix and a local name; qualifiedName("xmlns", "") is "xmlns"
+func qualifiedName(prefix, local string) string {
+	switch {
+	case prefix == "":
+		return local
+	case local == "":
+		return prefix
+	}
+	return prefix + ":" + local
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func stripXMLSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+func TestCanonicalize(t *testing.T) {
+	const doc = `<samlp:Response xmlns:samlp="urn:p" xmlns:saml="urn:a" xmlns:xs="urn:xs" xmlns:xsi="urn:xsi" ID="r1">` +
+		`<saml:Assertion b="2" a="1" ID="a1" xmlns="urn:d"><!-- dropped -->` +
+		`<saml:Issuer>idp &amp; co &lt;x&gt;</saml:Issuer>` +
+		`<x:Other xmlns:x="urn:x" x:attr="v&#xA;" plain='"q"'/>` +
+		`<saml:AttributeValue xsi:type="xs:string"><![CDATA[a<b]]></saml:AttributeValue>` +
+		`<child/></saml:Assertion></samlp:Response>`
+
+	tests := []struct {
+		name      string
+		inclusive []string
+		want      string
+	}{
+		{"exclusive", nil,
+			`<saml:Assertion xmlns:saml="urn:a" ID="a1" a="1" b="2">` +
+				`<saml:Issuer>idp &amp; co &lt;x&gt;</saml:Issuer>` +
+				`<x:Other xmlns:x="urn:x" plain="&quot;q&quot;" x:attr="v&#xA;"></x:Other>` +
+				`<saml:AttributeValue xmlns:xsi="urn:xsi" xsi:type="xs:string">a&lt;b</saml:AttributeValue>` +
+				`<child xmlns="urn:d"></child></saml:Assertion>`},
+		{"inclusive prefixes", []string{"xs", ""},
+			`<saml:Assertion xmlns="urn:d" xmlns:saml="urn:a" xmlns:xs="urn:xs" ID="a1" a="1" b="2">` +
+				`<saml:Issuer>idp &amp; co &lt;x&gt;</saml:Issuer>` +
+				`<x:Other xmlns:x="urn:x" plain="&quot;q&quot;" x:attr="v&#xA;"></x:Other>` +
+				`<saml:AttributeValue xmlns:xsi="urn:xsi" xsi:type="xs:string">a&lt;b</saml:AttributeValue>` +
+				`<child></child></saml:Assertion>`},
+	}
+
+	root, err := parseXMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatalf("parseXMLDocument() error = %v", err)
+	}
+	assertion := root.child("urn:a", "Assertion")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			canonicalize(&b, assertion, nil, tt.inclusive)
+			if b.String() != tt.want {
+				t.Errorf("canonicalize() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseXMLDocumentRejects(t *testing.T) {
+	tests := map[string]string{
+		"dtd":              `<!DOCTYPE r [<!ENTITY e "x">]><r>&e;</r>`,
+		"undeclared":       `<p:r/>`,
+		"mismatched":       `<a></b>`,
+		"two roots":        `<a/><b/>`,
+		"processing instr": `<a><?pi x?></a>`,
+		"incomplete":       `<a><b></b>`,
+		"deep":             strings.Repeat("<a>", samlMaxDepth+1) + strings.Repeat("</a>", samlMaxDepth+1),
+	}
+	for name, doc := range tests {
+		if _, err := parseXMLDocument([]byte(doc)); err == nil {
+			t.Errorf("%s: parseXMLDocument() accepted %q", name, doc)
+		}
+	}
+}
+
+const (
+	testSAMLACS      = "https://sentinel.example.com/api/v1/auth/sso/acs"
+	testSAMLIssuer   = "https://idp.example.com/metadata"
+	testSAMLRequest  = "_req1"
+	testSAMLAssertNS = `xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"`
+)
+
+// testSAMLAssertion builds an unsigned assertion; edit rewrites it before signing
+func testSAMLAssertion(id string, now time.Time) string {
+	ts := func(d time.Duration) string { return now.Add(d).UTC().Format(time.RFC3339) }
+	return `<saml:Assertion ` + testSAMLAssertNS + ` xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="` + id + `" Version="2.0" IssueInstant="` + ts(0) + `">` +
+		`<saml:Issuer>` + testSAMLIssuer + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">u-123</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + testSAMLRequest + `" NotOnOrAfter="` + ts(5*time.Minute) + `" Recipient="` + testSAMLACS + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + ts(-time.Minute) + `" NotOnOrAfter="` + ts(5*time.Minute) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + testSAMLACS + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="mail"><saml:AttributeValue xsi:type="xs:string">Alice@Example.com</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="groups"><saml:AttributeValue>soc</saml:AttributeValue><saml:AttributeValue>admins</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement></saml:Assertion>`
+}
+
+func testSAMLResponse(assertion string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_resp1" Version="2.0" InResponseTo="` + testSAMLRequest + `" Destination="` + testSAMLACS + `">` +
+		`<saml:Issuer ` + testSAMLAssertNS + `>` + testSAMLIssuer + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		assertion + `</samlp:Response>`
+}
+
+// signSAML inserts an enveloped signature over the element with the given ID, after its
+// first child (the Issuer) as SAML requires
+func signSAML(t *testing.T, key *rsa.PrivateKey, doc, id string) string {
+	t.Helper()
+	root, err := parseXMLDocument([]byte(doc))
+	if err != nil {
+		t.Fatalf("parseXMLDocument() error = %v", err)
+	}
+	el := root.findID(id)
+	var canonical strings.Builder
+	canonicalize(&canonical, el, nil, []string{"xs"})
+	digest := sha256.Sum256([]byte(canonical.String()))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference></ds:SignedInfo>`
+	signedInfoNode, err := parseXMLDocument([]byte(signedInfo))
+	if err != nil {
+		t.Fatalf("parseXMLDocument(SignedInfo) error = %v", err)
+	}
+	var canonicalInfo strings.Builder
+	canonicalize(&canonicalInfo, signedInfoNode, nil, nil)
+	hashed := sha256.Sum256([]byte(canonicalInfo.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() error = %v", err)
+	}
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue></ds:Signature>`
+
+	issuerEnd := strings.Index(doc[strings.Index(doc, `ID="`+id+`"`):], "</saml:Issuer>") + strings.Index(doc, `ID="`+id+`"`) + len("</saml:Issuer>")
+	return doc[:issuerEnd] + signature + doc[issuerEnd:]
+}
+
+func (n *xmlNode) findID(id string) *xmlNode {
+	if n.attr("ID") == id {
+		return n
+	}
+	for _, content := range n.content {
+		if content.element != nil {
+			if found := content.element.findID(id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func testSAMLProvider(t *testing.T) (*samlProvider, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	provider, err := newSAMLProvider(models.SSOProvider{
+		ID:             "idp",
+		Type:           models.SSOTypeSAML,
+		Issuer:         testSAMLIssuer,
+		RedirectURL:    testSAMLACS,
+		SSOURL:         "https://idp.example.com/sso",
+		Certificate:    string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		EmailAttribute: "mail",
+		GroupsClaim:    "groups",
+	})
+	if err != nil {
+		t.Fatalf("newSAMLProvider() error = %v", err)
+	}
+	return provider, key
+}
+
+func TestSAMLParseResponse(t *testing.T) {
+	provider, key := testSAMLProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	now := time.Now()
+	assertion := testSAMLAssertion("_a1", now)
+	signedAssertion := signSAML(t, key, assertion, "_a1")
+
+	tests := []struct {
+		name      string
+		response  string
+		requestID string
+		now       time.Time
+		wantErr   bool
+	}{
+		{"signed assertion", testSAMLResponse(signedAssertion), testSAMLRequest, now, false},
+		{"signed response", signSAML(t, key, testSAMLResponse(assertion), "_resp1"), testSAMLRequest, now, false},
+		{"unsigned", testSAMLResponse(assertion), testSAMLRequest, now, true},
+		{"signed by another key", testSAMLResponse(signSAML(t, otherKey, assertion, "_a1")), testSAMLRequest, now, true},
+		{"tampered attribute", testSAMLResponse(strings.Replace(signedAssertion, "Alice@", "Mallory@", 1)), testSAMLRequest, now, true},
+		{"comment injected in NameID", testSAMLResponse(strings.Replace(signedAssertion, "u-123<", "u-123<!---->x<", 1)), testSAMLRequest, now, true},
+		{"other request", testSAMLResponse(signedAssertion), "_req2", now, true},
+		{"expired", testSAMLResponse(signedAssertion), testSAMLRequest, now.Add(10 * time.Minute), true},
+		{"not yet valid", testSAMLResponse(signedAssertion), testSAMLRequest, now.Add(-10 * time.Minute), true},
+		{"second assertion", testSAMLResponse(testSAMLAssertion("_evil", now) + signedAssertion), testSAMLRequest, now, true},
+		{"signed assertion moved into extensions", strings.Replace(testSAMLResponse(strings.Replace(assertion, "u-123", "admin", 1)),
+			"<samlp:Status>", "<samlp:Extensions>"+signedAssertion+"</samlp:Extensions><samlp:Status>", 1), testSAMLRequest, now, true},
+		{"duplicate ID", strings.Replace(testSAMLResponse(signedAssertion),
+			"<samlp:Status>", `<samlp:Extensions><x ID="_a1"/></samlp:Extensions><samlp:Status>`, 1), testSAMLRequest, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := base64.StdEncoding.EncodeToString([]byte(tt.response))
+			identity, err := provider.parseResponse(encoded, tt.requestID, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := fmt.Sprint(ssoIdentity{Subject: "u-123", Email: "Alice@Example.com", Groups: []string{"soc", "admins"}})
+			if got := fmt.Sprint(*identity); got != want {
+				t.Errorf("parseResponse() = %s, want %s", got, want)
+			}
+		})
+	}
+}
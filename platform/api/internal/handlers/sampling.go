@@ -0,0 +1,255 @@
+// Event Sampling
+// Per-license sampling and aggregation policies applied by the consumer before insert
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	samplingDefaultMinSeverity = 2 // Medium and above are always stored
+	rollupDefaultHours         = 24
+	rollupMaxHours             = 24 * 31
+)
+
+// samplableEventTypes are the event types a sampling policy can be set for
+var samplableEventTypes = []string{
+	"process_start", "process_terminate", "file_access", "file_modify",
+	"file_delete", "network_conn", "registry_modify",
+}
+
+// SamplingHandler manages sampling policies. Policies live in ClickHouse, where the consumer
+// reads them; changes take effect within the consumer's refresh interval.
+type SamplingHandler struct {
+	clickhouse driver.Conn
+}
+
+// NewSamplingHandler creates a new sampling handler
+func NewSamplingHandler(ch driver.Conn) *SamplingHandler {
+	return &SamplingHandler{clickhouse: ch}
+}
+
+// ListSamplingPolicies lists the sampling policies of a license
+func (h *SamplingHandler) ListSamplingPolicies(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rows, err := h.clickhouse.Query(c.Request.Context(), `
+		SELECT tenant_id, event_type, toString(mode), sample_rate, keep_min_severity, updated_by, updated_at
+		FROM sampling_policies FINAL
+		WHERE tenant_id = ? AND deleted = 0
+		ORDER BY event_type
+	`, licenseID)
+	if err != nil {
+		log.Errorf("Failed to list sampling policies: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sampling policies"})
+		return
+	}
+	defer rows.Close()
+
+	policies := []models.SamplingPolicy{}
+	for rows.Next() {
+		var p models.SamplingPolicy
+		if err := rows.Scan(&p.LicenseID, &p.EventType, &p.Mode, &p.SampleRate, &p.KeepMinSeverity, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+			log.Errorf("Failed to scan sampling policy: %v", err)
+			continue
+		}
+		policies = append(policies, p)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": policies, "count": len(policies)})
+}
+
+// SetSamplingPolicy creates or replaces the sampling policy for an event type
+func (h *SamplingHandler) SetSamplingPolicy(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	eventType := c.Param("event_type")
+	if containsString(models.UnsampledEventTypes, eventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s events are security-relevant and cannot be sampled", eventType)})
+		return
+	}
+	if !containsString(samplableEventTypes, eventType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event_type", "event_types": samplableEventTypes})
+		return
+	}
+
+	var req models.SetSamplingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	switch req.Mode {
+	case models.SamplingModeSample:
+		if req.SampleRate < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sample_rate must be at least 2 in sample mode"})
+			return
+		}
+	case models.SamplingModeAggregate:
+		req.SampleRate = 0
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be sample or aggregate"})
+		return
+	}
+	minSeverity := uint8(samplingDefaultMinSeverity)
+	if req.KeepMinSeverity != nil {
+		minSeverity = *req.KeepMinSeverity
+	}
+	if minSeverity > 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "keep_min_severity must be between 0 and 4"})
+		return
+	}
+
+	policy := models.SamplingPolicy{
+		LicenseID:       req.LicenseID,
+		EventType:       eventType,
+		Mode:            req.Mode,
+		SampleRate:      req.SampleRate,
+		KeepMinSeverity: minSeverity,
+		UpdatedBy:       req.UpdatedBy,
+		UpdatedAt:       time.Now().UTC(),
+	}
+	if err := h.writePolicy(c.Request.Context(), policy, false); err != nil {
+		log.Errorf("Failed to save sampling policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save sampling policy"})
+		return
+	}
+
+	log.Infof("Sampling policy for %s events of license %s set to %s", eventType, req.LicenseID, req.Mode)
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteSamplingPolicy removes the sampling policy for an event type, so all events of that
+// type are stored again
+func (h *SamplingHandler) DeleteSamplingPolicy(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	var count uint64
+	if err := h.clickhouse.QueryRow(c.Request.Context(), `
+		SELECT count() FROM sampling_policies FINAL
+		WHERE tenant_id = ? AND event_type = ? AND deleted = 0
+	`, licenseID, c.Param("event_type")).Scan(&count); err != nil {
+		log.Errorf("Failed to look up sampling policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sampling policy"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sampling policy not found"})
+		return
+	}
+
+	policy := models.SamplingPolicy{
+		LicenseID:  licenseID,
+		EventType:  c.Param("event_type"),
+		Mode:       models.SamplingModeSample,
+		SampleRate: 1,
+		UpdatedAt:  time.Now().UTC(),
+	}
+	if err := h.writePolicy(c.Request.Context(), policy, true); err != nil {
+		log.Errorf("Failed to delete sampling policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sampling policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sampling policy deleted successfully"})
+}
+
+// writePolicy inserts a new version of a policy; the ReplacingMergeTree keeps the latest
+func (h *SamplingHandler) writePolicy(ctx context.Context, p models.SamplingPolicy, deleted bool) error {
+	var deletedFlag uint8
+	if deleted {
+		deletedFlag = 1
+	}
+	return h.clickhouse.Exec(ctx, `
+		INSERT INTO sampling_policies (tenant_id, event_type, mode, sample_rate, keep_min_severity, updated_by, updated_at, deleted)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.LicenseID, p.EventType, p.Mode, p.SampleRate, p.KeepMinSeverity, p.UpdatedBy, p.UpdatedAt, deletedFlag)
+}
+
+// ListRollups returns the per-minute counts of events that were aggregated or sampled out
+func (h *SamplingHandler) ListRollups(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(rollupDefaultHours)))
+	if hours <= 0 || hours > rollupMaxHours {
+		hours = rollupDefaultHours
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if limit < 1 || limit > 10000 {
+		limit = 1000
+	}
+
+	query := `
+		SELECT minute, event_type, agent_id, hostname, process_name, sum(event_count)
+		FROM telemetry_rollups
+		WHERE tenant_id = ? AND minute >= ?`
+	args := []interface{}{licenseID, time.Now().UTC().Add(-time.Duration(hours) * time.Hour)}
+	for _, filter := range []string{"event_type", "agent_id", "hostname"} {
+		if value := c.Query(filter); value != "" {
+			query += " AND " + filter + " = ?"
+			args = append(args, value)
+		}
+	}
+	query += `
+		GROUP BY minute, event_type, agent_id, hostname, process_name
+		ORDER BY minute DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := h.clickhouse.Query(c.Request.Context(), query, args...)
+	if err != nil {
+		log.Errorf("Failed to query event rollups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query event rollups"})
+		return
+	}
+	defer rows.Close()
+
+	rollups := []models.EventRollup{}
+	for rows.Next() {
+		var r models.EventRollup
+		if err := rows.Scan(&r.Minute, &r.EventType, &r.AgentID, &r.Hostname, &r.ProcessName, &r.EventCount); err != nil {
+			log.Errorf("Failed to scan event rollup: %v", err)
+			continue
+		}
+		rollups = append(rollups, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": rollups, "count": len(rollups)})
+}
@@ -0,0 +1,555 @@
+// Job Scheduler
+// Runs registered background jobs on persisted cron schedules, each in its own time zone
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// maxSchedulePreview caps the run times returned by a schedule preview
+	maxSchedulePreview = 20
+
+	// scheduleStaleAfter is how long a run may stay "running" before it is presumed lost
+	// (e.g. the server restarted mid-run) and the job may be claimed again
+	scheduleStaleAfter = 6 * time.Hour
+)
+
+// ScheduledJobFunc runs one occurrence of a scheduled job and returns a short summary of the result
+type ScheduledJobFunc func(job models.ScheduledJob) (string, error)
+
+// Scheduler runs due jobs from scheduled_jobs. Due rows are claimed with SKIP LOCKED and their
+// next run is advanced before the job starts, so several API replicas can run the scheduler
+// without firing a job twice. A run missed while no scheduler was up fires once on startup,
+// and a job whose previous run is still going is skipped rather than overlapped.
+type Scheduler struct {
+	db       *sql.DB
+	timezone string // Default for schedules created without one
+
+	mu       sync.RWMutex
+	jobTypes map[string]ScheduledJobFunc
+}
+
+// NewScheduler creates a scheduler; timezone defaults to UTC
+func NewScheduler(db *sql.DB, timezone string) *Scheduler {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		log.Warnf("Unknown scheduler time zone %q, using UTC", timezone)
+		timezone = "UTC"
+	}
+	return &Scheduler{db: db, timezone: timezone, jobTypes: map[string]ScheduledJobFunc{}}
+}
+
+// Register makes a job type available to schedules
+func (s *Scheduler) Register(jobType string, fn ScheduledJobFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobTypes[jobType] = fn
+}
+
+// JobTypes lists the registered job types
+func (s *Scheduler) JobTypes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	types := make([]string, 0, len(s.jobTypes))
+	for jobType := range s.jobTypes {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (s *Scheduler) jobFunc(jobType string) (ScheduledJobFunc, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn, ok := s.jobTypes[jobType]
+	return fn, ok
+}
+
+// Start polls for due jobs in the background
+func (s *Scheduler) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.tick()
+			<-ticker.C
+		}
+	}()
+
+	log.Infof("Job scheduler started (interval: %v, default time zone: %s)", interval, s.timezone)
+}
+
+// NextRun returns the next run of expr after t; an empty timezone uses the scheduler default
+func (s *Scheduler) NextRun(expr, timezone string, t time.Time) (time.Time, error) {
+	if timezone == "" {
+		timezone = s.timezone
+	}
+	return nextCronRun(expr, timezone, t)
+}
+
+func (s *Scheduler) tick() {
+	s.planUnscheduled()
+
+	jobs, err := s.claimDue()
+	if err != nil {
+		log.Errorf("Failed to claim due scheduled jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		go s.execute(job)
+	}
+}
+
+// planUnscheduled fills in next_run_at for enabled jobs that have none, e.g. seeded rows
+func (s *Scheduler) planUnscheduled() {
+	rows, err := s.db.Query(`
+		SELECT id, cron_expression, timezone FROM scheduled_jobs
+		WHERE enabled = TRUE AND next_run_at IS NULL
+	`)
+	if err != nil {
+		log.Errorf("Failed to load unscheduled jobs: %v", err)
+		return
+	}
+
+	type pending struct{ id, expr, timezone string }
+	jobs := []pending{}
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.expr, &p.timezone); err == nil {
+			jobs = append(jobs, p)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, p := range jobs {
+		next, err := s.NextRun(p.expr, p.timezone, now)
+		if err != nil {
+			log.Warnf("Scheduled job %s has an invalid schedule: %v", p.id, err)
+			continue
+		}
+		if _, err := s.db.Exec("UPDATE scheduled_jobs SET next_run_at = $1 WHERE id = $2", next, p.id); err != nil {
+			log.Errorf("Failed to schedule job %s: %v", p.id, err)
+		}
+	}
+}
+
+// claimDue locks due jobs, advances their next run and marks them running
+func (s *Scheduler) claimDue() ([]models.ScheduledJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+scheduledJobColumns+` FROM scheduled_jobs
+		WHERE enabled = TRUE AND next_run_at <= NOW()
+		  AND (COALESCE(last_status, '') <> $1 OR last_run_at < $2)
+		ORDER BY next_run_at
+		FOR UPDATE SKIP LOCKED
+	`, models.ScheduleRunRunning, time.Now().Add(-scheduleStaleAfter))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []models.ScheduledJob{}
+	for rows.Next() {
+		job, err := scanScheduledJob(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+
+	now := time.Now()
+	for i := range jobs {
+		// Next run is computed from now rather than the missed slot, so downtime doesn't cause a burst of catch-up runs
+		var next *time.Time
+		if t, err := s.NextRun(jobs[i].CronExpression, jobs[i].Timezone, now); err == nil {
+			next = &t
+		}
+		if _, err := tx.Exec(`
+			UPDATE scheduled_jobs
+			SET next_run_at = $1, last_run_at = $2, last_status = $3
+			WHERE id = $4
+		`, next, now, models.ScheduleRunRunning, jobs[i].ID); err != nil {
+			return nil, err
+		}
+		jobs[i].NextRunAt = next
+		jobs[i].LastRunAt = &now
+		jobs[i].LastStatus = models.ScheduleRunRunning
+	}
+
+	return jobs, tx.Commit()
+}
+
+// execute runs a claimed job and records the outcome
+func (s *Scheduler) execute(job models.ScheduledJob) {
+	started := time.Now()
+	status := models.ScheduleRunSucceeded
+	var result, errMsg string
+
+	fn, ok := s.jobFunc(job.JobType)
+	if !ok {
+		status = models.ScheduleRunFailed
+		errMsg = fmt.Sprintf("job type %s is not available on this server", job.JobType)
+	} else {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					status = models.ScheduleRunFailed
+					errMsg = fmt.Sprintf("job panicked: %v", r)
+				}
+			}()
+
+			var err error
+			result, err = fn(job)
+			if err != nil {
+				status = models.ScheduleRunFailed
+				errMsg = err.Error()
+			}
+		}()
+	}
+
+	duration := time.Since(started).Milliseconds()
+	if _, err := s.db.Exec(`
+		UPDATE scheduled_jobs
+		SET last_status = $1, last_result = $2, last_error = $3, last_duration_ms = $4
+		WHERE id = $5
+	`, status, result, errMsg, duration, job.ID); err != nil {
+		// The job stays marked running until scheduleStaleAfter lets it be claimed again
+		log.Errorf("Failed to record outcome of scheduled job %s (%s): %v", job.Name, job.JobType, err)
+	}
+
+	if status == models.ScheduleRunFailed {
+		log.Errorf("Scheduled job %s (%s) failed: %s", job.Name, job.JobType, errMsg)
+		return
+	}
+	log.Infof("Scheduled job %s (%s) completed in %dms: %s", job.Name, job.JobType, duration, result)
+}
+
+const scheduledJobColumns = `id, COALESCE(license_id::text, ''), name, job_type, cron_expression, timezone, enabled, params,
+	last_run_at, COALESCE(last_status, ''), COALESCE(last_result, ''), COALESCE(last_error, ''),
+	COALESCE(last_duration_ms, 0), next_run_at, created_at, updated_at`
+
+// scanScheduledJob scans a row selected with scheduledJobColumns
+func scanScheduledJob(row rowScanner) (models.ScheduledJob, error) {
+	var job models.ScheduledJob
+	var paramsJSON []byte
+	var lastRun, nextRun sql.NullTime
+
+	err := row.Scan(&job.ID, &job.LicenseID, &job.Name, &job.JobType, &job.CronExpression, &job.Timezone,
+		&job.Enabled, &paramsJSON, &lastRun, &job.LastStatus, &job.LastResult, &job.LastError,
+		&job.LastDurationMs, &nextRun, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return job, err
+	}
+
+	json.Unmarshal(paramsJSON, &job.Params)
+	if lastRun.Valid {
+		job.LastRunAt = &lastRun.Time
+	}
+	if nextRun.Valid {
+		job.NextRunAt = &nextRun.Time
+	}
+	return job, nil
+}
+
+// SchedulerHandler exposes schedule management
+type SchedulerHandler struct {
+	db        *sql.DB
+	scheduler *Scheduler
+}
+
+// NewSchedulerHandler creates a new scheduler handler
+func NewSchedulerHandler(db *sql.DB, scheduler *Scheduler) *SchedulerHandler {
+	return &SchedulerHandler{db: db, scheduler: scheduler}
+}
+
+// ListJobTypes lists the job types schedules may use
+func (h *SchedulerHandler) ListJobTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"job_types":        h.scheduler.JobTypes(),
+		"default_timezone": h.scheduler.timezone,
+	})
+}
+
+// PreviewSchedule returns the next run times of an expression without saving it
+func (h *SchedulerHandler) PreviewSchedule(c *gin.Context) {
+	var req models.SchedulePreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.Count < 1 || req.Count > maxSchedulePreview {
+		req.Count = 5
+	}
+	if req.Timezone == "" {
+		req.Timezone = h.scheduler.timezone
+	}
+
+	runs := []time.Time{}
+	t := time.Now()
+	for i := 0; i < req.Count; i++ {
+		next, err := h.scheduler.NextRun(req.CronExpression, req.Timezone, t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		runs = append(runs, next)
+		t = next
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cron_expression": req.CronExpression,
+		"timezone":        req.Timezone,
+		"next_runs":       runs,
+	})
+}
+
+// ListScheduledJobs lists schedules, optionally filtered by ?license_id= and ?job_type=.
+// Callers confined to a license only see their license's schedules.
+func (h *SchedulerHandler) ListScheduledJobs(c *gin.Context) {
+	query := "SELECT " + scheduledJobColumns + " FROM scheduled_jobs WHERE 1=1"
+	args := []interface{}{}
+
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		licenseID = principalLicense(c)
+	}
+	if licenseID != "" {
+		args = append(args, licenseID)
+		query += fmt.Sprintf(" AND license_id = $%d", len(args))
+	}
+	if jobType := c.Query("job_type"); jobType != "" {
+		args = append(args, jobType)
+		query += fmt.Sprintf(" AND job_type = $%d", len(args))
+	}
+	query += " ORDER BY name"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list scheduled jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list scheduled jobs"})
+		return
+	}
+	defer rows.Close()
+
+	jobs := []models.ScheduledJob{}
+	for rows.Next() {
+		job, err := scanScheduledJob(rows)
+		if err != nil {
+			log.Errorf("Failed to scan scheduled job: %v", err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"total": len(jobs),
+	})
+}
+
+// GetScheduledJob returns one schedule with its last and next run
+func (h *SchedulerHandler) GetScheduledJob(c *gin.Context) {
+	job, err := scanScheduledJob(h.db.QueryRow(
+		"SELECT "+scheduledJobColumns+" FROM scheduled_jobs WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get scheduled job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CreateScheduledJob creates a schedule for a registered job type
+func (h *SchedulerHandler) CreateScheduledJob(c *gin.Context) {
+	var req models.CreateScheduledJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if _, ok := h.scheduler.jobFunc(req.JobType); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown job type: %s", req.JobType)})
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = h.scheduler.timezone
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	next, err := h.scheduler.NextRun(req.CronExpression, req.Timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var nextRun *time.Time
+	if enabled {
+		nextRun = &next
+	}
+
+	var licenseID *string
+	if req.LicenseID != "" {
+		licenseID = &req.LicenseID
+	}
+	paramsJSON, _ := json.Marshal(req.Params)
+
+	job, err := scanScheduledJob(h.db.QueryRow(`
+		INSERT INTO scheduled_jobs (license_id, name, job_type, cron_expression, timezone, enabled, params, next_run_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+scheduledJobColumns,
+		licenseID, req.Name, req.JobType, req.CronExpression, req.Timezone, enabled, paramsJSON, nextRun,
+	))
+	if err != nil {
+		log.Errorf("Failed to create scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create scheduled job"})
+		return
+	}
+
+	log.Infof("Created scheduled job %s (%s, %q %s)", job.Name, job.JobType, job.CronExpression, job.Timezone)
+
+	c.JSON(http.StatusCreated, job)
+}
+
+// UpdateScheduledJob changes a schedule; the next run is recomputed from now
+func (h *SchedulerHandler) UpdateScheduledJob(c *gin.Context) {
+	var req models.UpdateScheduledJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	job, err := scanScheduledJob(h.db.QueryRow(
+		"SELECT "+scheduledJobColumns+" FROM scheduled_jobs WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to get scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled job"})
+		return
+	}
+
+	if req.Name != nil {
+		job.Name = *req.Name
+	}
+	if req.CronExpression != nil {
+		job.CronExpression = *req.CronExpression
+	}
+	if req.Timezone != nil {
+		job.Timezone = *req.Timezone
+	}
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+	if req.Params != nil {
+		job.Params = *req.Params
+	}
+
+	next, err := h.scheduler.NextRun(job.CronExpression, job.Timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	job.NextRunAt = nil
+	if job.Enabled {
+		job.NextRunAt = &next
+	}
+
+	paramsJSON, _ := json.Marshal(job.Params)
+	job, err = scanScheduledJob(h.db.QueryRow(`
+		UPDATE scheduled_jobs
+		SET name = $1, cron_expression = $2, timezone = $3, enabled = $4, params = $5,
+		    next_run_at = $6, updated_at = NOW()
+		WHERE id = $7 AND ($8 = '' OR license_id::text = $8)
+		RETURNING `+scheduledJobColumns,
+		job.Name, job.CronExpression, job.Timezone, job.Enabled, paramsJSON, job.NextRunAt, job.ID, principalLicense(c),
+	))
+	if err != nil {
+		log.Errorf("Failed to update scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scheduled job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// DeleteScheduledJob removes a schedule
+func (h *SchedulerHandler) DeleteScheduledJob(c *gin.Context) {
+	result, err := h.db.Exec(
+		"DELETE FROM scheduled_jobs WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete scheduled job"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled job deleted successfully"})
+}
+
+// RunScheduledJob triggers a schedule immediately without changing its next run
+func (h *SchedulerHandler) RunScheduledJob(c *gin.Context) {
+	job, err := scanScheduledJob(h.db.QueryRow(`
+		UPDATE scheduled_jobs
+		SET last_run_at = NOW(), last_status = $1
+		WHERE id = $2 AND ($3 = '' OR license_id::text = $3)
+		RETURNING `+scheduledJobColumns,
+		models.ScheduleRunRunning, c.Param("id"), principalLicense(c),
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled job not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to start scheduled job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start scheduled job"})
+		return
+	}
+
+	go h.scheduler.execute(job)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Scheduled job started",
+		"job":     job,
+	})
+}
@@ -0,0 +1,184 @@
+// Built-in Scheduled Jobs
+// Adapters that let the scheduler drive the platform's existing background work
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+	"github.com/sentinel-enterprise/platform/license/service"
+)
+
+// RegisterBuiltinJobs registers the platform's job types. Jobs whose dependency is not
+// configured (e.g. no license service) are left unregistered.
+func RegisterBuiltinJobs(s *Scheduler, db *sql.DB, licService *service.LicenseService, correlationEngine *CorrelationEngine, retentionManager *RetentionManager, logRetentionManager *LogRetentionManager, baselineEngine *BaselineEngine, watchlistEngine *WatchlistEngine) {
+	s.Register(models.ScheduledJobArchive, archiveJob(NewDataLakeHandler(db)))
+	s.Register(models.ScheduledJobMITREImport, mitreImportJob(NewMITREHandler(db)))
+
+	s.Register(models.ScheduledJobTicketSync, func(job models.ScheduledJob) (string, error) {
+		result, err := NewNotificationHandler(db).SyncTickets(job.LicenseID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d tickets of resolved alerts checked, %d closed, %d failed",
+			result.Checked, result.Closed, result.Failed), nil
+	})
+
+	if retentionManager != nil {
+		s.Register(models.ScheduledJobRetention, func(job models.ScheduledJob) (string, error) {
+			result, err := retentionManager.Apply(false)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d partitions dropped, %d tenants evaluated",
+				len(result.DroppedPartitions), len(result.Tenants)), nil
+		})
+	}
+
+	if logRetentionManager != nil {
+		s.Register(models.ScheduledJobLogRetention, func(job models.ScheduledJob) (string, error) {
+			result, err := logRetentionManager.Apply(false)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d notification log partitions dropped, %d notification logs and %d audit log entries expired",
+				len(result.NotificationLogs.DroppedPartitions), result.NotificationLogs.ExpiredEntries, result.AuditLog.ExpiredEntries), nil
+		})
+	}
+
+	if correlationEngine != nil {
+		s.Register(models.ScheduledJobCorrelation, func(job models.ScheduledJob) (string, error) {
+			result, err := correlationEngine.Run()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d rules evaluated, %d alerts correlated, %d cases created",
+				result.RulesEvaluated, result.AlertsCorrelated, result.CasesCreated), nil
+		})
+	}
+
+	if baselineEngine != nil {
+		s.Register(models.ScheduledJobBaseline, func(job models.ScheduledJob) (string, error) {
+			result, err := baselineEngine.Run()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d baselines updated, %d anomalies detected for %s",
+				result.BaselinesUpdated, result.AnomaliesDetected, result.HourEvaluated.Format(time.RFC3339)), nil
+		})
+	}
+
+	if watchlistEngine != nil {
+		s.Register(models.ScheduledJobWatchlist, func(job models.ScheduledJob) (string, error) {
+			result, err := watchlistEngine.Run()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d watchlists evaluated, %d events matched, %d alerts raised",
+				result.WatchlistsEvaluated, result.EventsMatched, result.AlertsRaised), nil
+		})
+	}
+
+	if licService != nil {
+		s.Register(models.ScheduledJobUsageSnapshot, func(job models.ScheduledJob) (string, error) {
+			captured, err := licService.CaptureUsageSnapshots()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("usage captured for %d licenses", captured), nil
+		})
+	}
+}
+
+// mitreImportJob refreshes ATT&CK data from MITRE. Params "domain" and "url" select the bundle.
+func mitreImportJob(mitre *MITREHandler) ScheduledJobFunc {
+	return func(job models.ScheduledJob) (string, error) {
+		req := models.MITREImportRequest{ImportedBy: "scheduler:" + job.Name}
+		if domain, ok := job.Params["domain"].(string); ok {
+			req.Domain = domain
+		}
+		if url, ok := job.Params["url"].(string); ok {
+			req.URL = url
+		}
+		result, err := mitre.Import(context.Background(), req)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ATT&CK %s %s: %d tactics, %d techniques, %d sub-techniques (%d new, %d updated)",
+			result.Domain, result.ATTACKVersion, result.Tactics, result.Techniques, result.SubTechniques,
+			result.Inserted, result.Updated), nil
+	}
+}
+
+// archiveJob archives the previous calendar day, in the schedule's time zone, for every tenant
+// with auto-archive enabled (or only the schedule's license). Days already archived are skipped,
+// so re-running the job is safe.
+func archiveJob(dataLake *DataLakeHandler) ScheduledJobFunc {
+	return func(job models.ScheduledJob) (string, error) {
+		loc, err := time.LoadLocation(job.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		now := time.Now().In(loc)
+		end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		start := end.AddDate(0, 0, -1)
+
+		query := "SELECT license_id FROM data_lake_configs WHERE enabled = TRUE AND enable_auto_archive = TRUE"
+		args := []interface{}{}
+		if job.LicenseID != "" {
+			query += " AND license_id = $1"
+			args = append(args, job.LicenseID)
+		}
+
+		rows, err := dataLake.db.Query(query, args...)
+		if err != nil {
+			return "", fmt.Errorf("failed to load data lake configurations: %w", err)
+		}
+		licenseIDs := []string{}
+		for rows.Next() {
+			var licenseID string
+			if err := rows.Scan(&licenseID); err == nil {
+				licenseIDs = append(licenseIDs, licenseID)
+			}
+		}
+		rows.Close()
+
+		created, skipped := 0, 0
+		for _, licenseID := range licenseIDs {
+			req := models.CreateArchiveJobRequest{
+				LicenseID: licenseID,
+				JobType:   models.JobTypeArchive,
+				StartDate: start,
+				EndDate:   end,
+				Metadata:  map[string]interface{}{"scheduled_job_id": job.ID},
+			}
+
+			var exists bool
+			dataLake.db.QueryRow(`
+				SELECT EXISTS(
+					SELECT 1 FROM archive_jobs
+					WHERE license_id = $1 AND job_type = $2 AND source_location = $3
+					  AND status IN ('pending', 'running', 'completed')
+				)
+			`, licenseID, models.JobTypeArchive, fmt.Sprintf("clickhouse://events/%s/%s",
+				start.Format("2006-01-02"), end.Format("2006-01-02"))).Scan(&exists)
+			if exists {
+				skipped++
+				continue
+			}
+
+			jobID, _, _, err := dataLake.insertArchiveJob(req)
+			if err != nil {
+				return "", fmt.Errorf("failed to create archive job for license %s: %w", licenseID, err)
+			}
+			dataLake.processArchiveJob(jobID, req)
+			created++
+		}
+
+		return fmt.Sprintf("archived %s for %d tenants (%d already archived)", start.Format("2006-01-02"), created, skipped), nil
+	}
+}
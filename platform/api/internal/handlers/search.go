@@ -0,0 +1,491 @@
+// Global Search
+// One query fanned out across agents, telemetry, threat intelligence, rules and honeypots
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// searchCategories lists every category in default display order
+var searchCategories = []string{
+	models.SearchCategoryAgents,
+	models.SearchCategoryEvents,
+	models.SearchCategoryIOCs,
+	models.SearchCategoryRules,
+	models.SearchCategoryHoneypots,
+}
+
+const (
+	searchMinQueryLength = 2
+	searchMaxQueryLength = 256
+	searchDefaultLimit   = 10
+	searchMaxLimit       = 50
+	searchDefaultDays    = 7
+	searchMaxDays        = 90
+	searchTimeout        = 10 * time.Second
+)
+
+// errSearchUnavailable marks a category whose backend is not configured
+var errSearchUnavailable = errors.New("ClickHouse connection not available")
+
+var (
+	searchHashPattern   = regexp.MustCompile(`(?i)^(?:[0-9a-f]{32}|[0-9a-f]{40}|[0-9a-f]{64})$`)
+	searchDomainPattern = regexp.MustCompile(`(?i)^([a-z0-9-]+\.)+[a-z]{2,}$`)
+)
+
+// SearchHandler serves the global search box
+type SearchHandler struct {
+	db         *sql.DB
+	clickhouse driver.Conn // Telemetry; nil skips the events category
+}
+
+// NewSearchHandler creates a new global search handler
+func NewSearchHandler(db *sql.DB, ch driver.Conn) *SearchHandler {
+	return &SearchHandler{
+		db:         db,
+		clickhouse: ch,
+	}
+}
+
+// searchRequest is a parsed search with the tenant it is scoped to
+type searchRequest struct {
+	licenseID string
+	query     string
+	queryType string
+	limit     int
+	since     time.Time
+}
+
+// classifySearchQuery guesses what kind of indicator the query is so backends can use exact lookups
+func classifySearchQuery(q string) string {
+	switch {
+	case net.ParseIP(q) != nil:
+		return "ip"
+	case searchHashPattern.MatchString(q):
+		return "hash"
+	case strings.Contains(q, "@"):
+		return "email"
+	case searchDomainPattern.MatchString(q):
+		return "domain"
+	}
+	return "text"
+}
+
+// searchScore ranks how well a field value matches the query: exact, prefix, then substring
+func searchScore(value, q string) float64 {
+	value, q = strings.ToLower(value), strings.ToLower(q)
+	switch {
+	case value == "":
+		return 0
+	case value == q:
+		return 1.0
+	case strings.HasPrefix(value, q):
+		return 0.8
+	case strings.Contains(value, q):
+		return 0.6
+	}
+	return 0
+}
+
+// bestMatch returns the highest scoring of the named fields
+func bestMatch(q string, fields ...[2]string) (string, float64) {
+	field, best := "", 0.0
+	for _, f := range fields {
+		if score := searchScore(f[1], q); score > best {
+			field, best = f[0], score
+		}
+	}
+	return field, best
+}
+
+// likePattern escapes LIKE wildcards so the query is matched literally as a substring
+func likePattern(q string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(q) + "%"
+}
+
+// Search runs the query against every requested category in parallel.
+// Query: q, license_id (required), categories (comma-separated), limit (per category), days (telemetry window)
+func (h *SearchHandler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+	if len(q) < searchMinQueryLength || len(q) > searchMaxQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be between %d and %d characters", searchMinQueryLength, searchMaxQueryLength)})
+		return
+	}
+
+	categories := searchCategories
+	if requested := c.Query("categories"); requested != "" {
+		categories = strings.Split(requested, ",")
+		for _, category := range categories {
+			if !containsString(searchCategories, category) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown category: %s", category)})
+				return
+			}
+		}
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(searchDefaultLimit)))
+	if limit <= 0 || limit > searchMaxLimit {
+		limit = searchDefaultLimit
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(searchDefaultDays)))
+	if days <= 0 || days > searchMaxDays {
+		days = searchDefaultDays
+	}
+
+	req := searchRequest{
+		licenseID: licenseID,
+		query:     q,
+		queryType: classifySearchQuery(q),
+		limit:     limit,
+		since:     time.Now().UTC().AddDate(0, 0, -days),
+	}
+
+	backends := map[string]func(context.Context, searchRequest) ([]models.SearchResult, error){
+		models.SearchCategoryAgents:    h.searchAgents,
+		models.SearchCategoryEvents:    h.searchEvents,
+		models.SearchCategoryIOCs:      h.searchIOCs,
+		models.SearchCategoryRules:     h.searchRules,
+		models.SearchCategoryHoneypots: h.searchHoneypots,
+	}
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), searchTimeout)
+	defer cancel()
+
+	results := make([]models.SearchCategory, len(categories))
+	var wg sync.WaitGroup
+	for i, category := range categories {
+		wg.Add(1)
+		go func(i int, category string) {
+			defer wg.Done()
+			found, err := backends[category](ctx, req)
+			results[i] = models.SearchCategory{Category: category, Results: found}
+			if err == errSearchUnavailable {
+				results[i].Error = err.Error()
+			} else if err != nil {
+				log.Errorf("Global search failed for %s: %v", category, err)
+				results[i].Error = fmt.Sprintf("%s search failed", category)
+			}
+			if results[i].Results == nil {
+				results[i].Results = []models.SearchResult{}
+			}
+			sort.SliceStable(results[i].Results, func(a, b int) bool {
+				return results[i].Results[a].Score > results[i].Results[b].Score
+			})
+			results[i].Total = len(results[i].Results)
+		}(i, category)
+	}
+	wg.Wait()
+
+	// Categories with the strongest match first; empty categories keep their default order at the end
+	topScore := func(category models.SearchCategory) float64 {
+		if len(category.Results) == 0 {
+			return 0
+		}
+		return category.Results[0].Score
+	}
+	sort.SliceStable(results, func(a, b int) bool { return topScore(results[a]) > topScore(results[b]) })
+
+	total := 0
+	for _, category := range results {
+		total += category.Total
+	}
+
+	c.JSON(http.StatusOK, models.SearchResponse{
+		Query:      q,
+		QueryType:  req.queryType,
+		Categories: results,
+		Total:      total,
+		TookMs:     time.Since(started).Milliseconds(),
+	})
+}
+
+// searchAgents matches agents by hostname, agent ID, database ID or IP address
+func (h *SearchHandler) searchAgents(ctx context.Context, req searchRequest) ([]models.SearchResult, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, agent_id, hostname, COALESCE(host(ip_address), ''), COALESCE(status, ''), last_seen
+		FROM agents
+		WHERE license_id = $1 AND deleted_at IS NULL
+		  AND (hostname ILIKE $2 OR agent_id ILIKE $2 OR id::text = $3 OR host(ip_address) = $3)
+		ORDER BY last_seen DESC NULLS LAST
+		LIMIT $4
+	`, req.licenseID, likePattern(req.query), req.query, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var id, agentID, hostname, ip, status string
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&id, &agentID, &hostname, &ip, &status, &lastSeen); err != nil {
+			log.Warnf("Failed to scan agent search result: %v", err)
+			continue
+		}
+
+		field, score := bestMatch(req.query, [2]string{"hostname", hostname}, [2]string{"agent_id", agentID},
+			[2]string{"ip_address", ip}, [2]string{"id", id})
+		result := models.SearchResult{
+			Category:     models.SearchCategoryAgents,
+			ID:           id,
+			Title:        hostname,
+			Subtitle:     strings.TrimSpace(fmt.Sprintf("%s %s %s", agentID, ip, status)),
+			MatchedField: field,
+			Score:        score,
+			Link:         "/api/v1/agents/" + id,
+		}
+		if lastSeen.Valid {
+			result.Timestamp = &lastSeen.Time
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// searchEvents looks for the query in the tenant's recent telemetry. IPs and hashes use exact
+// lookups on the extracted columns and payload; free text is matched case-insensitively.
+func (h *SearchHandler) searchEvents(ctx context.Context, req searchRequest) ([]models.SearchResult, error) {
+	if h.clickhouse == nil {
+		return nil, errSearchUnavailable
+	}
+
+	var condition string
+	args := []interface{}{req.licenseID, req.since}
+	switch req.queryType {
+	case "ip":
+		condition = "(dst_ip = ? OR JSONExtractString(payload, 'src_ip') = ?)"
+		args = append(args, req.query, req.query)
+	case "hash":
+		condition = "positionCaseInsensitive(payload, ?) > 0"
+		args = append(args, req.query)
+	default:
+		condition = `(positionCaseInsensitive(hostname, ?) > 0 OR positionCaseInsensitive(process_name, ?) > 0
+			OR positionCaseInsensitive(file_path, ?) > 0 OR positionCaseInsensitive(username, ?) > 0
+			OR positionCaseInsensitive(dst_hostname, ?) > 0 OR positionCaseInsensitive(payload, ?) > 0)`
+		for i := 0; i < 6; i++ {
+			args = append(args, req.query)
+		}
+	}
+	args = append(args, req.limit)
+
+	rows, err := h.clickhouse.Query(ctx, `
+		SELECT toString(event_id), timestamp, toString(event_type), hostname, process_name,
+		       file_path, dst_ip, dst_hostname, username, severity
+		FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND `+condition+`
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var eventID, eventType, hostname, processName, filePath, dstIP, dstHostname, username string
+		var timestamp time.Time
+		var severity uint8
+		if err := rows.Scan(&eventID, &timestamp, &eventType, &hostname, &processName,
+			&filePath, &dstIP, &dstHostname, &username, &severity); err != nil {
+			log.Warnf("Failed to scan event search result: %v", err)
+			continue
+		}
+
+		field, score := bestMatch(req.query, [2]string{"dst_ip", dstIP}, [2]string{"hostname", hostname},
+			[2]string{"process_name", processName}, [2]string{"file_path", filePath},
+			[2]string{"dst_hostname", dstHostname}, [2]string{"username", username})
+		if field == "" {
+			// Matched inside the payload only
+			field, score = "payload", 0.4
+		}
+
+		title := processName
+		if title == "" {
+			title = eventType
+		}
+		ts := timestamp
+		results = append(results, models.SearchResult{
+			Category:     models.SearchCategoryEvents,
+			ID:           eventID,
+			Title:        fmt.Sprintf("%s on %s", title, hostname),
+			Subtitle:     fmt.Sprintf("%s, severity %s", eventType, eventSeverityName(severity)),
+			MatchedField: field,
+			Score:        score,
+			Link:         "/api/v1/telemetry/events/" + eventID,
+			Timestamp:    &ts,
+		})
+	}
+	return results, nil
+}
+
+// searchIOCs matches community threat intelligence by value, malware family or description
+func (h *SearchHandler) searchIOCs(ctx context.Context, req searchRequest) ([]models.SearchResult, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, ioc_type, value, COALESCE(threat_type, ''), COALESCE(malware_family, ''), COALESCE(severity, ''), last_seen
+		FROM shared_iocs
+		WHERE value ILIKE $1 OR malware_family ILIKE $1 OR description ILIKE $1
+		ORDER BY lower(value) = lower($2) DESC, report_count DESC
+		LIMIT $3
+	`, likePattern(req.query), req.query, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var id, iocType, value, threatType, malwareFamily, severity string
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&id, &iocType, &value, &threatType, &malwareFamily, &severity, &lastSeen); err != nil {
+			log.Warnf("Failed to scan IOC search result: %v", err)
+			continue
+		}
+
+		field, score := bestMatch(req.query, [2]string{"value", value}, [2]string{"malware_family", malwareFamily})
+		if field == "" {
+			field, score = "description", 0.4
+		}
+
+		subtitle := []string{iocType}
+		for _, part := range []string{threatType, malwareFamily, severity} {
+			if part != "" {
+				subtitle = append(subtitle, part)
+			}
+		}
+		result := models.SearchResult{
+			Category:     models.SearchCategoryIOCs,
+			ID:           id,
+			Title:        value,
+			Subtitle:     strings.Join(subtitle, ", "),
+			MatchedField: field,
+			Score:        score,
+			Link:         "/api/v1/collaborative/iocs/" + id,
+		}
+		if lastSeen.Valid {
+			result.Timestamp = &lastSeen.Time
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// searchRules matches the tenant's alert rules and community shared rules by name, description or tag
+func (h *SearchHandler) searchRules(ctx context.Context, req searchRequest) ([]models.SearchResult, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT 'alert_rule', id::text, name, COALESCE(description, ''), COALESCE(severity, ''), updated_at
+		FROM alert_rules
+		WHERE license_id = $1 AND (name ILIKE $2 OR description ILIKE $2)
+		UNION ALL
+		SELECT rule_type, id::text, name, COALESCE(description, ''), '', updated_at
+		FROM shared_rules
+		WHERE name ILIKE $2 OR description ILIKE $2 OR $3 = ANY(tags) OR $3 = ANY(mitre_techniques)
+		LIMIT $4
+	`, req.licenseID, likePattern(req.query), req.query, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var ruleType, id, name, description, severity string
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&ruleType, &id, &name, &description, &severity, &updatedAt); err != nil {
+			log.Warnf("Failed to scan rule search result: %v", err)
+			continue
+		}
+
+		field, score := bestMatch(req.query, [2]string{"name", name})
+		if field == "" {
+			field, score = "description", 0.4
+		}
+
+		result := models.SearchResult{
+			Category:     models.SearchCategoryRules,
+			ID:           id,
+			Title:        name,
+			MatchedField: field,
+			Score:        score,
+		}
+		if ruleType == "alert_rule" {
+			result.Subtitle = fmt.Sprintf("alert rule, %s", severity)
+			result.Link = "/api/v1/alerts/rules?license_id=" + req.licenseID
+		} else {
+			result.Subtitle = fmt.Sprintf("shared %s rule", ruleType)
+			result.Link = "/api/v1/collaborative/rules/" + id
+		}
+		if updatedAt.Valid {
+			result.Timestamp = &updatedAt.Time
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// searchHoneypots matches the tenant's honeypots by name, type or deployed location
+func (h *SearchHandler) searchHoneypots(ctx context.Context, req searchRequest) ([]models.SearchResult, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, honeypot_type, COALESCE(status, ''), COALESCE(location, ''), last_interaction
+		FROM honeypots
+		WHERE license_id = $1 AND deleted_at IS NULL
+		  AND (name ILIKE $2 OR location ILIKE $2 OR honeypot_type = $3)
+		ORDER BY last_interaction DESC NULLS LAST
+		LIMIT $4
+	`, req.licenseID, likePattern(req.query), req.query, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var id, name, honeypotType, status, location string
+		var lastInteraction sql.NullTime
+		if err := rows.Scan(&id, &name, &honeypotType, &status, &location, &lastInteraction); err != nil {
+			log.Warnf("Failed to scan honeypot search result: %v", err)
+			continue
+		}
+
+		field, score := bestMatch(req.query, [2]string{"name", name}, [2]string{"location", location},
+			[2]string{"honeypot_type", honeypotType})
+		result := models.SearchResult{
+			Category:     models.SearchCategoryHoneypots,
+			ID:           id,
+			Title:        name,
+			Subtitle:     strings.TrimSpace(fmt.Sprintf("%s %s %s", honeypotType, status, location)),
+			MatchedField: field,
+			Score:        score,
+			Link:         "/api/v1/deception/honeypots/" + id,
+		}
+		if lastInteraction.Valid {
+			result.Timestamp = &lastInteraction.Time
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,107 @@
+// Soft Delete
+// Shared restore and purge handling for tables with a deleted_at column
+
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// includeDeleted reports whether a list or get request asked for soft-deleted rows (?include_deleted=true)
+func includeDeleted(c *gin.Context) bool {
+	return c.Query("include_deleted") == "true"
+}
+
+// liveOnly returns the filter that hides soft-deleted rows unless the request asked for them
+func liveOnly(c *gin.Context) string {
+	if includeDeleted(c) {
+		return ""
+	}
+	return " AND deleted_at IS NULL"
+}
+
+// softDeleteRow marks a live row deleted. entity names the row in responses, e.g. "Agent".
+// The table name always comes from a constant, never from the request.
+func softDeleteRow(c *gin.Context, db *sql.DB, table, entity string) {
+	id := c.Param("id")
+
+	result, err := db.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL", table), id)
+	if err != nil {
+		log.Errorf("Failed to delete %s %s: %v", table, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete %s", strings.ToLower(entity))})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s not found", entity)})
+		return
+	}
+
+	log.Infof("Soft-deleted %s: %s", table, id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("%s deleted successfully", entity),
+		"restore": fmt.Sprintf("%s/restore", c.Request.URL.Path),
+	})
+}
+
+// restoreRow clears deleted_at on a soft-deleted row
+func restoreRow(c *gin.Context, db *sql.DB, table, entity string) {
+	id := c.Param("id")
+
+	result, err := db.Exec(fmt.Sprintf("UPDATE %s SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL", table), id)
+	if err != nil {
+		log.Errorf("Failed to restore %s %s: %v", table, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to restore %s", strings.ToLower(entity))})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deleted %s not found", strings.ToLower(entity))})
+		return
+	}
+
+	log.Infof("Restored %s: %s", table, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s restored successfully", entity)})
+}
+
+// purgeRow permanently removes a row. Only soft-deleted rows can be purged, so a purge
+// always follows a recoverable delete.
+func purgeRow(c *gin.Context, db *sql.DB, table, entity string) {
+	id := c.Param("id")
+
+	var deleted bool
+	err := db.QueryRow(fmt.Sprintf("SELECT deleted_at IS NOT NULL FROM %s WHERE id = $1", table), id).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s not found", entity)})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to look up %s %s: %v", table, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to purge %s", strings.ToLower(entity))})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s must be deleted before it can be purged", entity)})
+		return
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1 AND deleted_at IS NOT NULL", table), id); err != nil {
+		log.Errorf("Failed to purge %s %s: %v", table, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to purge %s", strings.ToLower(entity))})
+		return
+	}
+
+	log.Warnf("Permanently purged %s: %s", table, id)
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s purged permanently", entity)})
+}
@@ -0,0 +1,493 @@
+// Single Sign-On
+// Dashboard login through OpenID Connect and SAML identity providers with group to role mapping
+
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// ssoStateCookie carries the login attempt between the redirect to the identity provider
+	// and the callback
+	ssoStateCookie = "sentinel_sso_state"
+	ssoStateTTL    = 10 * time.Minute
+	ssoCookiePath  = "/api/v1/auth/sso"
+)
+
+// ssoState is the signed content of the state cookie
+type ssoState struct {
+	Provider  string `json:"p"`
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"` // PKCE code verifier
+	ExpiresAt int64  `json:"e"`
+}
+
+// samlRequestID is the ID of the SAML AuthnRequest sent for the login. The nonce doubles as
+// the ID; XML IDs may not start with a digit.
+func (s *ssoState) samlRequestID() string {
+	return "_" + s.Nonce
+}
+
+// ssoIdentity is a user as asserted by an identity provider
+type ssoIdentity struct {
+	Subject  string // The provider's stable identifier for the user
+	Email    string
+	FullName string
+	Groups   []string
+}
+
+// errSSOAccountExists is returned for identities whose email address belongs to an account
+// that is not linked to them
+var errSSOAccountExists = errors.New("email address belongs to another account")
+
+// ssoProvider is a configured identity provider and the client for its protocol
+type ssoProvider struct {
+	config models.SSOProvider
+	oidc   *oidcProvider
+	saml   *samlProvider
+}
+
+// SSOHandler handles dashboard single sign-on through OpenID Connect and SAML 2.0 identity
+// providers
+type SSOHandler struct {
+	db        *sql.DB
+	tokens    *middleware.UserTokens
+	stateKey  []byte
+	providers map[string]*ssoProvider
+	order     []string
+}
+
+// NewSSOHandler creates a new SSO handler. stateSecret signs the login state cookie and must be
+// shared by all API instances; invalid provider configurations are skipped.
+func NewSSOHandler(db *sql.DB, tokens *middleware.UserTokens, stateSecret string, providers []models.SSOProvider) *SSOHandler {
+	h := &SSOHandler{
+		db:        db,
+		tokens:    tokens,
+		providers: make(map[string]*ssoProvider),
+	}
+	key := sha256.Sum256([]byte("sso-state:" + stateSecret))
+	h.stateKey = key[:]
+	if stateSecret == "" {
+		random, err := randomToken(32)
+		if err != nil {
+			log.Fatalf("Failed to generate SSO state key: %v", err)
+		}
+		h.stateKey = []byte(random)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, provider := range providers {
+		if err := validateSSOProvider(provider); err != nil {
+			log.Warnf("Skipping SSO provider %q: %v", provider.ID, err)
+			continue
+		}
+		if _, exists := h.providers[provider.ID]; exists {
+			log.Warnf("Skipping duplicate SSO provider %q", provider.ID)
+			continue
+		}
+		if provider.GroupsClaim == "" {
+			provider.GroupsClaim = "groups"
+		}
+
+		entry := &ssoProvider{config: provider}
+		if provider.Type == models.SSOTypeSAML {
+			saml, err := newSAMLProvider(provider)
+			if err != nil {
+				log.Warnf("Skipping SSO provider %q: %v", provider.ID, err)
+				continue
+			}
+			entry.saml = saml
+		} else {
+			entry.oidc = &oidcProvider{config: provider, client: client}
+		}
+		h.providers[provider.ID] = entry
+		h.order = append(h.order, provider.ID)
+	}
+	if len(h.order) > 0 {
+		log.Infof("SSO enabled with %d identity provider(s)", len(h.order))
+	}
+	return h
+}
+
+func validateSSOProvider(p models.SSOProvider) error {
+	if p.ID == "" {
+		return errors.New("id is required")
+	}
+	switch p.Type {
+	case "", models.SSOTypeOIDC:
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return errors.New("issuer, client_id and redirect_url are required")
+		}
+	case models.SSOTypeSAML:
+		if p.Issuer == "" || p.SSOURL == "" || p.Certificate == "" || p.RedirectURL == "" {
+			return errors.New("issuer, sso_url, certificate and redirect_url are required")
+		}
+		// The response is posted cross-site, which only carries SameSite=None (Secure) cookies
+		if !strings.HasPrefix(p.RedirectURL, "https://") {
+			return errors.New("redirect_url must use https")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", p.Type)
+	}
+	for _, mapping := range p.RoleMappings {
+		if mapping.Group == "" || !models.ValidRole(mapping.Role) {
+			return errors.New("role mappings need a group and a valid role")
+		}
+	}
+	if p.DefaultRole != "" && !models.ValidRole(p.DefaultRole) {
+		return errors.New("invalid default_role")
+	}
+	return nil
+}
+
+// ListProviders lists the identity providers users can sign in with
+func (h *SSOHandler) ListProviders(c *gin.Context) {
+	providers := make([]models.SSOProviderInfo, 0, len(h.order))
+	for _, id := range h.order {
+		p := h.providers[id].config
+		name := p.Name
+		if name == "" {
+			name = p.ID
+		}
+		providers = append(providers, models.SSOProviderInfo{
+			ID:       p.ID,
+			Name:     name,
+			LoginURL: ssoCookiePath + "/login?provider=" + url.QueryEscape(p.ID),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": providers, "count": len(providers)})
+}
+
+// Login redirects the browser to the identity provider. The provider parameter may be omitted
+// when only one provider is configured.
+func (h *SSOHandler) Login(c *gin.Context) {
+	providerID := c.Query("provider")
+	if providerID == "" && len(h.order) == 1 {
+		providerID = h.order[0]
+	}
+	provider, ok := h.providers[providerID]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO provider not found"})
+		return
+	}
+
+	state := ssoState{Provider: providerID, ExpiresAt: time.Now().Add(ssoStateTTL).Unix()}
+	var err error
+	for _, field := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *field, err = randomToken(32); err != nil {
+			log.Errorf("Failed to generate SSO state: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+			return
+		}
+	}
+
+	var authURL string
+	if provider.saml != nil {
+		authURL, err = provider.saml.authnRequestURL(state.samlRequestID(), state.State, time.Now())
+	} else {
+		authURL, err = provider.oidc.authCodeURL(state.State, state.Nonce, state.Verifier)
+	}
+	if err != nil {
+		log.Errorf("Failed to start SSO login with %s: %v", providerID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+	cookie, err := h.encodeState(state)
+	if err != nil {
+		log.Errorf("Failed to encode SSO state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	h.setStateCookie(c, provider, cookie, int(ssoStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes an OpenID Connect login: it verifies the identity provider's response
+// and signs the user in
+func (h *SSOHandler) Callback(c *gin.Context) {
+	state, provider, ok := h.loginState(c)
+	if !ok {
+		return
+	}
+	if provider.oidc == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO provider does not use this callback"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(state.State)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO state mismatch"})
+		return
+	}
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider denied the login", "reason": idpError, "description": c.Query("error_description")})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	claims, err := provider.oidc.exchange(code, state.Verifier, state.Nonce)
+	if err != nil {
+		log.Warnf("SSO login with %s failed: %v", state.Provider, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SSO login failed"})
+		return
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address is not verified with the identity provider"})
+		return
+	}
+
+	identity := ssoIdentity{Groups: claimStrings(claims, provider.config.GroupsClaim)}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.FullName, _ = claims["name"].(string)
+	h.signIn(c, provider.config, identity)
+}
+
+// AssertionConsumer completes a SAML login: the identity provider posts its signed response
+// here through the browser
+func (h *SSOHandler) AssertionConsumer(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, samlMaxResponseSize)
+
+	state, provider, ok := h.loginState(c)
+	if !ok {
+		return
+	}
+	if provider.saml == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO provider does not use this callback"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.PostForm("RelayState")), []byte(state.State)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO state mismatch"})
+		return
+	}
+	encoded := c.PostForm("SAMLResponse")
+	if encoded == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SAMLResponse is required"})
+		return
+	}
+
+	identity, err := provider.saml.parseResponse(encoded, state.samlRequestID(), time.Now())
+	if err != nil {
+		log.Warnf("SSO login with %s failed: %v", state.Provider, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SSO login failed"})
+		return
+	}
+	h.signIn(c, provider.config, *identity)
+}
+
+// loginState reads and clears the state cookie of the login in progress. Without a valid one
+// it writes the error response and returns false.
+func (h *SSOHandler) loginState(c *gin.Context) (*ssoState, *ssoProvider, bool) {
+	raw, err := c.Cookie(ssoStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO login was not started or has expired"})
+		return nil, nil, false
+	}
+	state, err := h.decodeState(raw)
+	if err != nil {
+		log.Warnf("Rejected SSO state from %s: %v", c.ClientIP(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO login was not started or has expired"})
+		return nil, nil, false
+	}
+	provider, ok := h.providers[state.Provider]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO provider not found"})
+		return nil, nil, false
+	}
+	h.setStateCookie(c, provider, "", -1)
+	return state, provider, true
+}
+
+// signIn maps a verified identity's groups to a role, records the user and issues a platform
+// session token
+func (h *SSOHandler) signIn(c *gin.Context, config models.SSOProvider, identity ssoIdentity) {
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+	if email == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Identity provider did not return an email address"})
+		return
+	}
+	if identity.Subject == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Identity provider did not identify the user"})
+		return
+	}
+	if len(config.AllowedDomains) > 0 {
+		_, domain, _ := strings.Cut(email, "@")
+		if !containsString(config.AllowedDomains, domain) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed to sign in"})
+			return
+		}
+	}
+
+	role := ssoRole(config, identity.Groups)
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No platform role is mapped to your groups"})
+		return
+	}
+
+	user := models.AuthenticatedUser{
+		Email:     email,
+		FullName:  identity.FullName,
+		Role:      role,
+		LicenseID: config.LicenseID,
+		Provider:  config.ID,
+	}
+	active, err := h.recordSSOUser(&user, identity.Subject)
+	if err == errSSOAccountExists {
+		log.Warnf("Refused SSO login through %s: %s belongs to an account not linked to this identity", config.ID, email)
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email address exists and is not linked to this identity provider"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to record SSO user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	if !active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User account is disabled"})
+		return
+	}
+
+	token, expiresAt, err := h.tokens.Issue(user)
+	if err != nil {
+		log.Errorf("Failed to issue session token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign in"})
+		return
+	}
+	log.Infof("User %s signed in through %s with role %s", user.Email, user.Provider, user.Role)
+
+	// The token goes in the fragment so it never reaches server logs or Referer headers
+	if config.PostLoginRedirect != "" {
+		fragment := url.Values{
+			"token":      {token},
+			"expires_at": {expiresAt.UTC().Format(time.RFC3339)},
+		}
+		c.Redirect(http.StatusFound, config.PostLoginRedirect+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SSOLoginResponse{Token: token, ExpiresAt: expiresAt, User: user})
+}
+
+// recordSSOUser refreshes the user linked to the identity (provider and subject) or creates
+// one, and reports whether the account is active. Accounts are never linked by email address
+// alone: whoever controls an address at some identity provider would otherwise take over the
+// local or differently linked account that uses it. Such logins get errSSOAccountExists.
+func (h *SSOHandler) recordSSOUser(user *models.AuthenticatedUser, subject string) (bool, error) {
+	var active bool
+	update := func() error {
+		return h.db.QueryRow(`
+			UPDATE users SET
+				full_name = COALESCE(NULLIF($3, ''), full_name),
+				role = $4,
+				license_id = NULLIF($5, '')::uuid,
+				last_login = NOW(),
+				updated_at = NOW()
+			WHERE auth_provider = $1 AND external_id = $2
+			RETURNING id, email, is_active
+		`, user.Provider, subject, user.FullName, user.Role, user.LicenseID).Scan(&user.ID, &user.Email, &active)
+	}
+
+	if err := update(); err != sql.ErrNoRows {
+		return active, err
+	}
+
+	err := h.db.QueryRow(`
+		INSERT INTO users (email, full_name, role, license_id, auth_provider, external_id, last_login)
+		VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, '')::uuid, $5, $6, NOW())
+		ON CONFLICT DO NOTHING
+		RETURNING id, is_active
+	`, user.Email, user.FullName, user.Role, user.LicenseID, user.Provider, subject).Scan(&user.ID, &active)
+	if err != sql.ErrNoRows {
+		return active, err
+	}
+
+	// Nothing was inserted: a concurrent first login of the same identity won, or the email
+	// address is taken
+	if err := update(); err != sql.ErrNoRows {
+		return active, err
+	}
+	return false, errSSOAccountExists
+}
+
+// ssoRole maps the user's groups to a role: the first matching mapping wins, otherwise the
+// provider's default role applies
+func ssoRole(config models.SSOProvider, groups []string) string {
+	for _, mapping := range config.RoleMappings {
+		if containsString(groups, mapping.Group) {
+			return models.NormalizeRole(mapping.Role)
+		}
+	}
+	return models.NormalizeRole(config.DefaultRole)
+}
+
+func (h *SSOHandler) setStateCookie(c *gin.Context, provider *ssoProvider, value string, maxAge int) {
+	// The OIDC callback arrives as a top-level navigation from the identity provider, which Lax
+	// allows. SAML responses are posted cross-site and only carry SameSite=None cookies.
+	if provider.saml != nil {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	secure := strings.HasPrefix(provider.config.RedirectURL, "https://")
+	c.SetCookie(ssoStateCookie, value, maxAge, ssoCookiePath, "", secure, true)
+}
+
+func (h *SSOHandler) encodeState(state ssoState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(h.signState(encoded)), nil
+}
+
+func (h *SSOHandler) decodeState(raw string) (*ssoState, error) {
+	encoded, sig, found := strings.Cut(raw, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if !found || err != nil || !hmac.Equal(signature, h.signState(encoded)) {
+		return nil, errors.New("invalid SSO state")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid SSO state")
+	}
+	var state ssoState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, errors.New("invalid SSO state")
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, errors.New("SSO login has expired, please try again")
+	}
+	return &state, nil
+}
+
+func (h *SSOHandler) signState(encoded string) []byte {
+	mac := hmac.New(sha256.New, h.stateKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -8,15 +8,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
 	"github.com/sentinel-enterprise/platform/api/internal/models"
 )
 
@@ -24,6 +29,11 @@ import (
 type TelemetryHandler struct {
 	db         *sql.DB            // PostgreSQL for metadata
 	clickhouse driver.Conn        // ClickHouse for event data
+	guardrails QueryGuardrails    // Default scan thresholds and execution limits for ad-hoc queries
+
+	limitsMu       sync.Mutex
+	tierGuardrails map[string]QueryGuardrails  // Per-tier limits layered over the defaults
+	limitsCache    map[string]cachedGuardrails // Effective limits per license
 }
 
 // NewTelemetryHandler creates a new telemetry handler
@@ -60,7 +70,7 @@ func NewTelemetryHandler(db *sql.DB) *TelemetryHandler {
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
-	if value := getEnv(key, ""); value != "" {
+	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
@@ -75,22 +85,18 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 
 	var req models.QueryEventsRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
 	// Parse time range
-	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	startTime, endTime, err := parseQueryRange(req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time format, use RFC3339"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	endTime, err := time.Parse(time.RFC3339, req.EndTime)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time format, use RFC3339"})
-		return
-	}
+	guardrails := h.guardrailsFor(req.TenantID)
 
 	// Set defaults
 	if req.Limit == 0 {
@@ -99,6 +105,7 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 	if req.Limit > 10000 {
 		req.Limit = 10000
 	}
+	req.Limit = guardrails.clampLimit(req.Limit)
 	if req.OrderBy == "" {
 		req.OrderBy = "timestamp"
 	}
@@ -112,78 +119,29 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 		SELECT
 			event_id, agent_id, tenant_id, timestamp, server_timestamp,
 			event_type, mitre_tactic, mitre_technique, severity, hostname, os_type,
-			payload, process_name, file_path, dst_ip, dst_port, username, ingestion_date
+			payload, process_name, file_path, dst_ip, dst_port, username, ingestion_date, redacted
 		FROM telemetry_events
 		WHERE tenant_id = ?
 		  AND timestamp >= ?
 		  AND timestamp <= ?
 	`
 
-	args := []interface{}{req.TenantID, startTime, endTime}
-
 	// Add filters
-	if len(req.EventTypes) > 0 {
-		placeholders := make([]string, len(req.EventTypes))
-		for i := range req.EventTypes {
-			placeholders[i] = "?"
-			args = append(args, req.EventTypes[i])
-		}
-		query += " AND event_type IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
-	if len(req.AgentIDs) > 0 {
-		placeholders := make([]string, len(req.AgentIDs))
-		for i := range req.AgentIDs {
-			placeholders[i] = "?"
-			args = append(args, req.AgentIDs[i])
-		}
-		query += " AND agent_id IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
-	if len(req.Hostnames) > 0 {
-		placeholders := make([]string, len(req.Hostnames))
-		for i := range req.Hostnames {
-			placeholders[i] = "?"
-			args = append(args, req.Hostnames[i])
-		}
-		query += " AND hostname IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
-	if req.MinSeverity != nil {
-		query += " AND severity >= ?"
-		args = append(args, *req.MinSeverity)
-	}
-
-	if len(req.MitreTactics) > 0 {
-		placeholders := make([]string, len(req.MitreTactics))
-		for i := range req.MitreTactics {
-			placeholders[i] = "?"
-			args = append(args, req.MitreTactics[i])
-		}
-		query += " AND mitre_tactic IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
-	if len(req.MitreTechniques) > 0 {
-		placeholders := make([]string, len(req.MitreTechniques))
-		for i := range req.MitreTechniques {
-			placeholders[i] = "?"
-			args = append(args, req.MitreTechniques[i])
-		}
-		query += " AND mitre_technique IN (" + strings.Join(placeholders, ",") + ")"
-	}
-
-	if len(req.ProcessNames) > 0 {
-		placeholders := make([]string, len(req.ProcessNames))
-		for i := range req.ProcessNames {
-			placeholders[i] = "?"
-			args = append(args, req.ProcessNames[i])
-		}
-		query += " AND process_name IN (" + strings.Join(placeholders, ",") + ")"
+	filters, filterArgs := eventQueryFilters(req)
+	query += filters
+	args := append([]interface{}{req.TenantID, startTime, endTime}, filterArgs...)
+	customFilters, customArgs, ok := h.customFieldFilters(c, req)
+	if !ok {
+		return
 	}
+	query += customFilters
+	args = append(args, customArgs...)
 
-	if req.SearchText != "" {
-		query += " AND positionCaseInsensitive(payload, ?) > 0"
-		args = append(args, req.SearchText)
+	// Reject or require confirmation for queries that would scan too much
+	ctx := queryContext(context.Background(), guardrails)
+	estimate, ok := h.checkQueryCost(ctx, c, guardrails, query, args, startTime, endTime, req.Confirm)
+	if !ok {
+		return
 	}
 
 	// Add ordering and pagination
@@ -191,9 +149,11 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 	args = append(args, req.Limit, req.Offset)
 
 	// Execute query
-	ctx := context.Background()
 	rows, err := h.clickhouse.Query(ctx, query, args...)
 	if err != nil {
+		if queryLimitError(c, err, guardrails) {
+			return
+		}
 		log.Errorf("Failed to query events: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
 		return
@@ -225,6 +185,7 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 			&event.DstPort,
 			&event.Username,
 			&event.IngestionDate,
+			&event.Redacted,
 		)
 
 		if err != nil {
@@ -260,6 +221,7 @@ func (h *TelemetryHandler) QueryEvents(c *gin.Context) {
 		Limit:       req.Limit,
 		Offset:      req.Offset,
 		QueryTimeMs: queryDuration,
+		Estimate:    estimate,
 	})
 }
 
@@ -276,7 +238,7 @@ func (h *TelemetryHandler) GetEvent(c *gin.Context) {
 		SELECT
 			event_id, agent_id, tenant_id, timestamp, server_timestamp,
 			event_type, mitre_tactic, mitre_technique, severity, hostname, os_type,
-			payload, process_name, file_path, dst_ip, dst_port, username, ingestion_date
+			payload, process_name, file_path, dst_ip, dst_port, username, ingestion_date, redacted
 		FROM telemetry_events
 		WHERE event_id = ?
 		LIMIT 1
@@ -306,6 +268,7 @@ func (h *TelemetryHandler) GetEvent(c *gin.Context) {
 		&event.DstPort,
 		&event.Username,
 		&event.IngestionDate,
+		&event.Redacted,
 	)
 
 	if err != nil {
@@ -326,13 +289,533 @@ func (h *TelemetryHandler) GetEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, event)
 }
 
-// GetStatistics retrieves aggregate statistics
+// GetEventsBatch retrieves multiple events by ID in one round trip, preserving request order
+func (h *TelemetryHandler) GetEventsBatch(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.BatchGetEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	events, err := fetchEventsByIDs(context.Background(), h.clickhouse, req.TenantID, req.EventIDs)
+	if err != nil {
+		log.Errorf("Failed to fetch events batch: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+
+	found := make(map[string]bool, len(events))
+	for _, event := range events {
+		found[event.EventID] = true
+	}
+	missing := make([]string, 0)
+	for _, id := range req.EventIDs {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.BatchGetEventsResponse{
+		Events:  events,
+		Count:   len(events),
+		Missing: missing,
+	})
+}
+
+// fetchEventsByIDs loads a set of events for a tenant with a single IN query.
+// Results follow the order of eventIDs; duplicate and unknown IDs are skipped.
+func fetchEventsByIDs(ctx context.Context, ch driver.Conn, tenantID string, eventIDs []string) ([]models.TelemetryEvent, error) {
+	events := make([]models.TelemetryEvent, 0, len(eventIDs))
+	if len(eventIDs) == 0 {
+		return events, nil
+	}
+
+	query := "SELECT " + telemetryEventColumns + " FROM telemetry_events WHERE tenant_id = ?"
+	args := []interface{}{tenantID}
+
+	placeholders := make([]string, len(eventIDs))
+	for i := range eventIDs {
+		placeholders[i] = "?"
+		args = append(args, eventIDs[i])
+	}
+	query += " AND event_id IN (" + strings.Join(placeholders, ",") + ")"
+
+	rows, err := ch.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[string]models.TelemetryEvent, len(eventIDs))
+	for rows.Next() {
+		event, err := scanTelemetryEvent(rows)
+		if err != nil {
+			log.Warnf("Failed to scan event: %v", err)
+			continue
+		}
+
+		byID[event.EventID] = event
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Restore the caller's ordering
+	for _, id := range eventIDs {
+		if event, ok := byID[id]; ok {
+			events = append(events, event)
+			delete(byID, id)
+		}
+	}
+
+	return events, nil
+}
+
+// telemetryEventColumns is the column list matching scanTelemetryEvent
+const telemetryEventColumns = `event_id, agent_id, tenant_id, timestamp, server_timestamp,
+	event_type, mitre_tactic, mitre_technique, severity, hostname, os_type,
+	payload, process_name, file_path, dst_ip, dst_port, username, ingestion_date, redacted`
+
+// rowScanner is satisfied by both driver.Row and driver.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTelemetryEvent scans a row selected with telemetryEventColumns
+func scanTelemetryEvent(row rowScanner) (models.TelemetryEvent, error) {
+	var event models.TelemetryEvent
+	var payloadStr string
+	var eventID string
+
+	err := row.Scan(
+		&eventID,
+		&event.AgentID,
+		&event.TenantID,
+		&event.Timestamp,
+		&event.ServerTimestamp,
+		&event.EventType,
+		&event.MitreTactic,
+		&event.MitreTechnique,
+		&event.Severity,
+		&event.Hostname,
+		&event.OSType,
+		&payloadStr,
+		&event.ProcessName,
+		&event.FilePath,
+		&event.DstIP,
+		&event.DstPort,
+		&event.Username,
+		&event.IngestionDate,
+		&event.Redacted,
+	)
+	if err != nil {
+		return event, err
+	}
+
+	event.EventID = eventID
+
+	// Parse JSON payload
+	if payloadStr != "" {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(payloadStr), &payload); err == nil {
+			event.Payload = payload
+		}
+	}
+
+	return event, nil
+}
+
+// pivotColumns maps pivot fields accepted by the API to ClickHouse columns
+var pivotColumns = map[string]string{
+	"process_name": "process_name",
+	"dst_ip":       "dst_ip",
+	"username":     "username",
+	"agent_id":     "agent_id",
+	"hostname":     "hostname",
+	"file_path":    "file_path",
+}
+
+// PivotEvents finds events sharing an attribute with a seed event, optionally over several hops
+func (h *TelemetryHandler) PivotEvents(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.PivotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	for _, field := range req.Hops {
+		if _, ok := pivotColumns[field]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported pivot field: %s", field)})
+			return
+		}
+	}
+
+	// Set defaults
+	if req.WindowMinutes <= 0 {
+		req.WindowMinutes = 60
+	}
+	if req.WindowMinutes > 10080 {
+		req.WindowMinutes = 10080
+	}
+	if req.Limit <= 0 {
+		req.Limit = 500
+	}
+	if req.Limit > 5000 {
+		req.Limit = 5000
+	}
+	guardrails := h.guardrailsFor(req.TenantID)
+	req.Limit = guardrails.clampLimit(req.Limit)
+
+	queryStart := time.Now()
+	ctx := queryContext(context.Background(), guardrails)
+
+	seeds, err := fetchEventsByIDs(ctx, h.clickhouse, req.TenantID, []string{req.SeedEventID})
+	if err != nil {
+		log.Errorf("Failed to fetch pivot seed event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+	if len(seeds) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	seed := seeds[0]
+
+	window := time.Duration(req.WindowMinutes) * time.Minute
+	startTime := seed.Timestamp.Add(-window)
+	endTime := seed.Timestamp.Add(window)
+
+	// Each hop pivots on the distinct values of its field among the previous hop's events
+	current := []models.TelemetryEvent{seed}
+	hops := make([]models.PivotHopResult, 0, len(req.Hops))
+	for _, field := range req.Hops {
+		values := distinctPivotValues(current, field)
+		hop := models.PivotHopResult{
+			Field:  field,
+			Values: values,
+			Events: make([]models.TelemetryEvent, 0),
+		}
+
+		if len(values) > 0 {
+			query := "SELECT " + telemetryEventColumns + ` FROM telemetry_events
+				WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ?`
+			args := []interface{}{req.TenantID, startTime, endTime}
+
+			placeholders := make([]string, len(values))
+			for i := range values {
+				placeholders[i] = "?"
+				args = append(args, values[i])
+			}
+			query += " AND " + pivotColumns[field] + " IN (" + strings.Join(placeholders, ",") + ")"
+			query += " ORDER BY timestamp ASC LIMIT ?"
+			args = append(args, req.Limit)
+
+			rows, err := h.clickhouse.Query(ctx, query, args...)
+			if err != nil {
+				if queryLimitError(c, err, guardrails) {
+					return
+				}
+				log.Errorf("Failed to query pivot hop %s: %v", field, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+				return
+			}
+			for rows.Next() {
+				event, err := scanTelemetryEvent(rows)
+				if err != nil {
+					log.Warnf("Failed to scan event: %v", err)
+					continue
+				}
+				hop.Events = append(hop.Events, event)
+			}
+			rows.Close()
+		}
+
+		hops = append(hops, hop)
+		current = hop.Events
+	}
+
+	c.JSON(http.StatusOK, models.PivotResponse{
+		SeedEvent:   seed,
+		Hops:        hops,
+		TimeRange:   models.TimeRange{Start: startTime, End: endTime},
+		QueryTimeMs: time.Since(queryStart).Milliseconds(),
+	})
+}
+
+// distinctPivotValues collects the non-empty values of a pivot field across events
+func distinctPivotValues(events []models.TelemetryEvent, field string) []string {
+	seen := make(map[string]bool)
+	values := make([]string, 0)
+	for _, event := range events {
+		var value string
+		switch field {
+		case "process_name":
+			value = event.ProcessName
+		case "dst_ip":
+			value = event.DstIP
+		case "username":
+			value = event.Username
+		case "agent_id":
+			value = event.AgentID
+		case "hostname":
+			value = event.Hostname
+		case "file_path":
+			value = event.FilePath
+		}
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// maxProcessTreeEvents bounds the number of events used to reconstruct a process tree
+const maxProcessTreeEvents = 10000
+
+// GetProcessTree reconstructs parent/child process relationships for an agent from
+// process_start/process_terminate events, attaching file, network and registry
+// activity to the process that generated it
+func (h *TelemetryHandler) GetProcessTree(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	tenantID := c.Query("tenant_id")
+	agentID := c.Query("agent_id")
+	startParam := c.Query("start")
+	endParam := c.Query("end")
+
+	if tenantID == "" || agentID == "" || startParam == "" || endParam == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant_id, agent_id, start, and end required"})
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, startParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start format, use RFC3339"})
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, endParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end format, use RFC3339"})
+		return
+	}
+
+	var rootPID uint64
+	hasRoot := false
+	if value := c.Query("root_pid"); value != "" {
+		rootPID, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid root_pid"})
+			return
+		}
+		hasRoot = true
+	}
+
+	query := "SELECT " + telemetryEventColumns + ` FROM telemetry_events
+		WHERE tenant_id = ? AND agent_id = ? AND timestamp >= ? AND timestamp <= ?
+		  AND event_type IN ('process_start', 'process_terminate', 'file_access', 'file_modify',
+		                     'file_delete', 'network_conn', 'registry_modify')
+		ORDER BY timestamp ASC
+		LIMIT ?`
+
+	guardrails := h.guardrailsFor(tenantID)
+	ctx := queryContext(context.Background(), guardrails)
+	limit := guardrails.clampLimit(maxProcessTreeEvents)
+	rows, err := h.clickhouse.Query(ctx, query, tenantID, agentID, start, end, limit)
+	if err != nil {
+		if queryLimitError(c, err, guardrails) {
+			return
+		}
+		log.Errorf("Failed to query process events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+	defer rows.Close()
+
+	events := make([]models.TelemetryEvent, 0)
+	for rows.Next() {
+		event, err := scanTelemetryEvent(rows)
+		if err != nil {
+			log.Warnf("Failed to scan event: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	roots := buildProcessTree(events)
+
+	if hasRoot {
+		roots = findProcessNodes(roots, uint32(rootPID))
+		if len(roots) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Process not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ProcessTreeResponse{
+		AgentID:    agentID,
+		Roots:      roots,
+		EventCount: len(events),
+		Truncated:  len(events) >= limit,
+		TimeRange: models.TimeRange{
+			Start: start,
+			End:   end,
+		},
+	})
+}
+
+// buildProcessTree links time-ordered events into process nodes. A PID maps to its
+// most recent live process, so PID reuse after termination starts a new node.
+func buildProcessTree(events []models.TelemetryEvent) []*models.ProcessNode {
+	live := make(map[uint32]*models.ProcessNode)
+	nodes := make([]*models.ProcessNode, 0)
+	parents := make(map[*models.ProcessNode]*models.ProcessNode)
+
+	nodeFor := func(pid uint32) *models.ProcessNode {
+		if node, ok := live[pid]; ok {
+			return node
+		}
+		// Process started before the window; create a placeholder node
+		node := &models.ProcessNode{PID: pid, Children: make([]*models.ProcessNode, 0), Events: make([]models.TelemetryEvent, 0)}
+		live[pid] = node
+		nodes = append(nodes, node)
+		return node
+	}
+
+	for _, event := range events {
+		pid, ok := payloadUint32(event.Payload, "pid")
+		if !ok {
+			continue
+		}
+
+		switch event.EventType {
+		case "process_start":
+			ppid, _ := payloadUint32(event.Payload, "ppid")
+			timestamp := event.Timestamp
+
+			node, exists := live[pid]
+			if !exists || node.StartTime != nil || node.EndTime != nil {
+				node = &models.ProcessNode{PID: pid, Children: make([]*models.ProcessNode, 0), Events: make([]models.TelemetryEvent, 0)}
+				live[pid] = node
+				nodes = append(nodes, node)
+			}
+			node.PPID = ppid
+			node.EventID = event.EventID
+			node.ProcessName = event.ProcessName
+			node.CommandLine = payloadString(event.Payload, "cmdline")
+			node.User = payloadString(event.Payload, "user")
+			node.Hash = payloadString(event.Payload, "hash")
+			node.StartTime = &timestamp
+
+			// A placeholder may already be an ancestor of its parent (a child was seen
+			// first, or the PID was reused); linking it again would close a cycle
+			if parent, ok := live[ppid]; ok && !isProcessAncestor(node, parent, parents) {
+				parents[node] = parent
+			}
+
+		case "process_terminate":
+			node := nodeFor(pid)
+			timestamp := event.Timestamp
+			node.EndTime = &timestamp
+			if code, ok := payloadUint32(event.Payload, "exit_code"); ok {
+				node.ExitCode = &code
+			}
+
+		default:
+			node := nodeFor(pid)
+			node.Events = append(node.Events, event)
+		}
+	}
+
+	roots := make([]*models.ProcessNode, 0)
+	for _, node := range nodes {
+		if parent, ok := parents[node]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
+
+// isProcessAncestor reports whether ancestor is node itself or on the parent chain above it
+func isProcessAncestor(ancestor, node *models.ProcessNode, parents map[*models.ProcessNode]*models.ProcessNode) bool {
+	visited := make(map[*models.ProcessNode]bool)
+	for current := node; current != nil && !visited[current]; current = parents[current] {
+		if current == ancestor {
+			return true
+		}
+		visited[current] = true
+	}
+	return false
+}
+
+// findProcessNodes returns every node in the forest with the given PID
+func findProcessNodes(nodes []*models.ProcessNode, pid uint32) []*models.ProcessNode {
+	matches := make([]*models.ProcessNode, 0)
+	for _, node := range nodes {
+		if node.PID == pid {
+			matches = append(matches, node)
+			continue
+		}
+		matches = append(matches, findProcessNodes(node.Children, pid)...)
+	}
+	return matches
+}
+
+// payloadUint32 reads a numeric payload field decoded from JSON
+func payloadUint32(payload map[string]interface{}, key string) (uint32, bool) {
+	switch v := payload[key].(type) {
+	case float64:
+		if v < 0 {
+			return 0, false
+		}
+		return uint32(v), true
+	case string:
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(n), true
+	}
+	return 0, false
+}
+
+// payloadString reads a string payload field
+func payloadString(payload map[string]interface{}, key string) string {
+	if v, ok := payload[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// GetStatistics retrieves aggregate statistics. ?format=csv or ?format=pdf returns a download instead of JSON.
 func (h *TelemetryHandler) GetStatistics(c *gin.Context) {
 	if h.clickhouse == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
 		return
 	}
 
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
 	tenantID := c.Query("tenant_id")
 	startTime := c.Query("start_time")
 	endTime := c.Query("end_time")
@@ -354,83 +837,156 @@ func (h *TelemetryHandler) GetStatistics(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	stats, err := h.statistics(context.Background(), tenantID, start, end)
+	if err != nil {
+		log.Errorf("Failed to query event totals: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve statistics"})
+		return
+	}
 
-	// Total events
-	var totalEvents int64
-	h.clickhouse.QueryRow(ctx,
-		"SELECT COUNT(*) FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ?",
-		tenantID, start, end).Scan(&totalEvents)
+	switch format {
+	case exportFormatCSV:
+		setExportFilename(c, "statistics", tenantID, format)
+		writeStatisticsCSV(c, stats)
+	case exportFormatPDF:
+		setExportFilename(c, "statistics", tenantID, format)
+		writeStatisticsPDF(c, tenantID, stats, start, end)
+	default:
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// statistics aggregates event totals, severity/type breakdowns and top MITRE tactics for a tenant
+func (h *TelemetryHandler) statistics(ctx context.Context, tenantID string, start, end time.Time) (models.Statistics, error) {
+	// Aggregates are served from the hourly rollup where possible, with raw
+	// scans only for the partial hours at either edge of the range
+	source, sourceArgs := statsSource(tenantID, start, end)
+
+	// Total events and unique counts
+	var totalEvents, uniqueAgents, uniqueHosts int64
+	if err := h.clickhouse.QueryRow(ctx,
+		"SELECT toInt64(sum(event_count)), toInt64(uniqMerge(agents_state)), toInt64(uniqMerge(hosts_state)) FROM "+source,
+		sourceArgs...).Scan(&totalEvents, &uniqueAgents, &uniqueHosts); err != nil {
+		return models.Statistics{}, err
+	}
 
 	// Events by type
 	eventsByType := make(map[string]int64)
-	rows, _ := h.clickhouse.Query(ctx,
-		"SELECT event_type, COUNT(*) as cnt FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ? GROUP BY event_type",
-		tenantID, start, end)
-	for rows.Next() {
-		var eventType string
-		var count int64
-		rows.Scan(&eventType, &count)
-		eventsByType[eventType] = count
+	rows, err := h.clickhouse.Query(ctx,
+		"SELECT event_type, toInt64(sum(event_count)) AS cnt FROM "+source+" GROUP BY event_type",
+		sourceArgs...)
+	if err == nil {
+		for rows.Next() {
+			var eventType string
+			var count int64
+			rows.Scan(&eventType, &count)
+			eventsByType[eventType] = count
+		}
+		rows.Close()
 	}
-	rows.Close()
 
 	// Events by severity
 	eventsBySeverity := make(map[uint8]int64)
-	rows, _ = h.clickhouse.Query(ctx,
-		"SELECT severity, COUNT(*) as cnt FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ? GROUP BY severity",
-		tenantID, start, end)
-	for rows.Next() {
-		var severity uint8
-		var count int64
-		rows.Scan(&severity, &count)
-		eventsBySeverity[severity] = count
-	}
-	rows.Close()
-
-	// Top MITRE tactics
-	topTactics := make([]models.MitreStat, 0)
-	rows, _ = h.clickhouse.Query(ctx,
-		`SELECT mitre_tactic, COUNT(*) as cnt FROM telemetry_events
-		WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ? AND mitre_tactic != ''
-		GROUP BY mitre_tactic ORDER BY cnt DESC LIMIT 10`,
-		tenantID, start, end)
-	for rows.Next() {
-		var tactic string
-		var count int64
-		rows.Scan(&tactic, &count)
-		percentage := float64(count) / float64(totalEvents) * 100
-		topTactics = append(topTactics, models.MitreStat{
-			ID:         tactic,
-			EventCount: count,
-			Percentage: percentage,
-		})
-	}
-	rows.Close()
-
-	// Unique counts
-	var uniqueAgents, uniqueHosts int64
-	h.clickhouse.QueryRow(ctx,
-		"SELECT uniq(agent_id) FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ?",
-		tenantID, start, end).Scan(&uniqueAgents)
-	h.clickhouse.QueryRow(ctx,
-		"SELECT uniq(hostname) FROM telemetry_events WHERE tenant_id = ? AND timestamp >= ? AND timestamp <= ?",
-		tenantID, start, end).Scan(&uniqueHosts)
+	rows, err = h.clickhouse.Query(ctx,
+		"SELECT severity, toInt64(sum(event_count)) AS cnt FROM "+source+" GROUP BY severity",
+		sourceArgs...)
+	if err == nil {
+		for rows.Next() {
+			var severity uint8
+			var count int64
+			rows.Scan(&severity, &count)
+			eventsBySeverity[severity] = count
+		}
+		rows.Close()
+	}
+
+	// MITRE tactics, ranked once deception-evidenced tactics are added
+	tacticCounts := make(map[string]int64)
+	rows, err = h.clickhouse.Query(ctx,
+		`SELECT mitre_tactic, toInt64(sum(event_count)) AS cnt FROM `+source+`
+		WHERE mitre_tactic != ''
+		GROUP BY mitre_tactic`,
+		sourceArgs...)
+	if err == nil {
+		for rows.Next() {
+			var tactic string
+			var count int64
+			rows.Scan(&tactic, &count)
+			tacticCounts[tactic] = count
+		}
+		rows.Close()
+	}
+
+	deceptionTotal, deceptionByType, deceptionTactics, err := h.deceptionStatistics(tenantID, start, end)
+	if err != nil {
+		log.Warnf("Failed to include deception events in statistics: %v", err)
+	}
+	for tactic, count := range deceptionTactics {
+		tacticCounts[tactic] += count
+	}
 
 	stats := models.Statistics{
 		TotalEvents:      totalEvents,
 		EventsByType:     eventsByType,
 		EventsBySeverity: eventsBySeverity,
-		TopMitreTactics:  topTactics,
+		TopMitreTactics:  topTactics(tacticCounts, totalEvents+deceptionTotal, 10),
 		UniqueAgents:     uniqueAgents,
 		UniqueHosts:      uniqueHosts,
 		TimeRange: models.TimeRange{
 			Start: start,
 			End:   end,
 		},
+		DeceptionEvents:       deceptionTotal,
+		DeceptionEventsByType: deceptionByType,
+	}
+
+	return stats, nil
+}
+
+// statsSource builds a subquery yielding partially aggregated statistics rows
+// (event_type, severity, mitre_tactic, event_count, agents_state, hosts_state)
+// for a tenant and time range. Whole hours are read from the
+// telemetry_stats_hourly rollup; the sub-hour edges fall back to raw events.
+func statsSource(tenantID string, start, end time.Time) (string, []interface{}) {
+	const rawSelect = `
+		SELECT toString(event_type) AS event_type, severity, mitre_tactic,
+			count() AS event_count, uniqState(agent_id) AS agents_state, uniqState(hostname) AS hosts_state
+		FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND %s
+		GROUP BY event_type, severity, mitre_tactic`
+
+	hourStart := start.Truncate(time.Hour)
+	if hourStart.Before(start) {
+		hourStart = hourStart.Add(time.Hour)
+	}
+	hourEnd := end.Truncate(time.Hour)
+
+	// Sub-hour ranges never touch a complete rollup bucket
+	if !hourStart.Before(hourEnd) {
+		return "(" + fmt.Sprintf(rawSelect, "timestamp <= ?") + ")", []interface{}{tenantID, start, end}
 	}
 
-	c.JSON(http.StatusOK, stats)
+	parts := make([]string, 0, 3)
+	args := make([]interface{}, 0, 9)
+
+	if start.Before(hourStart) {
+		parts = append(parts, fmt.Sprintf(rawSelect, "timestamp < ?"))
+		args = append(args, tenantID, start, hourStart)
+	}
+
+	parts = append(parts, `
+		SELECT event_type, severity, mitre_tactic,
+			sum(event_count) AS event_count, uniqMergeState(agents_state) AS agents_state, uniqMergeState(hosts_state) AS hosts_state
+		FROM telemetry_stats_hourly
+		WHERE tenant_id = ? AND event_hour >= ? AND event_hour < ?
+		GROUP BY event_type, severity, mitre_tactic`)
+	args = append(args, tenantID, hourStart, hourEnd)
+
+	// The trailing edge includes the end timestamp to match the raw query semantics
+	parts = append(parts, fmt.Sprintf(rawSelect, "timestamp <= ?"))
+	args = append(args, tenantID, hourEnd, end)
+
+	return "(" + strings.Join(parts, " UNION ALL ") + ")", args
 }
 
 // ListMITRETactics retrieves all MITRE tactics from PostgreSQL
@@ -477,13 +1033,14 @@ func (h *TelemetryHandler) ListMITRETechniques(c *gin.Context) {
 	tacticID := c.Query("tactic_id")
 
 	query := `
-		SELECT technique_id, tactic_id, name, description, platforms, url
+		SELECT technique_id, tactic_id, name, description, platforms, url, COALESCE(parent_technique_id, '')
 		FROM mitre_techniques
 	`
 	args := []interface{}{}
 
 	if tacticID != "" {
-		query += " WHERE tactic_id = $1"
+		// Imported techniques can belong to several tactics
+		query += " WHERE (tactic_id = $1 OR $1 = ANY(tactic_ids))"
 		args = append(args, tacticID)
 	}
 
@@ -503,7 +1060,7 @@ func (h *TelemetryHandler) ListMITRETechniques(c *gin.Context) {
 		var tacticID, description, url sql.NullString
 		var platforms interface{}
 
-		err := rows.Scan(&tech.TechniqueID, &tacticID, &tech.Name, &description, &platforms, &url)
+		err := rows.Scan(&tech.TechniqueID, &tacticID, &tech.Name, &description, &platforms, &url, &tech.ParentTechniqueID)
 		if err != nil {
 			log.Warnf("Failed to scan technique: %v", err)
 			continue
@@ -540,25 +1097,50 @@ func (h *TelemetryHandler) ListMITRETechniques(c *gin.Context) {
 	})
 }
 
-// GetMITRECoverage calculates MITRE ATT&CK detection coverage
+// GetMITRECoverage calculates MITRE ATT&CK detection coverage. ?format=csv or ?format=pdf returns a download instead of JSON.
 func (h *TelemetryHandler) GetMITRECoverage(c *gin.Context) {
 	if h.clickhouse == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
 		return
 	}
 
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
 	tenantID := c.Query("tenant_id")
 	if tenantID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "tenant_id required"})
 		return
 	}
 
+	coverage, err := h.mitreCoverage(context.Background(), tenantID)
+	if err != nil {
+		log.Errorf("Failed to query coverage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
+		return
+	}
+
+	switch format {
+	case exportFormatCSV:
+		setExportFilename(c, "mitre-coverage", tenantID, format)
+		writeCoverageCSV(c, coverage)
+	case exportFormatPDF:
+		setExportFilename(c, "mitre-coverage", tenantID, format)
+		writeCoveragePDF(c, tenantID, coverage)
+	default:
+		c.JSON(http.StatusOK, coverage)
+	}
+}
+
+// mitreCoverage calculates which MITRE ATT&CK techniques a tenant's telemetry and deception events have detected
+func (h *TelemetryHandler) mitreCoverage(ctx context.Context, tenantID string) (models.MITRECoverage, error) {
 	// Get total techniques from PostgreSQL
 	var totalTechniques int
 	h.db.QueryRow("SELECT COUNT(*) FROM mitre_techniques").Scan(&totalTechniques)
 
 	// Get detected techniques from ClickHouse
-	ctx := context.Background()
 	rows, err := h.clickhouse.Query(ctx,
 		`SELECT mitre_technique, COUNT(*) as cnt, min(timestamp) as first_seen, max(timestamp) as last_seen
 		FROM telemetry_events
@@ -567,9 +1149,7 @@ func (h *TelemetryHandler) GetMITRECoverage(c *gin.Context) {
 		tenantID)
 
 	if err != nil {
-		log.Errorf("Failed to query coverage: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Query failed"})
-		return
+		return models.MITRECoverage{}, err
 	}
 	defer rows.Close()
 
@@ -588,7 +1168,14 @@ func (h *TelemetryHandler) GetMITRECoverage(c *gin.Context) {
 		DetectedTechniques: detectedTechniques,
 	}
 
-	c.JSON(http.StatusOK, coverage)
+	// Telemetry tenant IDs are license IDs
+	deception, err := h.deceptionTechniques(tenantID)
+	if err != nil {
+		log.Warnf("Failed to include deception events in coverage: %v", err)
+	}
+	mergeDeceptionCoverage(&coverage, deception)
+
+	return coverage, nil
 }
 
 // Alert Rules Management
@@ -602,7 +1189,8 @@ func (h *TelemetryHandler) ListAlertRules(c *gin.Context) {
 	}
 
 	query := `
-		SELECT id, license_id, name, description, severity, enabled, condition, actions, created_at, updated_at
+		SELECT id, license_id, name, description, severity, enabled, condition, actions,
+		       COALESCE(mitre_techniques, '{}'), created_at, updated_at
 		FROM alert_rules
 		WHERE license_id = $1
 		ORDER BY created_at DESC
@@ -624,7 +1212,7 @@ func (h *TelemetryHandler) ListAlertRules(c *gin.Context) {
 
 		err := rows.Scan(
 			&rule.ID, &rule.LicenseID, &rule.Name, &description, &rule.Severity,
-			&rule.Enabled, &conditionJSON, &actionsJSON, &rule.CreatedAt, &rule.UpdatedAt,
+			&rule.Enabled, &conditionJSON, &actionsJSON, pq.Array(&rule.MitreTechniques), &rule.CreatedAt, &rule.UpdatedAt,
 		)
 
 		if err != nil {
@@ -657,24 +1245,36 @@ func (h *TelemetryHandler) ListAlertRules(c *gin.Context) {
 func (h *TelemetryHandler) CreateAlertRule(c *gin.Context) {
 	var req models.CreateAlertRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	if fields := validateAlertRuleActions(req.Actions); fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+		return
+	}
+	if alertRuleIsolates(req.Actions) && !middleware.HasPermission(c, models.PermAgentsIsolate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Isolating hosts requires the agents:isolate permission"})
 		return
 	}
 
 	ruleID := uuid.New().String()
 	conditionJSON, _ := json.Marshal(req.Condition)
 	actionsJSON, _ := json.Marshal(req.Actions)
+	if req.MitreTechniques == nil {
+		req.MitreTechniques = []string{}
+	}
 
 	query := `
-		INSERT INTO alert_rules (id, license_id, name, description, severity, enabled, condition, actions, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		INSERT INTO alert_rules (id, license_id, name, description, severity, enabled, condition, actions, mitre_techniques, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
 		RETURNING created_at, updated_at
 	`
 
 	var createdAt, updatedAt time.Time
 	err := h.db.QueryRow(query,
 		ruleID, req.LicenseID, req.Name, req.Description, req.Severity,
-		req.Enabled, string(conditionJSON), string(actionsJSON),
+		req.Enabled, string(conditionJSON), string(actionsJSON), pq.Array(req.MitreTechniques),
 	).Scan(&createdAt, &updatedAt)
 
 	if err != nil {
@@ -696,10 +1296,21 @@ func (h *TelemetryHandler) UpdateAlertRule(c *gin.Context) {
 
 	var req models.UpdateAlertRuleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
 		return
 	}
 
+	if req.Actions != nil {
+		if fields := validateAlertRuleActions(*req.Actions); fields != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fields})
+			return
+		}
+		if alertRuleIsolates(*req.Actions) && !middleware.HasPermission(c, models.PermAgentsIsolate) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Isolating hosts requires the agents:isolate permission"})
+			return
+		}
+	}
+
 	// Build dynamic update query (similar to DLP handler)
 	query := "UPDATE alert_rules SET updated_at = NOW()"
 	args := []interface{}{}
@@ -737,6 +1348,11 @@ func (h *TelemetryHandler) UpdateAlertRule(c *gin.Context) {
 		args = append(args, string(actionsJSON))
 		argCount++
 	}
+	if req.MitreTechniques != nil {
+		query += fmt.Sprintf(", mitre_techniques = $%d", argCount)
+		args = append(args, pq.Array(*req.MitreTechniques))
+		argCount++
+	}
 
 	query += fmt.Sprintf(" WHERE id = $%d", argCount)
 	args = append(args, ruleID)
@@ -0,0 +1,152 @@
+// Deception Coverage
+// Credits MITRE ATT&CK techniques evidenced by deception events to coverage and statistics
+
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// Detection sources of a technique
+const (
+	detectionSourceTelemetry = "telemetry"
+	detectionSourceDeception = "deception"
+)
+
+// deceptionMappingJoin matches deception events to the techniques they evidence. A mapping with
+// an empty interaction_type applies to every interaction of its event type.
+const deceptionMappingJoin = `
+	JOIN deception_mitre_mappings m
+	  ON m.event_type = e.event_type AND (m.interaction_type = '' OR m.interaction_type = e.interaction_type)`
+
+// deceptionTechniques returns the techniques a license's deception events evidence
+func (h *TelemetryHandler) deceptionTechniques(licenseID string) ([]models.DetectedTechnique, error) {
+	rows, err := h.db.Query(`
+		SELECT m.technique_id, COUNT(*), MIN(e.detected_at), MAX(e.detected_at)
+		FROM deception_events e`+deceptionMappingJoin+`
+		WHERE e.license_id::text = $1
+		GROUP BY m.technique_id
+	`, licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deception techniques: %w", err)
+	}
+	defer rows.Close()
+
+	techniques := make([]models.DetectedTechnique, 0)
+	for rows.Next() {
+		var tech models.DetectedTechnique
+		if err := rows.Scan(&tech.TechniqueID, &tech.DeceptionEventCount, &tech.FirstSeen, &tech.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan deception technique: %w", err)
+		}
+		tech.EventCount = tech.DeceptionEventCount
+		tech.Sources = []string{detectionSourceDeception}
+		techniques = append(techniques, tech)
+	}
+	return techniques, rows.Err()
+}
+
+// mergeDeceptionCoverage adds deception-evidenced techniques to telemetry coverage. A technique
+// seen by both has its counts summed and its first and last sightings widened.
+func mergeDeceptionCoverage(coverage *models.MITRECoverage, deception []models.DetectedTechnique) {
+	index := make(map[string]int, len(coverage.DetectedTechniques))
+	for i := range coverage.DetectedTechniques {
+		coverage.DetectedTechniques[i].Sources = []string{detectionSourceTelemetry}
+		index[coverage.DetectedTechniques[i].TechniqueID] = i
+	}
+
+	for _, tech := range deception {
+		i, ok := index[tech.TechniqueID]
+		if !ok {
+			coverage.DetectedTechniques = append(coverage.DetectedTechniques, tech)
+			coverage.DeceptionOnlyCount++
+			continue
+		}
+		merged := &coverage.DetectedTechniques[i]
+		merged.EventCount += tech.DeceptionEventCount
+		merged.DeceptionEventCount = tech.DeceptionEventCount
+		merged.Sources = append(merged.Sources, detectionSourceDeception)
+		if tech.FirstSeen.Before(merged.FirstSeen) {
+			merged.FirstSeen = tech.FirstSeen
+		}
+		if tech.LastSeen.After(merged.LastSeen) {
+			merged.LastSeen = tech.LastSeen
+		}
+	}
+
+	coverage.DetectedCount = len(coverage.DetectedTechniques)
+	if coverage.TotalTechniques > 0 {
+		coverage.CoveragePercent = float64(coverage.DetectedCount) / float64(coverage.TotalTechniques) * 100
+	}
+}
+
+// deceptionStatistics counts a license's deception events in a time range, by event type and by
+// the MITRE tactics they evidence
+func (h *TelemetryHandler) deceptionStatistics(licenseID string, start, end time.Time) (int64, map[string]int64, map[string]int64, error) {
+	byType := make(map[string]int64)
+	rows, err := h.db.Query(`
+		SELECT event_type, COUNT(*)
+		FROM deception_events
+		WHERE license_id::text = $1 AND detected_at >= $2 AND detected_at <= $3
+		GROUP BY event_type
+	`, licenseID, start, end)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to query deception events: %w", err)
+	}
+	var total int64
+	for rows.Next() {
+		var eventType string
+		var count int64
+		if err := rows.Scan(&eventType, &count); err != nil {
+			rows.Close()
+			return 0, nil, nil, fmt.Errorf("failed to scan deception event count: %w", err)
+		}
+		byType[eventType] = count
+		total += count
+	}
+	rows.Close()
+
+	// An event counts once per tactic even when it evidences several techniques of that tactic
+	byTactic := make(map[string]int64)
+	rows, err = h.db.Query(`
+		SELECT m.tactic_id, COUNT(DISTINCT e.id)
+		FROM deception_events e`+deceptionMappingJoin+`
+		WHERE e.license_id::text = $1 AND e.detected_at >= $2 AND e.detected_at <= $3
+		GROUP BY m.tactic_id
+	`, licenseID, start, end)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to query deception tactics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tacticID string
+		var count int64
+		if err := rows.Scan(&tacticID, &count); err != nil {
+			return 0, nil, nil, fmt.Errorf("failed to scan deception tactic count: %w", err)
+		}
+		byTactic[tacticID] = count
+	}
+	return total, byType, byTactic, rows.Err()
+}
+
+// topTactics ranks tactic counts, most frequent first, with percentages of total
+func topTactics(counts map[string]int64, total int64, limit int) []models.MitreStat {
+	tactics := make([]models.MitreStat, 0, len(counts))
+	for _, tactic := range sortedCounts(counts) {
+		percentage := 0.0
+		if total > 0 {
+			percentage = float64(counts[tactic]) / float64(total) * 100
+		}
+		tactics = append(tactics, models.MitreStat{
+			ID:         tactic,
+			EventCount: counts[tactic],
+			Percentage: percentage,
+		})
+	}
+	if len(tactics) > limit {
+		tactics = tactics[:limit]
+	}
+	return tactics
+}
@@ -0,0 +1,196 @@
+// Telemetry Exports
+// CSV and PDF renderings of the statistics and MITRE coverage views for sharing outside the console
+
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Export formats accepted by ?format= on the statistics and coverage endpoints
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+	exportFormatPDF  = "pdf"
+)
+
+// exportFormat reads ?format=, defaulting to JSON. It writes a 400 and returns false for unknown formats.
+func exportFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", exportFormatJSON)
+	if format != exportFormatJSON && format != exportFormatCSV && format != exportFormatPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or pdf"})
+		return "", false
+	}
+	return format, true
+}
+
+// setExportFilename marks the response as a download named <name>-<tenant>-<date>.<format>
+func setExportFilename(c *gin.Context, name, tenantID, format string) {
+	filename := fmt.Sprintf("%s-%s-%s.%s", name, tenantID, time.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
+
+// sortedCounts orders a count map by descending count, then key
+func sortedCounts(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// csvFormulaPrefixes are the leading characters that make spreadsheets evaluate a cell as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvSafeWriter writes CSV for opening in spreadsheets. Cells starting with a formula character
+// are prefixed with a single quote so host names, rule names and other event data cannot run
+// as formulas.
+type csvSafeWriter struct {
+	*csv.Writer
+}
+
+// newCSVSafeWriter creates a csvSafeWriter writing to w
+func newCSVSafeWriter(w io.Writer) csvSafeWriter {
+	return csvSafeWriter{csv.NewWriter(w)}
+}
+
+// Write writes one record with its cells neutralized
+func (w csvSafeWriter) Write(record []string) error {
+	safe := make([]string, len(record))
+	for i, cell := range record {
+		safe[i] = csvSafeCell(cell)
+	}
+	return w.Writer.Write(safe)
+}
+
+// csvSafeCell prefixes a cell that a spreadsheet would read as a formula with a single quote
+func csvSafeCell(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// writeStatisticsCSV writes statistics as section,key,name,count,percentage rows
+func writeStatisticsCSV(c *gin.Context, stats models.Statistics) {
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	count := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	writer := newCSVSafeWriter(c.Writer)
+	writer.Write([]string{"section", "key", "name", "count", "percentage"})
+	writer.Write([]string{"range", "start", "", stats.TimeRange.Start.UTC().Format(time.RFC3339), ""})
+	writer.Write([]string{"range", "end", "", stats.TimeRange.End.UTC().Format(time.RFC3339), ""})
+	writer.Write([]string{"total", "events", "", count(stats.TotalEvents), ""})
+	writer.Write([]string{"total", "agents", "", count(stats.UniqueAgents), ""})
+	writer.Write([]string{"total", "hosts", "", count(stats.UniqueHosts), ""})
+
+	for level := len(eventSeverityNames) - 1; level >= 0; level-- {
+		if v, ok := stats.EventsBySeverity[uint8(level)]; ok {
+			writer.Write([]string{"severity", eventSeverityName(uint8(level)), "", count(v), ""})
+		}
+	}
+	for _, eventType := range sortedCounts(stats.EventsByType) {
+		writer.Write([]string{"event_type", eventType, "", count(stats.EventsByType[eventType]), ""})
+	}
+	for _, host := range sortedCounts(stats.EventsByHost) {
+		writer.Write([]string{"host", host, "", count(stats.EventsByHost[host]), ""})
+	}
+	writer.Write([]string{"total", "deception_events", "", count(stats.DeceptionEvents), ""})
+	for _, eventType := range sortedCounts(stats.DeceptionEventsByType) {
+		writer.Write([]string{"deception_type", eventType, "", count(stats.DeceptionEventsByType[eventType]), ""})
+	}
+	for _, tactic := range stats.TopMitreTactics {
+		writer.Write([]string{"mitre_tactic", tactic.ID, tactic.Name, count(tactic.EventCount), strconv.FormatFloat(tactic.Percentage, 'f', 2, 64)})
+	}
+	for _, technique := range stats.TopMitreTechniques {
+		writer.Write([]string{"mitre_technique", technique.ID, technique.Name, count(technique.EventCount), strconv.FormatFloat(technique.Percentage, 'f', 2, 64)})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Errorf("Failed to write statistics export: %v", err)
+	}
+}
+
+// writeCoverageCSV writes one row per detected technique, most active first, after a summary row
+func writeCoverageCSV(c *gin.Context, coverage models.MITRECoverage) {
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	techniques := append([]models.DetectedTechnique(nil), coverage.DetectedTechniques...)
+	sort.Slice(techniques, func(i, j int) bool { return techniques[i].EventCount > techniques[j].EventCount })
+
+	writer := newCSVSafeWriter(c.Writer)
+	writer.Write([]string{"technique_id", "technique_name", "event_count", "first_seen", "last_seen", "sources"})
+	for _, tech := range techniques {
+		writer.Write([]string{
+			tech.TechniqueID,
+			tech.TechniqueName,
+			strconv.FormatInt(tech.EventCount, 10),
+			tech.FirstSeen.UTC().Format(time.RFC3339),
+			tech.LastSeen.UTC().Format(time.RFC3339),
+			strings.Join(tech.Sources, ";"),
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Errorf("Failed to write coverage export: %v", err)
+	}
+}
+
+// writeStatisticsPDF renders statistics through the report layout
+func writeStatisticsPDF(c *gin.Context, tenantID string, stats models.Statistics, start, end time.Time) {
+	report := models.SecurityReport{
+		LicenseID:   tenantID,
+		Title:       "Telemetry Statistics",
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: time.Now().UTC(),
+		Sections:    []string{models.ReportSectionTopThreats},
+		TopThreats:  &stats,
+	}
+	writeReportPDF(c, report)
+}
+
+// writeReportPDF answers with the report rendered as a PDF
+func writeReportPDF(c *gin.Context, report models.SecurityReport) {
+	pdf, err := renderReportPDF(report)
+	if err != nil {
+		log.Errorf("Failed to render PDF: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render report"})
+		return
+	}
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// writeCoveragePDF renders MITRE coverage through the report layout
+func writeCoveragePDF(c *gin.Context, tenantID string, coverage models.MITRECoverage) {
+	report := models.SecurityReport{
+		LicenseID:     tenantID,
+		Title:         "MITRE ATT&CK Coverage",
+		GeneratedAt:   time.Now().UTC(),
+		Sections:      []string{models.ReportSectionMITRECoverage},
+		MITRECoverage: &coverage,
+	}
+	writeReportPDF(c, report)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+func TestCSVSafeCell(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"web-01", "web-01"},
+		{"42", "42"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvSafeCell(tt.cell); got != tt.want {
+			t.Errorf("csvSafeCell(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestWriteStatisticsCSVNeutralizesFormulas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	writeStatisticsCSV(c, models.Statistics{
+		EventsByHost: map[string]int64{"=cmd|'/c calc'!A1": 3},
+		TopMitreTactics: []models.MitreStat{
+			{ID: "TA0002", Name: "@Execution", EventCount: 3, Percentage: 100},
+		},
+	})
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	for _, record := range records {
+		for _, cell := range record {
+			if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+				t.Errorf("cell %q starts with a formula character", cell)
+			}
+		}
+	}
+	if !strings.Contains(w.Body.String(), `host,'=cmd|'/c calc'!A1,,3,`) {
+		t.Errorf("host row not neutralized:\n%s", w.Body.String())
+	}
+}
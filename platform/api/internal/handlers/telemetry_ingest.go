@@ -0,0 +1,366 @@
+// REST Telemetry Ingestion
+// Batch event submission for agents and integrations that cannot use the gRPC ingestor
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// IngestSubject is the JetStream subject the gRPC ingestor publishes to and the consumer reads
+	// when no subject template is configured
+	IngestSubject = "edr.events.raw"
+
+	// ingestDLQSubject is where the consumer dead-letters events; routed events must never land on it
+	ingestDLQSubject = "edr.events.dlq"
+
+	// LicenseKeyHeader authenticates REST ingestion with the same key agents register with
+	LicenseKeyHeader = "X-License-Key"
+
+	// maxIngestBatchBytes matches the ingestor's gRPC max message size
+	maxIngestBatchBytes = 4 * 1024 * 1024
+
+	// maxIngestBatchEvents bounds a single batch; larger volumes should be split
+	maxIngestBatchEvents = 1000
+
+	// maxIngestPayloadBytes bounds the payload of a single event
+	maxIngestPayloadBytes = 64 * 1024
+)
+
+// ingestEventTypes are the event types the consumer maps onto the ClickHouse event_type enum
+var ingestEventTypes = map[string]bool{
+	"PROCESS_START":     true,
+	"PROCESS_TERMINATE": true,
+	"FILE_ACCESS":       true,
+	"FILE_MODIFY":       true,
+	"FILE_DELETE":       true,
+	"NETWORK_CONN":      true,
+	"REGISTRY_MODIFY":   true,
+	"DLP_VIOLATION":     true,
+	"AUTHENTICATION":    true,
+}
+
+// ingestWireEvent is the message format the consumer decodes from NATS
+type ingestWireEvent struct {
+	AgentID        string `json:"agent_id"`
+	Timestamp      int64  `json:"timestamp"`
+	EventType      string `json:"event_type"`
+	MitreTactic    string `json:"mitre_tactic"`
+	MitreTechnique string `json:"mitre_technique"`
+	Severity       int32  `json:"severity"`
+	Payload        string `json:"payload"`
+	TenantID       string `json:"tenant_id"`
+	Hostname       string `json:"hostname"`
+	OSType         string `json:"os_type"`
+}
+
+// IngestHandler publishes REST-submitted telemetry onto the ingestion stream
+type IngestHandler struct {
+	db              *sql.DB
+	jetStream       nats.JetStreamContext
+	limiter         *ingestRateLimiter
+	subjectTemplate string
+
+	simulationEnabled bool
+	simMu             sync.Mutex
+	simulations       map[string]*models.TelemetrySimulation
+}
+
+// NewIngestHandler creates an ingest handler. eventsPerSecond limits each license's REST
+// ingestion rate (0 disables the limit); a nil jetStream disables the endpoint.
+func NewIngestHandler(db *sql.DB, jetStream nats.JetStreamContext, eventsPerSecond int) *IngestHandler {
+	return &IngestHandler{
+		db:              db,
+		jetStream:       jetStream,
+		limiter:         newIngestRateLimiter(eventsPerSecond),
+		subjectTemplate: IngestSubject,
+
+		simulations: make(map[string]*models.TelemetrySimulation),
+	}
+}
+
+// SetSubjectTemplate publishes events on the subjects the gRPC ingestor routes them to with the
+// same INGESTOR_SUBJECT_TEMPLATE, e.g. edr.events.{tenant}.{type}, so consumers filtering on
+// routed subjects also receive REST-submitted and simulated events
+func (h *IngestHandler) SetSubjectTemplate(template string) error {
+	if !strings.HasPrefix(template, "edr.events.") {
+		return fmt.Errorf("subject template %q must start with edr.events.", template)
+	}
+	sample := strings.NewReplacer("{tenant}", "tenant", "{type}", "type").Replace(template)
+	for _, token := range strings.Split(sample, ".") {
+		if token == "" || strings.ContainsAny(token, "*> \t{}") {
+			return fmt.Errorf("subject template %q is not a valid subject; only {tenant} and {type} may be substituted", template)
+		}
+	}
+	tokens := strings.Split(template, ".")
+	if template == ingestDLQSubject || (len(tokens) == 3 && strings.Contains(tokens[2], "{")) {
+		return fmt.Errorf("subject template %q could publish on the dead-letter subject %s", template, ingestDLQSubject)
+	}
+	h.subjectTemplate = template
+	return nil
+}
+
+// subject returns the subject an event is published on. Missing fields are routed under
+// "unknown", as the ingestor does.
+func (h *IngestHandler) subject(wire ingestWireEvent) string {
+	return strings.NewReplacer(
+		"{tenant}", ingestSubjectToken(wire.TenantID),
+		"{type}", ingestSubjectToken(strings.ToLower(wire.EventType)),
+	).Replace(h.subjectTemplate)
+}
+
+// ingestSubjectToken makes a value safe to use as a single subject token
+func ingestSubjectToken(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '*' || r == '>' || r <= ' ' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// IngestEvents accepts a batch of events from a registered agent and publishes them to NATS
+func (h *IngestHandler) IngestEvents(c *gin.Context) {
+	if h.jetStream == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event ingestion not available"})
+		return
+	}
+
+	licenseKey := c.GetHeader(LicenseKeyHeader)
+	if licenseKey == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": LicenseKeyHeader + " header required"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBatchBytes)
+
+	var req models.IngestBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if len(req.Events) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "events must not be empty"})
+		return
+	}
+	if len(req.Events) > maxIngestBatchEvents {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("at most %d events per batch", maxIngestBatchEvents)})
+		return
+	}
+
+	// The key must belong to a live license and the agent must be registered under it
+	agent, ok := authenticateIngestAgent(c, h.db, licenseKey, req.AgentID)
+	if !ok {
+		return
+	}
+	licenseID := agent.licenseID
+
+	if wait, ok := h.limiter.take(licenseID, len(req.Events)); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Ingestion rate limit exceeded"})
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	response := models.IngestBatchResponse{Rejected: []models.IngestRejection{}}
+	for i, event := range req.Events {
+		wire, err := buildIngestWireEvent(event, now)
+		if err != nil {
+			response.Rejected = append(response.Rejected, models.IngestRejection{Index: i, Error: err.Error()})
+			continue
+		}
+		wire.AgentID = req.AgentID
+		wire.TenantID = licenseID
+		wire.Hostname = agent.hostname
+		wire.OSType = agent.osType
+
+		data, _ := json.Marshal(wire)
+
+		msgID := event.EventID
+		if msgID == "" {
+			msgID = uuid.New().String()
+		} else {
+			// Scope client-supplied IDs so tenants cannot collide in the stream's dedup window
+			msgID = licenseID + ":" + msgID
+		}
+
+		if _, err := h.jetStream.Publish(h.subject(wire), data, nats.MsgId(msgID)); err != nil {
+			log.Errorf("Failed to publish ingested event: %v", err)
+			if response.Accepted == 0 {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to publish events"})
+				return
+			}
+			// Report what made it so the client only retries the remainder
+			for j := i; j < len(req.Events); j++ {
+				response.Rejected = append(response.Rejected, models.IngestRejection{Index: j, Error: "publish failed, retry"})
+			}
+			break
+		}
+		response.Accepted++
+	}
+
+	if response.Accepted > 0 {
+		if _, err := h.db.Exec(
+			"UPDATE license_usage SET events_ingested = events_ingested + $1, last_updated = NOW() WHERE license_id = $2",
+			response.Accepted, licenseID,
+		); err != nil {
+			log.Warnf("Failed to record ingested events for license %s: %v", licenseID, err)
+		}
+	}
+
+	log.Debugf("REST ingest: agent=%s accepted=%d rejected=%d", req.AgentID, response.Accepted, len(response.Rejected))
+
+	status := http.StatusAccepted
+	if response.Accepted == 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, response)
+}
+
+// ingestAgent is the license and registered agent an ingestion request authenticated as
+type ingestAgent struct {
+	licenseID string
+	hostname  string
+	osType    string
+}
+
+// authenticateIngestAgent checks that licenseKey belongs to a live license and agentID is
+// registered under it. On failure the error response has been written and ok is false.
+func authenticateIngestAgent(c *gin.Context, db *sql.DB, licenseKey, agentID string) (agent ingestAgent, ok bool) {
+	var isActive bool
+	var expiresAt sql.NullTime
+	err := db.QueryRow(
+		"SELECT id, is_active, expires_at FROM licenses WHERE license_key = $1",
+		licenseKey,
+	).Scan(&agent.licenseID, &isActive, &expiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("Failed to validate ingest license: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate license"})
+		return agent, false
+	}
+	if err == sql.ErrNoRows || !isActive || (expiresAt.Valid && expiresAt.Time.Before(time.Now())) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or inactive license key"})
+		return agent, false
+	}
+
+	var hostname, osType sql.NullString
+	err = db.QueryRow(
+		"SELECT hostname, os_type FROM agents WHERE agent_id = $1 AND license_id = $2 AND deleted_at IS NULL",
+		agentID, agent.licenseID,
+	).Scan(&hostname, &osType)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Agent is not registered under this license"})
+		return agent, false
+	}
+	if err != nil {
+		log.Errorf("Failed to look up ingest agent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate agent"})
+		return agent, false
+	}
+	agent.hostname, agent.osType = hostname.String, osType.String
+	return agent, true
+}
+
+// buildIngestWireEvent validates a submitted event and converts it to the consumer's format
+func buildIngestWireEvent(event models.IngestEvent, now int64) (ingestWireEvent, error) {
+	eventType := strings.ToUpper(strings.TrimSpace(event.EventType))
+	if !ingestEventTypes[eventType] {
+		return ingestWireEvent{}, fmt.Errorf("unknown event_type %q", event.EventType)
+	}
+	if event.Severity < 0 || event.Severity > 4 {
+		return ingestWireEvent{}, fmt.Errorf("severity must be between 0 and 4")
+	}
+	if len(event.Payload) > maxIngestPayloadBytes {
+		return ingestWireEvent{}, fmt.Errorf("payload exceeds %d bytes", maxIngestPayloadBytes)
+	}
+
+	// Payloads are stored as JSON text; accept either an object or an already-encoded string
+	payload := string(event.Payload)
+	if len(event.Payload) > 0 && event.Payload[0] == '"' {
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return ingestWireEvent{}, fmt.Errorf("invalid payload: %v", err)
+		}
+	}
+
+	timestamp := event.Timestamp
+	if timestamp == 0 {
+		timestamp = now
+	}
+
+	return ingestWireEvent{
+		Timestamp:      timestamp,
+		EventType:      eventType,
+		MitreTactic:    event.MitreTactic,
+		MitreTechnique: event.MitreTechnique,
+		Severity:       event.Severity,
+		Payload:        payload,
+	}, nil
+}
+
+// ingestRateLimiter is a per-license token bucket refilled at rate events per second,
+// holding at most one second of burst
+type ingestRateLimiter struct {
+	rate float64
+
+	mu      sync.Mutex
+	buckets map[string]*ingestBucket
+}
+
+type ingestBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newIngestRateLimiter(eventsPerSecond int) *ingestRateLimiter {
+	return &ingestRateLimiter{
+		rate:    float64(eventsPerSecond),
+		buckets: make(map[string]*ingestBucket),
+	}
+}
+
+// take consumes n tokens for the license. When not enough are available nothing is consumed
+// and the time until they will be is returned.
+func (l *ingestRateLimiter) take(licenseID string, n int) (time.Duration, bool) {
+	if l.rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[licenseID]
+	if !ok {
+		bucket = &ingestBucket{tokens: l.rate, updated: now}
+		l.buckets[licenseID] = bucket
+	}
+	bucket.tokens = math.Min(l.rate, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	// A batch larger than the burst can never fit; let it through once the bucket is full
+	need := math.Min(float64(n), l.rate)
+	if bucket.tokens < need {
+		return time.Duration((need - bucket.tokens) / l.rate * float64(time.Second)), false
+	}
+	bucket.tokens -= float64(n)
+	return 0, true
+}
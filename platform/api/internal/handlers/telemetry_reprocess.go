@@ -0,0 +1,271 @@
+// Event Reprocessing
+// Jobs re-enriching stored events after GeoIP, reputation or MITRE mapping data changes
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+// maxReprocessRange bounds a single job; older ranges are split into several jobs
+const maxReprocessRange = 366 * 24 * time.Hour
+
+// CreateReprocessJob queues a job re-applying the consumer's current enrichment to a license's
+// events in a time range. A consumer picks it up within a minute; a license runs one job at a time.
+func (h *TelemetryHandler) CreateReprocessJob(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+
+	var req models.CreateReprocessJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+
+	startTime, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start_time format, use RFC3339"})
+		return
+	}
+	endTime, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_time format, use RFC3339"})
+		return
+	}
+	if !endTime.After(startTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+		return
+	}
+	if endTime.Sub(startTime) > maxReprocessRange {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "time range must not exceed 366 days"})
+		return
+	}
+
+	enrichments := req.Enrichments
+	if len(enrichments) == 0 {
+		enrichments = models.ReprocessEnrichments
+	}
+	seen := map[string]bool{}
+	deduped := make([]string, 0, len(enrichments))
+	for _, enrichment := range enrichments {
+		if !containsString(models.ReprocessEnrichments, enrichment) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown enrichment %q; available enrichments: %v", enrichment, models.ReprocessEnrichments)})
+			return
+		}
+		if !seen[enrichment] {
+			seen[enrichment] = true
+			deduped = append(deduped, enrichment)
+		}
+	}
+
+	ctx := c.Request.Context()
+	active, err := h.listReprocessJobs(ctx, req.LicenseID, "", models.ReprocessStatusPending, models.ReprocessStatusRunning)
+	if err != nil {
+		log.Errorf("Failed to check active reprocessing jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reprocessing job"})
+		return
+	}
+	if len(active) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A reprocessing job is already active for this license", "job_id": active[0].ID})
+		return
+	}
+
+	// Events under legal hold must stay exactly as they were preserved
+	var holdID string
+	err = h.db.QueryRow(`
+		SELECT id FROM legal_holds
+		WHERE license_id::text = $1 AND status = $2 AND start_time < $4 AND end_time >= $3
+		ORDER BY start_time
+		LIMIT 1
+	`, req.LicenseID, models.LegalHoldActive, startTime.UTC(), endTime.UTC()).Scan(&holdID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Errorf("Failed to check legal holds: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reprocessing job"})
+		return
+	}
+	if holdID != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Time range overlaps an active legal hold; held events cannot be reprocessed", "hold_id": holdID})
+		return
+	}
+
+	job := models.ReprocessJob{
+		ID:          uuid.New().String(),
+		LicenseID:   req.LicenseID,
+		StartTime:   startTime.UTC(),
+		EndTime:     endTime.UTC(),
+		Enrichments: deduped,
+		Status:      models.ReprocessStatusPending,
+		RequestedBy: req.RequestedBy,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := h.writeReprocessJob(ctx, job); err != nil {
+		log.Errorf("Failed to create reprocessing job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reprocessing job"})
+		return
+	}
+
+	log.Infof("Reprocessing job %s queued for license %s (%s to %s)", job.ID, job.LicenseID,
+		job.StartTime.Format(time.RFC3339), job.EndTime.Format(time.RFC3339))
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListReprocessJobs lists a license's reprocessing jobs, newest first
+func (h *TelemetryHandler) ListReprocessJobs(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	jobs, err := h.listReprocessJobs(c.Request.Context(), licenseID, "")
+	if err != nil {
+		log.Errorf("Failed to list reprocessing jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list reprocessing jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": jobs, "count": len(jobs), "enrichments": models.ReprocessEnrichments})
+}
+
+// GetReprocessJob returns a reprocessing job with its progress
+func (h *TelemetryHandler) GetReprocessJob(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	jobs, err := h.listReprocessJobs(c.Request.Context(), licenseID, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to look up reprocessing job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reprocessing job"})
+		return
+	}
+	if len(jobs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reprocessing job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs[0])
+}
+
+// CancelReprocessJob stops a pending or running job. The consumer notices between partitions,
+// so the partition in progress still completes; partitions already done keep their new enrichment.
+func (h *TelemetryHandler) CancelReprocessJob(c *gin.Context) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	jobs, err := h.listReprocessJobs(ctx, licenseID, c.Param("id"))
+	if err != nil {
+		log.Errorf("Failed to look up reprocessing job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel reprocessing job"})
+		return
+	}
+	if len(jobs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reprocessing job not found"})
+		return
+	}
+
+	job := jobs[0]
+	if job.Status != models.ReprocessStatusPending && job.Status != models.ReprocessStatusRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Reprocessing job is already %s", job.Status)})
+		return
+	}
+
+	now := time.Now().UTC()
+	job.Status = models.ReprocessStatusCancelled
+	job.FinishedAt = &now
+	if err := h.writeReprocessJob(ctx, job); err != nil {
+		log.Errorf("Failed to cancel reprocessing job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel reprocessing job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// listReprocessJobs returns a license's jobs, or the single job with jobID when it is set,
+// optionally limited to statuses
+func (h *TelemetryHandler) listReprocessJobs(ctx context.Context, licenseID, jobID string, statuses ...string) ([]models.ReprocessJob, error) {
+	query := `
+		SELECT job_id, tenant_id, start_time, end_time, enrichments, status, claimed_by,
+		       total_partitions, done_partitions, total_events, processed_events, error,
+		       requested_by, created_at, started_at, finished_at
+		FROM telemetry_reprocess_jobs FINAL
+		WHERE tenant_id = ?`
+	args := []interface{}{licenseID}
+	if jobID != "" {
+		query += " AND job_id = ?"
+		args = append(args, jobID)
+	}
+	if len(statuses) > 0 {
+		query += " AND has(?, status)"
+		args = append(args, statuses)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.ReprocessJob{}
+	for rows.Next() {
+		var j models.ReprocessJob
+		if err := rows.Scan(&j.ID, &j.LicenseID, &j.StartTime, &j.EndTime, &j.Enrichments, &j.Status, &j.ClaimedBy,
+			&j.TotalPartitions, &j.DonePartitions, &j.TotalEvents, &j.ProcessedEvents, &j.Error,
+			&j.RequestedBy, &j.CreatedAt, &j.StartedAt, &j.FinishedAt); err != nil {
+			return nil, err
+		}
+		switch {
+		case j.Status == models.ReprocessStatusCompleted:
+			j.ProgressPercent = 100
+		case j.TotalEvents > 0:
+			j.ProgressPercent = float64(j.ProcessedEvents) / float64(j.TotalEvents) * 100
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// writeReprocessJob inserts a new version of a job; the ReplacingMergeTree keeps the latest
+func (h *TelemetryHandler) writeReprocessJob(ctx context.Context, j models.ReprocessJob) error {
+	return h.clickhouse.Exec(ctx, `
+		INSERT INTO telemetry_reprocess_jobs (
+			tenant_id, job_id, start_time, end_time, enrichments, status, claimed_by,
+			total_partitions, done_partitions, total_events, processed_events, error,
+			requested_by, created_at, started_at, finished_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, j.LicenseID, j.ID, j.StartTime, j.EndTime, j.Enrichments, j.Status, j.ClaimedBy,
+		j.TotalPartitions, j.DonePartitions, j.TotalEvents, j.ProcessedEvents, j.Error,
+		j.RequestedBy, j.CreatedAt, j.StartedAt, j.FinishedAt, time.Now().UTC())
+}
@@ -0,0 +1,400 @@
+// Telemetry Simulation
+// Publishes synthetic events through the real NATS to ClickHouse pipeline so alert rules, deception
+// and dashboards can be exercised without deploying agents
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// defaultSimulationRate is the events per second of a simulation that does not set one
+	defaultSimulationRate = 100
+
+	// defaultSimulationMitreRatio is the share of simulated events tagged with a technique
+	defaultSimulationMitreRatio = 0.1
+
+	// simulationRetention is how long finished simulations stay queryable
+	simulationRetention = time.Hour
+)
+
+// defaultSimulationSeverities weights severities like typical endpoint traffic: mostly informational
+var defaultSimulationSeverities = map[string]int{"0": 70, "1": 15, "2": 10, "3": 4, "4": 1}
+
+// SetSimulationEnabled turns the telemetry simulation endpoint on. It is off by default so
+// synthetic events never reach production tenants by accident.
+func (h *IngestHandler) SetSimulationEnabled(enabled bool) {
+	h.simulationEnabled = enabled
+}
+
+// SimulateTelemetry starts publishing synthetic events for a license and returns immediately;
+// poll GetTelemetrySimulation for progress
+func (h *IngestHandler) SimulateTelemetry(c *gin.Context) {
+	if !h.simulationEnabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Telemetry simulation is disabled"})
+		return
+	}
+	if h.jetStream == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Event ingestion not available"})
+		return
+	}
+
+	var req models.SimulateTelemetryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	for eventType := range req.EventTypes {
+		if !ingestEventTypes[eventType] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"event_types." + eventType: "is not an event type"}})
+			return
+		}
+	}
+	if len(req.EventTypes) > 0 && totalWeight(req.EventTypes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"event_types": "must give at least one event type a positive weight"}})
+		return
+	}
+	if len(req.Severities) > 0 && totalWeight(req.Severities) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"severities": "must give at least one severity a positive weight"}})
+		return
+	}
+	for severity := range req.Severities {
+		if n, err := strconv.Atoi(severity); err != nil || n < 0 || n > 4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": map[string]string{"severities." + severity: "must be a severity from 0 to 4"}})
+			return
+		}
+	}
+
+	var isActive bool
+	err := h.db.QueryRow("SELECT is_active FROM licenses WHERE id = $1", req.LicenseID).Scan(&isActive)
+	if err == sql.ErrNoRows || (err == nil && !isActive) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "License not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to look up simulation license: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start simulation"})
+		return
+	}
+
+	hosts, err := h.simulationHosts(req)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent is not registered under this license"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to look up simulation agent: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start simulation"})
+		return
+	}
+
+	tactics, err := h.simulationTactics(req.MitreTechniques)
+	if err != nil {
+		log.Errorf("Failed to look up simulation techniques: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start simulation"})
+		return
+	}
+
+	if req.Rate == 0 {
+		req.Rate = defaultSimulationRate
+	}
+	if req.MitreRatio == 0 {
+		req.MitreRatio = defaultSimulationMitreRatio
+	}
+	if req.Seed == 0 {
+		req.Seed = time.Now().UnixNano()
+	}
+
+	sim := &models.TelemetrySimulation{
+		ID:        uuid.New().String(),
+		LicenseID: req.LicenseID,
+		Status:    models.SimulationRunning,
+		Requested: req.Count,
+		Rate:      req.Rate,
+		Seed:      req.Seed,
+		StartedAt: time.Now(),
+	}
+
+	h.simMu.Lock()
+	for id, existing := range h.simulations {
+		if existing.CompletedAt != nil && time.Since(*existing.CompletedAt) > simulationRetention {
+			delete(h.simulations, id)
+		} else if existing.LicenseID == req.LicenseID && existing.Status == models.SimulationRunning {
+			h.simMu.Unlock()
+			c.JSON(http.StatusConflict, gin.H{"error": "A simulation is already running for this license", "simulation_id": id})
+			return
+		}
+	}
+	h.simulations[sim.ID] = sim
+	h.simMu.Unlock()
+
+	go h.runSimulation(sim, req, hosts, tactics)
+
+	log.Infof("Started telemetry simulation %s: %d events at %d/s for license %s", sim.ID, req.Count, req.Rate, req.LicenseID)
+	c.JSON(http.StatusAccepted, h.simulationSnapshot(sim.ID))
+}
+
+// GetTelemetrySimulation returns the progress of a simulation
+func (h *IngestHandler) GetTelemetrySimulation(c *gin.Context) {
+	snapshot := h.simulationSnapshot(c.Param("id"))
+	if snapshot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Simulation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// simulationSnapshot copies a simulation so it can be serialized while it runs
+func (h *IngestHandler) simulationSnapshot(id string) *models.TelemetrySimulation {
+	h.simMu.Lock()
+	defer h.simMu.Unlock()
+	sim, ok := h.simulations[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *sim
+	return &snapshot
+}
+
+// simulatedHost is an agent that simulated events are attributed to
+type simulatedHost struct {
+	agentID  string
+	hostname string
+	osType   string
+}
+
+// simulationHosts returns the registered agent named by the request, or synthetic hosts
+func (h *IngestHandler) simulationHosts(req models.SimulateTelemetryRequest) ([]simulatedHost, error) {
+	if req.AgentID != "" {
+		var hostname, osType sql.NullString
+		err := h.db.QueryRow(
+			"SELECT hostname, os_type FROM agents WHERE agent_id = $1 AND license_id = $2 AND deleted_at IS NULL",
+			req.AgentID, req.LicenseID,
+		).Scan(&hostname, &osType)
+		if err != nil {
+			return nil, err
+		}
+		return []simulatedHost{{agentID: req.AgentID, hostname: hostname.String, osType: osType.String}}, nil
+	}
+
+	count := req.Hosts
+	if count == 0 {
+		count = 1
+	}
+	hosts := make([]simulatedHost, count)
+	osTypes := []string{"windows", "windows", "linux", "macos"}
+	for i := range hosts {
+		hosts[i] = simulatedHost{
+			agentID:  fmt.Sprintf("simulated-%03d", i+1),
+			hostname: fmt.Sprintf("SIM-HOST-%03d", i+1),
+			osType:   osTypes[i%len(osTypes)],
+		}
+	}
+	return hosts, nil
+}
+
+// simulationTactics maps each requested technique to its first tactic; techniques missing from
+// the ATT&CK tables are tagged without a tactic
+func (h *IngestHandler) simulationTactics(techniques []string) (map[string]string, error) {
+	tactics := make(map[string]string, len(techniques))
+	if len(techniques) == 0 {
+		return tactics, nil
+	}
+
+	rows, err := h.db.Query(
+		"SELECT technique_id, COALESCE(tactic_id, '') FROM mitre_techniques WHERE technique_id = ANY($1)",
+		pq.Array(techniques))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var techniqueID, tacticID string
+		if err := rows.Scan(&techniqueID, &tacticID); err != nil {
+			return nil, err
+		}
+		tactics[techniqueID] = tacticID
+	}
+	return tactics, rows.Err()
+}
+
+// runSimulation publishes the simulation's events at its rate, one batch per tick
+func (h *IngestHandler) runSimulation(sim *models.TelemetrySimulation, req models.SimulateTelemetryRequest, hosts []simulatedHost, tactics map[string]string) {
+	rng := rand.New(rand.NewSource(req.Seed))
+	eventTypes := newWeightedChoice(req.EventTypes, ingestEventTypes)
+	severities := newWeightedChoice(req.Severities, nil)
+	if len(req.Severities) == 0 {
+		severities = newWeightedChoice(defaultSimulationSeverities, nil)
+	}
+
+	// Ten ticks a second keeps the rate smooth without a publish per timer
+	const ticksPerSecond = 10
+	ticker := time.NewTicker(time.Second / ticksPerSecond)
+	defer ticker.Stop()
+
+	published := 0
+	carry := 0.0
+	var failure error
+	for published < req.Count && failure == nil {
+		<-ticker.C
+		carry += float64(req.Rate) / ticksPerSecond
+		for ; carry >= 1 && published < req.Count; carry-- {
+			host := hosts[rng.Intn(len(hosts))]
+			eventType := eventTypes.pick(rng)
+			severity, _ := strconv.Atoi(severities.pick(rng))
+
+			wire := ingestWireEvent{
+				AgentID:   host.agentID,
+				Timestamp: time.Now().UnixMilli(),
+				EventType: eventType,
+				Severity:  int32(severity),
+				TenantID:  req.LicenseID,
+				Hostname:  host.hostname,
+				OSType:    host.osType,
+			}
+			if len(req.MitreTechniques) > 0 && rng.Float64() < req.MitreRatio {
+				wire.MitreTechnique = req.MitreTechniques[rng.Intn(len(req.MitreTechniques))]
+				wire.MitreTactic = tactics[wire.MitreTechnique]
+			}
+			payload, _ := json.Marshal(simulatedPayload(rng, eventType, host, sim.ID))
+			wire.Payload = string(payload)
+
+			data, _ := json.Marshal(wire)
+			if _, err := h.jetStream.Publish(h.subject(wire), data); err != nil {
+				failure = err
+				break
+			}
+			published++
+		}
+
+		h.simMu.Lock()
+		sim.Published = published
+		h.simMu.Unlock()
+	}
+
+	now := time.Now()
+	h.simMu.Lock()
+	sim.Published = published
+	sim.CompletedAt = &now
+	sim.Status = models.SimulationCompleted
+	if failure != nil {
+		sim.Status = models.SimulationFailed
+		sim.Error = "Failed to publish events"
+	}
+	h.simMu.Unlock()
+
+	if failure != nil {
+		log.Errorf("Telemetry simulation %s failed after %d events: %v", sim.ID, published, failure)
+		return
+	}
+	log.Infof("Telemetry simulation %s published %d events", sim.ID, published)
+}
+
+// weightedChoice picks keys in proportion to their weights
+type weightedChoice struct {
+	keys       []string
+	cumulative []int
+}
+
+// newWeightedChoice builds a choice from weights, or an even one over the keys of fallback when
+// weights is empty. Keys are sorted so a seed always gives the same sequence.
+func newWeightedChoice(weights map[string]int, fallback map[string]bool) weightedChoice {
+	if len(weights) == 0 {
+		weights = make(map[string]int, len(fallback))
+		for key := range fallback {
+			weights[key] = 1
+		}
+	}
+	keys := make([]string, 0, len(weights))
+	for key, weight := range weights {
+		if weight > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	choice := weightedChoice{}
+	total := 0
+	for _, key := range keys {
+		total += weights[key]
+		choice.keys = append(choice.keys, key)
+		choice.cumulative = append(choice.cumulative, total)
+	}
+	return choice
+}
+
+func totalWeight(weights map[string]int) int {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	return total
+}
+
+func (w weightedChoice) pick(rng *rand.Rand) string {
+	if len(w.keys) == 0 {
+		return ""
+	}
+	n := rng.Intn(w.cumulative[len(w.cumulative)-1])
+	return w.keys[sort.SearchInts(w.cumulative, n+1)]
+}
+
+// Value pools for simulated payloads
+var (
+	simulatedProcesses = []string{"explorer.exe", "chrome.exe", "powershell.exe", "cmd.exe", "svchost.exe", "outlook.exe", "bash", "python3", "sshd", "curl"}
+	simulatedUsers     = []string{"alice", "bob", "carol", "dave", "svc_backup", "SYSTEM"}
+	simulatedFiles     = []string{`C:\Users\Public\Documents\report.docx`, `C:\Windows\Temp\update.ps1`, `C:\ProgramData\tmp.dll`, "/etc/passwd", "/tmp/.cache/x.sh", "/home/alice/finance.xlsx"}
+	simulatedPorts     = []int{22, 53, 80, 443, 445, 3389, 8080}
+)
+
+// simulatedPayload builds a plausible payload for the event type, marked as simulated
+func simulatedPayload(rng *rand.Rand, eventType string, host simulatedHost, simulationID string) map[string]interface{} {
+	process := simulatedProcesses[rng.Intn(len(simulatedProcesses))]
+	user := simulatedUsers[rng.Intn(len(simulatedUsers))]
+	payload := map[string]interface{}{
+		"simulated":     true,
+		"simulation_id": simulationID,
+		"process_name":  process,
+		"pid":           1000 + rng.Intn(60000),
+		"user":          user,
+	}
+
+	switch eventType {
+	case "PROCESS_START", "PROCESS_TERMINATE":
+		payload["parent_process_name"] = simulatedProcesses[rng.Intn(len(simulatedProcesses))]
+		payload["command_line"] = process + " " + []string{"-h", "--version", "-enc SQBFAFgA", "/c whoami", "-c 'id'"}[rng.Intn(5)]
+	case "FILE_ACCESS", "FILE_MODIFY", "FILE_DELETE":
+		payload["file_path"] = simulatedFiles[rng.Intn(len(simulatedFiles))]
+	case "NETWORK_CONN":
+		payload["src_ip"] = fmt.Sprintf("10.0.%d.%d", rng.Intn(4), 10+rng.Intn(200))
+		payload["dst_ip"] = fmt.Sprintf("%d.%d.%d.%d", 20+rng.Intn(180), rng.Intn(256), rng.Intn(256), 1+rng.Intn(254))
+		payload["dst_port"] = simulatedPorts[rng.Intn(len(simulatedPorts))]
+		payload["protocol"] = "tcp"
+	case "REGISTRY_MODIFY":
+		payload["registry_key"] = `HKCU\Software\Microsoft\Windows\CurrentVersion\Run`
+		payload["registry_value"] = "Updater"
+	case "AUTHENTICATION":
+		payload["logon_type"] = []string{"interactive", "network", "remote_interactive"}[rng.Intn(3)]
+		payload["success"] = rng.Float64() > 0.2
+		payload["source_host"] = host.hostname
+	case "DLP_VIOLATION":
+		payload["file_path"] = simulatedFiles[rng.Intn(len(simulatedFiles))]
+		payload["matched_pattern"] = []string{"credit_card", "us_ssn", "confidential_marking"}[rng.Intn(3)]
+	}
+	return payload
+}
@@ -0,0 +1,609 @@
+// User Behavior Analytics
+// Scores users by risk from their authentication, file and process activity and deception hits
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	uebaDefaultHours = 24
+	uebaMaxHours     = 30 * 24
+	uebaBaselineDays = 14 // History before the window that defines a user's normal behavior
+	uebaDefaultLimit = 50
+	uebaMaxLimit     = 500
+	uebaMaxUsers     = 10000
+	uebaTimeout      = 30 * time.Second
+
+	// Business hours in UTC; activity outside them or at weekends counts as off-hours
+	uebaBusinessHourStart = 7
+	uebaBusinessHourEnd   = 19
+
+	// Without coordinates in the GeoIP data, any change of login country faster than this
+	// is treated as physically impossible
+	uebaTravelWindow = 2 * time.Hour
+
+	uebaMinAuthFailures   = 10
+	uebaMinOffHoursEvents = 5
+	uebaOffHoursNormal    = 0.1 // Users with more off-hours history than this keep irregular hours
+	uebaMinSpikeEvents    = 100
+	uebaSpikeFactor       = 3.0
+	uebaMaxSignalDetails  = 20
+)
+
+// uebaFileEventTypes are the event types counted as file activity
+const uebaFileEventTypes = "('file_access', 'file_modify', 'file_delete')"
+
+// uebaFailedResult matches failed authentication events by their payload result
+const uebaFailedResult = "JSONExtractString(payload, 'result') IN ('failure', 'failed')"
+
+// uebaOffHours matches events outside business hours
+var uebaOffHours = fmt.Sprintf("(toHour(timestamp, 'UTC') < %d OR toHour(timestamp, 'UTC') >= %d OR toDayOfWeek(toDate(timestamp, 'UTC')) >= 6)",
+	uebaBusinessHourStart, uebaBusinessHourEnd)
+
+// UEBAHandler handles user risk scoring
+type UEBAHandler struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+}
+
+// NewUEBAHandler creates a new UEBA handler
+func NewUEBAHandler(db *sql.DB, ch driver.Conn) *UEBAHandler {
+	return &UEBAHandler{db: db, clickhouse: ch}
+}
+
+// uebaWindow is the scoring window and the baseline period before it
+type uebaWindow struct {
+	licenseID     string
+	username      string // Lowercased; empty scores every user
+	baselineStart time.Time
+	start         time.Time
+	end           time.Time
+}
+
+// userActivity is a user's raw counts before scoring
+type userActivity struct {
+	score                 *models.UserRiskScore
+	baselineEvents        int64
+	baselineOffHours      int64
+	baselineFileEvents    int64
+	baselineProcessEvents int64
+}
+
+// loginSegment is a run of successful logins from one country
+type loginSegment struct {
+	country     string
+	first, last time.Time
+}
+
+// ListUserRisk returns users ranked by risk score over the last hours (default 24)
+func (h *UEBAHandler) ListUserRisk(c *gin.Context) {
+	window, ok := h.parseWindow(c, "")
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(uebaDefaultLimit)))
+	if limit <= 0 || limit > uebaMaxLimit {
+		limit = uebaDefaultLimit
+	}
+	minScore, _ := strconv.Atoi(c.DefaultQuery("min_score", "0"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), uebaTimeout)
+	defer cancel()
+
+	users, err := h.scoreUsers(ctx, window)
+	if err != nil {
+		log.Errorf("Failed to score user risk: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score user risk"})
+		return
+	}
+
+	ranked := []models.UserRiskScore{}
+	for _, user := range users {
+		if user.Score < minScore {
+			continue
+		}
+		for i := range user.Signals {
+			user.Signals[i].Details = nil
+		}
+		ranked = append(ranked, *user)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Username < ranked[j].Username
+	})
+	total := len(ranked)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      ranked,
+		"count":      len(ranked),
+		"total":      total,
+		"time_range": models.TimeRange{Start: window.start, End: window.end},
+	})
+}
+
+// GetUserRisk returns one user's risk score with the signals that contributed to it
+func (h *UEBAHandler) GetUserRisk(c *gin.Context) {
+	window, ok := h.parseWindow(c, c.Param("username"))
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), uebaTimeout)
+	defer cancel()
+
+	users, err := h.scoreUsers(ctx, window)
+	if err != nil {
+		log.Errorf("Failed to score user risk: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score user risk"})
+		return
+	}
+
+	user, ok := users[window.username]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No activity found for user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":       user,
+		"time_range": models.TimeRange{Start: window.start, End: window.end},
+	})
+}
+
+// parseWindow validates the common query parameters, answering the request on failure
+func (h *UEBAHandler) parseWindow(c *gin.Context, username string) (uebaWindow, bool) {
+	if h.clickhouse == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return uebaWindow{}, false
+	}
+
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return uebaWindow{}, false
+	}
+
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", strconv.Itoa(uebaDefaultHours)))
+	if hours <= 0 || hours > uebaMaxHours {
+		hours = uebaDefaultHours
+	}
+
+	end := time.Now().UTC()
+	start := end.Add(-time.Duration(hours) * time.Hour)
+	return uebaWindow{
+		licenseID:     licenseID,
+		username:      normalizeUsername(username),
+		baselineStart: start.AddDate(0, 0, -uebaBaselineDays),
+		start:         start,
+		end:           end,
+	}, true
+}
+
+// normalizeUsername folds case so the same account reported differently is scored once
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// scoreUsers collects the window's activity and signals and scores every user, keyed by
+// normalized username
+func (h *UEBAHandler) scoreUsers(ctx context.Context, window uebaWindow) (map[string]*models.UserRiskScore, error) {
+	activity, err := h.loadActivity(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	logins, err := h.loadLogins(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	deception, err := h.loadDeceptionEvents(window)
+	if err != nil {
+		return nil, err
+	}
+
+	users := map[string]*models.UserRiskScore{}
+	user := func(key, username string) *models.UserRiskScore {
+		if existing, ok := users[key]; ok {
+			return existing
+		}
+		score := &models.UserRiskScore{Username: username, Signals: []models.UserRiskSignal{}}
+		users[key] = score
+		return score
+	}
+
+	windowHours := window.end.Sub(window.start).Hours()
+	baselineHours := window.start.Sub(window.baselineStart).Hours()
+	for key, a := range activity {
+		users[key] = a.score
+		if signal, ok := offHoursSignal(a); ok {
+			a.score.Signals = append(a.score.Signals, signal)
+		}
+		if signal, ok := authFailureSignal(a.score.AuthFailures); ok {
+			a.score.Signals = append(a.score.Signals, signal)
+		}
+		if signal, ok := activitySpikeSignal(models.RiskSignalFileActivitySpike, "file", a.score.FileEvents,
+			float64(a.baselineFileEvents)/baselineHours*windowHours, a.baselineEvents); ok {
+			a.score.Signals = append(a.score.Signals, signal)
+		}
+		if signal, ok := activitySpikeSignal(models.RiskSignalProcessActivitySpike, "process", a.score.ProcessEvents,
+			float64(a.baselineProcessEvents)/baselineHours*windowHours, a.baselineEvents); ok {
+			a.score.Signals = append(a.score.Signals, signal)
+		}
+	}
+
+	for key, segments := range logins {
+		if signal, ok := impossibleTravelSignal(segments); ok {
+			u := user(key, key)
+			u.Signals = append(u.Signals, signal)
+		}
+	}
+
+	for key, events := range deception {
+		u := user(key, events[0].SourceUser)
+		u.Signals = append(u.Signals, deceptionSignals(events)...)
+	}
+
+	for _, u := range users {
+		for _, signal := range u.Signals {
+			u.Score += signal.Points
+		}
+		if u.Score > 100 {
+			u.Score = 100
+		}
+		u.Level = riskLevel(u.Score)
+		sort.Slice(u.Signals, func(i, j int) bool { return u.Signals[i].Points > u.Signals[j].Points })
+	}
+
+	return users, nil
+}
+
+// loadActivity aggregates each user's activity in the window and the baseline period before it
+func (h *UEBAHandler) loadActivity(ctx context.Context, window uebaWindow) (map[string]*userActivity, error) {
+	query := `
+		WITH toDateTime64(?, 3) AS window_start
+		SELECT
+			username,
+			countIf(timestamp >= window_start AND event_type = 'authentication') AS auth_events,
+			countIf(timestamp >= window_start AND event_type = 'authentication' AND ` + uebaFailedResult + `) AS auth_failures,
+			countIf(timestamp >= window_start AND event_type IN ` + uebaFileEventTypes + `) AS file_events,
+			countIf(timestamp < window_start AND event_type IN ` + uebaFileEventTypes + `) AS baseline_file_events,
+			countIf(timestamp >= window_start AND event_type = 'process_start') AS process_events,
+			countIf(timestamp < window_start AND event_type = 'process_start') AS baseline_process_events,
+			countIf(timestamp >= window_start AND ` + uebaOffHours + `) AS off_hours_events,
+			countIf(timestamp < window_start AND ` + uebaOffHours + `) AS baseline_off_hours_events,
+			countIf(timestamp < window_start) AS baseline_events,
+			uniqExactIf(hostname, timestamp >= window_start) AS hosts,
+			maxIf(timestamp, timestamp >= window_start) AS last_seen,
+			groupUniqArrayIf(toString(src_country), timestamp >= window_start AND src_country != '') AS countries
+		FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ? AND username != ''
+		  AND event_type IN ('authentication', 'process_start', 'file_access', 'file_modify', 'file_delete')`
+	args := []interface{}{window.start, window.licenseID, window.baselineStart, window.end}
+	if window.username != "" {
+		query += " AND lower(username) = ?"
+		args = append(args, window.username)
+	}
+	query += fmt.Sprintf(`
+		GROUP BY username
+		HAVING countIf(timestamp >= window_start) > 0
+		LIMIT %d`, uebaMaxUsers)
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate user activity: %w", err)
+	}
+	defer rows.Close()
+
+	activity := map[string]*userActivity{}
+	for rows.Next() {
+		var username string
+		var auth, failures, files, baselineFiles, processes, baselineProcesses, offHours, baselineOffHours, baselineEvents, hosts uint64
+		var lastSeen time.Time
+		var countries []string
+		if err := rows.Scan(&username, &auth, &failures, &files, &baselineFiles, &processes, &baselineProcesses,
+			&offHours, &baselineOffHours, &baselineEvents, &hosts, &lastSeen, &countries); err != nil {
+			return nil, fmt.Errorf("failed to scan user activity: %w", err)
+		}
+
+		// Spellings of the same account that differ only in case are merged
+		key := normalizeUsername(username)
+		a, ok := activity[key]
+		if !ok {
+			a = &userActivity{score: &models.UserRiskScore{Username: username, Signals: []models.UserRiskSignal{}}}
+			activity[key] = a
+		}
+		a.score.AuthEvents += int64(auth)
+		a.score.AuthFailures += int64(failures)
+		a.score.FileEvents += int64(files)
+		a.score.ProcessEvents += int64(processes)
+		a.score.OffHoursEvents += int64(offHours)
+		a.score.Hosts += hosts
+		if a.score.LastSeen == nil || lastSeen.After(*a.score.LastSeen) {
+			seen := lastSeen
+			a.score.LastSeen = &seen
+		}
+		for _, country := range countries {
+			if !containsString(a.score.Countries, country) {
+				a.score.Countries = append(a.score.Countries, country)
+			}
+		}
+		a.baselineEvents += int64(baselineEvents)
+		a.baselineOffHours += int64(baselineOffHours)
+		a.baselineFileEvents += int64(baselineFiles)
+		a.baselineProcessEvents += int64(baselineProcesses)
+	}
+	return activity, rows.Err()
+}
+
+// loadLogins returns each user's successful logins with a known source country, as
+// chronological runs per country
+func (h *UEBAHandler) loadLogins(ctx context.Context, window uebaWindow) (map[string][]loginSegment, error) {
+	query := `
+		SELECT username, toString(src_country), min(timestamp) AS first_seen, max(timestamp) AS last_seen
+		FROM telemetry_events
+		WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ?
+		  AND event_type = 'authentication' AND username != '' AND src_country != ''
+		  AND NOT ` + uebaFailedResult
+	args := []interface{}{window.licenseID, window.start, window.end}
+	if window.username != "" {
+		query += " AND lower(username) = ?"
+		args = append(args, window.username)
+	}
+	query += fmt.Sprintf(`
+		GROUP BY username, src_country, toStartOfFifteenMinutes(timestamp)
+		ORDER BY username, first_seen
+		LIMIT %d`, uebaMaxUsers*10)
+
+	rows, err := h.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load logins: %w", err)
+	}
+	defer rows.Close()
+
+	logins := map[string][]loginSegment{}
+	for rows.Next() {
+		var username string
+		var segment loginSegment
+		if err := rows.Scan(&username, &segment.country, &segment.first, &segment.last); err != nil {
+			return nil, fmt.Errorf("failed to scan logins: %w", err)
+		}
+		key := normalizeUsername(username)
+		logins[key] = append(logins[key], segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, segments := range logins {
+		sort.Slice(segments, func(i, j int) bool { return segments[i].first.Before(segments[j].first) })
+	}
+	return logins, nil
+}
+
+// uebaDeceptionEvent is a deception hit attributed to a user
+type uebaDeceptionEvent struct {
+	SourceUser string
+	EventType  string
+	AssetName  string
+	SourceIP   string
+	DetectedAt time.Time
+}
+
+// loadDeceptionEvents returns the window's deception events with a source user, per user
+func (h *UEBAHandler) loadDeceptionEvents(window uebaWindow) (map[string][]uebaDeceptionEvent, error) {
+	query := `
+		SELECT de.source_user, de.event_type, COALESCE(ht.name, hp.name, ''), host(de.source_ip), de.detected_at
+		FROM deception_events de
+		LEFT JOIN honey_tokens ht ON ht.id = de.honey_token_id
+		LEFT JOIN honeypots hp ON hp.id = de.honeypot_id
+		WHERE de.license_id = $1 AND de.detected_at >= $2 AND de.detected_at < $3
+		  AND COALESCE(de.source_user, '') <> ''`
+	args := []interface{}{window.licenseID, window.start, window.end}
+	if window.username != "" {
+		query += " AND LOWER(de.source_user) = $4"
+		args = append(args, window.username)
+	}
+	query += fmt.Sprintf(" ORDER BY de.detected_at LIMIT %d", uebaMaxUsers)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deception events: %w", err)
+	}
+	defer rows.Close()
+
+	events := map[string][]uebaDeceptionEvent{}
+	for rows.Next() {
+		var event uebaDeceptionEvent
+		if err := rows.Scan(&event.SourceUser, &event.EventType, &event.AssetName, &event.SourceIP, &event.DetectedAt); err != nil {
+			continue
+		}
+		key := normalizeUsername(event.SourceUser)
+		events[key] = append(events[key], event)
+	}
+	return events, rows.Err()
+}
+
+// impossibleTravelSignal flags successful logins from different countries closer together
+// than anyone could travel
+func impossibleTravelSignal(segments []loginSegment) (models.UserRiskSignal, bool) {
+	hops := []map[string]interface{}{}
+	var first, last time.Time
+	for i := 1; i < len(segments); i++ {
+		prev, cur := segments[i-1], segments[i]
+		if prev.country == cur.country || cur.first.Sub(prev.last) >= uebaTravelWindow {
+			continue
+		}
+		if len(hops) == 0 {
+			first = prev.last
+		}
+		last = cur.first
+		if len(hops) < uebaMaxSignalDetails {
+			hops = append(hops, map[string]interface{}{
+				"from":       prev.country,
+				"to":         cur.country,
+				"left_at":    prev.last,
+				"arrived_at": cur.first,
+				"minutes":    int(cur.first.Sub(prev.last).Minutes()),
+			})
+		}
+	}
+	if len(hops) == 0 {
+		return models.UserRiskSignal{}, false
+	}
+
+	count := int64(len(hops))
+	return models.UserRiskSignal{
+		Type:        models.RiskSignalImpossibleTravel,
+		Description: fmt.Sprintf("Logged in from %s then %s within %d minutes", hops[0]["from"], hops[0]["to"], hops[0]["minutes"]),
+		Points:      capPoints(40+10*(len(hops)-1), 60),
+		Count:       count,
+		FirstSeen:   &first,
+		LastSeen:    &last,
+		Details:     map[string]interface{}{"hops": hops},
+	}, true
+}
+
+// offHoursSignal flags off-hours activity by a user whose history is mostly in business hours.
+// Users without history are not flagged; their normal hours are unknown.
+func offHoursSignal(a *userActivity) (models.UserRiskSignal, bool) {
+	offHours := a.score.OffHoursEvents
+	if offHours < uebaMinOffHoursEvents || a.baselineEvents == 0 {
+		return models.UserRiskSignal{}, false
+	}
+	normal := float64(a.baselineOffHours) / float64(a.baselineEvents)
+	if normal >= uebaOffHoursNormal {
+		return models.UserRiskSignal{}, false
+	}
+
+	return models.UserRiskSignal{
+		Type:        models.RiskSignalOffHours,
+		Description: fmt.Sprintf("%d events outside business hours; usually %.0f%% of activity", offHours, normal*100),
+		Points:      capPoints(15+int(offHours/20), 30),
+		Count:       offHours,
+		Details: map[string]interface{}{
+			"business_hours_utc": fmt.Sprintf("%02d:00-%02d:00 Mon-Fri", uebaBusinessHourStart, uebaBusinessHourEnd),
+			"baseline_off_hours": a.baselineOffHours,
+			"baseline_events":    a.baselineEvents,
+			"baseline_fraction":  normal,
+		},
+	}, true
+}
+
+// authFailureSignal flags repeated failed logins
+func authFailureSignal(failures int64) (models.UserRiskSignal, bool) {
+	if failures < uebaMinAuthFailures {
+		return models.UserRiskSignal{}, false
+	}
+	return models.UserRiskSignal{
+		Type:        models.RiskSignalAuthFailures,
+		Description: fmt.Sprintf("%d failed logins", failures),
+		Points:      capPoints(10+int(failures/10), 25),
+		Count:       failures,
+	}, true
+}
+
+// activitySpikeSignal flags activity far above the user's rate during the baseline period
+func activitySpikeSignal(signalType, kind string, observed int64, expected float64, baselineEvents int64) (models.UserRiskSignal, bool) {
+	if baselineEvents == 0 || observed < uebaMinSpikeEvents || float64(observed) <= expected*uebaSpikeFactor {
+		return models.UserRiskSignal{}, false
+	}
+	return models.UserRiskSignal{
+		Type:        signalType,
+		Description: fmt.Sprintf("%d %s events, usually ~%.0f", observed, kind, expected),
+		Points:      20,
+		Count:       observed,
+		Details:     map[string]interface{}{"expected": expected},
+	}, true
+}
+
+// deceptionSignals scores a user's honey token use and other decoy interactions
+func deceptionSignals(events []uebaDeceptionEvent) []models.UserRiskSignal {
+	groups := map[string][]uebaDeceptionEvent{}
+	for _, event := range events {
+		signalType := models.RiskSignalDeceptionActivity
+		if event.EventType == string(models.EventTypeHoneyTokenAccess) {
+			signalType = models.RiskSignalHoneyTokenAccess
+		}
+		groups[signalType] = append(groups[signalType], event)
+	}
+
+	signals := []models.UserRiskSignal{}
+	for signalType, group := range groups {
+		first, last := group[0].DetectedAt, group[len(group)-1].DetectedAt
+		assets := []string{}
+		hits := []map[string]interface{}{}
+		for _, event := range group {
+			if event.AssetName != "" && !containsString(assets, event.AssetName) {
+				assets = append(assets, event.AssetName)
+			}
+			if len(hits) < uebaMaxSignalDetails {
+				hits = append(hits, map[string]interface{}{
+					"event_type":  event.EventType,
+					"asset":       event.AssetName,
+					"source_ip":   event.SourceIP,
+					"detected_at": event.DetectedAt,
+				})
+			}
+		}
+
+		signal := models.UserRiskSignal{
+			Type:      signalType,
+			Count:     int64(len(group)),
+			FirstSeen: &first,
+			LastSeen:  &last,
+			Details:   map[string]interface{}{"assets": assets, "events": hits},
+		}
+		if signalType == models.RiskSignalHoneyTokenAccess {
+			// Nobody has a legitimate reason to use a honey token
+			signal.Description = fmt.Sprintf("Used %d honey token(s): %s", len(assets), strings.Join(assets, ", "))
+			signal.Points = capPoints(60+10*(len(group)-1), 80)
+		} else {
+			signal.Description = fmt.Sprintf("%d interactions with deception assets", len(group))
+			signal.Points = capPoints(30+5*(len(group)-1), 45)
+		}
+		signals = append(signals, signal)
+	}
+	return signals
+}
+
+// capPoints bounds a signal's contribution to the score
+func capPoints(points, limit int) int {
+	if points > limit {
+		return limit
+	}
+	return points
+}
+
+// riskLevel maps a 0-100 risk score to a level, on the same scale as deception scores
+func riskLevel(score int) string {
+	switch {
+	case score >= 85:
+		return "critical"
+	case score >= 60:
+		return "high"
+	case score >= 35:
+		return "medium"
+	default:
+		return "low"
+	}
+}
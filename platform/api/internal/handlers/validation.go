@@ -0,0 +1,128 @@
+// Request Validation Errors
+// Reports every invalid field of a request body at once instead of only the first
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// mitreTechniquePattern matches ATT&CK technique and sub-technique IDs such as T1059 and T1059.001
+var mitreTechniquePattern = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+func init() {
+	// Name fields by their JSON key so errors match what clients sent
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("mitre_technique", func(fl validator.FieldLevel) bool {
+			return mitreTechniquePattern.MatchString(fl.Field().String())
+		})
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// bindingErrorResponse builds the 400 body for a failed ShouldBindJSON. Validation failures
+// list every invalid field under "fields"; malformed JSON keeps the plain error message.
+func bindingErrorResponse(err error) gin.H {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make(map[string]string, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields[validationFieldPath(fe)] = validationMessage(fe)
+		}
+		return gin.H{"error": "Validation failed", "fields": fields}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return gin.H{
+			"error":  "Validation failed",
+			"fields": map[string]string{typeErr.Field: "must be " + jsonTypeName(typeErr.Type)},
+		}
+	}
+
+	return gin.H{"error": err.Error()}
+}
+
+// validationFieldPath drops the request struct name from the namespace: "retention_policy.hot_storage_days"
+func validationFieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	lengthUnit := ""
+	switch fe.Kind() {
+	case reflect.String:
+		lengthUnit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		lengthUnit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), lengthUnit)
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), lengthUnit)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s%s", fe.Param(), lengthUnit)
+	case "lt":
+		return fmt.Sprintf("must be less than %s%s", fe.Param(), lengthUnit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), lengthUnit)
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "url":
+		return "must be a valid URL"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "hexadecimal":
+		return "must be hexadecimal"
+	case "mitre_technique":
+		return "must be an ATT&CK technique ID such as T1059 or T1059.001"
+	}
+	return fmt.Sprintf("failed %s validation", fe.Tag())
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,580 @@
+// Watchlist Engine
+// Matches newly ingested telemetry against active watchlists and raises alerts on hits
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// watchlistMaxEventsPerRun bounds the events matched per license per run; the rest are
+	// picked up by the next run
+	watchlistMaxEventsPerRun = 10000
+
+	// watchlistMaxWindow bounds how far back a license that has not been evaluated is searched
+	watchlistMaxWindow = 24 * time.Hour
+
+	// watchlistSyncInterval is how often auto-synced community watchlists re-import the feed
+	watchlistSyncInterval = time.Hour
+
+	// watchlistAlertEventIDs bounds the event IDs listed in an alert's details
+	watchlistAlertEventIDs = 20
+
+	watchlistAlertRuleName = "Watchlist match"
+)
+
+// errWatchlistUnavailable is returned when watchlists are evaluated without ClickHouse
+var errWatchlistUnavailable = errors.New("ClickHouse connection not available")
+
+// watchlistColumns maps entry types to the telemetry expressions they are matched against
+var watchlistColumns = map[string][]string{
+	models.WatchlistEntryIP:          {"dst_ip", "JSONExtractString(payload, 'src_ip')"},
+	models.WatchlistEntryDomain:      {"dst_hostname", "JSONExtractString(payload, 'domain')"},
+	models.WatchlistEntryHash:        {"JSONExtractString(payload, 'hash')"},
+	models.WatchlistEntryUsername:    {"username"},
+	models.WatchlistEntryFilePath:    {"file_path"},
+	models.WatchlistEntryProcessName: {"process_name"},
+	models.WatchlistEntryHostname:    {"hostname"},
+}
+
+// watchlistSuppressionEntities maps entry types to the alert suppression entity types they match
+var watchlistSuppressionEntities = map[string][]string{
+	models.WatchlistEntryIP:          {"dst_ip", "source_ip"},
+	models.WatchlistEntryHash:        {"hash"},
+	models.WatchlistEntryUsername:    {"username"},
+	models.WatchlistEntryFilePath:    {"file_path"},
+	models.WatchlistEntryProcessName: {"process_name"},
+	models.WatchlistEntryHostname:    {"hostname"},
+}
+
+// communityIOCEntryTypes maps community IOC types to watchlist entry types
+var communityIOCEntryTypes = map[string]string{
+	"ip":        models.WatchlistEntryIP,
+	"domain":    models.WatchlistEntryDomain,
+	"hash":      models.WatchlistEntryHash,
+	"email":     models.WatchlistEntryUsername,
+	"file_path": models.WatchlistEntryFilePath,
+}
+
+// WatchlistEngine periodically matches new events against every enabled watchlist
+type WatchlistEngine struct {
+	db         *sql.DB
+	clickhouse driver.Conn
+	notifier   *NotificationHandler
+	notify     bool
+}
+
+type watchedEntry struct {
+	id          string
+	watchlistID string
+	listName    string
+	severity    string
+	entryType   string
+	value       string
+}
+
+type watchlistMatch struct {
+	entry    watchedEntry
+	eventIDs []string
+	hosts    []string
+	agentID  string
+}
+
+// NewWatchlistEngine creates a watchlist engine. notify sends hits to the license's
+// notification channels in addition to raising alerts.
+func NewWatchlistEngine(db *sql.DB, ch driver.Conn, notify bool) *WatchlistEngine {
+	return &WatchlistEngine{db: db, clickhouse: ch, notifier: NewNotificationHandler(db), notify: notify}
+}
+
+// StartWatchlistEngine runs the watchlist engine periodically in the background
+func StartWatchlistEngine(db *sql.DB, ch driver.Conn, notify bool, interval time.Duration) *WatchlistEngine {
+	engine := NewWatchlistEngine(db, ch, notify)
+	if ch == nil {
+		log.Warn("ClickHouse not available, watchlist matching disabled")
+		return engine
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := engine.Run()
+			if err != nil {
+				log.Errorf("Watchlist matching failed: %v", err)
+				continue
+			}
+			if result.AlertsRaised > 0 {
+				log.Infof("Watchlists matched %d events and raised %d alerts", result.EventsMatched, result.AlertsRaised)
+			}
+		}
+	}()
+
+	log.Infof("Watchlist engine started (interval: %v)", interval)
+	return engine
+}
+
+// Run re-syncs due community watchlists, then matches events ingested since each license was
+// last evaluated. Hits are recorded once per entry and event, so overlapping runs are safe.
+func (e *WatchlistEngine) Run() (models.WatchlistRunResult, error) {
+	result := models.WatchlistRunResult{StartedAt: time.Now()}
+	if e.clickhouse == nil {
+		return result, errWatchlistUnavailable
+	}
+
+	imported, err := e.syncDueFeeds()
+	if err != nil {
+		log.Warnf("Failed to sync community watchlists: %v", err)
+	}
+	result.IOCsImported = imported
+
+	entries, watermarks, err := e.activeEntries()
+	if err != nil {
+		return result, err
+	}
+
+	ctx := context.Background()
+	for licenseID, licenseEntries := range entries {
+		until, matches, lists, err := e.match(ctx, licenseID, licenseEntries, watermarks[licenseID])
+		if err != nil {
+			log.Errorf("Failed to match watchlists for license %s: %v", licenseID, err)
+			continue
+		}
+		result.WatchlistsEvaluated += len(lists)
+
+		for _, match := range matches {
+			result.EventsMatched += len(match.eventIDs)
+			raised, err := e.raise(licenseID, match)
+			if err != nil {
+				log.Errorf("Failed to raise watchlist alert: %v", err)
+				continue
+			}
+			if raised {
+				result.AlertsRaised++
+			} else {
+				result.AlertsSuppressed++
+			}
+		}
+
+		if _, err := e.db.Exec(
+			"UPDATE watchlists SET last_evaluated_at = $1 WHERE id = ANY($2)",
+			until, pq.Array(lists),
+		); err != nil {
+			log.Warnf("Failed to advance watchlist watermark for license %s: %v", licenseID, err)
+		}
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result, nil
+}
+
+// activeEntries loads the entries of enabled watchlists by license, with the earliest time each
+// license was last evaluated
+func (e *WatchlistEngine) activeEntries() (map[string][]watchedEntry, map[string]time.Time, error) {
+	rows, err := e.db.Query(`
+		SELECT w.license_id, w.id, w.name, w.severity, w.last_evaluated_at, en.id, en.entry_type, en.value
+		FROM watchlists w
+		JOIN watchlist_entries en ON en.watchlist_id = w.id
+		WHERE w.enabled = TRUE
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	entries := map[string][]watchedEntry{}
+	watermarks := map[string]time.Time{}
+	floor := time.Now().UTC().Add(-watchlistMaxWindow)
+	for rows.Next() {
+		var licenseID string
+		var lastEvaluated sql.NullTime
+		var entry watchedEntry
+		if err := rows.Scan(&licenseID, &entry.watchlistID, &entry.listName, &entry.severity, &lastEvaluated,
+			&entry.id, &entry.entryType, &entry.value); err != nil {
+			return nil, nil, err
+		}
+		entries[licenseID] = append(entries[licenseID], entry)
+
+		// Newly created watchlists start with the last window rather than all history
+		since := time.Now().UTC().Add(-time.Hour)
+		if lastEvaluated.Valid {
+			since = lastEvaluated.Time
+		}
+		if since.Before(floor) {
+			since = floor
+		}
+		if current, ok := watermarks[licenseID]; !ok || since.Before(current) {
+			watermarks[licenseID] = since
+		}
+	}
+	return entries, watermarks, rows.Err()
+}
+
+// match finds events ingested since the watermark that touch a watched value, records the hits
+// and returns the new ones grouped by entry, the time evaluated up to and the watchlists
+// evaluated. Events ingested at the watermark itself are read again, since a run cut short by
+// watchlistMaxEventsPerRun may have stopped partway through them; recordHit skips those that
+// already matched.
+func (e *WatchlistEngine) match(ctx context.Context, licenseID string, entries []watchedEntry, since time.Time) (time.Time, []*watchlistMatch, []string, error) {
+	until := time.Now().UTC()
+
+	byValue := map[string]map[string][]watchedEntry{} // entry type -> lower(value) -> entries
+	listSet := map[string]bool{}
+	for _, entry := range entries {
+		listSet[entry.watchlistID] = true
+		if byValue[entry.entryType] == nil {
+			byValue[entry.entryType] = map[string][]watchedEntry{}
+		}
+		key := strings.ToLower(entry.value)
+		byValue[entry.entryType][key] = append(byValue[entry.entryType][key], entry)
+	}
+	lists := make([]string, 0, len(listSet))
+	for id := range listSet {
+		lists = append(lists, id)
+	}
+
+	// Every watched expression is selected so the matching entry can be identified in Go
+	entryTypes := make([]string, 0, len(byValue))
+	for entryType := range byValue {
+		entryTypes = append(entryTypes, entryType)
+	}
+	sort.Strings(entryTypes)
+
+	type selected struct {
+		entryType string
+	}
+	var columns, conditions []string
+	var selections []selected
+	args := []interface{}{licenseID, since, until}
+	for _, entryType := range entryTypes {
+		values := make([]string, 0, len(byValue[entryType]))
+		for value := range byValue[entryType] {
+			values = append(values, value)
+		}
+		// One newline-joined parameter instead of a placeholder per value keeps large
+		// community lists cheap to bind; entry values cannot contain newlines
+		for _, expr := range watchlistColumns[entryType] {
+			columns = append(columns, "lower("+expr+")")
+			conditions = append(conditions, "has(splitByChar('\\n', ?), lower("+expr+"))")
+			args = append(args, strings.Join(values, "\n"))
+			selections = append(selections, selected{entryType: entryType})
+		}
+	}
+	if len(conditions) == 0 {
+		return until, nil, lists, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT toString(event_id), agent_id, hostname, toString(event_type), timestamp, server_timestamp, %s
+		FROM telemetry_events
+		WHERE tenant_id = ? AND server_timestamp >= ? AND server_timestamp <= ?
+		  AND (%s)
+		ORDER BY server_timestamp ASC, event_id ASC
+		LIMIT %d
+	`, strings.Join(columns, ", "), strings.Join(conditions, " OR "), watchlistMaxEventsPerRun)
+
+	rows, err := e.clickhouse.Query(ctx, query, args...)
+	if err != nil {
+		return since, nil, nil, err
+	}
+	defer rows.Close()
+
+	matches := map[string]*watchlistMatch{}
+	order := []string{}
+	scanned := 0
+	for rows.Next() {
+		var eventID, agentID, hostname, eventType string
+		var timestamp, ingested time.Time
+		values := make([]string, len(selections))
+		dest := []interface{}{&eventID, &agentID, &hostname, &eventType, &timestamp, &ingested}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return since, nil, nil, err
+		}
+		scanned++
+		if scanned == watchlistMaxEventsPerRun {
+			until = ingested
+		}
+
+		seen := map[string]bool{}
+		for i, value := range values {
+			if value == "" {
+				continue
+			}
+			for _, entry := range byValue[selections[i].entryType][value] {
+				if seen[entry.id] {
+					continue
+				}
+				seen[entry.id] = true
+
+				newHit, err := e.recordHit(licenseID, entry, eventID, agentID, hostname, eventType, timestamp)
+				if err != nil {
+					return since, nil, nil, err
+				}
+				if !newHit {
+					continue
+				}
+				match, ok := matches[entry.id]
+				if !ok {
+					match = &watchlistMatch{entry: entry, agentID: agentID}
+					matches[entry.id] = match
+					order = append(order, entry.id)
+				}
+				match.eventIDs = append(match.eventIDs, eventID)
+				if !containsString(match.hosts, hostname) {
+					match.hosts = append(match.hosts, hostname)
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return since, nil, nil, err
+	}
+	if scanned == watchlistMaxEventsPerRun && !until.After(since) {
+		// A full run within one millisecond would be read again forever
+		log.Warnf("Over %d watchlist matches for license %s ingested at %s; the rest of them are not evaluated",
+			watchlistMaxEventsPerRun, licenseID, since.Format(time.RFC3339Nano))
+		until = since.Add(time.Millisecond)
+	}
+
+	result := make([]*watchlistMatch, 0, len(order))
+	for _, id := range order {
+		result = append(result, matches[id])
+	}
+	return until, result, lists, nil
+}
+
+// recordHit stores a hit, reporting false when the entry already matched this event
+func (e *WatchlistEngine) recordHit(licenseID string, entry watchedEntry, eventID, agentID, hostname, eventType string, timestamp time.Time) (bool, error) {
+	result, err := e.db.Exec(`
+		INSERT INTO watchlist_hits (watchlist_id, entry_id, license_id, event_id, agent_id, hostname, event_type, event_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (entry_id, event_id) DO NOTHING
+	`, entry.watchlistID, entry.id, licenseID, eventID, agentID, hostname, eventType, timestamp)
+	if err != nil {
+		return false, err
+	}
+	inserted, _ := result.RowsAffected()
+	return inserted > 0, nil
+}
+
+// raise turns the new hits of one entry into an alert, unless a suppression silences it.
+// It reports whether an alert was raised.
+func (e *WatchlistEngine) raise(licenseID string, match *watchlistMatch) (bool, error) {
+	entry := match.entry
+	if _, err := e.db.Exec(
+		"UPDATE watchlist_entries SET hit_count = hit_count + $1 WHERE id = $2",
+		len(match.eventIDs), entry.id,
+	); err != nil {
+		log.Warnf("Failed to update watchlist entry hit count: %v", err)
+	}
+
+	ruleID, err := e.alertRule(licenseID)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve watchlist alert rule: %w", err)
+	}
+
+	entities := map[string]string{"agent_id": match.agentID}
+	if len(match.hosts) == 1 {
+		entities["hostname"] = match.hosts[0]
+	}
+	for _, entityType := range watchlistSuppressionEntities[entry.entryType] {
+		entities[entityType] = entry.value
+	}
+	if suppressionID, suppressed := suppressAlert(e.db, ruleID, entities); suppressed {
+		log.Infof("Watchlist alert for %s %s suppressed by %s", entry.entryType, entry.value, suppressionID)
+		return false, nil
+	}
+
+	message := fmt.Sprintf("Watchlist %q matched %s %s in %d event(s) on %s",
+		entry.listName, entry.entryType, entry.value, len(match.eventIDs), strings.Join(match.hosts, ", "))
+	eventIDs := match.eventIDs
+	if len(eventIDs) > watchlistAlertEventIDs {
+		eventIDs = eventIDs[:watchlistAlertEventIDs]
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"source":       "watchlist",
+		"watchlist_id": entry.watchlistID,
+		"entry_id":     entry.id,
+		"entry_type":   entry.entryType,
+		"value":        entry.value,
+		"event_count":  len(match.eventIDs),
+		"event_ids":    eventIDs,
+		"hosts":        match.hosts,
+	})
+
+	entityType := entry.entryType
+	if types := watchlistSuppressionEntities[entry.entryType]; len(types) > 0 {
+		entityType = types[0]
+	}
+	alertID, createdAt, err := raiseAlert(e.db, newAlert{
+		ruleID:      ruleID,
+		severity:    entry.severity,
+		message:     message,
+		entityType:  entityType,
+		entityValue: entry.value,
+		eventIDs:    eventIDs,
+		details:     details,
+		source:      "watchlist-engine",
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := e.db.Exec(
+		"UPDATE watchlist_hits SET alert_id = $1 WHERE entry_id = $2 AND event_id = ANY($3)",
+		alertID, entry.id, pq.Array(match.eventIDs),
+	); err != nil {
+		log.Warnf("Failed to link watchlist hits to alert %s: %v", alertID, err)
+	}
+
+	notification := models.WSAlertNotification{
+		AlertID:    alertID,
+		RuleName:   watchlistAlertRuleName,
+		Severity:   entry.severity,
+		Message:    message,
+		EventCount: len(match.eventIDs),
+		Hostname:   match.hosts[0],
+		CreatedAt:  createdAt,
+	}
+	if len(match.hosts) == 1 {
+		notification.AgentID = match.agentID
+	}
+	BroadcastAlert(licenseID, notification)
+
+	if e.notify {
+		e.notifier.NotifyLicense(licenseID, "Privé watchlist hit: "+entry.listName, message, entry.severity, map[string]interface{}{
+			"alert_id":     alertID,
+			"watchlist_id": entry.watchlistID,
+			"source":       "watchlist",
+		})
+	}
+
+	fired := firedAlert{id: alertID, ruleID: ruleID, licenseID: licenseID, severity: entry.severity, message: message}
+	if len(match.hosts) == 1 {
+		fired.agentID = match.agentID
+		fired.hostname = match.hosts[0]
+	}
+	NewAlertActionExecutor(e.db).Execute(fired)
+	return true, nil
+}
+
+// alertRule returns the license's built-in watchlist alert rule, creating it on first use
+func (e *WatchlistEngine) alertRule(licenseID string) (string, error) {
+	var ruleID string
+	err := e.db.QueryRow(`
+		SELECT id FROM alert_rules
+		WHERE license_id = $1 AND condition->>'source' = 'watchlist'
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, licenseID).Scan(&ruleID)
+	if err == nil {
+		return ruleID, nil
+	}
+
+	err = e.db.QueryRow(`
+		INSERT INTO alert_rules (license_id, name, description, severity, enabled, condition)
+		VALUES ($1, $2, 'Raised automatically when telemetry touches a watchlist value', 'high', TRUE, '{"source": "watchlist"}')
+		RETURNING id
+	`, licenseID, watchlistAlertRuleName).Scan(&ruleID)
+	return ruleID, err
+}
+
+// syncDueFeeds re-imports the community feed into auto-synced watchlists not synced recently
+func (e *WatchlistEngine) syncDueFeeds() (int, error) {
+	rows, err := e.db.Query(`
+		SELECT id, community_feed FROM watchlists
+		WHERE community_feed IS NOT NULL
+		  AND (community_feed->>'auto_sync')::boolean IS TRUE
+		  AND (last_synced_at IS NULL OR last_synced_at < NOW() - ($1 * INTERVAL '1 second'))
+	`, int(watchlistSyncInterval.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	type due struct {
+		id     string
+		filter models.CommunityFeedFilter
+	}
+	var lists []due
+	for rows.Next() {
+		var d due
+		var filter []byte
+		if err := rows.Scan(&d.id, &filter); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(filter, &d.filter); err != nil {
+			log.Warnf("Invalid community feed filter on watchlist %s: %v", d.id, err)
+			continue
+		}
+		lists = append(lists, d)
+	}
+	rows.Close()
+
+	imported := 0
+	for _, list := range lists {
+		n, err := importCommunityIOCs(e.db, list.id, list.filter)
+		if err != nil {
+			return imported, err
+		}
+		imported += n
+	}
+	return imported, nil
+}
+
+// importCommunityIOCs copies community shared IOCs matching the filter into a watchlist and
+// returns how many entries were added. IOC types without a telemetry mapping are skipped.
+func importCommunityIOCs(db *sql.DB, watchlistID string, filter models.CommunityFeedFilter) (int, error) {
+	iocTypes := filter.IOCTypes
+	if len(iocTypes) == 0 {
+		for iocType := range communityIOCEntryTypes {
+			iocTypes = append(iocTypes, iocType)
+		}
+	}
+	threatTypes := filter.ThreatTypes
+	if threatTypes == nil {
+		threatTypes = []string{}
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO watchlist_entries (watchlist_id, entry_type, value, comment, ioc_id)
+		SELECT $1,
+		       CASE ioc_type WHEN 'email' THEN 'username' ELSE ioc_type END,
+		       value,
+		       NULLIF(concat_ws(' / ', threat_type, malware_family), ''),
+		       id
+		FROM shared_iocs
+		WHERE ioc_type = ANY($2)
+		  AND ioc_type IN ('ip', 'domain', 'hash', 'email', 'file_path')
+		  AND (cardinality($3::text[]) = 0 OR threat_type = ANY($3))
+		  AND COALESCE(confidence, 0) >= $4
+		  AND ($5 = FALSE OR is_verified)
+		  AND position(E'\n' IN value) = 0
+		ON CONFLICT (watchlist_id, entry_type, value) DO NOTHING
+	`, watchlistID, pq.Array(iocTypes), pq.Array(threatTypes), filter.MinConfidence, filter.VerifiedOnly)
+	if err != nil {
+		return 0, err
+	}
+	imported, _ := result.RowsAffected()
+
+	if _, err := db.Exec("UPDATE watchlists SET last_synced_at = NOW(), updated_at = NOW() WHERE id = $1", watchlistID); err != nil {
+		log.Warnf("Failed to record watchlist sync time: %v", err)
+	}
+	return int(imported), nil
+}
@@ -0,0 +1,554 @@
+// Watchlists
+// IOC and entity watchlists, their entries and hits, and community feed imports
+
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const watchlistSelect = `SELECT w.id, w.license_id, w.name, COALESCE(w.description, ''), w.severity, w.enabled,
+	w.community_feed, w.last_synced_at, w.last_evaluated_at, COALESCE(w.created_by, ''), w.created_at, w.updated_at,
+	(SELECT COUNT(*) FROM watchlist_entries en WHERE en.watchlist_id = w.id),
+	(SELECT COALESCE(SUM(en.hit_count), 0) FROM watchlist_entries en WHERE en.watchlist_id = w.id)
+	FROM watchlists w`
+
+// WatchlistHandler handles watchlists
+type WatchlistHandler struct {
+	db     *sql.DB
+	engine *WatchlistEngine
+}
+
+// NewWatchlistHandler creates a new watchlist handler
+func NewWatchlistHandler(db *sql.DB, engine *WatchlistEngine) *WatchlistHandler {
+	if engine == nil {
+		engine = NewWatchlistEngine(db, nil, false)
+	}
+	return &WatchlistHandler{db: db, engine: engine}
+}
+
+// ListWatchlists lists the watchlists of a license
+func (h *WatchlistHandler) ListWatchlists(c *gin.Context) {
+	licenseID := c.Query("license_id")
+	if licenseID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_id required"})
+		return
+	}
+
+	rows, err := h.db.Query(watchlistSelect+" WHERE w.license_id = $1 ORDER BY w.name", licenseID)
+	if err != nil {
+		log.Errorf("Failed to list watchlists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list watchlists"})
+		return
+	}
+	defer rows.Close()
+
+	watchlists := []models.Watchlist{}
+	for rows.Next() {
+		w, err := scanWatchlist(rows)
+		if err != nil {
+			log.Errorf("Failed to scan watchlist: %v", err)
+			continue
+		}
+		watchlists = append(watchlists, w)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": watchlists, "count": len(watchlists)})
+}
+
+// CreateWatchlist creates a watchlist, optionally with its initial entries
+func (h *WatchlistHandler) CreateWatchlist(c *gin.Context) {
+	var req models.CreateWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = "high"
+	}
+	if !containsString(watchlistSeverities, req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, medium, high or critical"})
+		return
+	}
+	entries, err := normalizeWatchlistEntries(req.Entries)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "entry_types": models.WatchlistEntryTypes})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watchlist"})
+		return
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO watchlists (license_id, name, description, severity, created_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''))
+		RETURNING id
+	`, req.LicenseID, req.Name, req.Description, req.Severity, req.CreatedBy).Scan(&id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "A watchlist with this name already exists"})
+			return
+		}
+		log.Errorf("Failed to create watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watchlist"})
+		return
+	}
+
+	if _, err := insertWatchlistEntries(tx, id, entries); err != nil {
+		log.Errorf("Failed to add watchlist entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watchlist"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watchlist"})
+		return
+	}
+
+	watchlist, err := h.load(c, id)
+	if err != nil {
+		log.Errorf("Failed to load watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load watchlist"})
+		return
+	}
+
+	log.Infof("Watchlist %s created for license %s with %d entries", req.Name, req.LicenseID, watchlist.EntryCount)
+	c.JSON(http.StatusCreated, watchlist)
+}
+
+// GetWatchlist returns a watchlist
+func (h *WatchlistHandler) GetWatchlist(c *gin.Context) {
+	watchlist, err := h.load(c, c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load watchlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, watchlist)
+}
+
+// UpdateWatchlist updates a watchlist's name, description, severity or enabled state
+func (h *WatchlistHandler) UpdateWatchlist(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	if req.Severity != nil && !containsString(watchlistSeverities, *req.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, medium, high or critical"})
+		return
+	}
+
+	updates := []string{}
+	args := []interface{}{}
+	argCount := 1
+
+	if req.Name != nil {
+		updates = append(updates, fmt.Sprintf("name = $%d", argCount))
+		args = append(args, *req.Name)
+		argCount++
+	}
+	if req.Description != nil {
+		updates = append(updates, fmt.Sprintf("description = $%d", argCount))
+		args = append(args, *req.Description)
+		argCount++
+	}
+	if req.Severity != nil {
+		updates = append(updates, fmt.Sprintf("severity = $%d", argCount))
+		args = append(args, *req.Severity)
+		argCount++
+	}
+	if req.Enabled != nil {
+		updates = append(updates, fmt.Sprintf("enabled = $%d", argCount))
+		args = append(args, *req.Enabled)
+		argCount++
+		// Re-enabled lists resume from now rather than alerting on everything missed
+		if *req.Enabled {
+			updates = append(updates, "last_evaluated_at = NOW()")
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+	updates = append(updates, "updated_at = NOW()")
+
+	query := fmt.Sprintf("UPDATE watchlists SET %s WHERE id = $%d AND ($%d = '' OR license_id::text = $%d)",
+		strings.Join(updates, ", "), argCount, argCount+1, argCount+1)
+	args = append(args, id, principalLicense(c))
+
+	result, err := h.db.Exec(query, args...)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "A watchlist with this name already exists"})
+			return
+		}
+		log.Errorf("Failed to update watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update watchlist"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watchlist updated successfully"})
+}
+
+// DeleteWatchlist deletes a watchlist with its entries and hits. Alerts it raised are kept.
+func (h *WatchlistHandler) DeleteWatchlist(c *gin.Context) {
+	result, err := h.db.Exec(
+		"DELETE FROM watchlists WHERE id = $1 AND ($2 = '' OR license_id::text = $2)",
+		c.Param("id"), principalLicense(c),
+	)
+	if err != nil {
+		log.Errorf("Failed to delete watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete watchlist"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watchlist deleted successfully"})
+}
+
+// ListWatchlistEntries lists a watchlist's entries, optionally filtered by entry_type
+func (h *WatchlistHandler) ListWatchlistEntries(c *gin.Context) {
+	id := c.Param("id")
+	if !h.exists(c, id) {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if limit < 1 || limit > 10000 {
+		limit = 1000
+	}
+
+	query := `
+		SELECT id, watchlist_id, entry_type, value, COALESCE(comment, ''), COALESCE(ioc_id::text, ''), hit_count, created_at
+		FROM watchlist_entries
+		WHERE watchlist_id = $1`
+	args := []interface{}{id}
+	if entryType := c.Query("entry_type"); entryType != "" {
+		query += " AND entry_type = $2"
+		args = append(args, entryType)
+	}
+	query += fmt.Sprintf(" ORDER BY hit_count DESC, created_at DESC LIMIT %d", limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Failed to list watchlist entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list watchlist entries"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.WatchlistEntry{}
+	for rows.Next() {
+		var e models.WatchlistEntry
+		if err := rows.Scan(&e.ID, &e.WatchlistID, &e.EntryType, &e.Value, &e.Comment, &e.IOCID, &e.HitCount, &e.CreatedAt); err != nil {
+			log.Errorf("Failed to scan watchlist entry: %v", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": entries, "count": len(entries)})
+}
+
+// AddWatchlistEntries adds entries to a watchlist. Values already on the list are skipped.
+func (h *WatchlistHandler) AddWatchlistEntries(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.AddWatchlistEntriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+		return
+	}
+	entries, err := normalizeWatchlistEntries(req.Entries)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "entry_types": models.WatchlistEntryTypes})
+		return
+	}
+	if !h.exists(c, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		log.Errorf("Failed to begin transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add watchlist entries"})
+		return
+	}
+	defer tx.Rollback()
+
+	added, err := insertWatchlistEntries(tx, id, entries)
+	if err != nil {
+		log.Errorf("Failed to add watchlist entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add watchlist entries"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE watchlists SET updated_at = NOW() WHERE id = $1", id); err != nil {
+		log.Errorf("Failed to update watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add watchlist entries"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Failed to commit watchlist entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add watchlist entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Watchlist entries added successfully",
+		"added":   added,
+		"skipped": len(entries) - added,
+	})
+}
+
+// DeleteWatchlistEntry removes an entry from a watchlist
+func (h *WatchlistHandler) DeleteWatchlistEntry(c *gin.Context) {
+	result, err := h.db.Exec(`
+		DELETE FROM watchlist_entries
+		WHERE id = $1 AND watchlist_id IN (
+			SELECT id FROM watchlists WHERE id = $2 AND ($3 = '' OR license_id::text = $3)
+		)
+	`, c.Param("entry_id"), c.Param("id"), principalLicense(c))
+	if err != nil {
+		log.Errorf("Failed to delete watchlist entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete watchlist entry"})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watchlist entry deleted successfully"})
+}
+
+// ImportCommunityIOCs imports community shared IOCs into a watchlist. With auto_sync set, the
+// filter is kept and newly shared IOCs are imported periodically.
+func (h *WatchlistHandler) ImportCommunityIOCs(c *gin.Context) {
+	id := c.Param("id")
+
+	var filter models.CommunityFeedFilter
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, bindingErrorResponse(err))
+			return
+		}
+	}
+	supported := make([]string, 0, len(communityIOCEntryTypes))
+	for iocType := range communityIOCEntryTypes {
+		supported = append(supported, iocType)
+	}
+	for _, iocType := range filter.IOCTypes {
+		if _, ok := communityIOCEntryTypes[iocType]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ioc_type %s cannot be matched against telemetry", iocType), "ioc_types": supported})
+			return
+		}
+	}
+	if filter.MinConfidence < 0 || filter.MinConfidence > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_confidence must be between 0 and 1"})
+		return
+	}
+	if !h.exists(c, id) {
+		return
+	}
+
+	feed, _ := json.Marshal(filter)
+	if _, err := h.db.Exec("UPDATE watchlists SET community_feed = $1 WHERE id = $2", feed, id); err != nil {
+		log.Errorf("Failed to save community feed filter: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import community IOCs"})
+		return
+	}
+
+	imported, err := importCommunityIOCs(h.db, id, filter)
+	if err != nil {
+		log.Errorf("Failed to import community IOCs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import community IOCs"})
+		return
+	}
+
+	log.Infof("Imported %d community IOCs into watchlist %s", imported, id)
+	c.JSON(http.StatusOK, gin.H{"message": "Community IOCs imported successfully", "imported": imported})
+}
+
+// ListWatchlistHits lists the events that matched a watchlist, most recent first
+func (h *WatchlistHandler) ListWatchlistHits(c *gin.Context) {
+	id := c.Param("id")
+	if !h.exists(c, id) {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	rows, err := h.db.Query(`
+		SELECT hit.id, hit.watchlist_id, hit.entry_id, en.entry_type, en.value, hit.event_id,
+		       COALESCE(hit.agent_id, ''), COALESCE(hit.hostname, ''), COALESCE(hit.event_type, ''),
+		       hit.event_timestamp, COALESCE(hit.alert_id::text, ''), hit.created_at
+		FROM watchlist_hits hit
+		JOIN watchlist_entries en ON en.id = hit.entry_id
+		WHERE hit.watchlist_id = $1
+		ORDER BY hit.created_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		log.Errorf("Failed to list watchlist hits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list watchlist hits"})
+		return
+	}
+	defer rows.Close()
+
+	hits := []models.WatchlistHit{}
+	for rows.Next() {
+		var hit models.WatchlistHit
+		if err := rows.Scan(&hit.ID, &hit.WatchlistID, &hit.EntryID, &hit.EntryType, &hit.Value, &hit.EventID,
+			&hit.AgentID, &hit.Hostname, &hit.EventType, &hit.EventTimestamp, &hit.AlertID, &hit.CreatedAt); err != nil {
+			log.Errorf("Failed to scan watchlist hit: %v", err)
+			continue
+		}
+		hits = append(hits, hit)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": hits, "count": len(hits)})
+}
+
+// RunWatchlists triggers an immediate watchlist evaluation
+func (h *WatchlistHandler) RunWatchlists(c *gin.Context) {
+	result, err := h.engine.Run()
+	if err == errWatchlistUnavailable {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "ClickHouse connection not available"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to run watchlists: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run watchlists"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// load fetches a watchlist by ID, confined to the caller's license
+func (h *WatchlistHandler) load(c *gin.Context, id string) (models.Watchlist, error) {
+	return scanWatchlist(h.db.QueryRow(
+		watchlistSelect+" WHERE w.id = $1 AND ($2 = '' OR w.license_id::text = $2)", id, principalLicense(c),
+	))
+}
+
+// exists responds 404 and reports false when the watchlist does not exist, or belongs to another
+// license than the caller's
+func (h *WatchlistHandler) exists(c *gin.Context, id string) bool {
+	var found bool
+	if err := h.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM watchlists WHERE id = $1 AND ($2 = '' OR license_id::text = $2))",
+		id, principalLicense(c),
+	).Scan(&found); err != nil {
+		log.Errorf("Failed to look up watchlist: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load watchlist"})
+		return false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found"})
+	}
+	return found
+}
+
+var watchlistSeverities = []string{"low", "medium", "high", "critical"}
+
+func scanWatchlist(row rowScanner) (models.Watchlist, error) {
+	var w models.Watchlist
+	var feed []byte
+	var lastSynced, lastEvaluated sql.NullTime
+	err := row.Scan(&w.ID, &w.LicenseID, &w.Name, &w.Description, &w.Severity, &w.Enabled,
+		&feed, &lastSynced, &lastEvaluated, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt, &w.EntryCount, &w.HitCount)
+	if err != nil {
+		return w, err
+	}
+	if len(feed) > 0 {
+		w.CommunityFeed = &models.CommunityFeedFilter{}
+		json.Unmarshal(feed, w.CommunityFeed)
+	}
+	if lastSynced.Valid {
+		w.LastSyncedAt = &lastSynced.Time
+	}
+	if lastEvaluated.Valid {
+		w.LastEvaluatedAt = &lastEvaluated.Time
+	}
+	return w, nil
+}
+
+// normalizeWatchlistEntries validates entries and normalizes their values. Network indicators
+// are lowercased; all values are matched case-insensitively.
+func normalizeWatchlistEntries(entries []models.AddWatchlistEntry) ([]models.AddWatchlistEntry, error) {
+	normalized := make([]models.AddWatchlistEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !containsString(models.WatchlistEntryTypes, entry.EntryType) {
+			return nil, fmt.Errorf("invalid entry_type %q", entry.EntryType)
+		}
+		entry.Value = strings.TrimSpace(entry.Value)
+		if entry.Value == "" {
+			return nil, fmt.Errorf("%s entry value must not be empty", entry.EntryType)
+		}
+		if strings.ContainsAny(entry.Value, "\r\n") {
+			return nil, fmt.Errorf("%s entry value must be a single line", entry.EntryType)
+		}
+		switch entry.EntryType {
+		case models.WatchlistEntryIP, models.WatchlistEntryDomain, models.WatchlistEntryHash:
+			entry.Value = strings.ToLower(entry.Value)
+		}
+		normalized = append(normalized, entry)
+	}
+	return normalized, nil
+}
+
+// insertWatchlistEntries adds entries, skipping values already on the list, and returns how
+// many were added
+func insertWatchlistEntries(db sqlExecer, watchlistID string, entries []models.AddWatchlistEntry) (int, error) {
+	added := 0
+	for _, entry := range entries {
+		result, err := db.Exec(`
+			INSERT INTO watchlist_entries (watchlist_id, entry_type, value, comment)
+			VALUES ($1, $2, $3, NULLIF($4, ''))
+			ON CONFLICT (watchlist_id, entry_type, value) DO NOTHING
+		`, watchlistID, entry.EntryType, entry.Value, entry.Comment)
+		if err != nil {
+			return added, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return added, nil
+}
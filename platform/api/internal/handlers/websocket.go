@@ -3,9 +3,13 @@
 package handlers
 
 import (
+	"compress/flate"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -32,8 +36,45 @@ type WSHub struct {
 	register   chan *WSClient
 	unregister chan *WSClient
 	mu         sync.RWMutex
+	replay     *wsReplayStore // Recent messages per tenant for reconnecting clients
+	cursor     uint64         // Last cursor assigned to a broadcast message (atomic)
+
+	// Connection accounting, guarded by mu; slots are reserved before the upgrade
+	maxConnections          int
+	maxConnectionsPerTenant int
+	totalConns              int
+	tenantConns             map[string]int
+	rejected                uint64 // Upgrades refused because of limits (atomic)
+
+	compressionLevel int // flate level used when permessage-deflate is negotiated
+	batchMax         int // Maximum queued messages coalesced into one frame; 1 disables batching
+	writeStats       wsWriteStats
 }
 
+const (
+	// wsPongWait is how long a client may stay silent before it is considered dead
+	wsPongWait = 60 * time.Second
+
+	// wsStaleGrace is added to wsPongWait before the hub reaps a client that stopped answering pings
+	wsStaleGrace = 30 * time.Second
+)
+
+// WSHubConfig configures the WebSocket hub
+type WSHubConfig struct {
+	ReplayBufferSize int           // Messages kept per tenant for replay
+	ReplayMaxAge     time.Duration // Oldest message kept for replay
+
+	MaxConnections          int // Total concurrent connections; 0 means unlimited
+	MaxConnectionsPerTenant int // Concurrent connections per tenant; 0 means unlimited
+
+	EnableCompression bool // Negotiate permessage-deflate with clients that support it
+	CompressionLevel  int  // flate level (1 fastest - 9 smallest); 0 uses the default
+	BatchMaxMessages  int  // Coalesce up to this many queued messages into one batch frame; 0 uses the default
+}
+
+// defaultWSBatchMaxMessages is the batch size when none is configured
+const defaultWSBatchMaxMessages = 50
+
 // WSClient wraps a WebSocket connection
 type WSClient struct {
 	id           string
@@ -43,26 +84,44 @@ type WSClient struct {
 	send         chan models.WSMessage
 	hub          *WSHub
 	connectedAt  time.Time
-	lastPingAt   time.Time
+	lastPingAt   int64 // Unix nanoseconds of the last pong or ping (atomic)
 }
 
 // Global hub instance
 var globalHub *WSHub
 
 // InitWebSocketHub initializes the WebSocket hub
-func InitWebSocketHub() {
+func InitWebSocketHub(config WSHubConfig) {
 	globalHub = &WSHub{
 		clients:    make(map[string]*WSClient),
 		broadcast:  make(chan models.WSMessage, 256),
 		register:   make(chan *WSClient),
 		unregister: make(chan *WSClient),
+		replay:     newWSReplayStore(config.ReplayBufferSize, config.ReplayMaxAge),
+
+		maxConnections:          config.MaxConnections,
+		maxConnectionsPerTenant: config.MaxConnectionsPerTenant,
+		tenantConns:             make(map[string]int),
+
+		compressionLevel: config.CompressionLevel,
+		batchMax:         config.BatchMaxMessages,
+	}
+
+	if globalHub.compressionLevel == 0 {
+		globalHub.compressionLevel = flate.DefaultCompression
 	}
+	if globalHub.batchMax <= 0 {
+		globalHub.batchMax = defaultWSBatchMaxMessages
+	}
+	upgrader.EnableCompression = config.EnableCompression
 
 	go globalHub.run()
 	log.Info("WebSocket hub initialized")
 }
 
-// HandleWebSocket handles WebSocket connection requests
+// HandleWebSocket handles WebSocket connection requests.
+// A reconnecting client passes the last cursor it saw as ?since= to catch up on missed messages.
+// A detail view may pass ?agent_id= or ?case_id= to follow only that resource from the start.
 func HandleWebSocket(c *gin.Context) {
 	tenantID := c.Query("tenant_id")
 	if tenantID == "" {
@@ -70,13 +129,55 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	var since uint64
+	if v := c.Query("since"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since cursor"})
+			return
+		}
+		since = parsed
+	}
+
+	var resources []models.WSResource
+	if agentID := c.Query("agent_id"); agentID != "" {
+		resources = append(resources, models.WSResource{Type: models.WSResourceAgent, ID: agentID})
+	}
+	if caseID := c.Query("case_id"); caseID != "" {
+		resources = append(resources, models.WSResource{Type: models.WSResourceCase, ID: caseID})
+	}
+
+	// Reserve a connection slot before upgrading
+	reason := globalHub.reserve(tenantID)
+
 	// Upgrade HTTP connection to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Errorf("Failed to upgrade connection: %v", err)
+		if reason == "" {
+			globalHub.release(tenantID)
+		}
+		return
+	}
+
+	// Over the limit: complete the handshake only to tell the client why it is being refused
+	if reason != "" {
+		atomic.AddUint64(&globalHub.rejected, 1)
+		log.Warnf("Rejected WebSocket connection for tenant %s: %s", tenantID, reason)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason),
+			time.Now().Add(time.Second))
+		conn.Close()
 		return
 	}
 
+	if upgrader.EnableCompression {
+		conn.EnableWriteCompression(true)
+		if err := conn.SetCompressionLevel(globalHub.compressionLevel); err != nil {
+			log.Warnf("Invalid WebSocket compression level %d: %v", globalHub.compressionLevel, err)
+		}
+	}
+
 	// Create new client
 	client := &WSClient{
 		id:          uuid.New().String(),
@@ -85,9 +186,10 @@ func HandleWebSocket(c *gin.Context) {
 		send:        make(chan models.WSMessage, 256),
 		hub:         globalHub,
 		connectedAt: time.Now(),
-		lastPingAt:  time.Now(),
+		lastPingAt:  time.Now().UnixNano(),
 		subscription: models.WSSubscription{
-			TenantID: tenantID,
+			TenantID:  tenantID,
+			Resources: resources,
 		},
 	}
 
@@ -100,10 +202,15 @@ func HandleWebSocket(c *gin.Context) {
 		Timestamp: time.Now(),
 		Data: map[string]interface{}{
 			"client_id": client.id,
+			"cursor":    atomic.LoadUint64(&globalHub.cursor),
 			"message":   "Successfully connected to Privé Platform WebSocket",
 		},
 	}
 
+	if since > 0 {
+		client.replaySince(since)
+	}
+
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump()
@@ -112,49 +219,65 @@ func HandleWebSocket(c *gin.Context) {
 }
 
 // BroadcastEvent broadcasts an event to all subscribed clients
-func BroadcastEvent(event models.WSEventNotification) {
+func BroadcastEvent(tenantID string, event models.WSEventNotification) {
 	if globalHub != nil {
 		globalHub.broadcast <- models.WSMessage{
 			Type:      models.WSTypeNewEvent,
 			Timestamp: time.Now(),
+			TenantID:  tenantID,
 			Data:      event,
 		}
 	}
 }
 
 // BroadcastAlert broadcasts an alert to all subscribed clients
-func BroadcastAlert(alert models.WSAlertNotification) {
+func BroadcastAlert(tenantID string, alert models.WSAlertNotification) {
 	if globalHub != nil {
 		globalHub.broadcast <- models.WSMessage{
 			Type:      models.WSTypeNewAlert,
 			Timestamp: time.Now(),
+			TenantID:  tenantID,
 			Data:      alert,
 		}
 	}
 }
 
 // BroadcastAgentStatus broadcasts agent status change
-func BroadcastAgentStatus(status models.WSAgentStatusNotification) {
+func BroadcastAgentStatus(tenantID string, status models.WSAgentStatusNotification) {
 	if globalHub != nil {
 		globalHub.broadcast <- models.WSMessage{
 			Type:      models.WSTypeAgentStatus,
 			Timestamp: time.Now(),
+			TenantID:  tenantID,
 			Data:      status,
 		}
 	}
 }
 
 // BroadcastStatistics broadcasts real-time statistics
-func BroadcastStatistics(stats models.WSStatistics) {
+func BroadcastStatistics(tenantID string, stats models.WSStatistics) {
 	if globalHub != nil {
 		globalHub.broadcast <- models.WSMessage{
 			Type:      models.WSTypeSystemNotification,
 			Timestamp: time.Now(),
+			TenantID:  tenantID,
 			Data:      stats,
 		}
 	}
 }
 
+// BroadcastCaseUpdate sends a case timeline change to clients subscribed to the case
+func BroadcastCaseUpdate(tenantID string, update models.WSCaseUpdateNotification) {
+	if globalHub != nil {
+		globalHub.broadcast <- models.WSMessage{
+			Type:      models.WSTypeCaseUpdate,
+			Timestamp: time.Now(),
+			TenantID:  tenantID,
+			Data:      update,
+		}
+	}
+}
+
 // Hub methods
 
 func (h *WSHub) run() {
@@ -171,14 +294,16 @@ func (h *WSHub) run() {
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.id]; ok {
-				delete(h.clients, client.id)
-				close(client.send)
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
 			log.Infof("Client unregistered: %s (remaining: %d)", client.id, len(h.clients))
 
 		case message := <-h.broadcast:
+			// Assign a cursor and buffer the message so reconnecting clients can replay it
+			message.Cursor = atomic.AddUint64(&h.cursor, 1)
+			h.replay.add(message)
+
+			var slow []*WSClient
 			h.mu.RLock()
 			for _, client := range h.clients {
 				// Check if message should be sent to this client
@@ -186,16 +311,36 @@ func (h *WSHub) run() {
 					select {
 					case client.send <- message:
 					default:
-						// Client send buffer is full, disconnect
-						h.mu.RUnlock()
-						h.unregister <- client
-						h.mu.RLock()
+						// Client send buffer is full; it can catch up via replay after reconnecting
+						slow = append(slow, client)
 					}
 				}
 			}
 			h.mu.RUnlock()
 
+			if len(slow) > 0 {
+				h.mu.Lock()
+				for _, client := range slow {
+					if h.removeClient(client) {
+						log.Warnf("Dropped slow client %s (tenant: %s) at cursor %d", client.id, client.tenantID, message.Cursor)
+					}
+				}
+				h.mu.Unlock()
+			}
+
 		case <-ticker.C:
+			// Reap clients that stopped answering pings; closing the connection ends readPump,
+			// which unregisters the client
+			staleBefore := time.Now().Add(-(wsPongWait + wsStaleGrace)).UnixNano()
+			h.mu.RLock()
+			for _, client := range h.clients {
+				if atomic.LoadInt64(&client.lastPingAt) < staleBefore {
+					log.Warnf("Reaping stale WebSocket client %s (tenant: %s)", client.id, client.tenantID)
+					client.conn.Close()
+				}
+			}
+			h.mu.RUnlock()
+
 			// Send heartbeat to all clients
 			h.mu.RLock()
 			for _, client := range h.clients {
@@ -212,18 +357,113 @@ func (h *WSHub) run() {
 	}
 }
 
+// reserve claims a connection slot for a tenant, returning a non-empty reason if a limit is reached
+func (h *WSHub) reserve(tenantID string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.maxConnections > 0 && h.totalConns >= h.maxConnections {
+		return "server connection limit reached"
+	}
+	if h.maxConnectionsPerTenant > 0 && h.tenantConns[tenantID] >= h.maxConnectionsPerTenant {
+		return "tenant connection limit reached"
+	}
+
+	h.totalConns++
+	h.tenantConns[tenantID]++
+	return ""
+}
+
+// release returns a connection slot
+func (h *WSHub) release(tenantID string) {
+	h.mu.Lock()
+	h.releaseLocked(tenantID)
+	h.mu.Unlock()
+}
+
+func (h *WSHub) releaseLocked(tenantID string) {
+	h.totalConns--
+	h.tenantConns[tenantID]--
+	if h.tenantConns[tenantID] <= 0 {
+		delete(h.tenantConns, tenantID)
+	}
+}
+
+// removeClient drops a registered client and frees its slot; the caller holds mu
+func (h *WSHub) removeClient(client *WSClient) bool {
+	if _, ok := h.clients[client.id]; !ok {
+		return false
+	}
+	delete(h.clients, client.id)
+	close(client.send)
+	h.releaseLocked(client.tenantID)
+	return true
+}
+
 func (h *WSHub) shouldSendToClient(client *WSClient, message models.WSMessage) bool {
-	// Check tenant isolation
-	if message.Type == models.WSTypeNewEvent || message.Type == models.WSTypeNewAlert {
-		// For now, send all messages within the same tenant
-		// In production, implement subscription filtering
-		return true
+	// Tenant-scoped messages only go to that tenant's clients
+	if message.TenantID != "" && message.TenantID != client.tenantID {
+		return false
+	}
+
+	// A client following specific resources only receives updates about them
+	resourceType, resourceID := messageResource(message)
+	if len(client.subscription.Resources) > 0 {
+		if resourceType == "" {
+			return false
+		}
+		for _, resource := range client.subscription.Resources {
+			if resource.Type == resourceType && resource.ID == resourceID {
+				return true
+			}
+		}
+		return false
 	}
 
-	// System messages go to all clients
+	// Case updates are only for clients following the case
+	if message.Type == models.WSTypeCaseUpdate {
+		return false
+	}
+
+	// Everything else within the tenant, and system messages, go to all clients
 	return true
 }
 
+// messageResource returns the single resource a message is about, or "" for tenant-wide messages
+func messageResource(message models.WSMessage) (string, string) {
+	switch data := message.Data.(type) {
+	case models.WSEventNotification:
+		if data.AgentID != "" {
+			return models.WSResourceAgent, data.AgentID
+		}
+	case models.WSAlertNotification:
+		if data.AgentID != "" {
+			return models.WSResourceAgent, data.AgentID
+		}
+	case models.WSAgentStatusNotification:
+		return models.WSResourceAgent, data.AgentID
+	case models.WSCaseUpdateNotification:
+		return models.WSResourceCase, data.CaseID
+	}
+	return "", ""
+}
+
+// validateWSResources checks the resources of a subscription request
+func validateWSResources(resources []models.WSResource) string {
+	if len(resources) > models.MaxWSResources {
+		return fmt.Sprintf("At most %d resources per subscription", models.MaxWSResources)
+	}
+	for _, resource := range resources {
+		if resource.Type != models.WSResourceAgent && resource.Type != models.WSResourceCase {
+			return fmt.Sprintf("Unknown resource type %q; use agent or case", resource.Type)
+		}
+		if resource.ID == "" {
+			return "Resource id required"
+		}
+	}
+	return ""
+}
+
 // Client methods
 
 func (c *WSClient) readPump() {
@@ -232,10 +472,10 @@ func (c *WSClient) readPump() {
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		c.lastPingAt = time.Now()
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		atomic.StoreInt64(&c.lastPingAt, time.Now().UnixNano())
 		return nil
 	})
 
@@ -275,8 +515,17 @@ func (c *WSClient) writePump() {
 				return
 			}
 
-			// Send message as JSON
-			if err := c.conn.WriteJSON(message); err != nil {
+			// Coalesce whatever else is already queued into one batch frame
+			batch := []models.WSMessage{message}
+			for len(batch) < c.hub.batchMax && len(c.send) > 0 {
+				next, ok := <-c.send
+				if !ok {
+					break
+				}
+				batch = append(batch, next)
+			}
+
+			if err := c.writeBatch(batch); err != nil {
 				log.Errorf("Failed to write message: %v", err)
 				return
 			}
@@ -290,13 +539,60 @@ func (c *WSClient) writePump() {
 	}
 }
 
+// writeBatch writes a single message as-is, or several as one batch message
+func (c *WSClient) writeBatch(batch []models.WSMessage) error {
+	var frame models.WSMessage
+	if len(batch) == 1 {
+		frame = batch[0]
+	} else {
+		frame = models.WSMessage{
+			Type:      models.WSTypeBatch,
+			Timestamp: time.Now(),
+			Data:      batch,
+		}
+	}
+
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+		return err
+	}
+
+	c.hub.writeStats.record(payload, len(batch), c.hub.compressionLevel)
+	return nil
+}
+
 func (c *WSClient) handleMessage(msg models.WSMessage) {
 	switch msg.Type {
 	case models.WSTypeSubscribe:
 		// Update subscription preferences
 		if data, ok := msg.Data.(map[string]interface{}); ok {
 			dataJSON, _ := json.Marshal(data)
-			json.Unmarshal(dataJSON, &c.subscription)
+
+			subscription := c.subscription
+			subscription.Since = 0
+			if err := json.Unmarshal(dataJSON, &subscription); err != nil {
+				c.send <- models.WSMessage{
+					Type:      models.WSTypeError,
+					Timestamp: time.Now(),
+					Error:     "Invalid subscription",
+				}
+				return
+			}
+			if reason := validateWSResources(subscription.Resources); reason != "" {
+				c.send <- models.WSMessage{
+					Type:      models.WSTypeError,
+					Timestamp: time.Now(),
+					Error:     reason,
+				}
+				return
+			}
+			c.subscription = subscription
+			// Subscriptions cannot cross tenants
+			c.subscription.TenantID = c.tenantID
 
 			c.send <- models.WSMessage{
 				Type:      models.WSTypeSystemNotification,
@@ -304,9 +600,15 @@ func (c *WSClient) handleMessage(msg models.WSMessage) {
 				Data:      map[string]string{"message": "Subscription updated"},
 			}
 			log.Infof("Client %s updated subscription", c.id)
+
+			if c.subscription.Since > 0 {
+				c.replaySince(c.subscription.Since)
+			}
 		}
 
 	case models.WSTypePing:
+		atomic.StoreInt64(&c.lastPingAt, time.Now().UnixNano())
+
 		// Respond with pong
 		c.send <- models.WSMessage{
 			Type:      models.WSTypePong,
@@ -318,6 +620,44 @@ func (c *WSClient) handleMessage(msg models.WSMessage) {
 	}
 }
 
+// replaySince sends the client everything buffered after cursor as a single replay batch,
+// preceded by a replay_gap notice if part of that range has already been evicted.
+// Live messages may interleave with the batch; clients de-duplicate by cursor.
+func (c *WSClient) replaySince(cursor uint64) {
+	latest := atomic.LoadUint64(&c.hub.cursor)
+	buffered, gap := c.hub.replay.since(c.tenantID, cursor, latest)
+
+	messages := make([]models.WSMessage, 0, len(buffered))
+	for _, msg := range buffered {
+		if c.hub.shouldSendToClient(c, msg) {
+			messages = append(messages, msg)
+		}
+	}
+
+	if gap {
+		c.send <- models.WSMessage{
+			Type:      models.WSTypeReplayGap,
+			Timestamp: time.Now(),
+			Data: map[string]interface{}{
+				"since":   cursor,
+				"message": "Some messages after the cursor are no longer buffered",
+			},
+		}
+	}
+
+	c.send <- models.WSMessage{
+		Type:      models.WSTypeReplay,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"since":       cursor,
+			"next_cursor": latest,
+			"messages":    messages,
+		},
+	}
+
+	log.Infof("Replayed %d messages to client %s since cursor %d", len(messages), c.id, cursor)
+}
+
 // GetConnectionStats returns WebSocket connection statistics
 func GetConnectionStats() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -332,6 +672,9 @@ func GetConnectionStats() gin.HandlerFunc {
 		stats := map[string]interface{}{
 			"total_connections": len(globalHub.clients),
 			"connections_by_tenant": make(map[string]int),
+			"max_connections":            globalHub.maxConnections,
+			"max_connections_per_tenant": globalHub.maxConnectionsPerTenant,
+			"rejected_connections":       atomic.LoadUint64(&globalHub.rejected),
 		}
 
 		// Count connections by tenant
@@ -340,6 +683,7 @@ func GetConnectionStats() gin.HandlerFunc {
 			tenantCounts[client.tenantID]++
 		}
 		stats["connections_by_tenant"] = tenantCounts
+		stats["bandwidth"] = globalHub.writeStats.snapshot(upgrader.EnableCompression)
 
 		c.JSON(http.StatusOK, stats)
 	}
@@ -0,0 +1,127 @@
+// WebSocket Replay Buffer
+// Keeps recent per-tenant messages so reconnecting clients can catch up from a cursor
+
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	defaultReplayBufferSize = 1000
+	defaultReplayMaxAge     = 5 * time.Minute
+)
+
+// wsReplayBuffer holds the most recent messages of one tenant, oldest first
+type wsReplayBuffer struct {
+	messages []models.WSMessage
+	evicted  uint64 // Cursor of the newest message dropped from this buffer
+}
+
+// wsReplayStore holds replay buffers for every tenant; global messages use the "" tenant
+type wsReplayStore struct {
+	mu      sync.RWMutex
+	buffers map[string]*wsReplayBuffer
+	maxSize int
+	maxAge  time.Duration
+	notify  chan struct{} // Closed and replaced whenever a message is added, waking long-pollers
+}
+
+func newWSReplayStore(maxSize int, maxAge time.Duration) *wsReplayStore {
+	if maxSize <= 0 {
+		maxSize = defaultReplayBufferSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultReplayMaxAge
+	}
+	return &wsReplayStore{
+		buffers: make(map[string]*wsReplayBuffer),
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		notify:  make(chan struct{}),
+	}
+}
+
+// add appends a message to its tenant's buffer, evicting by size and age
+func (s *wsReplayStore) add(msg models.WSMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf, ok := s.buffers[msg.TenantID]
+	if !ok {
+		buf = &wsReplayBuffer{}
+		s.buffers[msg.TenantID] = buf
+	}
+
+	buf.messages = append(buf.messages, msg)
+	s.trim(buf, time.Now())
+
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// changed returns a channel that is closed when the next message is added
+func (s *wsReplayStore) changed() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.notify
+}
+
+// trim drops messages beyond the size bound or older than the age bound
+func (s *wsReplayStore) trim(buf *wsReplayBuffer, now time.Time) {
+	drop := 0
+	if len(buf.messages) > s.maxSize {
+		drop = len(buf.messages) - s.maxSize
+	}
+	for drop < len(buf.messages) && now.Sub(buf.messages[drop].Timestamp) > s.maxAge {
+		drop++
+	}
+	if drop == 0 {
+		return
+	}
+
+	buf.evicted = buf.messages[drop-1].Cursor
+	// Copy so the evicted prefix can be garbage collected
+	buf.messages = append([]models.WSMessage(nil), buf.messages[drop:]...)
+}
+
+// since returns a tenant's messages (plus global ones) newer than cursor, oldest first.
+// gap reports that some messages after cursor were already evicted, or that the cursor
+// is from before a server restart, so the client must refresh instead of relying on replay.
+func (s *wsReplayStore) since(tenantID string, cursor uint64, latest uint64) (messages []models.WSMessage, gap bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cursor > latest {
+		gap = true
+		cursor = 0
+	}
+
+	now := time.Now()
+	for _, key := range []string{tenantID, ""} {
+		buf, ok := s.buffers[key]
+		if !ok {
+			continue
+		}
+		s.trim(buf, now)
+
+		if cursor < buf.evicted {
+			gap = true
+		}
+		for _, msg := range buf.messages {
+			if msg.Cursor > cursor {
+				messages = append(messages, msg)
+			}
+		}
+		if tenantID == "" {
+			break
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Cursor < messages[j].Cursor })
+	return messages, gap
+}
@@ -0,0 +1,80 @@
+// WebSocket Bandwidth Accounting
+// Counts frames and payload bytes and estimates the permessage-deflate saving by sampling
+
+package handlers
+
+import (
+	"compress/flate"
+	"sync/atomic"
+)
+
+// wsCompressionSampleEvery compresses one in this many frames to estimate the compression ratio
+const wsCompressionSampleEvery = 100
+
+// wsWriteStats aggregates outbound WebSocket traffic across all clients
+type wsWriteStats struct {
+	frames           uint64 // Data frames written
+	messages         uint64 // Messages written, counting each message inside a batch
+	payloadBytes     uint64 // Uncompressed JSON bytes written
+	sampledBytes     uint64 // Uncompressed bytes of sampled frames
+	sampledCompBytes uint64 // Deflated bytes of sampled frames
+}
+
+// byteCounter is an io.Writer that only counts
+type byteCounter uint64
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
+
+// record accounts for one written frame carrying messages messages
+func (s *wsWriteStats) record(payload []byte, messages int, level int) {
+	frame := atomic.AddUint64(&s.frames, 1)
+	atomic.AddUint64(&s.messages, uint64(messages))
+	atomic.AddUint64(&s.payloadBytes, uint64(len(payload)))
+
+	if frame%wsCompressionSampleEvery != 1 {
+		return
+	}
+
+	var counter byteCounter
+	writer, err := flate.NewWriter(&counter, level)
+	if err != nil {
+		return
+	}
+	writer.Write(payload)
+	writer.Close()
+
+	atomic.AddUint64(&s.sampledBytes, uint64(len(payload)))
+	atomic.AddUint64(&s.sampledCompBytes, uint64(counter))
+}
+
+// snapshot returns the counters for the stats endpoint
+func (s *wsWriteStats) snapshot(compression bool) map[string]interface{} {
+	frames := atomic.LoadUint64(&s.frames)
+	messages := atomic.LoadUint64(&s.messages)
+	payload := atomic.LoadUint64(&s.payloadBytes)
+	sampled := atomic.LoadUint64(&s.sampledBytes)
+	compressed := atomic.LoadUint64(&s.sampledCompBytes)
+
+	stats := map[string]interface{}{
+		"frames_sent":         frames,
+		"messages_sent":       messages,
+		"payload_bytes_sent":  payload,
+		"compression_enabled": compression,
+	}
+
+	if frames > 0 {
+		stats["messages_per_frame"] = float64(messages) / float64(frames)
+	}
+	if sampled > 0 {
+		ratio := float64(compressed) / float64(sampled)
+		stats["estimated_compression_ratio"] = ratio
+		if compression {
+			stats["estimated_wire_bytes_sent"] = uint64(float64(payload) * ratio)
+		}
+	}
+
+	return stats
+}
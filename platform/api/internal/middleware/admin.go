@@ -0,0 +1,32 @@
+// Admin Token Middleware
+
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader carries the platform administrator token
+const AdminTokenHeader = "X-Admin-Token"
+
+// RequireAdmin returns middleware that only lets requests presenting the administrator token
+// through. With no token configured the protected routes are disabled entirely.
+func RequireAdmin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrative operations are disabled"})
+			return
+		}
+
+		presented := c.GetHeader(AdminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrator token required"})
+			return
+		}
+
+		c.Next()
+	}
+}
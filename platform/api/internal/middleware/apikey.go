@@ -0,0 +1,319 @@
+// API Key Authentication Middleware
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// APIKeyScheme is the Authorization scheme API keys are presented with: "ApiKey <key>"
+	APIKeyScheme = "ApiKey"
+
+	// Context keys set for requests authenticated with an API key
+	ContextAPIKeyID      = "api_key_id"
+	ContextAPIKeyLicense = "api_key_license_id"
+	ContextAPIKeyScopes  = "api_key_scopes"
+	ContextAPIKeyRole    = "api_key_role"
+
+	// apiKeyTag starts every key so leaked keys are easy to recognise in code and logs
+	apiKeyTag = "prv"
+
+	// apiKeyCacheTTL bounds how long a validated key is reused before re-reading it, i.e. how
+	// long a revocation takes to reach every API instance
+	apiKeyCacheTTL = 30 * time.Second
+
+	// apiKeyTouchInterval bounds how often last-used tracking writes to the database per key
+	apiKeyTouchInterval = time.Minute
+
+	// licenseRoutePrefix starts the routes whose :id parameter is a license ID
+	licenseRoutePrefix = "/api/v1/licenses/:id"
+)
+
+// GenerateAPIKey creates a key of the form prv_<prefix>_<secret>. The prefix identifies the key
+// and may be displayed; the hash is what gets stored.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = apiKeyTag + "_" + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex SHA-256 of a key. Keys carry 256 bits of randomness, so a fast
+// hash is sufficient.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyPrefix extracts the lookup prefix of a presented key. The secret is base64url, whose
+// alphabet includes "_", so only the first two separators split the key.
+func apiKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[0] + "_" + parts[1], true
+}
+
+// ScopeAllows reports whether the granted scopes cover the required one. Write access to a
+// resource includes read access, "<resource>:*" covers both and "*" covers everything.
+func ScopeAllows(granted []string, required string) bool {
+	resource, action, _ := strings.Cut(required, ":")
+	for _, scope := range granted {
+		switch scope {
+		case "*", required, resource + ":*":
+			return true
+		case resource + ":write":
+			if action == "read" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// APIKeys authenticates requests presenting an API key
+type APIKeys struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	cache map[string]*cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	id        string
+	licenseID string
+	hash      string
+	scopes    []string
+	role      string
+	expiresAt sql.NullTime
+	revokedAt sql.NullTime
+	fetchedAt time.Time
+	touchedAt time.Time
+}
+
+// NewAPIKeys creates API key middleware
+func NewAPIKeys(db *sql.DB) *APIKeys {
+	return &APIKeys{
+		db:    db,
+		cache: make(map[string]*cachedAPIKey),
+	}
+}
+
+// Handler returns the middleware for the /api/v1 group. Requests without an API key pass
+// through unchanged. Keyed requests must hold the scope for the route's resource (the first
+// path segment under /api/v1, read for GET/HEAD and write otherwise) and may only address
+// the key's own license.
+func (a *APIKeys) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, presented, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, APIKeyScheme) {
+			c.Next()
+			return
+		}
+
+		presented = strings.TrimSpace(presented)
+		prefix, ok := apiKeyPrefix(presented)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+
+		key, err := a.lookup(prefix)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to look up API key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate API key"})
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(HashAPIKey(presented)), []byte(key.hash)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		if key.revokedAt.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+			return
+		}
+		if key.expiresAt.Valid && key.expiresAt.Time.Before(time.Now()) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key has expired"})
+			return
+		}
+
+		required := apiKeyRequiredScope(c.Request)
+		if !ScopeAllows(key.scopes, required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the required scope", "scope": required})
+			return
+		}
+
+		confined, err := namesOnlyLicense(c, key.licenseID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		if !confined {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is not valid for this license"})
+			return
+		}
+
+		// License-aware middleware (feature gate, idempotency) reads the license from the header
+		if c.GetHeader("X-License-ID") == "" {
+			c.Request.Header.Set("X-License-ID", key.licenseID)
+		}
+
+		c.Set(ContextAPIKeyID, key.id)
+		c.Set(ContextAPIKeyLicense, key.licenseID)
+		c.Set(ContextAPIKeyScopes, key.scopes)
+		c.Set(ContextAPIKeyRole, key.role)
+		a.touch(key, c.ClientIP())
+
+		c.Next()
+	}
+}
+
+// apiKeyRequiredScope maps a request to the scope it needs, e.g. GET /api/v1/dlp/policies
+// needs dlp:read
+func apiKeyRequiredScope(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	resource, _, _ := strings.Cut(path, "/")
+
+	action := "write"
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		action = "read"
+	}
+	return resource + ":" + action
+}
+
+// namesOnlyLicense reports whether every license the request names is licenseID. API keys and
+// license-bound user sessions both confine requests through it.
+func namesOnlyLicense(c *gin.Context, licenseID string) (bool, error) {
+	body, err := readRequestBody(c)
+	if err != nil {
+		return false, err
+	}
+	for _, named := range requestLicenses(c, body) {
+		if named != licenseID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// readRequestBody returns the request body and puts it back for the handler to bind. The
+// Content-Type is not consulted: ShouldBindJSON decodes the body whatever it claims to be.
+func readRequestBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// requestLicenses returns every license a request names: the X-License-ID header, the
+// license_id path parameter, the license ID of /licenses/:id routes, the license_id/tenant_id
+// query parameters and license_id/tenant_id fields of a JSON body. The body is decoded the way
+// ShouldBindJSON decodes it, so trailing data after the object does not hide its fields. Other
+// resources addressed by ID are checked by their handlers.
+func requestLicenses(c *gin.Context, body []byte) []string {
+	licenses := []string{}
+	add := func(licenseID string) {
+		if licenseID != "" {
+			licenses = append(licenses, licenseID)
+		}
+	}
+	add(c.GetHeader("X-License-ID"))
+	add(c.Param("license_id"))
+	if strings.HasPrefix(c.FullPath(), licenseRoutePrefix) {
+		add(c.Param("id"))
+	}
+	add(c.Query("license_id"))
+	add(c.Query("tenant_id"))
+
+	var fields struct {
+		LicenseID string `json:"license_id"`
+		TenantID  string `json:"tenant_id"`
+	}
+	if len(body) > 0 && json.NewDecoder(bytes.NewReader(body)).Decode(&fields) == nil {
+		add(fields.LicenseID)
+		add(fields.TenantID)
+	}
+	return licenses
+}
+
+// lookup returns the key with the given prefix, cached for apiKeyCacheTTL
+func (a *APIKeys) lookup(prefix string) (*cachedAPIKey, error) {
+	a.mu.Lock()
+	cached, ok := a.cache[prefix]
+	a.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < apiKeyCacheTTL {
+		return cached, nil
+	}
+
+	key := &cachedAPIKey{fetchedAt: time.Now()}
+	err := a.db.QueryRow(`
+		SELECT id, license_id, key_hash, scopes, role, expires_at, revoked_at
+		FROM api_keys WHERE key_prefix = $1
+	`, prefix).Scan(&key.id, &key.licenseID, &key.hash, pq.Array(&key.scopes), &key.role, &key.expiresAt, &key.revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		key.touchedAt = cached.touchedAt
+	}
+
+	a.mu.Lock()
+	a.cache[prefix] = key
+	a.mu.Unlock()
+
+	return key, nil
+}
+
+// touch records that the key was used, at most once per apiKeyTouchInterval
+func (a *APIKeys) touch(key *cachedAPIKey, ip string) {
+	a.mu.Lock()
+	if time.Since(key.touchedAt) < apiKeyTouchInterval {
+		a.mu.Unlock()
+		return
+	}
+	key.touchedAt = time.Now()
+	a.mu.Unlock()
+
+	if _, err := a.db.Exec(
+		"UPDATE api_keys SET last_used_at = NOW(), last_used_ip = NULLIF($1, '')::inet WHERE id = $2",
+		ip, key.id,
+	); err != nil {
+		log.Warnf("Failed to record API key usage: %v", err)
+	}
+}
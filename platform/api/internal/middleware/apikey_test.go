@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestLicenses(t *testing.T) {
+	tests := []struct {
+		name        string
+		route       string
+		target      string
+		header      string
+		body        string
+		contentType string
+		want        []string
+	}{
+		{"nothing named", "/api/v1/cases/:id", "/api/v1/cases/c1", "", "", "", []string{}},
+		{"header", "/api/v1/cases", "/api/v1/cases", "lic-a", "", "", []string{"lic-a"}},
+		{"license_id query", "/api/v1/cases", "/api/v1/cases?license_id=lic-a", "", "", "", []string{"lic-a"}},
+		{"tenant_id query", "/api/v1/mssp/query", "/api/v1/mssp/query?tenant_id=lic-a", "", "", "", []string{"lic-a"}},
+		{"license_id path", "/api/v1/datalake/config/:license_id", "/api/v1/datalake/config/lic-a", "", "", "", []string{"lic-a"}},
+		{"license route", "/api/v1/licenses/:id", "/api/v1/licenses/lic-a", "", "", "", []string{"lic-a"}},
+		{"license subroute", "/api/v1/licenses/:id/features/:feature", "/api/v1/licenses/lic-a/features/dlp", "", "", "", []string{"lic-a"}},
+		{"other resource id", "/api/v1/watchlists/:id", "/api/v1/watchlists/w1", "", "", "", []string{}},
+		{"json body", "/api/v1/cases", "/api/v1/cases", "", `{"license_id":"lic-a","tenant_id":"lic-b"}`, "application/json", []string{"lic-a", "lic-b"}},
+		{"malformed body ignored", "/api/v1/cases", "/api/v1/cases", "", `{"license_id":`, "application/json", []string{}},
+		{"json body as text/plain", "/api/v1/telemetry/query", "/api/v1/telemetry/query", "", `{"tenant_id":"lic-b"}`, "text/plain", []string{"lic-b"}},
+		{"json body without content type", "/api/v1/telemetry/query", "/api/v1/telemetry/query", "", `{"tenant_id":"lic-b"}`, "", []string{"lic-b"}},
+		{"trailing data after body", "/api/v1/cases", "/api/v1/cases", "", `{"license_id":"lic-a"} trailing`, "application/json", []string{"lic-a"}},
+		{"every source", "/api/v1/licenses/:id", "/api/v1/licenses/lic-b?license_id=lic-c", "lic-a", `{"license_id":"lic-d"}`, "application/json",
+			[]string{"lic-a", "lic-b", "lic-c", "lic-d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST(tt.route, func(c *gin.Context) {
+				body, err := readRequestBody(c)
+				if err != nil {
+					t.Fatalf("readRequestBody() error = %v", err)
+				}
+				if got := requestLicenses(c, body); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("requestLicenses() = %v, want %v", got, tt.want)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.header != "" {
+				req.Header.Set("X-License-ID", tt.header)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestReadJSONBodyRestoresBody(t *testing.T) {
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		if _, err := readRequestBody(c); err != nil {
+			t.Fatalf("readRequestBody() error = %v", err)
+		}
+		var req struct {
+			LicenseID string `json:"license_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.LicenseID != "lic-a" {
+			t.Errorf("bind after readRequestBody = %q, %v; want lic-a", req.LicenseID, err)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"license_id":"lic-a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestNamesOnlyLicense(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        bool
+	}{
+		{"no body", "", "", true},
+		{"own license", `{"tenant_id":"lic-a"}`, "application/json", true},
+		{"other license", `{"tenant_id":"lic-b"}`, "application/json", false},
+		{"other license as text/plain", `{"tenant_id":"lic-b"}`, "text/plain", false},
+		{"other license as form", `{"license_id":"lic-b"}`, "application/x-www-form-urlencoded", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/api/v1/telemetry/query", func(c *gin.Context) {
+				got, err := namesOnlyLicense(c, "lic-a")
+				if err != nil {
+					t.Fatalf("namesOnlyLicense() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("namesOnlyLicense() = %v, want %v", got, tt.want)
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry/query", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestGeneratedAPIKeysAuthenticate(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		key, prefix, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey() error = %v", err)
+		}
+		if got, ok := apiKeyPrefix(key); !ok || got != prefix {
+			t.Fatalf("apiKeyPrefix(%q) = %q, %v; want %q", key, got, ok, prefix)
+		}
+
+		keys := NewAPIKeys(nil)
+		keys.cache[prefix] = &cachedAPIKey{
+			id:        "key-1",
+			licenseID: "lic-a",
+			hash:      hash,
+			scopes:    []string{"*"},
+			role:      "read_only",
+			fetchedAt: time.Now(),
+			touchedAt: time.Now(),
+		}
+		router := gin.New()
+		router.Use(keys.Handler())
+		router.GET("/api/v1/cases", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/cases", nil)
+		req.Header.Set("Authorization", APIKeyScheme+" "+key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("key %q: status = %d, want %d", key, w.Code, http.StatusOK)
+		}
+	}
+}
+
+func TestAPIKeyPrefix(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"prv_0a1b2c_secret", "prv_0a1b2c", true},
+		{"prv_0a1b2c_sec_ret_", "prv_0a1b2c", true},
+		{"prv_0a1b2c_", "", false},
+		{"prv__secret", "", false},
+		{"abc_0a1b2c_secret", "", false},
+		{"prv_0a1b2c", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := apiKeyPrefix(tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("apiKeyPrefix(%q) = %q, %v; want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// CORS Middleware
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins lists exact origins ("https://dashboard.example.com"), subdomain wildcards
+	// ("https://*.example.com") or "*". Empty rejects every cross-origin request.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string // Response headers scripts may read, e.g. ETag
+	AllowCredentials bool
+	MaxAge           time.Duration // How long browsers may cache a preflight response
+}
+
+// CORS answers preflight requests and adds CORS headers for allowed origins
+type CORS struct {
+	config  CORSConfig
+	methods string
+	headers string
+	exposed string
+	maxAge  string
+}
+
+// NewCORS creates CORS middleware from the configuration
+func NewCORS(config CORSConfig) *CORS {
+	for i, origin := range config.AllowedOrigins {
+		config.AllowedOrigins[i] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+	}
+	if config.AllowCredentials && containsOrigin(config.AllowedOrigins, "*") {
+		// Browsers refuse credentials with a wildcard origin, and echoing any origin back
+		// would hand every site the user's session
+		log.Warn("CORS: credentials are not allowed for the \"*\" origin; list the origins explicitly")
+	}
+
+	return &CORS{
+		config:  config,
+		methods: strings.Join(config.AllowedMethods, ", "),
+		headers: strings.Join(config.AllowedHeaders, ", "),
+		exposed: strings.Join(config.ExposedHeaders, ", "),
+		maxAge:  strconv.Itoa(int(config.MaxAge.Seconds())),
+	}
+}
+
+// Handler returns the middleware. Same-origin and non-browser requests (no Origin header) pass
+// through unchanged; disallowed origins get no CORS headers, so the browser blocks the response.
+func (m *CORS) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		allowed, wildcard := m.allowOrigin(origin)
+		if !allowed {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		if wildcard {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if m.config.AllowCredentials && !wildcard {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if m.exposed != "" {
+				header.Set("Access-Control-Expose-Headers", m.exposed)
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		if !containsMethod(m.config.AllowedMethods, c.GetHeader("Access-Control-Request-Method")) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", m.methods)
+		if m.headers != "" {
+			header.Set("Access-Control-Allow-Headers", m.headers)
+		}
+		if m.config.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", m.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowOrigin reports whether the origin may call the API, and whether it matched only "*"
+func (m *CORS) allowOrigin(origin string) (bool, bool) {
+	origin = strings.ToLower(origin)
+	wildcard := false
+	for _, allowed := range m.config.AllowedOrigins {
+		switch {
+		case allowed == origin:
+			return true, false
+		case allowed == "*":
+			wildcard = true
+		case strings.Contains(allowed, "://*."):
+			// https://*.example.com matches https://app.example.com, not https://example.com
+			scheme, domain, _ := strings.Cut(allowed, "://*")
+			if strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, domain) &&
+				len(origin) > len(scheme)+3+len(domain) {
+				return true, false
+			}
+		}
+	}
+	return wildcard, wildcard
+}
+
+func containsOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
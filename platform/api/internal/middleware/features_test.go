@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFeatureGateRequestLicenses(t *testing.T) {
+	jobLicense := func(c *gin.Context) (string, error) {
+		if c.Param("id") == "job-1" {
+			return "lic-job", nil
+		}
+		return "", nil
+	}
+	failing := func(c *gin.Context) (string, error) { return "", errors.New("db down") }
+
+	tests := []struct {
+		name    string
+		route   string
+		target  string
+		header  string
+		body    string
+		apiKey  string
+		user    string
+		resolve []LicenseResolver
+		want    []string
+		wantErr bool
+	}{
+		{"nothing named", "/datalake/stats", "/datalake/stats", "", "", "", "", nil, nil, false},
+		{"header", "/datalake/stats", "/datalake/stats", "lic-a", "", "", "", nil, []string{"lic-a"}, false},
+		{"path", "/config/:license_id", "/config/lic-a", "", "", "", "", nil, []string{"lic-a"}, false},
+		{"query", "/datalake/jobs", "/datalake/jobs?license_id=lic-a", "", "", "", "", nil, []string{"lic-a"}, false},
+		{"body", "/datalake/query", "/datalake/query", "", `{"license_id":"lic-a"}`, "", "", nil, []string{"lic-a"}, false},
+		{"header and body differ", "/datalake/query", "/datalake/query", "lic-a", `{"license_id":"lic-b"}`, "", "", nil, []string{"lic-a", "lic-b"}, false},
+		{"duplicates collapse", "/datalake/query", "/datalake/query?license_id=lic-a", "lic-a", `{"license_id":"lic-a"}`, "", "", nil, []string{"lic-a"}, false},
+		{"api key wins", "/datalake/query", "/datalake/query", "", `{"license_id":"lic-b"}`, "lic-key", "", nil, []string{"lic-key"}, false},
+		{"user session wins", "/datalake/stats", "/datalake/stats", "lic-a", "", "", "lic-user", nil, []string{"lic-user"}, false},
+		{"resolver", "/jobs/:id", "/jobs/job-1", "", "", "", "", []LicenseResolver{jobLicense}, []string{"lic-job"}, false},
+		{"resolver finds nothing", "/jobs/:id", "/jobs/job-2", "", "", "", "", []LicenseResolver{jobLicense}, nil, false},
+		{"resolver not needed", "/jobs/:id", "/jobs/job-1", "lic-a", "", "", "", []LicenseResolver{failing}, []string{"lic-a"}, false},
+		{"resolver error", "/jobs/:id", "/jobs/job-1", "", "", "", "", []LicenseResolver{failing}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewFeatureGate(nil)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.apiKey != "" {
+					c.Set(ContextAPIKeyLicense, tt.apiKey)
+				}
+				if tt.user != "" {
+					c.Set(ContextUserLicense, tt.user)
+				}
+			})
+			router.POST(tt.route, func(c *gin.Context) {
+				got, err := g.requestLicenses(c, tt.resolve)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("requestLicenses() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if len(got) == 0 {
+					got = nil
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("requestLicenses() = %v, want %v", got, tt.want)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.header != "" {
+				req.Header.Set("X-License-ID", tt.header)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestFeatureGateWithoutLicenseService(t *testing.T) {
+	router := gin.New()
+	router.GET("/", NewFeatureGate(nil).Require("data_lake"), func(c *gin.Context) {
+		t.Error("request passed the gate without a license service")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-License-ID", "lic-a")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,256 @@
+// Idempotency Key Middleware
+
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a create request safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyInFlightTimeout is how long a claimed key without a stored response blocks
+	// retries before it is treated as abandoned (e.g. the server restarted mid-request)
+	idempotencyInFlightTimeout = 5 * time.Minute
+
+	// idempotencyPruneInterval bounds how often expired keys are swept
+	idempotencyPruneInterval = time.Hour
+)
+
+// Idempotency replays the stored response of a create request when it is retried with the same
+// Idempotency-Key. Keys are scoped to the caller, license, method and route, and expire after the
+// TTL. Stored responses are kept in plaintext, so routes that return secrets must not use it.
+type Idempotency struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewIdempotency creates idempotency middleware that remembers responses for ttl
+func NewIdempotency(db *sql.DB, ttl time.Duration) *Idempotency {
+	return &Idempotency{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// responseRecorder copies everything written to the client so it can be stored for replay
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Handler returns the middleware. Requests without an Idempotency-Key header pass through unchanged.
+func (i *Idempotency) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || i.db == nil {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+		scope := strings.Join([]string{idempotencyPrincipal(c), idempotencyLicense(c, body), c.Request.Method, c.FullPath()}, ":")
+
+		i.prune()
+
+		claimed, err := i.claim(scope, key, requestHash)
+		if err != nil {
+			log.Errorf("Failed to claim idempotency key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+			return
+		}
+		if !claimed {
+			i.replay(c, scope, key, requestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		stored := false
+		defer func() {
+			// Server errors and panics release the key so the client's retry is processed again
+			if !stored {
+				if _, err := i.db.Exec("DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2", scope, key); err != nil {
+					log.Errorf("Failed to release idempotency key: %v", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		_, err = i.db.Exec(`
+			UPDATE idempotency_keys
+			SET status_code = $1, content_type = $2, response_body = $3, completed_at = NOW()
+			WHERE scope = $4 AND idempotency_key = $5
+		`, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes(), scope, key)
+		if err != nil {
+			log.Errorf("Failed to store idempotent response: %v", err)
+			return
+		}
+		stored = true
+	}
+}
+
+// claim records the key as in flight. It returns false when the key is already taken by a
+// live request; expired and abandoned claims are replaced.
+func (i *Idempotency) claim(scope, key, requestHash string) (bool, error) {
+	_, err := i.db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2
+		  AND (created_at < $3 OR (status_code IS NULL AND created_at < $4))
+	`, scope, key, time.Now().Add(-i.ttl), time.Now().Add(-idempotencyInFlightTimeout))
+	if err != nil {
+		return false, err
+	}
+
+	result, err := i.db.Exec(`
+		INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (scope, idempotency_key) DO NOTHING
+	`, scope, key, requestHash)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, _ := result.RowsAffected()
+	return inserted == 1, nil
+}
+
+// replay answers a retried request from the stored response
+func (i *Idempotency) replay(c *gin.Context, scope, key, requestHash string) {
+	var storedHash string
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+	var body []byte
+	err := i.db.QueryRow(`
+		SELECT request_hash, status_code, content_type, response_body
+		FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2
+	`, scope, key).Scan(&storedHash, &statusCode, &contentType, &body)
+	if err == sql.ErrNoRows {
+		// Released between the claim and the lookup; let the client retry
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is being processed, retry shortly"})
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to load idempotent response: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process Idempotency-Key"})
+		return
+	}
+
+	if storedHash != requestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	}
+	if !statusCode.Valid {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is being processed, retry shortly"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(int(statusCode.Int64), contentType.String, body)
+	c.Abort()
+}
+
+// prune sweeps expired keys at most once per interval
+func (i *Idempotency) prune() {
+	i.mu.Lock()
+	if time.Since(i.lastPrune) < idempotencyPruneInterval {
+		i.mu.Unlock()
+		return
+	}
+	i.lastPrune = time.Now()
+	i.mu.Unlock()
+
+	go func() {
+		result, err := i.db.Exec("DELETE FROM idempotency_keys WHERE created_at < $1", time.Now().Add(-i.ttl))
+		if err != nil {
+			log.Warnf("Failed to prune idempotency keys: %v", err)
+			return
+		}
+		if pruned, _ := result.RowsAffected(); pruned > 0 {
+			log.Infof("Pruned %d expired idempotency keys", pruned)
+		}
+	}()
+}
+
+// idempotencyPrincipal identifies the authenticated caller, so a key can only replay a response
+// to the API key or user that made the original request
+func idempotencyPrincipal(c *gin.Context) string {
+	if id := c.GetString(ContextAPIKeyID); id != "" {
+		return "key/" + id
+	}
+	if id := c.GetString(ContextUserID); id != "" {
+		return "user/" + id
+	}
+	return ""
+}
+
+// idempotencyLicense finds the license a request acts for, from the X-License-ID header, the
+// license_id query parameter, or a license_id/tenant_id field in a JSON body
+func idempotencyLicense(c *gin.Context, body []byte) string {
+	if licenseID := c.GetHeader("X-License-ID"); licenseID != "" {
+		return licenseID
+	}
+	if licenseID := c.Query("license_id"); licenseID != "" {
+		return licenseID
+	}
+
+	var fields struct {
+		LicenseID string `json:"license_id"`
+		TenantID  string `json:"tenant_id"`
+	}
+	if json.Unmarshal(body, &fields) == nil {
+		if fields.LicenseID != "" {
+			return fields.LicenseID
+		}
+		return fields.TenantID
+	}
+	return ""
+}
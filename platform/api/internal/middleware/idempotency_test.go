@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyPrincipal(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiKey string
+		user   string
+		want   string
+	}{
+		{"api key", "key-1", "", "key/key-1"},
+		{"user", "", "user-1", "user/user-1"},
+		{"api key wins", "key-1", "user-1", "key/key-1"},
+		{"anonymous", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.apiKey != "" {
+				c.Set(ContextAPIKeyID, tt.apiKey)
+			}
+			if tt.user != "" {
+				c.Set(ContextUserID, tt.user)
+			}
+			if got := idempotencyPrincipal(c); got != tt.want {
+				t.Errorf("idempotencyPrincipal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
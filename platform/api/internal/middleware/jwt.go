@@ -0,0 +1,234 @@
+// User Session Token Middleware
+
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+const (
+	// UserTokenScheme is the Authorization scheme user session tokens are presented with
+	UserTokenScheme = "Bearer"
+
+	// UserTokenIssuer is the iss claim of every token the platform issues
+	UserTokenIssuer = "sentinel-platform"
+
+	// Context keys set for requests authenticated with a user session token
+	ContextUserID      = "user_id"
+	ContextUserEmail   = "user_email"
+	ContextUserRole    = "user_role"
+	ContextUserLicense = "user_license_id"
+
+	// userStatusCacheTTL bounds how long a user's active flag is reused before re-reading it,
+	// i.e. how long disabling a user takes to end their sessions on every API instance
+	userStatusCacheTTL = 30 * time.Second
+)
+
+// UserClaims are the claims of a platform session token
+type UserClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"` // User ID
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	LicenseID string `json:"license_id,omitempty"` // Empty for platform operators
+	Provider  string `json:"idp,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserTokens issues and verifies HS256 JWTs for dashboard users
+type UserTokens struct {
+	db     *sql.DB
+	secret []byte
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	users map[string]cachedUserStatus
+}
+
+type cachedUserStatus struct {
+	active    bool
+	fetchedAt time.Time
+}
+
+// NewUserTokens creates the session token issuer. Without a secret a random one is generated,
+// which signs everyone out whenever the API restarts.
+func NewUserTokens(db *sql.DB, secret string, ttl time.Duration) *UserTokens {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("Failed to generate session token secret: %v", err)
+		}
+		log.Warn("JWT_SECRET is not set, user sessions will not survive an API restart")
+	}
+	return &UserTokens{db: db, secret: key, ttl: ttl, users: make(map[string]cachedUserStatus)}
+}
+
+// Issue signs a session token for the user
+func (t *UserTokens) Issue(user models.AuthenticatedUser) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.ttl)
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload, err := json.Marshal(UserClaims{
+		Issuer:    UserTokenIssuer,
+		Subject:   user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		LicenseID: user.LicenseID,
+		Provider:  user.Provider,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(t.sign(signingInput)), expiresAt, nil
+}
+
+// Verify checks a session token's signature and expiry and returns its claims
+func (t *UserTokens) Verify(token string) (*UserClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, errors.New("unsupported token algorithm")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, t.sign(parts[0]+"."+parts[1])) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var claims UserClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	if claims.Issuer != UserTokenIssuer {
+		return nil, errors.New("token was not issued by this platform")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token has expired")
+	}
+	return &claims, nil
+}
+
+func (t *UserTokens) sign(signingInput string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// Handler returns the middleware for the /api/v1 group. Requests without a bearer token pass
+// through unchanged. Tokens of disabled or deleted users are refused, and users bound to a
+// license may only address that license.
+func (t *UserTokens) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, presented, found := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, UserTokenScheme) {
+			c.Next()
+			return
+		}
+
+		claims, err := t.Verify(strings.TrimSpace(presented))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid session token: " + err.Error()})
+			return
+		}
+
+		active, err := t.userActive(claims.Subject)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+			return
+		}
+		if err != nil {
+			log.Errorf("Failed to look up user %s: %v", claims.Subject, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate session token"})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User account is disabled"})
+			return
+		}
+
+		if claims.LicenseID != "" {
+			confined, err := namesOnlyLicense(c, claims.LicenseID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+				return
+			}
+			if !confined {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "User is not a member of this license"})
+				return
+			}
+			if c.GetHeader("X-License-ID") == "" {
+				c.Request.Header.Set("X-License-ID", claims.LicenseID)
+			}
+		}
+
+		c.Set(ContextUserID, claims.Subject)
+		c.Set(ContextUserEmail, claims.Email)
+		c.Set(ContextUserRole, claims.Role)
+		c.Set(ContextUserLicense, claims.LicenseID)
+
+		c.Next()
+	}
+}
+
+// userActive reports whether the user's account is enabled, cached for userStatusCacheTTL
+func (t *UserTokens) userActive(userID string) (bool, error) {
+	t.mu.Lock()
+	cached, ok := t.users[userID]
+	t.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < userStatusCacheTTL {
+		return cached.active, nil
+	}
+
+	status := cachedUserStatus{fetchedAt: time.Now()}
+	err := t.db.QueryRow(`
+		SELECT COALESCE(is_active, FALSE) FROM users WHERE id::text = $1
+	`, userID).Scan(&status.active)
+	if err != nil {
+		return false, err
+	}
+
+	t.mu.Lock()
+	t.users[userID] = status
+	t.mu.Unlock()
+
+	return status.active, nil
+}
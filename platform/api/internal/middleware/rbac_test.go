@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sentinel-enterprise/platform/api/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRolePermissionMatrix(t *testing.T) {
+	all := []string{
+		models.PermLicensesManage, models.PermAPIKeysManage, models.PermAgentsManage,
+		models.PermAgentsRespond, models.PermAgentsIsolate, models.PermDeceptionDeploy,
+		models.PermPoliciesManage, models.PermCommunityShare, models.PermCommunityModerate,
+		models.PermCasesManage, models.PermTenantsQuery,
+	}
+	tests := []struct {
+		role    string
+		granted []string
+	}{
+		{models.RoleAdmin, all},
+		{models.RoleAnalyst, []string{models.PermPoliciesManage, models.PermCommunityShare, models.PermCasesManage}},
+		{models.RoleResponder, []string{models.PermAgentsRespond, models.PermAgentsIsolate, models.PermDeceptionDeploy, models.PermCasesManage}},
+		{models.RoleReadOnly, nil},
+		{models.RoleViewer, nil},
+		{models.RoleMSSP, []string{models.PermTenantsQuery}},
+		{"unknown", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		granted := map[string]bool{}
+		for _, p := range tt.granted {
+			granted[p] = true
+		}
+		for _, p := range all {
+			if got := models.RoleHasPermission(tt.role, p); got != granted[p] {
+				t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", tt.role, p, got, granted[p])
+			}
+		}
+	}
+}
+
+func TestRBACRequire(t *testing.T) {
+	const adminToken = "s3cret"
+	tests := []struct {
+		name          string
+		anonymousRole string
+		apiKeyRole    string
+		userRole      string
+		adminHeader   string
+		permission    string
+		want          int
+	}{
+		{"anonymous denied by default", "none", "", "", "", models.PermCasesManage, http.StatusUnauthorized},
+		{"anonymous denied with empty role", "", "", "", "", models.PermCasesManage, http.StatusUnauthorized},
+		{"unknown anonymous role denied", "superuser", "", "", "", models.PermCasesManage, http.StatusUnauthorized},
+		{"anonymous opt-in role applies", models.RoleAnalyst, "", "", "", models.PermCasesManage, http.StatusOK},
+		{"anonymous opt-in role is limited", models.RoleAnalyst, "", "", "", models.PermLicensesManage, http.StatusForbidden},
+		{"admin token", "none", "", "", adminToken, models.PermLicensesManage, http.StatusOK},
+		{"wrong admin token", "none", "", "", "guess", models.PermLicensesManage, http.StatusUnauthorized},
+		{"read-only key", "none", models.RoleReadOnly, "", "", models.PermCasesManage, http.StatusForbidden},
+		{"key role wins over admin token", "none", models.RoleReadOnly, "", adminToken, models.PermLicensesManage, http.StatusForbidden},
+		{"responder user may isolate", "none", "", models.RoleResponder, "", models.PermAgentsIsolate, http.StatusOK},
+		{"analyst user may not isolate", "none", "", models.RoleAnalyst, "", models.PermAgentsIsolate, http.StatusForbidden},
+		{"analyst user may not moderate", "none", "", models.RoleAnalyst, "", models.PermCommunityModerate, http.StatusForbidden},
+		{"legacy viewer user", "none", "", models.RoleViewer, "", models.PermCasesManage, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbac := NewRBAC(adminToken, tt.anonymousRole)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.apiKeyRole != "" {
+					c.Set(ContextAPIKeyRole, tt.apiKeyRole)
+				}
+				if tt.userRole != "" {
+					c.Set(ContextUserRole, tt.userRole)
+				}
+			})
+			router.POST("/", rbac.Require(tt.permission), func(c *gin.Context) {
+				if !HasPermission(c, tt.permission) {
+					t.Errorf("HasPermission(%q) = false after Require passed", tt.permission)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.adminHeader != "" {
+				req.Header.Set(AdminTokenHeader, tt.adminHeader)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPermissionWithoutRBAC(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if HasPermission(c, models.PermAgentsIsolate) {
+		t.Error("HasPermission without a resolved role = true, want false")
+	}
+}
+
+func TestRBACRequirePlatform(t *testing.T) {
+	const adminToken = "s3cret"
+	tests := []struct {
+		name        string
+		keyLicense  string
+		userLicense string
+		role        string
+		adminHeader string
+		want        int
+	}{
+		{"admin token", "", "", "", adminToken, http.StatusOK},
+		{"platform admin user", "", "", models.RoleAdmin, "", http.StatusOK},
+		{"platform analyst user", "", "", models.RoleAnalyst, "", http.StatusForbidden},
+		{"license admin key", "lic-a", "", models.RoleAdmin, "", http.StatusForbidden},
+		{"license admin user", "", "lic-a", models.RoleAdmin, "", http.StatusForbidden},
+		{"license admin key with admin token", "lic-a", "", models.RoleAdmin, adminToken, http.StatusForbidden},
+		{"anonymous", "", "", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbac := NewRBAC(adminToken, "none")
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.keyLicense != "" {
+					c.Set(ContextAPIKeyLicense, tt.keyLicense)
+					c.Set(ContextAPIKeyRole, tt.role)
+				} else if tt.role != "" {
+					c.Set(ContextUserRole, tt.role)
+					c.Set(ContextUserLicense, tt.userLicense)
+				}
+			})
+			router.POST("/", rbac.RequirePlatform(models.PermLicensesManage), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.adminHeader != "" {
+				req.Header.Set(AdminTokenHeader, tt.adminHeader)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
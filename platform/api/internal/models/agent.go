@@ -20,8 +20,11 @@ type Agent struct {
 	MemoryUsageMB *int                   `json:"memory_usage_mb,omitempty"`
 	EventsSent    int64                  `json:"events_sent"`
 	Config        map[string]interface{} `json:"config,omitempty"`
+	Groups        []string               `json:"groups"` // Targeting groups for DLP policies
 	CreatedAt     time.Time              `json:"created_at"`
 	UpdatedAt     time.Time              `json:"updated_at"`
+	DeletedAt     *time.Time             `json:"deleted_at,omitempty"` // Set while soft-deleted
+	Version       int                    `json:"version"`              // Incremented on every edit; sent as the ETag
 }
 
 // AgentRegistrationRequest is sent when an agent first registers
@@ -44,6 +47,7 @@ type UpdateAgentRequest struct {
 	Status        *string  `json:"status"`
 	CPUUsage      *float64 `json:"cpu_usage"`
 	MemoryUsageMB *int     `json:"memory_usage_mb"`
+	Groups        []string `json:"groups"` // Replaces the agent's groups when set
 }
 
 // UpdateAgentConfigRequest updates agent configuration
@@ -58,6 +62,8 @@ type AgentHeartbeat struct {
 	MemoryUsageMB int      `json:"memory_usage_mb"`
 	EventsSent    int64    `json:"events_sent"`
 	Status        string   `json:"status"`
+	AgentVersion  string   `json:"agent_version"` // Updated when reported, e.g. after a self-update
+	Arch          string   `json:"arch"`          // CPU architecture used to select update packages (default amd64)
 }
 
 // AgentHealthResponse provides health metrics
@@ -70,6 +76,8 @@ type AgentHealthResponse struct {
 	Uptime        int64      `json:"uptime_seconds"`
 	IsHealthy     bool       `json:"is_healthy"`
 	Issues        []string   `json:"issues,omitempty"`
+	AgentVersion  string     `json:"agent_version,omitempty"`
+	Outdated      bool       `json:"outdated"` // Below the configured minimum agent version
 }
 
 // AgentListResponse wraps agent list with pagination
@@ -79,3 +87,145 @@ type AgentListResponse struct {
 	Page   int     `json:"page"`
 	Limit  int     `json:"limit"`
 }
+
+// AgentVersionCount is the number of agents running one version
+type AgentVersionCount struct {
+	Version string `json:"version"`
+	Count   int    `json:"count"`
+}
+
+// OutdatedAgent is an agent running a version below the minimum
+type OutdatedAgent struct {
+	ID           string     `json:"id"`
+	AgentID      string     `json:"agent_id"`
+	Hostname     string     `json:"hostname"`
+	AgentVersion string     `json:"agent_version"`
+	Status       string     `json:"status"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+}
+
+// AgentVersionReport is the fleet version distribution for a license
+type AgentVersionReport struct {
+	LicenseID      string              `json:"license_id"`
+	TotalAgents    int                 `json:"total_agents"`
+	Versions       []AgentVersionCount `json:"versions"` // Newest first
+	MinimumVersion string              `json:"minimum_version,omitempty"`
+	Outdated       []OutdatedAgent     `json:"outdated"`
+	OutdatedCount  int                 `json:"outdated_count"`
+}
+
+// AgentUpdatePackage is a signed agent build offered to agents through the heartbeat
+type AgentUpdatePackage struct {
+	ID                string    `json:"id"`
+	Version           string    `json:"version"`
+	OSType            string    `json:"os_type"`
+	Arch              string    `json:"arch"`
+	DownloadURL       string    `json:"download_url"`
+	SHA256            string    `json:"sha256"`
+	Signature         string    `json:"signature"` // Base64 Ed25519 signature of the SHA-256 digest
+	SizeBytes         int64     `json:"size_bytes,omitempty"`
+	ReleaseNotes      string    `json:"release_notes,omitempty"`
+	RolloutPercentage int       `json:"rollout_percentage"` // Share of eligible agents offered the update
+	RolloutGroups     []string  `json:"rollout_groups"`     // Restricts the rollout to these agent groups when set
+	IsActive          bool      `json:"is_active"`
+	PublishedBy       string    `json:"published_by,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// PublishAgentUpdateRequest publishes a new agent update package
+type PublishAgentUpdateRequest struct {
+	Version           string   `json:"version" binding:"required"`
+	OSType            string   `json:"os_type" binding:"required"`
+	Arch              string   `json:"arch"`
+	DownloadURL       string   `json:"download_url" binding:"required,url"`
+	SHA256            string   `json:"sha256" binding:"required,len=64,hexadecimal"`
+	Signature         string   `json:"signature" binding:"required"`
+	SizeBytes         int64    `json:"size_bytes"`
+	ReleaseNotes      string   `json:"release_notes"`
+	RolloutPercentage int      `json:"rollout_percentage" binding:"min=0,max=100"`
+	RolloutGroups     []string `json:"rollout_groups"`
+	PublishedBy       string   `json:"published_by"`
+}
+
+// UpdateAgentRolloutRequest adjusts the staged rollout of a package
+type UpdateAgentRolloutRequest struct {
+	RolloutPercentage *int      `json:"rollout_percentage" binding:"omitempty,min=0,max=100"`
+	RolloutGroups     *[]string `json:"rollout_groups"`
+	IsActive          *bool     `json:"is_active"`
+}
+
+// AgentUpdateInstruction tells an agent to install a package, returned in the heartbeat response
+type AgentUpdateInstruction struct {
+	Version     string `json:"version"`
+	DownloadURL string `json:"download_url"`
+	SHA256      string `json:"sha256"`
+	Signature   string `json:"signature"`
+	SizeBytes   int64  `json:"size_bytes,omitempty"`
+}
+
+// AgentConfigSchemaVersion is the agent configuration schema the API validates against
+const AgentConfigSchemaVersion = 1
+
+// AgentConfig is version 1 of the agent configuration schema. Omitted settings take the
+// defaults from DefaultAgentConfig.
+type AgentConfig struct {
+	SchemaVersion            int                    `json:"schema_version"`
+	Collectors               *AgentCollectorsConfig `json:"collectors,omitempty"`
+	SamplingRates            map[string]float64     `json:"sampling_rates,omitempty" binding:"omitempty,dive,gte=0,lte=1"` // Share of events kept, by event type
+	DLPEnabled               *bool                  `json:"dlp_enabled,omitempty"`
+	DLPPolicyIDs             []string               `json:"dlp_policy_ids,omitempty" binding:"omitempty,max=100,dive,uuid"` // Policies pinned in addition to group targeting
+	HeartbeatIntervalSeconds int                    `json:"heartbeat_interval_seconds,omitempty" binding:"omitempty,min=10,max=3600"`
+	BatchSize                int                    `json:"batch_size,omitempty" binding:"omitempty,min=1,max=10000"`
+	MaxBufferSize            int                    `json:"max_buffer_size,omitempty" binding:"omitempty,min=100,max=1000000"`
+	LogLevel                 string                 `json:"log_level,omitempty" binding:"omitempty,oneof=error warn info debug trace"`
+}
+
+// AgentCollectorsConfig enables or disables each telemetry collector
+type AgentCollectorsConfig struct {
+	Process        *bool `json:"process,omitempty"`
+	File           *bool `json:"file,omitempty"`
+	Network        *bool `json:"network,omitempty"`
+	Registry       *bool `json:"registry,omitempty"` // Windows only
+	Authentication *bool `json:"authentication,omitempty"`
+}
+
+// DefaultAgentConfig returns the configuration an agent runs with when nothing is overridden
+func DefaultAgentConfig() AgentConfig {
+	enabled := func() *bool { v := true; return &v }
+	return AgentConfig{
+		SchemaVersion: AgentConfigSchemaVersion,
+		Collectors: &AgentCollectorsConfig{
+			Process:        enabled(),
+			File:           enabled(),
+			Network:        enabled(),
+			Registry:       enabled(),
+			Authentication: enabled(),
+		},
+		SamplingRates:            map[string]float64{},
+		DLPEnabled:               enabled(),
+		DLPPolicyIDs:             []string{},
+		HeartbeatIntervalSeconds: 60,
+		BatchSize:                100,
+		MaxBufferSize:            10000,
+		LogLevel:                 "info",
+	}
+}
+
+// AgentConfigChange is one difference between two agent configurations
+type AgentConfigChange struct {
+	Path   string      `json:"path"`   // Dotted path, e.g. collectors.network
+	Change string      `json:"change"` // added, removed, changed
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// AgentConfigPreview shows what applying a config would change, without applying it
+type AgentConfigPreview struct {
+	AgentID         string                 `json:"agent_id"`
+	CurrentVersion  int                    `json:"current_version"` // Send as If-Match when applying
+	Config          map[string]interface{} `json:"config"`          // The proposed config as it would be stored
+	EffectiveConfig *AgentConfig           `json:"effective_config"`
+	Changes         []AgentConfigChange    `json:"changes"` // Differences in the effective config
+	Warnings        []string               `json:"warnings"`
+}
@@ -38,6 +38,32 @@ type GenerateSummaryRequest struct {
 	IncludeMITRE  bool                   `json:"include_mitre"`
 	CustomPrompt  string                 `json:"custom_prompt,omitempty"`
 	Context       map[string]interface{} `json:"context,omitempty"`
+	Sampling      *AISamplingOptions     `json:"sampling,omitempty"` // How events are reduced to fit the model's context
+}
+
+// Event sampling strategies for AI analysis
+const (
+	AISamplingSeverity       = "severity"       // Most severe events first (default)
+	AISamplingRepresentative = "representative" // Spread across event types and hosts
+	AISamplingChronological  = "chronological"  // Evenly spaced over the time range
+)
+
+// AISamplingOptions controls how fetched events are reduced before prompting
+type AISamplingOptions struct {
+	Strategy         string `json:"strategy,omitempty"`
+	MaxEvents        int    `json:"max_events,omitempty"`        // Events included in full; default 200
+	SummarizeRepeats *bool  `json:"summarize_repeats,omitempty"` // Collapse repetitive events into counts; default true
+	MaxFieldLength   int    `json:"max_field_length,omitempty"`  // Longer payload values are truncated; default 256
+}
+
+// AIEventSamplingStats reports how the analysed events were reduced
+type AIEventSamplingStats struct {
+	Strategy         string `json:"strategy"`
+	EventsFetched    int    `json:"events_fetched"`
+	EventsIncluded   int    `json:"events_included"`   // Sent to the model in full
+	EventsSummarized int    `json:"events_summarized"` // Represented by repeated-activity groups
+	EventsOmitted    int    `json:"events_omitted"`    // Only counted by event type
+	RepeatGroups     int    `json:"repeat_groups"`
 }
 
 // ThreatSummary represents the AI-generated analysis
@@ -59,6 +85,9 @@ type ThreatSummary struct {
 	GeneratedAt      time.Time              `json:"generated_at"`
 	TokensUsed       int                    `json:"tokens_used,omitempty"`
 	ProcessingTimeMs int64                  `json:"processing_time_ms"`
+	EventSampling    *AIEventSamplingStats  `json:"event_sampling,omitempty"`
+	PromptTemplate   string                 `json:"prompt_template,omitempty"` // Tenant template used, by its analysis_type key
+	Redactions       map[string]int         `json:"redactions,omitempty"`      // Values masked by guardrails, by field or detector
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
 }
 
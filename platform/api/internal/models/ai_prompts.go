@@ -0,0 +1,71 @@
+// AI Prompt Models
+// Per-license prompt templates and the guardrails applied before events are sent to an LLM
+
+package models
+
+import "time"
+
+// AnalysisTypes are the analysis types a prompt template can be written for
+var AnalysisTypes = []AnalysisType{
+	AnalysisIncidentSummary, AnalysisAttackChain, AnalysisThreatReport, AnalysisRemediationPlan,
+	AnalysisRootCause, AnalysisRiskAssessment, AnalysisTrendAnalysis,
+}
+
+// AIPromptDefault is the template key used for analysis types without a template of their own
+const AIPromptDefault = "default"
+
+// AIPromptVariables are the {{name}} placeholders a prompt template may use
+var AIPromptVariables = map[string]string{
+	"analysis_type":     "The requested analysis type, e.g. incident_summary",
+	"events":            "The sampled events, repeated activity and omitted counts (required)",
+	"events_fetched":    "Number of events matching the request",
+	"events_included":   "Number of events shown in full",
+	"events_summarized": "Number of events summarized as repeated activity",
+	"events_omitted":    "Number of events only counted by type",
+	"time_range":        "First and last event timestamp",
+	"instructions":      "The built-in instructions for the analysis type",
+	"custom_prompt":     "The request's custom_prompt; appended as additional context when not referenced",
+}
+
+// AIPromptTemplate replaces the built-in prompt of one analysis type for a license
+type AIPromptTemplate struct {
+	LicenseID    string    `json:"license_id"`
+	AnalysisType string    `json:"analysis_type"`           // An AnalysisType or AIPromptDefault
+	SystemPrompt string    `json:"system_prompt,omitempty"` // Empty keeps the built-in system prompt
+	Template     string    `json:"template"`
+	UpdatedBy    string    `json:"updated_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AIPromptTemplateRequest is the request body for setting a prompt template
+type AIPromptTemplateRequest struct {
+	LicenseID    string `json:"license_id" binding:"required"`
+	SystemPrompt string `json:"system_prompt" binding:"max=4000"`
+	Template     string `json:"template" binding:"required,max=16000"`
+	UpdatedBy    string `json:"updated_by"`
+}
+
+// AIGuardrails limit what a license's analyses send to the LLM. Field redaction happens while
+// events are rendered; detectors and forbidden patterns then run over the complete prompt.
+type AIGuardrails struct {
+	LicenseID         string    `json:"license_id"`
+	MaxEvents         int       `json:"max_events"`          // Caps events shown in full; 0 keeps the request's sampling
+	AllowCustomPrompt bool      `json:"allow_custom_prompt"` // Whether requests may add a custom_prompt
+	RedactFields      []string  `json:"redact_fields"`       // Event fields (host, user, path, process, dst_ip) or payload keys to mask
+	RedactDetectors   []string  `json:"redact_detectors"`    // Built-in DLP detectors whose matches are masked
+	ForbiddenPatterns []string  `json:"forbidden_patterns"`  // RE2 patterns; a prompt still matching one is not sent
+	UpdatedBy         string    `json:"updated_by,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at,omitempty"`
+}
+
+// AIGuardrailsRequest is the request body for setting a license's guardrails
+type AIGuardrailsRequest struct {
+	LicenseID         string   `json:"license_id" binding:"required"`
+	MaxEvents         int      `json:"max_events" binding:"min=0,max=1000"`
+	AllowCustomPrompt *bool    `json:"allow_custom_prompt"` // Defaults to true
+	RedactFields      []string `json:"redact_fields" binding:"max=100,dive,required,max=128"`
+	RedactDetectors   []string `json:"redact_detectors" binding:"max=50,dive,required"`
+	ForbiddenPatterns []string `json:"forbidden_patterns" binding:"max=50,dive,required,max=1024"`
+	UpdatedBy         string   `json:"updated_by"`
+}
@@ -0,0 +1,84 @@
+// Alert Rule Action Models
+// Actions an alert rule runs when it fires, and the audit trail of their execution
+
+package models
+
+import "time"
+
+// Alert rule action types
+const (
+	AlertActionNotify      = "notify"       // Send the alert to notification channels
+	AlertActionCreateCase  = "create_case"  // Open an incident case with the alert attached
+	AlertActionIsolateHost = "isolate_host" // Queue a network isolation command for the alert's host
+	AlertActionRunPlaybook = "run_playbook" // Run a deception playbook
+)
+
+// Alert action execution outcomes
+const (
+	AlertActionSucceeded = "succeeded"
+	AlertActionFailed    = "failed"
+	AlertActionSkipped   = "skipped"
+)
+
+// MaxAlertRuleActions bounds the actions one rule may run
+const MaxAlertRuleActions = 10
+
+// AlertAction is one entry of an alert rule's actions. Parameters by type:
+//
+//	notify:       channel_ids ([]string, default every enabled channel), priority
+//	create_case:  title, severity (default the alert's), owner
+//	isolate_host: allow_ips ([]string of IPs or CIDRs the host may still reach)
+//	run_playbook: playbook_id (required)
+type AlertAction struct {
+	Type          string                 `json:"type"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+	StopOnFailure bool                   `json:"stop_on_failure,omitempty"` // Skip the rule's remaining actions if this one fails
+}
+
+// AlertActionExecution is the audit record of one action run for a fired alert
+type AlertActionExecution struct {
+	ID          string                 `json:"id"`
+	AlertID     string                 `json:"alert_id"`
+	RuleID      string                 `json:"rule_id"`
+	ActionIndex int                    `json:"action_index"`
+	ActionType  string                 `json:"action_type"`
+	Status      string                 `json:"status"`
+	Result      map[string]interface{} `json:"result,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	ExecutedAt  time.Time              `json:"executed_at"`
+}
+
+// Agent command types
+const (
+	AgentCommandIsolate = "isolate"  // Cut the host off the network except for allow_ips
+	AgentCommandBlockIP = "block_ip" // Block traffic to and from one address
+	AgentCommandRelease = "release"  // Lift an isolation, restoring network access
+)
+
+// Agent command statuses
+const (
+	AgentCommandPending   = "pending"
+	AgentCommandDelivered = "delivered"
+)
+
+// AgentCommand is an instruction queued for an agent and delivered in its next heartbeat response
+type AgentCommand struct {
+	ID          string                 `json:"id"`
+	CommandType string                 `json:"command_type"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Source      string                 `json:"source"` // What queued it, e.g. alert_rule:<id>
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// IsolateAgentRequest is the request body for isolating a host from the network
+type IsolateAgentRequest struct {
+	AllowIPs    []string `json:"allow_ips,omitempty"` // Addresses the host may still reach, e.g. the platform
+	Reason      string   `json:"reason" binding:"max=1000"`
+	RequestedBy string   `json:"requested_by"`
+}
+
+// ReleaseAgentRequest is the optional request body for lifting an isolation
+type ReleaseAgentRequest struct {
+	Reason      string `json:"reason" binding:"max=1000"`
+	RequestedBy string `json:"requested_by"`
+}
@@ -0,0 +1,129 @@
+// Alert Instance Models
+// Fired alerts, their grouping for triage, and their lifecycle, assignment and notes
+
+package models
+
+import "time"
+
+// Alert instance statuses. An alert is raised new and moves new -> acknowledged -> resolved or
+// suppressed; reopening returns it to new.
+const (
+	AlertStatusNew          = "new"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+	AlertStatusSuppressed   = "suppressed" // Closed as noise, optionally silencing the rule for its entity
+)
+
+// AlertStatuses are the statuses an alert instance can have
+var AlertStatuses = []string{AlertStatusNew, AlertStatusAcknowledged, AlertStatusResolved, AlertStatusSuppressed}
+
+// AlertResolutions record why a resolved or suppressed alert was closed
+var AlertResolutions = []string{"true_positive", "false_positive", "benign"}
+
+// Alert lifecycle actions recorded in an alert's history
+const (
+	AlertActionRaised      = "raised"
+	AlertActionAcknowledge = "acknowledge"
+	AlertActionResolve     = "resolve"
+	AlertActionSuppress    = "suppress"
+	AlertActionReopen      = "reopen"
+	AlertActionAssign      = "assign"
+)
+
+// Alert grouping dimensions. The agent, host, ip and user dimensions match the correlation
+// entity types.
+const (
+	AlertGroupRule        = "rule"
+	AlertGroupEntity      = "entity"      // The alert's primary entity
+	AlertGroupCorrelation = "correlation" // The case an alert was correlated into
+)
+
+// AlertInstance is a fired alert
+type AlertInstance struct {
+	ID              string                 `json:"id"`
+	RuleID          string                 `json:"rule_id,omitempty"`
+	RuleName        string                 `json:"rule_name,omitempty"`
+	AgentID         string                 `json:"agent_id,omitempty"`
+	Severity        string                 `json:"severity"`
+	Message         string                 `json:"message"`
+	EntityType      string                 `json:"entity_type,omitempty"` // One of SuppressionEntityTypes, e.g. hostname
+	EntityValue     string                 `json:"entity_value,omitempty"`
+	MatchedEventIDs []string               `json:"matched_event_ids"` // Events the alert fired on
+	Details         map[string]interface{} `json:"details,omitempty"`
+	Status          string                 `json:"status"`
+	Resolution      string                 `json:"resolution,omitempty"`
+	AssignedTo      string                 `json:"assigned_to,omitempty"` // User ID
+	AssignedAt      *time.Time             `json:"assigned_at,omitempty"`
+	CaseID          string                 `json:"case_id,omitempty"` // Case the alert was correlated or added into
+	SuppressionID   string                 `json:"suppression_id,omitempty"`
+	NoteCount       int                    `json:"note_count"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+	AcknowledgedAt  *time.Time             `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy  string                 `json:"acknowledged_by,omitempty"`
+	ResolvedAt      *time.Time             `json:"resolved_at,omitempty"` // Also set when suppressed
+	ResolvedBy      string                 `json:"resolved_by,omitempty"`
+}
+
+// AlertGroup aggregates the alerts sharing the values of the requested grouping dimensions
+type AlertGroup struct {
+	Key            map[string]string `json:"key"` // Dimension -> value; empty when the alert has none
+	RuleName       string            `json:"rule_name,omitempty"`
+	Count          int64             `json:"count"`
+	Statuses       map[string]int64  `json:"statuses"`
+	Severity       string            `json:"severity"` // Highest severity in the group
+	FirstSeen      time.Time         `json:"first_seen"`
+	LatestSeen     time.Time         `json:"latest_seen"`
+	LatestMessage  string            `json:"latest_message"`
+	LatestAlertIDs []string          `json:"latest_alert_ids"` // Most recent first
+	Agents         []string          `json:"agents"`
+	Hosts          []string          `json:"hosts"`
+	Users          []string          `json:"users"`
+	IPs            []string          `json:"ips"`
+}
+
+// AlertTransitionRequest is the optional request body for acknowledging, resolving, suppressing
+// or reopening an alert
+type AlertTransitionRequest struct {
+	ChangedBy  string `json:"changed_by"`
+	Note       string `json:"note" binding:"max=4000"`
+	Resolution string `json:"resolution" binding:"omitempty,oneof=true_positive false_positive benign"` // Resolve and suppress only
+
+	// Suppress only: also silence the alert's rule for its entity, as an alert suppression
+	SuppressFuture bool       `json:"suppress_future"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // Of the created suppression; omit to suppress until removed
+}
+
+// AssignAlertRequest is the request body for assigning an alert
+type AssignAlertRequest struct {
+	AssignedTo string `json:"assigned_to"` // User ID; empty unassigns
+	ChangedBy  string `json:"changed_by"`
+}
+
+// AlertStatusChange records one lifecycle action on an alert
+type AlertStatusChange struct {
+	ID         string                 `json:"id"`
+	AlertID    string                 `json:"alert_id"`
+	Action     string                 `json:"action"`
+	FromStatus string                 `json:"from_status,omitempty"`
+	ToStatus   string                 `json:"to_status"`
+	ChangedBy  string                 `json:"changed_by,omitempty"`
+	Note       string                 `json:"note,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	ChangedAt  time.Time              `json:"changed_at"`
+}
+
+// AlertNote is an analyst note on an alert
+type AlertNote struct {
+	ID        string    `json:"id"`
+	AlertID   string    `json:"alert_id"`
+	Author    string    `json:"author,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateAlertNoteRequest is the request body for adding a note to an alert
+type CreateAlertNoteRequest struct {
+	Author string `json:"author"`
+	Body   string `json:"body" binding:"required,max=10000"`
+}
@@ -0,0 +1,55 @@
+// API Key Models
+// Long-lived, scoped credentials for integrations and service accounts
+
+package models
+
+import "time"
+
+// APIKeyResources are the API areas a key can be scoped to; each is the first path segment
+// under /api/v1. A scope is "<resource>:read", "<resource>:write" (which includes read),
+// "<resource>:*" or "*" for everything.
+var APIKeyResources = []string{
+	"agents", "ai", "alerts", "apikeys", "billing", "cases", "collaborative", "datalake",
+	"deception", "dlp", "events", "licenses", "mitre", "notifications", "reports",
+	"schedules", "search", "telemetry", "ueba", "ws",
+}
+
+// APIKey is an issued key. The secret is only returned when the key is created or rotated.
+type APIKey struct {
+	ID          string     `json:"id"`
+	LicenseID   string     `json:"license_id"`
+	Name        string     `json:"name"`
+	KeyPrefix   string     `json:"key_prefix"`
+	Scopes      []string   `json:"scopes"`
+	Role        string     `json:"role"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	RotatedFrom *string    `json:"rotated_from,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  string     `json:"last_used_ip,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest is the request body for issuing an API key
+type CreateAPIKeyRequest struct {
+	LicenseID     string   `json:"license_id" binding:"required"`
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	Role          string   `json:"role,omitempty"`            // admin, analyst, responder or read_only (default)
+	ExpiresInDays int      `json:"expires_in_days,omitempty"` // 0 never expires
+	CreatedBy     string   `json:"created_by"`
+}
+
+// RotateAPIKeyRequest is the request body for rotating an API key
+type RotateAPIKeyRequest struct {
+	// GraceMinutes keeps the old key valid while clients switch over; 0 revokes it immediately
+	GraceMinutes int `json:"grace_minutes"`
+}
+
+// APIKeySecretResponse returns a newly issued key together with its secret
+type APIKeySecretResponse struct {
+	APIKey  APIKey `json:"api_key"`
+	Key     string `json:"key"` // Shown once; only its hash is stored
+	Message string `json:"message"`
+}
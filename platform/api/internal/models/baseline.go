@@ -0,0 +1,63 @@
+// Event Volume Baseline Models
+// Learned per-agent event rates and the anomalies detected against them
+
+package models
+
+import "time"
+
+// Volume anomaly kinds
+const (
+	AnomalySpike  = "spike"  // Far more events of a type than usual for this hour
+	AnomalyDrop   = "drop"   // Far fewer events of a type than usual for this hour
+	AnomalySilent = "silent" // No events at all from an agent that is normally active
+)
+
+// Volume anomaly statuses
+const (
+	AnomalyStatusOpen         = "open"
+	AnomalyStatusAcknowledged = "acknowledged"
+)
+
+// AnomalyAllEventTypes is the event type recorded for silent-agent anomalies
+const AnomalyAllEventTypes = "all"
+
+// ScheduledJobBaseline is the scheduler job type that rebuilds baselines and detects anomalies
+const ScheduledJobBaseline = "baseline"
+
+// EventBaseline is an agent's normal hourly event count for one event type and hour of day (UTC)
+type EventBaseline struct {
+	LicenseID string    `json:"license_id"`
+	AgentID   string    `json:"agent_id"`
+	EventType string    `json:"event_type"`
+	HourOfDay int       `json:"hour_of_day"`
+	Mean      float64   `json:"mean"`
+	Stddev    float64   `json:"stddev"`
+	Samples   int       `json:"samples"` // Days of history behind the statistics
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// VolumeAnomaly is an hour in which an agent's event volume deviated from its baseline
+type VolumeAnomaly struct {
+	ID        string    `json:"id"`
+	LicenseID string    `json:"license_id"`
+	AgentID   string    `json:"agent_id"`
+	EventType string    `json:"event_type"`
+	Kind      string    `json:"kind"`
+	HourStart time.Time `json:"hour_start"`
+	Observed  int64     `json:"observed"`
+	Expected  float64   `json:"expected"`
+	Stddev    float64   `json:"stddev"`
+	ZScore    float64   `json:"z_score"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BaselineRunResult summarises a single pass of the baseline engine
+type BaselineRunResult struct {
+	BaselinesUpdated  int       `json:"baselines_updated"`
+	HourEvaluated     time.Time `json:"hour_evaluated"`
+	AnomaliesDetected int       `json:"anomalies_detected"`
+	Notifications     int       `json:"notifications"`
+	StartedAt         time.Time `json:"started_at"`
+	DurationMs        int64     `json:"duration_ms"`
+}
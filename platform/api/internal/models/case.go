@@ -0,0 +1,104 @@
+// Incident Case Management Models
+// Groups related alerts, events, IOCs, AI analyses and deception events into cases
+
+package models
+
+import "time"
+
+// CaseStatus represents the lifecycle state of a case
+type CaseStatus string
+
+const (
+	CaseStatusOpen          CaseStatus = "open"
+	CaseStatusInvestigating CaseStatus = "investigating"
+	CaseStatusContained     CaseStatus = "contained"
+	CaseStatusClosed        CaseStatus = "closed"
+)
+
+// CaseItemType identifies what kind of object is attached to a case
+type CaseItemType string
+
+const (
+	CaseItemEvent          CaseItemType = "event"           // ClickHouse telemetry event
+	CaseItemAlert          CaseItemType = "alert"           // alert_instances
+	CaseItemIOC            CaseItemType = "ioc"             // shared_iocs
+	CaseItemAIAnalysis     CaseItemType = "ai_analysis"     // ai_analysis_history
+	CaseItemDeceptionEvent CaseItemType = "deception_event" // deception_events
+)
+
+// Case represents an incident bundling related alerts, events and notes
+type Case struct {
+	ID          string     `json:"id"`
+	LicenseID   string     `json:"license_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Status      CaseStatus `json:"status"`
+	Severity    string     `json:"severity"` // low, medium, high, critical
+	Owner       string     `json:"owner,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ItemCount   int        `json:"item_count"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Items       []CaseItem `json:"items,omitempty"`
+	Notes       []CaseNote `json:"notes,omitempty"`
+}
+
+// CaseItem is an alert, event, IOC, AI analysis or deception event linked to a case
+type CaseItem struct {
+	ID       string       `json:"id"`
+	CaseID   string       `json:"case_id"`
+	ItemType CaseItemType `json:"item_type"`
+	ItemID   string       `json:"item_id"`
+	Summary  string       `json:"summary,omitempty"`
+	AddedBy  string       `json:"added_by,omitempty"`
+	AddedAt  time.Time    `json:"added_at"`
+}
+
+// CaseNote is a timeline entry on a case; status and owner changes are recorded automatically
+type CaseNote struct {
+	ID        string    `json:"id"`
+	CaseID    string    `json:"case_id"`
+	NoteType  string    `json:"note_type"` // note, status_change, assignment, item_added, item_removed
+	Author    string    `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateCaseRequest is the request body for opening a case
+type CreateCaseRequest struct {
+	LicenseID   string                  `json:"license_id" binding:"required"`
+	Title       string                  `json:"title" binding:"required"`
+	Description string                  `json:"description"`
+	Severity    string                  `json:"severity" binding:"required"`
+	Owner       string                  `json:"owner"`
+	Tags        []string                `json:"tags"`
+	CreatedBy   string                  `json:"created_by"`
+	Items       []AttachCaseItemRequest `json:"items,omitempty"`
+}
+
+// UpdateCaseRequest is the request body for updating a case
+type UpdateCaseRequest struct {
+	Title       *string     `json:"title"`
+	Description *string     `json:"description"`
+	Status      *CaseStatus `json:"status"`
+	Severity    *string     `json:"severity"`
+	Owner       *string     `json:"owner"`
+	Tags        *[]string   `json:"tags"`
+	UpdatedBy   string      `json:"updated_by"`
+}
+
+// AttachCaseItemRequest links an object to a case
+type AttachCaseItemRequest struct {
+	ItemType CaseItemType `json:"item_type" binding:"required"`
+	ItemID   string       `json:"item_id" binding:"required"`
+	Summary  string       `json:"summary"`
+	AddedBy  string       `json:"added_by"`
+}
+
+// AddCaseNoteRequest adds a timeline note to a case
+type AddCaseNoteRequest struct {
+	Author  string `json:"author"`
+	Content string `json:"content" binding:"required"`
+}
@@ -64,9 +64,15 @@ type RuleVoteRequest struct {
 	VoteType  string `json:"vote_type" binding:"required"` // upvote, downvote
 }
 
+// ModerationVerifyRequest marks community content verified or removes the mark
+type ModerationVerifyRequest struct {
+	Verified   bool   `json:"verified"`
+	VerifiedBy string `json:"verified_by" binding:"required"`
+}
+
 // RuleCommentRequest adds a comment to a rule
 type RuleCommentRequest struct {
-	RuleID    string `json:"rule_id" binding:"required"`
+	RuleID    string `json:"rule_id"` // Taken from the path
 	LicenseID string `json:"license_id" binding:"required"`
 	Comment   string `json:"comment" binding:"required"`
 	Anonymous bool   `json:"anonymous"`
@@ -125,6 +131,13 @@ type PublishIOCRequest struct {
 	Anonymous   bool     `json:"anonymous"`
 }
 
+// ReportIOCRequest records a license's sighting or assessment of a shared IOC
+type ReportIOCRequest struct {
+	LicenseID  string `json:"license_id" binding:"required"`
+	ReportType string `json:"report_type" binding:"required,oneof=confirmed false_positive additional_info"`
+	Comment    string `json:"comment"`
+}
+
 // SearchIOCsRequest searches for shared IOCs
 type SearchIOCsRequest struct {
 	Query       string   `json:"query,omitempty"`
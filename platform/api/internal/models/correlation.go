@@ -0,0 +1,80 @@
+// Alert Correlation Models
+// Rules and results for grouping related alerts into incident cases
+
+package models
+
+import "time"
+
+// Correlation entity types
+const (
+	CorrelationEntityAgent = "agent"
+	CorrelationEntityHost  = "host"
+	CorrelationEntityIP    = "ip"
+	CorrelationEntityUser  = "user"
+)
+
+// CorrelationRule groups alerts sharing an entity within a time window into one case
+type CorrelationRule struct {
+	ID            string    `json:"id"`
+	LicenseID     string    `json:"license_id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	EntityType    string    `json:"entity_type"`    // agent, host, ip, user
+	WindowMinutes int       `json:"window_minutes"` // Alerts must fall within this window
+	MinAlerts     int       `json:"min_alerts"`     // Alerts needed before a case is opened
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CreateCorrelationRuleRequest is the request body for creating a correlation rule
+type CreateCorrelationRuleRequest struct {
+	LicenseID     string `json:"license_id" binding:"required"`
+	Name          string `json:"name" binding:"required"`
+	Description   string `json:"description"`
+	EntityType    string `json:"entity_type" binding:"required"`
+	WindowMinutes int    `json:"window_minutes" binding:"required,min=1"`
+	MinAlerts     int    `json:"min_alerts"`
+	Enabled       bool   `json:"enabled"`
+}
+
+// UpdateCorrelationRuleRequest is the request body for updating a correlation rule
+type UpdateCorrelationRuleRequest struct {
+	Name          *string `json:"name"`
+	Description   *string `json:"description"`
+	WindowMinutes *int    `json:"window_minutes"`
+	MinAlerts     *int    `json:"min_alerts"`
+	Enabled       *bool   `json:"enabled"`
+}
+
+// CorrelationRunResult summarises a single pass of the correlation engine
+type CorrelationRunResult struct {
+	RulesEvaluated   int       `json:"rules_evaluated"`
+	AlertsCorrelated int       `json:"alerts_correlated"`
+	CasesCreated     int       `json:"cases_created"`
+	CasesUpdated     int       `json:"cases_updated"`
+	StartedAt        time.Time `json:"started_at"`
+	DurationMs       int64     `json:"duration_ms"`
+}
+
+// CorrelationGraph links the alerts of a case to the entities they share
+type CorrelationGraph struct {
+	CaseID string      `json:"case_id"`
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+}
+
+// GraphNode is an alert or entity in a correlation graph
+type GraphNode struct {
+	ID    string                 `json:"id"`
+	Type  string                 `json:"type"` // alert, agent, host, ip, user
+	Label string                 `json:"label"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// GraphEdge connects an alert to an entity it references
+type GraphEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Relation string `json:"relation"`
+}
@@ -0,0 +1,41 @@
+// Custom Field Models
+// Tenant-defined telemetry fields extracted from the event payload into indexed columns
+
+package models
+
+import "time"
+
+// Custom field types
+const (
+	CustomFieldString = "string"
+	CustomFieldInt    = "int"
+	CustomFieldFloat  = "float"
+	CustomFieldBool   = "bool"
+)
+
+// ScheduledJobCustomFieldCleanup is the scheduler job type that drops the columns of deleted
+// custom fields once no license uses them
+const ScheduledJobCustomFieldCleanup = "custom_field_cleanup"
+
+// CustomField maps a payload key to a ClickHouse materialized column that queries can filter on
+type CustomField struct {
+	ID         string    `json:"id"`
+	LicenseID  string    `json:"license_id"`
+	Name       string    `json:"name"`        // Name used in query filters
+	PayloadKey string    `json:"payload_key"` // Dotted path into the payload, e.g. "http.user_agent"
+	Type       string    `json:"type"`
+	Column     string    `json:"column"` // Shared by every tenant extracting the same key and type
+	Indexed    bool      `json:"indexed"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateCustomFieldRequest is the request body for defining a custom field
+type CreateCustomFieldRequest struct {
+	LicenseID  string `json:"license_id" binding:"required"`
+	Name       string `json:"name" binding:"required"`
+	PayloadKey string `json:"payload_key" binding:"required"`
+	Type       string `json:"type,omitempty"`    // string (default), int, float or bool
+	Indexed    bool   `json:"indexed,omitempty"` // Add a skipping index for selective filters
+	CreatedBy  string `json:"created_by"`
+}
@@ -66,6 +66,8 @@ type UpdateDataLakeConfigRequest struct {
 	RetentionPolicy   *RetentionPolicy `json:"retention_policy"`
 	CompressionType   *string          `json:"compression_type"`
 	EncryptionEnabled *bool            `json:"encryption_enabled"`
+	Region            *string          `json:"region"`      // Checked against the license's data residency
+	BucketName        *string          `json:"bucket_name"`
 }
 
 // ArchiveJob represents a data archival job
@@ -83,10 +85,24 @@ type ArchiveJob struct {
 	Error            string           `json:"error,omitempty"`
 	Progress         float64          `json:"progress"` // 0.0 to 1.0
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	Datasets         []RestoreDatasetProgress `json:"datasets,omitempty"` // Restore jobs only
 	CreatedAt        time.Time        `json:"created_at"`
 	UpdatedAt        time.Time        `json:"updated_at"`
 }
 
+// RestoreDatasetProgress tracks one dataset of a restore job. Rows already committed are
+// skipped when a failed or interrupted restore is resumed.
+type RestoreDatasetProgress struct {
+	DatasetID     string     `json:"dataset_id"`
+	DatasetName   string     `json:"dataset_name"`
+	Status        string     `json:"status"` // pending, running, completed, failed
+	EventCount    int64      `json:"event_count"`
+	RowsCommitted int64      `json:"rows_committed"`
+	RowsSkipped   int64      `json:"rows_skipped"` // Rows of another tenant or unparseable
+	Error         string     `json:"error,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
+
 // ArchiveJobType defines the type of archive operation
 type ArchiveJobType string
 
@@ -135,6 +151,7 @@ type CreateArchiveJobRequest struct {
 	EndDate        time.Time              `json:"end_date" binding:"required"`
 	TargetLocation string                 `json:"target_location"`
 	Metadata       map[string]interface{} `json:"metadata"`
+	DatasetIDs     []string               `json:"dataset_ids"` // Restore only; defaults to datasets overlapping the date range
 }
 
 // QueryArchivedDataRequest is the request to query archived data
@@ -147,6 +164,7 @@ type QueryArchivedDataRequest struct {
 	Filters        map[string]interface{} `json:"filters,omitempty"`
 	Limit          int                    `json:"limit"`
 	IncludeMetrics bool                   `json:"include_metrics"`
+	NoCache        bool                   `json:"no_cache"` // Bypass the result cache and re-scan the datasets
 }
 
 // QueryArchivedDataResponse is the response from querying archived data
@@ -157,6 +175,8 @@ type QueryArchivedDataResponse struct {
 	QueryTimeMs     int64                    `json:"query_time_ms"`
 	DataScannedGB   float64                  `json:"data_scanned_gb"`
 	Metrics         *QueryMetrics            `json:"metrics,omitempty"`
+	Truncated       bool                     `json:"truncated"` // The limit was reached before all datasets were scanned
+	CacheHit        bool                     `json:"cache_hit"` // Served from the query result cache
 }
 
 // QueryMetrics provides detailed query performance metrics
@@ -253,3 +273,34 @@ type TestDataLakeConnectionResponse struct {
 	Error        string    `json:"error,omitempty"`
 	TestedAt     time.Time `json:"tested_at"`
 }
+
+// Hot storage retention actions
+const (
+	RetentionActionDelete         = "delete"           // Expired events removed
+	RetentionActionHoldForArchive = "hold_for_archive" // Waiting for the archive to catch up
+	RetentionActionNone           = "none"             // Nothing expired
+	RetentionActionLegalHold      = "legal_hold"       // Deletion limited by an active legal hold
+	RetentionActionError          = "error"
+)
+
+// TenantRetention describes retention enforcement for one license
+type TenantRetention struct {
+	LicenseID       string     `json:"license_id"`
+	HotStorageDays  int        `json:"hot_storage_days"`
+	AutoArchive     bool       `json:"auto_archive"`
+	Cutoff          time.Time  `json:"cutoff"`
+	ArchivedThrough *time.Time `json:"archived_through,omitempty"`
+	EffectiveCutoff *time.Time `json:"effective_cutoff,omitempty"` // Cutoff limited to archived data
+	LegalHoldFrom   *time.Time `json:"legal_hold_from,omitempty"`  // Start of the earliest active legal hold
+	ExpiredEvents   int64      `json:"expired_events"`
+	Action          string     `json:"action"`
+}
+
+// RetentionRunResult summarises a hot storage retention run
+type RetentionRunResult struct {
+	DryRun            bool              `json:"dry_run"`
+	DroppedPartitions []string          `json:"dropped_partitions"`
+	Tenants           []TenantRetention `json:"tenants"`
+	StartedAt         time.Time         `json:"started_at"`
+	DurationMs        int64             `json:"duration_ms"`
+}
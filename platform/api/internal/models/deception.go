@@ -23,6 +23,8 @@ type Honeypot struct {
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt       time.Time              `json:"created_at"`
 	UpdatedAt       time.Time              `json:"updated_at"`
+	DeletedAt       *time.Time             `json:"deleted_at,omitempty"` // Set while soft-deleted
+	Version         int                    `json:"version"`              // Incremented on every edit; sent as the ETag
 }
 
 // HoneypotType defines the type of honeypot
@@ -114,6 +116,7 @@ type HoneyToken struct {
 	AccessCount    int                    `json:"access_count"`
 	LastAccessed   *time.Time             `json:"last_accessed,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	ExpectedContext *HoneyTokenExpectedContext `json:"expected_context,omitempty"`
 	CreatedAt      time.Time              `json:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at"`
 }
@@ -131,15 +134,22 @@ const (
 	TokenTypeWebBug          HoneyTokenType = "web_bug"
 	TokenTypeQRCode          HoneyTokenType = "qr_code"
 	TokenTypeOfficeDocument  HoneyTokenType = "office_document"
+	TokenTypeAzureStorage    HoneyTokenType = "azure_storage"
+	TokenTypeSlackToken      HoneyTokenType = "slack_token"
+	TokenTypeGitHubToken     HoneyTokenType = "github_token"
+	TokenTypeCustom          HoneyTokenType = "custom" // Value rendered from a user-supplied template
 )
 
 // CreateHoneyTokenRequest is the request to create a honey token
 type CreateHoneyTokenRequest struct {
-	LicenseID   string                 `json:"license_id" binding:"required"`
-	Name        string                 `json:"name" binding:"required"`
-	TokenType   HoneyTokenType         `json:"token_type" binding:"required"`
-	CallbackURL string                 `json:"callback_url,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	LicenseID      string                 `json:"license_id" binding:"required"`
+	Name           string                 `json:"name" binding:"required"`
+	TokenType      HoneyTokenType         `json:"token_type" binding:"required"`
+	CallbackURL    string                 `json:"callback_url,omitempty"`
+	Template       string                 `json:"template,omitempty"`        // Custom value format, e.g. "sk_live_{alnum:24}"
+	DocumentFormat string                 `json:"document_format,omitempty"` // docx, xlsx or pdf for office_document tokens
+	Metadata       map[string]interface{} `json:"metadata"`
+	ExpectedContext *HoneyTokenExpectedContext `json:"expected_context,omitempty"`
 }
 
 // UpdateHoneyTokenRequest is the request to update a honey token
@@ -189,6 +199,8 @@ type DeceptionEventDetails struct {
 	AccessedFile       string            `json:"accessed_file,omitempty"`
 	SessionDuration    int64             `json:"session_duration,omitempty"` // milliseconds
 	BytesTransferred   int64             `json:"bytes_transferred,omitempty"`
+	ContextChecked     bool              `json:"context_checked,omitempty"`    // The honey token has an expected context to compare against
+	ContextDeviations  []string          `json:"context_deviations,omitempty"` // How the access departed from it
 }
 
 // DeceptionCampaign represents a coordinated deception deployment
@@ -310,3 +322,178 @@ type PlaybookAction struct {
 	Parameters  map[string]interface{} `json:"parameters"`
 	Description string                 `json:"description"`
 }
+
+// Deception asset kinds in attacker path graphs
+const (
+	DeceptionAssetHoneypot   = "honeypot"
+	DeceptionAssetHoneyToken = "honey_token"
+)
+
+// AttackerPathGraph shows how attackers moved through a license's deception assets
+type AttackerPathGraph struct {
+	LicenseID       string                `json:"license_id"`
+	TimeRange       TimeRange             `json:"time_range"`
+	Sources         []AttackerSourceNode  `json:"sources"`
+	Assets          []DeceptionAssetNode  `json:"assets"`
+	SourceEdges     []AttackerSourceEdge  `json:"source_edges"`     // Source IP -> asset touched
+	TransitionEdges []DeceptionTransition `json:"transition_edges"` // Asset -> next asset touched by the same source
+	Paths           []AttackerPath        `json:"paths"`
+	Heatmap         [7][24]int            `json:"heatmap"` // Interactions by weekday (0 = Sunday) and UTC hour
+	EventsAnalyzed  int                   `json:"events_analyzed"`
+	Truncated       bool                  `json:"truncated"`
+}
+
+// AttackerSourceNode is a source IP that touched deception assets
+type AttackerSourceNode struct {
+	SourceIP      string    `json:"source_ip"`
+	Hostnames     []string  `json:"hostnames,omitempty"`
+	Users         []string  `json:"users,omitempty"`
+	Interactions  int       `json:"interactions"`
+	AssetsTouched int       `json:"assets_touched"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	MaxSeverity   string    `json:"max_severity"`
+}
+
+// DeceptionAssetNode is a honeypot or honey token with how effectively it catches attackers.
+// A first touch is a source's first contact with the deception layer; a deep touch is any later
+// asset on its path.
+type DeceptionAssetNode struct {
+	ID            string  `json:"id"`
+	Kind          string  `json:"kind"` // honeypot or honey_token
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Interactions  int     `json:"interactions"`
+	UniqueSources int     `json:"unique_sources"`
+	FirstTouches  int     `json:"first_touches"`
+	DeepTouches   int     `json:"deep_touches"`
+	AvgDepth      float64 `json:"avg_depth"` // Mean 1-based position on the paths it appears in
+}
+
+// AttackerSourceEdge links a source to an asset it touched
+type AttackerSourceEdge struct {
+	SourceIP     string    `json:"source_ip"`
+	AssetID      string    `json:"asset_id"`
+	Interactions int       `json:"interactions"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// DeceptionTransition counts sources moving from one asset to the next
+type DeceptionTransition struct {
+	FromAssetID   string  `json:"from_asset_id"`
+	ToAssetID     string  `json:"to_asset_id"`
+	Count         int     `json:"count"`
+	AvgGapSeconds float64 `json:"avg_gap_seconds"`
+}
+
+// AttackerPath is the ordered route of one source through the deception layer. Consecutive
+// interactions with the same asset are collapsed into one step.
+type AttackerPath struct {
+	SourceIP string             `json:"source_ip"`
+	Steps    []AttackerPathStep `json:"steps"`
+	Duration float64            `json:"duration_seconds"`
+}
+
+// AttackerPathStep is one asset visit on a path
+type AttackerPathStep struct {
+	AssetID          string    `json:"asset_id"`
+	AssetName        string    `json:"asset_name"`
+	Kind             string    `json:"kind"`
+	InteractionTypes []string  `json:"interaction_types"`
+	MaxSeverity      string    `json:"max_severity"`
+	Interactions     int       `json:"interactions"`
+	FirstAt          time.Time `json:"first_at"`
+	LastAt           time.Time `json:"last_at"`
+	GapSeconds       float64   `json:"gap_seconds"` // Since the previous step ended
+}
+
+// AutoDeployRequest asks the platform to place honeypots that blend into the tenant's network.
+// Hosts and services are discovered from agent inventory and network telemetry, plus any
+// Inventory supplied here.
+type AutoDeployRequest struct {
+	LicenseID     string         `json:"license_id" binding:"required"`
+	Preview       bool           `json:"preview"`                                // Only return the plan
+	Subnets       []string       `json:"subnets" binding:"max=64,dive,cidrv4"`   // Limit placement to these IPv4 CIDRs
+	Inventory     []NetworkAsset `json:"inventory" binding:"max=10000,dive"`     // Extra hosts not covered by agents
+	HoneypotTypes []HoneypotType `json:"honeypot_types"`                         // Allowed types; empty allows all
+	ExcludeIPs    []string       `json:"exclude_ips" binding:"max=1000,dive,ip"` // Addresses never to use
+	MaxHoneypots  int            `json:"max_honeypots" binding:"omitempty,min=1,max=50"`
+	LookbackHours int            `json:"lookback_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// NetworkAsset is a host in a supplied inventory
+type NetworkAsset struct {
+	IP        string `json:"ip" binding:"required,ipv4"`
+	Hostname  string `json:"hostname"`
+	OSType    string `json:"os_type"`
+	OpenPorts []int  `json:"open_ports" binding:"max=1024,dive,min=1,max=65535"`
+}
+
+// AutoDeploySubnet summarizes what was discovered in one subnet
+type AutoDeploySubnet struct {
+	CIDR      string            `json:"cidr"`
+	Hosts     int               `json:"hosts"`
+	Honeypots int               `json:"honeypots"` // Existing honeypots placed in the subnet
+	OSType    string            `json:"os_type,omitempty"`
+	Services  []ObservedService `json:"services"`
+}
+
+// ObservedService is a port seen in use in a subnet
+type ObservedService struct {
+	Port         int   `json:"port"`
+	Hosts        int   `json:"hosts"`
+	Observations int64 `json:"observations"` // Connections in telemetry plus inventory listings
+}
+
+// HoneypotRecommendation is a proposed honeypot placement
+type HoneypotRecommendation struct {
+	Name           string       `json:"name"`
+	HoneypotType   HoneypotType `json:"honeypot_type"`
+	TargetPlatform string       `json:"target_platform"`
+	Location       string       `json:"location"`
+	Subnet         string       `json:"subnet"`
+	ListenPort     int          `json:"listen_port"`
+	ServiceBanner  string       `json:"service_banner"`
+	Score          float64      `json:"score"`
+	Reason         string       `json:"reason"`
+}
+
+// AutoDeployResponse is the plan and, outside preview mode, the honeypots created from it
+type AutoDeployResponse struct {
+	Preview         bool                     `json:"preview"`
+	Subnets         []AutoDeploySubnet       `json:"subnets"`
+	Recommendations []HoneypotRecommendation `json:"recommendations"`
+	Deployed        []Honeypot               `json:"deployed,omitempty"`
+}
+
+// HoneyTokenExpectedContext describes where and when a honey token would plausibly be touched.
+// Any access is suspicious; access from outside this context raises the event's severity.
+type HoneyTokenExpectedContext struct {
+	Networks      []string                 `json:"networks,omitempty"` // CIDRs the token's host lives in
+	BusinessHours *HoneyTokenBusinessHours `json:"business_hours,omitempty"`
+}
+
+// HoneyTokenBusinessHours is the working week of the token's owners
+type HoneyTokenBusinessHours struct {
+	Timezone  string   `json:"timezone,omitempty"` // IANA name; defaults to UTC
+	Days      []string `json:"days,omitempty"`     // mon..sun; defaults to mon-fri
+	StartHour int      `json:"start_hour" binding:"min=0,max=23"`
+	EndHour   int      `json:"end_hour" binding:"min=1,max=24"`
+}
+
+// Honey token context deviations
+const (
+	ContextDeviationNetwork  = "unexpected_network"
+	ContextDeviationOffHours = "off_hours"
+)
+
+// CreateDeceptionPlaybookRequest is the request to create a deception playbook
+type CreateDeceptionPlaybookRequest struct {
+	LicenseID         string                 `json:"license_id" binding:"required"`
+	Name              string                 `json:"name" binding:"required,max=255"`
+	Description       string                 `json:"description"`
+	Enabled           *bool                  `json:"enabled"`
+	TriggerConditions map[string]interface{} `json:"trigger_conditions"`
+	Actions           []PlaybookAction       `json:"actions" binding:"required,min=1,max=20"`
+}
@@ -12,11 +12,14 @@ type DLPPolicy struct {
 	Description      string                 `json:"description"`
 	Severity         string                 `json:"severity"` // low, medium, high, critical
 	Enabled          bool                   `json:"enabled"`
-	RuleType         string                 `json:"rule_type"` // fingerprint, regex, ml
-	Config           map[string]interface{} `json:"config,omitempty"`
+	RuleType         string                 `json:"rule_type"`        // regex, keyword, fingerprint, edm, detector, ml
+	Config           map[string]interface{} `json:"config,omitempty"` // Shaped by the rule type's config struct, e.g. DLPRegexConfig
 	FingerprintCount int                    `json:"fingerprint_count"`
+	Groups           []string               `json:"groups"` // Agent groups the policy targets; empty applies to all agents
 	CreatedAt        time.Time              `json:"created_at"`
 	UpdatedAt        time.Time              `json:"updated_at"`
+	DeletedAt        *time.Time             `json:"deleted_at,omitempty"` // Set while soft-deleted
+	Version          int                    `json:"version"`              // Incremented on every edit; sent as the ETag
 }
 
 // CreateDLPPolicyRequest is the request body for creating a policy
@@ -26,7 +29,7 @@ type CreateDLPPolicyRequest struct {
 	Description string                 `json:"description"`
 	Severity    string                 `json:"severity" binding:"required"`
 	Enabled     bool                   `json:"enabled"`
-	RuleType    string                 `json:"rule_type" binding:"required"`
+	RuleType    string                 `json:"rule_type" binding:"required,oneof=regex keyword fingerprint edm detector ml"`
 	Config      map[string]interface{} `json:"config"`
 }
 
@@ -39,6 +42,66 @@ type UpdateDLPPolicyRequest struct {
 	Config      *map[string]interface{} `json:"config"`
 }
 
+// DLP policy rule types. Each has its own config schema, validated when a policy is created or
+// its config is replaced.
+const (
+	DLPRuleRegex       = "regex"
+	DLPRuleKeyword     = "keyword"
+	DLPRuleFingerprint = "fingerprint"
+	DLPRuleEDM         = "edm"
+	DLPRuleDetector    = "detector"
+	DLPRuleML          = "ml" // Config is passed to the model as-is and not validated
+)
+
+// DLPRegexConfig is the config of a regex policy
+type DLPRegexConfig struct {
+	Patterns   []DLPRegexPattern `json:"patterns" binding:"required,min=1,max=100,dive"`
+	MinMatches int               `json:"min_matches,omitempty" binding:"omitempty,min=1,max=1000"` // Matches needed in one document; defaults to 1
+}
+
+// DLPRegexPattern is one named pattern of a regex policy, in RE2 syntax
+type DLPRegexPattern struct {
+	Name          string  `json:"name" binding:"required,max=100"`
+	Pattern       string  `json:"pattern" binding:"required,max=1000"`
+	CaseSensitive bool    `json:"case_sensitive,omitempty"`
+	Confidence    float64 `json:"confidence,omitempty" binding:"omitempty,gt=0,lte=1"` // Defaults to 0.8
+}
+
+// DLPKeywordConfig is the config of a keyword policy. Keywords match case-insensitively on word
+// boundaries.
+type DLPKeywordConfig struct {
+	Keywords   []string `json:"keywords" binding:"required,min=1,max=1000,dive,required,max=200"`
+	MinMatches int      `json:"min_matches,omitempty" binding:"omitempty,min=1,max=1000"`
+}
+
+// DLPFingerprintConfig is the config of a fingerprint policy; the fingerprints themselves are
+// added through the policy's fingerprints endpoint
+type DLPFingerprintConfig struct {
+	Algorithm           string   `json:"algorithm,omitempty" binding:"omitempty,oneof=sha256 simhash ssdeep"`  // Defaults to sha256
+	SimilarityThreshold float64  `json:"similarity_threshold,omitempty" binding:"omitempty,gt=0,lte=1"`        // Fuzzy algorithms only
+	FileTypes           []string `json:"file_types,omitempty" binding:"omitempty,max=50,dive,required,max=20"` // Extensions to scan; empty scans all
+	MaxFileSizeMB       int      `json:"max_file_size_mb,omitempty" binding:"omitempty,min=1,max=2048"`
+}
+
+// DLPEDMConfig is the config of an exact data match policy
+type DLPEDMConfig struct {
+	EDMDatasets []string `json:"edm_datasets" binding:"required,min=1,max=20,dive,uuid"`
+}
+
+// DLPDetectorConfig is the config of a detector policy: built-in detectors by name, optionally
+// with the policy's own keyword dictionary
+type DLPDetectorConfig struct {
+	Detectors     []string `json:"detectors" binding:"required,min=1,max=50,dive,required"`
+	Keywords      []string `json:"keywords,omitempty" binding:"omitempty,max=1000,dive,required,max=200"`
+	MinConfidence float64  `json:"min_confidence,omitempty" binding:"omitempty,gt=0,lte=1"` // Detector hits below it are dropped
+}
+
+// SetDLPPolicyAssignmentsRequest replaces the agent groups a policy applies to.
+// An empty list makes the policy license-wide again.
+type SetDLPPolicyAssignmentsRequest struct {
+	Groups []string `json:"groups"`
+}
+
 // AddFingerprintsRequest adds fingerprints to a policy
 type AddFingerprintsRequest struct {
 	Fingerprints []string `json:"fingerprints" binding:"required"`
@@ -65,5 +128,70 @@ type DLPMatch struct {
 	Offset     int     `json:"offset"`
 	Length     int     `json:"length"`
 	Confidence float64 `json:"confidence"`
-	MatchType  string  `json:"match_type"` // exact, partial, fuzzy
+	MatchType  string  `json:"match_type"` // exact, partial, fuzzy, detector, keyword, regex, edm
+	Detector   string  `json:"detector,omitempty"`
+}
+
+// DLPDetector describes a built-in detector that policies enable via config.detectors
+type DLPDetector struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Category    string  `json:"category"`  // pii, pci, financial, credentials, classification
+	Validated   bool    `json:"validated"` // Candidates are confirmed by a checksum or range check
+	Confidence  float64 `json:"confidence"`
+}
+
+// DLPViolation is a dlp_violation event joined with the policy that matched it
+type DLPViolation struct {
+	EventID        string    `json:"event_id"`
+	Timestamp      time.Time `json:"timestamp"`
+	AgentID        string    `json:"agent_id"`
+	Hostname       string    `json:"hostname"`
+	Username       string    `json:"username"`
+	FilePath       string    `json:"file_path"`
+	MatchedPattern string    `json:"matched_pattern,omitempty"`
+	Severity       string    `json:"severity"`
+	PolicyID       string    `json:"policy_id"`
+	PolicyName     string    `json:"policy_name,omitempty"` // Empty when the policy has since been deleted
+	RuleType       string    `json:"rule_type,omitempty"`
+}
+
+// DLPViolationCount is a violation count for one user or policy
+type DLPViolationCount struct {
+	Key   string `json:"key"`
+	Name  string `json:"name,omitempty"`
+	Count uint64 `json:"count"`
+}
+
+// DLPViolationSummary aggregates violations over the queried range
+type DLPViolationSummary struct {
+	Total       uint64              `json:"total"`
+	BySeverity  map[string]uint64   `json:"by_severity"`
+	TopUsers    []DLPViolationCount `json:"top_users"`
+	TopPolicies []DLPViolationCount `json:"top_policies"`
+}
+
+// DLPViolationsResponse is a page of violations with aggregates for the dashboard
+type DLPViolationsResponse struct {
+	Violations []DLPViolation      `json:"violations"`
+	Summary    DLPViolationSummary `json:"summary"`
+	StartTime  time.Time           `json:"start_time"`
+	EndTime    time.Time           `json:"end_time"`
+	Limit      int                 `json:"limit"`
+	Offset     int                 `json:"offset"`
+}
+
+// EDMDataset is an exact data match dataset. Cell values are stored only as salted hashes;
+// policies reference datasets by ID in config.edm_datasets.
+type EDMDataset struct {
+	ID          string    `json:"id"`
+	LicenseID   string    `json:"license_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Columns     []string  `json:"columns"`
+	RowCount    int       `json:"row_count"`
+	MinMatches  int       `json:"min_matches"` // Cells of one row that must co-occur for a match
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -0,0 +1,75 @@
+// Telemetry Ingestion Models
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// IngestBatchRequest submits telemetry over REST for agents and integrations without gRPC
+type IngestBatchRequest struct {
+	AgentID string        `json:"agent_id" binding:"required"`
+	Events  []IngestEvent `json:"events" binding:"required"`
+}
+
+// IngestEvent is a single event in an ingest batch. Tenant, hostname and OS are taken from
+// the registered agent, never from the request.
+type IngestEvent struct {
+	EventID        string          `json:"event_id,omitempty"`  // Optional; used to deduplicate retried batches
+	Timestamp      int64           `json:"timestamp,omitempty"` // Unix milliseconds; defaults to the time of receipt
+	EventType      string          `json:"event_type"`          // e.g. PROCESS_START, NETWORK_CONN
+	MitreTactic    string          `json:"mitre_tactic,omitempty"`
+	MitreTechnique string          `json:"mitre_technique,omitempty"`
+	Severity       int32           `json:"severity"` // 0=info ... 4=critical
+	Payload        json.RawMessage `json:"payload,omitempty"`
+}
+
+// IngestRejection explains why one event of a batch was not accepted
+type IngestRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// IngestBatchResponse reports how much of a batch was published
+type IngestBatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected []IngestRejection `json:"rejected"`
+}
+
+// Telemetry simulation statuses
+const (
+	SimulationRunning   = "running"
+	SimulationCompleted = "completed"
+	SimulationFailed    = "failed"
+)
+
+// SimulateTelemetryRequest generates synthetic events and publishes them through the real
+// ingestion pipeline, so alert rules and dashboards can be checked without deploying agents
+type SimulateTelemetryRequest struct {
+	LicenseID       string         `json:"license_id" binding:"required"`
+	AgentID         string         `json:"agent_id"`                                                         // Registered agent to attribute events to; synthetic hosts when empty
+	Hosts           int            `json:"hosts" binding:"omitempty,min=1,max=100"`                          // Synthetic hosts without agent_id; defaults to 1
+	Count           int            `json:"count" binding:"required,min=1,max=100000"`                        // Events to generate
+	Rate            int            `json:"rate" binding:"omitempty,min=1,max=5000"`                          // Events per second; defaults to 100
+	EventTypes      map[string]int `json:"event_types" binding:"omitempty,max=9,dive,min=0,max=1000"`        // Relative weights by event type; defaults to an even mix
+	MitreTechniques []string       `json:"mitre_techniques" binding:"omitempty,max=50,dive,mitre_technique"` // Tagged on a share of the events
+	MitreRatio      float64        `json:"mitre_ratio" binding:"omitempty,gt=0,lte=1"`                       // Share of events tagged with a technique; defaults to 0.1
+	Severities      map[string]int `json:"severities" binding:"omitempty,max=5,dive,min=0,max=1000"`         // Relative weights by severity 0-4; defaults to mostly informational
+	Seed            int64          `json:"seed"`                                                             // Makes the generated events repeatable; random when 0
+}
+
+// TelemetrySimulation reports the progress of a simulation. Simulated events carry
+// "simulated": true and the simulation ID in their payload.
+type TelemetrySimulation struct {
+	ID          string     `json:"id"`
+	LicenseID   string     `json:"license_id"`
+	Status      string     `json:"status"`
+	Requested   int        `json:"requested"`
+	Published   int        `json:"published"`
+	Rate        int        `json:"rate"`
+	Seed        int64      `json:"seed"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
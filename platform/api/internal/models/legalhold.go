@@ -0,0 +1,104 @@
+// Legal Hold Models
+// Preservation of a license's telemetry and audit history for litigation, with signed exports
+
+package models
+
+import "time"
+
+// Legal hold statuses
+const (
+	LegalHoldActive   = "active"   // Data in scope is exempt from retention
+	LegalHoldReleased = "released" // Retention applies again
+)
+
+// LegalHoldPackageFormat identifies the layout of a legal hold export package
+const LegalHoldPackageFormat = "PRIVE-LEGAL-HOLD-V1"
+
+// LegalHold preserves a license's data for a time range. While active, hot storage retention
+// does not delete telemetry from StartTime onwards.
+type LegalHold struct {
+	ID              string            `json:"id"`
+	LicenseID       string            `json:"license_id"`
+	Name            string            `json:"name"`
+	MatterReference string            `json:"matter_reference,omitempty"` // Case or docket number
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	AgentIDs        []string          `json:"agent_ids"` // Limits exported events; empty exports every agent
+	Status          string            `json:"status"`
+	CreatedBy       string            `json:"created_by,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	ReleasedBy      string            `json:"released_by,omitempty"`
+	ReleasedAt      *time.Time        `json:"released_at,omitempty"`
+	Exports         []LegalHoldExport `json:"exports,omitempty"`
+}
+
+// CreateLegalHoldRequest is the request body for placing a legal hold
+type CreateLegalHoldRequest struct {
+	LicenseID       string    `json:"license_id" binding:"required"`
+	Name            string    `json:"name" binding:"required,max=255"`
+	MatterReference string    `json:"matter_reference" binding:"max=255"`
+	StartTime       time.Time `json:"start_time" binding:"required"`
+	EndTime         time.Time `json:"end_time" binding:"required"`
+	AgentIDs        []string  `json:"agent_ids" binding:"max=1000"`
+	CreatedBy       string    `json:"created_by"`
+}
+
+// LegalHoldExportRequest exports an existing hold, or places a new hold and exports it
+type LegalHoldExportRequest struct {
+	HoldID      string                  `json:"hold_id"`
+	Hold        *CreateLegalHoldRequest `json:"hold"` // Used when hold_id is empty
+	RequestedBy string                  `json:"requested_by"`
+}
+
+// ReleaseLegalHoldRequest is the request body for releasing a legal hold
+type ReleaseLegalHoldRequest struct {
+	ReleasedBy string `json:"released_by"`
+}
+
+// LegalHoldExport records one package exported for a hold
+type LegalHoldExport struct {
+	ID             string    `json:"id"`
+	HoldID         string    `json:"hold_id"`
+	LicenseID      string    `json:"license_id"`
+	EventCount     int64     `json:"event_count"`
+	AuditCount     int64     `json:"audit_count"`
+	ManifestSHA256 string    `json:"manifest_sha256"`
+	Signature      string    `json:"signature"` // base64 Ed25519 signature over manifest.json
+	SizeBytes      int64     `json:"size_bytes"`
+	CreatedBy      string    `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// LegalHoldManifest is manifest.json of an export package. It lists every other file with its
+// SHA256; manifest.sig holds the base64 Ed25519 signature of the manifest.json bytes.
+type LegalHoldManifest struct {
+	Format          string          `json:"format"`
+	ExportID        string          `json:"export_id"`
+	HoldID          string          `json:"hold_id"`
+	LicenseID       string          `json:"license_id"`
+	MatterReference string          `json:"matter_reference,omitempty"`
+	StartTime       time.Time       `json:"start_time"`
+	EndTime         time.Time       `json:"end_time"`
+	AgentIDs        []string        `json:"agent_ids"`
+	GeneratedAt     time.Time       `json:"generated_at"`
+	GeneratedBy     string          `json:"generated_by,omitempty"`
+	PublicKey       string          `json:"public_key"` // base64 Ed25519 key the signature verifies with
+	Files           []LegalHoldFile `json:"files"`
+}
+
+// LegalHoldFile is one file of an export package
+type LegalHoldFile struct {
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+	Records   int64  `json:"records"`
+}
+
+// LegalHoldVerification is the result of checking an export package
+type LegalHoldVerification struct {
+	Valid          bool               `json:"valid"`
+	SignatureValid bool               `json:"signature_valid"`
+	KnownExport    bool               `json:"known_export"` // The manifest matches an export recorded by this platform
+	Manifest       *LegalHoldManifest `json:"manifest,omitempty"`
+	Issues         []string           `json:"issues"`
+}
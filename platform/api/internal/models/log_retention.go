@@ -0,0 +1,49 @@
+// Log Retention Models
+// Per-deployment retention of the notification and license audit logs
+
+package models
+
+import "time"
+
+// Log retention modes: expired entries are deleted, or written to archive files and then deleted
+const (
+	LogRetentionDelete  = "delete"
+	LogRetentionArchive = "archive"
+)
+
+// LogRetentionConfig is the deployment's log retention, set through the environment
+type LogRetentionConfig struct {
+	NotificationLogDays int    `json:"notification_log_days"` // 0 keeps notification logs forever
+	AuditLogDays        int    `json:"audit_log_days"`        // 0 keeps the license audit log forever
+	AuditLogMode        string `json:"audit_log_mode"`        // LogRetentionDelete or LogRetentionArchive
+	ArchiveDir          string `json:"archive_dir,omitempty"` // Where archive mode writes gzipped JSONL files
+	PartitionsAhead     int    `json:"partitions_ahead"`      // Monthly notification log partitions created in advance
+}
+
+// LogRetentionTableResult describes retention of one log table
+type LogRetentionTableResult struct {
+	Table             string     `json:"table"`
+	RetentionDays     int        `json:"retention_days"`
+	Mode              string     `json:"mode"`
+	Cutoff            *time.Time `json:"cutoff,omitempty"` // Unset when the table is kept forever
+	ExpiredEntries    int64      `json:"expired_entries"`  // Deleted, or that would be on a dry run, outside dropped partitions
+	HeldEntries       int64      `json:"held_entries"`     // Expired but kept by an active legal hold
+	DroppedPartitions []string   `json:"dropped_partitions"`
+	ArchiveFiles      []string   `json:"archive_files"`
+}
+
+// LogRetentionRunResult summarises a log retention run
+type LogRetentionRunResult struct {
+	DryRun            bool                    `json:"dry_run"`
+	CreatedPartitions []string                `json:"created_partitions"`
+	NotificationLogs  LogRetentionTableResult `json:"notification_logs"`
+	AuditLog          LogRetentionTableResult `json:"audit_log"`
+	StartedAt         time.Time               `json:"started_at"`
+	DurationMs        int64                   `json:"duration_ms"`
+}
+
+// LogRetentionStatus is the deployment's log retention configuration and last run
+type LogRetentionStatus struct {
+	Config  LogRetentionConfig     `json:"config"`
+	LastRun *LogRetentionRunResult `json:"last_run,omitempty"`
+}
@@ -0,0 +1,62 @@
+// Agent Log Models
+// Raw log lines shipped by agents, stored apart from structured telemetry
+
+package models
+
+import "time"
+
+// Log levels; lines may also leave the level empty when the source has none
+var LogLevels = []string{"debug", "info", "notice", "warning", "error", "critical"}
+
+// LogIngestRequest submits a batch of raw log lines from a registered agent
+type LogIngestRequest struct {
+	AgentID string    `json:"agent_id" binding:"required"`
+	Lines   []LogLine `json:"lines" binding:"required"`
+}
+
+// LogLine is a single raw log line. Tenant and hostname are taken from the registered agent.
+type LogLine struct {
+	Timestamp int64  `json:"timestamp,omitempty"` // Unix milliseconds; defaults to the time of receipt
+	Source    string `json:"source,omitempty"`    // e.g. syslog, journald, eventlog; defaults to agent
+	Level     string `json:"level,omitempty"`     // One of LogLevels; common aliases such as warn and err are accepted
+	Message   string `json:"message"`
+}
+
+// LogQueryRequest searches a tenant's agent logs. Either a time range or an event_id is
+// required; with event_id the window is centred on that event and limited to its agent.
+type LogQueryRequest struct {
+	TenantID       string   `json:"tenant_id" binding:"required"`
+	StartTime      string   `json:"start_time,omitempty"`                                          // RFC3339
+	EndTime        string   `json:"end_time,omitempty"`                                            // RFC3339, exclusive
+	EventID        string   `json:"event_id,omitempty"`                                            // Structured event to show the surrounding logs of
+	ContextSeconds int      `json:"context_seconds,omitempty" binding:"omitempty,min=1,max=86400"` // Window either side of event_id; defaults to 300
+	AgentIDs       []string `json:"agent_ids,omitempty"`
+	Hostnames      []string `json:"hostnames,omitempty"`
+	Sources        []string `json:"sources,omitempty"`
+	Levels         []string `json:"levels,omitempty"`
+	Text           string   `json:"text,omitempty" binding:"max=1024"` // Case-insensitive substring of the message
+	Limit          int      `json:"limit,omitempty"`                   // Defaults to 500, at most 10000
+	OrderDirection string   `json:"order_direction,omitempty"`         // asc or desc (default)
+}
+
+// AgentLog is a stored log line
+type AgentLog struct {
+	LogID      string    `json:"log_id"`
+	AgentID    string    `json:"agent_id"`
+	Hostname   string    `json:"hostname"`
+	Timestamp  time.Time `json:"timestamp"`
+	ReceivedAt time.Time `json:"received_at"`
+	Source     string    `json:"source"`
+	Level      string    `json:"level,omitempty"`
+	Message    string    `json:"message"`
+}
+
+// LogQueryResponse wraps the matching log lines
+type LogQueryResponse struct {
+	Logs        []AgentLog `json:"logs"`
+	Count       int        `json:"count"`
+	Truncated   bool       `json:"truncated"` // More lines matched than the limit
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     time.Time  `json:"end_time"`
+	QueryTimeMs int64      `json:"query_time_ms"`
+}
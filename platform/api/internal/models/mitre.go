@@ -0,0 +1,107 @@
+// MITRE ATT&CK Import Models
+// Loading tactics and techniques from MITRE's published ATT&CK STIX bundles
+
+package models
+
+import "time"
+
+// ScheduledJobMITREImport is the scheduler job type that refreshes ATT&CK data from MITRE.
+// Params may set "domain" and "url" like MITREImportRequest.
+const ScheduledJobMITREImport = "mitre_import"
+
+// ATT&CK domains, each published as its own STIX bundle
+const (
+	MITREDomainEnterprise = "enterprise"
+	MITREDomainMobile     = "mobile"
+	MITREDomainICS        = "ics"
+)
+
+// MITREImportRequest is the request body for importing an ATT&CK STIX bundle
+type MITREImportRequest struct {
+	Domain     string `json:"domain" form:"domain" binding:"omitempty,oneof=enterprise mobile ics"` // Defaults to enterprise
+	URL        string `json:"url" form:"url" binding:"omitempty,url"`                               // Defaults to MITRE's attack-stix-data repository
+	ImportedBy string `json:"imported_by" form:"imported_by"`
+}
+
+// MITREImport records one import of an ATT&CK bundle
+type MITREImport struct {
+	ID            string    `json:"id"`
+	Domain        string    `json:"domain"`
+	ATTACKVersion string    `json:"attack_version,omitempty"` // e.g. 15.1, from the bundle's collection object
+	SourceURL     string    `json:"source_url"`
+	Tactics       int       `json:"tactics"`
+	Techniques    int       `json:"techniques"`
+	SubTechniques int       `json:"subtechniques"`
+	Inserted      int       `json:"inserted"`   // Tactics and techniques new to the platform
+	Updated       int       `json:"updated"`    // Existing rows refreshed from the bundle
+	Deprecated    int       `json:"deprecated"` // Deprecated or revoked upstream; kept so old events still resolve
+	ImportedBy    string    `json:"imported_by,omitempty"`
+	ImportedAt    time.Time `json:"imported_at"`
+}
+
+// Technique posture statuses, combining detection capability with observed activity
+const (
+	PostureCovered      = "covered"       // A rule detects it and activity was observed
+	PostureDetectable   = "detectable"    // A rule detects it; no activity observed
+	PostureObservedOnly = "observed_only" // Activity was observed but no rule detects it
+	PostureGap          = "gap"           // Neither detected by a rule nor observed
+)
+
+// Rule sources that contribute detection capability
+const (
+	CoveringRuleAlert     = "alert_rule" // The license's enabled alert rules
+	CoveringRuleCommunity = "community"  // Community rules the license downloaded
+)
+
+// CoveringRule is a rule designed to detect a technique
+type CoveringRule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Source   string `json:"source"`              // alert_rule or community
+	RuleType string `json:"rule_type,omitempty"` // Community rules: yara, sigma, custom_query, alert_rule
+	Severity string `json:"severity,omitempty"`  // Alert rules
+}
+
+// TechniquePosture is the detection posture of one technique. Rules and activity mapped to a
+// sub-technique count toward its parent.
+type TechniquePosture struct {
+	TechniqueID   string         `json:"technique_id"`
+	Name          string         `json:"name"`
+	TacticIDs     []string       `json:"tactic_ids"`
+	Status        string         `json:"status"`
+	Rules         []CoveringRule `json:"rules"`
+	SubTechniques []string       `json:"subtechniques,omitempty"` // Sub-techniques named by rules or events
+	EventCount    int64          `json:"event_count"`
+	LastSeen      *time.Time     `json:"last_seen,omitempty"`
+}
+
+// TacticPosture summarizes detection posture for one tactic
+type TacticPosture struct {
+	TacticID          string  `json:"tactic_id"`
+	TacticName        string  `json:"tactic_name"`
+	TotalTechniques   int     `json:"total_techniques"`
+	DetectableCount   int     `json:"detectable_count"`
+	ObservedCount     int     `json:"observed_count"`
+	DetectablePercent float64 `json:"detectable_percent"`
+	ObservedPercent   float64 `json:"observed_percent"`
+}
+
+// MITREPosture compares what a license's rules are designed to detect with what its telemetry
+// has observed, per technique and per tactic. Deprecated techniques are excluded.
+type MITREPosture struct {
+	LicenseID         string             `json:"license_id"`
+	IncludesObserved  bool               `json:"includes_observed"` // False for the rules-only coverage view
+	TotalTechniques   int                `json:"total_techniques"`
+	DetectableCount   int                `json:"detectable_count"`
+	ObservedCount     int                `json:"observed_count"`
+	CoveredCount      int                `json:"covered_count"`
+	ObservedOnlyCount int                `json:"observed_only_count"` // Activity with no rule to alert on it
+	DetectablePercent float64            `json:"detectable_percent"`
+	ObservedPercent   float64            `json:"observed_percent"`
+	RulesEvaluated    int                `json:"rules_evaluated"`
+	UnmappedRules     int                `json:"unmapped_rules"`               // Rules that name no technique
+	UnknownTechniques []string           `json:"unknown_techniques,omitempty"` // Named by rules but not in the ATT&CK tables
+	Tactics           []TacticPosture    `json:"tactics"`
+	Techniques        []TechniquePosture `json:"techniques"`
+	GeneratedAt       time.Time          `json:"generated_at"`
+}
@@ -9,11 +9,18 @@ type NotificationChannel struct {
 	ID          string                 `json:"id"`
 	LicenseID   string                 `json:"license_id"`
 	Name        string                 `json:"name"`
-	Type        string                 `json:"type"` // email, slack, pagerduty, webhook
+	Type        string                 `json:"type"` // email, slack, pagerduty, webhook, jira, servicenow
 	Enabled     bool                   `json:"enabled"`
 	Config      map[string]interface{} `json:"config"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
+	DeletedAt   *time.Time             `json:"deleted_at,omitempty"` // Set while soft-deleted
+	Version     int                    `json:"version"`              // Incremented on every edit; sent as the ETag
+
+	// Channel that receives messages of at least FallbackMinPriority when this one fails
+	FallbackChannelID   *string `json:"fallback_channel_id,omitempty"`
+	FallbackMinPriority string  `json:"fallback_min_priority,omitempty"`
+	Circuit             string  `json:"circuit,omitempty"` // closed, open, half_open
 }
 
 // CreateChannelRequest is the request body for creating a notification channel
@@ -23,6 +30,9 @@ type CreateChannelRequest struct {
 	Type        string                 `json:"type" binding:"required"`
 	Enabled     bool                   `json:"enabled"`
 	Config      map[string]interface{} `json:"config" binding:"required"`
+
+	FallbackChannelID   string `json:"fallback_channel_id"`
+	FallbackMinPriority string `json:"fallback_min_priority" binding:"omitempty,oneof=low medium high critical"`
 }
 
 // UpdateChannelRequest is the request body for updating a notification channel
@@ -30,6 +40,9 @@ type UpdateChannelRequest struct {
 	Name    *string                 `json:"name"`
 	Enabled *bool                   `json:"enabled"`
 	Config  *map[string]interface{} `json:"config"`
+
+	FallbackChannelID   *string `json:"fallback_channel_id"` // Empty string removes the fallback
+	FallbackMinPriority *string `json:"fallback_min_priority" binding:"omitempty,oneof=low medium high critical"`
 }
 
 // SendNotificationRequest is the request to send a notification
@@ -51,6 +64,7 @@ type NotificationLog struct {
 	Priority    string                 `json:"priority"`
 	Status      string                 `json:"status"` // sent, failed, pending
 	Error       string                 `json:"error,omitempty"`
+	FallbackFrom string                 `json:"fallback_from,omitempty"` // Failed channel this delivery stood in for
 	SentAt      time.Time              `json:"sent_at"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 }
@@ -83,10 +97,44 @@ type PagerDutyConfig struct {
 
 // WebhookConfig represents custom webhook configuration
 type WebhookConfig struct {
-	URL     string            `json:"url"`
-	Method  string            `json:"method"` // POST, PUT
-	Headers map[string]string `json:"headers,omitempty"`
-	Timeout int               `json:"timeout"` // seconds
+	URL         string            `json:"url"`
+	Method      string            `json:"method"` // POST, PUT, PATCH
+	Headers     map[string]string `json:"headers,omitempty"`
+	QueryParams map[string]string `json:"query_params,omitempty"` // Added to the URL's query string
+	Timeout     int               `json:"timeout"`                // seconds
+
+	// BodyTemplate is a Go text/template over WebhookTemplateData that replaces the default
+	// {subject, message, timestamp, metadata} body, e.g. to match a ServiceNow or Jira schema.
+	// With the default content type its output must be valid JSON; use {{json .Message}} to
+	// embed values as escaped JSON strings.
+	BodyTemplate string       `json:"body_template,omitempty"`
+	ContentType  string       `json:"content_type,omitempty"` // Default application/json
+	Auth         *WebhookAuth `json:"auth,omitempty"`
+}
+
+// WebhookAuth is a built-in authentication scheme for webhook requests
+type WebhookAuth struct {
+	Type string `json:"type"` // bearer, basic, hmac
+
+	Token string `json:"token,omitempty"` // bearer
+
+	Username string `json:"username,omitempty"` // basic
+	Password string `json:"password,omitempty"`
+
+	// hmac: the body is signed with HMAC-SHA256 over "<timestamp>.<body>". The signature is sent
+	// as sha256=<hex> in SignatureHeader and the Unix timestamp in X-Prive-Timestamp, so the
+	// receiver can reject replays.
+	Secret          string `json:"secret,omitempty"`
+	SignatureHeader string `json:"signature_header,omitempty"` // Default X-Prive-Signature
+}
+
+// WebhookTemplateData is what a webhook body template is executed with
+type WebhookTemplateData struct {
+	Subject   string
+	Message   string
+	Priority  string
+	Timestamp time.Time
+	Metadata  map[string]interface{}
 }
 
 // TestChannelRequest is used to test a notification channel
@@ -102,3 +150,68 @@ type TestChannelResponse struct {
 	TestedAt  time.Time `json:"tested_at"`
 	LatencyMs int64     `json:"latency_ms"`
 }
+
+// NotificationGroup is a named set of channels, such as an on-call rotation, notified together
+type NotificationGroup struct {
+	ID          string    `json:"id"`
+	LicenseID   string    `json:"license_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	ChannelIDs  []string  `json:"channel_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CreateNotificationGroupRequest is the request body for creating a notification group
+type CreateNotificationGroupRequest struct {
+	LicenseID   string   `json:"license_id" binding:"required"`
+	Name        string   `json:"name" binding:"required,max=255"`
+	Description string   `json:"description"`
+	ChannelIDs  []string `json:"channel_ids" binding:"required,min=1,max=100"`
+}
+
+// UpdateNotificationGroupRequest is the request body for updating a notification group
+type UpdateNotificationGroupRequest struct {
+	Name        *string   `json:"name" binding:"omitempty,max=255"`
+	Description *string   `json:"description"`
+	ChannelIDs  *[]string `json:"channel_ids" binding:"omitempty,min=1,max=100"`
+}
+
+// BroadcastNotificationRequest sends one notification to several channels of a license at once.
+// Targets combine: explicit channels, every channel of the given types, and group members.
+type BroadcastNotificationRequest struct {
+	LicenseID    string                 `json:"license_id" binding:"required"`
+	ChannelIDs   []string               `json:"channel_ids"`
+	ChannelTypes []string               `json:"channel_types"` // email, slack, pagerduty, webhook
+	Groups       []string               `json:"groups"`        // Group IDs or names
+	Subject      string                 `json:"subject" binding:"required"`
+	Message      string                 `json:"message" binding:"required"`
+	Priority     string                 `json:"priority" binding:"omitempty,oneof=low medium high critical"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// NotificationDeliveryResult is the outcome of a broadcast for one channel
+type NotificationDeliveryResult struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name,omitempty"`
+	ChannelType string `json:"channel_type,omitempty"`
+	Status      string `json:"status"` // sent, fallback, failed, skipped
+	Error       string `json:"error,omitempty"`
+	LogID       string `json:"log_id,omitempty"`
+	LatencyMs   int64  `json:"latency_ms"`
+
+	// Set when the channel failed and its fallback was tried
+	FallbackChannelID string `json:"fallback_channel_id,omitempty"`
+	FallbackLogID     string `json:"fallback_log_id,omitempty"`
+	FallbackError     string `json:"fallback_error,omitempty"`
+}
+
+// BroadcastNotificationResponse summarises a broadcast
+type BroadcastNotificationResponse struct {
+	Total   int                          `json:"total"`
+	Sent    int                          `json:"sent"`
+	Fallback int                          `json:"fallback"` // Delivered through the channel's fallback
+	Failed  int                          `json:"failed"`
+	Skipped int                          `json:"skipped"` // Disabled channels
+	Results []NotificationDeliveryResult `json:"results"`
+}
@@ -0,0 +1,68 @@
+// Role-Based Access Control Models
+// Roles held by principals and the permissions sensitive operations require
+
+package models
+
+// Roles
+const (
+	RoleAdmin     = "admin"     // Everything, including license and API key management
+	RoleAnalyst   = "analyst"   // Detection content, policies, investigations
+	RoleResponder = "responder" // Host response actions, deception deployment, investigations
+	RoleReadOnly  = "read_only" // Read access only
+	RoleMSSP      = "mssp"      // Read access, plus queries across the child licenses of its license
+
+	// RoleViewer is the legacy name of RoleReadOnly still found on older user records
+	RoleViewer = "viewer"
+)
+
+// Permissions checked by sensitive operations. Reads need no permission.
+const (
+	PermLicensesManage    = "licenses:manage"    // Issue, revoke and change licenses; platform principals only
+	PermAPIKeysManage     = "apikeys:manage"     // Issue, rotate and revoke API keys
+	PermAgentsManage      = "agents:manage"      // Remove agents; platform principals also roll out agent updates
+	PermAgentsRespond     = "agents:respond"     // Change agent configuration and state on a live host
+	PermAgentsIsolate     = "agents:isolate"     // Isolate hosts from the network and release them
+	PermDeceptionDeploy   = "deception:deploy"   // Deploy, change and remove honeypots and honey tokens
+	PermPoliciesManage    = "policies:manage"    // DLP, alerting, notification, retention and AI configuration
+	PermCommunityShare    = "community:share"    // Publish, vote on and report community content
+	PermCommunityModerate = "community:moderate" // Verify and remove community content
+	PermCasesManage       = "cases:manage"       // Open and work cases and acknowledge findings
+	PermTenantsQuery      = "tenants:query"      // Query telemetry across the child licenses of a parent license
+)
+
+// RolePermissions lists the permissions each role holds
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermLicensesManage, PermAPIKeysManage, PermAgentsManage, PermAgentsRespond,
+		PermAgentsIsolate, PermDeceptionDeploy, PermPoliciesManage, PermCommunityShare,
+		PermCommunityModerate, PermCasesManage, PermTenantsQuery,
+	},
+	RoleAnalyst:   {PermPoliciesManage, PermCommunityShare, PermCasesManage},
+	RoleResponder: {PermAgentsRespond, PermAgentsIsolate, PermDeceptionDeploy, PermCasesManage},
+	RoleReadOnly:  {},
+	RoleMSSP:      {PermTenantsQuery},
+}
+
+// NormalizeRole maps legacy role names to their current name
+func NormalizeRole(role string) string {
+	if role == RoleViewer {
+		return RoleReadOnly
+	}
+	return role
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[NormalizeRole(role)]
+	return ok
+}
+
+// RoleHasPermission reports whether role grants permission
+func RoleHasPermission(role, permission string) bool {
+	for _, p := range RolePermissions[NormalizeRole(role)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
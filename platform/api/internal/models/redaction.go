@@ -0,0 +1,44 @@
+// Payload Redaction Models
+// Per-license rules masking secrets and PII in event payloads before storage
+
+package models
+
+import "time"
+
+// RedactionPresets are the built-in patterns the consumer implements
+var RedactionPresets = []string{
+	"password",       // Values after password=, pwd:, --password and similar
+	"token",          // Bearer tokens and api_key/token assignments
+	"aws_access_key", // AWS access key IDs
+	"private_key",    // PEM private key blocks
+	"credit_card",    // 13-16 digit card numbers
+	"ssn",            // US social security numbers
+	"email",          // Email addresses
+}
+
+// RedactionRule masks matching payload values for one license. A rule uses a preset or a
+// pattern, optionally limited to Fields; a rule with only Fields masks those fields entirely.
+type RedactionRule struct {
+	ID          string    `json:"id"`
+	LicenseID   string    `json:"license_id"`
+	Name        string    `json:"name"`
+	Preset      string    `json:"preset,omitempty"`
+	Pattern     string    `json:"pattern,omitempty"` // RE2 syntax; the replacement may reference groups as ${1}
+	Fields      []string  `json:"fields"`
+	Replacement string    `json:"replacement,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RedactionRuleRequest is the request body for creating or replacing a redaction rule
+type RedactionRuleRequest struct {
+	LicenseID   string   `json:"license_id" binding:"required"`
+	Name        string   `json:"name" binding:"required,max=128"`
+	Preset      string   `json:"preset"`
+	Pattern     string   `json:"pattern" binding:"max=1024"`
+	Fields      []string `json:"fields" binding:"max=50,dive,required,max=128"`
+	Replacement string   `json:"replacement" binding:"max=64"`
+	Enabled     *bool    `json:"enabled"` // Defaults to true
+	UpdatedBy   string   `json:"updated_by"`
+}
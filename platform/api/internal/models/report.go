@@ -0,0 +1,68 @@
+// Security Report Models
+// Scheduled posture reports rendered to HTML/PDF and delivered through notification channels
+
+package models
+
+import "time"
+
+// Report sections
+const (
+	ReportSectionMITRECoverage = "mitre_coverage"
+	ReportSectionTopThreats    = "top_threats"
+	ReportSectionDLPViolations = "dlp_violations"
+	ReportSectionDeception     = "deception_summary"
+)
+
+// Report output formats
+const (
+	ReportFormatHTML = "html"
+	ReportFormatPDF  = "pdf"
+)
+
+// ScheduledJobReport is the scheduler job type that generates and delivers a report
+const ScheduledJobReport = "report"
+
+// ReportParams configures a scheduled report; stored as the schedule's params
+type ReportParams struct {
+	Title      string   `json:"title,omitempty"`
+	Sections   []string `json:"sections"`
+	Format     string   `json:"format"`      // html or pdf; PDF is attached to an HTML email
+	ChannelIDs []string `json:"channel_ids"` // Notification channels to deliver to
+	PeriodDays int      `json:"period_days"` // Reporting window ending at generation time
+}
+
+// CreateReportScheduleRequest schedules a recurring report
+type CreateReportScheduleRequest struct {
+	LicenseID      string   `json:"license_id" binding:"required"`
+	Name           string   `json:"name" binding:"required"`
+	CronExpression string   `json:"cron_expression" binding:"required"` // e.g. "0 8 * * mon" for Monday 08:00
+	Timezone       string   `json:"timezone"`
+	Title          string   `json:"title"`
+	Sections       []string `json:"sections"` // Defaults to all sections
+	Format         string   `json:"format"`   // Defaults to html
+	ChannelIDs     []string `json:"channel_ids" binding:"required,min=1"`
+	PeriodDays     int      `json:"period_days"` // Defaults to 7
+	Enabled        *bool    `json:"enabled"`
+}
+
+// ReportSchedule is a scheduled job of type report with its decoded parameters
+type ReportSchedule struct {
+	ScheduledJob
+	Report ReportParams `json:"report"`
+}
+
+// SecurityReport is the data behind a rendered report. Sections that could not be
+// generated are listed in Errors rather than failing the whole report.
+type SecurityReport struct {
+	LicenseID     string               `json:"license_id"`
+	Title         string               `json:"title"`
+	PeriodStart   time.Time            `json:"period_start"`
+	PeriodEnd     time.Time            `json:"period_end"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Sections      []string             `json:"sections"`
+	MITRECoverage *MITRECoverage       `json:"mitre_coverage,omitempty"`
+	TopThreats    *Statistics          `json:"top_threats,omitempty"`
+	DLPViolations *DLPViolationSummary `json:"dlp_violations,omitempty"`
+	Deception     *DeceptionStatistics `json:"deception_summary,omitempty"`
+	Errors        map[string]string    `json:"errors,omitempty"`
+}
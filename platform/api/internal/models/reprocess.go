@@ -0,0 +1,55 @@
+// Event Reprocessing Models
+// Jobs re-applying the consumer's current enrichment to already stored events
+
+package models
+
+import "time"
+
+// ReprocessEnrichments are the enrichments a reprocessing job can re-apply
+var ReprocessEnrichments = []string{
+	"geoip",      // dst_country, dst_asn, dst_as_org and src_country from the GeoIP database
+	"rdns",       // dst_hostname from reverse DNS
+	"reputation", // process_reputation from the hash reputation database
+	"mitre",      // Bare MITRE IDs in place of the "TA0002_Execution" form of older agents
+}
+
+// Reprocessing job statuses
+const (
+	ReprocessStatusPending   = "pending"
+	ReprocessStatusRunning   = "running"
+	ReprocessStatusCompleted = "completed"
+	ReprocessStatusFailed    = "failed"
+	ReprocessStatusCancelled = "cancelled"
+)
+
+// ReprocessJob re-enriches a license's events in a time range. A consumer claims the job and
+// works through the range one monthly partition at a time; enrichments whose data source that
+// consumer has not loaded are dropped from Enrichments when it starts.
+type ReprocessJob struct {
+	ID              string     `json:"id"`
+	LicenseID       string     `json:"license_id"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         time.Time  `json:"end_time"`
+	Enrichments     []string   `json:"enrichments"`
+	Status          string     `json:"status"`
+	ClaimedBy       string     `json:"claimed_by,omitempty"` // Consumer instance running the job
+	TotalPartitions uint32     `json:"total_partitions"`
+	DonePartitions  uint32     `json:"done_partitions"`
+	TotalEvents     uint64     `json:"total_events"`
+	ProcessedEvents uint64     `json:"processed_events"`
+	ProgressPercent float64    `json:"progress_percent"`
+	Error           string     `json:"error,omitempty"`
+	RequestedBy     string     `json:"requested_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// CreateReprocessJobRequest is the request body for starting a reprocessing job
+type CreateReprocessJobRequest struct {
+	LicenseID   string   `json:"license_id" binding:"required"`
+	StartTime   string   `json:"start_time" binding:"required"` // RFC3339
+	EndTime     string   `json:"end_time" binding:"required"`   // RFC3339, exclusive
+	Enrichments []string `json:"enrichments"`                   // Defaults to all
+	RequestedBy string   `json:"requested_by"`
+}
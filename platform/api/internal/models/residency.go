@@ -0,0 +1,71 @@
+// Data Residency Models
+// Per-license pinning of stored data to a geographic zone
+
+package models
+
+import "time"
+
+// ResidencyZone is a geographic zone and the storage regions of each provider inside it
+type ResidencyZone struct {
+	Name    string                        `json:"name"`
+	Regions map[DataLakeProvider][]string `json:"regions"`
+}
+
+// ResidencyZones are the zones a license can be pinned to, keyed by ID
+var ResidencyZones = map[string]ResidencyZone{
+	"eu": {
+		Name: "European Union",
+		Regions: map[DataLakeProvider][]string{
+			ProviderS3:        {"eu-central-1", "eu-central-2", "eu-west-1", "eu-west-3", "eu-north-1", "eu-south-1", "eu-south-2"},
+			ProviderGCS:       {"EU", "europe-west1", "europe-west3", "europe-west4", "europe-west8", "europe-west9", "europe-north1", "europe-central2", "europe-southwest1"},
+			ProviderAzureBlob: {"westeurope", "northeurope", "germanywestcentral", "francecentral", "swedencentral", "italynorth", "polandcentral"},
+		},
+	},
+	"uk": {
+		Name: "United Kingdom",
+		Regions: map[DataLakeProvider][]string{
+			ProviderS3:        {"eu-west-2"},
+			ProviderGCS:       {"europe-west2"},
+			ProviderAzureBlob: {"uksouth", "ukwest"},
+		},
+	},
+	"us": {
+		Name: "United States",
+		Regions: map[DataLakeProvider][]string{
+			ProviderS3:        {"us-east-1", "us-east-2", "us-west-1", "us-west-2"},
+			ProviderGCS:       {"US", "us-central1", "us-east1", "us-east4", "us-west1", "us-west2"},
+			ProviderAzureBlob: {"eastus", "eastus2", "centralus", "westus", "westus2", "westus3"},
+		},
+	},
+	"apac": {
+		Name: "Asia Pacific",
+		Regions: map[DataLakeProvider][]string{
+			ProviderS3:        {"ap-southeast-1", "ap-southeast-2", "ap-northeast-1", "ap-northeast-2", "ap-south-1"},
+			ProviderGCS:       {"ASIA", "asia-southeast1", "asia-northeast1", "asia-east1", "asia-south1", "australia-southeast1"},
+			ProviderAzureBlob: {"southeastasia", "eastasia", "japaneast", "australiaeast", "centralindia"},
+		},
+	},
+}
+
+// DataResidency pins a license's stored data to a zone. Data lake configurations and archive
+// jobs must use a region of the zone, limited to AllowedRegions when set.
+type DataResidency struct {
+	LicenseID       string    `json:"license_id"`
+	Zone            string    `json:"zone"`
+	AllowedRegions  []string  `json:"allowed_regions"`            // Empty allows every region of the zone
+	DefaultRegion   string    `json:"default_region,omitempty"`   // Used when a data lake configuration names no region
+	ClickHouseShard string    `json:"clickhouse_shard,omitempty"` // Set when the deployment maps the zone to a shard
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	DataLakeCompliant *bool `json:"data_lake_compliant,omitempty"` // Whether the current data lake configuration complies; nil without one
+}
+
+// DataResidencyRequest is the request body for setting a license's data residency
+type DataResidencyRequest struct {
+	Zone           string   `json:"zone" binding:"required"`
+	AllowedRegions []string `json:"allowed_regions" binding:"max=50"`
+	DefaultRegion  string   `json:"default_region"`
+	UpdatedBy      string   `json:"updated_by"`
+}
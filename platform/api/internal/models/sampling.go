@@ -0,0 +1,47 @@
+// Event Sampling Models
+// Per-license policies that sample or aggregate high-volume, low-value event types
+
+package models
+
+import "time"
+
+// Sampling modes
+const (
+	SamplingModeSample    = "sample"    // Store 1 in SampleRate events
+	SamplingModeAggregate = "aggregate" // Store only per-minute counts
+)
+
+// UnsampledEventTypes are security-relevant event types that are always stored in full
+var UnsampledEventTypes = []string{"dlp_violation", "authentication"}
+
+// SamplingPolicy reduces how many events of one type the consumer stores for a license. Events
+// at or above KeepMinSeverity, events mapped to a MITRE technique and events from processes with
+// a bad reputation are always stored; the rest are counted in per-minute rollups.
+type SamplingPolicy struct {
+	LicenseID       string    `json:"license_id"`
+	EventType       string    `json:"event_type"`
+	Mode            string    `json:"mode"`
+	SampleRate      uint32    `json:"sample_rate"`
+	KeepMinSeverity uint8     `json:"keep_min_severity"`
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SetSamplingPolicyRequest is the request body for creating or replacing a sampling policy
+type SetSamplingPolicyRequest struct {
+	LicenseID       string `json:"license_id" binding:"required"`
+	Mode            string `json:"mode" binding:"required"` // sample or aggregate
+	SampleRate      uint32 `json:"sample_rate,omitempty"`   // Required for sample, e.g. 100 keeps 1 in 100
+	KeepMinSeverity *uint8 `json:"keep_min_severity,omitempty"`
+	UpdatedBy       string `json:"updated_by"`
+}
+
+// EventRollup is the number of events of a type that were counted instead of stored, per minute
+type EventRollup struct {
+	Minute      time.Time `json:"minute"`
+	EventType   string    `json:"event_type"`
+	AgentID     string    `json:"agent_id"`
+	Hostname    string    `json:"hostname"`
+	ProcessName string    `json:"process_name,omitempty"`
+	EventCount  uint64    `json:"event_count"`
+}
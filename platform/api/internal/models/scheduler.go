@@ -0,0 +1,69 @@
+// Job Scheduler Models
+// Persisted cron schedules for recurring background jobs
+
+package models
+
+import "time"
+
+// Built-in scheduled job types
+const (
+	ScheduledJobArchive       = "archive"        // Archive the previous day of telemetry for auto-archive tenants
+	ScheduledJobRetention     = "retention"      // Enforce hot storage retention
+	ScheduledJobUsageSnapshot = "usage_snapshot" // Capture license usage snapshots
+	ScheduledJobCorrelation   = "correlation"    // Run alert correlation
+	ScheduledJobLogRetention  = "log_retention"  // Expire old notification and license audit log entries
+)
+
+// Last run outcomes
+const (
+	ScheduleRunSucceeded = "succeeded"
+	ScheduleRunFailed    = "failed"
+	ScheduleRunRunning   = "running"
+)
+
+// ScheduledJob is a recurring job run on a cron schedule in a time zone
+type ScheduledJob struct {
+	ID             string                 `json:"id"`
+	LicenseID      string                 `json:"license_id,omitempty"` // Empty for platform-wide jobs
+	Name           string                 `json:"name"`
+	JobType        string                 `json:"job_type"`
+	CronExpression string                 `json:"cron_expression"` // minute hour day-of-month month day-of-week, or @daily etc.
+	Timezone       string                 `json:"timezone"`        // IANA name, e.g. Europe/Istanbul
+	Enabled        bool                   `json:"enabled"`
+	Params         map[string]interface{} `json:"params,omitempty"`
+	LastRunAt      *time.Time             `json:"last_run_at,omitempty"`
+	LastStatus     string                 `json:"last_status,omitempty"` // succeeded, failed, running
+	LastResult     string                 `json:"last_result,omitempty"`
+	LastError      string                 `json:"last_error,omitempty"`
+	LastDurationMs int64                  `json:"last_duration_ms,omitempty"`
+	NextRunAt      *time.Time             `json:"next_run_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
+}
+
+// CreateScheduledJobRequest is the request body for creating a schedule
+type CreateScheduledJobRequest struct {
+	LicenseID      string                 `json:"license_id"`
+	Name           string                 `json:"name" binding:"required"`
+	JobType        string                 `json:"job_type" binding:"required"`
+	CronExpression string                 `json:"cron_expression" binding:"required"`
+	Timezone       string                 `json:"timezone"` // Defaults to the scheduler's time zone
+	Enabled        *bool                  `json:"enabled"`  // Defaults to true
+	Params         map[string]interface{} `json:"params"`
+}
+
+// UpdateScheduledJobRequest is the request body for updating a schedule
+type UpdateScheduledJobRequest struct {
+	Name           *string                 `json:"name"`
+	CronExpression *string                 `json:"cron_expression"`
+	Timezone       *string                 `json:"timezone"`
+	Enabled        *bool                   `json:"enabled"`
+	Params         *map[string]interface{} `json:"params"`
+}
+
+// SchedulePreviewRequest asks for the next run times of an expression without saving it
+type SchedulePreviewRequest struct {
+	CronExpression string `json:"cron_expression" binding:"required"`
+	Timezone       string `json:"timezone"`
+	Count          int    `json:"count"`
+}
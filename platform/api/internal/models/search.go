@@ -0,0 +1,44 @@
+// Global Search Models
+// Normalized results for the cross-entity search box
+
+package models
+
+import "time"
+
+// Search categories
+const (
+	SearchCategoryAgents    = "agents"
+	SearchCategoryEvents    = "events"
+	SearchCategoryIOCs      = "iocs"
+	SearchCategoryRules     = "rules"
+	SearchCategoryHoneypots = "honeypots"
+)
+
+// SearchResult is one match from any backend, normalized for display
+type SearchResult struct {
+	Category     string     `json:"category"`
+	ID           string     `json:"id"`
+	Title        string     `json:"title"`
+	Subtitle     string     `json:"subtitle,omitempty"`
+	MatchedField string     `json:"matched_field"`
+	Score        float64    `json:"score"` // 0-1; exact matches rank above prefix and substring matches
+	Link         string     `json:"link"`  // API path of the full entity
+	Timestamp    *time.Time `json:"timestamp,omitempty"`
+}
+
+// SearchCategory groups the results from one backend
+type SearchCategory struct {
+	Category string         `json:"category"`
+	Results  []SearchResult `json:"results"`
+	Total    int            `json:"total"`
+	Error    string         `json:"error,omitempty"` // Set when the backend failed or is unavailable
+}
+
+// SearchResponse is the response of GET /search
+type SearchResponse struct {
+	Query      string           `json:"query"`
+	QueryType  string           `json:"query_type"` // ip, hash, domain, email or text
+	Categories []SearchCategory `json:"categories"` // Ordered by best match
+	Total      int              `json:"total"`
+	TookMs     int64            `json:"took_ms"`
+}
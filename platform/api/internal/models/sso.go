@@ -0,0 +1,74 @@
+// Single Sign-On Models
+// OpenID Connect and SAML identity provider configuration and dashboard login sessions
+
+package models
+
+import "time"
+
+// SSO provider types
+const (
+	SSOTypeOIDC = "oidc"
+	SSOTypeSAML = "saml"
+)
+
+// SSOProvider configures one OpenID Connect or SAML 2.0 identity provider. Providers are loaded
+// from the JSON file named by SSO_CONFIG_PATH, which holds an array of them.
+type SSOProvider struct {
+	ID          string `json:"id"`                     // Used in URLs, e.g. "okta"
+	Name        string `json:"name"`                   // Shown on the login page
+	Type        string `json:"type,omitempty"`         // "oidc" (default) or "saml"
+	Issuer      string `json:"issuer"`                 // OIDC issuer URL, or the SAML IdP entity ID
+	RedirectURL string `json:"redirect_url"`           // This API's /api/v1/auth/sso/callback (OIDC) or /api/v1/auth/sso/acs (SAML)
+	GroupsClaim string `json:"groups_claim,omitempty"` // ID token claim or SAML attribute holding group names, default "groups"
+
+	// OpenID Connect
+	ClientID     string   `json:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"` // Default: openid email profile
+
+	// SAML 2.0. The ACS URL (redirect_url) must use https: the IdP posts the response
+	// cross-site, so the login state cookie has to be SameSite=None and therefore Secure.
+	SSOURL         string `json:"sso_url,omitempty"`         // IdP single sign-on endpoint (HTTP-Redirect binding)
+	Certificate    string `json:"certificate,omitempty"`     // PEM certificate the IdP signs responses with
+	EntityID       string `json:"entity_id,omitempty"`       // This service provider's entity ID, default redirect_url
+	EmailAttribute string `json:"email_attribute,omitempty"` // Attribute holding the email address, default the NameID
+	NameAttribute  string `json:"name_attribute,omitempty"`  // Attribute holding the display name
+
+	// RoleMappings map IdP groups to platform roles; the first mapping the user matches wins
+	RoleMappings []SSORoleMapping `json:"role_mappings"`
+	DefaultRole  string           `json:"default_role,omitempty"` // For users matching no mapping; empty denies login
+
+	LicenseID         string   `json:"license_id,omitempty"`          // License users of this IdP belong to; empty for platform operators
+	AllowedDomains    []string `json:"allowed_domains,omitempty"`     // Restrict logins to these email domains
+	PostLoginRedirect string   `json:"post_login_redirect,omitempty"` // Dashboard URL that receives the token; JSON response when empty
+}
+
+// SSORoleMapping maps an IdP group to a platform role
+type SSORoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// SSOProviderInfo is the public description of a provider for the login page
+type SSOProviderInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+// AuthenticatedUser is a platform user signed in through SSO
+type AuthenticatedUser struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	FullName  string `json:"full_name,omitempty"`
+	Role      string `json:"role"`
+	LicenseID string `json:"license_id,omitempty"`
+	Provider  string `json:"provider"`
+}
+
+// SSOLoginResponse carries the platform token issued after a successful SSO login
+type SSOLoginResponse struct {
+	Token     string            `json:"token"` // Sent as "Authorization: Bearer <token>"
+	ExpiresAt time.Time         `json:"expires_at"`
+	User      AuthenticatedUser `json:"user"`
+}
@@ -0,0 +1,63 @@
+// Alert Suppression Models
+// Analyst-maintained false-positive suppressions for specific rule and entity combinations
+
+package models
+
+import "time"
+
+// SuppressionEntityTypes are the alert entities a suppression can match on
+var SuppressionEntityTypes = []string{
+	"hostname", "agent_id", "username", "source_ip", "dst_ip", "process_name", "file_path", "hash",
+}
+
+// Suppression audit actions
+const (
+	SuppressionActionCreated = "created"
+	SuppressionActionRemoved = "removed"
+)
+
+// AlertSuppression silences one alert rule for one entity, optionally until an expiry
+type AlertSuppression struct {
+	ID               string     `json:"id"`
+	LicenseID        string     `json:"license_id"`
+	RuleID           string     `json:"rule_id"`
+	RuleName         string     `json:"rule_name,omitempty"`
+	EntityType       string     `json:"entity_type"`
+	EntityValue      string     `json:"entity_value"`
+	Reason           string     `json:"reason"`
+	CreatedBy        string     `json:"created_by,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	SuppressedCount  int64      `json:"suppressed_count"` // Alerts silenced so far
+	LastSuppressedAt *time.Time `json:"last_suppressed_at,omitempty"`
+	RemovedAt        *time.Time `json:"removed_at,omitempty"`
+	RemovedBy        string     `json:"removed_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Active           bool       `json:"active"` // Not removed and not expired
+}
+
+// CreateSuppressionRequest is the request body for suppressing a rule for an entity
+type CreateSuppressionRequest struct {
+	LicenseID   string     `json:"license_id" binding:"required"`
+	RuleID      string     `json:"rule_id" binding:"required"`
+	EntityType  string     `json:"entity_type" binding:"required"`
+	EntityValue string     `json:"entity_value" binding:"required"`
+	Reason      string     `json:"reason" binding:"required"` // Why the activity is known-good
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`      // Omit to suppress until removed
+	CreatedBy   string     `json:"created_by"`
+}
+
+// RemoveSuppressionRequest is the optional request body for removing a suppression
+type RemoveSuppressionRequest struct {
+	RemovedBy string `json:"removed_by"`
+	Reason    string `json:"reason"`
+}
+
+// SuppressionAuditEntry records a change to a suppression
+type SuppressionAuditEntry struct {
+	ID            string                 `json:"id"`
+	SuppressionID string                 `json:"suppression_id"`
+	Action        string                 `json:"action"`
+	PerformedBy   string                 `json:"performed_by,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
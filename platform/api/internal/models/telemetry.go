@@ -24,6 +24,7 @@ type TelemetryEvent struct {
 	DstPort          uint16                 `json:"dst_port,omitempty"`
 	Username         string                 `json:"username,omitempty"`
 	IngestionDate    time.Time              `json:"ingestion_date"`
+	Redacted         bool                   `json:"redacted,omitempty"` // Payload values were masked before storage
 }
 
 // QueryEventsRequest defines the request parameters for querying events
@@ -41,10 +42,12 @@ type QueryEventsRequest struct {
 	FilePaths        []string `json:"file_paths,omitempty"`
 	DstIPs           []string `json:"dst_ips,omitempty"`
 	SearchText       string   `json:"search_text,omitempty"` // Full-text search in payload
+	CustomFields     map[string][]string `json:"custom_fields,omitempty"` // Custom field name -> accepted values
 	Limit            int      `json:"limit,omitempty"`
 	Offset           int      `json:"offset,omitempty"`
 	OrderBy          string   `json:"order_by,omitempty"` // timestamp, severity, hostname
 	OrderDirection   string   `json:"order_direction,omitempty"` // asc, desc
+	Confirm          bool     `json:"confirm,omitempty"` // Run even though the scan estimate is above the confirmation threshold
 }
 
 // QueryEventsResponse wraps the query results with metadata
@@ -54,6 +57,100 @@ type QueryEventsResponse struct {
 	Limit       int              `json:"limit"`
 	Offset      int              `json:"offset"`
 	QueryTimeMs int64            `json:"query_time_ms"`
+	Estimate    *QueryCostEstimate `json:"estimate,omitempty"` // Pre-flight scan estimate, when guardrails are enabled
+}
+
+// QueryCostEstimate is ClickHouse's pre-flight estimate of what a telemetry query would read
+type QueryCostEstimate struct {
+	Rows                 uint64  `json:"rows"`  // Rows left after partition and primary key pruning
+	Parts                uint64  `json:"parts"` // Data parts to read
+	Marks                uint64  `json:"marks"` // Index granules to read
+	RangeDays            float64 `json:"range_days"`
+	ConfirmScanRows      uint64  `json:"confirm_scan_rows,omitempty"`
+	MaxScanRows          uint64  `json:"max_scan_rows,omitempty"`
+	RequiresConfirmation bool    `json:"requires_confirmation"`
+	Rejected             bool    `json:"rejected"`
+}
+
+// TenantQueryLimits are per-license ClickHouse query limits. Unset fields fall back to the
+// license tier's limits, then to the global defaults.
+type TenantQueryLimits struct {
+	MaxExecutionSeconds *int    `json:"max_execution_seconds,omitempty"`
+	MaxResultRows       *uint64 `json:"max_result_rows,omitempty"`
+	ConfirmScanRows     *uint64 `json:"confirm_scan_rows,omitempty"`
+	MaxScanRows         *uint64 `json:"max_scan_rows,omitempty"`
+}
+
+// TenantQueryLimitsResponse shows a license's overrides next to the limits in effect
+type TenantQueryLimitsResponse struct {
+	LicenseID string            `json:"license_id"`
+	Tier      string            `json:"tier"`
+	Overrides TenantQueryLimits `json:"overrides"`
+	Effective TenantQueryLimits `json:"effective"` // Zero means unlimited
+}
+
+// BatchGetEventsRequest fetches multiple events by ID in a single query
+type BatchGetEventsRequest struct {
+	TenantID string   `json:"tenant_id" binding:"required"`
+	EventIDs []string `json:"event_ids" binding:"required,min=1,max=1000"`
+}
+
+// BatchGetEventsResponse returns events in the order they were requested
+type BatchGetEventsResponse struct {
+	Events  []TelemetryEvent `json:"events"`
+	Count   int              `json:"count"`
+	Missing []string         `json:"missing,omitempty"`
+}
+
+// PivotRequest finds events related to a seed event through one or more attribute hops.
+// Hops are applied in order, e.g. ["file_path", "process_name"] finds events touching the
+// seed's file, then all events from the processes that touched it.
+type PivotRequest struct {
+	TenantID      string   `json:"tenant_id" binding:"required"`
+	SeedEventID   string   `json:"seed_event_id" binding:"required"`
+	Hops          []string `json:"hops" binding:"required,min=1,max=5"` // process_name, dst_ip, username, agent_id, hostname, file_path
+	WindowMinutes int      `json:"window_minutes,omitempty"`            // Minutes either side of the seed event
+	Limit         int      `json:"limit,omitempty"`                     // Max events per hop
+}
+
+// PivotHopResult holds the events matched by a single pivot hop
+type PivotHopResult struct {
+	Field  string           `json:"field"`
+	Values []string         `json:"values"`
+	Events []TelemetryEvent `json:"events"`
+}
+
+// PivotResponse wraps the seed event and the results of each hop
+type PivotResponse struct {
+	SeedEvent   TelemetryEvent   `json:"seed_event"`
+	Hops        []PivotHopResult `json:"hops"`
+	TimeRange   TimeRange        `json:"time_range"`
+	QueryTimeMs int64            `json:"query_time_ms"`
+}
+
+// ProcessNode is a single process in a reconstructed process tree
+type ProcessNode struct {
+	PID         uint32           `json:"pid"`
+	PPID        uint32           `json:"ppid"`
+	EventID     string           `json:"event_id,omitempty"` // process_start event
+	ProcessName string           `json:"process_name,omitempty"`
+	CommandLine string           `json:"cmdline,omitempty"`
+	User        string           `json:"user,omitempty"`
+	Hash        string           `json:"hash,omitempty"`
+	StartTime   *time.Time       `json:"start_time,omitempty"` // nil if started before the window
+	EndTime     *time.Time       `json:"end_time,omitempty"`
+	ExitCode    *uint32          `json:"exit_code,omitempty"`
+	Events      []TelemetryEvent `json:"events"` // File, network and registry activity
+	Children    []*ProcessNode   `json:"children"`
+}
+
+// ProcessTreeResponse wraps the process forest for an agent and time range
+type ProcessTreeResponse struct {
+	AgentID    string         `json:"agent_id"`
+	Roots      []*ProcessNode `json:"roots"`
+	EventCount int            `json:"event_count"`
+	Truncated  bool           `json:"truncated"`
+	TimeRange  TimeRange      `json:"time_range"`
 }
 
 // StatisticsRequest defines parameters for statistics queries
@@ -74,6 +171,10 @@ type Statistics struct {
 	UniqueAgents      int64                  `json:"unique_agents"`
 	UniqueHosts       int64                  `json:"unique_hosts"`
 	TimeRange         TimeRange              `json:"time_range"`
+
+	// Deception events in the range; their tactics are counted in TopMitreTactics
+	DeceptionEvents       int64            `json:"deception_events"`
+	DeceptionEventsByType map[string]int64 `json:"deception_events_by_type,omitempty"`
 }
 
 // MitreStat represents statistics for MITRE tactics/techniques
@@ -100,13 +201,14 @@ type MITRETactic struct {
 
 // MITRETechnique represents a MITRE ATT&CK technique
 type MITRETechnique struct {
-	TechniqueID string   `json:"technique_id"`
-	TacticID    string   `json:"tactic_id,omitempty"`
-	Name        string   `json:"name"`
-	Description string   `json:"description,omitempty"`
-	Platforms   []string `json:"platforms,omitempty"`
-	DataSources []string `json:"data_sources,omitempty"`
-	URL         string   `json:"url,omitempty"`
+	TechniqueID       string   `json:"technique_id"`
+	TacticID          string   `json:"tactic_id,omitempty"`
+	Name              string   `json:"name"`
+	Description       string   `json:"description,omitempty"`
+	Platforms         []string `json:"platforms,omitempty"`
+	DataSources       []string `json:"data_sources,omitempty"`
+	URL               string   `json:"url,omitempty"`
+	ParentTechniqueID string   `json:"parent_technique_id,omitempty"` // Set on sub-techniques
 }
 
 // MITRECoverage represents detection coverage for MITRE framework
@@ -117,6 +219,7 @@ type MITRECoverage struct {
 	CoveragePercent  float64                       `json:"coverage_percent"`
 	CoverageByTactic map[string]TacticCoverage     `json:"coverage_by_tactic"`
 	DetectedTechniques []DetectedTechnique         `json:"detected_techniques"`
+	DeceptionOnlyCount int                         `json:"deception_only_count"` // Detected only through deception assets
 }
 
 // TacticCoverage represents coverage for a specific tactic
@@ -135,6 +238,8 @@ type DetectedTechnique struct {
 	EventCount  int64  `json:"event_count"`
 	FirstSeen   time.Time `json:"first_seen"`
 	LastSeen    time.Time `json:"last_seen"`
+	DeceptionEventCount int64    `json:"deception_event_count,omitempty"` // Included in EventCount
+	Sources             []string `json:"sources,omitempty"`               // telemetry, deception
 }
 
 // AlertRule represents an alerting rule
@@ -147,6 +252,7 @@ type AlertRule struct {
 	Enabled     bool                   `json:"enabled"`
 	Condition   map[string]interface{} `json:"condition"`
 	Actions     []map[string]interface{} `json:"actions,omitempty"`
+	MitreTechniques []string           `json:"mitre_techniques"` // Techniques the rule is designed to detect
 	CreatedBy   string                 `json:"created_by,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
@@ -161,6 +267,7 @@ type CreateAlertRuleRequest struct {
 	Enabled     bool                     `json:"enabled"`
 	Condition   map[string]interface{}   `json:"condition" binding:"required"`
 	Actions     []map[string]interface{} `json:"actions"`
+	MitreTechniques []string             `json:"mitre_techniques" binding:"max=100,dive,mitre_technique"`
 	CreatedBy   string                   `json:"created_by"`
 }
 
@@ -172,4 +279,112 @@ type UpdateAlertRuleRequest struct {
 	Enabled     *bool                     `json:"enabled"`
 	Condition   *map[string]interface{}   `json:"condition"`
 	Actions     *[]map[string]interface{} `json:"actions"`
+	MitreTechniques *[]string             `json:"mitre_techniques" binding:"omitempty,max=100,dive,mitre_technique"`
+}
+
+// Integrity issue types reported by chain verification
+const (
+	IntegrityEntryMissing   = "entry_missing"   // A ledger entry was deleted
+	IntegrityEntryModified  = "entry_modified"  // A ledger entry no longer matches its chain hash
+	IntegrityBrokenLink     = "broken_link"     // prev_hash does not match the preceding entry
+	IntegrityEventsMissing  = "events_missing"  // Fewer events are stored than the entry recorded
+	IntegrityEventsAdded    = "events_added"    // Events were inserted into a recorded batch
+	IntegrityEventsModified = "events_modified" // Stored event contents differ from what was recorded
+)
+
+// IntegrityIssue is one detected break in a tenant's hash chain
+type IntegrityIssue struct {
+	Type    string `json:"type"`
+	ChainID string `json:"chain_id"`
+	Seq     uint64 `json:"seq"`
+	BatchID string `json:"batch_id,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// IntegrityVerification is the result of verifying a tenant's ledger over a time range
+type IntegrityVerification struct {
+	TenantID       string           `json:"tenant_id"`
+	TimeRange      TimeRange        `json:"time_range"`
+	Verified       bool             `json:"verified"`
+	Chains         int              `json:"chains"`
+	EntriesChecked int              `json:"entries_checked"`
+	EventsChecked  int64            `json:"events_checked"`
+	Issues         []IntegrityIssue `json:"issues"`
+	Truncated      bool             `json:"truncated"` // Not every entry or issue was checked; narrow the range
+}
+
+// IOC types accepted by the IOC sweep
+const (
+	IOCTypeIP     = "ip"
+	IOCTypeDomain = "domain"
+	IOCTypeHash   = "hash"
+)
+
+// IOCSweepIndicator is one indicator to sweep for. An empty type is inferred from the value.
+type IOCSweepIndicator struct {
+	Type  string `json:"type,omitempty" binding:"omitempty,oneof=ip domain hash"`
+	Value string `json:"value" binding:"required,max=512"`
+}
+
+// IOCSweepRequest checks a tenant's telemetry in a time range against a list of indicators
+type IOCSweepRequest struct {
+	TenantID  string              `json:"tenant_id" binding:"required"`
+	StartTime string              `json:"start_time" binding:"required"` // RFC3339
+	EndTime   string              `json:"end_time" binding:"required"`
+	IOCs      []IOCSweepIndicator `json:"iocs" binding:"required,min=1,max=1000,dive"`
+	Limit     int                 `json:"limit,omitempty"` // Max matching events returned
+}
+
+// IOCSweepMatch summarizes the telemetry that matched one indicator
+type IOCSweepMatch struct {
+	Type       string    `json:"type"`
+	Value      string    `json:"value"`
+	EventCount uint64    `json:"event_count"`
+	AgentCount uint64    `json:"agent_count"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// IOCSweepEvent is a matching event with the indicators it matched, as type:value
+type IOCSweepEvent struct {
+	Event TelemetryEvent `json:"event"`
+	IOCs  []string       `json:"iocs"`
+}
+
+// IOCSweepResponse lists the indicators seen in the time range and the most recent matching events
+type IOCSweepResponse struct {
+	Matched     []IOCSweepMatch     `json:"matched"`
+	Unmatched   []IOCSweepIndicator `json:"unmatched"`
+	Events      []IOCSweepEvent     `json:"events"`
+	Truncated   bool                `json:"truncated"` // More events matched than were returned
+	TimeRange   TimeRange           `json:"time_range"`
+	QueryTimeMs int64               `json:"query_time_ms"`
+}
+
+// CrossTenantQueryRequest queries events across the child licenses a parent license manages.
+// TenantID is the parent license; the filters apply to every included tenant.
+type CrossTenantQueryRequest struct {
+	QueryEventsRequest
+	TenantIDs []string `json:"tenant_ids,omitempty" binding:"omitempty,max=500,dive,uuid"` // Child licenses to include, default every child; may include the parent itself
+}
+
+// TenantEventBreakdown is one tenant's share of a cross-tenant query
+type TenantEventBreakdown struct {
+	TenantID         string          `json:"tenant_id"`
+	Name             string          `json:"name"`
+	EventCount       int64           `json:"event_count"`
+	EventsBySeverity map[uint8]int64 `json:"events_by_severity"`
+	UniqueAgents     int64           `json:"unique_agents"`
+	UniqueHosts      int64           `json:"unique_hosts"`
+}
+
+// CrossTenantQueryResponse holds the most recent matching events across tenants and per-tenant totals
+type CrossTenantQueryResponse struct {
+	Events      []TelemetryEvent       `json:"events"`
+	Tenants     []TenantEventBreakdown `json:"tenants"`
+	Total       int64                  `json:"total"`
+	Limit       int                    `json:"limit"`
+	Offset      int                    `json:"offset"`
+	QueryTimeMs int64                  `json:"query_time_ms"`
+	Estimate    *QueryCostEstimate     `json:"estimate,omitempty"`
 }
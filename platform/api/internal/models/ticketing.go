@@ -0,0 +1,75 @@
+// Ticketing Channel Models
+// Jira and ServiceNow channels that open a ticket per alert and close it when the alert resolves
+
+package models
+
+import "time"
+
+// ScheduledJobTicketSync is the scheduler job type that closes the tickets of resolved alerts
+const ScheduledJobTicketSync = "ticket_sync"
+
+// Ticket statuses
+const (
+	TicketStatusOpen   = "open"
+	TicketStatusClosed = "closed"
+)
+
+// JiraConfig is the config of a jira channel. Jira Cloud authenticates with Email and APIToken;
+// Jira Server and Data Center with a PersonalAccessToken.
+type JiraConfig struct {
+	BaseURL             string `json:"base_url"` // e.g. https://example.atlassian.net
+	Email               string `json:"email,omitempty"`
+	APIToken            string `json:"api_token,omitempty"`
+	PersonalAccessToken string `json:"personal_access_token,omitempty"`
+
+	ProjectKey string            `json:"project_key"`
+	ProjectMap map[string]string `json:"project_map,omitempty"` // Alert severity to project key, overriding ProjectKey
+	IssueType  string            `json:"issue_type,omitempty"`  // Default Task
+	Assignee   string            `json:"assignee,omitempty"`    // accountId on Cloud, user name otherwise
+	Labels     []string          `json:"labels,omitempty"`
+
+	// PriorityMap maps alert severity to a Jira priority name. Default critical=Highest,
+	// high=High, medium=Medium, low=Low.
+	PriorityMap map[string]string `json:"priority_map,omitempty"`
+
+	CloseOnResolve  bool   `json:"close_on_resolve"`
+	CloseTransition string `json:"close_transition,omitempty"` // Workflow transition name, default Done
+}
+
+// ServiceNowConfig is the config of a servicenow channel. Requests use basic auth unless
+// ClientID is set, in which case an OAuth token is requested with the password grant.
+type ServiceNowConfig struct {
+	InstanceURL  string `json:"instance_url"` // e.g. https://example.service-now.com
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	AssignmentGroup string `json:"assignment_group,omitempty"` // sys_id or name
+	CallerID        string `json:"caller_id,omitempty"`
+	Category        string `json:"category,omitempty"`
+
+	// UrgencyMap and ImpactMap map alert severity to incident urgency and impact (1-3). Default
+	// critical=1/1, high=1/2, medium=2/2, low=3/3.
+	UrgencyMap map[string]string `json:"urgency_map,omitempty"`
+	ImpactMap  map[string]string `json:"impact_map,omitempty"`
+
+	CloseOnResolve bool   `json:"close_on_resolve"`
+	CloseCode      string `json:"close_code,omitempty"`  // Default "Solved (Permanently)"
+	CloseNotes     string `json:"close_notes,omitempty"` // Default names the resolved alert
+}
+
+// NotificationTicket is a ticket opened through a ticketing channel
+type NotificationTicket struct {
+	ID          string     `json:"id"`
+	ChannelID   *string    `json:"channel_id,omitempty"`
+	AlertID     *string    `json:"alert_id,omitempty"`
+	System      string     `json:"system"`                 // jira, servicenow
+	ExternalID  string     `json:"external_id"`            // Jira issue ID or ServiceNow sys_id
+	ExternalKey string     `json:"external_key,omitempty"` // Jira issue key or ServiceNow incident number
+	URL         string     `json:"url,omitempty"`
+	Status      string     `json:"status"` // open, closed
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
@@ -0,0 +1,44 @@
+// User Behavior Analytics Models
+// Per-user risk scores and the behavioral signals that raised them
+
+package models
+
+import "time"
+
+// User risk signal types
+const (
+	RiskSignalImpossibleTravel     = "impossible_travel"      // Successful logins from different countries too close together
+	RiskSignalOffHours             = "off_hours"              // Activity outside business hours by a user who normally keeps them
+	RiskSignalHoneyTokenAccess     = "honey_token_access"     // A honey token was used under the user's name
+	RiskSignalDeceptionActivity    = "deception_activity"     // The user touched a honeypot or other decoy
+	RiskSignalAuthFailures         = "auth_failures"          // Repeated failed logins
+	RiskSignalFileActivitySpike    = "file_activity_spike"    // File access far above the user's usual rate
+	RiskSignalProcessActivitySpike = "process_activity_spike" // Process execution far above the user's usual rate
+)
+
+// UserRiskSignal is one reason a user's risk score is raised
+type UserRiskSignal struct {
+	Type        string                 `json:"type"`
+	Description string                 `json:"description"`
+	Points      int                    `json:"points"` // Contribution to the score
+	Count       int64                  `json:"count"`
+	FirstSeen   *time.Time             `json:"first_seen,omitempty"`
+	LastSeen    *time.Time             `json:"last_seen,omitempty"`
+	Details     map[string]interface{} `json:"details,omitempty"` // Only returned for a single user
+}
+
+// UserRiskScore is a user's aggregated behavior and risk over the scoring window
+type UserRiskScore struct {
+	Username       string           `json:"username"`
+	Score          int              `json:"score"` // 0-100
+	Level          string           `json:"level"` // low, medium, high, critical
+	AuthEvents     int64            `json:"auth_events"`
+	AuthFailures   int64            `json:"auth_failures"`
+	FileEvents     int64            `json:"file_events"`
+	ProcessEvents  int64            `json:"process_events"`
+	OffHoursEvents int64            `json:"off_hours_events"`
+	Hosts          uint64           `json:"hosts"`
+	Countries      []string         `json:"countries,omitempty"` // Login source countries
+	LastSeen       *time.Time       `json:"last_seen,omitempty"`
+	Signals        []UserRiskSignal `json:"signals"`
+}
@@ -0,0 +1,122 @@
+// Watchlist Models
+// Lists of IOCs and entities whose appearance in telemetry raises an alert
+
+package models
+
+import "time"
+
+// Watchlist entry types and the telemetry they are matched against
+const (
+	WatchlistEntryIP          = "ip"           // dst_ip or payload src_ip
+	WatchlistEntryDomain      = "domain"       // Resolved destination hostname or payload domain
+	WatchlistEntryHash        = "hash"         // Payload hash
+	WatchlistEntryUsername    = "username"     // Event user; community email IOCs map here
+	WatchlistEntryFilePath    = "file_path"    // File path
+	WatchlistEntryProcessName = "process_name" // Process image name
+	WatchlistEntryHostname    = "hostname"     // Reporting host
+)
+
+// WatchlistEntryTypes lists the supported entry types
+var WatchlistEntryTypes = []string{
+	WatchlistEntryIP, WatchlistEntryDomain, WatchlistEntryHash, WatchlistEntryUsername,
+	WatchlistEntryFilePath, WatchlistEntryProcessName, WatchlistEntryHostname,
+}
+
+// ScheduledJobWatchlist is the scheduler job type that matches new events against watchlists
+const ScheduledJobWatchlist = "watchlist"
+
+// Watchlist is a named set of values to watch telemetry for
+type Watchlist struct {
+	ID              string               `json:"id"`
+	LicenseID       string               `json:"license_id"`
+	Name            string               `json:"name"`
+	Description     string               `json:"description,omitempty"`
+	Severity        string               `json:"severity"` // Severity of alerts raised on hits
+	Enabled         bool                 `json:"enabled"`
+	CommunityFeed   *CommunityFeedFilter `json:"community_feed,omitempty"` // Set when the list mirrors the community IOC feed
+	EntryCount      int                  `json:"entry_count"`
+	HitCount        int64                `json:"hit_count"`
+	LastSyncedAt    *time.Time           `json:"last_synced_at,omitempty"`
+	LastEvaluatedAt *time.Time           `json:"last_evaluated_at,omitempty"`
+	CreatedBy       string               `json:"created_by,omitempty"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+// CommunityFeedFilter selects which community shared IOCs a watchlist imports
+type CommunityFeedFilter struct {
+	IOCTypes      []string `json:"ioc_types,omitempty"`    // ip, domain, hash, email, file_path; all supported types when empty
+	ThreatTypes   []string `json:"threat_types,omitempty"` // e.g. c2, ransomware
+	MinConfidence float64  `json:"min_confidence,omitempty"`
+	VerifiedOnly  bool     `json:"verified_only,omitempty"`
+	AutoSync      bool     `json:"auto_sync,omitempty"` // Re-import new IOCs periodically
+}
+
+// WatchlistEntry is one watched value
+type WatchlistEntry struct {
+	ID          string    `json:"id"`
+	WatchlistID string    `json:"watchlist_id"`
+	EntryType   string    `json:"entry_type"`
+	Value       string    `json:"value"`
+	Comment     string    `json:"comment,omitempty"`
+	IOCID       string    `json:"ioc_id,omitempty"` // Community IOC the entry was imported from
+	HitCount    int64     `json:"hit_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WatchlistHit is an event that matched a watchlist entry
+type WatchlistHit struct {
+	ID             string    `json:"id"`
+	WatchlistID    string    `json:"watchlist_id"`
+	EntryID        string    `json:"entry_id"`
+	EntryType      string    `json:"entry_type"`
+	Value          string    `json:"value"`
+	EventID        string    `json:"event_id"`
+	AgentID        string    `json:"agent_id"`
+	Hostname       string    `json:"hostname"`
+	EventType      string    `json:"event_type"`
+	EventTimestamp time.Time `json:"event_timestamp"`
+	AlertID        string    `json:"alert_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CreateWatchlistRequest is the request body for creating a watchlist
+type CreateWatchlistRequest struct {
+	LicenseID   string              `json:"license_id" binding:"required"`
+	Name        string              `json:"name" binding:"required"`
+	Description string              `json:"description"`
+	Severity    string              `json:"severity"` // low, medium, high (default) or critical
+	Entries     []AddWatchlistEntry `json:"entries,omitempty"`
+	CreatedBy   string              `json:"created_by"`
+}
+
+// UpdateWatchlistRequest is the request body for updating a watchlist
+type UpdateWatchlistRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Severity    *string `json:"severity,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+// AddWatchlistEntry is one value to add to a watchlist
+type AddWatchlistEntry struct {
+	EntryType string `json:"entry_type" binding:"required"`
+	Value     string `json:"value" binding:"required"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// AddWatchlistEntriesRequest is the request body for adding entries to a watchlist
+type AddWatchlistEntriesRequest struct {
+	Entries []AddWatchlistEntry `json:"entries" binding:"required,min=1,dive"`
+}
+
+// WatchlistRunResult summarises a single pass of the watchlist engine
+type WatchlistRunResult struct {
+	WatchlistsEvaluated int       `json:"watchlists_evaluated"`
+	EventsMatched       int       `json:"events_matched"`
+	AlertsRaised        int       `json:"alerts_raised"`
+	AlertsSuppressed    int       `json:"alerts_suppressed"`
+	IOCsImported        int       `json:"iocs_imported"`
+	StartedAt           time.Time `json:"started_at"`
+	DurationMs          int64     `json:"duration_ms"`
+}
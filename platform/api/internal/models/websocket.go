@@ -15,6 +15,7 @@ const (
 	WSTypeHeartbeat        WSMessageType = "heartbeat"
 	WSTypePolicyUpdate     WSMessageType = "policy_update"
 	WSTypeSystemNotification WSMessageType = "system_notification"
+	WSTypeCaseUpdate       WSMessageType = "case_update" // Only sent to clients subscribed to the case
 
 	// Control messages
 	WSTypeSubscribe        WSMessageType = "subscribe"
@@ -23,12 +24,21 @@ const (
 	WSTypePong             WSMessageType = "pong"
 	WSTypeError            WSMessageType = "error"
 	WSTypeConnected        WSMessageType = "connected"
+
+	// Replay messages
+	WSTypeReplay           WSMessageType = "replay"     // Batch of missed messages after a since cursor
+	WSTypeReplayGap        WSMessageType = "replay_gap" // Some missed messages are no longer buffered; refresh state
+
+	// Several queued messages delivered in one frame; Data is the message array
+	WSTypeBatch            WSMessageType = "batch"
 )
 
 // WSMessage represents a WebSocket message
 type WSMessage struct {
 	Type      WSMessageType      `json:"type"`
 	Timestamp time.Time          `json:"timestamp"`
+	TenantID  string             `json:"tenant_id,omitempty"` // Empty for messages sent to every tenant
+	Cursor    uint64             `json:"cursor,omitempty"`    // Monotonic position for replay; 0 for unbuffered messages
 	Data      interface{}        `json:"data,omitempty"`
 	Error     string             `json:"error,omitempty"`
 }
@@ -41,6 +51,23 @@ type WSSubscription struct {
 	AgentIDs      []string        `json:"agent_ids,omitempty"`       // Filter by specific agents
 	Hostnames     []string        `json:"hostnames,omitempty"`       // Filter by hostname
 	AlertOnly     bool            `json:"alert_only"`                // Only send alerts
+	Since         uint64          `json:"since,omitempty"`           // Replay buffered messages after this cursor
+	Resources     []WSResource    `json:"resources,omitempty"`       // Only send updates about these resources
+}
+
+// WebSocket subscription resource types
+const (
+	WSResourceAgent = "agent" // Events, alerts and status changes of one agent
+	WSResourceCase  = "case"  // Timeline updates of one incident case
+)
+
+// MaxWSResources bounds the resources of one subscription
+const MaxWSResources = 100
+
+// WSResource identifies a single resource a detail view follows
+type WSResource struct {
+	Type string `json:"type"` // agent or case
+	ID   string `json:"id"`
 }
 
 // WSConnectRequest is sent when establishing WebSocket connection
@@ -52,6 +79,7 @@ type WSConnectRequest struct {
 // WSEventNotification represents a new event notification
 type WSEventNotification struct {
 	EventID        string    `json:"event_id"`
+	AgentID        string    `json:"agent_id,omitempty"`
 	EventType      string    `json:"event_type"`
 	Hostname       string    `json:"hostname"`
 	Severity       uint8     `json:"severity"`
@@ -69,6 +97,7 @@ type WSAlertNotification struct {
 	Message     string    `json:"message"`
 	EventCount  int       `json:"event_count"`
 	Hostname    string    `json:"hostname,omitempty"`
+	AgentID     string    `json:"agent_id,omitempty"` // Set when the alert concerns a single agent
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -82,6 +111,15 @@ type WSAgentStatusNotification struct {
 	Reason    string    `json:"reason,omitempty"`
 }
 
+// WSCaseUpdateNotification represents a change to an incident case's timeline
+type WSCaseUpdateNotification struct {
+	CaseID    string    `json:"case_id"`
+	Action    string    `json:"action"` // created, updated, item_attached, item_detached, note_added, deleted
+	Summary   string    `json:"summary"`
+	Actor     string    `json:"actor,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // WSStatistics represents real-time statistics update
 type WSStatistics struct {
 	TotalEvents       int64            `json:"total_events"`
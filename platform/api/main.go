@@ -8,22 +8,32 @@ import (
 	"context"
 	"crypto/ed25519"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Schedules name IANA time zones; don't depend on the image shipping zoneinfo
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/gin-gonic/gin"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/sentinel-enterprise/platform/api/internal/handlers"
+	"github.com/sentinel-enterprise/platform/api/internal/middleware"
+	"github.com/sentinel-enterprise/platform/api/internal/models"
 	"github.com/sentinel-enterprise/platform/database"
+	"github.com/sentinel-enterprise/platform/license/billing"
+	licenseModels "github.com/sentinel-enterprise/platform/license/models"
 	licenseService "github.com/sentinel-enterprise/platform/license/service"
+	"github.com/sentinel-enterprise/platform/secrets"
 )
 
 const (
@@ -33,8 +43,7 @@ const (
 
 func main() {
 	// Configure logging
-	log.SetFormatter(&log.JSONFormatter{})
-	log.SetLevel(log.InfoLevel)
+	configureLogging()
 	log.Info("Privé Platform API starting...")
 
 	// Load configuration
@@ -82,29 +91,148 @@ func main() {
 		}
 	}
 
-	// Initialize license service
-	// Note: In production, load keys from secure storage (e.g., AWS KMS, HashiCorp Vault)
-	privateKeyPath := getEnv("LICENSE_PRIVATE_KEY_PATH", "")
-	publicKeyPath := getEnv("LICENSE_PUBLIC_KEY_PATH", "")
+	// Connect to NATS JetStream so REST-submitted telemetry joins the gRPC ingestion stream
+	var jetStream nats.JetStreamContext
+	nc, err := nats.Connect(getEnv("NATS_URL", nats.DefaultURL),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+	)
+	if err != nil {
+		log.Warnf("Failed to connect to NATS: %v. REST event ingestion disabled.", err)
+	} else {
+		defer nc.Close()
+		if jetStream, err = nc.JetStream(); err != nil {
+			log.Warnf("Failed to create JetStream context: %v. REST event ingestion disabled.", err)
+			jetStream = nil
+		} else {
+			log.Info("NATS connection established")
+		}
+	}
+
+	// Secrets backend for license signing keys, AI provider keys and storage credentials
+	secretProvider, err := secrets.New(context.Background(), secrets.Config{
+		Backend:     getEnv("SECRETS_BACKEND", secrets.BackendFile),
+		CacheTTL:    time.Duration(getEnvInt("SECRETS_CACHE_SECONDS", 300)) * time.Second,
+		Dir:         getEnv("SECRETS_DIR", ""),
+		VaultAddr:   getEnv("VAULT_ADDR", ""),
+		VaultToken:  getEnv("VAULT_TOKEN", ""),
+		VaultMount:  getEnv("VAULT_KV_MOUNT", "secret"),
+		VaultPrefix: getEnv("VAULT_PATH_PREFIX", "sentinel"),
+		AWSRegion:   getEnv("AWS_REGION", ""),
+		AWSKMSKeyID: getEnv("SECRETS_KMS_KEY_ID", ""),
+		AWSPrefix:   getEnv("AWS_SECRETS_PREFIX", "sentinel/"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize secrets backend: %v", err)
+	}
+	log.Infof("Secrets backend: %s", secretProvider.Name())
 
-	var licenseService *licenseService.LicenseService
-	if privateKeyPath != "" && publicKeyPath != "" {
-		privateKey, publicKey, err := loadLicenseKeys(privateKeyPath, publicKeyPath)
+	// Initialize license service. Key names are secret names in the configured backend; with
+	// the file backend the legacy *_PATH settings are read as absolute paths.
+	privateKeyName := getEnv("LICENSE_PRIVATE_KEY_SECRET", getEnv("LICENSE_PRIVATE_KEY_PATH", ""))
+	publicKeyName := getEnv("LICENSE_PUBLIC_KEY_SECRET", getEnv("LICENSE_PUBLIC_KEY_PATH", ""))
+
+	var licService *licenseService.LicenseService
+	if privateKeyName != "" && publicKeyName != "" {
+		privateKey, publicKey, err := loadLicenseKeys(secretProvider, privateKeyName, publicKeyName)
 		if err != nil {
 			log.Warnf("Failed to load license keys: %v. License features will be limited.", err)
 		} else {
-			licenseService = licenseService.NewLicenseService(db, privateKey, publicKey)
+			licService = licenseService.NewLicenseService(db, privateKey, publicKey)
 			log.Info("License service initialized successfully")
+
+			// Record usage snapshots and flag sustained seat overages
+			snapshotInterval := time.Duration(getEnvInt("LICENSE_USAGE_SNAPSHOT_MINUTES", 60)) * time.Minute
+			overageWindow := time.Duration(getEnvInt("LICENSE_OVERAGE_WINDOW_HOURS", 24)) * time.Hour
+			licService.StartUsageSnapshotJob(snapshotInterval, overageWindow)
+
+			// Node-locked licensing: reject agents that do not report a hardware fingerprint
+			licService.RequireFingerprint(getEnv("LICENSE_REQUIRE_FINGERPRINT", "false") == "true")
 		}
 	} else {
-		log.Warn("License key paths not configured. Set LICENSE_PRIVATE_KEY_PATH and LICENSE_PUBLIC_KEY_PATH environment variables.")
+		log.Warn("License key paths not configured. Set LICENSE_PRIVATE_KEY_SECRET and LICENSE_PUBLIC_KEY_SECRET (or the *_PATH variables) environment variables.")
+	}
+
+	// Initialize self-serve billing (requires the license service)
+	var billingService *billing.Service
+	if stripeKey := getEnv("STRIPE_SECRET_KEY", ""); stripeKey != "" && licService != nil {
+		stripe := billing.NewStripeClient(stripeKey, getEnv("STRIPE_WEBHOOK_SECRET", ""))
+		billingService = billing.NewService(stripe, licService, billing.Config{
+			PriceIDs: map[licenseModels.LicenseTier]string{
+				licenseModels.TierPro:        getEnv("STRIPE_PRICE_PROFESSIONAL", ""),
+				licenseModels.TierEnterprise: getEnv("STRIPE_PRICE_ENTERPRISE", ""),
+			},
+			SuccessURL:   getEnv("BILLING_SUCCESS_URL", "http://localhost:3000/billing/success"),
+			CancelURL:    getEnv("BILLING_CANCEL_URL", "http://localhost:3000/billing/cancel"),
+			PeriodDays:   getEnvInt("BILLING_PERIOD_DAYS", 31),
+			CancelAction: getEnv("BILLING_CANCEL_ACTION", billing.CancelActionRevoke),
+		})
+		log.Info("Stripe billing initialized")
 	}
 
 	// Initialize WebSocket hub
-	handlers.InitWebSocketHub()
+	handlers.InitWebSocketHub(handlers.WSHubConfig{
+		ReplayBufferSize: getEnvInt("WS_REPLAY_BUFFER_SIZE", 1000),
+		ReplayMaxAge:     time.Duration(getEnvInt("WS_REPLAY_MAX_AGE_SECONDS", 300)) * time.Second,
+
+		MaxConnections:          getEnvInt("WS_MAX_CONNECTIONS", 10000),
+		MaxConnectionsPerTenant: getEnvInt("WS_MAX_CONNECTIONS_PER_TENANT", 200),
+
+		EnableCompression: getEnv("WS_ENABLE_COMPRESSION", "true") == "true",
+		CompressionLevel:  getEnvInt("WS_COMPRESSION_LEVEL", 1),
+		BatchMaxMessages:  getEnvInt("WS_BATCH_MAX_MESSAGES", 50),
+	})
+
+	// AI provider metrics; token prices turn the token counts into a spend estimate
+	if err := handlers.InitAIMetrics(getEnv("AI_TOKEN_PRICES", "")); err != nil {
+		log.Fatalf("Invalid AI_TOKEN_PRICES: %v", err)
+	}
+
+	// Start alert correlation engine
+	correlationInterval := time.Duration(getEnvInt("CORRELATION_INTERVAL_SECONDS", 60)) * time.Second
+	correlationEngine := handlers.StartCorrelationEngine(db, correlationInterval)
+
+	// Start hot storage retention job
+	retentionInterval := time.Duration(getEnvInt("RETENTION_INTERVAL_HOURS", 24)) * time.Hour
+	retentionManager := handlers.StartRetentionJob(db, ch, getEnvInt("RETENTION_DEFAULT_HOT_DAYS", 90), retentionInterval)
+
+	// Start notification and audit log retention
+	logRetentionInterval := time.Duration(getEnvInt("LOG_RETENTION_INTERVAL_HOURS", 24)) * time.Hour
+	logRetentionManager := handlers.StartLogRetentionJob(db, models.LogRetentionConfig{
+		NotificationLogDays: getEnvInt("NOTIFICATION_LOG_RETENTION_DAYS", 90),
+		AuditLogDays:        getEnvInt("AUDIT_LOG_RETENTION_DAYS", 730),
+		AuditLogMode:        getEnv("AUDIT_LOG_RETENTION_MODE", models.LogRetentionDelete),
+		ArchiveDir:          getEnv("LOG_RETENTION_ARCHIVE_DIR", ""),
+		PartitionsAhead:     getEnvInt("NOTIFICATION_LOG_PARTITIONS_AHEAD", 2),
+	}, logRetentionInterval)
+
+	// Start event volume baselining
+	baselineInterval := time.Duration(getEnvInt("BASELINE_INTERVAL_MINUTES", 60)) * time.Minute
+	baselineEngine := handlers.StartBaselineEngine(db, ch, handlers.BaselineConfig{
+		LookbackDays:    getEnvInt("BASELINE_LOOKBACK_DAYS", 28),
+		MinSamples:      getEnvInt("BASELINE_MIN_SAMPLES", 7),
+		ZThreshold:      float64(getEnvInt("BASELINE_Z_THRESHOLD", 3)),
+		MinDeviation:    float64(getEnvInt("BASELINE_MIN_DEVIATION", 20)),
+		SilentMinEvents: float64(getEnvInt("BASELINE_SILENT_MIN_EVENTS", 50)),
+		Notify:          getEnv("BASELINE_NOTIFY", "false") == "true",
+	}, baselineInterval)
+
+	// Start watchlist matching of new events
+	watchlistInterval := time.Duration(getEnvInt("WATCHLIST_INTERVAL_SECONDS", 60)) * time.Second
+	watchlistEngine := handlers.StartWatchlistEngine(db, ch, getEnv("WATCHLIST_NOTIFY", "true") == "true", watchlistInterval)
+
+	// Replicate license validity to ClickHouse, where the consumer checks each event's tenant
+	handlers.StartLicenseStatusSync(db, ch, time.Duration(getEnvInt("LICENSE_STATUS_SYNC_SECONDS", 60))*time.Second)
+
+	// Start cron scheduler for recurring jobs (archive, usage snapshots, ...)
+	scheduler := handlers.NewScheduler(db, getEnv("SCHEDULER_TIMEZONE", "UTC"))
+	handlers.RegisterBuiltinJobs(scheduler, db, licService, correlationEngine, retentionManager, logRetentionManager, baselineEngine, watchlistEngine)
 
 	// Initialize Gin router
-	router := setupRouter(db, ch, licenseService)
+	router := setupRouter(db, ch, jetStream, licService, billingService, correlationEngine, retentionManager, logRetentionManager, baselineEngine, watchlistEngine, scheduler, secretProvider)
+
+	// Started after the router so job types registered by handlers (e.g. reports) are known
+	scheduler.Start(time.Duration(getEnvInt("SCHEDULER_INTERVAL_SECONDS", 30)) * time.Second)
 
 	// Create HTTP server
 	srv := &http.Server{
@@ -123,6 +251,20 @@ func main() {
 		}
 	}()
 
+	// Prometheus metrics get their own listener so they stay off the public API port
+	var metricsSrv *http.Server
+	if metricsAddr := getEnv("METRICS_ADDR", ":9104"); metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", handlers.ServeAIMetrics)
+		metricsSrv = &http.Server{Addr: metricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			log.Infof("Metrics listening on %s", metricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Metrics server failed: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -136,13 +278,26 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Errorf("Server forced to shutdown: %v", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
 
 	log.Info("Server stopped")
 }
 
-func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseService) *gin.Engine {
+func setupRouter(db *sql.DB, ch driver.Conn, jetStream nats.JetStreamContext, licService *licenseService.LicenseService, billingService *billing.Service, correlationEngine *handlers.CorrelationEngine, retentionManager *handlers.RetentionManager, logRetentionManager *handlers.LogRetentionManager, baselineEngine *handlers.BaselineEngine, watchlistEngine *handlers.WatchlistEngine, scheduler *handlers.Scheduler, secretProvider secrets.SecretProvider) *gin.Engine {
 	router := gin.Default()
 
+	// CORS: cross-origin browser requests are rejected unless the origin is listed
+	router.Use(middleware.NewCORS(middleware.CORSConfig{
+		AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", ""),
+		AllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"),
+		AllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", "Authorization,Content-Type,Idempotency-Key,If-Match,X-License-Key,X-Admin-Token"),
+		ExposedHeaders:   getEnvList("CORS_EXPOSED_HEADERS", "ETag,Retry-After"),
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           time.Duration(getEnvInt("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+	}).Handler())
+
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -154,33 +309,181 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 
 	// Initialize handlers with dependencies
 	licenseHandler := handlers.NewLicenseHandler(licService)
-	dlpHandler := handlers.NewDLPHandler(db)
-	agentHandler := handlers.NewAgentHandler(db)
+	featureGate := middleware.NewFeatureGate(licService)
+	requireAdmin := middleware.RequireAdmin(getEnv("ADMIN_API_TOKEN", ""))
+
+	// Role-based access control for sensitive operations. Requests without credentials are denied
+	// unless RBAC_ANONYMOUS_ROLE explicitly grants them a role, e.g. during an authentication rollout.
+	rbac := middleware.NewRBAC(getEnv("ADMIN_API_TOKEN", ""), getEnv("RBAC_ANONYMOUS_ROLE", "none"))
+	canManageLicenses := rbac.RequirePlatform(models.PermLicensesManage)
+	canManageAPIKeys := rbac.Require(models.PermAPIKeysManage)
+	canManageAgents := rbac.Require(models.PermAgentsManage)
+	canManageAgentUpdates := rbac.RequirePlatform(models.PermAgentsManage) // Packages are shared by every license
+	canRespond := rbac.Require(models.PermAgentsRespond)
+	canIsolate := rbac.Require(models.PermAgentsIsolate)
+	canDeployDeception := rbac.Require(models.PermDeceptionDeploy)
+	canManagePolicies := rbac.Require(models.PermPoliciesManage)
+	canShare := rbac.Require(models.PermCommunityShare)
+	canModerate := rbac.Require(models.PermCommunityModerate)
+	canManageCases := rbac.Require(models.PermCasesManage)
+	canQueryTenants := rbac.Require(models.PermTenantsQuery)
+	idempotent := middleware.NewIdempotency(db, time.Duration(getEnvInt("IDEMPOTENCY_TTL_HOURS", 24))*time.Hour).Handler()
+	billingHandler := handlers.NewBillingHandler(billingService)
+	dlpHandler := handlers.NewDLPHandler(db, ch)
+	agentHandler := handlers.NewAgentHandler(db, getEnv("AGENT_MIN_VERSION", ""))
+	if keyPath := getEnv("AGENT_UPDATE_PUBLIC_KEY_PATH", ""); keyPath != "" {
+		if key, err := loadUpdateSigningKey(keyPath); err != nil {
+			log.Warnf("Failed to load agent update signing key: %v. Agent updates disabled.", err)
+		} else {
+			agentHandler.SetUpdateSigningKey(key)
+		}
+	}
 	telemetryHandler := handlers.NewTelemetryHandler(db)
+	telemetryHandler.SetQueryGuardrails(handlers.QueryGuardrails{
+		ConfirmScanRows:     uint64(getEnvInt("QUERY_CONFIRM_SCAN_ROWS", 100000000)),
+		MaxScanRows:         uint64(getEnvInt("QUERY_MAX_SCAN_ROWS", 2000000000)),
+		MaxExecutionSeconds: getEnvInt("QUERY_MAX_EXECUTION_SECONDS", 30),
+		MaxResultRows:       uint64(getEnvInt("QUERY_MAX_RESULT_ROWS", 0)),
+	})
+	// Per-tier limits (QUERY_*_<TIER>); zero inherits the defaults above, and licenses can
+	// override both through /licenses/:id/query-limits
+	tierQueryDefaults := map[licenseModels.LicenseTier][2]int{
+		licenseModels.TierFree: {10, 1000}, // max_execution_time, max_result_rows
+	}
+	for _, tier := range []licenseModels.LicenseTier{licenseModels.TierFree, licenseModels.TierPro, licenseModels.TierEnterprise} {
+		suffix := "_" + strings.ToUpper(string(tier))
+		defaults := tierQueryDefaults[tier]
+		telemetryHandler.SetTierQueryGuardrails(string(tier), handlers.QueryGuardrails{
+			ConfirmScanRows:     uint64(getEnvInt("QUERY_CONFIRM_SCAN_ROWS"+suffix, 0)),
+			MaxScanRows:         uint64(getEnvInt("QUERY_MAX_SCAN_ROWS"+suffix, 0)),
+			MaxExecutionSeconds: getEnvInt("QUERY_MAX_EXECUTION_SECONDS"+suffix, defaults[0]),
+			MaxResultRows:       uint64(getEnvInt("QUERY_MAX_RESULT_ROWS"+suffix, defaults[1])),
+		})
+	}
+	ingestHandler := handlers.NewIngestHandler(db, jetStream, getEnvInt("INGEST_RATE_LIMIT_EPS", 10000))
+	ingestHandler.SetSimulationEnabled(getEnv("TELEMETRY_SIMULATION_ENABLED", "false") == "true")
+	if err := ingestHandler.SetSubjectTemplate(getEnv("INGESTOR_SUBJECT_TEMPLATE", handlers.IngestSubject)); err != nil {
+		log.Fatalf("Invalid INGESTOR_SUBJECT_TEMPLATE: %v", err)
+	}
 	notificationHandler := handlers.NewNotificationHandler(db)
+
+	// License lifecycle webhooks for billing/CRM sync, sent and signed by the notification webhook delivery
+	if licService != nil {
+		if webhookURL := getEnv("LICENSE_WEBHOOK_URL", ""); webhookURL != "" {
+			webhookConfig := models.WebhookConfig{URL: webhookURL}
+			if secret := getEnv("LICENSE_WEBHOOK_SECRET", ""); secret != "" {
+				webhookConfig.Auth = &models.WebhookAuth{Type: "hmac", Secret: secret}
+			}
+			licService.SetWebhookSender(func(eventType, deliveryID string, payload []byte) error {
+				config := webhookConfig
+				config.Headers = map[string]string{"X-Prive-Event": eventType, "X-Prive-Delivery": deliveryID}
+				return notificationHandler.SendWebhookPayload("license-lifecycle-webhook", config, payload)
+			})
+		}
+		licService.StartWebhookDispatcher(time.Duration(getEnvInt("LICENSE_WEBHOOK_INTERVAL_SECONDS", 30)) * time.Second)
+
+		// Sustained seat overages are sent to the license's own notification channels
+		licService.SetOverageNotifier(func(licenseID, subject, message, priority string, details map[string]interface{}) {
+			notificationHandler.NotifyLicense(licenseID, subject, message, priority, details)
+		})
+	}
 	aiHandler := handlers.NewAIHandler(db, ch)
+	aiHandler.SetSecretProvider(secretProvider)
 	collaborativeHandler := handlers.NewCollaborativeHandler(db)
 	dataLakeHandler := handlers.NewDataLakeHandler(db)
+	dataLakeHandler.SetSecretProvider(secretProvider)
+	dataLakeHandler.SetQueryCache(
+		time.Duration(getEnvInt("DATALAKE_QUERY_CACHE_TTL_MINUTES", 60))*time.Minute,
+		getEnvInt("DATALAKE_QUERY_CACHE_ENTRIES", 256),
+	)
+	dataLakeHandler.SetQueryConcurrency(getEnvInt("DATALAKE_QUERY_CONCURRENCY", 4))
+	// Zone-to-shard map for region-sharded ClickHouse clusters, e.g. "eu=shard_eu,us=shard_us"
+	dataLakeHandler.SetResidencyShards(getEnvList("CLICKHOUSE_RESIDENCY_SHARDS", ""))
+	// Restores decrypt client-side encrypted datasets with DATALAKE_ENCRYPTION_KEY (hex, 32 bytes)
+	archiveKey, err := hex.DecodeString(getEnv("DATALAKE_ENCRYPTION_KEY", ""))
+	if err != nil {
+		log.Warnf("Invalid DATALAKE_ENCRYPTION_KEY: %v. Encrypted datasets cannot be restored.", err)
+	}
+	dataLakeHandler.EnableRestore(ch, archiveKey)
+	go dataLakeHandler.ResumeRestoreJobs()
 	deceptionHandler := handlers.NewDeceptionHandler(db)
+	deceptionHandler.SetClickHouse(ch)
+	caseHandler := handlers.NewCaseHandler(db)
+	correlationHandler := handlers.NewCorrelationHandler(db, correlationEngine)
+	retentionHandler := handlers.NewRetentionHandler(retentionManager)
+	logRetentionHandler := handlers.NewLogRetentionHandler(logRetentionManager)
+	legalHoldHandler := handlers.NewLegalHoldHandler(db, ch)
+	if licService != nil {
+		legalHoldHandler.SetSigner(licService)
+	}
+	baselineHandler := handlers.NewBaselineHandler(db, baselineEngine)
+	schedulerHandler := handlers.NewSchedulerHandler(db, scheduler)
+	searchHandler := handlers.NewSearchHandler(db, ch)
+	uebaHandler := handlers.NewUEBAHandler(db, ch)
+	customFieldHandler := handlers.NewCustomFieldHandler(db, ch)
+	scheduler.Register(models.ScheduledJobCustomFieldCleanup, customFieldHandler.RunColumnCleanup)
+	samplingHandler := handlers.NewSamplingHandler(ch)
+	redactionHandler := handlers.NewRedactionHandler(ch)
+	logHandler := handlers.NewLogHandler(db, ch, getEnvInt("LOG_INGEST_RATE_LIMIT_LPS", 5000))
+	mitreHandler := handlers.NewMITREHandler(db)
+	suppressionHandler := handlers.NewAlertSuppressionHandler(db)
+	alertHandler := handlers.NewAlertHandler(db)
+	watchlistHandler := handlers.NewWatchlistHandler(db, watchlistEngine)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	// Dashboard sessions: SSO logins are exchanged for platform JWTs signed with JWT_SECRET
+	userTokens := middleware.NewUserTokens(db, getEnv("JWT_SECRET", ""), time.Duration(getEnvInt("JWT_TTL_MINUTES", 480))*time.Minute)
+	ssoProviders, err := loadSSOProviders(getEnv("SSO_CONFIG_PATH", ""))
+	if err != nil {
+		log.Warnf("Failed to load SSO providers: %v. SSO disabled.", err)
+	}
+	ssoHandler := handlers.NewSSOHandler(db, userTokens, getEnv("JWT_SECRET", ""), ssoProviders)
+	reportHandler := handlers.NewReportHandler(db, telemetryHandler, dlpHandler, deceptionHandler, notificationHandler, scheduler)
+	scheduler.Register(models.ScheduledJobReport, reportHandler.RunScheduledReport)
 
 	// API v1 routes
-	v1 := router.Group("/api/v1")
+	// Requests presenting "Authorization: ApiKey ..." are authenticated and scoped by the key,
+	// "Authorization: Bearer ..." carries a signed-in user's session token
+	v1 := router.Group("/api/v1", middleware.NewAPIKeys(db).Handler(), userTokens.Handler())
 	{
+		// Single Sign-On (dashboard login)
+		sso := v1.Group("/auth/sso")
+		{
+			sso.GET("/providers", ssoHandler.ListProviders)
+			sso.GET("/login", ssoHandler.Login)
+			sso.GET("/callback", ssoHandler.Callback)
+			sso.POST("/acs", ssoHandler.AssertionConsumer)
+		}
+
 		// DLP Policy Management
 		dlp := v1.Group("/dlp")
 		{
 			dlp.GET("/policies", dlpHandler.ListDLPPolicies)
 			dlp.GET("/policies/:id", dlpHandler.GetDLPPolicy)
-			dlp.POST("/policies", dlpHandler.CreateDLPPolicy)
-			dlp.PUT("/policies/:id", dlpHandler.UpdateDLPPolicy)
-			dlp.DELETE("/policies/:id", dlpHandler.DeleteDLPPolicy)
+			dlp.POST("/policies", canManagePolicies, dlpHandler.CreateDLPPolicy)
+			dlp.PUT("/policies/:id", canManagePolicies, dlpHandler.UpdateDLPPolicy)
+			dlp.DELETE("/policies/:id", canManagePolicies, dlpHandler.DeleteDLPPolicy)
+			dlp.POST("/policies/:id/restore", canManagePolicies, dlpHandler.RestoreDLPPolicy)
+			dlp.DELETE("/policies/:id/purge", requireAdmin, dlpHandler.PurgeDLPPolicy)
 
 			// Fingerprint management
-			dlp.POST("/policies/:id/fingerprints", dlpHandler.AddFingerprints)
-			dlp.DELETE("/policies/:id/fingerprints/:fingerprint_id", dlpHandler.DeleteFingerprint)
+			dlp.POST("/policies/:id/fingerprints", canManagePolicies, dlpHandler.AddFingerprints)
+			dlp.DELETE("/policies/:id/fingerprints/:fingerprint_id", canManagePolicies, dlpHandler.DeleteFingerprint)
+
+			// Agent group targeting
+			dlp.GET("/policies/:id/assignments", dlpHandler.GetDLPPolicyAssignments)
+			dlp.PUT("/policies/:id/assignments", canManagePolicies, dlpHandler.SetDLPPolicyAssignments)
+
+			// Exact data match datasets (referenced from policy config.edm_datasets)
+			dlp.POST("/edm/datasets", canManagePolicies, dlpHandler.CreateEDMDataset)
+			dlp.GET("/edm/datasets", dlpHandler.ListEDMDatasets)
+			dlp.DELETE("/edm/datasets/:id", canManagePolicies, dlpHandler.DeleteEDMDataset)
 
 			// Policy testing
+			dlp.GET("/detectors", dlpHandler.ListDLPDetectors)
 			dlp.POST("/test", dlpHandler.TestDLPPolicy)
+
+			// Violations
+			dlp.GET("/violations", dlpHandler.ListDLPViolations)
 		}
 
 		// Agent Management
@@ -189,22 +492,81 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 			agents.POST("/register", agentHandler.RegisterAgent)
 			agents.POST("/heartbeat", agentHandler.ProcessHeartbeat)
 			agents.GET("", agentHandler.ListAgents)
+			agents.GET("/versions", agentHandler.GetAgentVersions)
 			agents.GET("/:id", agentHandler.GetAgent)
 			agents.GET("/:id/health", agentHandler.GetAgentHealth)
-			agents.PUT("/:id", agentHandler.UpdateAgent)
-			agents.DELETE("/:id", agentHandler.DeleteAgent)
+			agents.PUT("/:id", canRespond, agentHandler.UpdateAgent)
+			agents.DELETE("/:id", canManageAgents, agentHandler.DeleteAgent)
+			agents.POST("/:id/restore", canManageAgents, agentHandler.RestoreAgent)
+			agents.DELETE("/:id/purge", requireAdmin, agentHandler.PurgeAgent)
+
+			// Update packages and staged rollout
+			agents.GET("/updates", agentHandler.ListAgentUpdates)
+			agents.POST("/updates", canManageAgentUpdates, agentHandler.PublishAgentUpdate)
+			agents.PUT("/updates/:id/rollout", canManageAgentUpdates, agentHandler.UpdateAgentRollout)
+			agents.DELETE("/updates/:id", canManageAgentUpdates, agentHandler.DeleteAgentUpdate)
 
 			// Agent configuration
+			agents.GET("/config/schema", agentHandler.GetAgentConfigSchema)
 			agents.GET("/:id/config", agentHandler.GetAgentConfig)
-			agents.PUT("/:id/config", agentHandler.UpdateAgentConfig)
+			agents.POST("/:id/config/preview", agentHandler.PreviewAgentConfig) // A read, like GET /:id/config
+			agents.PUT("/:id/config", canRespond, agentHandler.UpdateAgentConfig)
+			agents.POST("/:id/isolate", canIsolate, agentHandler.IsolateAgent)
+			agents.POST("/:id/release", canIsolate, agentHandler.ReleaseAgent)
 		}
 
 		// Telemetry Query Interface
 		telemetry := v1.Group("/telemetry")
 		{
+			telemetry.POST("/ingest", ingestHandler.IngestEvents)
+			telemetry.POST("/simulate", requireAdmin, ingestHandler.SimulateTelemetry)
+			telemetry.GET("/simulate/:id", requireAdmin, ingestHandler.GetTelemetrySimulation)
 			telemetry.POST("/query", telemetryHandler.QueryEvents)
+			telemetry.POST("/query/estimate", telemetryHandler.EstimateQuery)
+			telemetry.POST("/query/tenants", canQueryTenants, telemetryHandler.QueryEventsAcrossTenants)
 			telemetry.GET("/events/:id", telemetryHandler.GetEvent)
+			telemetry.POST("/events/batch", telemetryHandler.GetEventsBatch)
+			telemetry.POST("/pivot", telemetryHandler.PivotEvents)
+			telemetry.POST("/ioc-sweep", telemetryHandler.SweepIOCs)
+			telemetry.GET("/process-tree", telemetryHandler.GetProcessTree)
 			telemetry.GET("/statistics", telemetryHandler.GetStatistics)
+			telemetry.GET("/integrity/verify", telemetryHandler.VerifyIntegrity)
+
+			// Custom fields: tenant-defined payload keys materialized as filterable columns
+			telemetry.GET("/custom-fields", customFieldHandler.ListCustomFields)
+			telemetry.POST("/custom-fields", canManagePolicies, customFieldHandler.CreateCustomField)
+			telemetry.DELETE("/custom-fields/:id", canManagePolicies, customFieldHandler.DeleteCustomField)
+
+			// Sampling and aggregation of high-volume, low-value event types
+			telemetry.GET("/sampling", samplingHandler.ListSamplingPolicies)
+			telemetry.PUT("/sampling/:event_type", canManagePolicies, samplingHandler.SetSamplingPolicy)
+			telemetry.DELETE("/sampling/:event_type", canManagePolicies, samplingHandler.DeleteSamplingPolicy)
+			telemetry.GET("/rollups", samplingHandler.ListRollups)
+
+			// Payload redaction rules applied by the consumer before storage
+			telemetry.GET("/redaction", redactionHandler.ListRedactionRules)
+			telemetry.POST("/redaction", canManagePolicies, redactionHandler.CreateRedactionRule)
+			telemetry.PUT("/redaction/:id", canManagePolicies, redactionHandler.UpdateRedactionRule)
+			telemetry.DELETE("/redaction/:id", canManagePolicies, redactionHandler.DeleteRedactionRule)
+
+			// Re-enrichment of stored events, run by the consumer
+			telemetry.GET("/reprocess", telemetryHandler.ListReprocessJobs)
+			telemetry.POST("/reprocess", canManagePolicies, telemetryHandler.CreateReprocessJob)
+			telemetry.GET("/reprocess/:id", telemetryHandler.GetReprocessJob)
+			telemetry.POST("/reprocess/:id/cancel", canManagePolicies, telemetryHandler.CancelReprocessJob)
+
+			// Event volume baselines and anomalies
+			telemetry.GET("/baselines", baselineHandler.ListBaselines)
+			telemetry.POST("/baselines/run", canManagePolicies, baselineHandler.RunBaseline)
+			telemetry.GET("/baselines/anomalies", baselineHandler.ListVolumeAnomalies)
+			telemetry.POST("/baselines/anomalies/:id/acknowledge", canManageCases, baselineHandler.AcknowledgeVolumeAnomaly)
+		}
+
+		// Raw agent logs, stored apart from structured telemetry
+		logs := v1.Group("/logs")
+		{
+			logs.POST("", logHandler.IngestLogs)
+			logs.POST("/query", logHandler.QueryLogs)
 		}
 
 		// MITRE ATT&CK Framework
@@ -213,27 +575,91 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 			mitre.GET("/tactics", telemetryHandler.ListMITRETactics)
 			mitre.GET("/techniques", telemetryHandler.ListMITRETechniques)
 			mitre.GET("/coverage", telemetryHandler.GetMITRECoverage)
+			mitre.GET("/coverage/rules", telemetryHandler.GetMITRERuleCoverage)
+			mitre.GET("/posture", telemetryHandler.GetMITREPosture)
+			mitre.POST("/import", requireAdmin, mitreHandler.ImportATTACK)
+			mitre.GET("/imports", mitreHandler.ListMITREImports)
 		}
 
 		// Alerting Rules
 		alerts := v1.Group("/alerts")
 		{
+			// Fired alerts, flat or grouped, and their lifecycle
+			alerts.GET("", alertHandler.ListAlerts)
+			alerts.GET("/instances/:id", alertHandler.GetAlert)
+			alerts.GET("/instances/:id/history", alertHandler.GetAlertHistory)
+			alerts.POST("/instances/:id/acknowledge", canManageCases, alertHandler.AcknowledgeAlert)
+			alerts.POST("/instances/:id/resolve", canManageCases, alertHandler.ResolveAlert)
+			alerts.POST("/instances/:id/suppress", canManageCases, alertHandler.SuppressAlert)
+			alerts.POST("/instances/:id/reopen", canManageCases, alertHandler.ReopenAlert)
+			alerts.PUT("/instances/:id/assignee", canManageCases, alertHandler.AssignAlert)
+			alerts.GET("/instances/:id/notes", alertHandler.ListAlertNotes)
+			alerts.POST("/instances/:id/notes", canManageCases, alertHandler.AddAlertNote)
+
 			alerts.GET("/rules", telemetryHandler.ListAlertRules)
-			alerts.POST("/rules", telemetryHandler.CreateAlertRule)
-			alerts.PUT("/rules/:id", telemetryHandler.UpdateAlertRule)
-			alerts.DELETE("/rules/:id", telemetryHandler.DeleteAlertRule)
+			alerts.POST("/rules", canManagePolicies, telemetryHandler.CreateAlertRule)
+			alerts.PUT("/rules/:id", canManagePolicies, telemetryHandler.UpdateAlertRule)
+			alerts.DELETE("/rules/:id", canManagePolicies, telemetryHandler.DeleteAlertRule)
+			alerts.GET("/instances/:id/actions", telemetryHandler.ListAlertActionExecutions)
+
+			// False-positive suppressions
+			alerts.GET("/suppressions", suppressionHandler.ListSuppressions)
+			alerts.POST("/suppressions", canManageCases, suppressionHandler.CreateSuppression)
+			alerts.DELETE("/suppressions/:id", canManageCases, suppressionHandler.RemoveSuppression)
+			alerts.GET("/suppressions/:id/audit", suppressionHandler.GetSuppressionAudit)
+
+			// IOC and entity watchlists
+			alerts.GET("/watchlists", watchlistHandler.ListWatchlists)
+			alerts.POST("/watchlists", canManagePolicies, watchlistHandler.CreateWatchlist)
+			alerts.POST("/watchlists/run", canManagePolicies, watchlistHandler.RunWatchlists)
+			alerts.GET("/watchlists/:id", watchlistHandler.GetWatchlist)
+			alerts.PUT("/watchlists/:id", canManagePolicies, watchlistHandler.UpdateWatchlist)
+			alerts.DELETE("/watchlists/:id", canManagePolicies, watchlistHandler.DeleteWatchlist)
+			alerts.GET("/watchlists/:id/entries", watchlistHandler.ListWatchlistEntries)
+			alerts.POST("/watchlists/:id/entries", canManagePolicies, watchlistHandler.AddWatchlistEntries)
+			alerts.DELETE("/watchlists/:id/entries/:entry_id", canManagePolicies, watchlistHandler.DeleteWatchlistEntry)
+			alerts.POST("/watchlists/:id/import/community", canManagePolicies, watchlistHandler.ImportCommunityIOCs)
+			alerts.GET("/watchlists/:id/hits", watchlistHandler.ListWatchlistHits)
+
+			// Alert correlation into cases
+			alerts.GET("/correlation/rules", correlationHandler.ListCorrelationRules)
+			alerts.POST("/correlation/rules", canManagePolicies, correlationHandler.CreateCorrelationRule)
+			alerts.PUT("/correlation/rules/:id", canManagePolicies, correlationHandler.UpdateCorrelationRule)
+			alerts.DELETE("/correlation/rules/:id", canManagePolicies, correlationHandler.DeleteCorrelationRule)
+			alerts.POST("/correlation/run", canManagePolicies, correlationHandler.RunCorrelation)
 		}
 
 		// License Management
 		licenses := v1.Group("/licenses")
 		{
 			licenses.GET("", licenseHandler.ListLicenses)
+			licenses.GET("/export", canManageLicenses, licenseHandler.ExportLicenses)
+			licenses.GET("/crl", licenseHandler.GetRevocationList)
 			licenses.GET("/:id", licenseHandler.GetLicense)
-			licenses.POST("", licenseHandler.CreateLicense)
+			licenses.POST("", canManageLicenses, idempotent, licenseHandler.CreateLicense)
 			licenses.POST("/validate", licenseHandler.ValidateLicense)
-			licenses.POST("/trial", licenseHandler.GenerateTrialLicense)
-			licenses.DELETE("/:id", licenseHandler.RevokeLicense)
+			licenses.POST("/trial", canManageLicenses, licenseHandler.GenerateTrialLicense)
+			licenses.POST("/bulk", canManageLicenses, idempotent, licenseHandler.BulkCreateLicenses)
+			licenses.DELETE("/:id", canManageLicenses, licenseHandler.RevokeLicense)
 			licenses.GET("/:id/usage", licenseHandler.GetLicenseUsage)
+			licenses.GET("/:id/usage/history", licenseHandler.GetLicenseUsageHistory)
+			licenses.GET("/:id/children", licenseHandler.ListChildLicenses)
+			licenses.POST("/:id/children", canManageLicenses, licenseHandler.LinkChildLicense)
+			licenses.DELETE("/:id/children/:childId", canManageLicenses, licenseHandler.UnlinkChildLicense)
+			licenses.GET("/:id/machines", licenseHandler.ListMachineBindings)
+			licenses.DELETE("/:id/machines/:bindingId", canManageLicenses, licenseHandler.ReleaseMachineBinding)
+			licenses.GET("/:id/features", licenseHandler.GetLicenseFeatures)
+			licenses.PUT("/:id/features/:feature", canManageLicenses, licenseHandler.SetFeatureOverride)
+			licenses.DELETE("/:id/features/:feature", canManageLicenses, licenseHandler.ClearFeatureOverride)
+			licenses.GET("/:id/query-limits", telemetryHandler.GetQueryLimits)
+			licenses.PUT("/:id/query-limits", canManageLicenses, telemetryHandler.UpdateQueryLimits)
+		}
+
+		// Self-Serve Billing
+		billingRoutes := v1.Group("/billing")
+		{
+			billingRoutes.POST("/checkout", billingHandler.CreateCheckout)
+			billingRoutes.POST("/stripe/webhook", billingHandler.StripeWebhook)
 		}
 
 		// Notification Channels
@@ -241,61 +667,95 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 		{
 			notifications.GET("/channels", notificationHandler.ListChannels)
 			notifications.GET("/channels/:id", notificationHandler.GetChannel)
-			notifications.POST("/channels", notificationHandler.CreateChannel)
-			notifications.PUT("/channels/:id", notificationHandler.UpdateChannel)
-			notifications.DELETE("/channels/:id", notificationHandler.DeleteChannel)
-			notifications.POST("/send", notificationHandler.SendNotification)
-			notifications.POST("/test", notificationHandler.TestChannel)
+			notifications.POST("/channels", canManagePolicies, idempotent, notificationHandler.CreateChannel)
+			notifications.PUT("/channels/:id", canManagePolicies, notificationHandler.UpdateChannel)
+			notifications.DELETE("/channels/:id", canManagePolicies, notificationHandler.DeleteChannel)
+			notifications.POST("/channels/:id/restore", canManagePolicies, notificationHandler.RestoreChannel)
+			notifications.DELETE("/channels/:id/purge", requireAdmin, notificationHandler.PurgeChannel)
+			notifications.POST("/send", canManagePolicies, notificationHandler.SendNotification)
+			notifications.POST("/test", canManagePolicies, notificationHandler.TestChannel)
+			notifications.POST("/broadcast", canManagePolicies, notificationHandler.BroadcastNotification)
+			notifications.GET("/tickets", notificationHandler.ListTickets)
+
+			// Notification and audit log retention (deployment-wide)
+			notifications.GET("/log-retention", requireAdmin, logRetentionHandler.GetLogRetention)
+			notifications.POST("/log-retention/apply", requireAdmin, logRetentionHandler.ApplyLogRetention)
+
+			// Notification groups
+			notifications.GET("/groups", notificationHandler.ListNotificationGroups)
+			notifications.GET("/groups/:id", notificationHandler.GetNotificationGroup)
+			notifications.POST("/groups", canManagePolicies, notificationHandler.CreateNotificationGroup)
+			notifications.PUT("/groups/:id", canManagePolicies, notificationHandler.UpdateNotificationGroup)
+			notifications.DELETE("/groups/:id", canManagePolicies, notificationHandler.DeleteNotificationGroup)
 		}
 
 		// AI-Powered Threat Analysis
 		ai := v1.Group("/ai")
 		{
 			ai.POST("/analyze", aiHandler.GenerateThreatSummary)
+			ai.GET("/analyze/:id/report", aiHandler.GetAnalysisReport)
 			ai.GET("/config", aiHandler.GetAIConfig)
-			ai.PUT("/config", aiHandler.UpdateAIConfig)
+			ai.PUT("/config", canManagePolicies, aiHandler.UpdateAIConfig)
 			ai.GET("/history", aiHandler.ListAnalysisHistory)
+			ai.GET("/prompts", aiHandler.ListPromptTemplates)
+			ai.PUT("/prompts/:analysis_type", canManagePolicies, aiHandler.SetPromptTemplate)
+			ai.DELETE("/prompts/:analysis_type", canManagePolicies, aiHandler.DeletePromptTemplate)
+			ai.GET("/guardrails", aiHandler.GetAIGuardrails)
+			ai.PUT("/guardrails", canManagePolicies, aiHandler.SetAIGuardrails)
 		}
 
 		// Collaborative Threat Hunting
 		collaborative := v1.Group("/collaborative")
 		{
 			// Shared Rules
-			collaborative.POST("/rules/publish", collaborativeHandler.PublishRule)
+			collaborative.POST("/rules/publish", canShare, collaborativeHandler.PublishRule)
 			collaborative.GET("/rules/search", collaborativeHandler.SearchRules)
 			collaborative.GET("/rules/:id", collaborativeHandler.GetRule)
-			collaborative.POST("/rules/:id/vote", collaborativeHandler.VoteRule)
+			collaborative.POST("/rules/:id/vote", canShare, collaborativeHandler.VoteRule)
 			collaborative.POST("/rules/:id/download", collaborativeHandler.DownloadRule)
-			collaborative.POST("/rules/:id/comments", collaborativeHandler.AddComment)
+			collaborative.POST("/rules/:id/comments", canShare, collaborativeHandler.AddComment)
 			collaborative.GET("/rules/:id/comments", collaborativeHandler.GetComments)
 
 			// Shared IOCs
-			collaborative.POST("/iocs/publish", collaborativeHandler.PublishIOC)
+			collaborative.POST("/iocs/publish", canShare, collaborativeHandler.PublishIOC)
 			collaborative.GET("/iocs/search", collaborativeHandler.SearchIOCs)
 			collaborative.GET("/iocs/:id", collaborativeHandler.GetIOC)
-			collaborative.POST("/iocs/:id/report", collaborativeHandler.ReportIOC)
+			collaborative.POST("/iocs/:id/report", canShare, collaborativeHandler.ReportIOC)
 
 			// Hunting Queries
-			collaborative.POST("/queries/publish", collaborativeHandler.PublishQuery)
+			collaborative.POST("/queries/publish", canShare, collaborativeHandler.PublishQuery)
 			collaborative.GET("/queries/search", collaborativeHandler.SearchQueries)
 			collaborative.GET("/queries/:id", collaborativeHandler.GetQuery)
 
+			// Moderation
+			collaborative.POST("/rules/:id/verify", canModerate, collaborativeHandler.VerifyRule)
+			collaborative.DELETE("/rules/:id", canModerate, collaborativeHandler.RemoveRule)
+			collaborative.DELETE("/rules/:id/comments/:comment_id", canModerate, collaborativeHandler.RemoveComment)
+			collaborative.POST("/iocs/:id/verify", canModerate, collaborativeHandler.VerifyIOC)
+			collaborative.DELETE("/iocs/:id", canModerate, collaborativeHandler.RemoveIOC)
+			collaborative.DELETE("/queries/:id", canModerate, collaborativeHandler.RemoveQuery)
+
 			// Statistics
 			collaborative.GET("/stats", collaborativeHandler.GetCommunityStats)
 		}
 
-		// Security Data Lake (Cold Storage)
-		dataLake := v1.Group("/datalake")
+		// Security Data Lake (Cold Storage). Every route acts on one license, which must have the
+		// data_lake feature; routes addressed by job ID are gated on the job's license.
+		dataLake := v1.Group("/datalake", featureGate.Require("data_lake"))
 		{
 			// Configuration
-			dataLake.POST("/config", dataLakeHandler.CreateDataLakeConfig)
+			dataLake.POST("/config", canManagePolicies, dataLakeHandler.CreateDataLakeConfig)
 			dataLake.GET("/config/:license_id", dataLakeHandler.GetDataLakeConfig)
-			dataLake.PUT("/config/:license_id", dataLakeHandler.UpdateDataLakeConfig)
-			dataLake.POST("/test", dataLakeHandler.TestDataLakeConnection)
+			dataLake.PUT("/config/:license_id", canManagePolicies, dataLakeHandler.UpdateDataLakeConfig)
+			dataLake.POST("/test", canManagePolicies, dataLakeHandler.TestDataLakeConnection)
+
+			// Data residency
+			dataLake.GET("/residency/:license_id", dataLakeHandler.GetDataResidency)
+			dataLake.PUT("/residency/:license_id", canManagePolicies, dataLakeHandler.SetDataResidency)
+			dataLake.DELETE("/residency/:license_id", requireAdmin, dataLakeHandler.DeleteDataResidency)
 
 			// Archive Jobs
-			dataLake.POST("/jobs", dataLakeHandler.CreateArchiveJob)
-			dataLake.GET("/jobs/:id", dataLakeHandler.GetArchiveJob)
+			dataLake.POST("/jobs", canManagePolicies, idempotent, dataLakeHandler.CreateArchiveJob)
 			dataLake.GET("/jobs", dataLakeHandler.ListArchiveJobs)
 
 			// Datasets
@@ -305,20 +765,57 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 			// Statistics
 			dataLake.GET("/stats", dataLakeHandler.GetDataLakeStatistics)
 		}
+		dataLakeJobs := v1.Group("/datalake/jobs", featureGate.Require("data_lake", dataLakeHandler.ArchiveJobLicense))
+		{
+			dataLakeJobs.GET("/:id", dataLakeHandler.GetArchiveJob)
+			dataLakeJobs.POST("/:id/resume", canManagePolicies, dataLakeHandler.ResumeRestoreJob)
+		}
+
+		// Deployment-wide data lake settings, not tied to a license
+		dataLakeAdmin := v1.Group("/datalake")
+		{
+			dataLakeAdmin.GET("/residency/zones", dataLakeHandler.ListResidencyZones)
+
+			// Hot storage retention (ClickHouse TTL)
+			dataLakeAdmin.GET("/retention", retentionHandler.GetRetentionPlan)
+			dataLakeAdmin.POST("/retention/apply", requireAdmin, retentionHandler.ApplyRetention)
+		}
+
+		// Legal hold (held data is exempt from retention; exports are signed with the platform key)
+		legalHold := v1.Group("/legal-hold")
+		{
+			legalHold.POST("/holds", requireAdmin, legalHoldHandler.CreateLegalHold)
+			legalHold.GET("/holds", legalHoldHandler.ListLegalHolds)
+			legalHold.GET("/holds/:id", legalHoldHandler.GetLegalHold)
+			legalHold.POST("/holds/:id/release", requireAdmin, legalHoldHandler.ReleaseLegalHold)
+			legalHold.POST("/export", requireAdmin, legalHoldHandler.ExportLegalHold)
+			legalHold.POST("/verify", legalHoldHandler.VerifyLegalHoldExport)
+			legalHold.GET("/public-key", legalHoldHandler.GetLegalHoldPublicKey)
+		}
 
 		// Deception Technology (Honeypots & Honey Tokens)
 		deception := v1.Group("/deception")
 		{
 			// Honeypots
-			deception.POST("/honeypots", deceptionHandler.CreateHoneypot)
+			deception.POST("/honeypots", canDeployDeception, idempotent, deceptionHandler.CreateHoneypot)
 			deception.GET("/honeypots", deceptionHandler.ListHoneypots)
 			deception.GET("/honeypots/:id", deceptionHandler.GetHoneypot)
-			deception.PUT("/honeypots/:id", deceptionHandler.UpdateHoneypot)
-			deception.DELETE("/honeypots/:id", deceptionHandler.DeleteHoneypot)
+			deception.PUT("/honeypots/:id", canDeployDeception, deceptionHandler.UpdateHoneypot)
+			deception.DELETE("/honeypots/:id", canDeployDeception, deceptionHandler.DeleteHoneypot)
+			deception.POST("/honeypots/:id/restore", canDeployDeception, deceptionHandler.RestoreHoneypot)
+			deception.DELETE("/honeypots/:id/purge", requireAdmin, deceptionHandler.PurgeHoneypot)
 
 			// Honey Tokens
-			deception.POST("/tokens", deceptionHandler.CreateHoneyToken)
+			deception.POST("/tokens", canDeployDeception, deceptionHandler.CreateHoneyToken)
 			deception.GET("/tokens", deceptionHandler.ListHoneyTokens)
+			deception.GET("/tokens/:id/document", deceptionHandler.DownloadHoneyTokenDocument)
+			deception.GET("/callback/:id", deceptionHandler.HoneyTokenCallback)
+			deception.GET("/callback/:id/:asset", deceptionHandler.HoneyTokenCallback)
+
+			// Response playbooks, run by alert rule actions
+			deception.POST("/playbooks", canDeployDeception, deceptionHandler.CreatePlaybook)
+			deception.GET("/playbooks", deceptionHandler.ListPlaybooks)
+			deception.DELETE("/playbooks/:id", canDeployDeception, deceptionHandler.DeletePlaybook)
 
 			// Events
 			deception.POST("/events", deceptionHandler.RecordDeceptionEvent)
@@ -326,9 +823,68 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 
 			// Statistics & Templates
 			deception.GET("/stats", deceptionHandler.GetDeceptionStatistics)
+			deception.GET("/attacker-paths", deceptionHandler.GetAttackerPaths)
+			deception.POST("/auto-deploy", canDeployDeception, deceptionHandler.AutoDeployHoneypots)
 			deception.GET("/templates", deceptionHandler.ListHoneypotTemplates)
 		}
 
+		// Incident Case Management
+		cases := v1.Group("/cases")
+		{
+			cases.POST("", canManageCases, caseHandler.CreateCase)
+			cases.GET("", caseHandler.ListCases)
+			cases.GET("/:id", caseHandler.GetCase)
+			cases.PUT("/:id", canManageCases, caseHandler.UpdateCase)
+			cases.DELETE("/:id", canManageCases, caseHandler.DeleteCase)
+			cases.POST("/:id/items", canManageCases, caseHandler.AttachCaseItem)
+			cases.DELETE("/:id/items/:item_id", canManageCases, caseHandler.DetachCaseItem)
+			cases.POST("/:id/notes", canManageCases, caseHandler.AddCaseNote)
+			cases.GET("/:id/graph", correlationHandler.GetCorrelationGraph)
+		}
+
+		// Scheduled Jobs
+		schedules := v1.Group("/schedules")
+		{
+			schedules.GET("", schedulerHandler.ListScheduledJobs)
+			schedules.POST("", canManagePolicies, schedulerHandler.CreateScheduledJob)
+			schedules.GET("/job-types", schedulerHandler.ListJobTypes)
+			schedules.POST("/preview", schedulerHandler.PreviewSchedule)
+			schedules.GET("/:id", schedulerHandler.GetScheduledJob)
+			schedules.PUT("/:id", canManagePolicies, schedulerHandler.UpdateScheduledJob)
+			schedules.DELETE("/:id", canManagePolicies, schedulerHandler.DeleteScheduledJob)
+			schedules.POST("/:id/run", canManagePolicies, schedulerHandler.RunScheduledJob)
+		}
+
+		// Scheduled Reports
+		reports := v1.Group("/reports")
+		{
+			reports.GET("/schedules", reportHandler.ListReportSchedules)
+			reports.POST("/schedules", canManagePolicies, reportHandler.CreateReportSchedule)
+			reports.DELETE("/schedules/:id", canManagePolicies, reportHandler.DeleteReportSchedule)
+			reports.GET("/preview", reportHandler.PreviewReport)
+		}
+
+		// Global Search
+		v1.GET("/search", searchHandler.Search)
+
+		// API Keys (service-to-service credentials)
+		apiKeys := v1.Group("/apikeys")
+		{
+			// Not idempotent: a replay would need the plaintext key stored with the response
+			apiKeys.POST("", canManageAPIKeys, apiKeyHandler.CreateAPIKey)
+			apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+			apiKeys.GET("/:id", apiKeyHandler.GetAPIKey)
+			apiKeys.POST("/:id/rotate", canManageAPIKeys, apiKeyHandler.RotateAPIKey)
+			apiKeys.DELETE("/:id", canManageAPIKeys, apiKeyHandler.RevokeAPIKey)
+		}
+
+		// User Behavior Analytics (user risk scoring)
+		ueba := v1.Group("/ueba")
+		{
+			ueba.GET("/users", uebaHandler.ListUserRisk)
+			ueba.GET("/users/:username", uebaHandler.GetUserRisk)
+		}
+
 		// WebSocket Live Updates
 		ws := v1.Group("/ws")
 		{
@@ -336,11 +892,34 @@ func setupRouter(db *sql.DB, ch driver.Conn, licService *licenseService.LicenseS
 			ws.GET("/stats", handlers.GetConnectionStats())
 			ws.POST("/disconnect/:id", handlers.DisconnectClient)
 		}
+
+		// Long-polling fallback for clients that cannot hold a WebSocket
+		v1.GET("/events/stream", handlers.StreamEvents)
 	}
 
 	return router
 }
 
+// configureLogging applies LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT (json, text)
+func configureLogging() {
+	switch strings.ToLower(getEnv("LOG_FORMAT", "json")) {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.SetFormatter(&log.JSONFormatter{})
+		log.Warnf("Unknown LOG_FORMAT %q, using json", os.Getenv("LOG_FORMAT"))
+	}
+
+	level, err := log.ParseLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Warnf("Invalid LOG_LEVEL %q, using info", os.Getenv("LOG_LEVEL"))
+		level = log.InfoLevel
+	}
+	log.SetLevel(level)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -357,8 +936,21 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func loadLicenseKeys(privateKeyPath, publicKeyPath string) (privateKey, publicKey []byte, err error) {
-	privateKey, err = os.ReadFile(privateKeyPath)
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key, defaultValue string) []string {
+	values := []string{}
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func loadLicenseKeys(provider secrets.SecretProvider, privateKeyName, publicKeyName string) (privateKey, publicKey []byte, err error) {
+	ctx := context.Background()
+
+	privateKey, err = provider.Get(ctx, privateKeyName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read private key: %w", err)
 	}
@@ -368,7 +960,7 @@ func loadLicenseKeys(privateKeyPath, publicKeyPath string) (privateKey, publicKe
 		return nil, nil, fmt.Errorf("invalid private key size: expected %d bytes, got %d bytes", ed25519.PrivateKeySize, len(privateKey))
 	}
 
-	publicKey, err = os.ReadFile(publicKeyPath)
+	publicKey, err = provider.Get(ctx, publicKeyName)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to read public key: %w", err)
 	}
@@ -381,3 +973,31 @@ func loadLicenseKeys(privateKeyPath, publicKeyPath string) (privateKey, publicKe
 	log.Info("License keys validated successfully")
 	return privateKey, publicKey, nil
 }
+
+// loadUpdateSigningKey reads the raw Ed25519 public key agent update packages are signed with
+func loadUpdateSigningKey(path string) (ed25519.PublicKey, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read update signing key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update signing key size: expected %d bytes, got %d bytes", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// loadSSOProviders reads the identity provider list from a JSON file; no path disables SSO
+func loadSSOProviders(path string) ([]models.SSOProvider, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSO config: %w", err)
+	}
+	var providers []models.SSOProvider
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("failed to parse SSO config: %w", err)
+	}
+	return providers, nil
+}
@@ -4,6 +4,7 @@
 -- Enable UUID extension
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";   -- Substring search over license customers
 
 -- ============================================================================
 -- LICENSE MANAGEMENT TABLES
@@ -25,6 +26,11 @@ CREATE TABLE IF NOT EXISTS licenses (
     activated_at      TIMESTAMP,
     last_validated_at TIMESTAMP,
     metadata          JSONB DEFAULT '{}',
+    feature_overrides JSONB DEFAULT '{}',  -- Per-license feature grants/restrictions on top of the tier defaults
+    query_limits      JSONB DEFAULT '{}',  -- Per-license ClickHouse query limits on top of the tier limits
+    stripe_customer_id     VARCHAR(255),  -- Set for licenses purchased through self-serve billing
+    stripe_subscription_id VARCHAR(255) UNIQUE,
+    parent_license_id UUID REFERENCES licenses(id) ON DELETE SET NULL,  -- Managing (MSSP or parent org) license; it may query this license's telemetry
     created_at        TIMESTAMP DEFAULT NOW(),
     updated_at        TIMESTAMP DEFAULT NOW()
 );
@@ -36,9 +42,25 @@ CREATE TABLE IF NOT EXISTS license_usage (
     active_users     INTEGER DEFAULT 0,
     events_ingested  BIGINT DEFAULT 0,
     storage_used_gb  NUMERIC(10, 2) DEFAULT 0,
+    overage_since    TIMESTAMP,  -- Set while active agents or users exceed the license caps for a sustained period
     last_updated     TIMESTAMP DEFAULT NOW()
 );
 
+-- Periodic license usage snapshots (time series for usage history and overage detection)
+CREATE TABLE IF NOT EXISTS license_usage_snapshots (
+    id               UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id       UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    active_agents    INTEGER NOT NULL DEFAULT 0,
+    active_users     INTEGER NOT NULL DEFAULT 0,
+    max_agents       INTEGER NOT NULL,
+    max_users        INTEGER NOT NULL,
+    events_ingested  BIGINT DEFAULT 0,
+    storage_used_gb  NUMERIC(10, 2) DEFAULT 0,
+    agents_over_cap  BOOLEAN DEFAULT FALSE,
+    users_over_cap   BOOLEAN DEFAULT FALSE,
+    captured_at      TIMESTAMP DEFAULT NOW()
+);
+
 -- License activation history
 CREATE TABLE IF NOT EXISTS license_activations (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -47,7 +69,9 @@ CREATE TABLE IF NOT EXISTS license_activations (
     hostname        VARCHAR(255),
     ip_address      INET,
     os_type         VARCHAR(50),
+    machine_fingerprint VARCHAR(256),  -- Hardware fingerprint reported by the agent; binds a seat to one machine
     activated_at    TIMESTAMP DEFAULT NOW(),
+    last_seen_at    TIMESTAMP DEFAULT NOW(),
     deactivated_at  TIMESTAMP
 );
 
@@ -61,6 +85,29 @@ CREATE TABLE IF NOT EXISTS license_audit_log (
     created_at      TIMESTAMP DEFAULT NOW()
 );
 
+-- Outbound license lifecycle webhooks (outbox; delivered with retries by the license service)
+CREATE TABLE IF NOT EXISTS license_webhook_deliveries (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    event_type      VARCHAR(100) NOT NULL,  -- license.created, license.upgraded, license.downgraded, license.extended, license.revoked, license.reactivated, license.expiring, license.expired
+    dedup_key       VARCHAR(255) UNIQUE,    -- Prevents re-emitting scheduled events (expiring/expired) for the same expiry
+    payload         JSONB NOT NULL,
+    status          VARCHAR(50) DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts        INTEGER DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    delivered_at    TIMESTAMP,
+    created_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- Processed Stripe webhook events (Stripe retries deliveries; each event is applied once)
+CREATE TABLE IF NOT EXISTS billing_events (
+    id              VARCHAR(255) PRIMARY KEY,  -- Stripe event ID
+    event_type      VARCHAR(100) NOT NULL,
+    license_id      UUID REFERENCES licenses(id) ON DELETE SET NULL,
+    processed_at    TIMESTAMP DEFAULT NOW()
+);
+
 -- ============================================================================
 -- USER MANAGEMENT TABLES
 -- ============================================================================
@@ -69,10 +116,12 @@ CREATE TABLE IF NOT EXISTS license_audit_log (
 CREATE TABLE IF NOT EXISTS users (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     email           VARCHAR(255) UNIQUE NOT NULL,
-    password_hash   TEXT NOT NULL,
+    password_hash   TEXT,  -- NULL for users who sign in through SSO
     full_name       VARCHAR(255),
-    role            VARCHAR(50) NOT NULL CHECK (role IN ('admin', 'analyst', 'viewer')),
+    role            VARCHAR(50) NOT NULL CHECK (role IN ('admin', 'analyst', 'responder', 'read_only', 'mssp', 'viewer')),  -- viewer: legacy name of read_only
     license_id      UUID REFERENCES licenses(id) ON DELETE SET NULL,
+    auth_provider   VARCHAR(100),  -- SSO provider the user is linked to
+    external_id     TEXT,          -- Subject identifier at the SSO provider; SSO logins match on these two, never on email
     is_active       BOOLEAN DEFAULT TRUE,
     last_login      TIMESTAMP,
     created_at      TIMESTAMP DEFAULT NOW(),
@@ -110,8 +159,31 @@ CREATE TABLE IF NOT EXISTS agents (
     memory_usage_mb INTEGER,
     events_sent     BIGINT DEFAULT 0,
     config          JSONB DEFAULT '{}',
+    groups          TEXT[] DEFAULT '{}',  -- Agent groups (e.g. finance, engineering) used to target policies
     created_at      TIMESTAMP DEFAULT NOW(),
-    updated_at      TIMESTAMP DEFAULT NOW()
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    deleted_at      TIMESTAMP, -- Soft-deleted; NULL while live
+    version         INTEGER NOT NULL DEFAULT 1  -- Optimistic concurrency; returned as the ETag
+);
+
+-- Agent update packages (published builds offered to agents through the heartbeat)
+CREATE TABLE IF NOT EXISTS agent_update_packages (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    version             VARCHAR(50) NOT NULL,
+    os_type             VARCHAR(50) NOT NULL,
+    arch                VARCHAR(20) NOT NULL DEFAULT 'amd64',
+    download_url        TEXT NOT NULL,
+    sha256              CHAR(64) NOT NULL,
+    signature           TEXT NOT NULL,         -- Base64 Ed25519 signature of the SHA-256 digest
+    size_bytes          BIGINT,
+    release_notes       TEXT,
+    rollout_percentage  INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percentage BETWEEN 0 AND 100),
+    rollout_groups      TEXT[] DEFAULT '{}',   -- Limits the rollout to agents in these groups when set
+    is_active           BOOLEAN DEFAULT TRUE,
+    published_by        VARCHAR(255),
+    created_at          TIMESTAMP DEFAULT NOW(),
+    updated_at          TIMESTAMP DEFAULT NOW(),
+    UNIQUE (version, os_type, arch)
 );
 
 -- ============================================================================
@@ -126,11 +198,13 @@ CREATE TABLE IF NOT EXISTS dlp_policies (
     description       TEXT,
     severity          VARCHAR(50) CHECK (severity IN ('low', 'medium', 'high', 'critical')),
     enabled           BOOLEAN DEFAULT TRUE,
-    rule_type         VARCHAR(50) CHECK (rule_type IN ('fingerprint', 'regex', 'ml')),
+    rule_type         VARCHAR(50) CHECK (rule_type IN ('regex', 'keyword', 'fingerprint', 'edm', 'detector', 'ml')),
     config            JSONB DEFAULT '{}',
     fingerprint_count INTEGER DEFAULT 0,
     created_at        TIMESTAMP DEFAULT NOW(),
-    updated_at        TIMESTAMP DEFAULT NOW()
+    updated_at        TIMESTAMP DEFAULT NOW(),
+    deleted_at        TIMESTAMP, -- Soft-deleted; NULL while live
+    version           INTEGER NOT NULL DEFAULT 1  -- Optimistic concurrency; returned as the ETag
 );
 
 -- DLP fingerprints
@@ -142,6 +216,37 @@ CREATE TABLE IF NOT EXISTS dlp_fingerprints (
     created_at        TIMESTAMP DEFAULT NOW()
 );
 
+-- Exact data match datasets (known sensitive records; only salted hashes of cell values are stored)
+CREATE TABLE IF NOT EXISTS dlp_edm_datasets (
+    id                UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id        UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    name              VARCHAR(255) NOT NULL,
+    description       TEXT,
+    columns           TEXT[] NOT NULL,
+    salt              VARCHAR(64) NOT NULL,  -- Hex HMAC key; per dataset so hashes cannot be compared across datasets
+    row_count         INTEGER DEFAULT 0,
+    min_matches       INTEGER DEFAULT 2,     -- Cells from one row that must appear together to flag content
+    created_by        VARCHAR(255),
+    created_at        TIMESTAMP DEFAULT NOW(),
+    updated_at        TIMESTAMP DEFAULT NOW()
+);
+
+-- Exact data match cell hashes
+CREATE TABLE IF NOT EXISTS dlp_edm_hashes (
+    dataset_id        UUID REFERENCES dlp_edm_datasets(id) ON DELETE CASCADE,
+    row_index         INTEGER NOT NULL,
+    column_index      SMALLINT NOT NULL,
+    cell_hash         CHAR(64) NOT NULL
+);
+
+-- DLP policy assignments (a policy with no assignments applies to every agent of its license)
+CREATE TABLE IF NOT EXISTS dlp_policy_assignments (
+    policy_id         UUID REFERENCES dlp_policies(id) ON DELETE CASCADE,
+    group_name        VARCHAR(255) NOT NULL,
+    created_at        TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (policy_id, group_name)
+);
+
 -- ============================================================================
 -- ALERT RULES TABLES
 -- ============================================================================
@@ -155,24 +260,110 @@ CREATE TABLE IF NOT EXISTS alert_rules (
     severity        VARCHAR(50),
     enabled         BOOLEAN DEFAULT TRUE,
     condition       JSONB NOT NULL,  -- Rule condition in JSON format
-    actions         JSONB DEFAULT '[]',  -- Actions to take (email, webhook, etc.)
+    actions         JSONB DEFAULT '[]',  -- [{type: notify/create_case/isolate_host/run_playbook, parameters, stop_on_failure}]
+    mitre_techniques TEXT[] DEFAULT '{}',  -- ATT&CK techniques the rule is designed to detect
     created_by      UUID REFERENCES users(id),
     created_at      TIMESTAMP DEFAULT NOW(),
     updated_at      TIMESTAMP DEFAULT NOW()
 );
 
--- Alert instances (fired alerts)
+-- Alert instances (fired alerts). Lifecycle: new -> acknowledged -> resolved or suppressed;
+-- reopening returns an alert to new.
 CREATE TABLE IF NOT EXISTS alert_instances (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     rule_id         UUID REFERENCES alert_rules(id) ON DELETE CASCADE,
     agent_id        UUID REFERENCES agents(id),
     severity        VARCHAR(50),
     message         TEXT,
+    entity_type     VARCHAR(50),               -- Primary entity, one of the alert_suppressions entity types
+    entity_value    TEXT,
+    matched_event_ids TEXT[] DEFAULT '{}',     -- Telemetry or deception event IDs the alert fired on
+    details         JSONB,
+    status          VARCHAR(50) NOT NULL DEFAULT 'new' CHECK (status IN ('new', 'acknowledged', 'resolved', 'suppressed')),
+    resolution      VARCHAR(50) CHECK (resolution IN ('true_positive', 'false_positive', 'benign')),
+    assigned_to     UUID REFERENCES users(id) ON DELETE SET NULL,
+    assigned_at     TIMESTAMP,
+    suppression_id  UUID,                      -- alert_suppressions entry created when suppressing it
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    acknowledged_at TIMESTAMP,
+    acknowledged_by VARCHAR(255),
+    resolved_at     TIMESTAMP,                 -- Also set when suppressed
+    resolved_by     VARCHAR(255)
+);
+
+-- Lifecycle of each alert instance: raised, every status change and assignment
+CREATE TABLE IF NOT EXISTS alert_status_history (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    alert_id        UUID NOT NULL REFERENCES alert_instances(id) ON DELETE CASCADE,
+    action          VARCHAR(50) NOT NULL,  -- raised, acknowledge, resolve, suppress, reopen, assign
+    from_status     VARCHAR(50),
+    to_status       VARCHAR(50) NOT NULL,
+    changed_by      VARCHAR(255),
+    note            TEXT,
     details         JSONB,
-    status          VARCHAR(50) CHECK (status IN ('open', 'investigating', 'resolved', 'false_positive')),
-    assigned_to     UUID REFERENCES users(id),
+    changed_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Analyst notes on alert instances
+CREATE TABLE IF NOT EXISTS alert_notes (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    alert_id        UUID NOT NULL REFERENCES alert_instances(id) ON DELETE CASCADE,
+    author          VARCHAR(255),
+    body            TEXT NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Audit trail of alert rule actions run when an alert fired
+CREATE TABLE IF NOT EXISTS alert_action_executions (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    alert_id        UUID NOT NULL REFERENCES alert_instances(id) ON DELETE CASCADE,
+    rule_id         UUID REFERENCES alert_rules(id) ON DELETE SET NULL,
+    action_index    INTEGER NOT NULL,
+    action_type     VARCHAR(50),
+    status          VARCHAR(50) NOT NULL CHECK (status IN ('succeeded', 'failed', 'skipped')),
+    result          JSONB,
+    error           TEXT,
+    executed_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Commands queued for agents (host isolation, IP blocks), delivered in the heartbeat response
+CREATE TABLE IF NOT EXISTS agent_commands (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    agent_id        UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    command_type    VARCHAR(50) NOT NULL CHECK (command_type IN ('isolate', 'block_ip', 'release')),
+    parameters      JSONB DEFAULT '{}',
+    status          VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered')),
+    source          VARCHAR(255) NOT NULL,  -- What queued it, e.g. alert_rule:<id>
     created_at      TIMESTAMP DEFAULT NOW(),
-    resolved_at     TIMESTAMP
+    delivered_at    TIMESTAMP
+);
+
+-- False-positive suppressions: silence one rule for one entity without disabling the rule
+CREATE TABLE IF NOT EXISTS alert_suppressions (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id          UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    rule_id             UUID NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    entity_type         VARCHAR(50) NOT NULL CHECK (entity_type IN ('hostname', 'agent_id', 'username', 'source_ip', 'dst_ip', 'process_name', 'file_path', 'hash')),
+    entity_value        TEXT NOT NULL,             -- Matched case-insensitively
+    reason              TEXT NOT NULL,
+    created_by          VARCHAR(255),
+    expires_at          TIMESTAMP,                 -- NULL suppresses until removed
+    suppressed_count    BIGINT NOT NULL DEFAULT 0, -- Alerts silenced so far
+    last_suppressed_at  TIMESTAMP,
+    removed_at          TIMESTAMP,                 -- Removed entries are kept for the audit trail
+    removed_by          VARCHAR(255),
+    created_at          TIMESTAMP DEFAULT NOW()
+);
+
+-- Audit trail of suppression changes
+CREATE TABLE IF NOT EXISTS alert_suppression_audit (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    suppression_id  UUID NOT NULL REFERENCES alert_suppressions(id) ON DELETE CASCADE,
+    action          VARCHAR(50) NOT NULL,  -- created, removed
+    performed_by    VARCHAR(255),
+    details         JSONB,
+    created_at      TIMESTAMP DEFAULT NOW()
 );
 
 -- ============================================================================
@@ -184,18 +375,48 @@ CREATE TABLE IF NOT EXISTS mitre_tactics (
     tactic_id       VARCHAR(50) PRIMARY KEY,
     name            VARCHAR(255) NOT NULL,
     description     TEXT,
-    url             TEXT
+    url             TEXT,
+    shortname       VARCHAR(100),         -- Kill chain phase name, e.g. initial-access
+    stix_id         VARCHAR(100),         -- Set by the ATT&CK importer; NULL for seed rows
+    attack_version  VARCHAR(20),          -- ATT&CK release the row was last imported from
+    deprecated      BOOLEAN NOT NULL DEFAULT FALSE,
+    modified_at     TIMESTAMP,            -- STIX modified timestamp
+    updated_at      TIMESTAMP DEFAULT NOW()
 );
 
--- MITRE techniques
+-- MITRE techniques and sub-techniques (technique_id T1059.001 with parent_technique_id T1059)
 CREATE TABLE IF NOT EXISTS mitre_techniques (
-    technique_id    VARCHAR(50) PRIMARY KEY,
-    tactic_id       VARCHAR(50) REFERENCES mitre_tactics(tactic_id),
-    name            VARCHAR(255) NOT NULL,
-    description     TEXT,
-    platforms       TEXT[],
-    data_sources    TEXT[],
-    url             TEXT
+    technique_id        VARCHAR(50) PRIMARY KEY,
+    tactic_id           VARCHAR(50) REFERENCES mitre_tactics(tactic_id), -- First tactic, kept for existing queries
+    name                VARCHAR(255) NOT NULL,
+    description         TEXT,
+    platforms           TEXT[],
+    data_sources        TEXT[],
+    url                 TEXT,
+    tactic_ids          TEXT[] DEFAULT '{}',  -- Every tactic the technique belongs to
+    parent_technique_id VARCHAR(50),
+    is_subtechnique     BOOLEAN NOT NULL DEFAULT FALSE,
+    stix_id             VARCHAR(100),
+    attack_version      VARCHAR(20),
+    deprecated          BOOLEAN NOT NULL DEFAULT FALSE, -- Deprecated or revoked upstream; kept for historical events
+    modified_at         TIMESTAMP,
+    updated_at          TIMESTAMP DEFAULT NOW()
+);
+
+-- ATT&CK imports (one row per run of the STIX importer)
+CREATE TABLE IF NOT EXISTS mitre_imports (
+    id               UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    domain           VARCHAR(20) NOT NULL,  -- enterprise, mobile, ics
+    attack_version   VARCHAR(20),
+    source_url       TEXT NOT NULL,
+    tactics          INTEGER NOT NULL DEFAULT 0,
+    techniques       INTEGER NOT NULL DEFAULT 0,
+    subtechniques    INTEGER NOT NULL DEFAULT 0,
+    inserted         INTEGER NOT NULL DEFAULT 0,
+    updated          INTEGER NOT NULL DEFAULT 0,
+    deprecated       INTEGER NOT NULL DEFAULT 0,
+    imported_by      VARCHAR(255),
+    imported_at      TIMESTAMP DEFAULT NOW()
 );
 
 -- ============================================================================
@@ -226,10 +447,35 @@ CREATE TABLE IF NOT EXISTS ai_analysis_history (
     summary         TEXT NOT NULL,
     event_count     INTEGER NOT NULL,
     tokens_used     INTEGER DEFAULT 0,
+    result          JSONB,  -- Full structured ThreatSummary, rendered into incident reports
     created_at      TIMESTAMP DEFAULT NOW(),
     created_by      VARCHAR(255)
 );
 
+-- Per-license AI prompt templates ({{name}} variables; analysis_type 'default' covers types without one)
+CREATE TABLE IF NOT EXISTS ai_prompt_templates (
+    license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    analysis_type   VARCHAR(50) NOT NULL,
+    system_prompt   TEXT,                   -- NULL keeps the built-in system prompt
+    template        TEXT NOT NULL,
+    updated_by      VARCHAR(255),
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (license_id, analysis_type)
+);
+
+-- Per-license limits on what AI analyses send to external LLMs
+CREATE TABLE IF NOT EXISTS ai_guardrails (
+    license_id          UUID PRIMARY KEY REFERENCES licenses(id) ON DELETE CASCADE,
+    max_events          INTEGER DEFAULT 0,       -- Events shown in full; 0 leaves it to the request
+    allow_custom_prompt BOOLEAN DEFAULT TRUE,
+    redact_fields       TEXT[] DEFAULT '{}',     -- Event fields and payload keys masked before prompting
+    redact_detectors    TEXT[] DEFAULT '{}',     -- Built-in DLP detectors masked in the prompt
+    forbidden_patterns  TEXT[] DEFAULT '{}',     -- Prompts still matching one are not sent
+    updated_by          VARCHAR(255),
+    updated_at          TIMESTAMP DEFAULT NOW()
+);
+
 -- ============================================================================
 -- COLLABORATIVE THREAT HUNTING TABLES
 -- ============================================================================
@@ -368,6 +614,17 @@ CREATE TABLE IF NOT EXISTS data_lake_configs (
     updated_at            TIMESTAMP DEFAULT NOW()
 );
 
+-- Data residency (pins a license's stored data to a geographic zone)
+CREATE TABLE IF NOT EXISTS data_residency_configs (
+    license_id       UUID PRIMARY KEY REFERENCES licenses(id) ON DELETE CASCADE,
+    zone             VARCHAR(20) NOT NULL,     -- eu, uk, us, apac
+    allowed_regions  TEXT[] DEFAULT '{}',      -- Empty allows every region of the zone
+    default_region   VARCHAR(100),
+    updated_by       VARCHAR(255),
+    created_at       TIMESTAMP DEFAULT NOW(),
+    updated_at       TIMESTAMP DEFAULT NOW()
+);
+
 -- Archive jobs tracking
 CREATE TABLE IF NOT EXISTS archive_jobs (
     id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -407,6 +664,20 @@ CREATE TABLE IF NOT EXISTS archived_datasets (
     archived_at         TIMESTAMP DEFAULT NOW()
 );
 
+-- Per-dataset progress of restore jobs, so a failed restore resumes where it stopped
+CREATE TABLE IF NOT EXISTS restore_job_datasets (
+    job_id          UUID NOT NULL REFERENCES archive_jobs(id) ON DELETE CASCADE,
+    dataset_id      UUID NOT NULL REFERENCES archived_datasets(id) ON DELETE CASCADE,
+    position        INTEGER NOT NULL,                -- Restore order
+    status          VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    rows_committed  BIGINT NOT NULL DEFAULT 0,       -- Dataset rows already read and inserted; skipped on resume
+    rows_skipped    BIGINT NOT NULL DEFAULT 0,
+    error           TEXT,
+    completed_at    TIMESTAMP,
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (job_id, dataset_id)
+);
+
 -- Data access logs for compliance
 CREATE TABLE IF NOT EXISTS data_access_logs (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -420,6 +691,37 @@ CREATE TABLE IF NOT EXISTS data_access_logs (
     accessed_at     TIMESTAMP DEFAULT NOW()
 );
 
+-- Legal holds (telemetry from start_time on is exempt from retention while active)
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id          UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name                VARCHAR(255) NOT NULL,
+    matter_reference    VARCHAR(255),              -- Case or docket number
+    start_time          TIMESTAMP NOT NULL,
+    end_time            TIMESTAMP NOT NULL,
+    agent_ids           TEXT[] DEFAULT '{}',       -- Limits exported events; empty exports every agent
+    status              VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released')),
+    created_by          VARCHAR(255),
+    created_at          TIMESTAMP DEFAULT NOW(),
+    released_by         VARCHAR(255),
+    released_at         TIMESTAMP,
+    CHECK (end_time > start_time)
+);
+
+-- Signed legal hold export packages (the package itself is handed to the requester, not stored)
+CREATE TABLE IF NOT EXISTS legal_hold_exports (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    hold_id             UUID NOT NULL REFERENCES legal_holds(id) ON DELETE CASCADE,
+    license_id          UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    event_count         BIGINT NOT NULL DEFAULT 0,
+    audit_count         BIGINT NOT NULL DEFAULT 0,
+    manifest_sha256     VARCHAR(64) NOT NULL,
+    signature           TEXT NOT NULL,             -- base64 Ed25519 signature over manifest.json
+    size_bytes          BIGINT NOT NULL DEFAULT 0,
+    created_by          VARCHAR(255),
+    created_at          TIMESTAMP DEFAULT NOW()
+);
+
 -- Compliance reports
 CREATE TABLE IF NOT EXISTS compliance_reports (
     id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -455,7 +757,9 @@ CREATE TABLE IF NOT EXISTS honeypots (
     deployed_at         TIMESTAMP DEFAULT NOW(),
     metadata            JSONB DEFAULT '{}',
     created_at          TIMESTAMP DEFAULT NOW(),
-    updated_at          TIMESTAMP DEFAULT NOW()
+    updated_at          TIMESTAMP DEFAULT NOW(),
+    deleted_at          TIMESTAMP, -- Soft-deleted; NULL while live
+    version             INTEGER NOT NULL DEFAULT 1  -- Optimistic concurrency; returned as the ETag
 );
 
 -- Honey tokens
@@ -463,13 +767,14 @@ CREATE TABLE IF NOT EXISTS honey_tokens (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
     name            VARCHAR(255) NOT NULL,
-    token_type      VARCHAR(50) CHECK (token_type IN ('aws_key', 'api_key', 'database_creds', 'document_url', 'dns_query', 'email_address', 'web_bug', 'qr_code', 'office_document')),
+    token_type      VARCHAR(50) CHECK (token_type IN ('aws_key', 'api_key', 'database_creds', 'document_url', 'dns_query', 'email_address', 'web_bug', 'qr_code', 'office_document', 'azure_storage', 'slack_token', 'github_token', 'custom')),
     token_value     TEXT NOT NULL,
     callback_url    TEXT NOT NULL,
     is_active       BOOLEAN DEFAULT TRUE,
     access_count    INTEGER DEFAULT 0,
     last_accessed   TIMESTAMP,
     metadata        JSONB DEFAULT '{}',
+    expected_context JSONB,  -- Networks and business hours access is expected from; NULL grades every access alike
     created_at      TIMESTAMP DEFAULT NOW(),
     updated_at      TIMESTAMP DEFAULT NOW()
 );
@@ -493,6 +798,15 @@ CREATE TABLE IF NOT EXISTS deception_events (
     detected_at        TIMESTAMP DEFAULT NOW()
 );
 
+-- MITRE ATT&CK techniques evidenced by deception events, counted in coverage and statistics
+CREATE TABLE IF NOT EXISTS deception_mitre_mappings (
+    event_type         VARCHAR(50) NOT NULL,
+    interaction_type   VARCHAR(100) NOT NULL DEFAULT '', -- Empty matches every interaction type
+    technique_id       VARCHAR(50) NOT NULL,
+    tactic_id          VARCHAR(50) NOT NULL,
+    PRIMARY KEY (event_type, interaction_type, technique_id)
+);
+
 -- Deception campaigns
 CREATE TABLE IF NOT EXISTS deception_campaigns (
     id                UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -512,25 +826,45 @@ CREATE TABLE IF NOT EXISTS deception_campaigns (
     updated_at        TIMESTAMP DEFAULT NOW()
 );
 
+-- Deception playbooks, run by alert rules with a run_playbook action
+CREATE TABLE IF NOT EXISTS deception_playbooks (
+    id                 UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id         UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name               VARCHAR(255) NOT NULL,
+    description        TEXT,
+    enabled            BOOLEAN NOT NULL DEFAULT TRUE,
+    trigger_conditions JSONB DEFAULT '{}',
+    actions            JSONB NOT NULL DEFAULT '[]',  -- [{action_type, priority, parameters, description}]
+    execution_count    INTEGER NOT NULL DEFAULT 0,
+    last_executed      TIMESTAMP,
+    created_at         TIMESTAMP DEFAULT NOW(),
+    updated_at         TIMESTAMP DEFAULT NOW()
+);
+
 -- ============================================================================
 -- NOTIFICATION CHANNELS TABLES
 -- ============================================================================
 
--- Notification channels (Email, Slack, PagerDuty, Webhooks)
+-- Notification channels (Email, Slack, PagerDuty, Webhooks, Jira, ServiceNow)
 CREATE TABLE IF NOT EXISTS notification_channels (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
     name            VARCHAR(255) NOT NULL,
-    type            VARCHAR(50) CHECK (type IN ('email', 'slack', 'pagerduty', 'webhook')),
+    type            VARCHAR(50) CHECK (type IN ('email', 'slack', 'pagerduty', 'webhook', 'jira', 'servicenow')),
     enabled         BOOLEAN DEFAULT TRUE,
     config          JSONB DEFAULT '{}',
+    fallback_channel_id UUID REFERENCES notification_channels(id) ON DELETE SET NULL, -- Gets the message when this channel fails or its circuit is open
+    fallback_min_priority VARCHAR(50) NOT NULL DEFAULT 'critical' CHECK (fallback_min_priority IN ('low', 'medium', 'high', 'critical')),
     created_at      TIMESTAMP DEFAULT NOW(),
-    updated_at      TIMESTAMP DEFAULT NOW()
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    deleted_at      TIMESTAMP, -- Soft-deleted; NULL while live
+    version         INTEGER NOT NULL DEFAULT 1  -- Optimistic concurrency; returned as the ETag
 );
 
 -- Notification logs (audit trail of sent notifications)
+-- Partitioned by month so retention drops whole partitions; see create_notification_log_partition
 CREATE TABLE IF NOT EXISTS notification_logs (
-    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id              UUID NOT NULL DEFAULT uuid_generate_v4(),
     channel_id      UUID REFERENCES notification_channels(id) ON DELETE SET NULL,
     channel_type    VARCHAR(50),
     subject         TEXT NOT NULL,
@@ -538,8 +872,274 @@ CREATE TABLE IF NOT EXISTS notification_logs (
     priority        VARCHAR(50) CHECK (priority IN ('low', 'medium', 'high', 'critical')),
     status          VARCHAR(50) CHECK (status IN ('sent', 'failed', 'pending')),
     error           TEXT,
-    sent_at         TIMESTAMP DEFAULT NOW(),
-    metadata        JSONB DEFAULT '{}'
+    fallback_from   UUID REFERENCES notification_channels(id) ON DELETE SET NULL, -- Failed channel this delivery stood in for
+    sent_at         TIMESTAMP NOT NULL DEFAULT NOW(),
+    metadata        JSONB DEFAULT '{}',
+    PRIMARY KEY (id, sent_at)  -- The partition key must be part of the primary key
+) PARTITION BY RANGE (sent_at);
+
+-- Catches rows outside the created monthly partitions; retention deletes from it row by row
+CREATE TABLE IF NOT EXISTS notification_logs_default PARTITION OF notification_logs DEFAULT;
+
+-- Notification groups (named sets of channels notified together, e.g. on-call)
+CREATE TABLE IF NOT EXISTS notification_groups (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL,
+    description     TEXT,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW(),
+    UNIQUE (license_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS notification_group_channels (
+    group_id        UUID NOT NULL REFERENCES notification_groups(id) ON DELETE CASCADE,
+    channel_id      UUID NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, channel_id)
+);
+
+-- Notification tickets (Jira issues and ServiceNow incidents opened by ticketing channels)
+CREATE TABLE IF NOT EXISTS notification_tickets (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    channel_id      UUID REFERENCES notification_channels(id) ON DELETE SET NULL,
+    alert_id        UUID REFERENCES alert_instances(id) ON DELETE SET NULL,
+    system          VARCHAR(50) NOT NULL CHECK (system IN ('jira', 'servicenow')),
+    external_id     VARCHAR(255) NOT NULL, -- Jira issue ID or ServiceNow sys_id
+    external_key    VARCHAR(255), -- Jira issue key or ServiceNow incident number
+    url             TEXT,
+    status          VARCHAR(50) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    last_error      TEXT, -- Last failed attempt to close the ticket
+    created_at      TIMESTAMP DEFAULT NOW(),
+    closed_at       TIMESTAMP
+);
+
+-- ============================================================================
+-- INCIDENT CASE MANAGEMENT TABLES
+-- ============================================================================
+
+-- Cases (incidents grouping related alerts, events and IOCs)
+CREATE TABLE IF NOT EXISTS cases (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    title           VARCHAR(255) NOT NULL,
+    description     TEXT,
+    status          VARCHAR(50) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'investigating', 'contained', 'closed')),
+    severity        VARCHAR(50) NOT NULL CHECK (severity IN ('low', 'medium', 'high', 'critical')),
+    owner           VARCHAR(255),
+    tags            TEXT[] DEFAULT '{}',
+    created_by      VARCHAR(255),
+    correlation_rule_id UUID,          -- Set when opened by the correlation engine
+    correlation_key VARCHAR(512),      -- entity_type:value shared by the correlated alerts
+    closed_at       TIMESTAMP,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- Items attached to a case (events live in ClickHouse, so item_id is not a foreign key)
+CREATE TABLE IF NOT EXISTS case_items (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    case_id         UUID REFERENCES cases(id) ON DELETE CASCADE,
+    item_type       VARCHAR(50) NOT NULL CHECK (item_type IN ('event', 'alert', 'ioc', 'ai_analysis', 'deception_event')),
+    item_id         VARCHAR(255) NOT NULL,
+    summary         TEXT,
+    added_by        VARCHAR(255),
+    added_at        TIMESTAMP DEFAULT NOW(),
+    UNIQUE(case_id, item_type, item_id)
+);
+
+-- Case timeline (analyst notes plus automatic status/assignment entries)
+CREATE TABLE IF NOT EXISTS case_notes (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    case_id         UUID REFERENCES cases(id) ON DELETE CASCADE,
+    note_type       VARCHAR(50) NOT NULL CHECK (note_type IN ('note', 'status_change', 'assignment', 'item_added', 'item_removed')),
+    author          VARCHAR(255),
+    content         TEXT NOT NULL,
+    created_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- Correlation rules (group alerts sharing an entity into one case)
+CREATE TABLE IF NOT EXISTS correlation_rules (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL,
+    description     TEXT,
+    entity_type     VARCHAR(50) NOT NULL CHECK (entity_type IN ('agent', 'host', 'ip', 'user')),
+    window_minutes  INTEGER NOT NULL DEFAULT 60 CHECK (window_minutes > 0),
+    min_alerts      INTEGER NOT NULL DEFAULT 2 CHECK (min_alerts > 0),
+    enabled         BOOLEAN DEFAULT TRUE,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    updated_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================================================
+-- SCHEDULED JOBS
+-- ============================================================================
+
+-- Recurring jobs run by the API's scheduler on cron schedules (minute hour day month weekday)
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    id               UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id       UUID REFERENCES licenses(id) ON DELETE CASCADE,  -- NULL for platform-wide jobs
+    name             VARCHAR(255) NOT NULL,
+    job_type         VARCHAR(100) NOT NULL,
+    cron_expression  VARCHAR(255) NOT NULL,
+    timezone         VARCHAR(100) NOT NULL DEFAULT 'UTC',
+    enabled          BOOLEAN DEFAULT TRUE,
+    params           JSONB DEFAULT '{}',
+    last_run_at      TIMESTAMP,
+    last_status      VARCHAR(50) CHECK (last_status IN ('running', 'succeeded', 'failed')),
+    last_result      TEXT,
+    last_error       TEXT,
+    last_duration_ms BIGINT,
+    next_run_at      TIMESTAMP,  -- Filled in by the scheduler when NULL
+    created_at       TIMESTAMP DEFAULT NOW(),
+    updated_at       TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================================================
+-- IDEMPOTENCY KEYS
+-- ============================================================================
+
+-- Responses of create requests sent with an Idempotency-Key header, replayed on retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    scope           VARCHAR(512) NOT NULL,  -- license:method:route the key is unique within
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash    VARCHAR(64) NOT NULL,   -- SHA-256 of the request body; a reused key must carry the same request
+    status_code     INTEGER,                -- NULL while the first request is still in flight
+    content_type    VARCHAR(255),
+    response_body   BYTEA,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    completed_at    TIMESTAMP,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+-- ============================================================================
+-- EVENT VOLUME BASELINES
+-- ============================================================================
+
+-- Learned hourly event rate per agent, event type and hour of day (UTC), rebuilt from ClickHouse
+CREATE TABLE IF NOT EXISTS event_baselines (
+    license_id   UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    agent_id     VARCHAR(255) NOT NULL,   -- Agent identifier as reported in telemetry
+    event_type   VARCHAR(100) NOT NULL,
+    hour_of_day  SMALLINT NOT NULL CHECK (hour_of_day BETWEEN 0 AND 23),
+    mean         DOUBLE PRECISION NOT NULL,
+    stddev       DOUBLE PRECISION NOT NULL,
+    samples      INTEGER NOT NULL,        -- Days of history the statistics are based on
+    updated_at   TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (license_id, agent_id, event_type, hour_of_day)
+);
+
+-- Hours in which an agent's event volume deviated significantly from its baseline
+CREATE TABLE IF NOT EXISTS volume_anomalies (
+    id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id   UUID REFERENCES licenses(id) ON DELETE CASCADE,
+    agent_id     VARCHAR(255) NOT NULL,
+    event_type   VARCHAR(100) NOT NULL,   -- 'all' for an agent that went silent
+    kind         VARCHAR(20) NOT NULL CHECK (kind IN ('spike', 'drop', 'silent')),
+    hour_start   TIMESTAMP NOT NULL,
+    observed     BIGINT NOT NULL,
+    expected     DOUBLE PRECISION NOT NULL,
+    stddev       DOUBLE PRECISION NOT NULL,
+    z_score      DOUBLE PRECISION NOT NULL,
+    status       VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged')),
+    created_at   TIMESTAMP DEFAULT NOW(),
+    UNIQUE (license_id, agent_id, event_type, hour_start)
+);
+
+-- ============================================================================
+-- API KEYS
+-- ============================================================================
+
+-- Long-lived credentials for integrations and service accounts, presented as "Authorization: ApiKey <key>"
+CREATE TABLE IF NOT EXISTS api_keys (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL,
+    key_prefix      VARCHAR(32) UNIQUE NOT NULL,  -- Public part of the key, used for lookup and display
+    key_hash        VARCHAR(64) NOT NULL,         -- SHA-256 of the full key; the key itself is never stored
+    scopes          TEXT[] NOT NULL DEFAULT '{}', -- e.g. telemetry:read, dlp:write, agents:*, *
+    role            VARCHAR(50) NOT NULL DEFAULT 'read_only' CHECK (role IN ('admin', 'analyst', 'responder', 'read_only', 'mssp')),
+    created_by      VARCHAR(255),
+    rotated_from    UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    expires_at      TIMESTAMP,
+    revoked_at      TIMESTAMP,
+    last_used_at    TIMESTAMP,
+    last_used_ip    INET,
+    created_at      TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================================================
+-- CUSTOM TELEMETRY FIELDS
+-- ============================================================================
+
+-- Tenant-defined payload fields, each backed by a materialized column on telemetry_events
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id      UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name            VARCHAR(63) NOT NULL,    -- Name used in query filters
+    payload_key     VARCHAR(330) NOT NULL,   -- Dotted path into the event payload
+    field_type      VARCHAR(20) NOT NULL DEFAULT 'string' CHECK (field_type IN ('string', 'int', 'float', 'bool')),
+    column_name     VARCHAR(100) NOT NULL,   -- ClickHouse column, shared by licenses extracting the same key and type
+    indexed         BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by      VARCHAR(255),
+    created_at      TIMESTAMP DEFAULT NOW(),
+    UNIQUE (license_id, name)
+);
+
+-- Columns no custom field uses any more, dropped from ClickHouse by the custom_field_cleanup job
+CREATE TABLE IF NOT EXISTS custom_field_column_drops (
+    column_name     VARCHAR(100) PRIMARY KEY,
+    requested_at    TIMESTAMP DEFAULT NOW()
+);
+
+-- ============================================================================
+-- WATCHLISTS
+-- ============================================================================
+
+-- Lists of IOCs and entities; new telemetry touching a listed value raises an alert
+CREATE TABLE IF NOT EXISTS watchlists (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    license_id          UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    name                VARCHAR(255) NOT NULL,
+    description         TEXT,
+    severity            VARCHAR(20) NOT NULL DEFAULT 'high' CHECK (severity IN ('low', 'medium', 'high', 'critical')),
+    enabled             BOOLEAN NOT NULL DEFAULT TRUE,
+    community_feed      JSONB,      -- Community IOC filter when the list mirrors shared_iocs
+    last_synced_at      TIMESTAMP,  -- Last community feed import
+    last_evaluated_at   TIMESTAMP,  -- Events ingested up to this time have been matched
+    created_by          VARCHAR(255),
+    created_at          TIMESTAMP DEFAULT NOW(),
+    updated_at          TIMESTAMP DEFAULT NOW(),
+    UNIQUE (license_id, name)
+);
+
+-- Watched values
+CREATE TABLE IF NOT EXISTS watchlist_entries (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    watchlist_id    UUID NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+    entry_type      VARCHAR(20) NOT NULL CHECK (entry_type IN ('ip', 'domain', 'hash', 'username', 'file_path', 'process_name', 'hostname')),
+    value           TEXT NOT NULL,  -- Matched case-insensitively
+    comment         TEXT,
+    ioc_id          UUID REFERENCES shared_iocs(id) ON DELETE SET NULL,
+    hit_count       BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    UNIQUE (watchlist_id, entry_type, value)
+);
+
+-- Events that matched a watchlist entry
+CREATE TABLE IF NOT EXISTS watchlist_hits (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    watchlist_id    UUID NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+    entry_id        UUID NOT NULL REFERENCES watchlist_entries(id) ON DELETE CASCADE,
+    license_id      UUID NOT NULL REFERENCES licenses(id) ON DELETE CASCADE,
+    event_id        VARCHAR(64) NOT NULL,
+    agent_id        VARCHAR(64),
+    hostname        VARCHAR(255),
+    event_type      VARCHAR(50),
+    event_timestamp TIMESTAMP,
+    alert_id        UUID REFERENCES alert_instances(id) ON DELETE SET NULL,
+    created_at      TIMESTAMP DEFAULT NOW(),
+    UNIQUE (entry_id, event_id)
 );
 
 -- ============================================================================
@@ -551,37 +1151,92 @@ CREATE INDEX idx_licenses_email ON licenses(customer_email);
 CREATE INDEX idx_licenses_tier ON licenses(tier);
 CREATE INDEX idx_licenses_active ON licenses(is_active);
 CREATE INDEX idx_licenses_expires_at ON licenses(expires_at);
+CREATE INDEX idx_licenses_created_at ON licenses(created_at DESC);
+CREATE INDEX idx_licenses_parent ON licenses(parent_license_id) WHERE parent_license_id IS NOT NULL;
+-- Trigram indexes serve the ILIKE '%term%' customer search of the license list
+CREATE INDEX idx_licenses_customer_name_trgm ON licenses USING gin (customer_name gin_trgm_ops);
+CREATE INDEX idx_licenses_customer_email_trgm ON licenses USING gin (customer_email gin_trgm_ops);
+CREATE INDEX idx_licenses_company_name_trgm ON licenses USING gin (company_name gin_trgm_ops);
+CREATE INDEX idx_licenses_stripe_customer ON licenses(stripe_customer_id);
+
+CREATE INDEX idx_license_audit_log_license ON license_audit_log(license_id, created_at);
+CREATE INDEX idx_license_audit_log_created ON license_audit_log(created_at);
 
 -- License activation indexes
 CREATE INDEX idx_license_activations_license ON license_activations(license_id);
 CREATE INDEX idx_license_activations_agent ON license_activations(agent_id);
+CREATE UNIQUE INDEX idx_license_activations_fingerprint ON license_activations(license_id, machine_fingerprint)
+    WHERE machine_fingerprint IS NOT NULL AND deactivated_at IS NULL;
+
+-- License webhook indexes
+CREATE INDEX idx_license_webhook_deliveries_pending ON license_webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_license_webhook_deliveries_license ON license_webhook_deliveries(license_id);
+
+-- License usage snapshot indexes
+CREATE INDEX idx_license_usage_snapshots_license_time ON license_usage_snapshots(license_id, captured_at DESC);
 
 -- User indexes
 CREATE INDEX idx_users_email ON users(email);
 CREATE INDEX idx_users_role ON users(role);
 CREATE INDEX idx_users_license ON users(license_id);
+CREATE UNIQUE INDEX idx_users_external_identity ON users(auth_provider, external_id) WHERE external_id IS NOT NULL;
 
 -- Agent indexes
 CREATE INDEX idx_agents_license ON agents(license_id);
 CREATE INDEX idx_agents_status ON agents(status);
 CREATE INDEX idx_agents_last_seen ON agents(last_seen);
+CREATE INDEX idx_agents_groups ON agents USING GIN(groups);
+CREATE INDEX idx_agent_commands_pending ON agent_commands(agent_id, created_at) WHERE status = 'pending';
+CREATE INDEX idx_agent_update_packages_platform ON agent_update_packages(os_type, arch) WHERE is_active;
+CREATE INDEX idx_scheduled_jobs_due ON scheduled_jobs(next_run_at) WHERE enabled;
+CREATE INDEX idx_scheduled_jobs_license ON scheduled_jobs(license_id);
+
+-- Idempotency key indexes
+CREATE INDEX idx_idempotency_keys_created ON idempotency_keys(created_at);
+
+-- API key indexes
+CREATE INDEX idx_api_keys_license ON api_keys(license_id);
+
+-- Custom field indexes
+CREATE INDEX idx_custom_fields_column ON custom_fields(column_name);
+
+-- Baseline indexes
+CREATE INDEX idx_event_baselines_hour ON event_baselines(hour_of_day);
+CREATE INDEX idx_volume_anomalies_license ON volume_anomalies(license_id, hour_start DESC);
 
 -- DLP indexes
 CREATE INDEX idx_dlp_policies_license ON dlp_policies(license_id);
 CREATE INDEX idx_dlp_fingerprints_policy ON dlp_fingerprints(policy_id);
 CREATE INDEX idx_dlp_fingerprints_hash ON dlp_fingerprints(fingerprint_hash);
+CREATE INDEX idx_dlp_policy_assignments_group ON dlp_policy_assignments(group_name);
+CREATE INDEX idx_dlp_edm_datasets_license ON dlp_edm_datasets(license_id);
+CREATE INDEX idx_dlp_edm_hashes_lookup ON dlp_edm_hashes(dataset_id, cell_hash);
 
 -- Alert indexes
 CREATE INDEX idx_alert_rules_license ON alert_rules(license_id);
 CREATE INDEX idx_alert_instances_rule ON alert_instances(rule_id);
+CREATE UNIQUE INDEX idx_alert_suppressions_active ON alert_suppressions(rule_id, entity_type, lower(entity_value)) WHERE removed_at IS NULL;
+CREATE INDEX idx_alert_suppressions_license ON alert_suppressions(license_id, created_at DESC);
+CREATE INDEX idx_alert_suppression_audit ON alert_suppression_audit(suppression_id, created_at);
+CREATE INDEX idx_watchlists_license ON watchlists(license_id);
+CREATE INDEX idx_watchlist_hits_watchlist ON watchlist_hits(watchlist_id, created_at DESC);
+CREATE INDEX idx_watchlist_hits_license ON watchlist_hits(license_id, created_at DESC);
 CREATE INDEX idx_alert_instances_status ON alert_instances(status);
 CREATE INDEX idx_alert_instances_created ON alert_instances(created_at DESC);
+CREATE INDEX idx_alert_status_history_alert ON alert_status_history(alert_id, changed_at);
+CREATE INDEX idx_alert_notes_alert ON alert_notes(alert_id, created_at);
+CREATE INDEX idx_alert_instances_assigned ON alert_instances(assigned_to) WHERE assigned_to IS NOT NULL;
+CREATE INDEX idx_alert_instances_entity ON alert_instances(rule_id, entity_type, entity_value);
+CREATE INDEX idx_alert_action_executions_alert ON alert_action_executions(alert_id, executed_at);
 
 -- Notification indexes
 CREATE INDEX idx_notification_channels_license ON notification_channels(license_id);
 CREATE INDEX idx_notification_channels_type ON notification_channels(type);
 CREATE INDEX idx_notification_logs_channel ON notification_logs(channel_id);
 CREATE INDEX idx_notification_logs_sent_at ON notification_logs(sent_at DESC);
+CREATE INDEX idx_notification_tickets_alert ON notification_tickets(alert_id);
+CREATE INDEX idx_notification_tickets_open ON notification_tickets(channel_id) WHERE status = 'open';
+CREATE INDEX idx_notification_group_channels_channel ON notification_group_channels(channel_id);
 
 -- AI indexes
 CREATE INDEX idx_ai_analysis_tenant ON ai_analysis_history(tenant_id);
@@ -624,6 +1279,9 @@ CREATE INDEX idx_archived_datasets_dates ON archived_datasets(start_date, end_da
 CREATE INDEX idx_archived_datasets_archived ON archived_datasets(archived_at DESC);
 CREATE INDEX idx_data_access_logs_license ON data_access_logs(license_id);
 CREATE INDEX idx_data_access_logs_accessed ON data_access_logs(accessed_at DESC);
+CREATE INDEX idx_legal_holds_license ON legal_holds(license_id, status);
+CREATE INDEX idx_legal_hold_exports_hold ON legal_hold_exports(hold_id, created_at DESC);
+CREATE INDEX idx_legal_hold_exports_manifest ON legal_hold_exports(manifest_sha256);
 CREATE INDEX idx_compliance_reports_license ON compliance_reports(license_id);
 
 -- Deception indexes
@@ -642,6 +1300,70 @@ CREATE INDEX idx_deception_events_source_ip ON deception_events(source_ip);
 CREATE INDEX idx_deception_events_detected ON deception_events(detected_at DESC);
 CREATE INDEX idx_deception_campaigns_license ON deception_campaigns(license_id);
 CREATE INDEX idx_deception_campaigns_status ON deception_campaigns(status);
+CREATE INDEX idx_deception_playbooks_license ON deception_playbooks(license_id);
+
+-- Case indexes
+CREATE INDEX idx_cases_license ON cases(license_id);
+CREATE INDEX idx_cases_status ON cases(status);
+CREATE INDEX idx_cases_owner ON cases(owner);
+CREATE INDEX idx_cases_updated ON cases(updated_at DESC);
+CREATE INDEX idx_case_items_case ON case_items(case_id);
+CREATE INDEX idx_case_items_item ON case_items(item_type, item_id);
+CREATE INDEX idx_case_notes_case ON case_notes(case_id, created_at);
+CREATE INDEX idx_cases_correlation ON cases(license_id, correlation_key) WHERE correlation_key IS NOT NULL;
+CREATE INDEX idx_correlation_rules_license ON correlation_rules(license_id);
+
+-- MITRE ATT&CK indexes
+CREATE INDEX idx_mitre_techniques_parent ON mitre_techniques(parent_technique_id);
+CREATE INDEX idx_mitre_imports_imported ON mitre_imports(imported_at DESC);
+
+-- ============================================================================
+-- NOTIFICATION LOG PARTITIONS
+-- ============================================================================
+
+-- Monthly partitions are named notification_logs_pYYYYMM. Both functions run as the schema
+-- owner, so the application role can maintain partitions without DDL privileges.
+
+-- Creates the partition for the month containing p_month; returns its name
+CREATE OR REPLACE FUNCTION create_notification_log_partition(p_month DATE)
+RETURNS TEXT AS $$
+DECLARE
+    month_start DATE := date_trunc('month', p_month)::DATE;
+    partition   TEXT := 'notification_logs_p' || to_char(p_month, 'YYYYMM');
+BEGIN
+    IF to_regclass(partition) IS NULL THEN
+        EXECUTE format('CREATE TABLE %I PARTITION OF notification_logs FOR VALUES FROM (%L) TO (%L)',
+                       partition, month_start, (month_start + INTERVAL '1 month')::DATE);
+    END IF;
+    RETURN partition;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+-- Drops the monthly partitions that end on or before p_cutoff; returns the dropped names
+CREATE OR REPLACE FUNCTION drop_notification_log_partitions(p_cutoff TIMESTAMP)
+RETURNS SETOF TEXT AS $$
+DECLARE
+    partition TEXT;
+BEGIN
+    FOR partition IN
+        SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = 'notification_logs'::regclass AND c.relname ~ '^notification_logs_p[0-9]{6}$'
+        ORDER BY c.relname
+    LOOP
+        IF to_date(substring(partition FROM '[0-9]{6}$'), 'YYYYMM') + INTERVAL '1 month' <= p_cutoff THEN
+            EXECUTE format('DROP TABLE %I', partition);
+            RETURN NEXT partition;
+        END IF;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public;
+
+REVOKE EXECUTE ON FUNCTION create_notification_log_partition(DATE) FROM PUBLIC;
+REVOKE EXECUTE ON FUNCTION drop_notification_log_partitions(TIMESTAMP) FROM PUBLIC;
+
+-- The current and next two months; the log retention job keeps creating them ahead
+SELECT create_notification_log_partition((CURRENT_DATE + make_interval(months => m))::DATE)
+FROM generate_series(0, 2) AS m;
 
 -- ============================================================================
 -- TRIGGERS FOR AUTOMATIC TIMESTAMPS
@@ -705,6 +1427,12 @@ CREATE TRIGGER update_honey_tokens_updated_at BEFORE UPDATE ON honey_tokens
 CREATE TRIGGER update_deception_campaigns_updated_at BEFORE UPDATE ON deception_campaigns
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+CREATE TRIGGER update_cases_updated_at BEFORE UPDATE ON cases
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_correlation_rules_updated_at BEFORE UPDATE ON correlation_rules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
 -- ============================================================================
 -- SEED DATA FOR MITRE ATT&CK FRAMEWORK
 -- ============================================================================
@@ -734,6 +1462,20 @@ INSERT INTO mitre_techniques (technique_id, tactic_id, name, description, platfo
     ('T1204', 'TA0002', 'User Execution', 'Adversaries may rely upon specific actions by a user to gain execution', ARRAY['Windows', 'Linux', 'macOS'], 'https://attack.mitre.org/techniques/T1204')
 ON CONFLICT (technique_id) DO NOTHING;
 
+UPDATE mitre_techniques SET tactic_ids = ARRAY[tactic_id] WHERE tactic_ids = '{}' AND tactic_id IS NOT NULL;
+
+-- Techniques an adversary shows by touching deception assets
+INSERT INTO deception_mitre_mappings (event_type, interaction_type, technique_id, tactic_id) VALUES
+    ('honeypot_access', '', 'T1021', 'TA0008'),                  -- Remote Services
+    ('honeypot_access', 'exploit_attempt', 'T1210', 'TA0008'),   -- Exploitation of Remote Services
+    ('honeytoken_access', '', 'T1552', 'TA0006'),                -- Unsecured Credentials
+    ('credential_attempt', '', 'T1110', 'TA0006'),               -- Brute Force
+    ('credential_attempt', 'credential_use', 'T1078', 'TA0001'), -- Valid Accounts
+    ('file_access', '', 'T1083', 'TA0007'),                      -- File and Directory Discovery
+    ('file_access', '', 'T1039', 'TA0009'),                      -- Data from Network Shared Drive
+    ('network_scan', '', 'T1046', 'TA0007')                      -- Network Service Discovery
+ON CONFLICT DO NOTHING;
+
 -- ============================================================================
 -- VIEWS FOR COMMON QUERIES
 -- ============================================================================
@@ -781,6 +1523,17 @@ GROUP BY l.id, l.customer_name;
 -- GRANT PERMISSIONS (adjust as needed)
 -- ============================================================================
 
+-- ============================================================================
+-- DEFAULT SCHEDULED JOBS
+-- ============================================================================
+
+-- next_run_at is left NULL; the scheduler computes it on startup
+INSERT INTO scheduled_jobs (name, job_type, cron_expression, timezone) VALUES
+    ('Nightly archive', 'archive', '0 2 * * *', 'UTC'),
+    ('Daily usage snapshot', 'usage_snapshot', '5 0 * * *', 'UTC'),
+    ('Ticket sync', 'ticket_sync', '*/5 * * * *', 'UTC'),
+    ('Custom field column cleanup', 'custom_field_cleanup', '30 3 * * *', 'UTC');
+
 -- Create application user
 CREATE USER prive_app WITH PASSWORD 'change_this_password';
 
@@ -789,6 +1542,8 @@ GRANT CONNECT ON DATABASE prive TO prive_app;
 GRANT USAGE ON SCHEMA public TO prive_app;
 GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO prive_app;
 GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO prive_app;
+GRANT EXECUTE ON FUNCTION create_notification_log_partition(DATE) TO prive_app;
+GRANT EXECUTE ON FUNCTION drop_notification_log_partitions(TIMESTAMP) TO prive_app;
 
 -- Grant permissions on future tables
 ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO prive_app;
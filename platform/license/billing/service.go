@@ -0,0 +1,302 @@
+// Billing Service - provisions and maintains licenses from Stripe subscriptions
+
+package billing
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+	"github.com/sentinel-enterprise/platform/license/service"
+)
+
+// Subscription cancellation behaviours
+const (
+	CancelActionRevoke    = "revoke"    // Deactivate the license
+	CancelActionDowngrade = "downgrade" // Keep the license on the free tier
+)
+
+// Config configures self-serve billing
+type Config struct {
+	PriceIDs     map[models.LicenseTier]string // Stripe price per purchasable tier
+	SuccessURL   string
+	CancelURL    string
+	PeriodDays   int    // License validity added per paid billing period
+	CancelAction string // revoke or downgrade
+}
+
+// Service turns Stripe checkout and subscription events into license changes
+type Service struct {
+	stripe   *StripeClient
+	licenses *service.LicenseService
+	config   Config
+}
+
+// NewService creates a new billing service
+func NewService(stripe *StripeClient, licenses *service.LicenseService, config Config) *Service {
+	if config.PeriodDays <= 0 {
+		config.PeriodDays = 31
+	}
+	if config.CancelAction != CancelActionDowngrade {
+		config.CancelAction = CancelActionRevoke
+	}
+	return &Service{stripe: stripe, licenses: licenses, config: config}
+}
+
+// CreateCheckout creates a Stripe checkout session for a tier
+func (s *Service) CreateCheckout(req models.CheckoutRequest) (*models.CheckoutResponse, error) {
+	priceID, ok := s.config.PriceIDs[req.Tier]
+	if !ok || priceID == "" {
+		return nil, fmt.Errorf("tier %s is not available for purchase", req.Tier)
+	}
+
+	if req.LicenseID != "" {
+		if _, err := s.licenses.GetLicense(req.LicenseID); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := s.stripe.CreateCheckoutSession(CheckoutParams{
+		PriceID:       priceID,
+		CustomerEmail: req.CustomerEmail,
+		SuccessURL:    s.config.SuccessURL,
+		CancelURL:     s.config.CancelURL,
+		Metadata: map[string]string{
+			"tier":          string(req.Tier),
+			"customer_name": req.CustomerName,
+			"company_name":  req.CompanyName,
+			"license_id":    req.LicenseID,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %w", err)
+	}
+
+	log.Infof("Created checkout session %s for %s (%s tier)", session.ID, req.CustomerEmail, req.Tier)
+	return &models.CheckoutResponse{SessionID: session.ID, URL: session.URL}, nil
+}
+
+// HandleWebhook verifies and applies a Stripe webhook. Each event is applied at most once: it is
+// recorded in the transaction that applies it. Events about subscriptions no license is linked
+// to are acknowledged and ignored, since retrying them cannot succeed.
+func (s *Service) HandleWebhook(payload []byte, signature string) error {
+	event, err := s.stripe.ParseWebhook(payload, signature)
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %w", err)
+	}
+
+	var replaced string
+	applied, err := s.licenses.ApplyBillingEvent(event.ID, event.Type, func(btx *service.BillingTx) (string, error) {
+		switch event.Type {
+		case "checkout.session.completed":
+			licenseID, previous, err := s.handleCheckoutCompleted(btx, event)
+			replaced = previous
+			return licenseID, err
+		case "invoice.paid":
+			return s.handleInvoicePaid(btx, event)
+		case "customer.subscription.updated":
+			return s.handleSubscriptionUpdated(btx, event)
+		case "customer.subscription.deleted":
+			return s.handleSubscriptionDeleted(btx, event)
+		}
+		log.Debugf("Ignoring Stripe event %s (%s)", event.ID, event.Type)
+		return "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s: %w", event.Type, err)
+	}
+	if !applied {
+		log.Debugf("Skipping already processed Stripe event %s", event.ID)
+		return nil
+	}
+
+	// The license now follows the new subscription; stop billing for the one it replaced. Its
+	// customer.subscription.deleted event is then ignored, as no license is linked to it.
+	if replaced != "" {
+		if err := s.stripe.CancelSubscription(replaced); err != nil {
+			log.Errorf("Failed to cancel replaced subscription %s, cancel it in Stripe: %v", replaced, err)
+		} else {
+			log.Infof("Cancelled replaced subscription %s", replaced)
+		}
+	}
+	return nil
+}
+
+// handleCheckoutCompleted provisions a new license, or reactivates, changes the tier of and renews
+// the one named in the session. It also returns the subscription the license was paid for by
+// before, if the checkout replaced it.
+func (s *Service) handleCheckoutCompleted(btx *service.BillingTx, event *Event) (string, string, error) {
+	var session CheckoutSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return "", "", fmt.Errorf("failed to decode checkout session: %w", err)
+	}
+
+	tier := models.LicenseTier(session.Metadata["tier"])
+	if _, ok := s.config.PriceIDs[tier]; !ok {
+		return "", "", fmt.Errorf("checkout session %s has unknown tier %q", session.ID, tier)
+	}
+
+	licenseID := session.Metadata["license_id"]
+	if licenseID != "" {
+		license, err := btx.GetLicense(licenseID)
+		if err != nil {
+			return "", "", err
+		}
+		// A revoked or lapsed license that is paid for again comes back
+		if err := btx.Reactivate(license, "Paid checkout "+session.ID); err != nil {
+			return "", "", err
+		}
+		if err := btx.ChangeTier(license, tier); err != nil {
+			return "", "", err
+		}
+		if err := btx.Extend(licenseID, s.config.PeriodDays); err != nil {
+			return "", "", err
+		}
+	} else {
+		email := session.CustomerDetails.Email
+		if email == "" {
+			email = session.CustomerEmail
+		}
+		name := session.Metadata["customer_name"]
+		if name == "" {
+			name = session.CustomerDetails.Name
+		}
+
+		license, err := btx.CreateLicense(models.CreateLicenseRequest{
+			CustomerEmail: email,
+			CustomerName:  name,
+			CompanyName:   session.Metadata["company_name"],
+			Tier:          tier,
+			DurationDays:  s.config.PeriodDays,
+		})
+		if err != nil {
+			return "", "", err
+		}
+		licenseID = license.ID
+	}
+
+	replaced, err := btx.AttachBilling(licenseID, session.Customer, session.Subscription)
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Infof("Provisioned license %s from checkout %s (%s tier)", licenseID, session.ID, tier)
+	return licenseID, replaced, nil
+}
+
+// handleInvoicePaid extends the license for each renewal payment
+func (s *Service) handleInvoicePaid(btx *service.BillingTx, event *Event) (string, error) {
+	var invoice Invoice
+	if err := json.Unmarshal(event.Data.Object, &invoice); err != nil {
+		return "", fmt.Errorf("failed to decode invoice: %w", err)
+	}
+
+	// The first invoice is covered by checkout.session.completed
+	if invoice.BillingReason != "subscription_cycle" || invoice.Subscription == "" {
+		return "", nil
+	}
+
+	license, err := s.linkedLicense(btx, invoice.Subscription, event)
+	if license == nil || err != nil {
+		return "", err
+	}
+	if !license.IsActive {
+		// Revoked by an administrator while the subscription kept billing; a checkout reactivates it
+		log.Warnf("Not renewing inactive license %s from invoice %s", license.ID, invoice.ID)
+		return license.ID, nil
+	}
+
+	if err := btx.Extend(license.ID, s.config.PeriodDays); err != nil {
+		return "", err
+	}
+
+	log.Infof("Renewed license %s from invoice %s", license.ID, invoice.ID)
+	return license.ID, nil
+}
+
+// handleSubscriptionUpdated follows plan changes made in the Stripe customer portal
+func (s *Service) handleSubscriptionUpdated(btx *service.BillingTx, event *Event) (string, error) {
+	var sub Subscription
+	if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+		return "", fmt.Errorf("failed to decode subscription: %w", err)
+	}
+
+	if sub.Status != "active" || len(sub.Items.Data) == 0 {
+		return "", nil
+	}
+
+	tier, ok := s.tierForPrice(sub.Items.Data[0].Price.ID)
+	if !ok {
+		return "", nil
+	}
+
+	license, err := s.linkedLicense(btx, sub.ID, event)
+	if license == nil || err != nil {
+		return "", err
+	}
+
+	if license.Tier == tier || !license.IsActive {
+		return license.ID, nil
+	}
+
+	if err := btx.ChangeTier(license, tier); err != nil {
+		return "", err
+	}
+
+	log.Infof("Changed license %s to %s tier from subscription %s", license.ID, tier, sub.ID)
+	return license.ID, nil
+}
+
+// handleSubscriptionDeleted revokes or downgrades the license when the subscription ends
+func (s *Service) handleSubscriptionDeleted(btx *service.BillingTx, event *Event) (string, error) {
+	var sub Subscription
+	if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+		return "", fmt.Errorf("failed to decode subscription: %w", err)
+	}
+
+	license, err := s.linkedLicense(btx, sub.ID, event)
+	if license == nil || err != nil {
+		return "", err
+	}
+
+	if s.config.CancelAction == CancelActionDowngrade {
+		if !license.IsActive {
+			return license.ID, nil
+		}
+		if err := btx.ChangeTier(license, models.TierFree); err != nil {
+			return "", err
+		}
+		log.Infof("Downgraded license %s to free tier after subscription %s ended", license.ID, sub.ID)
+		return license.ID, nil
+	}
+
+	if err := btx.Revoke(license.ID, "Subscription cancelled"); err != nil {
+		return "", err
+	}
+	return license.ID, nil
+}
+
+// linkedLicense returns the license paid for by a subscription, or nil when none is, e.g. for a
+// subscription a checkout replaced or one created outside the platform
+func (s *Service) linkedLicense(btx *service.BillingTx, subscriptionID string, event *Event) (*models.License, error) {
+	license, err := btx.FindLicenseBySubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if license == nil {
+		log.Infof("Ignoring Stripe event %s (%s): no license is linked to subscription %s", event.ID, event.Type, subscriptionID)
+	}
+	return license, nil
+}
+
+// tierForPrice maps a Stripe price back to a license tier
+func (s *Service) tierForPrice(priceID string) (models.LicenseTier, bool) {
+	for tier, id := range s.config.PriceIDs {
+		if id == priceID {
+			return tier, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,218 @@
+// Stripe API client (checkout sessions and webhook verification) over plain HTTPS
+
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeAPIBase = "https://api.stripe.com/v1"
+
+	// webhookTolerance is the maximum age of a signed Stripe webhook
+	webhookTolerance = 5 * time.Minute
+)
+
+// StripeClient talks to the Stripe REST API
+type StripeClient struct {
+	secretKey     string
+	webhookSecret string
+	httpClient    *http.Client
+}
+
+// NewStripeClient creates a Stripe client
+func NewStripeClient(secretKey, webhookSecret string) *StripeClient {
+	return &StripeClient{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// CheckoutSession is the subset of a Stripe checkout session used here
+type CheckoutSession struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	CustomerEmail     string            `json:"customer_email"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+	CustomerDetails   struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	} `json:"customer_details"`
+}
+
+// Subscription is the subset of a Stripe subscription used here
+type Subscription struct {
+	ID       string            `json:"id"`
+	Customer string            `json:"customer"`
+	Status   string            `json:"status"`
+	Metadata map[string]string `json:"metadata"`
+	Items    struct {
+		Data []struct {
+			Price struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// Invoice is the subset of a Stripe invoice used here
+type Invoice struct {
+	ID            string `json:"id"`
+	Customer      string `json:"customer"`
+	Subscription  string `json:"subscription"`
+	BillingReason string `json:"billing_reason"`
+	Paid          bool   `json:"paid"`
+}
+
+// Event is a Stripe webhook event
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// CheckoutParams describes a subscription checkout
+type CheckoutParams struct {
+	PriceID       string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	Metadata      map[string]string // Copied to the session and the subscription
+}
+
+// CreateCheckoutSession creates a subscription-mode checkout session
+func (c *StripeClient) CreateCheckoutSession(params CheckoutParams) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", params.PriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	if params.CustomerEmail != "" {
+		form.Set("customer_email", params.CustomerEmail)
+	}
+	for k, v := range params.Metadata {
+		form.Set(fmt.Sprintf("metadata[%s]", k), v)
+		form.Set(fmt.Sprintf("subscription_data[metadata][%s]", k), v)
+	}
+
+	var session CheckoutSession
+	if err := c.post("/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CancelSubscription cancels a subscription immediately
+func (c *StripeClient) CancelSubscription(subscriptionID string) error {
+	var sub Subscription
+	return c.do(http.MethodDelete, "/subscriptions/"+url.PathEscape(subscriptionID), url.Values{}, &sub)
+}
+
+// post sends a form-encoded request to the Stripe API and decodes the response
+func (c *StripeClient) post(path string, form url.Values, out interface{}) error {
+	return c.do(http.MethodPost, path, form, out)
+}
+
+// do sends a form-encoded request to the Stripe API and decodes the response
+func (c *StripeClient) do(method, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequest(method, stripeAPIBase+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(c.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("stripe returned status %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode stripe response: %w", err)
+	}
+	return nil
+}
+
+// ParseWebhook verifies the Stripe-Signature header and decodes the event
+func (c *StripeClient) ParseWebhook(payload []byte, signatureHeader string) (*Event, error) {
+	if c.webhookSecret == "" {
+		return nil, fmt.Errorf("webhook secret not configured")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signatureHeader, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return nil, fmt.Errorf("invalid signature header")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.webhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, sig := range signatures {
+		decoded, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	return &event, nil
+}
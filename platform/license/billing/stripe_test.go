@@ -0,0 +1,63 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signStripePayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id":"evt_1","type":"invoice.paid","data":{"object":{"id":"in_1"}}}`)
+	now := time.Now().Unix()
+	valid := signStripePayload(secret, now, payload)
+
+	tests := []struct {
+		name          string
+		webhookSecret string
+		header        string
+		payload       []byte
+		wantErr       bool
+	}{
+		{"valid", secret, fmt.Sprintf("t=%d,v1=%s", now, valid), payload, false},
+		{"valid among rotated signatures", secret, fmt.Sprintf("t=%d,v1=%s,v1=%s", now, signStripePayload("whsec_old", now, payload), valid), payload, false},
+		{"whitespace around parts", secret, fmt.Sprintf("t=%d, v1=%s", now, valid), payload, false},
+		{"unknown scheme ignored", secret, fmt.Sprintf("t=%d,v0=deadbeef,v1=%s", now, valid), payload, false},
+		{"secret not configured", "", fmt.Sprintf("t=%d,v1=%s", now, valid), payload, true},
+		{"empty header", secret, "", payload, true},
+		{"missing timestamp", secret, "v1=" + valid, payload, true},
+		{"missing signature", secret, fmt.Sprintf("t=%d", now), payload, true},
+		{"non-numeric timestamp", secret, "t=now,v1=" + valid, payload, true},
+		{"wrong secret", secret, fmt.Sprintf("t=%d,v1=%s", now, signStripePayload("whsec_other", now, payload)), payload, true},
+		{"tampered payload", secret, fmt.Sprintf("t=%d,v1=%s", now, valid), []byte(`{"id":"evt_2","type":"invoice.paid"}`), true},
+		{"signature not hex", secret, fmt.Sprintf("t=%d,v1=zz", now), payload, true},
+		{"timestamp too old", secret, fmt.Sprintf("t=%d,v1=%s", now-600, signStripePayload(secret, now-600, payload)), payload, true},
+		{"timestamp too far ahead", secret, fmt.Sprintf("t=%d,v1=%s", now+600, signStripePayload(secret, now+600, payload)), payload, true},
+		{"timestamp replaced", secret, fmt.Sprintf("t=%d,v1=%s", now-1, valid), payload, true},
+		{"signed invalid json", secret, fmt.Sprintf("t=%d,v1=%s", now, signStripePayload(secret, now, []byte("{"))), []byte("{"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewStripeClient("sk_test", tt.webhookSecret)
+			event, err := client.ParseWebhook(tt.payload, tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (event.ID != "evt_1" || event.Type != "invoice.paid") {
+				t.Errorf("ParseWebhook() = %s %s, want evt_1 invoice.paid", event.ID, event.Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Signed Certificate Revocation List (CRL) for offline license validation
+
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CRLFormat identifies the revocation list encoding
+const CRLFormat = "PRIVE-CRL-V1"
+
+// RevokedLicense is a single revocation entry
+type RevokedLicense struct {
+	ID        string `json:"id"`
+	RevokedAt int64  `json:"revoked_at"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// RevocationList is the list of revoked license IDs agents cache for offline checks
+type RevocationList struct {
+	Number     int64            `json:"number"` // Monotonic; agents must reject a list older than the one they hold
+	IssuedAt   int64            `json:"iat"`
+	NextUpdate int64            `json:"next_update"` // Agents should refresh before this time
+	Revoked    []RevokedLicense `json:"revoked"`
+}
+
+// SignedRevocationList carries the exact signed CRL bytes and their signature
+type SignedRevocationList struct {
+	Format    string `json:"format"`
+	Payload   string `json:"payload"`   // base64url(JSON RevocationList)
+	Signature string `json:"signature"` // base64url(Ed25519 signature over the payload bytes)
+}
+
+// SignRevocationList serialises and signs a revocation list
+func SignRevocationList(list RevocationList, privateKey ed25519.PrivateKey) (*SignedRevocationList, error) {
+	if list.Revoked == nil {
+		list.Revoked = []RevokedLicense{}
+	}
+
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revocation list: %w", err)
+	}
+
+	signature := ed25519.Sign(privateKey, listJSON)
+
+	return &SignedRevocationList{
+		Format:    CRLFormat,
+		Payload:   base64.RawURLEncoding.EncodeToString(listJSON),
+		Signature: base64.RawURLEncoding.EncodeToString(signature),
+	}, nil
+}
+
+// VerifyRevocationList checks the CRL signature and returns the decoded list
+func VerifyRevocationList(signed *SignedRevocationList, publicKey ed25519.PublicKey) (*RevocationList, error) {
+	if signed.Format != CRLFormat {
+		return nil, fmt.Errorf("unsupported revocation list format: %s", signed.Format)
+	}
+
+	listJSON, err := base64.RawURLEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revocation list encoding: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if !ed25519.Verify(publicKey, listJSON, signature) {
+		return nil, fmt.Errorf("invalid revocation list signature")
+	}
+
+	var list RevocationList
+	if err := json.Unmarshal(listJSON, &list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revocation list: %w", err)
+	}
+
+	return &list, nil
+}
+
+// IsRevoked reports whether a license ID appears on the list
+func (l *RevocationList) IsRevoked(licenseID string) bool {
+	for _, entry := range l.Revoked {
+		if entry.ID == licenseID {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateLicenseOffline validates a license without contacting the platform.
+// It checks the key signature and expiry, then the cached CRL. A CRL past its
+// NextUpdate by more than maxStaleness is rejected so revocations cannot be
+// dodged indefinitely by never refreshing; maxStaleness of 0 disables that check.
+func ValidateLicenseOffline(licenseKey string, publicKey ed25519.PublicKey, crl *RevocationList, maxStaleness time.Duration) (*LicensePayload, error) {
+	payload, err := ValidateLicenseKey(licenseKey, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if crl == nil {
+		return nil, fmt.Errorf("revocation list not available")
+	}
+
+	if maxStaleness > 0 && time.Now().After(time.Unix(crl.NextUpdate, 0).Add(maxStaleness)) {
+		return nil, fmt.Errorf("revocation list is stale (next update was %s)", time.Unix(crl.NextUpdate, 0).Format(time.RFC3339))
+	}
+
+	if crl.IsRevoked(payload.ID) {
+		return nil, fmt.Errorf("license has been revoked")
+	}
+
+	return payload, nil
+}
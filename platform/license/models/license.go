@@ -2,7 +2,10 @@
 
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // LicenseTier defines the subscription level
 type LicenseTier string
@@ -15,21 +18,27 @@ const (
 
 // License represents a software license for Privé
 type License struct {
-	ID              string      `json:"id" db:"id"`
-	LicenseKey      string      `json:"license_key" db:"license_key"`
-	CustomerEmail   string      `json:"customer_email" db:"customer_email"`
-	CustomerName    string      `json:"customer_name" db:"customer_name"`
-	CompanyName     string      `json:"company_name" db:"company_name"`
-	Tier            LicenseTier `json:"tier" db:"tier"`
-	MaxAgents       int         `json:"max_agents" db:"max_agents"`
-	MaxUsers        int         `json:"max_users" db:"max_users"`
-	Features        []string    `json:"features" db:"-"`
-	IssuedAt        time.Time   `json:"issued_at" db:"issued_at"`
-	ExpiresAt       *time.Time  `json:"expires_at" db:"expires_at"`
-	IsActive        bool        `json:"is_active" db:"is_active"`
-	ActivatedAt     *time.Time  `json:"activated_at" db:"activated_at"`
-	LastValidatedAt *time.Time  `json:"last_validated_at" db:"last_validated_at"`
-	Metadata        string      `json:"metadata" db:"metadata"` // JSON-encoded map
+	ID                   string          `json:"id" db:"id"`
+	LicenseKey           string          `json:"license_key" db:"license_key"`
+	CustomerEmail        string          `json:"customer_email" db:"customer_email"`
+	CustomerName         string          `json:"customer_name" db:"customer_name"`
+	CompanyName          string          `json:"company_name" db:"company_name"`
+	Tier                 LicenseTier     `json:"tier" db:"tier"`
+	MaxAgents            int             `json:"max_agents" db:"max_agents"`
+	MaxUsers             int             `json:"max_users" db:"max_users"`
+	Features             []string        `json:"features" db:"-"`
+	IssuedAt             time.Time       `json:"issued_at" db:"issued_at"`
+	ExpiresAt            *time.Time      `json:"expires_at" db:"expires_at"`
+	IsActive             bool            `json:"is_active" db:"is_active"`
+	ActivatedAt          *time.Time      `json:"activated_at" db:"activated_at"`
+	LastValidatedAt      *time.Time      `json:"last_validated_at" db:"last_validated_at"`
+	Metadata             string          `json:"metadata" db:"metadata"`                             // JSON-encoded map
+	FeatureOverrides     map[string]bool `json:"feature_overrides,omitempty" db:"feature_overrides"` // Per-license grants/restrictions on top of the tier
+	StripeCustomerID     string          `json:"stripe_customer_id,omitempty" db:"stripe_customer_id"`
+	StripeSubscriptionID string          `json:"stripe_subscription_id,omitempty" db:"stripe_subscription_id"`
+	ParentLicenseID      string          `json:"parent_license_id,omitempty" db:"parent_license_id"` // Managing license (MSSP or parent organization), if any
+	CreatedAt            time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt            *time.Time      `json:"updated_at,omitempty" db:"updated_at"`
 }
 
 // LicenseFeatures defines feature sets per tier
@@ -48,6 +57,7 @@ type LicenseFeatures struct {
 	PrioritySupport      bool `json:"priority_support"`
 	CustomIntegrations   bool `json:"custom_integrations"`
 	MachineLearning      bool `json:"machine_learning"`
+	DataLake             bool `json:"data_lake"`
 }
 
 // GetFeaturesForTier returns the feature set for a license tier
@@ -93,12 +103,51 @@ func GetFeaturesForTier(tier LicenseTier) LicenseFeatures {
 			PrioritySupport:      true,
 			CustomIntegrations:   true,
 			MachineLearning:      true,
+			DataLake:             true,
 		}
 	default:
 		return LicenseFeatures{}
 	}
 }
 
+// IsKnownFeature reports whether name is a feature flag of LicenseFeatures
+func IsKnownFeature(name string) bool {
+	_, ok := featureMap(LicenseFeatures{})[name]
+	return ok
+}
+
+// ApplyFeatureOverrides grants or restricts individual features on top of the tier defaults
+func ApplyFeatureOverrides(features LicenseFeatures, overrides map[string]bool) LicenseFeatures {
+	if len(overrides) == 0 {
+		return features
+	}
+
+	flags := featureMap(features)
+	for name, enabled := range overrides {
+		if _, ok := flags[name]; ok {
+			flags[name] = enabled
+		}
+	}
+
+	data, _ := json.Marshal(flags)
+	var effective LicenseFeatures
+	json.Unmarshal(data, &effective)
+	return effective
+}
+
+// Enabled reports whether the named feature is on
+func (f LicenseFeatures) Enabled(name string) bool {
+	return featureMap(f)[name]
+}
+
+// featureMap converts the feature set to a map keyed by JSON feature name
+func featureMap(features LicenseFeatures) map[string]bool {
+	data, _ := json.Marshal(features)
+	flags := map[string]bool{}
+	json.Unmarshal(data, &flags)
+	return flags
+}
+
 // GetLimitsForTier returns resource limits per tier
 func GetLimitsForTier(tier LicenseTier) (maxAgents int, maxUsers int) {
 	switch tier {
@@ -122,11 +171,54 @@ type CreateLicenseRequest struct {
 	DurationDays  int         `json:"duration_days"` // 0 for perpetual
 }
 
+// BulkCreateLicensesRequest creates many licenses in one call
+type BulkCreateLicensesRequest struct {
+	Mode     BulkMode               `json:"mode"` // atomic (default) or best_effort
+	Licenses []CreateLicenseRequest `json:"licenses" binding:"required,min=1,max=1000,dive"`
+}
+
+// BulkMode controls how failures in a bulk request are handled
+type BulkMode string
+
+const (
+	BulkModeAtomic     BulkMode = "atomic"      // All rows succeed or none are created
+	BulkModeBestEffort BulkMode = "best_effort" // Valid rows are created, failures reported per row
+)
+
+// BulkLicenseResult is the outcome of one row in a bulk create
+type BulkLicenseResult struct {
+	Row           int      `json:"row"` // 1-based position in the request
+	CustomerEmail string   `json:"customer_email"`
+	Success       bool     `json:"success"`
+	License       *License `json:"license,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// BulkCreateLicensesResponse summarises a bulk create
+type BulkCreateLicensesResponse struct {
+	Mode    BulkMode            `json:"mode"`
+	Total   int                 `json:"total"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Results []BulkLicenseResult `json:"results"`
+}
+
+// LicenseListFilter narrows a license listing; zero values match every license
+type LicenseListFilter struct {
+	LicenseID          string // Only this license; set for callers confined to a license
+	Tier               LicenseTier
+	IsActive           *bool
+	ExpiringWithinDays int    // Licenses expiring between now and this many days from now
+	Search             string // Case-insensitive substring of customer name, email or company
+}
+
 // ValidateLicenseRequest validates a license key
 type ValidateLicenseRequest struct {
-	LicenseKey string `json:"license_key" binding:"required"`
-	AgentID    string `json:"agent_id"`
-	Hostname   string `json:"hostname"`
+	LicenseKey  string `json:"license_key" binding:"required"`
+	AgentID     string `json:"agent_id"`
+	Hostname    string `json:"hostname"`
+	OSType      string `json:"os_type"`
+	Fingerprint string `json:"fingerprint" binding:"max=256"` // Hardware fingerprint; binds the seat to this machine
 }
 
 // ValidateLicenseResponse returns validation result
@@ -148,3 +240,111 @@ type LicenseUsage struct {
 	StorageUsedGB  float64   `json:"storage_used_gb" db:"storage_used_gb"`
 	LastUpdated    time.Time `json:"last_updated" db:"last_updated"`
 }
+
+// LicenseUsageSnapshot is a point-in-time record of license usage against its caps
+type LicenseUsageSnapshot struct {
+	ActiveAgents   int       `json:"active_agents"`
+	ActiveUsers    int       `json:"active_users"`
+	MaxAgents      int       `json:"max_agents"`
+	MaxUsers       int       `json:"max_users"`
+	EventsIngested int64     `json:"events_ingested"`
+	StorageUsedGB  float64   `json:"storage_used_gb"`
+	AgentsOverCap  bool      `json:"agents_over_cap"`
+	UsersOverCap   bool      `json:"users_over_cap"`
+	CapturedAt     time.Time `json:"captured_at"`
+}
+
+// LicenseUsageHistory is a usage time series with peak utilisation and overage status
+type LicenseUsageHistory struct {
+	LicenseID        string                 `json:"license_id"`
+	Start            time.Time              `json:"start"`
+	End              time.Time              `json:"end"`
+	Snapshots        []LicenseUsageSnapshot `json:"snapshots"`
+	PeakAgents       int                    `json:"peak_agents"`
+	PeakUsers        int                    `json:"peak_users"`
+	AgentUtilization float64                `json:"agent_utilization"` // Peak agents / max agents, 0 when unlimited
+	UserUtilization  float64                `json:"user_utilization"`  // Peak users / max users, 0 when unlimited
+	OverageDetected  bool                   `json:"overage_detected"`
+	OverageSince     *time.Time             `json:"overage_since,omitempty"`
+}
+
+// MachineBinding is a license seat bound to a hardware fingerprint
+type MachineBinding struct {
+	ID          string    `json:"id"`
+	LicenseID   string    `json:"license_id"`
+	AgentID     string    `json:"agent_id,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	OSType      string    `json:"os_type,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	ActivatedAt time.Time `json:"activated_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// LicenseFeatureSet shows how a license's effective features are derived
+type LicenseFeatureSet struct {
+	LicenseID string          `json:"license_id"`
+	Tier      LicenseTier     `json:"tier"`
+	Defaults  LicenseFeatures `json:"defaults"`
+	Overrides map[string]bool `json:"overrides"`
+	Effective LicenseFeatures `json:"effective"`
+}
+
+// SetFeatureOverrideRequest grants (true) or revokes (false) a single feature
+type SetFeatureOverrideRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// CheckoutRequest starts a self-serve purchase, or a plan change for an existing license
+type CheckoutRequest struct {
+	Tier          LicenseTier `json:"tier" binding:"required"`
+	CustomerEmail string      `json:"customer_email" binding:"required,email"`
+	CustomerName  string      `json:"customer_name" binding:"required"`
+	CompanyName   string      `json:"company_name"`
+	LicenseID     string      `json:"license_id"` // Existing license to upgrade/renew instead of creating one
+}
+
+// CheckoutResponse points the customer at the hosted payment page
+type CheckoutResponse struct {
+	SessionID string `json:"session_id"`
+	URL       string `json:"url"`
+}
+
+
+// LinkChildLicenseRequest places a license under a parent license
+type LinkChildLicenseRequest struct {
+	ChildLicenseID string `json:"child_license_id" binding:"required,uuid"`
+}
+
+// ChildLicense is a license managed by a parent license, with its current usage
+type ChildLicense struct {
+	ID           string       `json:"id"`
+	CustomerName string       `json:"customer_name"`
+	CompanyName  string       `json:"company_name"`
+	Tier         LicenseTier  `json:"tier"`
+	MaxAgents    int          `json:"max_agents"`
+	MaxUsers     int          `json:"max_users"`
+	IsActive     bool         `json:"is_active"`
+	ExpiresAt    *time.Time   `json:"expires_at"`
+	Usage        LicenseUsage `json:"usage"`
+}
+
+// LicenseUsageRollup totals usage and caps over a parent license and its children
+type LicenseUsageRollup struct {
+	Licenses       int     `json:"licenses"`
+	ActiveAgents   int     `json:"active_agents"`
+	ActiveUsers    int     `json:"active_users"`
+	EventsIngested int64   `json:"events_ingested"`
+	StorageUsedGB  float64 `json:"storage_used_gb"`
+	MaxAgents      int     `json:"max_agents"`
+	MaxUsers       int     `json:"max_users"`
+}
+
+// LicenseHierarchy lists a parent license's children with usage rolled up across the family.
+// Inactive children are listed but left out of the rollup.
+type LicenseHierarchy struct {
+	ParentLicenseID string             `json:"parent_license_id"`
+	Parent          LicenseUsage       `json:"parent_usage"`
+	Children        []ChildLicense     `json:"children"`
+	Rollup          LicenseUsageRollup `json:"rollup"`
+}
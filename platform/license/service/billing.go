@@ -0,0 +1,258 @@
+// Billing references stored on licenses, and billing provider events applied to them
+
+package service
+
+import (
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// tierRank orders tiers so tier changes can be told apart as upgrades or downgrades
+var tierRank = map[models.LicenseTier]int{
+	models.TierFree:       0,
+	models.TierPro:        1,
+	models.TierEnterprise: 2,
+}
+
+// BillingTx applies the license changes of one billing provider event inside the transaction
+// that records the event. Lifecycle webhooks and the revocation list follow once it commits.
+type BillingTx struct {
+	tx         *sql.Tx
+	service    *LicenseService
+	events     []billingLicenseEvent
+	crlChanged bool
+}
+
+// billingLicenseEvent is a lifecycle event held back until the billing transaction commits
+type billingLicenseEvent struct {
+	eventType string
+	licenseID string
+	details   map[string]interface{}
+}
+
+// ApplyBillingEvent records a billing provider event and runs apply in the same transaction.
+// The event ID is inserted first: a concurrent delivery of the same event blocks on it until
+// this one finishes and then finds it recorded. If apply fails nothing is recorded, so the
+// provider's retry applies the event again. It reports false, without calling apply, for
+// events that were already applied. apply returns the license the event concerned, if any.
+func (s *LicenseService) ApplyBillingEvent(eventID, eventType string, apply func(btx *BillingTx) (string, error)) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO billing_events (id, event_type)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING
+	`, eventID, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to record billing event: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rowsAffected == 0 {
+		return false, nil
+	}
+
+	btx := &BillingTx{tx: tx, service: s}
+	licenseID, err := apply(btx)
+	if err != nil {
+		return false, err
+	}
+	if licenseID != "" {
+		if _, err := tx.Exec(`UPDATE billing_events SET license_id = $2 WHERE id = $1`, eventID, licenseID); err != nil {
+			return false, fmt.Errorf("failed to record billing event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit billing event: %w", err)
+	}
+
+	if btx.crlChanged {
+		s.invalidateRevocationList()
+	}
+	for _, event := range btx.events {
+		s.emitLicenseEvent(event.eventType, event.licenseID, event.details)
+	}
+	return true, nil
+}
+
+// emit queues a lifecycle event for after the commit
+func (b *BillingTx) emit(eventType, licenseID string, details map[string]interface{}) {
+	b.events = append(b.events, billingLicenseEvent{eventType: eventType, licenseID: licenseID, details: details})
+}
+
+// GetLicense reads a license, locking it for the rest of the transaction
+func (b *BillingTx) GetLicense(licenseID string) (*models.License, error) {
+	var locked string
+	err := b.tx.QueryRow(`SELECT id FROM licenses WHERE id = $1 FOR UPDATE`, licenseID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("license not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return getLicense(b.tx, licenseID)
+}
+
+// FindLicenseBySubscription returns the license paid for by a Stripe subscription, locked for the
+// rest of the transaction, or nil if no license is linked to it
+func (b *BillingTx) FindLicenseBySubscription(subscriptionID string) (*models.License, error) {
+	var licenseID string
+	err := b.tx.QueryRow(`SELECT id FROM licenses WHERE stripe_subscription_id = $1 FOR UPDATE`, subscriptionID).Scan(&licenseID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return getLicense(b.tx, licenseID)
+}
+
+// CreateLicense creates a license paid for through billing
+func (b *BillingTx) CreateLicense(req models.CreateLicenseRequest) (*models.License, error) {
+	license, err := b.service.buildLicense(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertLicense(b.tx, license); err != nil {
+		return nil, err
+	}
+	if err := initLicenseUsage(b.tx, license.ID); err != nil {
+		return nil, fmt.Errorf("failed to initialize license usage: %w", err)
+	}
+
+	b.emit(EventLicenseCreated, license.ID, map[string]interface{}{"source": "billing"})
+	return license, nil
+}
+
+// ChangeTier moves an active license to newTier, as an upgrade or a downgrade depending on the
+// tiers. It does nothing when the license is already on newTier.
+func (b *BillingTx) ChangeTier(license *models.License, newTier models.LicenseTier) error {
+	if license.Tier == newTier {
+		return nil
+	}
+
+	maxAgents, maxUsers, err := setLicenseTier(b.tx, license.ID, newTier)
+	if err != nil {
+		return err
+	}
+
+	eventType := EventLicenseUpgraded
+	if tierRank[newTier] < tierRank[license.Tier] {
+		eventType = EventLicenseDowngraded
+	}
+	details := tierChangeDetails(newTier, maxAgents, maxUsers)
+	if err := auditLicense(b.tx, license.ID, tierChangeAction(eventType), details); err != nil {
+		return err
+	}
+
+	b.emit(eventType, license.ID, details)
+	license.Tier = newTier
+	license.MaxAgents, license.MaxUsers = maxAgents, maxUsers
+	return nil
+}
+
+// Extend moves an active license's expiry additionalDays further out
+func (b *BillingTx) Extend(licenseID string, additionalDays int) error {
+	if err := extendLicense(b.tx, licenseID, additionalDays); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"additional_days": additionalDays}
+	if err := auditLicense(b.tx, licenseID, "extended", details); err != nil {
+		return err
+	}
+
+	b.emit(EventLicenseExtended, licenseID, details)
+	return nil
+}
+
+// Reactivate restores an inactive (revoked or lapsed) license that has been paid for again.
+// A license that expired in the meantime restarts from now, so the following extension covers
+// the paid period.
+func (b *BillingTx) Reactivate(license *models.License, reason string) error {
+	if license.IsActive {
+		return nil
+	}
+
+	_, err := b.tx.Exec(`
+		UPDATE licenses
+		SET is_active = TRUE, expires_at = GREATEST(expires_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`, license.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reactivate license: %w", err)
+	}
+
+	details := map[string]interface{}{"reason": reason}
+	if err := auditLicense(b.tx, license.ID, "reactivated", details); err != nil {
+		return err
+	}
+
+	// Revoked licenses are on the CRL until it is reissued
+	b.crlChanged = true
+	b.emit(EventLicenseReactivated, license.ID, details)
+	license.IsActive = true
+	return nil
+}
+
+// Revoke deactivates a license
+func (b *BillingTx) Revoke(licenseID, reason string) error {
+	if err := deactivateLicense(b.tx, licenseID); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"reason": reason}
+	if err := auditLicense(b.tx, licenseID, "revoked", details); err != nil {
+		return err
+	}
+
+	b.crlChanged = true
+	b.emit(EventLicenseRevoked, licenseID, details)
+	return nil
+}
+
+// AttachBilling stores the Stripe customer and subscription that pay for a license. It returns
+// the subscription it replaces, if the license was paid for by a different one; the caller is
+// responsible for cancelling it so the customer is not billed twice.
+func (b *BillingTx) AttachBilling(licenseID, customerID, subscriptionID string) (string, error) {
+	var previous sql.NullString
+	err := b.tx.QueryRow(`
+		SELECT stripe_subscription_id FROM licenses WHERE id = $1 FOR UPDATE
+	`, licenseID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("license not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	_, err = b.tx.Exec(`
+		UPDATE licenses
+		SET stripe_customer_id = $2, stripe_subscription_id = NULLIF($3, ''), updated_at = NOW()
+		WHERE id = $1
+	`, licenseID, customerID, subscriptionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach billing: %w", err)
+	}
+
+	if previous.String != "" && previous.String != subscriptionID {
+		if err := auditLicense(b.tx, licenseID, "subscription_replaced", map[string]interface{}{
+			"previous_subscription_id": previous.String,
+			"subscription_id":          subscriptionID,
+		}); err != nil {
+			return "", err
+		}
+		log.Infof("License %s moved from subscription %s to %s", licenseID, previous.String, subscriptionID)
+		return previous.String, nil
+	}
+	return "", nil
+}
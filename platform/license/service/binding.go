@@ -0,0 +1,165 @@
+// Machine fingerprint binding for node-locked licensing
+
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// RequireFingerprint makes a machine fingerprint mandatory for every validation
+func (s *LicenseService) RequireFingerprint(required bool) {
+	s.requireFingerprint = required
+}
+
+// bindMachine checks the fingerprint against the license's bound machines.
+// A known fingerprint is refreshed; a new one takes a free seat if one is left under
+// the signed max_agents, otherwise it is rejected.
+func (s *LicenseService) bindMachine(licenseID string, maxAgents int, req models.ValidateLicenseRequest, ipAddress string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialise seat allocation per license
+	if _, err := tx.Exec(`SELECT id FROM licenses WHERE id = $1 FOR UPDATE`, licenseID); err != nil {
+		return false, fmt.Errorf("failed to lock license: %w", err)
+	}
+
+	var bindingID string
+	err = tx.QueryRow(`
+		SELECT id FROM license_activations
+		WHERE license_id = $1 AND machine_fingerprint = $2 AND deactivated_at IS NULL
+	`, licenseID, req.Fingerprint).Scan(&bindingID)
+
+	switch {
+	case err == nil:
+		_, err = tx.Exec(`
+			UPDATE license_activations
+			SET last_seen_at = NOW(), agent_id = COALESCE(NULLIF($2, ''), agent_id),
+			    hostname = COALESCE(NULLIF($3, ''), hostname)
+			WHERE id = $1
+		`, bindingID, req.AgentID, req.Hostname)
+		if err != nil {
+			return false, fmt.Errorf("failed to refresh machine binding: %w", err)
+		}
+		return true, tx.Commit()
+
+	case err != sql.ErrNoRows:
+		return false, fmt.Errorf("failed to look up machine binding: %w", err)
+	}
+
+	if maxAgents >= 0 {
+		var bound int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM license_activations
+			WHERE license_id = $1 AND machine_fingerprint IS NOT NULL AND deactivated_at IS NULL
+		`, licenseID).Scan(&bound)
+		if err != nil {
+			return false, fmt.Errorf("failed to count machine bindings: %w", err)
+		}
+		if bound >= maxAgents {
+			return false, nil
+		}
+	}
+
+	var ip sql.NullString
+	if ipAddress != "" {
+		ip = sql.NullString{String: ipAddress, Valid: true}
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO license_activations (license_id, agent_id, hostname, ip_address, os_type, machine_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, licenseID, req.AgentID, req.Hostname, ip, req.OSType, req.Fingerprint).Scan(&bindingID)
+	if err != nil {
+		return false, fmt.Errorf("failed to bind machine: %w", err)
+	}
+
+	details, _ := json.Marshal(map[string]string{
+		"binding_id": bindingID,
+		"agent_id":   req.AgentID,
+		"hostname":   req.Hostname,
+	})
+	if _, err := tx.Exec(`
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, 'machine_bound', $2, NOW())
+	`, licenseID, string(details)); err != nil {
+		return false, fmt.Errorf("failed to insert audit log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit machine binding: %w", err)
+	}
+
+	log.Infof("Bound license %s to machine %s (agent: %s)", licenseID, req.Hostname, req.AgentID)
+	return true, nil
+}
+
+// ListMachineBindings returns the machines currently holding seats on a license
+func (s *LicenseService) ListMachineBindings(licenseID string) ([]models.MachineBinding, error) {
+	rows, err := s.db.Query(`
+		SELECT id, license_id, COALESCE(agent_id, ''), COALESCE(hostname, ''), COALESCE(host(ip_address), ''),
+		       COALESCE(os_type, ''), machine_fingerprint, activated_at, last_seen_at
+		FROM license_activations
+		WHERE license_id = $1 AND machine_fingerprint IS NOT NULL AND deactivated_at IS NULL
+		ORDER BY activated_at ASC
+	`, licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query machine bindings: %w", err)
+	}
+	defer rows.Close()
+
+	bindings := []models.MachineBinding{}
+	for rows.Next() {
+		var b models.MachineBinding
+		if err := rows.Scan(&b.ID, &b.LicenseID, &b.AgentID, &b.Hostname, &b.IPAddress,
+			&b.OSType, &b.Fingerprint, &b.ActivatedAt, &b.LastSeenAt); err != nil {
+			log.Warnf("Failed to scan machine binding: %v", err)
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+
+	return bindings, nil
+}
+
+// ReleaseMachineBinding frees the seat held by a machine so another can bind
+func (s *LicenseService) ReleaseMachineBinding(licenseID, bindingID string) error {
+	result, err := s.db.Exec(`
+		UPDATE license_activations
+		SET deactivated_at = NOW()
+		WHERE id = $1 AND license_id = $2 AND deactivated_at IS NULL
+	`, bindingID, licenseID)
+	if err != nil {
+		return fmt.Errorf("failed to release machine binding: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("machine binding not found")
+	}
+
+	auditQuery := `
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, 'machine_released', $2, NOW())
+	`
+	details, _ := json.Marshal(map[string]string{"binding_id": bindingID})
+	if _, err := s.db.Exec(auditQuery, licenseID, string(details)); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+
+	log.Infof("Released machine binding %s on license %s", bindingID, licenseID)
+	return nil
+}
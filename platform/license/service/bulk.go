@@ -0,0 +1,232 @@
+// Bulk license operations for resellers
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// MaxBulkLicenses caps the number of licenses created in one bulk request
+const MaxBulkLicenses = 1000
+
+// ValidateCreateRequest checks a license request that did not pass through JSON binding (e.g. a CSV row)
+func ValidateCreateRequest(req models.CreateLicenseRequest) error {
+	if req.CustomerEmail == "" {
+		return fmt.Errorf("customer_email is required")
+	}
+	if _, err := mail.ParseAddress(req.CustomerEmail); err != nil {
+		return fmt.Errorf("invalid customer_email: %s", req.CustomerEmail)
+	}
+	if req.CustomerName == "" {
+		return fmt.Errorf("customer_name is required")
+	}
+	switch req.Tier {
+	case models.TierFree, models.TierPro, models.TierEnterprise:
+	default:
+		return fmt.Errorf("invalid tier: %s", req.Tier)
+	}
+	if req.DurationDays < 0 {
+		return fmt.Errorf("duration_days cannot be negative")
+	}
+	return nil
+}
+
+// BulkCreateLicenses creates many licenses at once.
+// In atomic mode every row is created in a single transaction and any failure creates nothing;
+// in best-effort mode each row is committed on its own and failures are reported per row.
+func (s *LicenseService) BulkCreateLicenses(reqs []models.CreateLicenseRequest, mode models.BulkMode) (*models.BulkCreateLicensesResponse, error) {
+	if mode == "" {
+		mode = models.BulkModeAtomic
+	}
+	if mode != models.BulkModeAtomic && mode != models.BulkModeBestEffort {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no licenses provided")
+	}
+	if len(reqs) > MaxBulkLicenses {
+		return nil, fmt.Errorf("too many licenses: %d (max %d)", len(reqs), MaxBulkLicenses)
+	}
+
+	response := &models.BulkCreateLicensesResponse{
+		Mode:    mode,
+		Total:   len(reqs),
+		Results: make([]models.BulkLicenseResult, len(reqs)),
+	}
+
+	// Validate and sign every row up front so an atomic batch fails before touching the database
+	licenses := make([]*models.License, len(reqs))
+	invalid := 0
+	for i, req := range reqs {
+		response.Results[i] = models.BulkLicenseResult{Row: i + 1, CustomerEmail: req.CustomerEmail}
+
+		if err := ValidateCreateRequest(req); err != nil {
+			response.Results[i].Error = err.Error()
+			invalid++
+			continue
+		}
+
+		license, err := s.buildLicense(req)
+		if err != nil {
+			response.Results[i].Error = err.Error()
+			invalid++
+			continue
+		}
+		licenses[i] = license
+	}
+
+	if mode == models.BulkModeAtomic {
+		if invalid > 0 {
+			markNotCreated(response, "not created: batch contains invalid rows")
+			return response, nil
+		}
+		if err := s.createLicensesAtomic(licenses, response); err != nil {
+			return nil, err
+		}
+	} else {
+		for i, license := range licenses {
+			if license == nil {
+				continue
+			}
+			if err := s.createLicenseTx(license, len(reqs)); err != nil {
+				response.Results[i].Error = err.Error()
+				continue
+			}
+			response.Results[i].Success = true
+			response.Results[i].License = license
+		}
+	}
+
+	for _, result := range response.Results {
+		if result.Success {
+			response.Created++
+			s.emitLicenseEvent(EventLicenseCreated, result.License.ID, map[string]interface{}{"source": "bulk_import"})
+		} else {
+			response.Failed++
+		}
+	}
+
+	log.Infof("Bulk license import (%s): %d created, %d failed", mode, response.Created, response.Failed)
+	return response, nil
+}
+
+// createLicensesAtomic inserts all licenses in one transaction
+func (s *LicenseService) createLicensesAtomic(licenses []*models.License, response *models.BulkCreateLicensesResponse) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i, license := range licenses {
+		if err := insertBulkLicense(tx, license, len(licenses)); err != nil {
+			response.Results[i].Error = err.Error()
+			markNotCreated(response, "not created: batch rolled back")
+			return nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit bulk import: %w", err)
+	}
+
+	for i, license := range licenses {
+		response.Results[i].Success = true
+		response.Results[i].License = license
+	}
+	return nil
+}
+
+// createLicenseTx inserts a single license and its usage and audit rows in their own transaction
+func (s *LicenseService) createLicenseTx(license *models.License, batchSize int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertBulkLicense(tx, license, batchSize); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit license: %w", err)
+	}
+	return nil
+}
+
+// insertBulkLicense writes the license, its usage record and a 'created' audit entry
+func insertBulkLicense(db dbExecer, license *models.License, batchSize int) error {
+	if err := insertLicense(db, license); err != nil {
+		return err
+	}
+
+	if err := initLicenseUsage(db, license.ID); err != nil {
+		return fmt.Errorf("failed to initialize license usage: %w", err)
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"source":     "bulk_import",
+		"batch_size": batchSize,
+		"tier":       license.Tier,
+	})
+	_, err := db.Exec(`
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, 'created', $2, NOW())
+	`, license.ID, string(details))
+	if err != nil {
+		return fmt.Errorf("failed to insert audit log: %w", err)
+	}
+
+	return nil
+}
+
+// markNotCreated flags every row without an error of its own as not created
+func markNotCreated(response *models.BulkCreateLicensesResponse, reason string) {
+	for i := range response.Results {
+		response.Results[i].Success = false
+		response.Results[i].License = nil
+		if response.Results[i].Error == "" {
+			response.Results[i].Error = reason
+		}
+	}
+}
+
+// ExportLicenses returns every license, oldest first, or only licenseID when it is set
+func (s *LicenseService) ExportLicenses(licenseID string) ([]*models.License, error) {
+	rows, err := s.db.Query(`
+		SELECT id, license_key, customer_email, customer_name, company_name,
+		       tier, max_agents, max_users, issued_at, expires_at, is_active,
+		       activated_at, last_validated_at, metadata, feature_overrides,
+		       stripe_customer_id, stripe_subscription_id, parent_license_id, created_at, updated_at
+		FROM licenses
+		WHERE ($1 = '' OR id::text = $1)
+		ORDER BY created_at ASC
+	`, licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query licenses: %w", err)
+	}
+	defer rows.Close()
+
+	licenses := make([]*models.License, 0)
+	for rows.Next() {
+		license, err := scanLicense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan license: %w", err)
+		}
+		licenses = append(licenses, license)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read licenses: %w", err)
+	}
+
+	log.Infof("Exported %d licenses", len(licenses))
+	return licenses, nil
+}
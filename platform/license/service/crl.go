@@ -0,0 +1,96 @@
+// Revocation list generation for offline license validation
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/crypto"
+)
+
+const (
+	// crlValidity is how long agents may rely on a CRL before they should refresh it
+	crlValidity = 24 * time.Hour
+
+	// crlRefreshInterval is how often the cached CRL is reissued when nothing changes
+	crlRefreshInterval = time.Hour
+)
+
+// GetRevocationList returns the current signed CRL, reissuing it when it is
+// older than the refresh interval or a license has been revoked since
+func (s *LicenseService) GetRevocationList() (*crypto.SignedRevocationList, error) {
+	s.crlMu.Lock()
+	defer s.crlMu.Unlock()
+
+	if s.crl != nil && time.Since(s.crlIssuedAt) < crlRefreshInterval {
+		return s.crl, nil
+	}
+
+	signed, err := s.buildRevocationList()
+	if err != nil {
+		return nil, err
+	}
+
+	s.crl = signed
+	s.crlIssuedAt = time.Now()
+	return signed, nil
+}
+
+// invalidateRevocationList drops the cached CRL
+func (s *LicenseService) invalidateRevocationList() {
+	s.crlMu.Lock()
+	s.crl = nil
+	s.crlMu.Unlock()
+}
+
+// buildRevocationList collects every revoked license and signs the list
+func (s *LicenseService) buildRevocationList() (*crypto.SignedRevocationList, error) {
+	rows, err := s.db.Query(`
+		SELECT l.id, COALESCE(l.updated_at, l.created_at),
+		       COALESCE((
+		           SELECT a.details->>'reason' FROM license_audit_log a
+		           WHERE a.license_id = l.id AND a.action = 'revoked'
+		           ORDER BY a.created_at DESC LIMIT 1
+		       ), '')
+		FROM licenses l
+		WHERE l.is_active = FALSE
+		ORDER BY l.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revoked licenses: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	list := crypto.RevocationList{
+		Number:     now.UnixMilli(),
+		IssuedAt:   now.Unix(),
+		NextUpdate: now.Add(crlValidity).Unix(),
+		Revoked:    []crypto.RevokedLicense{},
+	}
+
+	for rows.Next() {
+		var entry crypto.RevokedLicense
+		var revokedAt time.Time
+		if err := rows.Scan(&entry.ID, &revokedAt, &entry.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan revoked license: %w", err)
+		}
+		entry.RevokedAt = revokedAt.Unix()
+		list.Revoked = append(list.Revoked, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read revoked licenses: %w", err)
+	}
+
+	signed, err := crypto.SignRevocationList(list, s.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Issued license CRL #%d with %d revoked licenses", list.Number, len(list.Revoked))
+	return signed, nil
+}
@@ -0,0 +1,117 @@
+// Per-license feature overrides on top of tier defaults
+
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// GetLicenseFeatures returns the tier defaults, overrides and effective features of a license
+func (s *LicenseService) GetLicenseFeatures(licenseID string) (*models.LicenseFeatureSet, error) {
+	var tier string
+	var overridesJSON []byte
+
+	err := s.db.QueryRow(`
+		SELECT tier, feature_overrides FROM licenses WHERE id = $1
+	`, licenseID).Scan(&tier, &overridesJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("license not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	overrides := map[string]bool{}
+	if len(overridesJSON) > 0 {
+		json.Unmarshal(overridesJSON, &overrides)
+	}
+
+	defaults := models.GetFeaturesForTier(models.LicenseTier(tier))
+	return &models.LicenseFeatureSet{
+		LicenseID: licenseID,
+		Tier:      models.LicenseTier(tier),
+		Defaults:  defaults,
+		Overrides: overrides,
+		Effective: models.ApplyFeatureOverrides(defaults, overrides),
+	}, nil
+}
+
+// SetFeatureOverride grants (enabled) or revokes (disabled) a single feature regardless of tier
+func (s *LicenseService) SetFeatureOverride(licenseID, feature string, enabled bool) error {
+	if !models.IsKnownFeature(feature) {
+		return fmt.Errorf("unknown feature: %s", feature)
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE licenses
+		SET feature_overrides = COALESCE(feature_overrides, '{}'::jsonb) || jsonb_build_object($2::text, $3::boolean),
+		    updated_at = NOW()
+		WHERE id = $1
+	`, licenseID, feature, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to set feature override: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("license not found")
+	}
+
+	action := "feature_revoked"
+	if enabled {
+		action = "feature_granted"
+	}
+	s.auditFeatureChange(licenseID, action, feature)
+
+	log.Infof("Set feature %s=%t on license %s", feature, enabled, licenseID)
+	return nil
+}
+
+// ClearFeatureOverride removes an override so the feature follows the tier default again
+func (s *LicenseService) ClearFeatureOverride(licenseID, feature string) error {
+	result, err := s.db.Exec(`
+		UPDATE licenses
+		SET feature_overrides = COALESCE(feature_overrides, '{}'::jsonb) - $2::text,
+		    updated_at = NOW()
+		WHERE id = $1
+	`, licenseID, feature)
+	if err != nil {
+		return fmt.Errorf("failed to clear feature override: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("license not found")
+	}
+
+	s.auditFeatureChange(licenseID, "feature_override_cleared", feature)
+
+	log.Infof("Cleared feature override %s on license %s", feature, licenseID)
+	return nil
+}
+
+// auditFeatureChange records a feature override change
+func (s *LicenseService) auditFeatureChange(licenseID, action, feature string) {
+	auditQuery := `
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	details, _ := json.Marshal(map[string]string{"feature": feature})
+	if _, err := s.db.Exec(auditQuery, licenseID, action, string(details)); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+// Parent/child license hierarchy for MSSPs and multi-unit enterprises
+
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// HierarchyError is a link request the license hierarchy does not allow
+type HierarchyError struct {
+	msg string
+}
+
+func (e *HierarchyError) Error() string { return e.msg }
+
+// LinkChildLicense places childID under parentID. The hierarchy is one level deep: a parent
+// cannot itself be a child, and a child cannot have children of its own, which also rules out
+// cycles. The parent needs the multi_tenancy feature. Linking gives the parent the child's
+// telemetry; callers must restrict it to platform administrators.
+func (s *LicenseService) LinkChildLicense(parentID, childID string) error {
+	if parentID == childID {
+		return &HierarchyError{"a license cannot be its own parent"}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both rows so concurrent links cannot build a deeper hierarchy between checks
+	var tier string
+	var overridesJSON []byte
+	var grandparentID sql.NullString
+	err = tx.QueryRow(`
+		SELECT tier, feature_overrides, parent_license_id FROM licenses WHERE id = $1 FOR UPDATE
+	`, parentID).Scan(&tier, &overridesJSON, &grandparentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("license not found")
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	var currentParentID sql.NullString
+	err = tx.QueryRow(`
+		SELECT parent_license_id FROM licenses WHERE id = $1 FOR UPDATE
+	`, childID).Scan(&currentParentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("child license not found")
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if currentParentID.String == parentID {
+		return nil
+	}
+	if currentParentID.Valid {
+		return &HierarchyError{"license already belongs to another parent license; unlink it first"}
+	}
+	if grandparentID.Valid {
+		return &HierarchyError{"license is a child license and cannot have children of its own"}
+	}
+
+	var hasChildren bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM licenses WHERE parent_license_id = $1)
+	`, childID).Scan(&hasChildren); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if hasChildren {
+		return &HierarchyError{"license has child licenses of its own and cannot become a child"}
+	}
+
+	overrides := map[string]bool{}
+	if len(overridesJSON) > 0 {
+		json.Unmarshal(overridesJSON, &overrides)
+	}
+	if !models.ApplyFeatureOverrides(models.GetFeaturesForTier(models.LicenseTier(tier)), overrides).MultiTenancy {
+		return &HierarchyError{"parent license does not include the multi_tenancy feature"}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE licenses SET parent_license_id = $1, updated_at = NOW() WHERE id = $2
+	`, parentID, childID); err != nil {
+		return fmt.Errorf("failed to link child license: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.auditHierarchyChange(parentID, "child_linked", map[string]string{"child_license_id": childID})
+	s.auditHierarchyChange(childID, "parent_linked", map[string]string{"parent_license_id": parentID})
+
+	log.Infof("Linked license %s under parent %s", childID, parentID)
+	return nil
+}
+
+// UnlinkChildLicense removes childID from parentID's hierarchy
+func (s *LicenseService) UnlinkChildLicense(parentID, childID string) error {
+	result, err := s.db.Exec(`
+		UPDATE licenses SET parent_license_id = NULL, updated_at = NOW()
+		WHERE id = $2 AND parent_license_id = $1
+	`, parentID, childID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink child license: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("child license not found")
+	}
+
+	s.auditHierarchyChange(parentID, "child_unlinked", map[string]string{"child_license_id": childID})
+	s.auditHierarchyChange(childID, "parent_unlinked", map[string]string{"parent_license_id": parentID})
+
+	log.Infof("Unlinked license %s from parent %s", childID, parentID)
+	return nil
+}
+
+// ListChildLicenses returns a parent license's children with their usage, and usage and caps
+// rolled up over the parent and its active children
+func (s *LicenseService) ListChildLicenses(parentID string) (*models.LicenseHierarchy, error) {
+	var maxAgents, maxUsers int
+	err := s.db.QueryRow(`
+		SELECT max_agents, max_users FROM licenses WHERE id = $1
+	`, parentID).Scan(&maxAgents, &maxUsers)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("license not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	parentUsage, err := s.GetLicenseUsage(parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	hierarchy := &models.LicenseHierarchy{
+		ParentLicenseID: parentID,
+		Parent:          *parentUsage,
+		Children:        make([]models.ChildLicense, 0),
+		Rollup: models.LicenseUsageRollup{
+			Licenses:       1,
+			ActiveAgents:   parentUsage.ActiveAgents,
+			ActiveUsers:    parentUsage.ActiveUsers,
+			EventsIngested: parentUsage.EventsIngested,
+			StorageUsedGB:  parentUsage.StorageUsedGB,
+			MaxAgents:      maxAgents,
+			MaxUsers:       maxUsers,
+		},
+	}
+
+	rows, err := s.db.Query(`
+		SELECT l.id, l.customer_name, COALESCE(l.company_name, ''), l.tier, l.max_agents, l.max_users,
+		       l.is_active, l.expires_at,
+		       COALESCE(u.active_agents, 0), COALESCE(u.active_users, 0), COALESCE(u.events_ingested, 0),
+		       COALESCE(u.storage_used_gb, 0), u.last_updated
+		FROM licenses l
+		LEFT JOIN license_usage u ON u.license_id = l.id
+		WHERE l.parent_license_id = $1
+		ORDER BY l.customer_name
+	`, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child licenses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var child models.ChildLicense
+		var expiresAt, lastUpdated sql.NullTime
+		if err := rows.Scan(
+			&child.ID, &child.CustomerName, &child.CompanyName, &child.Tier, &child.MaxAgents, &child.MaxUsers,
+			&child.IsActive, &expiresAt,
+			&child.Usage.ActiveAgents, &child.Usage.ActiveUsers, &child.Usage.EventsIngested,
+			&child.Usage.StorageUsedGB, &lastUpdated,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan child license: %w", err)
+		}
+		if expiresAt.Valid {
+			child.ExpiresAt = &expiresAt.Time
+		}
+		child.Usage.LicenseID = child.ID
+		child.Usage.LastUpdated = lastUpdated.Time
+		if !lastUpdated.Valid {
+			child.Usage.LastUpdated = time.Now()
+		}
+
+		hierarchy.Children = append(hierarchy.Children, child)
+
+		if !child.IsActive {
+			continue
+		}
+		hierarchy.Rollup.Licenses++
+		hierarchy.Rollup.ActiveAgents += child.Usage.ActiveAgents
+		hierarchy.Rollup.ActiveUsers += child.Usage.ActiveUsers
+		hierarchy.Rollup.EventsIngested += child.Usage.EventsIngested
+		hierarchy.Rollup.StorageUsedGB += child.Usage.StorageUsedGB
+		hierarchy.Rollup.MaxAgents += child.MaxAgents
+		hierarchy.Rollup.MaxUsers += child.MaxUsers
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query child licenses: %w", err)
+	}
+
+	return hierarchy, nil
+}
+
+// auditHierarchyChange records a hierarchy change on one side of the link
+func (s *LicenseService) auditHierarchyChange(licenseID, action string, details map[string]string) {
+	detailsJSON, _ := json.Marshal(details)
+	if _, err := s.db.Exec(`
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, licenseID, action, detailsJSON); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+}
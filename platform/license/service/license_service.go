@@ -7,6 +7,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,9 +20,17 @@ import (
 
 // LicenseService handles license operations
 type LicenseService struct {
-	db         *sql.DB
-	privateKey ed25519.PrivateKey
-	publicKey  ed25519.PublicKey
+	db                 *sql.DB
+	privateKey         ed25519.PrivateKey
+	publicKey          ed25519.PublicKey
+	requireFingerprint bool // Reject validations that do not submit a machine fingerprint
+
+	crlMu       sync.Mutex
+	crl         *crypto.SignedRevocationList // Cached signed revocation list
+	crlIssuedAt time.Time
+
+	webhookSender   WebhookSender   // License lifecycle webhook delivery; disabled when nil
+	overageNotifier OverageNotifier // Seat overage notifications to the license's channels; disabled when nil
 }
 
 // NewLicenseService creates a new license service
@@ -32,8 +42,42 @@ func NewLicenseService(db *sql.DB, privateKey ed25519.PrivateKey, publicKey ed25
 	}
 }
 
+// dbExecer is satisfied by both *sql.DB and *sql.Tx
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbQuerier is satisfied by both *sql.DB and *sql.Tx
+type dbQuerier interface {
+	dbExecer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // CreateLicense generates a new license
 func (s *LicenseService) CreateLicense(req models.CreateLicenseRequest) (*models.License, error) {
+	license, err := s.buildLicense(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertLicense(s.db, license); err != nil {
+		return nil, err
+	}
+
+	// Initialize license usage record
+	if err := initLicenseUsage(s.db, license.ID); err != nil {
+		log.Warnf("Failed to initialize license usage record: %v", err)
+	}
+
+	log.Infof("Created license: %s for %s (%s tier)", license.ID, req.CustomerEmail, req.Tier)
+
+	s.emitLicenseEvent(EventLicenseCreated, license.ID, map[string]interface{}{"source": "api"})
+
+	return license, nil
+}
+
+// buildLicense assembles a license record and its signed key without persisting it
+func (s *LicenseService) buildLicense(req models.CreateLicenseRequest) (*models.License, error) {
 	// Generate license ID
 	licenseID := uuid.New().String()
 
@@ -70,8 +114,7 @@ func (s *LicenseService) CreateLicense(req models.CreateLicenseRequest) (*models
 	features := models.GetFeaturesForTier(req.Tier)
 	featuresJSON, _ := json.Marshal(features)
 
-	// Create license record
-	license := &models.License{
+	return &models.License{
 		ID:            licenseID,
 		LicenseKey:    licenseKey,
 		CustomerEmail: req.CustomerEmail,
@@ -84,9 +127,11 @@ func (s *LicenseService) CreateLicense(req models.CreateLicenseRequest) (*models
 		ExpiresAt:     expiresAt,
 		IsActive:      true,
 		Metadata:      string(featuresJSON),
-	}
+	}, nil
+}
 
-	// Insert into database
+// insertLicense writes a license record
+func insertLicense(db dbExecer, license *models.License) error {
 	query := `
 		INSERT INTO licenses (
 			id, license_key, customer_email, customer_name, company_name,
@@ -94,42 +139,43 @@ func (s *LicenseService) CreateLicense(req models.CreateLicenseRequest) (*models
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
 
-	_, err = s.db.Exec(query,
-		licenseID,
-		licenseKey,
-		req.CustomerEmail,
-		req.CustomerName,
-		req.CompanyName,
-		string(req.Tier),
-		maxAgents,
-		maxUsers,
+	_, err := db.Exec(query,
+		license.ID,
+		license.LicenseKey,
+		license.CustomerEmail,
+		license.CustomerName,
+		license.CompanyName,
+		string(license.Tier),
+		license.MaxAgents,
+		license.MaxUsers,
 		license.IssuedAt,
-		expiresAt,
-		true,
-		string(featuresJSON),
+		license.ExpiresAt,
+		license.IsActive,
+		license.Metadata,
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert license into database: %w", err)
+		return fmt.Errorf("failed to insert license into database: %w", err)
 	}
 
-	// Initialize license usage record
+	return nil
+}
+
+// initLicenseUsage creates the zeroed usage record for a new license
+func initLicenseUsage(db dbExecer, licenseID string) error {
 	usageQuery := `
 		INSERT INTO license_usage (license_id, active_agents, active_users, events_ingested, storage_used_gb)
 		VALUES ($1, 0, 0, 0, 0)
 	`
-	_, err = s.db.Exec(usageQuery, licenseID)
-	if err != nil {
-		log.Warnf("Failed to initialize license usage record: %v", err)
-	}
-
-	log.Infof("Created license: %s for %s (%s tier)", licenseID, req.CustomerEmail, req.Tier)
-
-	return license, nil
+	_, err := db.Exec(usageQuery, licenseID)
+	return err
 }
 
-// ValidateLicense checks if a license key is valid
-func (s *LicenseService) ValidateLicense(licenseKey string, agentID string) (*models.ValidateLicenseResponse, error) {
+// ValidateLicense checks if a license key is valid and, when a fingerprint is submitted,
+// binds a seat to the requesting machine
+func (s *LicenseService) ValidateLicense(req models.ValidateLicenseRequest, ipAddress string) (*models.ValidateLicenseResponse, error) {
+	licenseKey := req.LicenseKey
+	agentID := req.AgentID
+
 	// Cryptographically validate the key
 	payload, err := crypto.ValidateLicenseKey(licenseKey, s.publicKey)
 	if err != nil {
@@ -142,13 +188,14 @@ func (s *LicenseService) ValidateLicense(licenseKey string, agentID string) (*mo
 	// Check database for license status and usage
 	var isActive bool
 	var dbExpiresAt *time.Time
+	var overridesJSON []byte
 
 	query := `
-		SELECT is_active, expires_at
+		SELECT is_active, expires_at, feature_overrides
 		FROM licenses
 		WHERE id = $1
 	`
-	err = s.db.QueryRow(query, payload.ID).Scan(&isActive, &dbExpiresAt)
+	err = s.db.QueryRow(query, payload.ID).Scan(&isActive, &dbExpiresAt, &overridesJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return &models.ValidateLicenseResponse{
@@ -195,8 +242,33 @@ func (s *LicenseService) ValidateLicense(licenseKey string, agentID string) (*mo
 		}
 	}
 
-	// Get features
-	features := models.GetFeaturesForTier(license.Tier)
+	// Node-lock the seat to the machine's hardware fingerprint
+	if req.Fingerprint == "" && s.requireFingerprint {
+		return &models.ValidateLicenseResponse{
+			Valid:   false,
+			Message: "Machine fingerprint required",
+		}, nil
+	}
+	if req.Fingerprint != "" {
+		allowed, err := s.bindMachine(payload.ID, payload.MaxAgents, req, ipAddress)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			log.Warnf("License %s rejected for unbound machine (agent: %s, host: %s)", payload.ID, agentID, req.Hostname)
+			return &models.ValidateLicenseResponse{
+				Valid:   false,
+				Message: "License seat limit reached: machine is not bound to this license",
+			}, nil
+		}
+	}
+
+	// Get features, including any per-license grants or restrictions
+	var overrides map[string]bool
+	if len(overridesJSON) > 0 {
+		json.Unmarshal(overridesJSON, &overrides)
+	}
+	features := models.ApplyFeatureOverrides(models.GetFeaturesForTier(license.Tier), overrides)
 
 	// Calculate actual remaining agents from usage
 	var activeAgents int
@@ -236,18 +308,32 @@ func (s *LicenseService) ValidateLicense(licenseKey string, agentID string) (*mo
 
 // GetLicense retrieves license by ID
 func (s *LicenseService) GetLicense(licenseID string) (*models.License, error) {
+	license, err := getLicense(s.db, licenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Retrieved license: %s", licenseID)
+	return license, nil
+}
+
+// getLicense reads a license record
+func getLicense(db dbQuerier, licenseID string) (*models.License, error) {
 	query := `
 		SELECT id, license_key, customer_email, customer_name, company_name,
 		       tier, max_agents, max_users, issued_at, expires_at, is_active,
-		       activated_at, last_validated_at, metadata, created_at, updated_at
+		       activated_at, last_validated_at, metadata, feature_overrides,
+		       stripe_customer_id, stripe_subscription_id, parent_license_id, created_at, updated_at
 		FROM licenses
 		WHERE id = $1
 	`
 
 	license := &models.License{}
 	var expiresAt, activatedAt, lastValidatedAt, updatedAt sql.NullTime
+	var overrides []byte
+	var stripeCustomerID, stripeSubscriptionID, parentLicenseID sql.NullString
 
-	err := s.db.QueryRow(query, licenseID).Scan(
+	err := db.QueryRow(query, licenseID).Scan(
 		&license.ID,
 		&license.LicenseKey,
 		&license.CustomerEmail,
@@ -262,6 +348,10 @@ func (s *LicenseService) GetLicense(licenseID string) (*models.License, error) {
 		&activatedAt,
 		&lastValidatedAt,
 		&license.Metadata,
+		&overrides,
+		&stripeCustomerID,
+		&stripeSubscriptionID,
+		&parentLicenseID,
 		&license.CreatedAt,
 		&updatedAt,
 	)
@@ -286,32 +376,41 @@ func (s *LicenseService) GetLicense(licenseID string) (*models.License, error) {
 	if updatedAt.Valid {
 		license.UpdatedAt = &updatedAt.Time
 	}
+	if len(overrides) > 0 {
+		json.Unmarshal(overrides, &license.FeatureOverrides)
+	}
+	license.StripeCustomerID = stripeCustomerID.String
+	license.StripeSubscriptionID = stripeSubscriptionID.String
+	license.ParentLicenseID = parentLicenseID.String
 
-	log.Infof("Retrieved license: %s", licenseID)
 	return license, nil
 }
 
-// ListLicenses retrieves all licenses (with pagination)
-func (s *LicenseService) ListLicenses(limit, offset int) ([]*models.License, int, error) {
+// ListLicenses retrieves the licenses matching filter (with pagination)
+func (s *LicenseService) ListLicenses(filter models.LicenseListFilter, limit, offset int) ([]*models.License, int, error) {
+	where, args := licenseListConditions(filter)
+
 	// Get total count
 	var total int
-	countQuery := `SELECT COUNT(*) FROM licenses`
-	err := s.db.QueryRow(countQuery).Scan(&total)
+	countQuery := `SELECT COUNT(*) FROM licenses` + where
+	err := s.db.QueryRow(countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count licenses: %w", err)
 	}
 
 	// Get licenses with pagination
-	query := `
+	query := fmt.Sprintf(`
 		SELECT id, license_key, customer_email, customer_name, company_name,
 		       tier, max_agents, max_users, issued_at, expires_at, is_active,
-		       activated_at, last_validated_at, metadata, created_at, updated_at
-		FROM licenses
+		       activated_at, last_validated_at, metadata, feature_overrides,
+		       stripe_customer_id, stripe_subscription_id, parent_license_id, created_at, updated_at
+		FROM licenses%s
 		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
 
-	rows, err := s.db.Query(query, limit, offset)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query licenses: %w", err)
 	}
@@ -319,47 +418,11 @@ func (s *LicenseService) ListLicenses(limit, offset int) ([]*models.License, int
 
 	licenses := make([]*models.License, 0)
 	for rows.Next() {
-		license := &models.License{}
-		var expiresAt, activatedAt, lastValidatedAt, updatedAt sql.NullTime
-
-		err := rows.Scan(
-			&license.ID,
-			&license.LicenseKey,
-			&license.CustomerEmail,
-			&license.CustomerName,
-			&license.CompanyName,
-			&license.Tier,
-			&license.MaxAgents,
-			&license.MaxUsers,
-			&license.IssuedAt,
-			&expiresAt,
-			&license.IsActive,
-			&activatedAt,
-			&lastValidatedAt,
-			&license.Metadata,
-			&license.CreatedAt,
-			&updatedAt,
-		)
-
+		license, err := scanLicense(rows)
 		if err != nil {
 			log.Warnf("Failed to scan license: %v", err)
 			continue
 		}
-
-		// Handle nullable timestamps
-		if expiresAt.Valid {
-			license.ExpiresAt = &expiresAt.Time
-		}
-		if activatedAt.Valid {
-			license.ActivatedAt = &activatedAt.Time
-		}
-		if lastValidatedAt.Valid {
-			license.LastValidatedAt = &lastValidatedAt.Time
-		}
-		if updatedAt.Valid {
-			license.UpdatedAt = &updatedAt.Time
-		}
-
 		licenses = append(licenses, license)
 	}
 
@@ -367,16 +430,122 @@ func (s *LicenseService) ListLicenses(limit, offset int) ([]*models.License, int
 	return licenses, total, nil
 }
 
+// licenseListConditions builds the WHERE clause for a license listing. The search is served by
+// the trigram indexes on customer_name, customer_email and company_name.
+func licenseListConditions(filter models.LicenseListFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.LicenseID != "" {
+		conditions = append(conditions, "id = "+addArg(filter.LicenseID))
+	}
+	if filter.Tier != "" {
+		conditions = append(conditions, "tier = "+addArg(string(filter.Tier)))
+	}
+	if filter.IsActive != nil {
+		conditions = append(conditions, "is_active = "+addArg(*filter.IsActive))
+	}
+	if filter.ExpiringWithinDays > 0 {
+		conditions = append(conditions, fmt.Sprintf("expires_at BETWEEN NOW() AND NOW() + %s * INTERVAL '1 day'", addArg(filter.ExpiringWithinDays)))
+	}
+	if filter.Search != "" {
+		// Escape LIKE wildcards so the search is a literal substring match
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Search) + "%"
+		placeholder := addArg(pattern)
+		conditions = append(conditions, fmt.Sprintf("(customer_name ILIKE %[1]s OR customer_email ILIKE %[1]s OR company_name ILIKE %[1]s)", placeholder))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanLicense reads a license row selected with the standard column list
+func scanLicense(rows *sql.Rows) (*models.License, error) {
+	license := &models.License{}
+	var expiresAt, activatedAt, lastValidatedAt, updatedAt sql.NullTime
+	var overrides []byte
+	var stripeCustomerID, stripeSubscriptionID, parentLicenseID sql.NullString
+
+	err := rows.Scan(
+		&license.ID,
+		&license.LicenseKey,
+		&license.CustomerEmail,
+		&license.CustomerName,
+		&license.CompanyName,
+		&license.Tier,
+		&license.MaxAgents,
+		&license.MaxUsers,
+		&license.IssuedAt,
+		&expiresAt,
+		&license.IsActive,
+		&activatedAt,
+		&lastValidatedAt,
+		&license.Metadata,
+		&overrides,
+		&stripeCustomerID,
+		&stripeSubscriptionID,
+		&parentLicenseID,
+		&license.CreatedAt,
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable timestamps
+	if expiresAt.Valid {
+		license.ExpiresAt = &expiresAt.Time
+	}
+	if activatedAt.Valid {
+		license.ActivatedAt = &activatedAt.Time
+	}
+	if lastValidatedAt.Valid {
+		license.LastValidatedAt = &lastValidatedAt.Time
+	}
+	if updatedAt.Valid {
+		license.UpdatedAt = &updatedAt.Time
+	}
+	if len(overrides) > 0 {
+		json.Unmarshal(overrides, &license.FeatureOverrides)
+	}
+	license.StripeCustomerID = stripeCustomerID.String
+	license.StripeSubscriptionID = stripeSubscriptionID.String
+	license.ParentLicenseID = parentLicenseID.String
+
+	return license, nil
+}
+
 // RevokeLicense deactivates a license
 func (s *LicenseService) RevokeLicense(licenseID string, reason string) error {
-	// Update database to set is_active = false
-	query := `
+	if err := deactivateLicense(s.db, licenseID); err != nil {
+		return err
+	}
+	if err := auditLicense(s.db, licenseID, "revoked", map[string]interface{}{"reason": reason}); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+
+	// Reissue the CRL on next request so offline agents pick up the revocation
+	s.invalidateRevocationList()
+
+	s.emitLicenseEvent(EventLicenseRevoked, licenseID, map[string]interface{}{"reason": reason})
+
+	log.Warnf("Revoked license: %s (reason: %s)", licenseID, reason)
+	return nil
+}
+
+// deactivateLicense sets a license inactive
+func deactivateLicense(db dbExecer, licenseID string) error {
+	result, err := db.Exec(`
 		UPDATE licenses
 		SET is_active = FALSE, updated_at = NOW()
 		WHERE id = $1
-	`
-
-	result, err := s.db.Exec(query, licenseID)
+	`, licenseID)
 	if err != nil {
 		return fmt.Errorf("failed to revoke license: %w", err)
 	}
@@ -389,19 +558,22 @@ func (s *LicenseService) RevokeLicense(licenseID string, reason string) error {
 	if rowsAffected == 0 {
 		return fmt.Errorf("license not found")
 	}
+	return nil
+}
 
-	// Insert audit log entry
-	auditQuery := `
+// auditLicense writes a license_audit_log entry
+func auditLicense(db dbExecer, licenseID, action string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+	_, err = db.Exec(`
 		INSERT INTO license_audit_log (license_id, action, details, created_at)
-		VALUES ($1, 'revoked', $2, NOW())
-	`
-	details := fmt.Sprintf(`{"reason": "%s"}`, reason)
-	_, err = s.db.Exec(auditQuery, licenseID, details)
+		VALUES ($1, $2, $3, NOW())
+	`, licenseID, action, string(detailsJSON))
 	if err != nil {
-		log.Warnf("Failed to insert audit log: %v", err)
+		return fmt.Errorf("failed to insert audit log: %w", err)
 	}
-
-	log.Warnf("Revoked license: %s (reason: %s)", licenseID, reason)
 	return nil
 }
 
@@ -456,56 +628,89 @@ func (s *LicenseService) GenerateTrialLicense(email, name string) (*models.Licen
 
 // UpgradeLicense upgrades an existing license to a higher tier
 func (s *LicenseService) UpgradeLicense(licenseID string, newTier models.LicenseTier) error {
+	maxAgents, maxUsers, err := setLicenseTier(s.db, licenseID, newTier)
+	if err != nil {
+		return err
+	}
+
+	details := tierChangeDetails(newTier, maxAgents, maxUsers)
+	if err := auditLicense(s.db, licenseID, tierChangeAction(EventLicenseUpgraded), details); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+
+	s.emitLicenseEvent(EventLicenseUpgraded, licenseID, details)
+
+	log.Infof("Upgraded license %s to %s tier", licenseID, newTier)
+	return nil
+}
+
+// setLicenseTier applies a tier and its limits to an active license
+func setLicenseTier(db dbExecer, licenseID string, newTier models.LicenseTier) (maxAgents, maxUsers int, err error) {
 	// Get new limits for tier
-	maxAgents, maxUsers := models.GetLimitsForTier(newTier)
+	maxAgents, maxUsers = models.GetLimitsForTier(newTier)
 
-	// Update database with new tier and limits
-	query := `
+	result, err := db.Exec(`
 		UPDATE licenses
 		SET tier = $1, max_agents = $2, max_users = $3, updated_at = NOW()
 		WHERE id = $4 AND is_active = TRUE
-	`
-
-	result, err := s.db.Exec(query, string(newTier), maxAgents, maxUsers, licenseID)
+	`, string(newTier), maxAgents, maxUsers, licenseID)
 	if err != nil {
-		return fmt.Errorf("failed to upgrade license: %w", err)
+		return 0, 0, fmt.Errorf("failed to change license tier: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return 0, 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("license not found or inactive")
+		return 0, 0, fmt.Errorf("license not found or inactive")
 	}
+	return maxAgents, maxUsers, nil
+}
 
-	// Insert audit log entry
-	auditQuery := `
-		INSERT INTO license_audit_log (license_id, action, details, created_at)
-		VALUES ($1, 'upgraded', $2, NOW())
-	`
-	details := fmt.Sprintf(`{"new_tier": "%s", "max_agents": %d, "max_users": %d}`, newTier, maxAgents, maxUsers)
-	_, err = s.db.Exec(auditQuery, licenseID, details)
-	if err != nil {
-		log.Warnf("Failed to insert audit log: %v", err)
+// tierChangeDetails are the audit and webhook details of a tier change
+func tierChangeDetails(newTier models.LicenseTier, maxAgents, maxUsers int) map[string]interface{} {
+	return map[string]interface{}{
+		"new_tier":   newTier,
+		"max_agents": maxAgents,
+		"max_users":  maxUsers,
 	}
+}
 
-	log.Infof("Upgraded license %s to %s tier", licenseID, newTier)
-	return nil
+// tierChangeAction is the audit action of a tier change event
+func tierChangeAction(eventType string) string {
+	if eventType == EventLicenseDowngraded {
+		return "downgraded"
+	}
+	return "upgraded"
 }
 
 // ExtendLicense extends the expiration date
 func (s *LicenseService) ExtendLicense(licenseID string, additionalDays int) error {
-	// Update expiration date in database
-	query := `
+	if err := extendLicense(s.db, licenseID, additionalDays); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"additional_days": additionalDays}
+	if err := auditLicense(s.db, licenseID, "extended", details); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+
+	s.emitLicenseEvent(EventLicenseExtended, licenseID, details)
+
+	log.Infof("Extended license %s by %d days", licenseID, additionalDays)
+	return nil
+}
+
+// extendLicense moves an active license's expiry additionalDays further out
+func extendLicense(db dbExecer, licenseID string, additionalDays int) error {
+	result, err := db.Exec(`
 		UPDATE licenses
 		SET expires_at = COALESCE(expires_at, NOW()) + INTERVAL '1 day' * $1,
 		    updated_at = NOW()
 		WHERE id = $2 AND is_active = TRUE
-	`
-
-	result, err := s.db.Exec(query, additionalDays, licenseID)
+	`, additionalDays, licenseID)
 	if err != nil {
 		return fmt.Errorf("failed to extend license: %w", err)
 	}
@@ -518,18 +723,5 @@ func (s *LicenseService) ExtendLicense(licenseID string, additionalDays int) err
 	if rowsAffected == 0 {
 		return fmt.Errorf("license not found or inactive")
 	}
-
-	// Insert audit log entry
-	auditQuery := `
-		INSERT INTO license_audit_log (license_id, action, details, created_at)
-		VALUES ($1, 'extended', $2, NOW())
-	`
-	details := fmt.Sprintf(`{"additional_days": %d}`, additionalDays)
-	_, err = s.db.Exec(auditQuery, licenseID, details)
-	if err != nil {
-		log.Warnf("Failed to insert audit log: %v", err)
-	}
-
-	log.Infof("Extended license %s by %d days", licenseID, additionalDays)
 	return nil
 }
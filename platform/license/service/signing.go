@@ -0,0 +1,15 @@
+// Detached signing with the platform key, for artifacts other than licenses
+
+package service
+
+import "crypto/ed25519"
+
+// Sign returns the Ed25519 signature of data under the platform's license signing key
+func (s *LicenseService) Sign(data []byte) []byte {
+	return ed25519.Sign(s.privateKey, data)
+}
+
+// PublicKey returns the key third parties verify platform signatures with
+func (s *LicenseService) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
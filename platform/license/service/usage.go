@@ -0,0 +1,299 @@
+// License usage snapshots and seat overage detection
+
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+const (
+	// usageSnapshotRetention bounds how long usage snapshots are kept
+	usageSnapshotRetention = 365 * 24 * time.Hour
+
+	// maxUsageHistoryPoints caps the snapshots returned by a single history request
+	maxUsageHistoryPoints = 5000
+
+	// minOverageSnapshots is the number of snapshots needed before an overage counts as sustained
+	minOverageSnapshots = 2
+)
+
+// OverageNotifier sends a message to a license's notification channels. The API sends through
+// its notification channel delivery.
+type OverageNotifier func(licenseID, subject, message, priority string, details map[string]interface{})
+
+// SetOverageNotifier enables notifications when a license's sustained overage starts or ends
+func (s *LicenseService) SetOverageNotifier(notify OverageNotifier) {
+	s.overageNotifier = notify
+}
+
+// StartUsageSnapshotJob periodically records license usage and flags sustained seat overages
+func (s *LicenseService) StartUsageSnapshotJob(interval, overageWindow time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			captured, err := s.CaptureUsageSnapshots()
+			if err != nil {
+				log.Errorf("License usage snapshot failed: %v", err)
+				continue
+			}
+
+			detected, resolved, err := s.DetectOverages(overageWindow)
+			if err != nil {
+				log.Errorf("License overage detection failed: %v", err)
+				continue
+			}
+
+			log.Infof("License usage captured for %d licenses (%d overages detected, %d resolved)", captured, detected, resolved)
+		}
+	}()
+
+	log.Infof("License usage snapshot job started (interval: %v, overage window: %v)", interval, overageWindow)
+}
+
+// CaptureUsageSnapshots refreshes live usage counts and records a snapshot for every active license
+func (s *LicenseService) CaptureUsageSnapshots() (int, error) {
+	// Recount usage from the agents and users tables so license_usage reflects the current deployment
+	_, err := s.db.Exec(`
+		UPDATE license_usage lu
+		SET active_agents = (SELECT COUNT(*) FROM agents a WHERE a.license_id = lu.license_id AND a.status = 'active' AND a.deleted_at IS NULL),
+		    active_users = (SELECT COUNT(*) FROM users u WHERE u.license_id = lu.license_id AND u.is_active = TRUE),
+		    last_updated = NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh license usage: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO license_usage_snapshots (
+			license_id, active_agents, active_users, max_agents, max_users,
+			events_ingested, storage_used_gb, agents_over_cap, users_over_cap
+		)
+		SELECT l.id, lu.active_agents, lu.active_users, l.max_agents, l.max_users,
+		       lu.events_ingested, lu.storage_used_gb,
+		       l.max_agents >= 0 AND lu.active_agents > l.max_agents,
+		       l.max_users >= 0 AND lu.active_users > l.max_users
+		FROM licenses l
+		JOIN license_usage lu ON lu.license_id = l.id
+		WHERE l.is_active = TRUE
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert usage snapshots: %w", err)
+	}
+
+	captured, _ := result.RowsAffected()
+
+	if _, err := s.db.Exec(
+		`DELETE FROM license_usage_snapshots WHERE captured_at < $1`,
+		time.Now().Add(-usageSnapshotRetention),
+	); err != nil {
+		log.Warnf("Failed to prune usage snapshots: %v", err)
+	}
+
+	return int(captured), nil
+}
+
+// DetectOverages flags licenses whose every snapshot within the window exceeds a cap,
+// and clears the flag once the latest snapshot is back within limits
+func (s *LicenseService) DetectOverages(window time.Duration) (detected int, resolved int, err error) {
+	rows, err := s.db.Query(`
+		SELECT s.license_id,
+		       COUNT(*),
+		       bool_and(s.agents_over_cap OR s.users_over_cap),
+		       (array_agg(s.agents_over_cap OR s.users_over_cap ORDER BY s.captured_at DESC))[1],
+		       MAX(s.active_agents), MAX(s.max_agents), MAX(s.active_users), MAX(s.max_users),
+		       lu.overage_since
+		FROM license_usage_snapshots s
+		JOIN license_usage lu ON lu.license_id = s.license_id
+		WHERE s.captured_at >= $1
+		GROUP BY s.license_id, lu.overage_since
+	`, time.Now().Add(-window))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to evaluate overages: %w", err)
+	}
+
+	type overageState struct {
+		licenseID                                  string
+		snapshots                                  int
+		sustained, latestOver                      bool
+		peakAgents, maxAgents, peakUsers, maxUsers int
+		flagged                                    bool
+	}
+
+	states := []overageState{}
+	for rows.Next() {
+		var st overageState
+		var overageSince sql.NullTime
+		if err := rows.Scan(&st.licenseID, &st.snapshots, &st.sustained, &st.latestOver,
+			&st.peakAgents, &st.maxAgents, &st.peakUsers, &st.maxUsers, &overageSince); err != nil {
+			log.Warnf("Failed to scan overage state: %v", err)
+			continue
+		}
+		st.flagged = overageSince.Valid
+		states = append(states, st)
+	}
+	rows.Close()
+
+	for _, st := range states {
+		detailsMap := map[string]interface{}{
+			"window_hours": window.Hours(),
+			"snapshots":    st.snapshots,
+			"peak_agents":  st.peakAgents,
+			"max_agents":   st.maxAgents,
+			"peak_users":   st.peakUsers,
+			"max_users":    st.maxUsers,
+		}
+		details, _ := json.Marshal(detailsMap)
+
+		switch {
+		case !st.flagged && st.sustained && st.snapshots >= minOverageSnapshots:
+			if err := s.setOverage(st.licenseID, true, "overage_detected", string(details)); err != nil {
+				log.Errorf("Failed to flag overage for license %s: %v", st.licenseID, err)
+				continue
+			}
+			log.Warnf("License %s over its caps for %v (agents %d/%d, users %d/%d)",
+				st.licenseID, window, st.peakAgents, st.maxAgents, st.peakUsers, st.maxUsers)
+			s.notifyOverage(st.licenseID, "Privé license over its limits",
+				fmt.Sprintf("License %s has been over its limits for %v: %s. Remove unused agents or users, or upgrade the license.",
+					st.licenseID, window, overageSummary(st.peakAgents, st.maxAgents, st.peakUsers, st.maxUsers)),
+				"high", detailsMap)
+			detected++
+		case st.flagged && !st.latestOver:
+			if err := s.setOverage(st.licenseID, false, "overage_resolved", string(details)); err != nil {
+				log.Errorf("Failed to clear overage for license %s: %v", st.licenseID, err)
+				continue
+			}
+			log.Infof("License %s back within its caps", st.licenseID)
+			s.notifyOverage(st.licenseID, "Privé license back within its limits",
+				fmt.Sprintf("License %s is back within its agent and user limits.", st.licenseID), "low", detailsMap)
+			resolved++
+		}
+	}
+
+	return detected, resolved, nil
+}
+
+// notifyOverage tells the license's notification channels about an overage transition
+func (s *LicenseService) notifyOverage(licenseID, subject, message, priority string, details map[string]interface{}) {
+	if s.overageNotifier == nil {
+		return
+	}
+	details["source"] = "license_overage"
+	s.overageNotifier(licenseID, subject, message, priority, details)
+}
+
+// overageSummary lists the caps a license's peak usage exceeded
+func overageSummary(peakAgents, maxAgents, peakUsers, maxUsers int) string {
+	parts := []string{}
+	if maxAgents >= 0 && peakAgents > maxAgents {
+		parts = append(parts, fmt.Sprintf("%d agents of %d allowed", peakAgents, maxAgents))
+	}
+	if maxUsers >= 0 && peakUsers > maxUsers {
+		parts = append(parts, fmt.Sprintf("%d users of %d allowed", peakUsers, maxUsers))
+	}
+	if len(parts) == 0 {
+		return "usage above its caps"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// setOverage records the start or end of a sustained overage and audits the transition
+func (s *LicenseService) setOverage(licenseID string, over bool, action string, details string) error {
+	query := `UPDATE license_usage SET overage_since = NULL WHERE license_id = $1`
+	if over {
+		query = `UPDATE license_usage SET overage_since = NOW() WHERE license_id = $1`
+	}
+	if _, err := s.db.Exec(query, licenseID); err != nil {
+		return err
+	}
+
+	auditQuery := `
+		INSERT INTO license_audit_log (license_id, action, details, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`
+	if _, err := s.db.Exec(auditQuery, licenseID, action, details); err != nil {
+		log.Warnf("Failed to insert audit log: %v", err)
+	}
+
+	return nil
+}
+
+// GetUsageHistory returns the usage time series for a license between start and end
+func (s *LicenseService) GetUsageHistory(licenseID string, start, end time.Time) (*models.LicenseUsageHistory, error) {
+	history := &models.LicenseUsageHistory{
+		LicenseID: licenseID,
+		Start:     start,
+		End:       end,
+		Snapshots: []models.LicenseUsageSnapshot{},
+	}
+
+	var overageSince sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT lu.overage_since
+		FROM licenses l
+		LEFT JOIN license_usage lu ON lu.license_id = l.id
+		WHERE l.id = $1
+	`, licenseID).Scan(&overageSince)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("license not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if overageSince.Valid {
+		history.OverageDetected = true
+		history.OverageSince = &overageSince.Time
+	}
+
+	rows, err := s.db.Query(`
+		SELECT active_agents, active_users, max_agents, max_users, events_ingested,
+		       storage_used_gb, agents_over_cap, users_over_cap, captured_at
+		FROM license_usage_snapshots
+		WHERE license_id = $1 AND captured_at >= $2 AND captured_at <= $3
+		ORDER BY captured_at ASC
+		LIMIT $4
+	`, licenseID, start, end, maxUsageHistoryPoints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage history: %w", err)
+	}
+	defer rows.Close()
+
+	var maxAgents, maxUsers int
+	for rows.Next() {
+		var snap models.LicenseUsageSnapshot
+		if err := rows.Scan(&snap.ActiveAgents, &snap.ActiveUsers, &snap.MaxAgents, &snap.MaxUsers,
+			&snap.EventsIngested, &snap.StorageUsedGB, &snap.AgentsOverCap, &snap.UsersOverCap, &snap.CapturedAt); err != nil {
+			log.Warnf("Failed to scan usage snapshot: %v", err)
+			continue
+		}
+
+		if snap.ActiveAgents > history.PeakAgents {
+			history.PeakAgents = snap.ActiveAgents
+		}
+		if snap.ActiveUsers > history.PeakUsers {
+			history.PeakUsers = snap.ActiveUsers
+		}
+		maxAgents, maxUsers = snap.MaxAgents, snap.MaxUsers
+
+		history.Snapshots = append(history.Snapshots, snap)
+	}
+
+	// Utilisation is measured against the most recent caps; unlimited (-1) caps report 0
+	if maxAgents > 0 {
+		history.AgentUtilization = float64(history.PeakAgents) / float64(maxAgents)
+	}
+	if maxUsers > 0 {
+		history.UserUtilization = float64(history.PeakUsers) / float64(maxUsers)
+	}
+
+	return history, nil
+}
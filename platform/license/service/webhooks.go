@@ -0,0 +1,264 @@
+// License lifecycle webhooks for billing and CRM systems
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sentinel-enterprise/platform/license/models"
+)
+
+// License lifecycle event types
+const (
+	EventLicenseCreated     = "license.created"
+	EventLicenseUpgraded    = "license.upgraded"
+	EventLicenseDowngraded  = "license.downgraded"
+	EventLicenseExtended    = "license.extended"
+	EventLicenseRevoked     = "license.revoked"
+	EventLicenseReactivated = "license.reactivated"
+	EventLicenseExpiring    = "license.expiring"
+	EventLicenseExpired     = "license.expired"
+)
+
+const (
+	// webhookMaxAttempts is the number of delivery attempts before a webhook is marked failed
+	webhookMaxAttempts = 8
+
+	// webhookBatchSize caps deliveries attempted per dispatcher pass
+	webhookBatchSize = 100
+
+	// expiringNoticeDays is how far ahead of expiry the license.expiring event fires
+	expiringNoticeDays = 14
+)
+
+// License states reported in lifecycle events
+const (
+	LicenseStatusActive   = "active"
+	LicenseStatusInactive = "inactive"
+	LicenseStatusExpired  = "expired"
+)
+
+// WebhookSender delivers one lifecycle event payload, returning an error if the receiver did not
+// accept it. The API sends through the notification webhook delivery, which signs the request.
+type WebhookSender func(eventType, deliveryID string, payload []byte) error
+
+// LicenseEvent is the webhook payload for a license lifecycle change
+type LicenseEvent struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	License    *LicenseSummary        `json:"license,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// LicenseSummary is the license state sent to billing and CRM systems. It leaves out the signed
+// license key and customer contact details.
+type LicenseSummary struct {
+	ID        string             `json:"id"`
+	Tier      models.LicenseTier `json:"tier"`
+	Status    string             `json:"status"`
+	ExpiresAt *time.Time         `json:"expires_at"`
+	MaxAgents int                `json:"max_agents"`
+	MaxUsers  int                `json:"max_users"`
+}
+
+// summarizeLicense returns the lifecycle event view of a license
+func summarizeLicense(license *models.License, now time.Time) *LicenseSummary {
+	status := LicenseStatusActive
+	switch {
+	case !license.IsActive:
+		status = LicenseStatusInactive
+	case license.ExpiresAt != nil && !license.ExpiresAt.After(now):
+		status = LicenseStatusExpired
+	}
+	return &LicenseSummary{
+		ID:        license.ID,
+		Tier:      license.Tier,
+		Status:    status,
+		ExpiresAt: license.ExpiresAt,
+		MaxAgents: license.MaxAgents,
+		MaxUsers:  license.MaxUsers,
+	}
+}
+
+// SetWebhookSender enables license lifecycle webhooks, delivered through send
+func (s *LicenseService) SetWebhookSender(send WebhookSender) {
+	s.webhookSender = send
+}
+
+// emitLicenseEvent queues a lifecycle event for delivery. The current license state is
+// captured at emit time so the receiver sees what the change produced.
+func (s *LicenseService) emitLicenseEvent(eventType, licenseID string, details map[string]interface{}) {
+	s.queueLicenseEvent(eventType, licenseID, "", details)
+}
+
+// queueLicenseEvent writes the event to the delivery outbox; a non-empty dedupKey makes the insert idempotent
+func (s *LicenseService) queueLicenseEvent(eventType, licenseID, dedupKey string, details map[string]interface{}) {
+	if s.webhookSender == nil {
+		return
+	}
+
+	event := LicenseEvent{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Details:    details,
+	}
+	if license, err := s.GetLicense(licenseID); err == nil {
+		event.License = summarizeLicense(license, event.OccurredAt)
+	} else {
+		log.Warnf("Failed to load license %s for %s webhook: %v", licenseID, eventType, err)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("Failed to marshal %s webhook: %v", eventType, err)
+		return
+	}
+
+	var dedup interface{}
+	if dedupKey != "" {
+		dedup = dedupKey
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO license_webhook_deliveries (id, license_id, event_type, dedup_key, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (dedup_key) DO NOTHING
+	`, event.ID, licenseID, eventType, dedup, string(payload))
+	if err != nil {
+		log.Errorf("Failed to queue %s webhook for license %s: %v", eventType, licenseID, err)
+	}
+}
+
+// StartWebhookDispatcher delivers queued lifecycle webhooks and raises expiry events in the
+// background. Undelivered events stay queued, so none are lost while the receiver is down.
+func (s *LicenseService) StartWebhookDispatcher(interval time.Duration) {
+	if s.webhookSender == nil {
+		log.Info("License webhook not configured, lifecycle webhooks disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.queueExpiryEvents()
+
+			delivered, failed := s.DeliverPendingWebhooks()
+			if delivered > 0 || failed > 0 {
+				log.Infof("License webhooks: %d delivered, %d failed attempts", delivered, failed)
+			}
+		}
+	}()
+
+	log.Infof("License webhook dispatcher started (interval: %v)", interval)
+}
+
+// queueExpiryEvents emits license.expiring and license.expired once per expiry date
+func (s *LicenseService) queueExpiryEvents() {
+	rows, err := s.db.Query(`
+		SELECT id, expires_at, expires_at <= NOW()
+		FROM licenses
+		WHERE is_active = TRUE AND expires_at IS NOT NULL
+		  AND expires_at <= NOW() + INTERVAL '1 day' * $1
+		  AND expires_at > NOW() - INTERVAL '1 day'
+	`, expiringNoticeDays)
+	if err != nil {
+		log.Errorf("Failed to scan expiring licenses: %v", err)
+		return
+	}
+
+	type expiring struct {
+		id        string
+		expiresAt time.Time
+		expired   bool
+	}
+	licenses := []expiring{}
+	for rows.Next() {
+		var l expiring
+		if err := rows.Scan(&l.id, &l.expiresAt, &l.expired); err != nil {
+			continue
+		}
+		licenses = append(licenses, l)
+	}
+	rows.Close()
+
+	for _, l := range licenses {
+		eventType := EventLicenseExpiring
+		if l.expired {
+			eventType = EventLicenseExpired
+		}
+		// Keyed on the expiry date so an extension re-arms the events
+		dedupKey := fmt.Sprintf("%s:%s:%d", eventType, l.id, l.expiresAt.Unix())
+		s.queueLicenseEvent(eventType, l.id, dedupKey, map[string]interface{}{
+			"expires_at":     l.expiresAt.UTC(),
+			"days_remaining": int(time.Until(l.expiresAt).Hours() / 24),
+		})
+	}
+}
+
+// DeliverPendingWebhooks attempts every due delivery once, rescheduling failures with exponential backoff
+func (s *LicenseService) DeliverPendingWebhooks() (delivered int, failed int) {
+	rows, err := s.db.Query(`
+		SELECT id, event_type, payload, attempts
+		FROM license_webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY created_at ASC
+		LIMIT $1
+	`, webhookBatchSize)
+	if err != nil {
+		log.Errorf("Failed to load pending license webhooks: %v", err)
+		return 0, 0
+	}
+
+	type delivery struct {
+		id        string
+		eventType string
+		payload   []byte
+		attempts  int
+	}
+	pending := []delivery{}
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.id, &d.eventType, &d.payload, &d.attempts); err != nil {
+			continue
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+
+	for _, d := range pending {
+		attempts := d.attempts + 1
+		if err := s.webhookSender(d.eventType, d.id, d.payload); err != nil {
+			failed++
+			status := "pending"
+			if attempts >= webhookMaxAttempts {
+				status = "failed"
+				log.Errorf("License webhook %s (%s) failed permanently: %v", d.id, d.eventType, err)
+			}
+			backoff := time.Duration(1<<uint(attempts)) * time.Minute
+			s.db.Exec(`
+				UPDATE license_webhook_deliveries
+				SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5
+				WHERE id = $1
+			`, d.id, status, attempts, err.Error(), time.Now().Add(backoff))
+			continue
+		}
+
+		delivered++
+		s.db.Exec(`
+			UPDATE license_webhook_deliveries
+			SET status = 'delivered', attempts = $2, last_error = NULL, delivered_at = NOW()
+			WHERE id = $1
+		`, d.id, attempts)
+	}
+
+	return delivered, failed
+}
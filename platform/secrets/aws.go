@@ -0,0 +1,101 @@
+// AWS Secrets Backend
+// Stores secrets in AWS Secrets Manager, encrypted with a customer-managed KMS key when set
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// AWSProvider stores each secret as <prefix><name> in Secrets Manager. Credentials come from
+// the default AWS chain (environment, instance profile, IRSA).
+type AWSProvider struct {
+	client   *secretsmanager.Client
+	kmsKeyID string
+	prefix   string
+}
+
+// NewAWSProvider creates a Secrets Manager provider
+func NewAWSProvider(ctx context.Context, region, kmsKeyID, prefix string) (*AWSProvider, error) {
+	opts := []func(*config.LoadOptions) error{}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if prefix == "" {
+		prefix = "sentinel/"
+	}
+	return &AWSProvider{
+		client:   secretsmanager.NewFromConfig(cfg),
+		kmsKeyID: kmsKeyID,
+		prefix:   prefix,
+	}, nil
+}
+
+// Name returns the backend name
+func (p *AWSProvider) Name() string {
+	return BackendAWS
+}
+
+// Get reads the current version of the secret
+func (p *AWSProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.prefix + name),
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil, err
+	}
+	if out.SecretBinary != nil {
+		return out.SecretBinary, nil
+	}
+	return []byte(aws.ToString(out.SecretString)), nil
+}
+
+// Put stores a new version of the secret, creating it on first use
+func (p *AWSProvider) Put(ctx context.Context, name string, value []byte) error {
+	_, err := p.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(p.prefix + name),
+		SecretBinary: value,
+	})
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(p.prefix + name),
+		SecretBinary: value,
+	}
+	if p.kmsKeyID != "" {
+		input.KmsKeyId = aws.String(p.kmsKeyID)
+	}
+	_, err = p.client.CreateSecret(ctx, input)
+	return err
+}
+
+// Delete removes the secret immediately rather than after the recovery window
+func (p *AWSProvider) Delete(ctx context.Context, name string) error {
+	_, err := p.client.DeleteSecret(ctx, &secretsmanager.DeleteSecretInput{
+		SecretId:                   aws.String(p.prefix + name),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+// File Secrets Backend
+// Reads secrets from local files; suitable for development and mounted Kubernetes secrets
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider stores each secret as a file under a directory
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider creates a file provider rooted at dir. An empty dir gives a read-only
+// provider that reads names as file paths.
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+// Name returns the backend name
+func (p *FileProvider) Name() string {
+	return BackendFile
+}
+
+// Get reads the secret file. Absolute names, and all names when no directory is configured,
+// are read as paths so existing *_PATH settings keep working.
+func (p *FileProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	path, err := p.path(name, true)
+	if err != nil {
+		return nil, err
+	}
+	value, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, err
+}
+
+// Put writes the secret with owner-only permissions
+func (p *FileProvider) Put(ctx context.Context, name string, value []byte) error {
+	if p.dir == "" {
+		return ErrReadOnly
+	}
+	path, err := p.path(name, false)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial secret
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, value, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Delete removes the secret file
+func (p *FileProvider) Delete(ctx context.Context, name string) error {
+	if p.dir == "" {
+		return ErrReadOnly
+	}
+	path, err := p.path(name, false)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path maps a secret name into the directory, rejecting names that escape it
+func (p *FileProvider) path(name string, allowPath bool) (string, error) {
+	if filepath.IsAbs(name) || p.dir == "" {
+		if !allowPath {
+			return "", fmt.Errorf("invalid secret name: %s", name)
+		}
+		return name, nil
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid secret name: %s", name)
+	}
+	return filepath.Join(p.dir, clean), nil
+}
@@ -0,0 +1,185 @@
+// Pluggable Secrets Backends
+// Resolves license signing keys, AI provider keys and storage credentials from files,
+// HashiCorp Vault or AWS Secrets Manager
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported backends
+const (
+	BackendFile  = "file"
+	BackendVault = "vault"
+	BackendAWS   = "aws"
+)
+
+// RefPrefix marks a database value as a reference to a secret held by the provider rather
+// than the secret itself: "secret://ai/<license_id>/openai_key"
+const RefPrefix = "secret://"
+
+var (
+	// ErrNotFound is returned when the named secret does not exist
+	ErrNotFound = errors.New("secret not found")
+
+	// ErrReadOnly is returned by providers that cannot store secrets. Callers keep the value
+	// inline in that case.
+	ErrReadOnly = errors.New("secret provider is read-only")
+)
+
+// SecretProvider reads and writes named secrets in a backing store
+type SecretProvider interface {
+	Name() string
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, value []byte) error
+	Delete(ctx context.Context, name string) error
+}
+
+// Config selects and configures the secrets backend
+type Config struct {
+	Backend  string        // file (default), vault or aws
+	CacheTTL time.Duration // Resolved secrets are cached this long; 0 disables caching
+
+	// File backend: relative names are read from Dir. Without Dir the backend is read-only
+	// and names are file paths.
+	Dir string
+
+	// Vault backend (KV version 2)
+	VaultAddr   string
+	VaultToken  string
+	VaultMount  string // default "secret"
+	VaultPrefix string // default "sentinel"
+
+	// AWS backend (Secrets Manager, encrypted with the given KMS key when set)
+	AWSRegion   string
+	AWSKMSKeyID string
+	AWSPrefix   string // default "sentinel/"
+}
+
+// New creates the provider selected by cfg
+func New(ctx context.Context, cfg Config) (SecretProvider, error) {
+	var provider SecretProvider
+	var err error
+
+	switch cfg.Backend {
+	case "", BackendFile:
+		provider = NewFileProvider(cfg.Dir)
+	case BackendVault:
+		provider, err = NewVaultProvider(cfg.VaultAddr, cfg.VaultToken, cfg.VaultMount, cfg.VaultPrefix)
+	case BackendAWS:
+		provider, err = NewAWSProvider(ctx, cfg.AWSRegion, cfg.AWSKMSKeyID, cfg.AWSPrefix)
+	default:
+		return nil, fmt.Errorf("unsupported secrets backend: %s", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheTTL > 0 {
+		provider = newCachedProvider(provider, cfg.CacheTTL)
+	}
+	return provider, nil
+}
+
+// Ref returns the database reference for a named secret
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// IsRef reports whether a stored value is a secret reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Resolve returns the secret a stored value refers to. Values that are not references are
+// legacy inline secrets and are returned unchanged.
+func Resolve(ctx context.Context, provider SecretProvider, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	if provider == nil {
+		return "", fmt.Errorf("secret %s referenced but no secret provider is configured", value)
+	}
+	secret, err := provider.Get(ctx, strings.TrimPrefix(value, RefPrefix))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Store saves a secret under name and returns the value to persist in the database: a
+// reference, or the secret itself when no writable provider is configured.
+func Store(ctx context.Context, provider SecretProvider, name, value string) (string, error) {
+	if value == "" || provider == nil {
+		return value, nil
+	}
+	if err := provider.Put(ctx, name, []byte(value)); err != nil {
+		if errors.Is(err, ErrReadOnly) {
+			return value, nil
+		}
+		return "", fmt.Errorf("failed to store secret %s: %w", name, err)
+	}
+	return Ref(name), nil
+}
+
+// cachedProvider keeps resolved secrets in memory to avoid a backend round trip per request
+type cachedProvider struct {
+	SecretProvider
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value     []byte
+	fetchedAt time.Time
+}
+
+func newCachedProvider(provider SecretProvider, ttl time.Duration) *cachedProvider {
+	return &cachedProvider{
+		SecretProvider: provider,
+		ttl:            ttl,
+		cache:          make(map[string]cachedSecret),
+	}
+}
+
+func (p *cachedProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	p.mu.Lock()
+	entry, ok := p.cache[name]
+	p.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < p.ttl {
+		return entry.value, nil
+	}
+
+	value, err := p.SecretProvider.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[name] = cachedSecret{value: value, fetchedAt: time.Now()}
+	p.mu.Unlock()
+	return value, nil
+}
+
+func (p *cachedProvider) Put(ctx context.Context, name string, value []byte) error {
+	p.invalidate(name)
+	return p.SecretProvider.Put(ctx, name, value)
+}
+
+func (p *cachedProvider) Delete(ctx context.Context, name string) error {
+	p.invalidate(name)
+	return p.SecretProvider.Delete(ctx, name)
+}
+
+func (p *cachedProvider) invalidate(name string) {
+	p.mu.Lock()
+	delete(p.cache, name)
+	p.mu.Unlock()
+}
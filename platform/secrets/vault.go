@@ -0,0 +1,132 @@
+// HashiCorp Vault Secrets Backend
+// Stores secrets in a KV version 2 engine over Vault's HTTP API
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// VaultProvider stores each secret at <mount>/data/<prefix>/<name>. The secret's "value" field
+// holds the data; binary values are base64 encoded and flagged with "encoding": "base64".
+type VaultProvider struct {
+	addr   string
+	token  string
+	mount  string
+	prefix string
+	client *http.Client
+}
+
+// NewVaultProvider creates a Vault KV v2 provider
+func NewVaultProvider(addr, token, mount, prefix string) (*VaultProvider, error) {
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault backend requires VAULT_ADDR and VAULT_TOKEN")
+	}
+	if mount == "" {
+		mount = "secret"
+	}
+	if prefix == "" {
+		prefix = "sentinel"
+	}
+	return &VaultProvider{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		prefix: strings.Trim(prefix, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns the backend name
+func (p *VaultProvider) Name() string {
+	return BackendVault
+}
+
+// Get reads the latest version of the secret
+func (p *VaultProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := p.do(ctx, http.MethodGet, "data", name, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	value, ok := resp.Data.Data["value"]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s has no value field", name)
+	}
+	if resp.Data.Data["encoding"] == "base64" {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
+
+// Put writes a new version of the secret
+func (p *VaultProvider) Put(ctx context.Context, name string, value []byte) error {
+	data := map[string]string{"value": string(value)}
+	if !utf8.Valid(value) {
+		data = map[string]string{"value": base64.StdEncoding.EncodeToString(value), "encoding": "base64"}
+	}
+	return p.do(ctx, http.MethodPost, "data", name, map[string]interface{}{"data": data}, nil)
+}
+
+// Delete removes the secret and all of its versions
+func (p *VaultProvider) Delete(ctx context.Context, name string) error {
+	err := p.do(ctx, http.MethodDelete, "metadata", name, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (p *VaultProvider) do(ctx context.Context, method, kind, name string, body, out interface{}) error {
+	url := fmt.Sprintf("%s/v1/%s/%s/%s/%s", p.addr, p.mount, kind, p.prefix, strings.TrimLeft(name, "/"))
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 -- ClickHouse Schema for Sentinel-Enterprise EDR/DLP Platform
 -- Optimized for high-throughput ingestion (10,000+ events/sec) and fast analytical queries
--- Retention: Configurable via TTL (default: 90 days)
+-- Retention: telemetry_events is expired by the API retention job from per-license hot_storage_days
 
 -- Drop existing table if re-deploying (CAUTION: data loss)
 -- DROP TABLE IF EXISTS telemetry_events;
 
 -- Main telemetry events table using MergeTree engine
 -- Partitioned by month for efficient data management and pruning
+-- The consumer creates this table and its indexes on startup from consumer/telemetry_events.sql;
+-- changes to its columns or indexes here must be made there too
 CREATE TABLE IF NOT EXISTS telemetry_events
 (
     -- Event identification and timing
@@ -45,6 +47,7 @@ CREATE TABLE IF NOT EXISTS telemetry_events
     --   FILE_ACCESS: {"path":"...","operation":"read","hash":"...","size":1024}
     --   NETWORK_CONN: {"src_ip":"...","dst_ip":"...","dst_port":443,"protocol":"tcp"}
     --   DLP_VIOLATION: {"rule_id":"...","matched_pattern":"...","file_path":"..."}
+    --   AUTHENTICATION: {"user":"...","src_ip":"...","result":"success","logon_type":"..."}
     payload             String,
 
     -- Extracted fields for fast filtering (materialized from JSON payload)
@@ -55,17 +58,33 @@ CREATE TABLE IF NOT EXISTS telemetry_events
     dst_port            UInt16 MATERIALIZED JSONExtractUInt(payload, 'dst_port'),
     username            String MATERIALIZED JSONExtractString(payload, 'user'),
 
+    -- Enrichment columns (populated by the consumer at write time)
+    dst_country         LowCardinality(String) DEFAULT '',  -- ISO country code of dst_ip
+    dst_asn             UInt32 DEFAULT 0,                   -- Autonomous system number of dst_ip
+    dst_as_org          LowCardinality(String) DEFAULT '',  -- AS organisation name
+    dst_hostname        String DEFAULT '',                  -- Reverse DNS of dst_ip (if enabled)
+    process_reputation  LowCardinality(String) DEFAULT '',  -- unknown, known_good, malicious
+    src_country         LowCardinality(String) DEFAULT '',  -- ISO country code of src_ip (logins)
+
+    -- Integrity ledger batch the event was written in (see telemetry_ledger)
+    batch_id            UUID DEFAULT toUUID('00000000-0000-0000-0000-000000000000'),
+
+    -- Set when a redaction rule masked part of the payload before storage
+    redacted            Bool DEFAULT false,
+
+    -- Set when the ingestor clamped an out-of-bounds agent timestamp to server time;
+    -- agent_timestamp keeps the agent's clock reading and otherwise equals timestamp
+    agent_timestamp     DateTime64(3) DEFAULT timestamp,
+    timestamp_clamped   Bool DEFAULT false,
+
     -- Indexing metadata
     ingestion_date      Date MATERIALIZED toDate(server_timestamp)
 )
 ENGINE = MergeTree()
-PARTITION BY toYYYYMM(timestamp)  -- Monthly partitions for efficient TTL and queries
+PARTITION BY toYYYYMM(timestamp)  -- Monthly partitions the API retention job drops once expired and archived
 ORDER BY (tenant_id, timestamp, event_type, agent_id, event_id)
-TTL timestamp + INTERVAL 90 DAY   -- Auto-delete events older than 90 days
 SETTINGS
     index_granularity = 8192,               -- Default granularity (good for most workloads)
-    ttl_only_drop_parts = 1,                -- Drop entire partitions when TTL expires (faster)
-    merge_with_ttl_timeout = 3600,          -- Merge parts with expired TTL hourly
     min_bytes_for_wide_part = 10485760,     -- Use wide format for parts >10MB (better compression)
     min_rows_for_wide_part = 100000;
 
@@ -77,6 +96,60 @@ ALTER TABLE telemetry_events ADD INDEX idx_mitre_technique mitre_technique TYPE
 ALTER TABLE telemetry_events ADD INDEX idx_hostname hostname TYPE bloom_filter(0.01) GRANULARITY 4;
 ALTER TABLE telemetry_events ADD INDEX idx_process process_name TYPE bloom_filter(0.01) GRANULARITY 4;
 
+-- Enrichment columns for deployments created before write-time enrichment
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_country LowCardinality(String) DEFAULT '' AFTER username;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_asn UInt32 DEFAULT 0 AFTER dst_country;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_as_org LowCardinality(String) DEFAULT '' AFTER dst_asn;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS dst_hostname String DEFAULT '' AFTER dst_as_org;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS process_reputation LowCardinality(String) DEFAULT '' AFTER dst_hostname;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS src_country LowCardinality(String) DEFAULT '' AFTER process_reputation;
+
+-- Set index for reputation filtering (e.g. alerting on malicious processes)
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_process_reputation process_reputation TYPE set(10) GRANULARITY 4;
+
+-- Ledger batch column for deployments created before hash chaining
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS batch_id UUID DEFAULT toUUID('00000000-0000-0000-0000-000000000000') AFTER src_country;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_batch_id batch_id TYPE bloom_filter(0.01) GRANULARITY 4;
+
+-- Redaction flag for deployments created before payload redaction
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS redacted Bool DEFAULT false AFTER batch_id;
+
+-- Clamped timestamp columns for deployments created before ingest timestamp bounds
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS agent_timestamp DateTime64(3) DEFAULT timestamp AFTER redacted;
+ALTER TABLE telemetry_events ADD COLUMN IF NOT EXISTS timestamp_clamped Bool DEFAULT false AFTER agent_timestamp;
+
+-- Bloom filter indexes for IOC sweeps (POST /api/v1/telemetry/ioc-sweep). The expressions must
+-- match iocSweepColumns in the API exactly, or the sweep falls back to scanning. Existing parts are
+-- only indexed after ALTER TABLE telemetry_events MATERIALIZE INDEX <name>.
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_dst_ip dst_ip TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_src_ip JSONExtractString(payload, 'src_ip') TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_dst_hostname lower(dst_hostname) TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_domain lower(JSONExtractString(payload, 'domain')) TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_ioc_hash lower(JSONExtractString(payload, 'hash')) TYPE bloom_filter(0.01) GRANULARITY 4;
+
+-- Data-skipping indexes for the remaining telemetry query filters (eventQueryFilters in the API).
+-- event_type and agent_id are in the sort key, but behind timestamp, so the primary index only
+-- prunes on them within a single millisecond; these indexes skip granules for them across the
+-- queried range instead. Existing parts are only indexed after MATERIALIZE INDEX <name>.
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_severity severity TYPE minmax GRANULARITY 1;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_event_type event_type TYPE set(16) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_agent_id agent_id TYPE bloom_filter(0.01) GRANULARITY 4;
+ALTER TABLE telemetry_events ADD INDEX IF NOT EXISTS idx_file_path file_path TYPE bloom_filter(0.01) GRANULARITY 4;
+-- dst_ip filters use idx_ioc_dst_ip above
+
+-- Expected plans for POST /api/v1/telemetry/query (check with EXPLAIN indexes = 1 <query>):
+--   MinMax     timestamp range                    -> drops whole months outside the range
+--   Partition  toYYYYMM(timestamp)                -> same parts as MinMax
+--   PrimaryKey tenant_id, timestamp               -> granules of other tenants and outside the range
+--   Skip       idx_event_type, idx_agent_id,      -> only the indexes whose columns are filtered on
+--              idx_hostname, idx_process, idx_severity, idx_mitre_*, idx_file_path, idx_ioc_dst_ip
+-- search_text (positionCaseInsensitive on payload) is never index-assisted; it is always the last
+-- predicate so it only runs on granules the indexes above kept. A plan whose PrimaryKey step keeps
+-- every granule of the range means the query lost its tenant_id/timestamp anchor.
+
+-- Tenant custom fields add cf_<type>_<key>_<hash> MATERIALIZED columns (and idx_cf_* indexes) at
+-- runtime through POST /api/v1/telemetry/custom-fields; they are not declared here
+
 -- Create materialized view for real-time aggregations (optional - for dashboard performance)
 CREATE MATERIALIZED VIEW IF NOT EXISTS events_hourly
 ENGINE = SummingMergeTree()
@@ -92,6 +165,199 @@ AS SELECT
 FROM telemetry_events
 GROUP BY tenant_id, event_hour, event_type, hostname;
 
+-- Hourly statistics rollup backing the dashboard statistics endpoint
+-- Counts are pre-summed and unique agent/host counts stored as mergeable uniq states,
+-- so any range of whole hours can be answered without scanning telemetry_events. The API
+-- retention job expires it together with telemetry_events, per license and around legal holds.
+CREATE TABLE IF NOT EXISTS telemetry_stats_hourly
+(
+    tenant_id           String,
+    event_hour          DateTime,
+    event_type          LowCardinality(String),
+    severity            UInt8,
+    mitre_tactic        LowCardinality(String),
+    event_count         SimpleAggregateFunction(sum, UInt64),
+    agents_state        AggregateFunction(uniq, String),
+    hosts_state         AggregateFunction(uniq, LowCardinality(String))
+)
+ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(event_hour)
+ORDER BY (tenant_id, event_hour, event_type, severity, mitre_tactic);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_stats_hourly_mv
+TO telemetry_stats_hourly
+AS SELECT
+    tenant_id,
+    toStartOfHour(timestamp) AS event_hour,
+    toString(event_type) AS event_type,
+    severity,
+    mitre_tactic,
+    count() AS event_count,
+    uniqState(agent_id) AS agents_state,
+    uniqState(hostname) AS hosts_state
+FROM telemetry_events
+GROUP BY tenant_id, event_hour, event_type, severity, mitre_tactic;
+
+-- Backfill the rollup for events ingested before the view existed (run once):
+-- INSERT INTO telemetry_stats_hourly
+-- SELECT tenant_id, toStartOfHour(timestamp) AS event_hour, toString(event_type) AS event_type,
+--        severity, mitre_tactic, count(), uniqState(agent_id), uniqState(hostname)
+-- FROM telemetry_events
+-- GROUP BY tenant_id, event_hour, event_type, severity, mitre_tactic;
+
+-- Per-license sampling and aggregation policies for high-volume, low-value event types
+-- Managed through /api/v1/telemetry/sampling and applied by the consumer before insert;
+-- a row with deleted = 1 removes the policy
+CREATE TABLE IF NOT EXISTS sampling_policies
+(
+    tenant_id           String,
+    event_type          LowCardinality(String),  -- telemetry_events.event_type name, e.g. file_access
+    mode                Enum8('sample' = 1, 'aggregate' = 2),
+    sample_rate         UInt32 DEFAULT 1,        -- sample: keep 1 in sample_rate events
+    keep_min_severity   UInt8 DEFAULT 2,         -- Events at or above this severity are always stored
+    updated_by          String DEFAULT '',
+    updated_at          DateTime64(3) DEFAULT now64(3),
+    deleted             UInt8 DEFAULT 0
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (tenant_id, event_type);
+
+-- Per-license payload redaction rules, managed through /api/v1/telemetry/redaction and applied
+-- by the consumer before insert. A rule uses a built-in preset or an RE2 pattern, optionally
+-- limited to payload fields; a rule with only fields masks those fields entirely. A row with
+-- deleted = 1 removes the rule.
+CREATE TABLE IF NOT EXISTS redaction_rules
+(
+    tenant_id           String,
+    rule_id             String,
+    name                String,
+    preset              LowCardinality(String) DEFAULT '',  -- password, token, aws_access_key, ...
+    pattern             String DEFAULT '',
+    fields              Array(String) DEFAULT [],
+    replacement         String DEFAULT '',                  -- Empty uses [REDACTED]
+    enabled             UInt8 DEFAULT 1,
+    updated_by          String DEFAULT '',
+    updated_at          DateTime64(3) DEFAULT now64(3),
+    deleted             UInt8 DEFAULT 0
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (tenant_id, rule_id);
+
+-- License validity replicated from PostgreSQL by the API every minute, so the consumer can
+-- refuse events of unknown, revoked or expired licenses without a database of its own. A row
+-- with deleted = 1 marks a license that no longer exists.
+CREATE TABLE IF NOT EXISTS license_status
+(
+    tenant_id           String,
+    active              UInt8,
+    expires_at          Nullable(DateTime64(3)),  -- NULL for perpetual licenses
+    deleted             UInt8 DEFAULT 0,
+    updated_at          DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY tenant_id;
+
+-- Legal holds replicated from PostgreSQL by the API when they are placed or released, so the
+-- consumer leaves held events alone when it reprocesses stored telemetry
+CREATE TABLE IF NOT EXISTS legal_holds
+(
+    tenant_id           String,
+    hold_id             String,
+    start_time          DateTime64(3),
+    end_time            DateTime64(3),
+    active              UInt8,
+    updated_at          DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (tenant_id, hold_id);
+
+-- Per-minute counts of events the consumer did not store individually because of a sampling
+-- or aggregation policy. Stored events plus these counts give the true event volume.
+CREATE TABLE IF NOT EXISTS telemetry_rollups
+(
+    tenant_id           String,
+    agent_id            String,
+    hostname            LowCardinality(String),
+    event_type          LowCardinality(String),
+    process_name        String,
+    minute              DateTime,
+    event_count         UInt64
+)
+ENGINE = SummingMergeTree(event_count)
+PARTITION BY toYYYYMM(minute)
+ORDER BY (tenant_id, event_type, minute, agent_id, hostname, process_name)
+TTL minute + INTERVAL 90 DAY;
+
+-- Raw log lines agents ship through POST /api/v1/logs (syslog, journald, event log text, agent
+-- diagnostics). Written by the API directly, never through NATS and the consumer, so log volume
+-- cannot delay structured events. The ngram index on lower(message) serves substring search.
+-- The API retention job expires lines after 30 days, except those under legal hold.
+CREATE TABLE IF NOT EXISTS agent_logs
+(
+    log_id              UUID DEFAULT generateUUIDv4(),
+    tenant_id           String,
+    agent_id            String,
+    hostname            LowCardinality(String),
+    timestamp           DateTime64(3),
+    received_at         DateTime64(3) DEFAULT now64(3),
+    source              LowCardinality(String),  -- e.g. syslog, journald, eventlog, agent
+    level               LowCardinality(String),  -- debug, info, notice, warning, error, critical; '' when unknown
+    message             String CODEC(ZSTD(3)),
+
+    INDEX idx_message_ngrams lower(message) TYPE ngrambf_v1(4, 65536, 3, 0) GRANULARITY 1,
+    INDEX idx_level level TYPE set(10) GRANULARITY 4
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(timestamp)
+ORDER BY (tenant_id, agent_id, timestamp);
+
+-- Tamper-evidence ledger written by the consumer when INTEGRITY_CHAIN is enabled. Each row covers
+-- one tenant's events of one inserted batch: events_hash is the SHA-256 over the batch's event
+-- hashes and chain_hash = SHA-256(prev_hash, entry fields, events_hash), so deleting or editing
+-- stored events, or ledger rows, breaks the chain. Kept beyond event retention on purpose.
+CREATE TABLE IF NOT EXISTS telemetry_ledger
+(
+    chain_id            String,                  -- Writing consumer instance
+    tenant_id           String,
+    seq                 UInt64,                  -- Position in the (chain_id, tenant_id) chain, from 1
+    batch_id            UUID,
+    event_count         UInt32,
+    first_timestamp     DateTime64(3),
+    last_timestamp      DateTime64(3),
+    events_hash         String,
+    prev_hash           String,
+    chain_hash          String,
+    created_at          DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = MergeTree()
+ORDER BY (tenant_id, chain_id, seq);
+
+-- Jobs re-applying the consumer's current enrichment to stored events, created through
+-- /api/v1/telemetry/reprocess and run by whichever consumer claims them. Every state change and
+-- checkpoint inserts a new version of the job; the ReplacingMergeTree keeps the latest.
+CREATE TABLE IF NOT EXISTS telemetry_reprocess_jobs
+(
+    tenant_id            String,
+    job_id               String,
+    start_time           DateTime64(3),
+    end_time             DateTime64(3),
+    enrichments          Array(String) DEFAULT [],                 -- geoip, rdns, reputation, mitre
+    status               LowCardinality(String) DEFAULT 'pending', -- pending, running, completed, failed, cancelled
+    claimed_by           String DEFAULT '',                        -- Consumer instance running the job
+    total_partitions     UInt32 DEFAULT 0,
+    done_partitions      UInt32 DEFAULT 0,                         -- Checkpoint; monthly partitions are reprocessed in order
+    total_events         UInt64 DEFAULT 0,
+    processed_events     UInt64 DEFAULT 0,
+    error                String DEFAULT '',
+    requested_by         String DEFAULT '',
+    created_at           DateTime64(3) DEFAULT now64(3),
+    started_at           Nullable(DateTime64(3)),
+    finished_at          Nullable(DateTime64(3)),
+    updated_at           DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (tenant_id, job_id);
+
 -- Create table for DLP policy fingerprints (used by agent for Exact Data Match)
 CREATE TABLE IF NOT EXISTS dlp_fingerprints
 (